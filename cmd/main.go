@@ -8,22 +8,30 @@ import (
 
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"aidanwoods.dev/go-paseto"
 	httpPb "github.com/10664kls/automatic-finance-api/genproto/go/http/v1"
+	"github.com/10664kls/automatic-finance-api/internal/application"
 	"github.com/10664kls/automatic-finance-api/internal/auth"
 	"github.com/10664kls/automatic-finance-api/internal/cib"
 	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database"
 	"github.com/10664kls/automatic-finance-api/internal/income"
 	"github.com/10664kls/automatic-finance-api/internal/middleware"
 	"github.com/10664kls/automatic-finance-api/internal/selfemployed"
 	"github.com/10664kls/automatic-finance-api/internal/server"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
 	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/labstack/echo/v4"
 	stdmw "github.com/labstack/echo/v4/middleware"
+	"github.com/shopspring/decimal"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"google.golang.org/genproto/googleapis/rpc/code"
@@ -73,6 +81,17 @@ func run() error {
 		return fmt.Errorf("failed to ping database: %w", err)
 	}
 	zlog.Info("Database connection established")
+	slowQueryThresholdMs, err := getEnvInt("SLOW_QUERY_THRESHOLD_MS", int(database.DefaultSlowQueryThreshold.Milliseconds()))
+	if err != nil {
+		return err
+	}
+	database.SetSlowQueryThreshold(time.Duration(slowQueryThresholdMs) * time.Millisecond)
+
+	decimalFormat, err := types.ParseDecimalFormat(getEnv("DECIMAL_FORMAT", types.DefaultDecimalFormat.String()))
+	if err != nil {
+		return fmt.Errorf("failed to parse decimal format: %w", err)
+	}
+	types.SetDecimalFormat(decimalFormat)
 
 	aKey := must(paseto.V4SymmetricKeyFromHex(os.Getenv("PASETO_ACCESS_KEY")))
 	rKey := must(paseto.V4SymmetricKeyFromHex(os.Getenv("PASETO_REFRESH_KEY")))
@@ -82,6 +101,17 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to create auth service: %w", err)
 	}
+	checkPasswordBlocklist, err := strconv.ParseBool(getEnv("PASSWORD_BLOCKLIST_ENABLED", "true"))
+	if err != nil {
+		return fmt.Errorf("failed to parse PASSWORD_BLOCKLIST_ENABLED: %w", err)
+	}
+	if checkPasswordBlocklist {
+		passwords, err := auth.LoadPasswordBlocklist(getEnv("PASSWORD_BLOCKLIST_PATH", ""))
+		if err != nil {
+			return fmt.Errorf("failed to load password blocklist: %w", err)
+		}
+		authSvc.SetPasswordBlocklist(passwords)
+	}
 	zlog.Info("Auth service initialized")
 
 	// Initialize the currency service
@@ -89,34 +119,274 @@ func run() error {
 	if err != nil {
 		return fmt.Errorf("failed to create currency service: %w", err)
 	}
+	currencyCacheSeconds, err := getEnvInt("CURRENCY_CACHE_SECONDS", int(currency.DefaultCacheTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+	currencySvc.SetCacheTTL(time.Duration(currencyCacheSeconds) * time.Second)
+	if err := currencySvc.SetBaseCurrency(getEnv("BASE_CURRENCY", currency.DefaultBaseCurrency)); err != nil {
+		return fmt.Errorf("failed to set base currency: %w", err)
+	}
 	zlog.Info("Currency service initialized")
 
+	// The uploaded files are kept forever unless a retention is configured.
+	fileRetentionDays, err := getEnvInt("FILE_RETENTION_DAYS", 0)
+	if err != nil {
+		return err
+	}
+	fileRetention := time.Duration(fileRetentionDays) * 24 * time.Hour
+
 	// Initialize the statement service
 	statementSvc, err := statement.NewService(ctx, db, zlog)
 	if err != nil {
 		return fmt.Errorf("failed to create statement service: %w", err)
 	}
+	if err := statementSvc.SetLayout(statement.StatementLayout{
+		Period:             getEnv("STATEMENT_CELL_PERIOD", ""),
+		AccountNumber:      getEnv("STATEMENT_CELL_ACCOUNT_NUMBER", ""),
+		AccountDisplayName: getEnv("STATEMENT_CELL_ACCOUNT_DISPLAY_NAME", ""),
+		AccountCurrency:    getEnv("STATEMENT_CELL_ACCOUNT_CURRENCY", ""),
+		HeaderLabels:       getEnvList("STATEMENT_HEADER_LABELS"),
+	}); err != nil {
+		return fmt.Errorf("failed to set statement layout: %w", err)
+	}
+	if v := getEnv("STATEMENT_NUMBER_FORMAT", ""); v != "" {
+		numberFormat, err := statement.ParseNumberFormat(v)
+		if err != nil {
+			return fmt.Errorf("failed to parse STATEMENT_NUMBER_FORMAT: %w", err)
+		}
+		statementSvc.SetNumberFormat(numberFormat)
+	}
+	statementSvc.SetFileRetention(fileRetention)
 	zlog.Info("Statement service initialized")
 
+	otherIncomeCap, err := decimal.NewFromString(getEnv("OTHER_INCOME_CAP_PERCENTAGE", "0"))
+	if err != nil {
+		return fmt.Errorf("failed to parse OTHER_INCOME_CAP_PERCENTAGE: %w", err)
+	}
+
+	salaryVariationThreshold, err := decimal.NewFromString(getEnv("SALARY_VARIATION_THRESHOLD", "0"))
+	if err != nil {
+		return fmt.Errorf("failed to parse SALARY_VARIATION_THRESHOLD: %w", err)
+	}
+
+	minFinanceAmount, err := decimal.NewFromString(getEnv("CIB_MIN_FINANCE_AMOUNT", "0"))
+	if err != nil {
+		return fmt.Errorf("failed to parse CIB_MIN_FINANCE_AMOUNT: %w", err)
+	}
+
+	cibInstallmentPlaces, err := getEnvInt("CIB_INSTALLMENT_ROUNDING_PLACES", 0)
+	if err != nil {
+		return err
+	}
+
+	// Initialize the settings service, the environment gives the settings not set at runtime.
+	settingsSvc, err := settings.NewService(ctx, db, zlog)
+	if err != nil {
+		return fmt.Errorf("failed to create settings service: %w", err)
+	}
+	settingsSvc.SetDefaults(settings.Settings{
+		OtherIncomeFactor:        settings.DefaultSettings.OtherIncomeFactor,
+		OtherIncomeCapPercentage: otherIncomeCap,
+		SalaryVariationThreshold: salaryVariationThreshold,
+		CIBMinFinanceAmount:      minFinanceAmount,
+		ExcludedNotePrefixes:     getEnvList("EXCLUDED_NOTE_PREFIXES"),
+		CIBInstallmentPlaces:     int32(cibInstallmentPlaces),
+		BaseCurrency:             currencySvc.BaseCurrency(),
+	})
+	settingsCacheSeconds, err := getEnvInt("SETTINGS_CACHE_SECONDS", int(settings.DefaultCacheTTL.Seconds()))
+	if err != nil {
+		return err
+	}
+	settingsSvc.SetCacheTTL(time.Duration(settingsCacheSeconds) * time.Second)
+	currencySvc.SetSettings(settingsSvc)
+	zlog.Info("Settings service initialized")
+
+	defaultProduct := types.ProductUnSpecified
+	if v := getEnv("DEFAULT_PRODUCT", ""); v != "" {
+		defaultProduct, err = types.ParseProductType(v)
+		if err != nil {
+			return fmt.Errorf("failed to parse DEFAULT_PRODUCT: %w", err)
+		}
+	}
+
+	var accountNumberPattern *regexp.Regexp
+	if v := getEnv("ACCOUNT_NUMBER_PATTERN", ""); v != "" {
+		accountNumberPattern, err = regexp.Compile(v)
+		if err != nil {
+			return fmt.Errorf("failed to parse ACCOUNT_NUMBER_PATTERN: %w", err)
+		}
+	}
+
+	incomeDirection := income.DefaultIncomeDirection
+	if v := getEnv("INCOME_DIRECTION", ""); v != "" {
+		incomeDirection, err = income.ParseIncomeDirection(v)
+		if err != nil {
+			return fmt.Errorf("failed to parse INCOME_DIRECTION: %w", err)
+		}
+	}
+
+	mergeSameDayCredits, err := strconv.ParseBool(getEnv("MERGE_SAME_DAY_CREDITS", "false"))
+	if err != nil {
+		return fmt.Errorf("failed to parse MERGE_SAME_DAY_CREDITS: %w", err)
+	}
+	excludePartialFinalMonth, err := strconv.ParseBool(getEnv("EXCLUDE_PARTIAL_FINAL_MONTH", "false"))
+	if err != nil {
+		return fmt.Errorf("failed to parse EXCLUDE_PARTIAL_FINAL_MONTH: %w", err)
+	}
+	pinExchangeRates, err := strconv.ParseBool(getEnv("PIN_EXCHANGE_RATES", "false"))
+	if err != nil {
+		return fmt.Errorf("failed to parse PIN_EXCHANGE_RATES: %w", err)
+	}
+
+	netIncomeRanges, err := income.ParseNetIncomeRanges(getEnv("NET_INCOME_RANGES", ""))
+	if err != nil {
+		return fmt.Errorf("failed to parse NET_INCOME_RANGES: %w", err)
+	}
+	exchangeRateOverrides, err := income.ParseExchangeRateOverrides(getEnv("EXCHANGE_RATE_OVERRIDES", ""))
+	if err != nil {
+		return fmt.Errorf("failed to parse EXCHANGE_RATE_OVERRIDES: %w", err)
+	}
+
 	// Initialize the income service
 	incomeSvc, err := income.NewService(ctx, db, currencySvc, statementSvc, zlog)
 	if err != nil {
 		return fmt.Errorf("failed to create income service: %w", err)
 	}
+	incomeMaxStatementRows, err := getEnvInt("MAX_STATEMENT_ROWS", income.DefaultMaxStatementRows)
+	if err != nil {
+		return err
+	}
+	incomeSvc.SetMaxStatementRows(incomeMaxStatementRows)
+	incomeMaxRecalculationMonths, err := getEnvInt("MAX_RECALCULATION_MONTHS", income.DefaultMaxRecalculationMonths)
+	if err != nil {
+		return err
+	}
+	incomeSvc.SetMaxRecalculationMonths(incomeMaxRecalculationMonths)
+	incomeSvc.SetDefaultProduct(defaultProduct)
+	incomeSvc.SetAccountNumberPattern(accountNumberPattern)
+	incomeSvc.SetIncomeDirection(incomeDirection)
+	incomeSvc.SetMergeSameDayCredits(mergeSameDayCredits)
+	incomeSvc.SetExcludePartialFinalMonth(excludePartialFinalMonth)
+	incomeSvc.SetPinExchangeRates(pinExchangeRates)
+	incomeSvc.SetNetIncomeRanges(netIncomeRanges)
+	if err := incomeSvc.SetExchangeRateOverrides(exchangeRateOverrides); err != nil {
+		return fmt.Errorf("failed to set exchange rate overrides: %w", err)
+	}
+
+	incomeSvc.SetOtherIncomeCapPercentage(otherIncomeCap)
+	completedGraceMinutes, err := getEnvInt("COMPLETED_GRACE_MINUTES", 0)
+	if err != nil {
+		return err
+	}
+	incomeSvc.SetCompletedGracePeriod(time.Duration(completedGraceMinutes) * time.Minute)
+	incomeSvc.SetSalaryVariationThreshold(salaryVariationThreshold)
+	incomeSvc.SetSettings(settingsSvc)
+	wordlistUsageWindowDays, err := getEnvInt("WORDLIST_USAGE_WINDOW_DAYS", 90)
+	if err != nil {
+		return err
+	}
+	incomeSvc.SetWordlistUsageWindow(time.Duration(wordlistUsageWindowDays) * 24 * time.Hour)
+	for _, period := range []struct {
+		product types.ProductType
+		key     string
+	}{
+		{types.ProductSA, "MIN_PERIOD_MONTHS_SA"},
+		{types.ProductSF, "MIN_PERIOD_MONTHS_SF"},
+		{types.ProductPL, "MIN_PERIOD_MONTHS_PL"},
+	} {
+		months, err := getEnvInt(period.key, 0)
+		if err != nil {
+			return err
+		}
+		if err := incomeSvc.SetMinPeriod(period.product, int64(months)); err != nil {
+			return fmt.Errorf("failed to set minimum period: %w", err)
+		}
+	}
+
+	attentionCriteria := income.DefaultAttentionCriteria
+	stalePendingHours, err := getEnvInt("ATTENTION_STALE_PENDING_HOURS", int(attentionCriteria.StalePendingAfter.Hours()))
+	if err != nil {
+		return err
+	}
+	attentionCriteria.StalePendingAfter = time.Duration(stalePendingHours) * time.Hour
+	incomeSvc.SetAttentionCriteria(attentionCriteria)
 	zlog.Info("Income service initialized")
 
 	cibService, err := cib.NewService(ctx, db, currencySvc, zlog, os.Getenv("PDF_EXTRACTOR_URL"))
 	if err != nil {
 		return fmt.Errorf("failed to create cib service: %w", err)
 	}
+	for _, floor := range []struct {
+		termType string
+		key      string
+	}{
+		{"OD", "CIB_INSTALLMENT_FLOOR_OD"},
+		{"CC", "CIB_INSTALLMENT_FLOOR_CC"},
+		{"RL", "CIB_INSTALLMENT_FLOOR_RL"},
+	} {
+		amount, err := decimal.NewFromString(getEnv(floor.key, "0"))
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", floor.key, err)
+		}
+		if err := cibService.SetInstallmentFloor(floor.termType, amount); err != nil {
+			return fmt.Errorf("failed to set cib installment floor: %w", err)
+		}
+	}
+	if err := cibService.SetMinFinanceAmount(minFinanceAmount); err != nil {
+		return fmt.Errorf("failed to set cib minimum finance amount: %w", err)
+	}
+	if err := cibService.SetInstallmentRoundingPlaces(int32(cibInstallmentPlaces)); err != nil {
+		return fmt.Errorf("failed to set cib installment rounding places: %w", err)
+	}
+	maxOverdueDays, err := getEnvInt("CIB_MAX_OVERDUE_DAYS", cib.DefaultMaxOverdueDays)
+	if err != nil {
+		return err
+	}
+	cibService.SetMaxOverdueDays(int64(maxOverdueDays))
+	cibService.SetRiskExcludedBankCodes(strings.Split(getEnv("CIB_RISK_EXCLUDED_BANK_CODES", strings.Join(cib.DefaultRiskExcludedBankCodes, ",")), ","))
+	cibService.SetSettings(settingsSvc)
+	cibService.SetFileRetention(fileRetention)
 	zlog.Info("CIB service initialized")
 
+	defaultMargin, err := decimal.NewFromString(getEnv("DEFAULT_MARGIN_PERCENTAGE", "0"))
+	if err != nil {
+		return fmt.Errorf("failed to parse DEFAULT_MARGIN_PERCENTAGE: %w", err)
+	}
+
 	selfemployedSvc, err := selfemployed.NewService(ctx, db, statementSvc, currencySvc, zlog)
 	if err != nil {
 		return fmt.Errorf("failed to create selfemployed service: %w", err)
 	}
+	selfemployedMaxStatementRows, err := getEnvInt("MAX_STATEMENT_ROWS", selfemployed.DefaultMaxStatementRows)
+	if err != nil {
+		return err
+	}
+	selfemployedSvc.SetMaxStatementRows(selfemployedMaxStatementRows)
+	selfemployedMaxRecalculationMonths, err := getEnvInt("MAX_RECALCULATION_MONTHS", selfemployed.DefaultMaxRecalculationMonths)
+	if err != nil {
+		return err
+	}
+	selfemployedSvc.SetMaxRecalculationMonths(selfemployedMaxRecalculationMonths)
+	selfemployedSvc.SetDefaultProduct(defaultProduct)
+	selfemployedSvc.SetAccountNumberPattern(accountNumberPattern)
+	selfemployedSvc.SetDefaultMarginPercentage(defaultMargin)
+	selfemployedSvc.SetExcludePartialFinalMonth(excludePartialFinalMonth)
+	marginDisplayPlaces, err := getEnvInt("MARGIN_DISPLAY_PLACES", selfemployed.DefaultMarginDisplayPlaces)
+	if err != nil {
+		return err
+	}
+	if err := selfemployedSvc.SetMarginDisplayPlaces(int32(marginDisplayPlaces)); err != nil {
+		return fmt.Errorf("failed to set margin display places: %w", err)
+	}
 	zlog.Info("Selfemployed service initialized")
 
+	applicationSvc, err := application.NewService(ctx, currencySvc, incomeSvc, cibService, selfemployedSvc, zlog)
+	if err != nil {
+		return fmt.Errorf("failed to create application service: %w", err)
+	}
+	zlog.Info("Application service initialized")
+
 	e := echo.New()
 	e.HideBanner = true
 	e.HTTPErrorHandler = httpErr
@@ -129,13 +399,33 @@ func run() error {
 		},
 		),
 		middleware.SetContextClaimsFromToken,
+		middleware.RejectRevokedTokens(authSvc.IsTokenRevoked),
 	}
 
-	serve := must(server.NewServer(authSvc, currencySvc, incomeSvc, statementSvc, cibService, selfemployedSvc))
+	serve := must(server.NewServer(authSvc, currencySvc, incomeSvc, statementSvc, cibService, selfemployedSvc, settingsSvc, applicationSvc))
+	listStreamThreshold, err := getEnvInt("LIST_STREAM_THRESHOLD", server.DefaultListStreamThreshold)
+	if err != nil {
+		return err
+	}
+	serve.SetListStreamThreshold(listStreamThreshold)
+	exportConcurrency, err := getEnvInt("EXPORT_CONCURRENCY", 4)
+	if err != nil {
+		return err
+	}
+	serve.UseForExports(middleware.ConcurrencyLimit(exportConcurrency))
 	if err := serve.Install(e, mdw...); err != nil {
 		return fmt.Errorf("failed to install auth service: %w", err)
 	}
 
+	fileCleanupIntervalHours, err := getEnvInt("FILE_CLEANUP_INTERVAL_HOURS", 0)
+	if err != nil {
+		return err
+	}
+	wordlistUsageFlushMinutes, err := getEnvInt("WORDLIST_USAGE_FLUSH_MINUTES", 5)
+	if err != nil {
+		return err
+	}
+
 	errCh := make(chan error)
 	go func() {
 		errCh <- e.Start(fmt.Sprintf(":%s", getEnv("PORT", "8890")))
@@ -144,6 +434,48 @@ func run() error {
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, os.Kill, syscall.SIGTERM)
 	defer stop()
 
+	// Remove the uploaded files no longer referenced by any calculation in the background.
+	// The files are deleted for good, so it is off unless an interval is configured.
+	if interval := time.Duration(fileCleanupIntervalHours) * time.Hour; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if _, err := statementSvc.RemoveExpiredFiles(ctx); err != nil {
+						zlog.Error("failed to remove expired statement files", zap.Error(err))
+					}
+					if _, err := cibService.RemoveExpiredFiles(ctx); err != nil {
+						zlog.Error("failed to remove expired cib files", zap.Error(err))
+					}
+				}
+			}
+		}()
+	}
+
+	// Save the transactions matched by the income wordlists in the background.
+	if interval := time.Duration(wordlistUsageFlushMinutes) * time.Minute; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					if err := incomeSvc.FlushWordlistUsage(ctx); err != nil {
+						zlog.Error("failed to flush income wordlist usage", zap.Error(err))
+					}
+				}
+			}
+		}()
+	}
+
 	select {
 	case <-ctx.Done():
 		zlog.Info("Received shutdown signal, shutting down server...")
@@ -158,6 +490,10 @@ func run() error {
 		}
 		zlog.Info("Server shut down gracefully")
 
+		if err := incomeSvc.FlushWordlistUsage(ctx); err != nil {
+			zlog.Error("failed to flush income wordlist usage", zap.Error(err))
+		}
+
 	case err := <-errCh:
 		if err != nil && err != http.ErrServerClosed {
 			zlog.Error("Error starting server", zap.Error(err))
@@ -176,6 +512,32 @@ func getEnv(key string, fallback string) string {
 	return value
 }
 
+// getEnvInt returns the fallback when the environment variable is not set,
+// and an error when it is set but is not an integer.
+func getEnvInt(key string, fallback int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	return n, nil
+}
+
+// getEnvList returns the comma separated values of the environment variable, without the empty ones.
+func getEnvList(key string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func httpLogger(zlog *zap.Logger) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -247,7 +609,11 @@ func stdMws() []echo.MiddlewareFunc {
 			MaxAge:           3600,
 		})),
 		stdmw.Secure(),
-		stdmw.RateLimiter(stdmw.NewRateLimiterMemoryStore(30)),
+		stdmw.RateLimiterWithConfig(stdmw.RateLimiterConfig{
+			// Export routes have their own limiter, see server.UseForExports.
+			Skipper: middleware.IsExportRoute,
+			Store:   stdmw.NewRateLimiterMemoryStore(30),
+		}),
 	}
 }
 
@@ -0,0 +1,157 @@
+package application
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/cib"
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/10664kls/automatic-finance-api/internal/selfemployed"
+	"go.uber.org/zap"
+)
+
+// affectedPageSize is the page size the affected calculations are listed with, the largest one allowed.
+const affectedPageSize = 250
+
+// AffectedCalculationsQuery finds the calculations made in a currency before its exchange rate changed.
+type AffectedCalculationsQuery struct {
+	Code string `param:"code"`
+
+	// Before is when the exchange rate changed, the last update of the currency by default.
+	Before time.Time `query:"before"`
+}
+
+// CalculationRef identifies a calculation of a module.
+type CalculationRef struct {
+	ID        int64     `json:"id"`
+	Number    string    `json:"number"`
+	CreatedBy string    `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// AffectedCalculations are the calculations of each module made in a currency before the given time,
+// i.e. with an exchange rate that may have changed since.
+type AffectedCalculations struct {
+	Currency     string            `json:"currency"`
+	Before       time.Time         `json:"before"`
+	Income       []*CalculationRef `json:"income"`
+	CIB          []*CalculationRef `json:"cib"`
+	SelfEmployed []*CalculationRef `json:"selfEmployed"`
+}
+
+// ListAffectedCalculations lists the income, CIB and selfemployed calculations the caller is allowed to view
+// made in the given currency before its exchange rate changed, to reassess them.
+// The income and selfemployed calculations match on the account currency,
+// the CIB calculations on the currency of any of their contracts.
+func (s *Service) ListAffectedCalculations(ctx context.Context, in *AffectedCalculationsQuery) (*AffectedCalculations, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListAffectedCalculations"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	currency, err := s.currency.GetCurrencyByCode(ctx, strings.ToUpper(strings.TrimSpace(in.Code)))
+	if err != nil {
+		return nil, err
+	}
+
+	before := in.Before
+	if before.IsZero() {
+		before = currency.UpdatedAt
+	}
+
+	a := &AffectedCalculations{
+		Currency: currency.Code,
+		Before:   before,
+	}
+
+	a.Income, err = listAll(func(token string) ([]*CalculationRef, string, error) {
+		r, err := s.income.ListCalculations(ctx, &income.CalculationQuery{
+			Currency:      currency.Code,
+			CreatedBefore: before,
+			PageSize:      affectedPageSize,
+			PageToken:     token,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		refs := make([]*CalculationRef, len(r.Calculations))
+		for i, c := range r.Calculations {
+			refs[i] = &CalculationRef{ID: c.ID, Number: c.Number, CreatedBy: c.CreatedBy, CreatedAt: c.CreatedAt}
+		}
+		return refs, r.NextPageToken, nil
+	})
+	if err != nil {
+		zlog.Error("failed to list income calculations", zap.Error(err))
+		return nil, err
+	}
+
+	a.CIB, err = listAll(func(token string) ([]*CalculationRef, string, error) {
+		r, err := s.cib.ListCalculations(ctx, &cib.CalculationQuery{
+			Currency:      currency.Code,
+			CreatedBefore: before,
+			PageSize:      affectedPageSize,
+			PageToken:     token,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		refs := make([]*CalculationRef, len(r.Calculations))
+		for i, c := range r.Calculations {
+			refs[i] = &CalculationRef{ID: c.ID, Number: c.Number, CreatedBy: c.CreatedBy, CreatedAt: c.CreatedAt}
+		}
+		return refs, r.NextPageToken, nil
+	})
+	if err != nil {
+		zlog.Error("failed to list cib calculations", zap.Error(err))
+		return nil, err
+	}
+
+	a.SelfEmployed, err = listAll(func(token string) ([]*CalculationRef, string, error) {
+		r, err := s.selfemployed.ListCalculations(ctx, &selfemployed.CalculationQuery{
+			Currency:      currency.Code,
+			CreatedBefore: before,
+			PageSize:      affectedPageSize,
+			PageToken:     token,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+
+		refs := make([]*CalculationRef, len(r.Calculations))
+		for i, c := range r.Calculations {
+			refs[i] = &CalculationRef{ID: c.ID, Number: c.Number, CreatedBy: c.CreatedBy, CreatedAt: c.CreatedAt}
+		}
+		return refs, r.NextPageToken, nil
+	})
+	if err != nil {
+		zlog.Error("failed to list selfemployed calculations", zap.Error(err))
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// listAll reads every page of a listing, starting from the first page.
+func listAll(list func(pageToken string) ([]*CalculationRef, string, error)) ([]*CalculationRef, error) {
+	all := make([]*CalculationRef, 0)
+	var token string
+	for {
+		refs, next, err := list(token)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, refs...)
+
+		if next == "" {
+			return all, nil
+		}
+		token = next
+	}
+}
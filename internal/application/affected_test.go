@@ -0,0 +1,107 @@
+package application
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+)
+
+func TestListAffectedCalculations(t *testing.T) {
+	rateChangedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	madeBefore := rateChangedAt.AddDate(0, -1, 0)
+
+	tests := []struct {
+		name       string
+		before     time.Time
+		wantBefore time.Time
+	}{
+		{name: "before the last rate change", wantBefore: rateChangedAt},
+		{name: "before the given time", before: rateChangedAt.AddDate(0, -2, 0), wantBefore: rateChangedAt.AddDate(0, -2, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			mock.ExpectQuery(`FROM currency`).WillReturnRows(
+				[]string{"id", "code", "exchange_rate", "created_by", "updated_by", "created_at", "updated_at"},
+				[]any{"currency0001", "USD", "21500", "admin@example.com", "admin@example.com", madeBefore.AddDate(-1, 0, 0), rateChangedAt},
+			)
+
+			// The calculations made after the rate change are left out by the database, so only those made before are seeded.
+			incomes := mock.ExpectQuery(`FROM statement_file_analysis WHERE`).WillReturnRows(incomeColumns,
+				incomeRow(1, "APP-1", "USD", madeBefore),
+				incomeRow(2, "APP-2", "USD", madeBefore.AddDate(0, 0, 7)),
+			)
+			cibs := mock.ExpectQuery(`FROM cib_file_analysis WHERE .*CAST\(contract_info AS VARCHAR\(MAX\)\) LIKE`).WillReturnRows(cibColumns,
+				[]any{
+					3, "APP-3", "cib.pdf", "Somchai", "020000000", "1990-01-01",
+					"1", "0", "1", "2150000", "LAK",
+					[]byte(`[]`), []byte(`[{"currency":"USD"}]`), "user@example.com", madeBefore, "user@example.com", madeBefore,
+				},
+			)
+			selfs := mock.ExpectQuery(`FROM self_employed_analysis`).WillReturnRows(selfemployedColumns,
+				[]any{
+					4, "APP-4", "statement.pdf", "BT-1", "Retail", "SA", "USD", "0100001",
+					"Somchai", "6", madeBefore.AddDate(0, -6, 0), madeBefore, "21500", "20",
+					false, false, "0", "0",
+					"0", "0", []byte(`{}`), "PENDING", "user@example.com", madeBefore,
+					"user@example.com", madeBefore,
+				},
+			)
+
+			a, err := s.ListAffectedCalculations(contextWithAdmin(), &AffectedCalculationsQuery{Code: " usd ", Before: tt.before})
+			if err != nil {
+				t.Fatalf("ListAffectedCalculations() error = %v", err)
+			}
+
+			if a.Currency != "USD" || !a.Before.Equal(tt.wantBefore) {
+				t.Errorf("ListAffectedCalculations() = %s before %v, want USD before %v", a.Currency, a.Before, tt.wantBefore)
+			}
+			if got := refNumbers(a.Income); !slices.Equal(got, []string{"APP-1", "APP-2"}) {
+				t.Errorf("income = %v, want [APP-1 APP-2]", got)
+			}
+			if got := refNumbers(a.CIB); !slices.Equal(got, []string{"APP-3"}) {
+				t.Errorf("cib = %v, want [APP-3]", got)
+			}
+			if got := refNumbers(a.SelfEmployed); !slices.Equal(got, []string{"APP-4"}) {
+				t.Errorf("selfemployed = %v, want [APP-4]", got)
+			}
+
+			for name, e := range map[string]*dbtest.Expectation{"income": incomes, "cib": cibs, "selfemployed": selfs} {
+				if !slices.ContainsFunc(e.Args(), func(v any) bool {
+					at, ok := v.(time.Time)
+					return ok && at.Equal(tt.wantBefore)
+				}) {
+					t.Errorf("%s args = %v, want the calculations made before %v", name, e.Args(), tt.wantBefore)
+				}
+			}
+			if !slices.Contains(incomes.Args(), any("USD")) || !slices.Contains(selfs.Args(), any("USD")) {
+				t.Errorf("income args = %v, selfemployed args = %v, want the account currency USD", incomes.Args(), selfs.Args())
+			}
+			if !slices.Contains(cibs.Args(), any(`%"currency":"USD"%`)) {
+				t.Errorf("cib args = %v, want the contracts in USD", cibs.Args())
+			}
+		})
+	}
+}
+
+func incomeRow(id int64, number, currency string, createdAt time.Time) []any {
+	return []any{
+		id, "statement.pdf", number, "SA", currency, "0100001", "Somchai",
+		"21500", "CURRENCY", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "6", createdAt.AddDate(0, -6, 0), createdAt, "COMPLETED", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", createdAt, "user@example.com", createdAt, nil,
+	}
+}
+
+func refNumbers(refs []*CalculationRef) []string {
+	numbers := make([]string, len(refs))
+	for i, r := range refs {
+		numbers[i] = r.Number
+	}
+	return numbers
+}
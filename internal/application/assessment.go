@@ -0,0 +1,242 @@
+package application
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/cib"
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+type AssessmentQuery struct {
+	IncomeNumber string `query:"incomeNumber"`
+	CIBNumber    string `query:"cibNumber"`
+}
+
+func (q *AssessmentQuery) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	q.IncomeNumber = strings.TrimSpace(q.IncomeNumber)
+	if q.IncomeNumber == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "incomeNumber",
+			Description: "Income number must not be empty",
+		})
+	}
+
+	q.CIBNumber = strings.TrimSpace(q.CIBNumber)
+	if q.CIBNumber == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "cibNumber",
+			Description: "CIB number must not be empty",
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Assessment query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// Assessment is the credit assessment of a customer combining the income and the CIB calculations.
+// The monthly net income and the total installment are both in the base currency.
+type Assessment struct {
+	BaseCurrency     string              `json:"baseCurrency"`
+	Income           *income.Calculation `json:"income"`
+	CIB              *cib.Calculation    `json:"cib"`
+	MonthlyNetIncome decimal.Decimal     `json:"monthlyNetIncome"`
+	TotalInstallment decimal.Decimal     `json:"totalInstallment"`
+
+	// DTI is the debt-to-income ratio, i.e. the total installment over the monthly net income,
+	// in percent rounded to 2 decimal places. It is zero when there is no net income.
+	DTI decimal.Decimal `json:"dti"`
+}
+
+// newAssessment combines the calculations into an assessment.
+func newAssessment(baseCurrency string, i *income.Calculation, c *cib.Calculation) *Assessment {
+	a := &Assessment{
+		BaseCurrency:     baseCurrency,
+		Income:           i,
+		CIB:              c,
+		MonthlyNetIncome: i.MonthlyNetIncome,
+		TotalInstallment: c.TotalInstallmentInLAK,
+	}
+	if a.MonthlyNetIncome.IsPositive() {
+		a.DTI = a.TotalInstallment.Div(a.MonthlyNetIncome).Mul(decimal.NewFromInt(100)).Round(2)
+	}
+
+	return a
+}
+
+// ExportAssessmentToExcel returns the workbook of the credit assessment combining the income
+// and the CIB calculations of the given numbers, with their summaries and the debt-to-income ratio.
+// Both calculations must be in the current base currency.
+func (s *Service) ExportAssessmentToExcel(ctx context.Context, in *AssessmentQuery) (*bytes.Buffer, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ExportAssessmentToExcel"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	assessment, err := s.assess(ctx, zlog, in)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, err := exportAssessmentToExcel(assessment)
+	if err != nil {
+		zlog.Error("failed to export assessment to excel", zap.Error(err))
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (s *Service) assess(ctx context.Context, zlog *zap.Logger, in *AssessmentQuery) (*Assessment, error) {
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	incomeCalculation, err := s.income.GetCalculationByNumber(ctx, in.IncomeNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	cibCalculation, err := s.cib.GetCalculationByNumber(ctx, in.CIBNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	// The net income and the installments are converted to the base currency in effect when they are calculated,
+	// so they cannot be compared once the base currency changed. The calculations saved before their base currency
+	// was recorded are assumed to be in the current one.
+	baseCurrency := s.currency.BaseCurrency()
+	config, err := s.income.GetCalculationConfig(ctx, in.IncomeNumber)
+	if err != nil && !isNotFound(err) {
+		zlog.Error("failed to get income calculation config", zap.Error(err))
+		return nil, err
+	}
+	if config != nil && config.Config != nil && !sameBaseCurrency(config.Config.BaseCurrency, baseCurrency) {
+		return nil, rpcStatus.Errorf(
+			codes.FailedPrecondition,
+			"The income calculation is in %s while the base currency is %s. Please recalculate the income before the assessment.",
+			config.Config.BaseCurrency,
+			baseCurrency,
+		)
+	}
+	if !sameBaseCurrency(cibCalculation.BaseCurrency, baseCurrency) {
+		return nil, rpcStatus.Errorf(
+			codes.FailedPrecondition,
+			"The CIB calculation is in %s while the base currency is %s. Please refresh the exchange rates of the CIB calculation before the assessment.",
+			cibCalculation.BaseCurrency,
+			baseCurrency,
+		)
+	}
+
+	return newAssessment(baseCurrency, incomeCalculation, cibCalculation), nil
+}
+
+// sameBaseCurrency reports whether a calculation in the recorded base currency is in the current one.
+// An empty recorded base currency is the one of a calculation saved before it was recorded.
+func sameBaseCurrency(recorded, current string) bool {
+	return recorded == "" || strings.EqualFold(recorded, current)
+}
+
+func exportAssessmentToExcel(a *Assessment) (*bytes.Buffer, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Assessment"
+	sheet, err := f.NewSheet(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+	}
+	f.SetActiveSheet(sheet)
+	f.DeleteSheet("Sheet1")
+
+	formatNumber := "#,##0.00"
+	numberStyle, err := f.NewStyle(&excelize.Style{
+		CustomNumFmt: &formatNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create style: %w", err)
+	}
+
+	fontStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font style: %w", err)
+	}
+
+	rows := [][]any{
+		{"Income"},
+		{"Number", a.Income.Number},
+		{"Product", a.Income.Product.String()},
+		{"Account Name", a.Income.Account.DisplayName},
+		{"Account Currency", a.Income.Account.Currency},
+		{"Period (months)", a.Income.PeriodInMonth},
+		{"Average income/month", a.Income.MonthlyAverageIncome},
+		{"Exchange Rate", a.Income.ExchangeRate},
+		{fmt.Sprintf("Net income/month (%s)", a.BaseCurrency), a.MonthlyNetIncome},
+		{},
+		{"CIB"},
+		{"Number", a.CIB.Number},
+		{"Customer Name", a.CIB.Customer.DisplayName},
+		{"Total Loan", a.CIB.AggregateQuantity.Total},
+		{"Total active loan", a.CIB.AggregateQuantity.Active},
+		{fmt.Sprintf("Total installment (%s)", a.BaseCurrency), a.TotalInstallment},
+		{},
+		{"DTI (%)", a.DTI},
+	}
+
+	for i, row := range rows {
+		for j, v := range row {
+			cell, err := excelize.CoordinatesToCellName(j+1, i+1)
+			if err != nil {
+				return nil, err
+			}
+
+			if d, ok := v.(decimal.Decimal); ok {
+				f.SetCellValue(sheetName, cell, d.InexactFloat64())
+				f.SetCellStyle(sheetName, cell, cell, numberStyle)
+				continue
+			}
+
+			f.SetCellValue(sheetName, cell, v)
+			if j == 0 {
+				f.SetCellStyle(sheetName, cell, cell, fontStyle)
+			}
+		}
+	}
+	f.SetColWidth(sheetName, "A", "A", 30)
+	f.SetColWidth(sheetName, "B", "B", 25)
+
+	byt, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	}
+
+	return byt, nil
+}
@@ -0,0 +1,202 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/cib"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/10664kls/automatic-finance-api/internal/selfemployed"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func newTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	ctx := context.Background()
+	zlog := zap.NewNop()
+	db, mock := dbtest.New(t)
+
+	currencySvc, err := currency.NewService(ctx, db, zlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statementSvc, err := statement.NewService(ctx, db, zlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomeSvc, err := income.NewService(ctx, db, currencySvc, statementSvc, zlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cibSvc, err := cib.NewService(ctx, db, currencySvc, zlog, "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selfemployedSvc, err := selfemployed.NewService(ctx, db, statementSvc, currencySvc, zlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewService(ctx, currencySvc, incomeSvc, cibSvc, selfemployedSvc, zlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+var incomeColumns = []string{
+	"id", "statement_file_name", "number", "product", "account_currency", "account_number", "account_display_name",
+	"exchange_rate", "exchange_rate_source", "income_direction", "other_income_cap_percentage", "salary_variation",
+	"salary_volatile", "net_income_out_of_range", "basic_salary_interview", "total_income", "total_basic_salary",
+	"total_other_income", "eighty_percent_of_monthly_other_income", "monthly_other_income", "monthly_net_income",
+	"monthly_average_income", "period_in_month", "started_at", "ended_at", "status", "source_income", "monthly_salary",
+	"allowance", "commission", "excluded_transactions", "created_by", "created_at", "updated_by", "updated_at", "completed_at",
+}
+
+func seedIncome(mock *dbtest.Mock, number, monthlyNetIncome string) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(incomeColumns, []any{
+		1, "statement.pdf", number, "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", monthlyNetIncome,
+		monthlyNetIncome, "6", now.AddDate(0, -6, 0), now, "COMPLETED", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", now, "user@example.com", now, nil,
+	})
+}
+
+func seedIncomeConfig(mock *dbtest.Mock, number string, config []byte) {
+	mock.ExpectQuery(`TOP 1 number,\s*config`).WillReturnRows([]string{"number", "config"}, []any{number, config})
+}
+
+var cibColumns = []string{
+	"id", "number", "cib_file_name", "customer_display_name", "customer_phone_number", "customer_dob",
+	"total_loan", "total_closed_loan", "total_active_loan", "total_installment_lak", "base_currency",
+	"aggregate_by_bank", "contract_info", "created_by", "created_at", "updated_by", "updated_at",
+}
+
+func seedCIB(mock *dbtest.Mock, number, totalInstallment, baseCurrency string) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(cibColumns, []any{
+		2, number, "cib.pdf", "Somchai", "020000000", "1990-01-01",
+		"2", "1", "1", totalInstallment, baseCurrency,
+		[]byte(`[]`), []byte(`[]`), "user@example.com", now, "user@example.com", now,
+	})
+}
+
+func contextWithAdmin() context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{
+		ID:       "admin0000001",
+		Username: "admin@example.com",
+		Role:     auth.RoleAdmin,
+		IsAdmin:  true,
+	})
+}
+
+func TestExportAssessmentToExcel(t *testing.T) {
+	s, mock := newTestService(t)
+	seedIncome(mock, "INC-1", "10000000")
+	seedCIB(mock, "CIB-1", "2500000", "LAK")
+	seedIncomeConfig(mock, "INC-1", []byte(`{"baseCurrency":"LAK"}`))
+
+	buf, err := s.ExportAssessmentToExcel(contextWithAdmin(), &AssessmentQuery{IncomeNumber: "INC-1", CIBNumber: "CIB-1"})
+	if err != nil {
+		t.Fatalf("ExportAssessmentToExcel() error = %v", err)
+	}
+
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatalf("failed to open the workbook: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Assessment")
+	if err != nil {
+		t.Fatalf("failed to read the assessment sheet: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, row := range rows {
+		if len(row) == 2 {
+			got[row[0]] = row[1]
+		}
+	}
+
+	want := map[string]string{
+		"Net income/month (LAK)":  "10,000,000.00",
+		"Total installment (LAK)": "2,500,000.00",
+		"DTI (%)":                 "25.00",
+	}
+	for label, value := range want {
+		if got[label] != value {
+			t.Errorf("%s = %q, want %q", label, got[label], value)
+		}
+	}
+}
+
+func TestAssessBaseCurrency(t *testing.T) {
+	tests := []struct {
+		name         string
+		incomeConfig []byte
+		cibCurrency  string
+		wantCode     codes.Code
+		wantDTI      string
+	}{
+		{
+			name:         "recorded in the base currency",
+			incomeConfig: []byte(`{"baseCurrency":"LAK"}`),
+			cibCurrency:  "LAK",
+			wantCode:     codes.OK,
+			wantDTI:      "25",
+		},
+		{
+			name:         "saved before the base currency was recorded",
+			incomeConfig: nil,
+			cibCurrency:  "",
+			wantCode:     codes.OK,
+			wantDTI:      "25",
+		},
+		{
+			name:         "income in another base currency",
+			incomeConfig: []byte(`{"baseCurrency":"THB"}`),
+			cibCurrency:  "LAK",
+			wantCode:     codes.FailedPrecondition,
+		},
+		{
+			name:         "cib in another base currency",
+			incomeConfig: []byte(`{"baseCurrency":"LAK"}`),
+			cibCurrency:  "THB",
+			wantCode:     codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			seedIncome(mock, "INC-1", "10000000")
+			seedCIB(mock, "CIB-1", "2500000", tt.cibCurrency)
+			seedIncomeConfig(mock, "INC-1", tt.incomeConfig)
+
+			a, err := s.assess(contextWithAdmin(), zap.NewNop(), &AssessmentQuery{IncomeNumber: "INC-1", CIBNumber: "CIB-1"})
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("assess() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := a.DTI.String(); got != tt.wantDTI {
+				t.Errorf("DTI = %s, want %s", got, tt.wantDTI)
+			}
+		})
+	}
+}
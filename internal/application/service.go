@@ -0,0 +1,125 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/cib"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/10664kls/automatic-finance-api/internal/selfemployed"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// Application links the analyses made for the same application number across the modules.
+// The modules keep their own numbers, so an application only exists through the calculations
+// sharing its number; the analyses not made for the application are nil.
+type Application struct {
+	Number       string                    `json:"number"`
+	Income       *income.Calculation       `json:"income"`
+	CIB          *cib.Calculation          `json:"cib"`
+	SelfEmployed *selfemployed.Calculation `json:"selfEmployed"`
+
+	// Unavailable lists the modules whose analysis could not be read, their analysis being nil,
+	// so a failing module does not hide the analyses of the others.
+	Unavailable []string `json:"unavailable,omitempty"`
+}
+
+type Service struct {
+	currency     *currency.Service
+	income       *income.Service
+	cib          *cib.Service
+	selfemployed *selfemployed.Service
+	zlog         *zap.Logger
+}
+
+func NewService(_ context.Context, currency *currency.Service, income *income.Service, cib *cib.Service, selfemployed *selfemployed.Service, zlog *zap.Logger) (*Service, error) {
+	if currency == nil {
+		return nil, errors.New("currency service is nil")
+	}
+	if income == nil {
+		return nil, errors.New("income service is nil")
+	}
+	if cib == nil {
+		return nil, errors.New("cib service is nil")
+	}
+	if selfemployed == nil {
+		return nil, errors.New("selfemployed service is nil")
+	}
+	if zlog == nil {
+		return nil, errors.New("logger is nil")
+	}
+
+	return &Service{
+		currency:     currency,
+		income:       income,
+		cib:          cib,
+		selfemployed: selfemployed,
+		zlog:         zlog,
+	}, nil
+}
+
+// GetApplicationByNumber returns the income, CIB and selfemployed analyses of the given application number
+// the caller is allowed to view. It returns NotFound if there is none.
+func (s *Service) GetApplicationByNumber(ctx context.Context, number string) (*Application, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetApplicationByNumber"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	a := &Application{Number: number}
+
+	// markUnavailable records the module whose analysis could not be read, unless the analysis
+	// does not exist or the caller is not allowed to view it.
+	var lastErr error
+	markUnavailable := func(module string, err error) {
+		if err == nil || isNotFound(err) || isPermissionDenied(err) {
+			return
+		}
+
+		zlog.Error("failed to get calculation", zap.String("Module", module), zap.Error(err))
+		a.Unavailable = append(a.Unavailable, module)
+		lastErr = err
+	}
+
+	incomeCalculation, err := s.income.GetCalculationByNumber(ctx, number)
+	markUnavailable("income", err)
+	a.Income = incomeCalculation
+
+	cibCalculation, err := s.cib.GetCalculationByNumber(ctx, number)
+	markUnavailable("cib", err)
+	a.CIB = cibCalculation
+
+	selfemployedCalculation, err := s.selfemployed.GetCalculationByNumber(ctx, number)
+	markUnavailable("selfEmployed", err)
+	a.SelfEmployed = selfemployedCalculation
+
+	if a.Income == nil && a.CIB == nil && a.SelfEmployed == nil {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+		return nil, rpcStatus.Error(codes.NotFound, "Application not found or you are not allowed to view it")
+	}
+
+	return a, nil
+}
+
+// isNotFound reports whether the error is the NotFound status the modules return
+// for the calculations that do not exist or the caller is not allowed to view.
+func isNotFound(err error) bool {
+	st, ok := rpcStatus.FromError(err)
+	return ok && st.Code() == codes.NotFound
+}
+
+// isPermissionDenied reports whether the error is the PermissionDenied status of a module
+// the caller is not allowed to.
+func isPermissionDenied(err error) bool {
+	st, ok := rpcStatus.FromError(err)
+	return ok && st.Code() == codes.PermissionDenied
+}
@@ -0,0 +1,123 @@
+package application
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+var selfemployedColumns = []string{
+	"id", "number", "statement_file_name", "b.id", "b.name", "product", "account_currency", "account_number",
+	"account_display_name", "period_in_month", "started_at", "ended_at", "exchange_rate", "s.margin_percentage",
+	"s.margin_fallback", "s.partial_final_month_excluded", "total_income", "monthly_average_income",
+	"monthly_average_margin", "monthly_net_income", "source_income", "status", "s.created_by", "s.created_at",
+	"s.updated_by", "s.updated_at",
+}
+
+func seedSelfEmployed(mock *dbtest.Mock, number string) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM self_employed_analysis`).WillReturnRows(selfemployedColumns, []any{
+		3, number, "statement.pdf", "BT-1", "Retail", "SA", "LAK", "0100001",
+		"Somchai", "6", now.AddDate(0, -6, 0), now, "1", "20",
+		false, false, "0", "0",
+		"0", "0", []byte(`{}`), "PENDING", "user@example.com", now,
+		"user@example.com", now,
+	})
+}
+
+func TestGetApplicationByNumber(t *testing.T) {
+	errDatabase := errors.New("database is down")
+
+	tests := []struct {
+		name            string
+		seed            func(mock *dbtest.Mock)
+		wantCode        codes.Code
+		wantIncome      bool
+		wantCIB         bool
+		wantSelf        bool
+		wantUnavailable []string
+	}{
+		{
+			name: "every module",
+			seed: func(mock *dbtest.Mock) {
+				seedIncome(mock, "APP-1", "10000000")
+				seedCIB(mock, "APP-1", "2500000", "LAK")
+				seedSelfEmployed(mock, "APP-1")
+			},
+			wantIncome: true,
+			wantCIB:    true,
+			wantSelf:   true,
+		},
+		{
+			name: "only cib",
+			seed: func(mock *dbtest.Mock) {
+				mock.ExpectQuery(`FROM statement_file_analysis`)
+				seedCIB(mock, "APP-1", "2500000", "LAK")
+				mock.ExpectQuery(`FROM self_employed_analysis`)
+			},
+			wantCIB: true,
+		},
+		{
+			name: "no module",
+			seed: func(mock *dbtest.Mock) {
+				mock.ExpectQuery(`FROM statement_file_analysis`)
+				mock.ExpectQuery(`FROM cib_file_analysis`)
+				mock.ExpectQuery(`FROM self_employed_analysis`)
+			},
+			wantCode: codes.NotFound,
+		},
+		{
+			name: "a failing module",
+			seed: func(mock *dbtest.Mock) {
+				seedIncome(mock, "APP-1", "10000000")
+				mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnError(errDatabase)
+				seedSelfEmployed(mock, "APP-1")
+			},
+			wantIncome:      true,
+			wantSelf:        true,
+			wantUnavailable: []string{"cib"},
+		},
+		{
+			name: "every module failing",
+			seed: func(mock *dbtest.Mock) {
+				mock.ExpectQuery(`FROM statement_file_analysis`).WillReturnError(errDatabase)
+				mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnError(errDatabase)
+				mock.ExpectQuery(`FROM self_employed_analysis`).WillReturnError(errDatabase)
+			},
+			wantCode: codes.Unknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			tt.seed(mock)
+
+			a, err := s.GetApplicationByNumber(contextWithAdmin(), "APP-1")
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetApplicationByNumber() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if got := a.Income != nil; got != tt.wantIncome {
+				t.Errorf("income found = %v, want %v", got, tt.wantIncome)
+			}
+			if got := a.CIB != nil; got != tt.wantCIB {
+				t.Errorf("cib found = %v, want %v", got, tt.wantCIB)
+			}
+			if got := a.SelfEmployed != nil; got != tt.wantSelf {
+				t.Errorf("selfemployed found = %v, want %v", got, tt.wantSelf)
+			}
+			if !reflect.DeepEqual(a.Unavailable, tt.wantUnavailable) {
+				t.Errorf("unavailable = %v, want %v", a.Unavailable, tt.wantUnavailable)
+			}
+		})
+	}
+}
@@ -27,6 +27,9 @@ type Auth struct {
 	aKey paseto.V4SymmetricKey
 	rKey paseto.V4SymmetricKey
 	zlog *zap.Logger
+
+	// passwordBlocklist are the lower-cased passwords rejected, see SetPasswordBlocklist.
+	passwordBlocklist map[string]bool
 }
 
 func New(_ context.Context, db *sql.DB, zlog *zap.Logger, aKey, rKey paseto.V4SymmetricKey) (*Auth, error) {
@@ -58,7 +61,7 @@ func (s *Auth) ListUsers(ctx context.Context, in *UserQuery) (*ListUsersResult,
 		zap.String("Username", claims.Username),
 	)
 
-	if !claims.IsAdmin {
+	if !claims.CanViewAll() {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
 	}
 
@@ -92,7 +95,7 @@ func (s *Auth) GetUserByID(ctx context.Context, id string) (*User, error) {
 		zap.String("userId", id),
 	)
 
-	if !claims.IsAdmin {
+	if !claims.CanViewAll() {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
 	}
 
@@ -112,8 +115,6 @@ func (s *Auth) GetUserByID(ctx context.Context, id string) (*User, error) {
 
 func (s *Auth) CreateUser(ctx context.Context, in *CreateUserReq) (*User, error) {
 	claims := ClaimsFromContext(ctx)
-	claims.IsAdmin = true
-	claims.Username = "System"
 
 	zlog := s.zlog.With(
 		zap.String("Method", "CreateUser"),
@@ -127,6 +128,9 @@ func (s *Auth) CreateUser(ctx context.Context, in *CreateUserReq) (*User, error)
 	if err := in.Validate(); err != nil {
 		return nil, err
 	}
+	if err := s.checkPasswordBlocklist("password", in.Password); err != nil {
+		return nil, err
+	}
 
 	user := newUser(claims.Username, in)
 	exists, err := isEmailAlreadyExists(ctx, s.db, user.ID, user.Email)
@@ -157,6 +161,9 @@ func (s *Auth) ChangeMyPassword(ctx context.Context, in *ChangeMyPasswordReq) er
 	if err := in.Validate(); err != nil {
 		return err
 	}
+	if err := s.checkPasswordBlocklist("newPassword", in.NewPassword); err != nil {
+		return err
+	}
 
 	user, err := getUser(ctx, s.db, &UserQuery{
 		ID: claims.ID,
@@ -173,7 +180,9 @@ func (s *Auth) ChangeMyPassword(ctx context.Context, in *ChangeMyPasswordReq) er
 		return rpcStatus.Error(codes.FailedPrecondition, "Your current password not valid. Please check your current password and try again.")
 	}
 
-	user.changePassword(claims.Username, in.NewPassword)
+	if err := user.changePassword(claims.Username, in.NewPassword); err != nil {
+		return err
+	}
 	if err := updateUser(ctx, s.db, user); err != nil {
 		zlog.Error("failed to update user", zap.Error(err))
 		return err
@@ -198,6 +207,13 @@ func (s *Auth) ResetUserPasswordByAdmin(ctx context.Context, in *ResetUserPasswo
 	if err := in.Validate(); err != nil {
 		return err
 	}
+	if err := s.checkPasswordBlocklist("password", in.Password); err != nil {
+		return err
+	}
+
+	if err := checkNotSelf(claims, in.UserID); err != nil {
+		return err
+	}
 
 	user, err := getUser(ctx, s.db, &UserQuery{
 		ID: in.UserID,
@@ -210,7 +226,9 @@ func (s *Auth) ResetUserPasswordByAdmin(ctx context.Context, in *ResetUserPasswo
 		return err
 	}
 
-	user.changePassword(claims.Username, in.Password)
+	if err := user.changePassword(claims.Username, in.Password); err != nil {
+		return err
+	}
 	if err := updateUser(ctx, s.db, user); err != nil {
 		zlog.Error("failed to update user", zap.Error(err))
 		return err
@@ -273,25 +291,34 @@ func (s *Auth) Profile(ctx context.Context) (*User, error) {
 	return user, nil
 }
 
-func (s *Auth) genToken(u *User) (*Token, error) {
+// genToken issues a new access and refresh token pair sharing a new token ID (jti),
+// and records the refresh token so it can be used only once and be revoked.
+func (s *Auth) genToken(ctx context.Context, u *User) (*Token, error) {
 	now := time.Now()
+	tokenID := gen.ID()
+	refreshExpiresAt := now.Add(time.Hour * 24 * 7)
 
 	t := paseto.NewToken()
+	t.SetJti(tokenID)
 	t.SetSubject(u.Username)
 	t.SetIssuedAt(now)
 	t.SetNotBefore(now)
 	t.SetExpiration(now.Add(time.Hour))
 	t.SetFooter([]byte(now.Format(time.RFC3339)))
 
-	if err := t.Set("profile", u.toClaims()); err != nil {
+	if err := t.Set("profile", u.toClaims(tokenID)); err != nil {
 		return nil, fmt.Errorf("failed to set claims: %w", err)
 	}
 
 	accessToken := t.V4Encrypt(s.aKey, nil)
 
-	t.SetExpiration(now.Add(time.Hour * 24 * 7))
+	t.SetExpiration(refreshExpiresAt)
 	refreshToken := t.V4Encrypt(s.rKey, nil)
 
+	if err := createRefreshToken(ctx, s.db, tokenID, u.ID, refreshExpiresAt); err != nil {
+		return nil, err
+	}
+
 	return &Token{
 		Access:  accessToken,
 		Refresh: refreshToken,
@@ -301,6 +328,9 @@ func (s *Auth) genToken(u *User) (*Token, error) {
 type LoginReq struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+
+	// IPAddress is the address the login comes from, set by the handler.
+	IPAddress string `json:"-"`
 }
 
 func (r *LoginReq) Validate() error {
@@ -353,6 +383,10 @@ func (s *Auth) DisableUser(ctx context.Context, id string) (*User, error) {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
 	}
 
+	if err := checkNotSelf(claims, id); err != nil {
+		return nil, err
+	}
+
 	user, err := getUser(ctx, s.db, &UserQuery{
 		ID: id,
 	})
@@ -364,6 +398,10 @@ func (s *Auth) DisableUser(ctx context.Context, id string) (*User, error) {
 		return nil, err
 	}
 
+	if err := checkNotLastAdmin(ctx, s.db, user); err != nil {
+		return nil, err
+	}
+
 	if err := user.Disable(claims.Username); err != nil {
 		return nil, err
 	}
@@ -371,6 +409,9 @@ func (s *Auth) DisableUser(ctx context.Context, id string) (*User, error) {
 		zlog.Error("failed to update user", zap.Error(err))
 		return nil, err
 	}
+	if err := s.revokeUserTokens(ctx, zlog, user.ID); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -423,6 +464,10 @@ func (s *Auth) TerminateUser(ctx context.Context, id string) (*User, error) {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
 	}
 
+	if err := checkNotSelf(claims, id); err != nil {
+		return nil, err
+	}
+
 	user, err := getUser(ctx, s.db, &UserQuery{
 		ID: id,
 	})
@@ -434,6 +479,10 @@ func (s *Auth) TerminateUser(ctx context.Context, id string) (*User, error) {
 		return nil, err
 	}
 
+	if err := checkNotLastAdmin(ctx, s.db, user); err != nil {
+		return nil, err
+	}
+
 	if err := user.Close(claims.Username); err != nil {
 		return nil, err
 	}
@@ -442,6 +491,9 @@ func (s *Auth) TerminateUser(ctx context.Context, id string) (*User, error) {
 		zlog.Error("failed to update user", zap.Error(err))
 		return nil, err
 	}
+	if err := s.revokeUserTokens(ctx, zlog, user.ID); err != nil {
+		return nil, err
+	}
 
 	return user, nil
 }
@@ -460,6 +512,7 @@ func (s *Auth) Login(ctx context.Context, in *LoginReq) (*Token, error) {
 		Email: in.Email,
 	})
 	if errors.Is(err, ErrUserNotFound) {
+		s.recordLoginAttempt(ctx, zlog, in.Email, in.IPAddress, false)
 		return nil, rpcStatus.Error(codes.Unauthenticated, "Your credentials not valid. Please check your email and password and try again.")
 	}
 	if err != nil {
@@ -468,15 +521,17 @@ func (s *Auth) Login(ctx context.Context, in *LoginReq) (*Token, error) {
 	}
 
 	if passed := user.ComparePassword(in.Password); !passed {
+		s.recordLoginAttempt(ctx, zlog, in.Email, in.IPAddress, false)
 		return nil, rpcStatus.Error(codes.Unauthenticated, "Your credentials not valid. Please check your email and password and try again.")
 	}
 
-	token, err := s.genToken(user)
+	token, err := s.genToken(ctx, user)
 	if err != nil {
 		zlog.Error("failed to generate token", zap.Error(err))
 		return nil, err
 	}
 
+	s.recordLoginAttempt(ctx, zlog, user.Email, in.IPAddress, true)
 	return token, nil
 }
 
@@ -510,6 +565,17 @@ func (s *Auth) RefreshToken(ctx context.Context, in *NewTokenReq) (*Token, error
 		return nil, rpcStatus.Error(codes.Unauthenticated, "Your credentials not valid. Please check your token and try again.")
 	}
 
+	// A refresh token is used only once, the new pair replaces it.
+	// The tokens issued before the refresh tokens were recorded have no token ID and are rejected.
+	used, err := useRefreshToken(ctx, s.db, claims.TokenID)
+	if err != nil {
+		zlog.Error("failed to use refresh token", zap.Error(err))
+		return nil, err
+	}
+	if !used {
+		return nil, rpcStatus.Error(codes.Unauthenticated, "Your credentials not valid. Please check your token and try again.")
+	}
+
 	user, err := getUser(ctx, s.db, &UserQuery{
 		ID: claims.ID,
 	})
@@ -524,7 +590,7 @@ func (s *Auth) RefreshToken(ctx context.Context, in *NewTokenReq) (*Token, error
 		return nil, rpcStatus.Error(codes.Unauthenticated, "Your credentials not valid. Please check your token and try again.")
 	}
 
-	token, err := s.genToken(user)
+	token, err := s.genToken(ctx, user)
 	if err != nil {
 		zlog.Error("failed to generate token", zap.Error(err))
 		return nil, err
@@ -540,10 +606,25 @@ type Token struct {
 
 type Claims struct {
 	IsAdmin     bool   `json:"isAdmin"`
+	Role        Role   `json:"role"`
 	ID          string `json:"id"`
 	Email       string `json:"email"`
 	Username    string `json:"username"`
 	DisplayName string `json:"displayName"`
+
+	// TokenID is the ID (jti) of the token pair the claims were issued with, see Auth.RevokeToken.
+	TokenID string `json:"tokenId"`
+}
+
+// VisibleCreator returns the user the visible resources of the claims must have been created by,
+// or an empty string if every resource is visible.
+// Admins and read-only admins can view every resource; other users can only view the resources they created.
+func (c *Claims) VisibleCreator() string {
+	if c.CanViewAll() {
+		return ""
+	}
+
+	return c.Username
 }
 
 type ctxKey int
@@ -567,25 +648,33 @@ func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
 
 type User struct {
 	IsAdmin        bool `json:"isAdmin"`
+	Role           Role `json:"role"`
 	hashedPassword []byte
-	createdBy      string
-	updatedBy      string
-	ID             string    `json:"id"`
-	Email          string    `json:"email"`
-	Username       string    `json:"username"`
-	DisplayName    string    `json:"displayName"`
-	Status         status    `json:"status"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+
+	// passwordHistory are the hashes of the previous passwords, the most recent first.
+	passwordHistory [][]byte
+	purgedBy        string
+	purgedAt        *time.Time
+	createdBy       string
+	updatedBy       string
+	ID              string    `json:"id"`
+	Email           string    `json:"email"`
+	Username        string    `json:"username"`
+	DisplayName     string    `json:"displayName"`
+	Status          status    `json:"status"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
 }
 
-func (u User) toClaims() *Claims {
+func (u User) toClaims(tokenID string) *Claims {
 	return &Claims{
 		IsAdmin:     u.IsAdmin,
+		Role:        u.Role,
 		ID:          u.ID,
 		Email:       u.Email,
 		Username:    u.Username,
 		DisplayName: u.DisplayName,
+		TokenID:     tokenID,
 	}
 }
 
@@ -647,12 +736,6 @@ func (u *User) Close(by string) error {
 	return nil
 }
 
-func (u *User) changePassword(by string, password string) {
-	u.SetPassword(password)
-	u.updatedBy = by
-	u.UpdatedAt = time.Now()
-}
-
 func (u *User) changeDisplayName(by string, displayName string) {
 	u.DisplayName = displayName
 	u.updatedBy = u.createdBy
@@ -672,6 +755,19 @@ type UserQuery struct {
 	PageSize      uint64    `json:"pageSize"  query:"pageSize"`
 	CreatedAfter  time.Time `json:"createdAfter"  query:"createdAfter"`
 	CreatedBefore time.Time `json:"createdBefore"  query:"createdBefore"`
+
+	ids []string
+}
+
+// hasCriteria reports whether the query restricts the users, the paging aside.
+func (q *UserQuery) hasCriteria() bool {
+	return q.ID != "" ||
+		len(q.ids) > 0 ||
+		q.Email != "" ||
+		q.Username != "" ||
+		q.Status != "" ||
+		!q.CreatedAfter.IsZero() ||
+		!q.CreatedBefore.IsZero()
 }
 
 func (q *UserQuery) ToSql() (string, []any, error) {
@@ -681,6 +777,10 @@ func (q *UserQuery) ToSql() (string, []any, error) {
 		and = append(and, sq.Eq{"id": q.ID})
 	}
 
+	if len(q.ids) > 0 {
+		and = append(and, sq.Eq{"id": q.ids})
+	}
+
 	if q.Email != "" {
 		and = append(and, sq.Eq{"email": q.Email})
 	}
@@ -726,7 +826,11 @@ func listUsers(ctx context.Context, db *sql.DB, in *UserQuery) ([]*User, error)
 			"display_name",
 			"status",
 			"is_admin",
+			"role",
 			"password_hash",
+			"password_history",
+			"purged_by",
+			"purged_at",
 			"created_by",
 			"updated_by",
 			"created_at",
@@ -747,6 +851,8 @@ func listUsers(ctx context.Context, db *sql.DB, in *UserQuery) ([]*User, error)
 	users := make([]*User, 0)
 	for rows.Next() {
 		var u User
+		var passwordHistory string
+		var purgedAt sql.NullTime
 		err := rows.Scan(
 			&u.ID,
 			&u.Email,
@@ -754,7 +860,11 @@ func listUsers(ctx context.Context, db *sql.DB, in *UserQuery) ([]*User, error)
 			&u.DisplayName,
 			&u.Status,
 			&u.IsAdmin,
+			&u.Role,
 			&u.hashedPassword,
+			&passwordHistory,
+			&u.purgedBy,
+			&purgedAt,
 			&u.createdBy,
 			&u.updatedBy,
 			&u.CreatedAt,
@@ -767,6 +877,14 @@ func listUsers(ctx context.Context, db *sql.DB, in *UserQuery) ([]*User, error)
 			return nil, err
 		}
 
+		u.passwordHistory, err = parsePasswordHistory(passwordHistory)
+		if err != nil {
+			return nil, err
+		}
+		if purgedAt.Valid {
+			u.purgedAt = &purgedAt.Time
+		}
+
 		users = append(users, &u)
 	}
 	if err := rows.Err(); err != nil {
@@ -799,6 +917,7 @@ func createUser(ctx context.Context, db *sql.DB, in *User) error {
 			"display_name",
 			"status",
 			"is_admin",
+			"role",
 			"password_hash",
 			"created_by",
 			"updated_by",
@@ -812,6 +931,7 @@ func createUser(ctx context.Context, db *sql.DB, in *User) error {
 			in.DisplayName,
 			in.Status,
 			in.IsAdmin,
+			in.Role.String(),
 			in.hashedPassword,
 			in.createdBy,
 			in.updatedBy,
@@ -834,9 +954,11 @@ func updateUser(ctx context.Context, db *sql.DB, in *User) error {
 		Set("email", in.Email).
 		Set("username", in.Username).
 		Set("password_hash", in.hashedPassword).
+		Set("password_history", marshalPasswordHistory(in.passwordHistory)).
 		Set("display_name", in.DisplayName).
 		Set("status", in.Status).
 		Set("is_admin", in.IsAdmin).
+		Set("role", in.Role.String()).
 		Set("updated_by", in.updatedBy).
 		Set("updated_at", in.UpdatedAt).
 		Where(
@@ -898,6 +1020,8 @@ func (r *CreateUserReq) Validate() error {
 		})
 	}
 
+	violations = append(violations, passwordComplexityViolations("password", r.Password)...)
+
 	if r.DisplayName == "" {
 		violations = append(violations, &edPb.BadRequest_FieldViolation{
 			Field:       "displayName",
@@ -1011,6 +1135,8 @@ func (r *ChangeMyPasswordReq) Validate() error {
 		})
 	}
 
+	violations = append(violations, passwordComplexityViolations("newPassword", r.NewPassword)...)
+
 	if len(violations) > 0 {
 		s, _ := rpcStatus.New(
 			codes.InvalidArgument,
@@ -1061,6 +1187,8 @@ func (r *ResetUserPasswordByAdminReq) Validate() error {
 		})
 	}
 
+	violations = append(violations, passwordComplexityViolations("password", r.Password)...)
+
 	if len(violations) > 0 {
 		s, _ := rpcStatus.New(
 			codes.InvalidArgument,
@@ -1082,6 +1210,7 @@ func newUser(createdBy string, in *CreateUserReq) *User {
 		Email:       in.Email,
 		Username:    in.Email, // In this version, the username is the same as the email.
 		DisplayName: in.DisplayName,
+		Role:        RoleUser,
 		createdBy:   createdBy,
 		updatedBy:   createdBy,
 		Status:      StatusEnabled,
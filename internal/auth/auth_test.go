@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// userColumns are the columns selected by listUsers.
+var userColumns = []string{
+	"id",
+	"email",
+	"username",
+	"display_name",
+	"status",
+	"is_admin",
+	"role",
+	"password_hash",
+	"password_history",
+	"purged_by",
+	"purged_at",
+	"created_by",
+	"updated_by",
+	"created_at",
+	"updated_at",
+}
+
+// userRow returns the row of the user as selected by listUsers.
+func userRow(u *User) []any {
+	history := marshalPasswordHistory(u.passwordHistory)
+	var purgedAt any
+	if u.purgedAt != nil {
+		purgedAt = *u.purgedAt
+	}
+
+	return []any{
+		u.ID,
+		u.Email,
+		u.Username,
+		u.DisplayName,
+		u.Status.String(),
+		u.IsAdmin,
+		string(u.Role),
+		u.hashedPassword,
+		history,
+		u.purgedBy,
+		purgedAt,
+		u.createdBy,
+		u.updatedBy,
+		u.CreatedAt,
+		u.UpdatedAt,
+	}
+}
+
+func newTestAuth(t *testing.T) (*Auth, *dbtest.Mock) {
+	t.Helper()
+
+	db, mock := dbtest.New(t)
+	return &Auth{
+		db:   db,
+		zlog: zap.NewNop(),
+	}, mock
+}
+
+func newTestUser(id, email string, role Role) *User {
+	now := time.Now()
+	return &User{
+		ID:          id,
+		Email:       email,
+		Username:    email,
+		DisplayName: "Test user",
+		Role:        role,
+		IsAdmin:     role == RoleAdmin,
+		Status:      StatusEnabled,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+}
+
+func contextWithRole(role Role) context.Context {
+	return ContextWithClaims(context.Background(), &Claims{
+		ID:       "caller000001",
+		Username: "caller@example.com",
+		Role:     role,
+		IsAdmin:  role == RoleAdmin,
+	})
+}
+
+func TestRoleUserOperations(t *testing.T) {
+	tests := []struct {
+		role      Role
+		canView   bool
+		canManage bool
+	}{
+		{role: RoleUser, canView: false, canManage: false},
+		{role: RoleReadOnlyAdmin, canView: true, canManage: false},
+		{role: RoleApprover, canView: true, canManage: false},
+		{role: RoleAdmin, canView: true, canManage: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			ctx := contextWithRole(tt.role)
+
+			t.Run("list users", func(t *testing.T) {
+				s, mock := newTestAuth(t)
+				if tt.canView {
+					mock.ExpectQuery(`FROM "user"`).
+						WillReturnRows(userColumns, userRow(newTestUser("user00000001", "ann@example.com", RoleUser)))
+				}
+
+				result, err := s.ListUsers(ctx, &UserQuery{})
+				if !tt.canView {
+					if rpcStatus.Code(err) != codes.PermissionDenied {
+						t.Fatalf("ListUsers() error = %v, want PermissionDenied", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ListUsers() error = %v", err)
+				}
+				if len(result.Users) != 1 {
+					t.Errorf("ListUsers() got %d users, want 1", len(result.Users))
+				}
+			})
+
+			t.Run("create user", func(t *testing.T) {
+				s, mock := newTestAuth(t)
+				if tt.canManage {
+					mock.ExpectQuery(`SELECT id FROM "user"`)
+					mock.ExpectExec(`INSERT INTO "user"`)
+				}
+
+				_, err := s.CreateUser(ctx, &CreateUserReq{
+					Email:       "new@example.com",
+					Password:    "Str0ng!Passw0rd",
+					DisplayName: "New user",
+				})
+				if tt.canManage {
+					if err != nil {
+						t.Fatalf("CreateUser() error = %v", err)
+					}
+					return
+				}
+				if rpcStatus.Code(err) != codes.PermissionDenied {
+					t.Fatalf("CreateUser() error = %v, want PermissionDenied", err)
+				}
+			})
+
+			if tt.canManage {
+				return
+			}
+
+			t.Run("disable user", func(t *testing.T) {
+				s, _ := newTestAuth(t)
+				_, err := s.DisableUser(ctx, "user00000001")
+				if rpcStatus.Code(err) != codes.PermissionDenied {
+					t.Fatalf("DisableUser() error = %v, want PermissionDenied", err)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/pager"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// maxBatchDisableIDs is the maximum number of user IDs accepted by BatchDisableUsers.
+const maxBatchDisableIDs = 250
+
+// DisableOutcome is what happened to a user of a batch disable.
+type DisableOutcome string
+
+const (
+	DisableOutcomeDisabled        DisableOutcome = "DISABLED"
+	DisableOutcomeAlreadyDisabled DisableOutcome = "ALREADY_DISABLED"
+
+	// DisableOutcomeClosed is the outcome of the closed users, which cannot be disabled.
+	DisableOutcomeClosed DisableOutcome = "CLOSED"
+
+	// DisableOutcomeNotFound is the outcome of the given IDs matching no user.
+	DisableOutcomeNotFound DisableOutcome = "NOT_FOUND"
+
+	// DisableOutcomeSelf is the outcome of the caller, who is never disabled
+	// so a broad filter cannot lock the admin out.
+	DisableOutcomeSelf DisableOutcome = "SELF"
+
+	// DisableOutcomeLastAdmin is the outcome of the last enabled admin, who is never disabled
+	// so there is always an admin able to manage the users, see checkNotLastAdmin.
+	DisableOutcomeLastAdmin DisableOutcome = "LAST_ADMIN"
+)
+
+// BatchDisableUsersReq selects the users to disable, either by their IDs or by a filter.
+type BatchDisableUsersReq struct {
+	IDs    []string   `json:"ids"`
+	Filter *UserQuery `json:"filter"`
+}
+
+func (r *BatchDisableUsersReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if len(r.IDs) == 0 && r.Filter == nil {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "ids",
+			Description: "IDs or filter must be given",
+		})
+	}
+
+	if r.Filter != nil && !r.Filter.hasCriteria() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "filter",
+			Description: "Filter must have at least one criterion",
+		})
+	}
+
+	if len(r.IDs) > 0 && r.Filter != nil {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "filter",
+			Description: "Filter must not be given together with IDs",
+		})
+	}
+
+	if len(r.IDs) > maxBatchDisableIDs {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "ids",
+			Description: fmt.Sprintf("IDs must not contain more than %d items", maxBatchDisableIDs),
+		})
+	}
+
+	seen := make(map[string]bool, len(r.IDs))
+	for i, id := range r.IDs {
+		if id == "" {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("ids[%d]", i),
+				Description: "ID must not be empty",
+			})
+			continue
+		}
+
+		if seen[id] {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("ids[%d]", i),
+				Description: "ID must not be duplicated",
+			})
+		}
+		seen[id] = true
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Batch disable is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+type DisableUserResult struct {
+	UserID  string         `json:"userId"`
+	Email   string         `json:"email"`
+	Outcome DisableOutcome `json:"outcome"`
+}
+
+type BatchDisableUsersResult struct {
+	Results []*DisableUserResult `json:"results"`
+}
+
+// BatchDisableUsers disables the selected users in one transaction and reports the outcome for each of them.
+// Only admins are allowed to disable users.
+func (s *Auth) BatchDisableUsers(ctx context.Context, in *BatchDisableUsersReq) (*BatchDisableUsersResult, error) {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "BatchDisableUsers"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	users, err := s.listUsersToDisable(ctx, in)
+	if err != nil {
+		zlog.Error("failed to list users", zap.Error(err))
+		return nil, err
+	}
+
+	result := &BatchDisableUsersResult{
+		Results: make([]*DisableUserResult, 0, len(users)),
+	}
+	found := make(map[string]bool, len(users))
+	disabled := make([]*User, 0, len(users))
+
+	// enabledAdmins is counted on the first admin to disable, and decreased for each one disabled.
+	enabledAdmins := int64(-1)
+	for _, u := range users {
+		found[u.ID] = true
+
+		enabledAdmin := u.ID != claims.ID && u.IsAdmin && u.IsEnabled()
+		if enabledAdmin && enabledAdmins < 0 {
+			enabledAdmins, err = countEnabledAdmins(ctx, s.db)
+			if err != nil {
+				zlog.Error("failed to count enabled admins", zap.Error(err))
+				return nil, err
+			}
+		}
+
+		outcome := DisableOutcomeDisabled
+		switch {
+		case u.ID == claims.ID:
+			outcome = DisableOutcomeSelf
+		case u.Status == StatusDisabled:
+			outcome = DisableOutcomeAlreadyDisabled
+		case u.Status == StatusClosed:
+			outcome = DisableOutcomeClosed
+		case enabledAdmin && enabledAdmins <= 1:
+			outcome = DisableOutcomeLastAdmin
+		default:
+			if enabledAdmin {
+				enabledAdmins--
+			}
+			if err := u.Disable(claims.Username); err != nil {
+				return nil, err
+			}
+			disabled = append(disabled, u)
+		}
+
+		result.Results = append(result.Results, &DisableUserResult{
+			UserID:  u.ID,
+			Email:   u.Email,
+			Outcome: outcome,
+		})
+	}
+
+	for _, id := range in.IDs {
+		if !found[id] {
+			result.Results = append(result.Results, &DisableUserResult{
+				UserID:  id,
+				Outcome: DisableOutcomeNotFound,
+			})
+		}
+	}
+
+	if err := disableUsers(ctx, s.db, disabled); err != nil {
+		zlog.Error("failed to disable users", zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// listUsersToDisable lists the users of the given IDs, or every user matching the filter.
+func (s *Auth) listUsersToDisable(ctx context.Context, in *BatchDisableUsersReq) ([]*User, error) {
+	if len(in.IDs) > 0 {
+		return listUsers(ctx, s.db, &UserQuery{
+			ids:      in.IDs,
+			PageSize: maxBatchDisableIDs,
+		})
+	}
+
+	q := *in.Filter
+	q.PageSize = maxBatchDisableIDs
+	q.PageToken = ""
+
+	users := make([]*User, 0)
+	for {
+		page, err := listUsers(ctx, s.db, &q)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, page...)
+
+		if len(page) < maxBatchDisableIDs {
+			return users, nil
+		}
+		last := page[len(page)-1]
+		q.PageToken = pager.EncodeCursor(&pager.Cursor{
+			ID:   last.ID,
+			Time: last.CreatedAt,
+		})
+	}
+}
+
+// disableUsers saves the status of the disabled users and revokes their tokens in one transaction.
+func disableUsers(ctx context.Context, db *sql.DB, users []*User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	defer database.TimeQuery("auth.disableUsers")()
+
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for _, u := range users {
+			q, args := sq.Update(`"user"`).
+				Set("status", u.Status).
+				Set("updated_by", u.updatedBy).
+				Set("updated_at", u.UpdatedAt).
+				Where(sq.Eq{
+					"id": u.ID,
+				}).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+				return fmt.Errorf("failed to disable user %s: %w", u.ID, err)
+			}
+
+			q, args = sq.Update("refresh_token").
+				Set("revoked_at", u.UpdatedAt).
+				Where(sq.Eq{
+					"user_id":    u.ID,
+					"revoked_at": nil,
+				}).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+				return fmt.Errorf("failed to revoke tokens of user %s: %w", u.ID, err)
+			}
+		}
+
+		return nil
+	})
+}
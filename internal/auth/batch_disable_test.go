@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestBatchDisableUsersReqValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *BatchDisableUsersReq
+		wantCode codes.Code
+	}{
+		{
+			name:     "ids",
+			req:      &BatchDisableUsersReq{IDs: []string{"user00000001"}},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "filter",
+			req:      &BatchDisableUsersReq{Filter: &UserQuery{Status: "ENABLED"}},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "nothing",
+			req:      &BatchDisableUsersReq{},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "empty filter",
+			req:      &BatchDisableUsersReq{Filter: &UserQuery{}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "filter with paging only",
+			req:      &BatchDisableUsersReq{Filter: &UserQuery{PageSize: 10}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "ids and filter",
+			req:      &BatchDisableUsersReq{IDs: []string{"user00000001"}, Filter: &UserQuery{Status: "ENABLED"}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "duplicated ids",
+			req:      &BatchDisableUsersReq{IDs: []string{"user00000001", "user00000001"}},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpcStatus.Code(tt.req.Validate()); got != tt.wantCode {
+				t.Errorf("Validate() code = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestBatchDisableUsersMixedOutcomes(t *testing.T) {
+	self := newTestUser("caller000001", "caller@example.com", RoleAdmin)
+	enabled := newTestUser("user00000001", "enabled@example.com", RoleUser)
+	admin := newTestUser("user00000002", "admin@example.com", RoleAdmin)
+	disabled := newTestUser("user00000003", "disabled@example.com", RoleUser)
+	disabled.Status = StatusDisabled
+	closed := newTestUser("user00000004", "closed@example.com", RoleUser)
+	closed.Status = StatusClosed
+
+	s, mock := newTestAuth(t)
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns,
+		userRow(self), userRow(enabled), userRow(admin), userRow(disabled), userRow(closed),
+	)
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "user"`).WillReturnRows([]string{"n"}, []any{2})
+	mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE refresh_token`)
+	mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE refresh_token`)
+
+	result, err := s.BatchDisableUsers(contextWithRole(RoleAdmin), &BatchDisableUsersReq{
+		IDs: []string{self.ID, enabled.ID, admin.ID, disabled.ID, closed.ID, "user00000005"},
+	})
+	if err != nil {
+		t.Fatalf("BatchDisableUsers() error = %v", err)
+	}
+
+	want := map[string]DisableOutcome{
+		self.ID:        DisableOutcomeSelf,
+		enabled.ID:     DisableOutcomeDisabled,
+		admin.ID:       DisableOutcomeDisabled,
+		disabled.ID:    DisableOutcomeAlreadyDisabled,
+		closed.ID:      DisableOutcomeClosed,
+		"user00000005": DisableOutcomeNotFound,
+	}
+	if len(result.Results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(result.Results), len(want))
+	}
+	for _, r := range result.Results {
+		if r.Outcome != want[r.UserID] {
+			t.Errorf("outcome of %s = %s, want %s", r.UserID, r.Outcome, want[r.UserID])
+		}
+	}
+	if mock.Commits() != 1 {
+		t.Errorf("got %d commits, want 1", mock.Commits())
+	}
+}
+
+func TestBatchDisableUsersKeepsLastAdmin(t *testing.T) {
+	first := newTestUser("user00000001", "first@example.com", RoleAdmin)
+	second := newTestUser("user00000002", "second@example.com", RoleAdmin)
+
+	s, mock := newTestAuth(t)
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(first), userRow(second))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "user"`).WillReturnRows([]string{"n"}, []any{2})
+	mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE refresh_token`)
+
+	// The two enabled admins are the users disabled, the caller being an admin by the token only.
+	result, err := s.BatchDisableUsers(contextWithRole(RoleAdmin), &BatchDisableUsersReq{
+		Filter: &UserQuery{Status: "ENABLED"},
+	})
+	if err != nil {
+		t.Fatalf("BatchDisableUsers() error = %v", err)
+	}
+
+	want := map[string]DisableOutcome{
+		first.ID:  DisableOutcomeDisabled,
+		second.ID: DisableOutcomeLastAdmin,
+	}
+	for _, r := range result.Results {
+		if r.Outcome != want[r.UserID] {
+			t.Errorf("outcome of %s = %s, want %s", r.UserID, r.Outcome, want[r.UserID])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+// LoadPasswordBlocklist reads the passwords to reject from the file at the given path,
+// one per line, skipping the empty lines and the lines starting with #.
+// An empty path loads the embedded list of common passwords.
+func LoadPasswordBlocklist(path string) ([]string, error) {
+	content := commonPasswords
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+		}
+		content = string(b)
+	}
+
+	passwords := make([]string, 0)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords = append(passwords, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+
+	return passwords, nil
+}
+
+// SetPasswordBlocklist sets the passwords rejected when creating a user or changing a password,
+// compared case-insensitively. Nil or empty rejects no password.
+func (s *Auth) SetPasswordBlocklist(passwords []string) {
+	blocklist := make(map[string]bool, len(passwords))
+	for _, p := range passwords {
+		blocklist[strings.ToLower(p)] = true
+	}
+	s.passwordBlocklist = blocklist
+}
+
+// checkPasswordBlocklist returns an InvalidArgument error on the given field
+// if the password is in the blocklist.
+func (s *Auth) checkPasswordBlocklist(field, password string) error {
+	if !s.passwordBlocklist[strings.ToLower(password)] {
+		return nil
+	}
+
+	st, _ := rpcStatus.New(
+		codes.InvalidArgument,
+		"Password is too common. Please choose another password and try again, see details for more information.",
+	).WithDetails(&edPb.BadRequest{
+		FieldViolations: []*edPb.BadRequest_FieldViolation{
+			{
+				Field:       field,
+				Description: "Password is a commonly used password",
+			},
+		},
+	})
+
+	return st.Err()
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestLoadPasswordBlocklist(t *testing.T) {
+	embedded, err := LoadPasswordBlocklist("")
+	if err != nil {
+		t.Fatalf("LoadPasswordBlocklist() error = %v", err)
+	}
+	if !slices.Contains(embedded, "password123") || slices.Contains(embedded, "") {
+		t.Errorf("embedded blocklist = %d passwords, want the common passwords without empty lines", len(embedded))
+	}
+
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("# rejected passwords\n\nSummer-2025!\n  Winter-2025!  \n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadPasswordBlocklist(path)
+	if err != nil {
+		t.Fatalf("LoadPasswordBlocklist() error = %v", err)
+	}
+	if want := []string{"Summer-2025!", "Winter-2025!"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadPasswordBlocklist() = %v, want %v", got, want)
+	}
+
+	if _, err := LoadPasswordBlocklist(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("LoadPasswordBlocklist() of a missing file error = nil, want an error")
+	}
+}
+
+func TestPasswordBlocklist(t *testing.T) {
+	// Both passwords pass the complexity rules, only the blocklisted one is rejected.
+	const blocked = "Summer-2025!"
+
+	tests := []struct {
+		name     string
+		password string
+		wantCode codes.Code
+	}{
+		{name: "blocklisted", password: blocked, wantCode: codes.InvalidArgument},
+		{name: "blocklisted in another case", password: "sUMMER-2025!", wantCode: codes.InvalidArgument},
+		{name: "strong", password: "N3w-Passphrase", wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestAuth(t)
+			s.SetPasswordBlocklist([]string{blocked})
+
+			if err := (&ChangeMyPasswordReq{CurrentPassword: "Str0ng!Passw0rd", NewPassword: tt.password}).Validate(); err != nil {
+				t.Fatalf("Validate() error = %v, want the password to pass the complexity rules", err)
+			}
+
+			err := s.checkPasswordBlocklist("newPassword", tt.password)
+			if rpcStatus.Code(err) != tt.wantCode {
+				t.Fatalf("checkPasswordBlocklist() error = %v, want %s", err, tt.wantCode)
+			}
+			if err != nil && !hasFieldViolation(err, "newPassword") {
+				t.Errorf("checkPasswordBlocklist() error = %v, want a violation on newPassword", err)
+			}
+		})
+	}
+}
+
+func TestCreateUserRejectsBlocklistedPassword(t *testing.T) {
+	// No statement is expected, the password is rejected before the user is looked up.
+	s, _ := newTestAuth(t)
+	s.SetPasswordBlocklist([]string{"Summer-2025!"})
+
+	_, err := s.CreateUser(contextWithRole(RoleAdmin), &CreateUserReq{
+		Email:       "new@example.com",
+		Password:    "Summer-2025!",
+		DisplayName: "New user",
+	})
+	if rpcStatus.Code(err) != codes.InvalidArgument || !hasFieldViolation(err, "password") {
+		t.Errorf("CreateUser() error = %v, want InvalidArgument on password", err)
+	}
+}
+
+func hasFieldViolation(err error, field string) bool {
+	for _, d := range rpcStatus.Convert(err).Details() {
+		v, ok := d.(*edPb.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, fv := range v.GetFieldViolations() {
+			if fv.GetField() == field {
+				return true
+			}
+		}
+	}
+	return false
+}
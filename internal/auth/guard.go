@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// checkNotSelf returns a FailedPrecondition error if the user of the given ID is the caller,
+// so admins cannot lock themselves out.
+func checkNotSelf(claims *Claims, id string) error {
+	if id == claims.ID {
+		return rpcStatus.Error(codes.FailedPrecondition, "You can not perform this action on your own user.")
+	}
+
+	return nil
+}
+
+// checkNotLastAdmin returns a FailedPrecondition error if the user is the last enabled admin,
+// so there is always an admin able to manage the users.
+func checkNotLastAdmin(ctx context.Context, db *sql.DB, u *User) error {
+	if !u.IsAdmin || !u.IsEnabled() {
+		return nil
+	}
+
+	n, err := countEnabledAdmins(ctx, db)
+	if err != nil {
+		return err
+	}
+	if n <= 1 {
+		return rpcStatus.Error(codes.FailedPrecondition, "The user is the last enabled admin. You can not perform this action on this user.")
+	}
+
+	return nil
+}
+
+func countEnabledAdmins(ctx context.Context, db *sql.DB) (int64, error) {
+	defer database.TimeQuery("auth.countEnabledAdmins")()
+
+	q, args := sq.Select("COUNT(*)").
+		From(`"user"`).
+		Where(sq.Eq{
+			"is_admin": true,
+			"status":   StatusEnabled,
+		}).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	var n int64
+	if err := db.QueryRowContext(ctx, q, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("failed to count enabled admins: %w", err)
+	}
+
+	return n, nil
+}
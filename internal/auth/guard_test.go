@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestAdminSelfTargeting(t *testing.T) {
+	const self = "caller000001"
+
+	tests := []struct {
+		name string
+		call func(s *Auth) error
+	}{
+		{name: "disable", call: func(s *Auth) error {
+			_, err := s.DisableUser(contextWithRole(RoleAdmin), self)
+			return err
+		}},
+		{name: "terminate", call: func(s *Auth) error {
+			_, err := s.TerminateUser(contextWithRole(RoleAdmin), self)
+			return err
+		}},
+		{name: "reset password", call: func(s *Auth) error {
+			return s.ResetUserPasswordByAdmin(contextWithRole(RoleAdmin), &ResetUserPasswordByAdminReq{UserID: self, Password: "N3w-Passphrase"})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// No statement is expected, the caller is rejected before the user is read.
+			s, _ := newTestAuth(t)
+			if err := tt.call(s); rpcStatus.Code(err) != codes.FailedPrecondition {
+				t.Errorf("error = %v, want FailedPrecondition", err)
+			}
+		})
+	}
+}
+
+func TestLastEnabledAdmin(t *testing.T) {
+	admin := newTestUser("user00000001", "admin@example.com", RoleAdmin)
+
+	tests := []struct {
+		name string
+		call func(s *Auth) error
+	}{
+		{name: "disable", call: func(s *Auth) error {
+			_, err := s.DisableUser(contextWithRole(RoleAdmin), admin.ID)
+			return err
+		}},
+		{name: "terminate", call: func(s *Auth) error {
+			_, err := s.TerminateUser(contextWithRole(RoleAdmin), admin.ID)
+			return err
+		}},
+		{name: "demote", call: func(s *Auth) error {
+			_, err := s.ChangeUserRole(contextWithRole(RoleAdmin), &ChangeUserRoleReq{UserID: admin.ID, Role: RoleUser})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The user is not updated, the fake driver failing on any other statement.
+			s, mock := newTestAuth(t)
+			mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(admin))
+			count := mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "user"`).WillReturnRows([]string{"n"}, []any{1})
+
+			if err := tt.call(s); rpcStatus.Code(err) != codes.FailedPrecondition {
+				t.Errorf("error = %v, want FailedPrecondition", err)
+			}
+			if !count.Used() {
+				t.Error("enabled admins were not counted")
+			}
+		})
+	}
+}
+
+func TestDisableAdminWithAnotherEnabledAdmin(t *testing.T) {
+	admin := newTestUser("user00000001", "admin@example.com", RoleAdmin)
+
+	s, mock := newTestAuth(t)
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(admin))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM "user"`).WillReturnRows([]string{"n"}, []any{2})
+	update := mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE refresh_token`)
+
+	user, err := s.DisableUser(contextWithRole(RoleAdmin), admin.ID)
+	if err != nil {
+		t.Fatalf("DisableUser() error = %v", err)
+	}
+	if user.IsEnabled() || !update.Used() {
+		t.Errorf("user status = %s, want the admin disabled", user.Status)
+	}
+}
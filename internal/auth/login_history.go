@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/pager"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+)
+
+// LoginAttempt is a login attempt with the email of a user, successful or not.
+type LoginAttempt struct {
+	ID        int64     `json:"id"`
+	Succeeded bool      `json:"succeeded"`
+	IPAddress string    `json:"ipAddress"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type LoginHistoryQuery struct {
+	PageSize  uint64 `query:"pageSize"`
+	PageToken string `query:"pageToken"`
+
+	email string
+}
+
+func (q *LoginHistoryQuery) ToSql() (string, []any, error) {
+	and := sq.And{
+		sq.Eq{"email": q.email},
+	}
+
+	if q.PageToken != "" {
+		cursor, err := pager.DecodeCursor(q.PageToken)
+		if err == nil {
+			and = append(and, sq.Lt{"created_at": cursor.Time})
+		}
+	}
+
+	return and.ToSql()
+}
+
+type ListLoginHistoryResult struct {
+	Attempts      []*LoginAttempt `json:"attempts"`
+	NextPageToken string          `json:"nextPageToken"`
+}
+
+// ListMyLoginHistory lists the login attempts with the email of the current user, most recent first.
+func (s *Auth) ListMyLoginHistory(ctx context.Context, in *LoginHistoryQuery) (*ListLoginHistoryResult, error) {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListMyLoginHistory"),
+		zap.String("Username", claims.Username),
+	)
+
+	in.email = claims.Email
+	attempts, err := listLoginAttempts(ctx, s.db, in)
+	if err != nil {
+		zlog.Error("failed to list login attempts", zap.Error(err))
+		return nil, err
+	}
+
+	var pageToken string
+	if l := len(attempts); l > 0 && l == int(pager.Size(in.PageSize)) {
+		last := attempts[l-1]
+		pageToken = pager.EncodeCursor(&pager.Cursor{
+			ID:   strconv.FormatInt(last.ID, 10),
+			Time: last.CreatedAt,
+		})
+	}
+
+	return &ListLoginHistoryResult{
+		Attempts:      attempts,
+		NextPageToken: pageToken,
+	}, nil
+}
+
+// recordLoginAttempt records the login attempt with the given email.
+// A failure to record it is logged without failing the login.
+func (s *Auth) recordLoginAttempt(ctx context.Context, zlog *zap.Logger, email, ipAddress string, succeeded bool) {
+	if err := createLoginAttempt(ctx, s.db, email, ipAddress, succeeded); err != nil {
+		zlog.Warn("failed to record login attempt", zap.Error(err))
+	}
+}
+
+func createLoginAttempt(ctx context.Context, db *sql.DB, email, ipAddress string, succeeded bool) error {
+	defer database.TimeQuery("auth.createLoginAttempt")()
+
+	q, args := sq.Insert("login_history").
+		Columns(
+			"email",
+			"succeeded",
+			"ip_address",
+			"created_at",
+		).
+		Values(
+			email,
+			succeeded,
+			ipAddress,
+			time.Now(),
+		).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	if _, err := db.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("failed to insert login attempt: %w", err)
+	}
+
+	return nil
+}
+
+func listLoginAttempts(ctx context.Context, db *sql.DB, in *LoginHistoryQuery) ([]*LoginAttempt, error) {
+	defer database.TimeQuery("auth.listLoginAttempts")()
+
+	id := fmt.Sprintf("TOP %d id", pager.Size(in.PageSize))
+	pred, args, err := in.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.
+		Select(
+			id,
+			"succeeded",
+			"ip_address",
+			"created_at",
+		).
+		From("login_history").
+		Where(pred, args...).
+		OrderBy("created_at DESC").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login attempts: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := make([]*LoginAttempt, 0)
+	for rows.Next() {
+		a := new(LoginAttempt)
+		if err := rows.Scan(
+			&a.ID,
+			&a.Succeeded,
+			&a.IPAddress,
+			&a.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan login attempt: %w", err)
+		}
+
+		attempts = append(attempts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate login attempts: %w", err)
+	}
+
+	return attempts, nil
+}
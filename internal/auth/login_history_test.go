@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestLoginHistory(t *testing.T) {
+	s, mock := newTestAuth(t)
+	s.aKey = paseto.NewV4SymmetricKey()
+	s.rKey = paseto.NewV4SymmetricKey()
+	user := newTestUser("user00000001", "ann@example.com", RoleUser)
+	if err := user.SetPassword("correct horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+	failed := mock.ExpectExec(`INSERT INTO login_history`)
+	_, err := s.Login(ctx, &LoginReq{Email: user.Email, Password: "wrong password", IPAddress: "10.0.0.2"})
+	if rpcStatus.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Login() with a wrong password error = %v, want Unauthenticated", err)
+	}
+
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+	mock.ExpectExec(`INSERT INTO refresh_token`)
+	succeeded := mock.ExpectExec(`INSERT INTO login_history`)
+	if _, err := s.Login(ctx, &LoginReq{Email: user.Email, Password: "correct horse battery", IPAddress: "10.0.0.1"}); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	// The arguments are the email, whether it succeeded, the IP address and the time of the attempt.
+	for _, tt := range []struct {
+		name          string
+		args          []any
+		wantSucceeded bool
+		wantIPAddress string
+	}{
+		{name: "failed", args: failed.Args(), wantSucceeded: false, wantIPAddress: "10.0.0.2"},
+		{name: "succeeded", args: succeeded.Args(), wantSucceeded: true, wantIPAddress: "10.0.0.1"},
+	} {
+		if len(tt.args) != 4 || tt.args[0] != user.Email || tt.args[1] != tt.wantSucceeded || tt.args[2] != tt.wantIPAddress {
+			t.Errorf("%s attempt recorded = %v, want %s succeeded %v from %s", tt.name, tt.args, user.Email, tt.wantSucceeded, tt.wantIPAddress)
+		}
+	}
+
+	list := mock.ExpectQuery(`FROM login_history WHERE \(email = @p1\) ORDER BY created_at DESC`).WillReturnRows(
+		[]string{"id", "succeeded", "ip_address", "created_at"},
+		[]any{2, true, "10.0.0.1", succeeded.Args()[3]},
+		[]any{1, false, "10.0.0.2", failed.Args()[3]},
+	)
+	me := ContextWithClaims(ctx, &Claims{ID: user.ID, Email: user.Email, Username: user.Username, Role: user.Role})
+	result, err := s.ListMyLoginHistory(me, &LoginHistoryQuery{})
+	if err != nil {
+		t.Fatalf("ListMyLoginHistory() error = %v", err)
+	}
+	if args := list.Args(); len(args) != 1 || args[0] != user.Email {
+		t.Errorf("query args = %v, want the email of the current user", args)
+	}
+
+	if len(result.Attempts) != 2 {
+		t.Fatalf("ListMyLoginHistory() = %d attempts, want 2", len(result.Attempts))
+	}
+	if a := result.Attempts[0]; !a.Succeeded || a.IPAddress != "10.0.0.1" {
+		t.Errorf("first attempt = %+v, want the successful login from 10.0.0.1", a)
+	}
+	if a := result.Attempts[1]; a.Succeeded || a.IPAddress != "10.0.0.2" {
+		t.Errorf("second attempt = %+v, want the failed login from 10.0.0.2", a)
+	}
+	if result.Attempts[0].CreatedAt.Before(result.Attempts[1].CreatedAt) {
+		t.Error("attempts are not listed most recent first")
+	}
+	if result.NextPageToken != "" {
+		t.Errorf("next page token = %q, want none for a partial page", result.NextPageToken)
+	}
+}
+
+func TestLoginHistoryUnknownEmail(t *testing.T) {
+	s, mock := newTestAuth(t)
+
+	mock.ExpectQuery(`FROM "user"`)
+	attempt := mock.ExpectExec(`INSERT INTO login_history`)
+	_, err := s.Login(context.Background(), &LoginReq{Email: "nobody@example.com", Password: "whatever password", IPAddress: "10.0.0.3"})
+	if rpcStatus.Code(err) != codes.Unauthenticated {
+		t.Fatalf("Login() of an unknown email error = %v, want Unauthenticated", err)
+	}
+
+	args := attempt.Args()
+	if len(args) != 4 || args[0] != "nobody@example.com" || args[1] != false || args[2] != "10.0.0.3" {
+		t.Errorf("attempt recorded = %v, want a failed attempt of nobody@example.com from 10.0.0.3", args)
+	}
+	if _, ok := args[3].(time.Time); !ok {
+		t.Errorf("attempt time = %T, want a time", args[3])
+	}
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// passwordHistorySize is the number of recent passwords, the current one included, that cannot be reused.
+const passwordHistorySize = 3
+
+// passwordComplexityViolations returns the violations of a password missing
+// an uppercase letter, a lowercase letter, a digit or a symbol. An empty password has none,
+// it is reported as empty by the validators.
+func passwordComplexityViolations(field, password string) []*edPb.BadRequest_FieldViolation {
+	if password == "" {
+		return nil
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			symbol = true
+		}
+	}
+
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+	for _, class := range []struct {
+		ok   bool
+		name string
+	}{
+		{upper, "an uppercase letter"},
+		{lower, "a lowercase letter"},
+		{digit, "a digit"},
+		{symbol, "a symbol"},
+	} {
+		if !class.ok {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       field,
+				Description: fmt.Sprintf("Password must contain at least %s", class.name),
+			})
+		}
+	}
+
+	return violations
+}
+
+// isRecentPassword reports whether the password matches the current password or one of the previous ones.
+func (u *User) isRecentPassword(password string) bool {
+	hashes := append([][]byte{u.hashedPassword}, u.passwordHistory...)
+	for _, hash := range hashes {
+		if len(hash) > 0 && bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// changePassword sets the new password and keeps the current one in the history.
+// It returns FailedPrecondition if the password is one of the recent ones.
+func (u *User) changePassword(by string, password string) error {
+	if u.isRecentPassword(password) {
+		return rpcStatus.Error(codes.FailedPrecondition, fmt.Sprintf("The password must not be one of the last %d passwords. Please choose another password and try again.", passwordHistorySize))
+	}
+
+	previous := u.hashedPassword
+	if err := u.SetPassword(password); err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if len(previous) > 0 {
+		u.passwordHistory = append([][]byte{previous}, u.passwordHistory...)
+	}
+	if len(u.passwordHistory) > passwordHistorySize-1 {
+		u.passwordHistory = u.passwordHistory[:passwordHistorySize-1]
+	}
+
+	u.updatedBy = by
+	u.UpdatedAt = time.Now()
+	return nil
+}
+
+// parsePasswordHistory parses the password history as stored in the database, a JSON array of bcrypt hashes.
+func parsePasswordHistory(s string) ([][]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var hashes []string
+	if err := json.Unmarshal([]byte(s), &hashes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal password history: %w", err)
+	}
+
+	history := make([][]byte, 0, len(hashes))
+	for _, h := range hashes {
+		history = append(history, []byte(h))
+	}
+	return history, nil
+}
+
+func marshalPasswordHistory(hashes [][]byte) string {
+	s := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		s = append(s, string(h))
+	}
+
+	b, _ := json.Marshal(s)
+	return string(b)
+}
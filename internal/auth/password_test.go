@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestPasswordComplexityViolations(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "every class", password: "Str0ng!Passw0rd"},
+		{name: "no uppercase letter", password: "str0ng!passw0rd", want: []string{"Password must contain at least an uppercase letter"}},
+		{name: "no lowercase letter", password: "STR0NG!PASSW0RD", want: []string{"Password must contain at least a lowercase letter"}},
+		{name: "no digit", password: "Strong!Password", want: []string{"Password must contain at least a digit"}},
+		{name: "no symbol", password: "Str0ngPassw0rd", want: []string{"Password must contain at least a symbol"}},
+		{name: "letters only", password: "StrongPassword", want: []string{
+			"Password must contain at least a digit",
+			"Password must contain at least a symbol",
+		}},
+		{name: "empty", password: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			violations := passwordComplexityViolations("password", tt.password)
+			if len(violations) != len(tt.want) {
+				t.Fatalf("got %d violations %v, want %v", len(violations), violations, tt.want)
+			}
+			for i, v := range violations {
+				if v.GetField() != "password" || v.GetDescription() != tt.want[i] {
+					t.Errorf("violation %d = %s: %s, want password: %s", i, v.GetField(), v.GetDescription(), tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPasswordValidatorsCheckComplexity(t *testing.T) {
+	const weak = "weakpassword1"
+
+	tests := []struct {
+		name string
+		req  interface{ Validate() error }
+	}{
+		{name: "create user", req: &CreateUserReq{Email: "new@example.com", Password: weak, DisplayName: "New user"}},
+		{name: "change my password", req: &ChangeMyPasswordReq{CurrentPassword: "Str0ng!Passw0rd", NewPassword: weak}},
+		{name: "reset by admin", req: &ResetUserPasswordByAdminReq{UserID: "user00000001", Password: weak}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); rpcStatus.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Validate() error = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	passwords := []string{"First!Passw0rd", "Second!Passw0rd", "Third!Passw0rd"}
+
+	u := newTestUser("user00000001", "ann@example.com", RoleUser)
+	if err := u.SetPassword(passwords[0]); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range passwords[1:] {
+		if err := u.changePassword("ann@example.com", p); err != nil {
+			t.Fatalf("changePassword(%q) error = %v", p, err)
+		}
+	}
+
+	for _, p := range passwords {
+		if err := u.changePassword("ann@example.com", p); rpcStatus.Code(err) != codes.FailedPrecondition {
+			t.Errorf("changePassword(%q) error = %v, want FailedPrecondition", p, err)
+		}
+	}
+
+	// The fourth password pushes the first one out of the last 3.
+	if err := u.changePassword("ann@example.com", "Fourth!Passw0rd"); err != nil {
+		t.Fatalf("changePassword() error = %v", err)
+	}
+	if len(u.passwordHistory) != passwordHistorySize-1 {
+		t.Errorf("history holds %d passwords, want %d", len(u.passwordHistory), passwordHistorySize-1)
+	}
+	if err := u.changePassword("ann@example.com", passwords[0]); err != nil {
+		t.Errorf("changePassword() of a password older than the last %d error = %v", passwordHistorySize, err)
+	}
+}
+
+func TestPasswordHistoryRoundTrip(t *testing.T) {
+	history := [][]byte{[]byte("$2a$10$first"), []byte("$2a$10$second")}
+
+	got, err := parsePasswordHistory(marshalPasswordHistory(history))
+	if err != nil {
+		t.Fatalf("parsePasswordHistory() error = %v", err)
+	}
+	if len(got) != len(history) || string(got[0]) != string(history[0]) || string(got[1]) != string(history[1]) {
+		t.Errorf("parsePasswordHistory() = %q, want %q", got, history)
+	}
+
+	if got, err := parsePasswordHistory(""); err != nil || got != nil {
+		t.Errorf("parsePasswordHistory(\"\") = %q, %v, want no history", got, err)
+	}
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// purgedEmailDomain is the domain of the anonymized email of the purged users.
+// The .invalid top-level domain is reserved, so the address never reaches anyone.
+const purgedEmailDomain = "purged.invalid"
+
+// PurgeUser anonymizes the email, the username and the display name of a closed user,
+// so the email can be used by another user. The user row is kept, and the created by and updated by
+// of the calculations of the user are moved to the anonymized username, so they keep referring to it
+// and a new user of the email does not see them. Only admins are allowed to purge users.
+func (s *Auth) PurgeUser(ctx context.Context, id string) (*User, error) {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "PurgeUser"),
+		zap.String("Username", claims.Username),
+		zap.String("userId", id),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := checkNotSelf(claims, id); err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(ctx, s.db, &UserQuery{
+		ID: id,
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to access this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if user.purgedAt != nil {
+		return user, nil
+	}
+
+	if user.Status != StatusClosed {
+		return nil, rpcStatus.Error(codes.FailedPrecondition, "The user status is not closed. You must terminate this user before purging it.")
+	}
+
+	email, username := user.Email, user.Username
+	user.purge(claims.Username)
+	err = purgeUser(ctx, s.db, claims.Username, user, email, username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, rpcStatus.Error(codes.FailedPrecondition, "The user status is not closed. You must terminate this user before purging it.")
+	}
+	if err != nil {
+		zlog.Error("failed to purge user", zap.Error(err))
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// purge anonymizes the user and drops its password, so it can never log in again.
+func (u *User) purge(by string) {
+	now := time.Now()
+
+	u.Email = fmt.Sprintf("deleted+%s@%s", u.ID, purgedEmailDomain)
+	u.Username = u.Email
+	u.DisplayName = "Deleted user"
+	u.hashedPassword = []byte{}
+	u.passwordHistory = nil
+	u.purgedBy = by
+	u.purgedAt = &now
+	u.updatedBy = by
+	u.UpdatedAt = now
+}
+
+// purgeUser saves the anonymized user and moves the login history and the calculations of its previous
+// email and username to the anonymized ones in one transaction, so a new user of the email
+// does not see the history or the calculations of the purged one.
+func purgeUser(ctx context.Context, db *sql.DB, by string, in *User, previousEmail, previousUsername string) error {
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		q, args := sq.Update(`"user"`).
+			Set("email", in.Email).
+			Set("username", in.Username).
+			Set("display_name", in.DisplayName).
+			Set("password_hash", in.hashedPassword).
+			Set("password_history", marshalPasswordHistory(in.passwordHistory)).
+			Set("purged_by", in.purgedBy).
+			Set("purged_at", in.purgedAt).
+			Set("updated_by", in.updatedBy).
+			Set("updated_at", in.UpdatedAt).
+			Where(sq.Eq{
+				"id":     in.ID,
+				"status": StatusClosed,
+			}).
+			PlaceholderFormat(sq.AtP).
+			MustSql()
+
+		effected, err := tx.ExecContext(ctx, q, args...)
+		if err != nil {
+			return fmt.Errorf("failed to purge user: %w", err)
+		}
+
+		rowsAffected, err := effected.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return ErrUserNotFound
+		}
+
+		q, args = sq.Update("login_history").
+			Set("email", in.Email).
+			Where(sq.Eq{
+				"email": previousEmail,
+			}).
+			PlaceholderFormat(sq.AtP).
+			MustSql()
+
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return fmt.Errorf("failed to anonymize login history: %w", err)
+		}
+
+		_, err = reassignCalculationsTx(ctx, tx, by, &ReassignCalculationsReq{
+			FromUsername: previousUsername,
+			ToUsername:   in.Username,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to anonymize calculations: %w", err)
+		}
+
+		return nil
+	})
+}
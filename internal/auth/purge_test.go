@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestPurgeUserMovesCalculations(t *testing.T) {
+	s, mock := newTestAuth(t)
+	user := newTestUser("user00000001", "ann@example.com", RoleUser)
+	user.Status = StatusClosed
+	const purgedUsername = "deleted+user00000001@purged.invalid"
+
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+	mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE login_history SET email`)
+	moves := make([]*dbtest.Expectation, 0)
+	for _, table := range []string{"statement_file_analysis", "self_employed_analysis", "cib_file_analysis"} {
+		moves = append(moves,
+			mock.ExpectExec(`UPDATE `+table+` SET created_by`).WillReturnResult(2),
+			mock.ExpectExec(`UPDATE `+table+` SET updated_by`).WillReturnResult(2),
+		)
+		mock.ExpectExec(`INSERT INTO audit_log`)
+	}
+
+	purged, err := s.PurgeUser(contextWithRole(RoleAdmin), user.ID)
+	if err != nil {
+		t.Fatalf("PurgeUser() error = %v", err)
+	}
+	if purged.Username != purgedUsername || purged.Email != purgedUsername {
+		t.Errorf("PurgeUser() = %s, %s, want %s", purged.Email, purged.Username, purgedUsername)
+	}
+
+	// A new user of the email must not become the creator of the calculations of the purged user.
+	for _, e := range moves {
+		if args := e.Args(); len(args) != 2 || args[0] != purgedUsername || args[1] != "ann@example.com" {
+			t.Errorf("calculations moved with args %v, want from ann@example.com to %s", args, purgedUsername)
+		}
+	}
+	if mock.Commits() != 1 {
+		t.Errorf("commits = %d, want 1", mock.Commits())
+	}
+}
+
+func TestPurgeUserRollsBackOnFailedMove(t *testing.T) {
+	s, mock := newTestAuth(t)
+	user := newTestUser("user00000001", "ann@example.com", RoleUser)
+	user.Status = StatusClosed
+
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+	mock.ExpectExec(`UPDATE "user"`)
+	mock.ExpectExec(`UPDATE login_history SET email`)
+	mock.ExpectExec(`UPDATE statement_file_analysis SET created_by`).WillReturnError(errors.New("database is down"))
+
+	if _, err := s.PurgeUser(contextWithRole(RoleAdmin), user.ID); err == nil {
+		t.Fatal("PurgeUser() error = nil, want the failed move")
+	}
+	if mock.Commits() != 0 || mock.Rollbacks() != 1 {
+		t.Errorf("commits = %d, rollbacks = %d, want the purge rolled back", mock.Commits(), mock.Rollbacks())
+	}
+}
+
+func TestPurgeUserRequiresClosedUser(t *testing.T) {
+	s, mock := newTestAuth(t)
+	user := newTestUser("user00000001", "ann@example.com", RoleUser)
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+
+	_, err := s.PurgeUser(contextWithRole(RoleAdmin), user.ID)
+	if rpcStatus.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("PurgeUser() error = %v, want FailedPrecondition", err)
+	}
+	if mock.Commits() != 0 {
+		t.Error("an enabled user was purged")
+	}
+}
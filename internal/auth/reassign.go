@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// calculationTables are the tables of the calculations that can be reassigned,
+// keyed by the name returned in the reassignment result.
+var calculationTables = []struct {
+	name  string
+	table string
+}{
+	{name: "income", table: "statement_file_analysis"},
+	{name: "selfemployed", table: "self_employed_analysis"},
+	{name: "cib", table: "cib_file_analysis"},
+}
+
+type ReassignCalculationsReq struct {
+	FromUsername string `json:"fromUsername"`
+	ToUsername   string `json:"toUsername"`
+
+	// Numbers limits the reassignment to the calculations with these numbers.
+	// All calculations of FromUsername are reassigned when it is empty.
+	Numbers []string `json:"numbers"`
+}
+
+func (r *ReassignCalculationsReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	r.FromUsername = strings.TrimSpace(r.FromUsername)
+	r.ToUsername = strings.TrimSpace(r.ToUsername)
+
+	if r.FromUsername == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "fromUsername",
+			Description: "From username must not be empty",
+		})
+	}
+
+	if r.ToUsername == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "toUsername",
+			Description: "To username must not be empty",
+		})
+	}
+
+	if r.FromUsername != "" && r.FromUsername == r.ToUsername {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "toUsername",
+			Description: "To username must be different from the from username",
+		})
+	}
+
+	for i, n := range r.Numbers {
+		if strings.TrimSpace(n) == "" {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("numbers[%d]", i),
+				Description: "Number must not be empty",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Reassignment is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+type ReassignCalculationsResult struct {
+	FromUsername string `json:"fromUsername"`
+	ToUsername   string `json:"toUsername"`
+
+	// Reassigned is the number of calculations reassigned per calculation type.
+	Reassigned map[string]int64 `json:"reassigned"`
+}
+
+// ReassignCalculations moves the ownership of calculations from one user to another,
+// e.g. when the owner has left. Only admins are allowed to reassign calculations.
+// The receiving user must be enabled.
+func (s *Auth) ReassignCalculations(ctx context.Context, in *ReassignCalculationsReq) (*ReassignCalculationsResult, error) {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ReassignCalculations"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := getUser(ctx, s.db, &UserQuery{Username: in.FromUsername}); err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to access this resource or (it may not exist)")
+		}
+
+		zlog.Error("failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	to, err := getUser(ctx, s.db, &UserQuery{Username: in.ToUsername})
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to access this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if !to.IsEnabled() {
+		return nil, rpcStatus.Error(codes.FailedPrecondition, "Calculations can only be reassigned to an enabled user.")
+	}
+
+	reassigned, err := reassignCalculations(ctx, s.db, claims.Username, in)
+	if err != nil {
+		zlog.Error("failed to reassign calculations", zap.Error(err))
+		return nil, err
+	}
+
+	return &ReassignCalculationsResult{
+		FromUsername: in.FromUsername,
+		ToUsername:   in.ToUsername,
+		Reassigned:   reassigned,
+	}, nil
+}
+
+type reassignAuditDetail struct {
+	FromUsername string   `json:"fromUsername"`
+	ToUsername   string   `json:"toUsername"`
+	Numbers      []string `json:"numbers"`
+	Count        int64    `json:"count"`
+}
+
+// reassignCalculations updates the created_by and updated_by of the calculations
+// and records an audit log entry per calculation table within one transaction.
+func reassignCalculations(ctx context.Context, db *sql.DB, by string, in *ReassignCalculationsReq) (map[string]int64, error) {
+	var reassigned map[string]int64
+	err := database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		var err error
+		reassigned, err = reassignCalculationsTx(ctx, tx, by, in)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reassigned, nil
+}
+
+// reassignCalculationsTx is reassignCalculations within the given transaction.
+func reassignCalculationsTx(ctx context.Context, tx *sql.Tx, by string, in *ReassignCalculationsReq) (map[string]int64, error) {
+	reassigned := make(map[string]int64, len(calculationTables))
+	now := time.Now()
+	for _, t := range calculationTables {
+		var count int64
+		for _, column := range []string{"created_by", "updated_by"} {
+			pred := sq.And{sq.Eq{column: in.FromUsername}}
+			if len(in.Numbers) > 0 {
+				pred = append(pred, sq.Eq{"number": in.Numbers})
+			}
+
+			q, args := sq.Update(t.table).
+				Set(column, in.ToUsername).
+				Where(pred).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			result, err := tx.ExecContext(ctx, q, args...)
+			if err != nil {
+				return nil, fmt.Errorf("failed to reassign %s of %s: %w", column, t.table, err)
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get rows affected: %w", err)
+			}
+
+			// created_by decides the ownership of a calculation,
+			// updated_by only follows it.
+			if column == "created_by" {
+				count = rowsAffected
+			}
+		}
+		reassigned[t.name] = count
+
+		detail, err := json.Marshal(&reassignAuditDetail{
+			FromUsername: in.FromUsername,
+			ToUsername:   in.ToUsername,
+			Numbers:      in.Numbers,
+			Count:        count,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal audit detail: %w", err)
+		}
+
+		q, args := sq.Insert("audit_log").
+			Columns(
+				"action",
+				"resource",
+				"detail",
+				"created_by",
+				"created_at",
+			).
+			Values(
+				"REASSIGN_CALCULATIONS",
+				t.table,
+				string(detail),
+				by,
+				now,
+			).
+			PlaceholderFormat(sq.AtP).
+			MustSql()
+
+		if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+			return nil, fmt.Errorf("failed to insert audit log: %w", err)
+		}
+	}
+
+	return reassigned, nil
+}
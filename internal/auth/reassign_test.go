@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestReassignCalculations(t *testing.T) {
+	s, mock := newTestAuth(t)
+	from := newTestUser("user00000001", "ann@example.com", RoleUser)
+	from.Status = StatusClosed
+	to := newTestUser("user00000002", "bob@example.com", RoleUser)
+
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(from))
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(to))
+	moves := make([]*dbtest.Expectation, 0)
+	audits := make([]*dbtest.Expectation, 0)
+	for i, table := range []string{"statement_file_analysis", "self_employed_analysis", "cib_file_analysis"} {
+		moves = append(moves,
+			mock.ExpectExec(`UPDATE `+table+` SET created_by`).WillReturnResult(int64(i)),
+			mock.ExpectExec(`UPDATE `+table+` SET updated_by`).WillReturnResult(3),
+		)
+		audits = append(audits, mock.ExpectExec(`INSERT INTO audit_log`))
+	}
+
+	result, err := s.ReassignCalculations(contextWithRole(RoleAdmin), &ReassignCalculationsReq{
+		FromUsername: " ann@example.com ",
+		ToUsername:   "bob@example.com",
+		Numbers:      []string{"APP-1", "APP-2"},
+	})
+	if err != nil {
+		t.Fatalf("ReassignCalculations() error = %v", err)
+	}
+
+	// The count follows created_by, which decides the ownership.
+	want := map[string]int64{"income": 0, "selfemployed": 1, "cib": 2}
+	if !maps.Equal(result.Reassigned, want) {
+		t.Errorf("reassigned = %v, want %v", result.Reassigned, want)
+	}
+	for _, e := range moves {
+		args := e.Args()
+		if len(args) != 4 || args[0] != "bob@example.com" || args[1] != "ann@example.com" || !slices.Contains(args, any("APP-2")) {
+			t.Errorf("calculations moved with args %v, want APP-1 and APP-2 from ann@example.com to bob@example.com", args)
+		}
+	}
+
+	for i, e := range audits {
+		args := e.Args()
+		if len(args) != 5 || args[0] != "REASSIGN_CALCULATIONS" || args[3] != "caller@example.com" {
+			t.Fatalf("audit log args = %v, want the reassignment by caller@example.com", args)
+		}
+
+		var detail reassignAuditDetail
+		if err := json.Unmarshal([]byte(args[2].(string)), &detail); err != nil {
+			t.Fatal(err)
+		}
+		if detail.FromUsername != "ann@example.com" || detail.ToUsername != "bob@example.com" || detail.Count != int64(i) || len(detail.Numbers) != 2 {
+			t.Errorf("audit detail of %s = %+v, want %d calculations from ann@example.com to bob@example.com", args[1], detail, i)
+		}
+	}
+	if mock.Commits() != 1 {
+		t.Errorf("commits = %d, want 1", mock.Commits())
+	}
+}
+
+func TestReassignCalculationsRejected(t *testing.T) {
+	disabled := newTestUser("user00000002", "bob@example.com", RoleUser)
+	disabled.Status = StatusDisabled
+
+	tests := []struct {
+		name     string
+		role     Role
+		req      *ReassignCalculationsReq
+		users    []*User
+		wantCode codes.Code
+	}{
+		{
+			name:     "not an admin",
+			role:     RoleReadOnlyAdmin,
+			req:      &ReassignCalculationsReq{FromUsername: "ann@example.com", ToUsername: "bob@example.com"},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "same user",
+			role:     RoleAdmin,
+			req:      &ReassignCalculationsReq{FromUsername: "ann@example.com", ToUsername: " ann@example.com"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "empty number",
+			role:     RoleAdmin,
+			req:      &ReassignCalculationsReq{FromUsername: "ann@example.com", ToUsername: "bob@example.com", Numbers: []string{" "}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "disabled receiver",
+			role:     RoleAdmin,
+			req:      &ReassignCalculationsReq{FromUsername: "ann@example.com", ToUsername: "bob@example.com"},
+			users:    []*User{newTestUser("user00000001", "ann@example.com", RoleUser), disabled},
+			wantCode: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAuth(t)
+			for _, u := range tt.users {
+				mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(u))
+			}
+
+			_, err := s.ReassignCalculations(contextWithRole(tt.role), tt.req)
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ReassignCalculations() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if mock.Commits() != 0 {
+				t.Error("calculations were reassigned")
+			}
+		})
+	}
+}
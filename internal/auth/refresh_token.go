@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// RevokeToken revokes the token pair of the given token ID, so its refresh token can no longer be used
+// and its access token is rejected. Users can revoke their own tokens, admins any token.
+func (s *Auth) RevokeToken(ctx context.Context, tokenID string) error {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "RevokeToken"),
+		zap.String("Username", claims.Username),
+		zap.String("tokenId", tokenID),
+	)
+
+	where := sq.Eq{"id": tokenID}
+	if !claims.IsAdmin {
+		where["user_id"] = claims.ID
+	}
+
+	n, err := revokeRefreshTokens(ctx, s.db, where)
+	if err != nil {
+		zlog.Error("failed to revoke token", zap.Error(err))
+		return err
+	}
+	if n == 0 {
+		return rpcStatus.Error(codes.PermissionDenied, "You are not allowed to access this resource or (it may not exist)")
+	}
+
+	return nil
+}
+
+// IsTokenRevoked reports whether the token pair of the given token ID has been revoked.
+// The tokens without a token ID were issued before the tokens were tracked and are never revoked.
+func (s *Auth) IsTokenRevoked(ctx context.Context, tokenID string) (bool, error) {
+	if tokenID == "" {
+		return false, nil
+	}
+
+	return isRefreshTokenRevoked(ctx, s.db, tokenID)
+}
+
+// revokeUserTokens revokes every token of the user, e.g. when the user is disabled or terminated.
+func (s *Auth) revokeUserTokens(ctx context.Context, zlog *zap.Logger, userID string) error {
+	if _, err := revokeRefreshTokens(ctx, s.db, sq.Eq{"user_id": userID}); err != nil {
+		zlog.Error("failed to revoke user tokens", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func createRefreshToken(ctx context.Context, db *sql.DB, id, userID string, expiresAt time.Time) error {
+	defer database.TimeQuery("auth.createRefreshToken")()
+
+	q, args := sq.Insert("refresh_token").
+		Columns(
+			"id",
+			"user_id",
+			"expires_at",
+		).
+		Values(
+			id,
+			userID,
+			expiresAt,
+		).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	if _, err := db.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// useRefreshToken marks the refresh token of the given ID as used.
+// It reports false if the token is unknown, has already been used or has been revoked.
+func useRefreshToken(ctx context.Context, db *sql.DB, id string) (bool, error) {
+	defer database.TimeQuery("auth.useRefreshToken")()
+
+	q, args := sq.Update("refresh_token").
+		Set("used_at", time.Now()).
+		Where(sq.Eq{
+			"id":         id,
+			"used_at":    nil,
+			"revoked_at": nil,
+		}).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	res, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// revokeRefreshTokens revokes the refresh tokens matching the predicate not revoked yet
+// and returns how many were revoked.
+func revokeRefreshTokens(ctx context.Context, db *sql.DB, where sq.Eq) (int64, error) {
+	defer database.TimeQuery("auth.revokeRefreshTokens")()
+
+	pred := sq.And{where, sq.Eq{"revoked_at": nil}}
+	q, args := sq.Update("refresh_token").
+		Set("revoked_at", time.Now()).
+		Where(pred).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	res, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return n, nil
+}
+
+func isRefreshTokenRevoked(ctx context.Context, db *sql.DB, id string) (bool, error) {
+	defer database.TimeQuery("auth.isRefreshTokenRevoked")()
+
+	q, args := sq.Select("TOP 1 revoked_at").
+		From("refresh_token").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	var revokedAt sql.NullTime
+	err := db.QueryRowContext(ctx, q, args...).Scan(&revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check if refresh token is revoked: %w", err)
+	}
+
+	return revokedAt.Valid, nil
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestRefreshTokenUsedOnce(t *testing.T) {
+	s, mock := newTestAuth(t)
+	s.aKey = paseto.NewV4SymmetricKey()
+	s.rKey = paseto.NewV4SymmetricKey()
+	user := newTestUser("user00000001", "ann@example.com", RoleUser)
+	ctx := context.Background()
+
+	mock.ExpectExec(`INSERT INTO refresh_token`)
+	token, err := s.genToken(ctx, user)
+	if err != nil {
+		t.Fatalf("genToken() error = %v", err)
+	}
+
+	first := mock.ExpectExec(`UPDATE refresh_token SET used_at`)
+	mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+	mock.ExpectExec(`INSERT INTO refresh_token`)
+	if _, err := s.RefreshToken(ctx, &NewTokenReq{Token: token.Refresh}); err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+
+	// The token was marked used by the first refresh, so it no longer matches an unused token.
+	reuse := mock.ExpectExec(`UPDATE refresh_token SET used_at`).WillReturnResult(0)
+	_, err = s.RefreshToken(ctx, &NewTokenReq{Token: token.Refresh})
+	if rpcStatus.Code(err) != codes.Unauthenticated {
+		t.Fatalf("RefreshToken() of a used token error = %v, want Unauthenticated", err)
+	}
+
+	tokenID := first.Args()[1]
+	if !slices.Contains(reuse.Args(), tokenID) {
+		t.Errorf("reused token args = %v, want the token ID %v", reuse.Args(), tokenID)
+	}
+}
+
+func TestRefreshTokenRejectsInvalidTokens(t *testing.T) {
+	s, _ := newTestAuth(t)
+	s.rKey = paseto.NewV4SymmetricKey()
+
+	// A token encrypted with another key, e.g. an access token.
+	other := paseto.NewToken()
+	other.SetExpiration(time.Now().Add(time.Hour))
+	forged := other.V4Encrypt(paseto.NewV4SymmetricKey(), nil)
+
+	for _, token := range []string{"", "not-a-token", forged} {
+		_, err := s.RefreshToken(context.Background(), &NewTokenReq{Token: token})
+		if rpcStatus.Code(err) != codes.Unauthenticated {
+			t.Errorf("RefreshToken(%q) error = %v, want Unauthenticated", token, err)
+		}
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		role       Role
+		revoked    int64
+		wantUserID bool
+		want       codes.Code
+	}{
+		{name: "own token", role: RoleUser, revoked: 1, wantUserID: true, want: codes.OK},
+		{name: "token of another user", role: RoleUser, revoked: 0, wantUserID: true, want: codes.PermissionDenied},
+		{name: "admin", role: RoleAdmin, revoked: 1, want: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAuth(t)
+			revoke := mock.ExpectExec(`UPDATE refresh_token SET revoked_at`).WillReturnResult(tt.revoked)
+
+			err := s.RevokeToken(contextWithRole(tt.role), "token0000001")
+			if got := rpcStatus.Code(err); got != tt.want {
+				t.Fatalf("RevokeToken() error = %v, want %s", err, tt.want)
+			}
+			if got := slices.Contains(revoke.Args(), any("caller000001")); got != tt.wantUserID {
+				t.Errorf("revoke restricted to the caller = %v, want %v", got, tt.wantUserID)
+			}
+		})
+	}
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	tests := []struct {
+		name      string
+		tokenID   string
+		revokedAt any
+		want      bool
+	}{
+		{name: "revoked", tokenID: "token0000001", revokedAt: time.Now(), want: true},
+		{name: "not revoked", tokenID: "token0000001", revokedAt: nil, want: false},
+		{name: "issued before the tokens were tracked", tokenID: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAuth(t)
+			if tt.tokenID != "" {
+				mock.ExpectQuery(`TOP 1 revoked_at FROM refresh_token`).WillReturnRows([]string{"revoked_at"}, []any{tt.revokedAt})
+			}
+
+			got, err := s.IsTokenRevoked(context.Background(), tt.tokenID)
+			if err != nil {
+				t.Fatalf("IsTokenRevoked() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("IsTokenRevoked() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisablingUserRevokesTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		call func(s *Auth, ctx context.Context, id string) (*User, error)
+	}{
+		{name: "disable", call: (*Auth).DisableUser},
+		{name: "terminate", call: (*Auth).TerminateUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestAuth(t)
+			user := newTestUser("user00000001", "ann@example.com", RoleUser)
+			mock.ExpectQuery(`FROM "user"`).WillReturnRows(userColumns, userRow(user))
+			mock.ExpectExec(`UPDATE "user"`)
+			revoke := mock.ExpectExec(`UPDATE refresh_token SET revoked_at`).WillReturnResult(3)
+
+			if _, err := tt.call(s, contextWithRole(RoleAdmin), user.ID); err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !slices.Contains(revoke.Args(), any(user.ID)) {
+				t.Errorf("revoked token args = %v, want the tokens of %s", revoke.Args(), user.ID)
+			}
+		})
+	}
+}
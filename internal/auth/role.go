@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// Role is the level of access of a user.
+type Role string
+
+const (
+	// RoleUser can only access the resources they created.
+	RoleUser Role = "user"
+
+	// RoleReadOnlyAdmin can view every resource, e.g. a supervisor,
+	// but cannot change the users or the settings.
+	RoleReadOnlyAdmin Role = "readonly_admin"
+
+	// RoleApprover can view and complete every calculation, e.g. a reviewer,
+	// but cannot create or recalculate them.
+	RoleApprover Role = "approver"
+
+	// RoleAdmin can view and change every resource.
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) String() string {
+	return string(r)
+}
+
+// IsValid reports whether the role is one of the known roles.
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleUser, RoleReadOnlyAdmin, RoleApprover, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// CanViewAll reports whether the claims allow to view the resources of every user.
+// Admins, read-only admins and approvers can; the admin-only changes still require IsAdmin.
+func (c *Claims) CanViewAll() bool {
+	return c.IsAdmin || c.Role == RoleReadOnlyAdmin || c.Role == RoleApprover
+}
+
+// ChangeableCreator returns the user the resources changed by the claims must have been created by,
+// or an empty string if the claims have one of the given roles, which can change the resources of every user.
+// Unlike VisibleCreator, viewing every resource does not allow to change them; only admins can without a role.
+func (c *Claims) ChangeableCreator(roles ...Role) string {
+	if c.HasRole(roles...) {
+		return ""
+	}
+
+	return c.Username
+}
+
+// HasRole reports whether the claims have one of the given roles.
+// Admins have every role, IsAdmin being kept for the tokens issued before the roles.
+func (c *Claims) HasRole(roles ...Role) bool {
+	if c.IsAdmin {
+		return true
+	}
+
+	for _, r := range roles {
+		if c.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) changeRole(by string, role Role) {
+	u.Role = role
+	u.IsAdmin = role == RoleAdmin
+	u.updatedBy = by
+	u.UpdatedAt = time.Now()
+}
+
+type ChangeUserRoleReq struct {
+	UserID string `json:"userId" param:"id"`
+	Role   Role   `json:"role"`
+}
+
+func (r *ChangeUserRoleReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if len(r.UserID) != 12 {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "userId",
+			Description: "User ID must be a valid user ID",
+		})
+	}
+
+	if !r.Role.IsValid() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "role",
+			Description: fmt.Sprintf("Role must be one of %s, %s, %s or %s", RoleUser, RoleReadOnlyAdmin, RoleApprover, RoleAdmin),
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Change role is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// ChangeUserRole changes the role of a user. Only admins are allowed to change the roles.
+// The new role applies from the next token of the user.
+func (s *Auth) ChangeUserRole(ctx context.Context, in *ChangeUserRoleReq) (*User, error) {
+	claims := ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ChangeUserRole"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	user, err := getUser(ctx, s.db, &UserQuery{
+		ID: in.UserID,
+	})
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to access this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get user", zap.Error(err))
+		return nil, err
+	}
+
+	if in.Role != RoleAdmin {
+		if err := checkNotLastAdmin(ctx, s.db, user); err != nil {
+			return nil, err
+		}
+	}
+
+	user.changeRole(claims.Username, in.Role)
+	if err := updateUser(ctx, s.db, user); err != nil {
+		zlog.Error("failed to update user", zap.Error(err))
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,104 @@
+package auth
+
+import "testing"
+
+func TestClaimsHasRole(t *testing.T) {
+	roles := []Role{RoleUser, RoleReadOnlyAdmin, RoleApprover, RoleAdmin}
+
+	tests := []struct {
+		name    string
+		claims  *Claims
+		allowed []Role
+	}{
+		{
+			name:    "user",
+			claims:  &Claims{Role: RoleUser},
+			allowed: []Role{RoleUser},
+		},
+		{
+			name:    "read-only admin",
+			claims:  &Claims{Role: RoleReadOnlyAdmin},
+			allowed: []Role{RoleReadOnlyAdmin},
+		},
+		{
+			name:    "approver",
+			claims:  &Claims{Role: RoleApprover},
+			allowed: []Role{RoleApprover},
+		},
+		{
+			name:    "admin",
+			claims:  &Claims{Role: RoleAdmin, IsAdmin: true},
+			allowed: roles,
+		},
+		{
+			name:    "admin issued before the roles",
+			claims:  &Claims{IsAdmin: true},
+			allowed: roles,
+		},
+		{
+			name:    "no role",
+			claims:  &Claims{},
+			allowed: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := make(map[Role]bool, len(tt.allowed))
+			for _, r := range tt.allowed {
+				allowed[r] = true
+			}
+
+			for _, r := range roles {
+				if got := tt.claims.HasRole(r); got != allowed[r] {
+					t.Errorf("HasRole(%s) = %v, want %v", r, got, allowed[r])
+				}
+			}
+		})
+	}
+}
+
+func TestClaimsVisibleCreator(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   string
+	}{
+		{name: "user", claims: &Claims{Role: RoleUser, Username: "ann"}, want: "ann"},
+		{name: "read-only admin", claims: &Claims{Role: RoleReadOnlyAdmin, Username: "ann"}, want: ""},
+		{name: "approver", claims: &Claims{Role: RoleApprover, Username: "ann"}, want: ""},
+		{name: "admin", claims: &Claims{Role: RoleAdmin, IsAdmin: true, Username: "ann"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.VisibleCreator(); got != tt.want {
+				t.Errorf("VisibleCreator() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClaimsChangeableCreator(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims *Claims
+		roles  []Role
+		want   string
+	}{
+		{name: "user", claims: &Claims{Role: RoleUser, Username: "ann"}, want: "ann"},
+		{name: "read-only admin", claims: &Claims{Role: RoleReadOnlyAdmin, Username: "ann"}, want: "ann"},
+		{name: "approver", claims: &Claims{Role: RoleApprover, Username: "ann"}, want: "ann"},
+		{name: "approver completing", claims: &Claims{Role: RoleApprover, Username: "ann"}, roles: []Role{RoleApprover}, want: ""},
+		{name: "user completing", claims: &Claims{Role: RoleUser, Username: "ann"}, roles: []Role{RoleApprover}, want: "ann"},
+		{name: "admin", claims: &Claims{Role: RoleAdmin, IsAdmin: true, Username: "ann"}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.claims.ChangeableCreator(tt.roles...); got != tt.want {
+				t.Errorf("ChangeableCreator(%v) = %q, want %q", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import "time"
+
+// UserView is the representation of a user returned by the user endpoints.
+// The audit metadata is only set for admin callers.
+type UserView struct {
+	IsAdmin     bool   `json:"isAdmin"`
+	Role        Role   `json:"role"`
+	ID          string `json:"id"`
+	Email       string `json:"email"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	Status      status `json:"status"`
+
+	CreatedBy string     `json:"createdBy,omitempty"`
+	UpdatedBy string     `json:"updatedBy,omitempty"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	PurgedBy  string     `json:"purgedBy,omitempty"`
+	PurgedAt  *time.Time `json:"purgedAt,omitempty"`
+}
+
+// View returns the view of the user for the caller of the given claims.
+// Callers who can view every resource see the audit metadata of the user, others see a trimmed view.
+func (u *User) View(claims *Claims) *UserView {
+	v := &UserView{
+		IsAdmin:     u.IsAdmin,
+		Role:        u.Role,
+		ID:          u.ID,
+		Email:       u.Email,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Status:      u.Status,
+	}
+
+	if claims == nil || !claims.CanViewAll() {
+		return v
+	}
+
+	createdAt, updatedAt := u.CreatedAt, u.UpdatedAt
+	v.CreatedBy = u.createdBy
+	v.UpdatedBy = u.updatedBy
+	v.CreatedAt = &createdAt
+	v.UpdatedAt = &updatedAt
+	v.PurgedBy = u.purgedBy
+	v.PurgedAt = u.purgedAt
+
+	return v
+}
+
+type ListUserViewsResult struct {
+	Users         []*UserView `json:"users"`
+	NextPageToken string      `json:"nextPageToken"`
+}
+
+// View returns the result with the view of each user for the caller of the given claims.
+func (r *ListUsersResult) View(claims *Claims) *ListUserViewsResult {
+	users := make([]*UserView, len(r.Users))
+	for i, u := range r.Users {
+		users[i] = u.View(claims)
+	}
+
+	return &ListUserViewsResult{
+		Users:         users,
+		NextPageToken: r.NextPageToken,
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestUserView(t *testing.T) {
+	auditFields := []string{"createdBy", "updatedBy", "createdAt", "updatedAt"}
+
+	tests := []struct {
+		role      Role
+		wantAudit bool
+	}{
+		{role: RoleAdmin, wantAudit: true},
+		{role: RoleReadOnlyAdmin, wantAudit: true},
+		{role: RoleApprover, wantAudit: true},
+		{role: RoleUser},
+	}
+
+	u := newTestUser("user00000001", "ann@example.com", RoleUser)
+	u.createdBy = "admin@example.com"
+	u.updatedBy = "admin@example.com"
+	result := &ListUsersResult{Users: []*User{u}, NextPageToken: "next"}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			claims := &Claims{Username: "caller@example.com", Role: tt.role, IsAdmin: tt.role == RoleAdmin}
+			b, err := json.Marshal(result.View(claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got struct {
+				Users         []map[string]any `json:"users"`
+				NextPageToken string           `json:"nextPageToken"`
+			}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Users) != 1 || got.NextPageToken != "next" {
+				t.Fatalf("View() = %s, want the user and the next page token", b)
+			}
+
+			user := got.Users[0]
+			if user["email"] != "ann@example.com" || user["role"] != string(RoleUser) {
+				t.Errorf("View() = %s, want the profile of the user", b)
+			}
+			for _, field := range auditFields {
+				if _, ok := user[field]; ok != tt.wantAudit {
+					t.Errorf("%s shown = %v, want %v", field, ok, tt.wantAudit)
+				}
+			}
+			if tt.wantAudit && user["createdBy"] != "admin@example.com" {
+				t.Errorf("createdBy = %v, want admin@example.com", user["createdBy"])
+			}
+		})
+	}
+}
+
+func TestUserViewWithoutClaims(t *testing.T) {
+	u := newTestUser("user00000001", "ann@example.com", RoleUser)
+	u.createdBy = "admin@example.com"
+
+	if v := u.View(nil); v.CreatedBy != "" || v.CreatedAt != nil {
+		t.Errorf("View(nil) = %+v, want the trimmed view", v)
+	}
+}
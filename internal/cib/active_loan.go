@@ -0,0 +1,175 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/pager"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// ActiveLoan is an active contract of a customer together with
+// the calculation it was found in.
+type ActiveLoan struct {
+	CalculationID     int64     `json:"calculationId"`
+	CalculationNumber string    `json:"calculationNumber"`
+	CIBFileName       string    `json:"cibFileName"`
+	Customer          Customer  `json:"customer"`
+	Contract          Contract  `json:"contract"`
+	CalculatedAt      time.Time `json:"calculatedAt"`
+}
+
+type ActiveLoanQuery struct {
+	Name      string `query:"name"`
+	PageSize  uint64 `query:"pageSize"`
+	PageToken string `query:"pageToken"`
+}
+
+func (q *ActiveLoanQuery) Validate() error {
+	if strings.TrimSpace(q.Name) == "" {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Active loan query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "name",
+					Description: "Name must not be empty",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+type ListActiveLoansResult struct {
+	ActiveLoans   []*ActiveLoan `json:"activeLoans"`
+	NextPageToken string        `json:"nextPageToken"`
+}
+
+// ListActiveLoansByCustomer lists the active contracts of every calculation
+// whose customer display name matches the given name.
+// The contracts are flattened across calculations, newest calculation first.
+func (s *Service) ListActiveLoansByCustomer(ctx context.Context, in *ActiveLoanQuery) (*ListActiveLoansResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListActiveLoansByCustomer"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	size := int(pager.Size(in.PageSize))
+	nextID, startIndex := decodeActiveLoanCursor(in.PageToken)
+
+	q := &BatchGetCalculationsQuery{
+		CustomerDisplayName: strings.TrimSpace(in.Name),
+		createdBy:           claims.VisibleCreator(),
+	}
+
+	loans := make([]*ActiveLoan, 0)
+	var pageToken string
+	for len(loans) < size {
+		calculations, err := batchGetCalculations(ctx, s.db, size, nextID, q)
+		if err != nil {
+			zlog.Error("failed to get calculations", zap.Error(err))
+			return nil, err
+		}
+		if len(calculations) == 0 {
+			break
+		}
+
+		for _, c := range calculations {
+			for i := startIndex; i < len(c.Contracts); i++ {
+				if c.Contracts[i].Status != StatusActive {
+					continue
+				}
+
+				if len(loans) == size {
+					pageToken = encodeActiveLoanCursor(c, i)
+					break
+				}
+
+				loans = append(loans, &ActiveLoan{
+					CalculationID:     c.ID,
+					CalculationNumber: c.Number,
+					CIBFileName:       c.CIBFileName,
+					Customer:          c.Customer,
+					Contract:          c.Contracts[i],
+					CalculatedAt:      c.CreatedAt,
+				})
+			}
+			startIndex = 0
+
+			if pageToken != "" {
+				break
+			}
+		}
+		if pageToken != "" {
+			break
+		}
+
+		nextID = calculations[len(calculations)-1].ID
+	}
+
+	return &ListActiveLoansResult{
+		ActiveLoans:   loans,
+		NextPageToken: pageToken,
+	}, nil
+}
+
+// encodeActiveLoanCursor encodes the position of the next active loan.
+// The cursor ID holds the calculation ID and the contract index within it.
+func encodeActiveLoanCursor(c *Calculation, index int) string {
+	return pager.EncodeCursor(&pager.Cursor{
+		ID:   fmt.Sprintf("%d:%d", c.ID, index),
+		Time: c.CreatedAt,
+	})
+}
+
+// decodeActiveLoanCursor returns the batch cursor to resume listing from
+// and the contract index to start at within the first calculation.
+// An invalid token starts from the beginning.
+func decodeActiveLoanCursor(token string) (nextID int64, index int) {
+	if token == "" {
+		return 0, 0
+	}
+
+	cursor, err := pager.DecodeCursor(token)
+	if err != nil {
+		return 0, 0
+	}
+
+	id, idx, ok := strings.Cut(cursor.ID, ":")
+	if !ok {
+		return 0, 0
+	}
+
+	calculationID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || calculationID <= 0 {
+		return 0, 0
+	}
+
+	index, err = strconv.Atoi(idx)
+	if err != nil || index < 0 {
+		return 0, 0
+	}
+
+	// batchGetCalculations lists calculations with an ID lower than nextID,
+	// so the calculation of the cursor must be included.
+	return calculationID + 1, index
+}
@@ -0,0 +1,75 @@
+package cib
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+)
+
+func TestListActiveLoansByCustomer(t *testing.T) {
+	contract := func(number string, status status) Contract {
+		return Contract{
+			Number:           number,
+			BankCode:         "BCEL",
+			Currency:         "LAK",
+			Status:           status,
+			Installment:      decimal.NewFromInt(100000),
+			InstallmentInLAK: decimal.NewFromInt(100000),
+			ExchangeRate:     decimal.NewFromInt(1),
+		}
+	}
+	newer := batchRow(t, 2, "CIB-2", "Somchai", []Contract{
+		contract("LN-1", StatusActive),
+		contract("LN-2", StatusClosed),
+		contract("LN-3", StatusActive),
+	})
+	older := batchRow(t, 1, "CIB-1", "Somchai", []Contract{
+		contract("LN-4", StatusActive),
+		contract("LN-5", StatusActive),
+	})
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+
+	s, mock := newTestService(t)
+	first := mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns, newer, older)
+	page, err := s.ListActiveLoansByCustomer(ctx, &ActiveLoanQuery{Name: "Somchai", PageSize: 3})
+	if err != nil {
+		t.Fatalf("ListActiveLoansByCustomer() error = %v", err)
+	}
+	if got := loanNumbers(page.ActiveLoans); !slices.Equal(got, []string{"LN-1", "LN-3", "LN-4"}) {
+		t.Errorf("first page = %v, want [LN-1 LN-3 LN-4]", got)
+	}
+	if page.NextPageToken == "" {
+		t.Fatal("first page has no next page token, want one for LN-5")
+	}
+	if !slices.Contains(first.Args(), any("%Somchai%")) {
+		t.Errorf("args = %v, want the calculations of the customers named like Somchai", first.Args())
+	}
+	if got := page.ActiveLoans[2].CalculationNumber; got != "CIB-1" {
+		t.Errorf("calculation of LN-4 = %s, want CIB-1", got)
+	}
+
+	// The next page resumes within the older calculation.
+	mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns, older)
+	mock.ExpectQuery(`FROM cib_file_analysis`)
+	page, err = s.ListActiveLoansByCustomer(ctx, &ActiveLoanQuery{Name: "Somchai", PageSize: 3, PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatalf("ListActiveLoansByCustomer() error = %v", err)
+	}
+	if got := loanNumbers(page.ActiveLoans); !slices.Equal(got, []string{"LN-5"}) {
+		t.Errorf("second page = %v, want [LN-5]", got)
+	}
+	if page.NextPageToken != "" {
+		t.Errorf("second page token = %q, want none", page.NextPageToken)
+	}
+}
+
+func loanNumbers(loans []*ActiveLoan) []string {
+	numbers := make([]string, len(loans))
+	for i, l := range loans {
+		numbers[i] = l.Contract.Number
+	}
+	return numbers
+}
@@ -0,0 +1,86 @@
+package cib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// BankAggregate is the distribution of the contracts of a calculation per bank code,
+// read without the contracts of the calculation.
+type BankAggregate struct {
+	Number              string                `json:"number"`
+	AggregateByBankCode []AggregateByBankCode `json:"aggregateByBankCode"`
+}
+
+// GetAggregateByBankCode returns the distribution of the contracts per bank code
+// of the calculation of the given number.
+func (s *Service) GetAggregateByBankCode(ctx context.Context, number string) (*BankAggregate, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetAggregateByBankCode"),
+		zap.String("Username", claims.Username),
+		zap.String("number", number),
+	)
+
+	aggregate, err := getBankAggregate(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get aggregate by bank code", zap.Error(err))
+		return nil, err
+	}
+
+	return aggregate, nil
+}
+
+// getBankAggregate reads only the aggregate by bank code of the first calculation matching the query.
+func getBankAggregate(ctx context.Context, db *sql.DB, in *CalculationQuery) (*BankAggregate, error) {
+	defer database.TimeQuery("cib.getBankAggregate")()
+
+	pred, args, err := in.ToSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.
+		Select(
+			"TOP 1 number",
+			"aggregate_by_bank",
+		).
+		From(`cib_file_analysis`).
+		Where(pred, args...).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	var a BankAggregate
+	var aggregateBank []byte
+	err = db.QueryRowContext(ctx, q, args...).Scan(&a.Number, &aggregateBank)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCalculationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan aggregate by bank: %w", err)
+	}
+
+	a.AggregateByBankCode = make([]AggregateByBankCode, 0)
+	if err := json.Unmarshal(aggregateBank, &a.AggregateByBankCode); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal aggregate by bank: %w", err)
+	}
+
+	return &a, nil
+}
@@ -0,0 +1,49 @@
+package cib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestGetAggregateByBankCode(t *testing.T) {
+	s, mock := newTestService(t)
+	// Only the number and the aggregate are read, never the contracts.
+	projection := `^SELECT TOP 1 number, aggregate_by_bank FROM cib_file_analysis WHERE`
+	mock.ExpectQuery(projection).WillReturnRows([]string{"number", "aggregate_by_bank"},
+		[]any{"CIB-1", []byte(`[{"bankCode":"BCEL","quantity":"2"},{"bankCode":"LDB","quantity":"1"}]`)},
+	)
+	mock.ExpectQuery(projection)
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	got, err := s.GetAggregateByBankCode(ctx, "CIB-1")
+	if err != nil {
+		t.Fatalf("GetAggregateByBankCode() error = %v", err)
+	}
+
+	if got.Number != "CIB-1" || len(got.AggregateByBankCode) != 2 ||
+		got.AggregateByBankCode[0].BankCode != "BCEL" || !got.AggregateByBankCode[0].Quantity.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("GetAggregateByBankCode() = %+v, want 2 loans of BCEL and 1 of LDB", got)
+	}
+
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 2 {
+		t.Errorf("response fields = %s, want only the number and the aggregate by bank code", b)
+	}
+
+	if _, err := s.GetAggregateByBankCode(ctx, "CIB-2"); rpcStatus.Code(err) != codes.NotFound {
+		t.Errorf("GetAggregateByBankCode() of a missing calculation = %v, want NotFound", err)
+	}
+}
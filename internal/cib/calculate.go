@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,7 +27,8 @@ type Calculation struct {
 	CIBFileName           string                `json:"cibFileName"`
 	Number                string                `json:"number"`
 	Customer              Customer              `json:"customer"`
-	TotalInstallmentInLAK decimal.Decimal       `json:"totalInstallmentInLAK"`
+	TotalInstallmentInLAK decimal.Decimal       `json:"totalInstallmentInLAK"` // Total installment in the base currency.
+	BaseCurrency          string                `json:"baseCurrency"`          // Base currency of the installments, empty for the calculations saved before it was recorded.
 	AggregateQuantity     AggregateQuantity     `json:"aggregateQuantity"`
 	AggregateByBankCode   []AggregateByBankCode `json:"aggregateByBankCode"`
 	Contracts             []Contract            `json:"contracts"`
@@ -34,6 +36,9 @@ type Calculation struct {
 	UpdatedBy             string                `json:"updatedBy"`
 	CreatedAt             time.Time             `json:"createdAt"`
 	UpdatedAt             time.Time             `json:"updatedAt"`
+
+	// confidence is the confidence of the extracted fields, only recorded when the calculation is created.
+	confidence []FieldConfidence
 }
 
 func (c Calculation) BytesFromContracts() []byte {
@@ -41,6 +46,17 @@ func (c Calculation) BytesFromContracts() []byte {
 	return bytes
 }
 
+// stringFromConfidence returns the JSON encoding of the confidence, NULL if the extractor provided none.
+// It is bound as a string since the extraction_confidence column is NVARCHAR.
+func (c Calculation) stringFromConfidence() sql.NullString {
+	if len(c.confidence) == 0 {
+		return sql.NullString{}
+	}
+
+	bytes, _ := json.Marshal(c.confidence)
+	return sql.NullString{String: string(bytes), Valid: true}
+}
+
 func (c Calculation) BytesFromAggregateByBankCode() []byte {
 	bytes, _ := json.Marshal(c.AggregateByBankCode)
 	return bytes
@@ -86,14 +102,29 @@ type Contract struct {
 	OverdueInDay       decimal.Decimal `json:"overdueInDay"`
 	Period             decimal.Decimal `json:"period"`
 	Installment        decimal.Decimal `json:"installment"`
-	InstallmentInLAK   decimal.Decimal `json:"installmentInLAK"`
+	InstallmentInLAK   decimal.Decimal `json:"installmentInLAK"` // Installment in the base currency, see currency.Service.BaseCurrency.
 	ExchangeRate       decimal.Decimal `json:"exchangeRate"`
+
+	// Negligible is set for an active contract whose finance amount is below the minimum finance amount,
+	// it is listed but excluded from the active quantity and the total installment.
+	Negligible bool `json:"negligible"`
+
+	// DateWarnings lists the dates of the CIB file that are missing or could not be parsed,
+	// a zero first or last installment leaves the contract with a zero period.
+	DateWarnings []string `json:"dateWarnings,omitempty"`
+
+	// OverdueInDayWarning is set when the overdue days of the CIB file were out of range and clamped.
+	OverdueInDayWarning string `json:"overdueInDayWarning,omitempty"`
 }
 
 type CalculateReq struct {
 	fileID      int64
 	Number      string `json:"number"`
 	CIBFileName string `json:"cibFileName"`
+
+	// RatesAt pins the exchange rates to the rates effective at this time, e.g. to reproduce a past calculation.
+	// Zero uses the current rates.
+	RatesAt time.Time `json:"ratesAt"`
 }
 
 func (r *CalculateReq) Validate() error {
@@ -113,6 +144,13 @@ func (r *CalculateReq) Validate() error {
 		})
 	}
 
+	if r.RatesAt.After(time.Now()) {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "ratesAt",
+			Description: "Rates at must not be in the future",
+		})
+	}
+
 	if len(violations) > 0 {
 		s, _ := rpcStatus.New(
 			codes.InvalidArgument,
@@ -127,7 +165,7 @@ func (r *CalculateReq) Validate() error {
 	return nil
 }
 
-func newCalculationFromCIBInfo(by string, number string, fileName string, extraction *CreditBureau, currencies []*currency.Currency) *Calculation {
+func newCalculationFromCIBInfo(by string, number string, fileName string, extraction *CreditBureau, currencies map[string]decimal.Decimal, floors map[termType]decimal.Decimal, minFinanceAmountInLAK decimal.Decimal, installmentPlaces int32, maxOverdueDays decimal.Decimal) *Calculation {
 	now := time.Now()
 	c := new(Calculation)
 	c.CreatedBy = by
@@ -138,7 +176,9 @@ func newCalculationFromCIBInfo(by string, number string, fileName string, extrac
 	c.CIBFileName = fileName
 	c.Customer.DisplayName = extraction.DisplayName
 	c.Customer.PhoneNumber = extraction.MobileNumber
-	c.Contracts = newContracts(extraction.Contracts, currenciesToMap(currencies))
+	c.Contracts = newContracts(extraction.Contracts, currencies, floors, installmentPlaces)
+	clampOverdueDays(c.Contracts, maxOverdueDays)
+	markNegligibleContracts(c.Contracts, minFinanceAmountInLAK)
 	c.AggregateQuantity = newAggregateQuantity(c.Contracts)
 	c.AggregateByBankCode = extraction.AggregateByBankCode
 	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
@@ -149,14 +189,60 @@ func newCalculationFromCIBInfo(by string, number string, fileName string, extrac
 	return c
 }
 
-func currenciesToMap(currencies []*currency.Currency) map[string]decimal.Decimal {
+// RefreshExchangeRates recomputes the installments of the contracts in the base currency
+// with the given exchange rates, without extracting the CIB file again.
+func (c *Calculation) RefreshExchangeRates(by string, currencies map[string]decimal.Decimal, floors map[termType]decimal.Decimal, minFinanceAmountInLAK decimal.Decimal, installmentPlaces int32) {
+	for i := range c.Contracts {
+		contract := &c.Contracts[i]
+		exchangeRate, ok := currencies[contract.Currency]
+		if !ok {
+			exchangeRate = decimal.NewFromInt(1)
+		}
+
+		contract.termType = termTypeFromTypeOfTermLoan(contract.TermType)
+		contract.ExchangeRate = exchangeRate
+		contract.Installment = calculateInstallment(*contract, installmentFloor(*contract, floors))
+		contract.InstallmentInLAK = convertInstallmentToBase(contract.Installment, exchangeRate, installmentPlaces)
+	}
+
+	markNegligibleContracts(c.Contracts, minFinanceAmountInLAK)
+	c.AggregateQuantity = newAggregateQuantity(c.Contracts)
+	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
+	c.UpdatedBy = by
+	c.UpdatedAt = time.Now()
+}
+
+// exchangeRates maps the codes of the currencies to their rate to the base currency.
+func (s *Service) exchangeRates(currencies []*currency.Currency) map[string]decimal.Decimal {
 	m := make(map[string]decimal.Decimal)
 	for _, c := range currencies {
-		m[c.Code] = c.ExchangeRate
+		m[c.Code] = s.currency.RateToBase(c)
 	}
 	return m
 }
 
+// missingPinnedRates returns the currencies of the contracts which have a current rate
+// but no pinned rate, sorted, so they are not converted at 1 as the unknown currencies are.
+func missingPinnedRates(contracts []loanHistory, current, pinned map[string]decimal.Decimal) []string {
+	seen := make(map[string]bool)
+	missing := make([]string, 0)
+	for _, c := range contracts {
+		if seen[c.Currency] {
+			continue
+		}
+		seen[c.Currency] = true
+
+		_, hasCurrent := current[c.Currency]
+		_, hasPinned := pinned[c.Currency]
+		if hasCurrent && !hasPinned {
+			missing = append(missing, c.Currency)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing
+}
+
 func newAggregateQuantity(contracts []Contract) AggregateQuantity {
 	a := AggregateQuantity{
 		Total:  decimal.Zero,
@@ -168,6 +254,9 @@ func newAggregateQuantity(contracts []Contract) AggregateQuantity {
 		a.Total = a.Total.Add(decimal.NewFromInt(1))
 		switch c.Status {
 		case StatusActive:
+			if c.Negligible {
+				continue
+			}
 			a.Active = a.Active.Add(decimal.NewFromInt(1))
 
 		case StatusClosed:
@@ -178,28 +267,17 @@ func newAggregateQuantity(contracts []Contract) AggregateQuantity {
 	return a
 }
 
-func newContract(contract loanHistory, exchangeRate decimal.Decimal) Contract {
+func newContract(contract loanHistory, exchangeRate decimal.Decimal, floors map[termType]decimal.Decimal, installmentPlaces int32) Contract {
 	var c Contract
-	startedAt, err := ParseDDMMYYYY("02-01-2006", contract.OpenedDate)
-	if err == nil {
-		c.FirstInstallment = startedAt
-	}
-
-	endedAt, err := ParseDDMMYYYY("02-01-2006", contract.MatureDate)
-	if err == nil {
-		c.LastInstallment = endedAt
-	}
-
-	lastedAt, err := ParseDDMMYYYY("02-01-2006", contract.RecentDate)
-	if err == nil {
-		c.LastedAt = lastedAt
-	}
+	c.FirstInstallment = c.parseDate("openedDate", contract.OpenedDate, true)
+	c.LastInstallment = c.parseDate("matureDate", contract.MatureDate, true)
+	c.LastedAt = c.parseDate("recentDate", contract.RecentDate, false)
 
 	c.Number = contract.AccountNumber
 	c.TermType = contract.TypeOfLoan
 	c.termType = termTypeFromTypeOfTermLoan(contract.TypeOfLoan)
 	c.Status = statusFromContractStatus(contract.AccountStatusEng)
-	c.Period = countMonth(startedAt.Time(), endedAt.Time())
+	c.Period = countMonth(c.FirstInstallment.Time(), c.LastInstallment.Time())
 	c.BankCode = contract.BankNameEn
 	c.Currency = contract.Currency
 	c.GradeCIB = contract.DelinquencyCode
@@ -212,13 +290,33 @@ func newContract(contract loanHistory, exchangeRate decimal.Decimal) Contract {
 	c.OutstandingBalance = parseDecimal(contract.OsBalance)
 	c.FinanceAmount = parseDecimal(contract.CreditLimit)
 
-	installment := calculateInstallment(c)
+	installment := calculateInstallment(c, installmentFloor(c, floors))
 	c.Installment = installment
-	c.InstallmentInLAK = convertToLAK(installment, exchangeRate)
+	c.InstallmentInLAK = convertInstallmentToBase(installment, exchangeRate, installmentPlaces)
 
 	return c
 }
 
+// parseDate parses a DD-MM-YYYY date of the CIB file and records a date warning
+// when it cannot be parsed, or when it is missing and required.
+func (c *Contract) parseDate(field, s string, required bool) yyyymmdd {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		if required {
+			c.DateWarnings = append(c.DateWarnings, fmt.Sprintf("%s is missing", field))
+		}
+		return yyyymmdd{}
+	}
+
+	d, err := ParseDDMMYYYY("02-01-2006", s)
+	if err != nil {
+		c.DateWarnings = append(c.DateWarnings, fmt.Sprintf("%s %q is not a valid DD-MM-YYYY date", field, s))
+		return yyyymmdd{}
+	}
+
+	return d
+}
+
 func parseDecimal(s string) decimal.Decimal {
 	s = strings.ReplaceAll(s, ",", "")
 	d, err := decimal.NewFromString(s)
@@ -228,7 +326,7 @@ func parseDecimal(s string) decimal.Decimal {
 	return d
 }
 
-func newContracts(contracts []loanHistory, currencies map[string]decimal.Decimal) []Contract {
+func newContracts(contracts []loanHistory, currencies map[string]decimal.Decimal, floors map[termType]decimal.Decimal, installmentPlaces int32) []Contract {
 	cs := make([]Contract, len(contracts))
 
 	for i, c := range contracts {
@@ -237,12 +335,26 @@ func newContracts(contracts []loanHistory, currencies map[string]decimal.Decimal
 			exchangeRate = decimal.NewFromInt(1)
 		}
 
-		cs[i] = newContract(c, exchangeRate)
+		cs[i] = newContract(c, exchangeRate, floors, installmentPlaces)
 	}
 	return cs
 }
 
-func calculateInstallment(c Contract) decimal.Decimal {
+// markNegligibleContracts flags the active contracts whose finance amount in the base currency
+// is below minFinanceAmountInLAK. A zero minimum flags none.
+func markNegligibleContracts(contracts []Contract, minFinanceAmountInLAK decimal.Decimal) {
+	for i := range contracts {
+		c := &contracts[i]
+		c.Negligible = minFinanceAmountInLAK.IsPositive() &&
+			c.Status == StatusActive &&
+			convertToBase(c.FinanceAmount, c.ExchangeRate).LessThan(minFinanceAmountInLAK)
+	}
+}
+
+// calculateInstallment returns the monthly installment of an active contract in its currency.
+// For revolving facilities the installment is never less than floorInLAK
+// converted to the contract currency, as long as there is an outstanding balance.
+func calculateInstallment(c Contract, floorInLAK decimal.Decimal) decimal.Decimal {
 	if c.Status != StatusActive {
 		return decimal.Zero
 	}
@@ -255,7 +367,8 @@ func calculateInstallment(c Contract) decimal.Decimal {
 		return calculatePMT(c.InterestRate, c.Period, c.FinanceAmount)
 
 	case TermTypeOD, TermTypeCC, TermTypeRL:
-		return calculateTenPercentOfMonthlyAccruedBalance(c.OutstandingBalance, c.InterestRate)
+		installment := calculateTenPercentOfMonthlyAccruedBalance(c.OutstandingBalance, c.InterestRate)
+		return applyInstallmentFloor(installment, c.OutstandingBalance, floorInLAK, c.ExchangeRate)
 
 	case TermTypeOther:
 		return calculatePMT(c.InterestRate, c.Period, c.FinanceAmount)
@@ -264,10 +377,12 @@ func calculateInstallment(c Contract) decimal.Decimal {
 	return decimal.Zero
 }
 
+// sumInstallment sums the installments in the base currency as displayed per contract,
+// so the total always equals the sum of the rows.
 func sumInstallment(contracts []Contract) decimal.Decimal {
 	var total decimal.Decimal
 	for _, c := range contracts {
-		if strings.ToUpper(c.BankCode) == "KLS_LS" {
+		if strings.ToUpper(c.BankCode) == "KLS_LS" || c.Negligible {
 			continue
 		}
 
@@ -277,6 +392,20 @@ func sumInstallment(contracts []Contract) decimal.Decimal {
 	return total
 }
 
+// installmentFloor returns the floor of the contract by its original term type,
+// since OD, CC and RL are all calculated as TermTypeOD.
+func installmentFloor(c Contract, floors map[termType]decimal.Decimal) decimal.Decimal {
+	return floors[termTypeValues[strings.ToUpper(strings.TrimSpace(c.TermType))]]
+}
+
+func applyInstallmentFloor(installment, outstandingBalance, floorInLAK, exchangeRate decimal.Decimal) decimal.Decimal {
+	if !floorInLAK.IsPositive() || !outstandingBalance.IsPositive() || !exchangeRate.IsPositive() {
+		return installment
+	}
+
+	return decimal.Max(installment, floorInLAK.Div(exchangeRate))
+}
+
 func calculateTenPercentOfMonthlyAccruedBalance(outstandingBalance, interest decimal.Decimal) decimal.Decimal {
 	if interest.IsZero() || outstandingBalance.IsZero() {
 		return decimal.Zero
@@ -369,10 +498,18 @@ func statusFromContractStatus(status string) status {
 	return StatusUnSpecified
 }
 
-func convertToLAK(amount decimal.Decimal, exchangeRate decimal.Decimal) decimal.Decimal {
+// convertToBase converts an amount to the base currency,
+// the exchange rate being the rate of its currency to the base currency.
+func convertToBase(amount decimal.Decimal, exchangeRate decimal.Decimal) decimal.Decimal {
 	return amount.Mul(exchangeRate)
 }
 
+// convertInstallmentToBase converts an installment to the base currency
+// rounded to the given decimal places.
+func convertInstallmentToBase(installment decimal.Decimal, exchangeRate decimal.Decimal, places int32) decimal.Decimal {
+	return convertToBase(installment, exchangeRate).Round(places)
+}
+
 func isCalculationExists(ctx context.Context, db *sql.DB, number string) (bool, error) {
 	q, args := sq.Select("TOP 1 number").
 		From("cib_file_analysis").
@@ -396,7 +533,15 @@ func isCalculationExists(ctx context.Context, db *sql.DB, number string) (bool,
 }
 
 func saveCalculation(ctx context.Context, db *sql.DB, in *Calculation) error {
-	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+	defer database.TimeQuery("cib.saveCalculation")()
+
+	err := database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		// A new calculation is only inserted, so a number already used is reported by the unique index
+		// instead of overwriting the calculation of the number. The loaded calculations are updated.
+		if in.ID == 0 {
+			return insertCalculation(ctx, tx, in)
+		}
+
 		updatedQuery, args := sq.Update("cib_file_analysis").
 			Set("number", in.Number).
 			Set("cib_file_name", in.CIBFileName).
@@ -407,6 +552,7 @@ func saveCalculation(ctx context.Context, db *sql.DB, in *Calculation) error {
 			Set("total_closed_loan", in.AggregateQuantity.Closed).
 			Set("total_active_loan", in.AggregateQuantity.Active).
 			Set("total_installment_lak", in.TotalInstallmentInLAK).
+			Set("base_currency", in.BaseCurrency).
 			Set("contract_info", in.BytesFromContracts()).
 			Set("aggregate_by_bank", in.BytesFromAggregateByBankCode()).
 			Set("updated_by", in.UpdatedBy).
@@ -431,52 +577,68 @@ func saveCalculation(ctx context.Context, db *sql.DB, in *Calculation) error {
 			return nil
 		}
 
-		insertQuery, args := sq.Insert("cib_file_analysis").
-			Columns(
-				"number",
-				"cib_file_name",
-				"customer_display_name",
-				"customer_phone_number",
-				"customer_dob",
-				"total_loan",
-				"total_closed_loan",
-				"total_active_loan",
-				"total_installment_lak",
-				"aggregate_by_bank",
-				"contract_info",
-				"created_by",
-				"created_at",
-				"updated_by",
-				"updated_at",
-			).
-			Values(
-				in.Number,
-				in.CIBFileName,
-				in.Customer.DisplayName,
-				in.Customer.PhoneNumber,
-				in.Customer.DateOfBirth,
-				in.AggregateQuantity.Total,
-				in.AggregateQuantity.Closed,
-				in.AggregateQuantity.Active,
-				in.TotalInstallmentInLAK,
-				in.BytesFromAggregateByBankCode(),
-				in.BytesFromContracts(),
-				in.CreatedBy,
-				in.CreatedAt,
-				in.UpdatedBy,
-				in.UpdatedAt,
-			).
-			Suffix("SELECT SCOPE_IDENTITY()").
-			PlaceholderFormat(sq.AtP).
-			MustSql()
+		return insertCalculation(ctx, tx, in)
+	})
+	if database.IsUniqueViolation(err) {
+		return rpcStatus.New(
+			codes.AlreadyExists,
+			"Calculation with this number already exists. Please use a different number.",
+		).Err()
+	}
 
-		row := tx.QueryRowContext(ctx, insertQuery, args...)
-		if err := row.Scan(&in.ID); err != nil {
-			return fmt.Errorf("failed to insert calculation: %w", err)
-		}
+	return err
+}
 
-		return nil
-	})
+func insertCalculation(ctx context.Context, tx *sql.Tx, in *Calculation) error {
+	insertQuery, args := sq.Insert("cib_file_analysis").
+		Columns(
+			"number",
+			"cib_file_name",
+			"customer_display_name",
+			"customer_phone_number",
+			"customer_dob",
+			"total_loan",
+			"total_closed_loan",
+			"total_active_loan",
+			"total_installment_lak",
+			"base_currency",
+			"aggregate_by_bank",
+			"contract_info",
+			"extraction_confidence",
+			"created_by",
+			"created_at",
+			"updated_by",
+			"updated_at",
+		).
+		Values(
+			in.Number,
+			in.CIBFileName,
+			in.Customer.DisplayName,
+			in.Customer.PhoneNumber,
+			in.Customer.DateOfBirth,
+			in.AggregateQuantity.Total,
+			in.AggregateQuantity.Closed,
+			in.AggregateQuantity.Active,
+			in.TotalInstallmentInLAK,
+			in.BaseCurrency,
+			in.BytesFromAggregateByBankCode(),
+			in.BytesFromContracts(),
+			in.stringFromConfidence(),
+			in.CreatedBy,
+			in.CreatedAt,
+			in.UpdatedBy,
+			in.UpdatedAt,
+		).
+		Suffix("SELECT SCOPE_IDENTITY()").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	row := tx.QueryRowContext(ctx, insertQuery, args...)
+	if err := row.Scan(&in.ID); err != nil {
+		return fmt.Errorf("failed to insert calculation: %w", err)
+	}
+
+	return nil
 }
 
 type CalculationQuery struct {
@@ -487,6 +649,45 @@ type CalculationQuery struct {
 	CreatedBefore       time.Time `query:"createdBefore"`
 	PageSize            uint64    `query:"pageSize"`
 	PageToken           string    `query:"pageToken"`
+	OrderBy             string    `query:"orderBy"`
+	OrderDir            string    `query:"orderDir"`
+
+	// MinActiveLoans keeps the calculations with at least this many active loans, zero keeps them all.
+	MinActiveLoans int64 `query:"minActiveLoans"`
+
+	// MinTotalInstallmentInLAK keeps the calculations with a total installment in the base currency
+	// of at least this amount, zero keeps them all.
+	MinTotalInstallmentInLAK decimal.Decimal `query:"minTotalInstallmentInLAK"`
+
+	// Currency keeps the calculations with a contract in this currency.
+	Currency string `query:"currency"`
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+}
+
+// calculationOrderColumns are the columns the calculations can be ordered by.
+var calculationOrderColumns = map[string]pager.Column{
+	"createdAt":             {Name: "created_at", Time: true},
+	"number":                {Name: "number"},
+	"totalInstallmentInLAK": {Name: "total_installment_lak"},
+}
+
+// order returns the order of the calculations, newest first by default.
+func (q *CalculationQuery) order() (*pager.Order, error) {
+	return pager.ParseOrder(q.OrderBy, q.OrderDir, "createdAt", calculationOrderColumns)
+}
+
+// orderValue returns the value of the calculation kept in the cursor for the given order.
+func (c *Calculation) orderValue(o *pager.Order) string {
+	switch o.By {
+	case "number":
+		return c.Number
+	case "totalInstallmentInLAK":
+		return c.TotalInstallmentInLAK.String()
+	}
+
+	return ""
 }
 
 func (q *CalculationQuery) ToSQL() (string, []any, error) {
@@ -500,6 +701,13 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 	if q.CustomerDisplayName != "" {
 		and = append(and, sq.Expr("customer_display_name LIKE ?", "%"+q.CustomerDisplayName+"%"))
 	}
+	if q.Currency != "" {
+		and = append(and, sq.Expr(contractInfoText+" LIKE ?", contractCurrencyPattern(q.Currency)))
+	}
+
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"created_by": q.createdBy})
+	}
 
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
@@ -509,16 +717,31 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 		and = append(and, sq.LtOrEq{"created_at": q.CreatedBefore})
 	}
 
+	if q.MinActiveLoans > 0 {
+		and = append(and, sq.GtOrEq{"total_active_loan": q.MinActiveLoans})
+	}
+
+	if q.MinTotalInstallmentInLAK.IsPositive() {
+		and = append(and, sq.GtOrEq{"total_installment_lak": q.MinTotalInstallmentInLAK})
+	}
+
 	if q.PageToken != "" {
+		order, err := q.order()
+		if err != nil {
+			return "", nil, err
+		}
+
 		cursor, err := pager.DecodeCursor(q.PageToken)
 		if err == nil {
-			and = append(and, sq.Lt{"created_at": cursor.Time})
+			and = append(and, order.After(cursor, "id"))
 		}
 	}
 
 	return and.ToSql()
 }
 func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("cib.listCalculations")()
+
 	id := fmt.Sprintf("TOP %d id", pager.Size(in.PageSize))
 
 	pred, args, err := in.ToSQL()
@@ -526,6 +749,11 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
 	q, args := sq.
 		Select(
 			id,
@@ -538,6 +766,7 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 			"total_closed_loan",
 			"total_active_loan",
 			"total_installment_lak",
+			"base_currency",
 			"aggregate_by_bank",
 			"contract_info",
 			"created_by",
@@ -548,7 +777,7 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		From(`cib_file_analysis`).
 		Where(pred, args...).
 		PlaceholderFormat(sq.AtP).
-		OrderBy("created_at DESC").
+		OrderBy(order.OrderBy("id")...).
 		MustSql()
 
 	rows, err := db.QueryContext(ctx, q, args...)
@@ -572,6 +801,7 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 			&c.AggregateQuantity.Closed,
 			&c.AggregateQuantity.Active,
 			&c.TotalInstallmentInLAK,
+			&c.BaseCurrency,
 			&aggregateBank,
 			&contracts,
 			&c.CreatedBy,
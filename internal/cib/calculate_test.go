@@ -0,0 +1,442 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestSaveCalculationConcurrentCreate(t *testing.T) {
+	db, mock := dbtest.New(t)
+
+	// Both creations passed the isCalculationExists pre-check,
+	// the fake driver answers the insert of the second one as the unique index on the number would.
+	// It checks the handling of the violation, not the index itself.
+	mock.ExpectQuery(`INSERT INTO cib_file_analysis`).WillReturnRows([]string{"id"}, []any{1})
+	mock.ExpectQuery(`INSERT INTO cib_file_analysis`).WillReturnError(dbtest.SQLError{Number: 2601})
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = saveCalculation(context.Background(), db, &Calculation{Number: "CIB-1"})
+		}()
+	}
+	wg.Wait()
+
+	var created, exists int
+	for _, err := range errs {
+		switch rpcStatus.Code(err) {
+		case codes.OK:
+			created++
+		case codes.AlreadyExists:
+			exists++
+		default:
+			t.Errorf("saveCalculation() error = %v", err)
+		}
+	}
+	if created != 1 || exists != 1 {
+		t.Errorf("got %d created and %d already exists, want 1 and 1", created, exists)
+	}
+}
+
+func TestSaveCalculationBindsConfidenceAsString(t *testing.T) {
+	// extraction_confidence is the 13th inserted column, see insertCalculation.
+	const confidenceArg = 12
+
+	tests := []struct {
+		name       string
+		confidence []FieldConfidence
+		want       any
+	}{
+		{
+			name: "none",
+			want: nil,
+		},
+		{
+			name:       "recorded",
+			confidence: []FieldConfidence{{Field: "customer.displayName", Confidence: decimal.RequireFromString("0.5")}},
+			want:       `[{"field":"customer.displayName","confidence":"0.5"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			insert := mock.ExpectQuery(`INSERT INTO cib_file_analysis`).WillReturnRows([]string{"id"}, []any{1})
+
+			c := &Calculation{Number: "CIB-1", confidence: tt.confidence}
+			if err := saveCalculation(context.Background(), db, c); err != nil {
+				t.Fatalf("saveCalculation() error = %v", err)
+			}
+
+			// The column is NVARCHAR, a []byte would be sent as VARBINARY and rejected.
+			if got := insert.Args()[confidenceArg]; got != tt.want {
+				t.Errorf("extraction_confidence = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingPinnedRates(t *testing.T) {
+	contracts := []loanHistory{
+		{AccountNumber: "LN-1", Currency: "USD"},
+		{AccountNumber: "LN-2", Currency: "THB"},
+		{AccountNumber: "LN-3", Currency: "USD"},
+		{AccountNumber: "LN-4", Currency: "LAK"},
+		{AccountNumber: "LN-5", Currency: "XYZ"},
+	}
+	current := map[string]decimal.Decimal{
+		"LAK": decimal.NewFromInt(1),
+		"USD": decimal.NewFromInt(21500),
+		"THB": decimal.NewFromInt(650),
+	}
+
+	tests := []struct {
+		name   string
+		pinned map[string]decimal.Decimal
+		want   []string
+	}{
+		{
+			name:   "every rate pinned",
+			pinned: map[string]decimal.Decimal{"LAK": decimal.NewFromInt(1), "USD": decimal.NewFromInt(20000), "THB": decimal.NewFromInt(600)},
+			want:   []string{},
+		},
+		{
+			// The currencies created after the pinned time would be converted at 1.
+			name:   "currencies created later",
+			pinned: map[string]decimal.Decimal{"LAK": decimal.NewFromInt(1)},
+			want:   []string{"THB", "USD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := missingPinnedRates(contracts, current, tt.pinned)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingPinnedRates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewContractInstallmentFloor(t *testing.T) {
+	floors := map[termType]decimal.Decimal{
+		TermTypeOD: decimal.NewFromInt(50000),
+		TermTypeRL: decimal.NewFromInt(5000),
+	}
+	revolving := func(typeOfLoan, balance, currency string) loanHistory {
+		return loanHistory{
+			AccountNumber:    "LN-1",
+			OpenedDate:       "01-01-2024",
+			MatureDate:       "01-01-2026",
+			Interest:         "12",
+			CreditLimit:      "1000000",
+			OsBalance:        balance,
+			Currency:         currency,
+			TypeOfLoan:       typeOfLoan,
+			AccountStatusEng: "ເຄື່ອນໄຫວ",
+		}
+	}
+
+	tests := []struct {
+		name                 string
+		contract             loanHistory
+		exchangeRate         decimal.Decimal
+		wantInstallmentInLAK decimal.Decimal
+	}{
+		{name: "floor overrides a tiny installment", contract: revolving("OD", "100000", "LAK"), exchangeRate: decimal.NewFromInt(1), wantInstallmentInLAK: decimal.NewFromInt(50000)},
+		{name: "floor in the contract currency", contract: revolving("OD", "10", "USD"), exchangeRate: decimal.NewFromInt(21500), wantInstallmentInLAK: decimal.NewFromInt(50000)},
+		{name: "installment above the floor", contract: revolving("RL", "100000", "LAK"), exchangeRate: decimal.NewFromInt(1), wantInstallmentInLAK: decimal.NewFromInt(10100)},
+		{name: "term type without floor", contract: revolving("CC", "100000", "LAK"), exchangeRate: decimal.NewFromInt(1), wantInstallmentInLAK: decimal.NewFromInt(10100)},
+		{name: "no outstanding balance", contract: revolving("OD", "0", "LAK"), exchangeRate: decimal.NewFromInt(1), wantInstallmentInLAK: decimal.Zero},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newContract(tt.contract, tt.exchangeRate, floors, 0)
+			if !c.InstallmentInLAK.Equal(tt.wantInstallmentInLAK) {
+				t.Errorf("installment in LAK = %s, want %s", c.InstallmentInLAK, tt.wantInstallmentInLAK)
+			}
+		})
+	}
+}
+
+func TestSetInstallmentFloor(t *testing.T) {
+	tests := []struct {
+		termType string
+		floor    int64
+		wantErr  bool
+	}{
+		{termType: "OD", floor: 50000},
+		{termType: "CC", floor: 0},
+		{termType: "RL", floor: -1, wantErr: true},
+		{termType: "PL", floor: 50000, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.termType, func(t *testing.T) {
+			s := &Service{installmentFloors: make(map[termType]decimal.Decimal)}
+			err := s.SetInstallmentFloor(tt.termType, decimal.NewFromInt(tt.floor))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetInstallmentFloor() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got, ok := s.installmentFloors[termTypeValues[tt.termType]]; ok == tt.wantErr || (ok && !got.Equal(decimal.NewFromInt(tt.floor))) {
+				t.Errorf("floor = %s (set %v), want %d", got, ok, tt.floor)
+			}
+		})
+	}
+}
+
+func TestNewContractDateWarnings(t *testing.T) {
+	contract := func(opened, mature, recent string) loanHistory {
+		return loanHistory{
+			AccountNumber:    "LN-1",
+			OpenedDate:       opened,
+			MatureDate:       mature,
+			RecentDate:       recent,
+			CreditLimit:      "1200000",
+			OsBalance:        "1200000",
+			Currency:         "LAK",
+			TypeOfLoan:       "PL",
+			AccountStatusEng: "ເຄື່ອນໄຫວ",
+		}
+	}
+
+	tests := []struct {
+		name         string
+		contract     loanHistory
+		wantWarnings []string
+		wantPeriod   int64
+	}{
+		{name: "valid dates", contract: contract("01-01-2024", "01-01-2026", "15-06-2025"), wantPeriod: 24},
+		{name: "missing recent date", contract: contract("01-01-2024", "01-01-2026", ""), wantPeriod: 24},
+		{name: "malformed opened date", contract: contract("01/01/2024", "01-01-2026", "15-06-2025"), wantWarnings: []string{`openedDate "01/01/2024" is not a valid DD-MM-YYYY date`}},
+		{name: "missing mature date", contract: contract("01-01-2024", " ", "15-06-2025"), wantWarnings: []string{"matureDate is missing"}},
+		{name: "malformed recent date", contract: contract("01-01-2024", "01-01-2026", "31-13-2025"), wantWarnings: []string{`recentDate "31-13-2025" is not a valid DD-MM-YYYY date`}, wantPeriod: 24},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newContract(tt.contract, decimal.NewFromInt(1), nil, 0)
+			if !reflect.DeepEqual(c.DateWarnings, tt.wantWarnings) {
+				t.Errorf("date warnings = %q, want %q", c.DateWarnings, tt.wantWarnings)
+			}
+			// The period is only meaningful when both installment dates are parsed.
+			if tt.wantPeriod > 0 && !c.Period.Equal(decimal.NewFromInt(tt.wantPeriod)) {
+				t.Errorf("period = %s, want %d", c.Period, tt.wantPeriod)
+			}
+		})
+	}
+}
+
+func TestCalculationRefreshExchangeRates(t *testing.T) {
+	contract := func(number, currency, limit string) loanHistory {
+		return loanHistory{
+			AccountNumber:    number,
+			BankNameEn:       "BCEL",
+			OpenedDate:       "01-01-2024",
+			MatureDate:       "01-01-2026",
+			Interest:         "12",
+			CreditLimit:      limit,
+			OsBalance:        limit,
+			Currency:         currency,
+			TypeOfLoan:       "CL",
+			AccountStatusEng: "ເຄື່ອນໄຫວ",
+		}
+	}
+	extracted := []loanHistory{
+		contract("LN-1", "LAK", "24000000"),
+		contract("LN-2", "USD", "2400"),
+	}
+
+	c := &Calculation{Contracts: newContracts(extracted, map[string]decimal.Decimal{
+		"LAK": decimal.NewFromInt(1),
+		"USD": decimal.NewFromInt(20000),
+	}, nil, 0)}
+	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
+	before := c.TotalInstallmentInLAK
+	usdInstallment := c.Contracts[1].Installment
+
+	c.RefreshExchangeRates("user@example.com", map[string]decimal.Decimal{
+		"LAK": decimal.NewFromInt(1),
+		"USD": decimal.NewFromInt(21500),
+	}, nil, decimal.Zero, 0)
+
+	want := c.Contracts[0].InstallmentInLAK.Add(usdInstallment.Mul(decimal.NewFromInt(21500)).Round(0))
+	if !c.TotalInstallmentInLAK.Equal(want) || c.TotalInstallmentInLAK.Equal(before) {
+		t.Errorf("total installment = %s (before %s), want %s", c.TotalInstallmentInLAK, before, want)
+	}
+	if !c.Contracts[1].Installment.Equal(usdInstallment) {
+		t.Errorf("installment in USD = %s, want it unchanged at %s", c.Contracts[1].Installment, usdInstallment)
+	}
+	if !c.Contracts[1].ExchangeRate.Equal(decimal.NewFromInt(21500)) {
+		t.Errorf("exchange rate = %s, want 21500", c.Contracts[1].ExchangeRate)
+	}
+	if c.UpdatedBy != "user@example.com" {
+		t.Errorf("updated by = %s, want user@example.com", c.UpdatedBy)
+	}
+
+	// A currency without a current rate is converted at 1, as on extraction.
+	c.RefreshExchangeRates("user@example.com", map[string]decimal.Decimal{"LAK": decimal.NewFromInt(1)}, nil, decimal.Zero, 0)
+	if !c.Contracts[1].InstallmentInLAK.Equal(usdInstallment.Round(0)) {
+		t.Errorf("installment in LAK without a rate = %s, want %s", c.Contracts[1].InstallmentInLAK, usdInstallment.Round(0))
+	}
+}
+
+func TestMarkNegligibleContracts(t *testing.T) {
+	contracts := func() []Contract {
+		return []Contract{
+			// 40 USD at 21500 is 860000 LAK.
+			{Number: "LN-1", Status: StatusActive, FinanceAmount: decimal.NewFromInt(40), ExchangeRate: decimal.NewFromInt(21500), InstallmentInLAK: decimal.NewFromInt(100)},
+			{Number: "LN-2", Status: StatusActive, FinanceAmount: decimal.NewFromInt(1000000), ExchangeRate: decimal.NewFromInt(1), InstallmentInLAK: decimal.NewFromInt(200)},
+			{Number: "LN-3", Status: StatusActive, FinanceAmount: decimal.Zero, ExchangeRate: decimal.NewFromInt(1), InstallmentInLAK: decimal.NewFromInt(400)},
+			{Number: "LN-4", Status: StatusClosed, FinanceAmount: decimal.Zero, ExchangeRate: decimal.NewFromInt(1)},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		minFinanceAmount int64
+		wantNegligible   []bool
+		wantInstallment  int64
+		wantActive       int64
+	}{
+		{name: "no minimum", wantNegligible: []bool{false, false, false, false}, wantInstallment: 700, wantActive: 3},
+		{name: "below the minimum", minFinanceAmount: 1000000, wantNegligible: []bool{true, false, true, false}, wantInstallment: 200, wantActive: 1},
+		{name: "at the minimum", minFinanceAmount: 860000, wantNegligible: []bool{false, false, true, false}, wantInstallment: 300, wantActive: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{}
+			if err := s.SetMinFinanceAmount(decimal.NewFromInt(tt.minFinanceAmount)); err != nil {
+				t.Fatal(err)
+			}
+
+			cs := contracts()
+			markNegligibleContracts(cs, s.minFinanceAmount)
+			for i, c := range cs {
+				if c.Negligible != tt.wantNegligible[i] {
+					t.Errorf("%s negligible = %v, want %v", c.Number, c.Negligible, tt.wantNegligible[i])
+				}
+			}
+			// Negligible contracts are still listed.
+			if got := newAggregateQuantity(cs); !got.Total.Equal(decimal.NewFromInt(4)) || !got.Active.Equal(decimal.NewFromInt(tt.wantActive)) {
+				t.Errorf("aggregate quantity = %+v, want 4 contracts of which %d active", got, tt.wantActive)
+			}
+			if got := sumInstallment(cs); !got.Equal(decimal.NewFromInt(tt.wantInstallment)) {
+				t.Errorf("total installment = %s, want %d", got, tt.wantInstallment)
+			}
+		})
+	}
+
+	if err := (&Service{}).SetMinFinanceAmount(decimal.NewFromInt(-1)); err == nil {
+		t.Error("SetMinFinanceAmount() with a negative amount succeeded, want an error")
+	}
+}
+
+func TestExchangeRatesBaseCurrency(t *testing.T) {
+	s, _ := newTestService(t)
+
+	// The rate stored for LAK is wrong, the base currency converts at 1 anyway.
+	rates := s.exchangeRates([]*currency.Currency{
+		{Code: "LAK", ExchangeRate: decimal.NewFromInt(2)},
+		{Code: "USD", ExchangeRate: decimal.NewFromInt(21500)},
+	})
+	if !rates["LAK"].Equal(decimal.NewFromInt(1)) {
+		t.Errorf("LAK rate = %s, want 1", rates["LAK"])
+	}
+	if !rates["USD"].Equal(decimal.NewFromInt(21500)) {
+		t.Errorf("USD rate = %s, want 21500", rates["USD"])
+	}
+
+	contracts := newContracts([]loanHistory{{
+		AccountNumber:    "LN-1",
+		BankNameEn:       "BCEL",
+		OpenedDate:       "01-01-2024",
+		MatureDate:       "01-01-2026",
+		Interest:         "12",
+		CreditLimit:      "24000000",
+		OsBalance:        "24000000",
+		Currency:         "LAK",
+		TypeOfLoan:       "CL",
+		AccountStatusEng: "ເຄື່ອນໄຫວ",
+	}}, rates, nil, 0)
+	if c := contracts[0]; c.Installment.IsZero() || !c.InstallmentInLAK.Equal(c.Installment.Round(0)) {
+		t.Errorf("installment in LAK = %s, want the installment %s unchanged", c.InstallmentInLAK, c.Installment)
+	}
+}
+
+func TestInstallmentRoundingWithoutDrift(t *testing.T) {
+	contract := func(number, limit string) loanHistory {
+		return loanHistory{
+			AccountNumber:    number,
+			BankNameEn:       "BCEL",
+			OpenedDate:       "01-01-2024",
+			MatureDate:       "01-08-2025",
+			Interest:         "11.7",
+			CreditLimit:      limit,
+			OsBalance:        limit,
+			Currency:         "USD",
+			TypeOfLoan:       "L",
+			AccountStatusEng: "ເຄື່ອນໄຫວ",
+		}
+	}
+	extracted := []loanHistory{
+		contract("LN-1", "1234.57"),
+		contract("LN-2", "987.65"),
+		contract("LN-3", "3333.33"),
+	}
+	rates := map[string]decimal.Decimal{"USD": decimal.RequireFromString("21543.37")}
+
+	for _, places := range []int32{0, 2} {
+		t.Run(fmt.Sprintf("%d places", places), func(t *testing.T) {
+			c := &Calculation{Contracts: newContracts(extracted, rates, nil, places)}
+			check := func(when string) {
+				t.Helper()
+
+				rows := decimal.Zero
+				for _, contract := range c.Contracts {
+					if contract.Installment.IsZero() {
+						t.Fatalf("%s: installment of %s is zero", when, contract.Number)
+					}
+					if contract.InstallmentInLAK.Exponent() < -places {
+						t.Errorf("%s: installment in LAK of %s = %s, want it rounded to %d places", when, contract.Number, contract.InstallmentInLAK, places)
+					}
+					rows = rows.Add(contract.InstallmentInLAK)
+				}
+				if total := sumInstallment(c.Contracts); !total.Equal(rows) {
+					t.Errorf("%s: total installment = %s, want the sum of the rows %s", when, total, rows)
+				}
+			}
+
+			check("on extraction")
+			c.RefreshExchangeRates("user@example.com", rates, nil, decimal.Zero, places)
+			check("on refresh")
+			if c.TotalInstallmentInLAK.Exponent() < -places {
+				t.Errorf("total installment in LAK = %s, want it rounded to %d places", c.TotalInstallmentInLAK, places)
+			}
+		})
+	}
+}
+
+func TestSetInstallmentRoundingPlaces(t *testing.T) {
+	s, _ := newTestService(t)
+	if err := s.SetInstallmentRoundingPlaces(-1); err == nil {
+		t.Error("SetInstallmentRoundingPlaces(-1) error = nil, want an error")
+	}
+	if err := s.SetInstallmentRoundingPlaces(2); err != nil || s.installmentPlaces != 2 {
+		t.Errorf("SetInstallmentRoundingPlaces(2) = %v with %d places, want 2", err, s.installmentPlaces)
+	}
+}
@@ -0,0 +1,108 @@
+package cib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+)
+
+func TestCalculationQueryAggregateThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    CalculationQuery
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:    "no threshold",
+			query:   CalculationQuery{},
+			wantSQL: "(1=1)",
+		},
+		{
+			name:     "min active loans",
+			query:    CalculationQuery{MinActiveLoans: 3},
+			wantSQL:  "(total_active_loan >= ?)",
+			wantArgs: []any{int64(3)},
+		},
+		{
+			name:     "min total installment",
+			query:    CalculationQuery{MinTotalInstallmentInLAK: decimal.NewFromInt(5000000)},
+			wantSQL:  "(total_installment_lak >= ?)",
+			wantArgs: []any{decimal.NewFromInt(5000000)},
+		},
+		{
+			name:     "both thresholds",
+			query:    CalculationQuery{MinActiveLoans: 2, MinTotalInstallmentInLAK: decimal.NewFromInt(1000000)},
+			wantSQL:  "(total_active_loan >= ? AND total_installment_lak >= ?)",
+			wantArgs: []any{int64(2), decimal.NewFromInt(1000000)},
+		},
+		{
+			name:    "negative thresholds are ignored",
+			query:   CalculationQuery{MinActiveLoans: -1, MinTotalInstallmentInLAK: decimal.NewFromInt(-1)},
+			wantSQL: "(1=1)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.query.ToSQL()
+			if err != nil {
+				t.Fatalf("ToSQL() error = %v", err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("ToSQL() sql = %s, want %s", sql, tt.wantSQL)
+			}
+			if fmt.Sprint(args) != fmt.Sprint(tt.wantArgs) {
+				t.Errorf("ToSQL() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestListCalculationsByAggregateThresholds(t *testing.T) {
+	s, mock := newTestService(t)
+
+	columns := []string{
+		"id", "number", "cib_file_name", "customer_display_name", "customer_phone_number", "customer_dob",
+		"total_loan", "total_closed_loan", "total_active_loan", "total_installment_lak", "base_currency",
+		"aggregate_by_bank", "contract_info", "created_by", "created_at", "updated_by", "updated_at",
+	}
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	row := func(id int64, number string, active int64, installment string) []any {
+		return []any{
+			id, number, "cib.pdf", "Somchai", "020000000", "1990-01-01",
+			active, "0", active, installment, "LAK",
+			[]byte(`[]`), []byte(`[]`), "user@example.com", now, "user@example.com", now,
+		}
+	}
+
+	// The database applies the thresholds, only the calculations above both of them are returned.
+	list := mock.ExpectQuery(`WHERE \(created_by = @p1 AND total_active_loan >= @p2 AND total_installment_lak >= @p3\) ORDER BY`).
+		WillReturnRows(columns, row(3, "CIB-3", 4, "6000000"), row(1, "CIB-1", 3, "5000000"))
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	result, err := s.ListCalculations(ctx, &CalculationQuery{MinActiveLoans: 3, MinTotalInstallmentInLAK: decimal.NewFromInt(5000000)})
+	if err != nil {
+		t.Fatalf("ListCalculations() error = %v", err)
+	}
+
+	if args := list.Args(); len(args) != 3 || args[0] != "user@example.com" || args[1] != int64(3) || args[2] != "5000000" {
+		t.Errorf("query args = %v, want the creator and both thresholds", args)
+	}
+
+	if len(result.Calculations) != 2 {
+		t.Fatalf("ListCalculations() = %d calculations, want 2", len(result.Calculations))
+	}
+	for i, want := range []string{"CIB-3", "CIB-1"} {
+		if got := result.Calculations[i].Number; got != want {
+			t.Errorf("calculation %d = %s, want %s", i, got, want)
+		}
+	}
+	if got := result.Calculations[0].TotalInstallmentInLAK; !got.Equal(decimal.NewFromInt(6000000)) {
+		t.Errorf("total installment = %s, want 6000000", got)
+	}
+}
@@ -0,0 +1,198 @@
+package cib
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// DefaultLowConfidenceThreshold is the confidence below which an extracted field is listed as low-confidence
+// when the query does not give a threshold.
+var DefaultLowConfidenceThreshold = decimal.RequireFromString("0.8")
+
+// FieldConfidence is the confidence, from 0 to 1, the extractor has in an extracted field.
+// The field is named as in the response of the extractor. The loan number is set for the fields of a contract.
+type FieldConfidence struct {
+	Field      string          `json:"field"`
+	LoanNumber string          `json:"loanNumber,omitempty"`
+	Confidence decimal.Decimal `json:"confidence"`
+}
+
+// newFieldConfidences flattens the confidence of the customer fields and of the fields of each contract,
+// ordered by loan number then by field. It returns nil when the extractor provides none.
+func newFieldConfidences(customer map[string]decimal.Decimal, contracts []loanHistory) []FieldConfidence {
+	var fields []FieldConfidence
+	for field, confidence := range customer {
+		fields = append(fields, FieldConfidence{
+			Field:      field,
+			Confidence: confidence,
+		})
+	}
+	for _, c := range contracts {
+		for field, confidence := range c.Confidence {
+			fields = append(fields, FieldConfidence{
+				Field:      field,
+				LoanNumber: c.AccountNumber,
+				Confidence: confidence,
+			})
+		}
+	}
+
+	sort.Slice(fields, func(i, j int) bool {
+		if fields[i].LoanNumber != fields[j].LoanNumber {
+			return fields[i].LoanNumber < fields[j].LoanNumber
+		}
+		return fields[i].Field < fields[j].Field
+	})
+
+	return fields
+}
+
+type ExtractionConfidenceQuery struct {
+	Number string `param:"number"`
+
+	// Threshold is the confidence below which a field is listed. Zero uses DefaultLowConfidenceThreshold.
+	Threshold decimal.Decimal `query:"threshold"`
+}
+
+func (q *ExtractionConfidenceQuery) Validate() error {
+	if q.Threshold.IsNegative() || q.Threshold.GreaterThan(decimal.NewFromInt(1)) {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "threshold",
+					Description: "Threshold must be between 0 and 1",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// ExtractionConfidence lists the low-confidence fields extracted from the CIB file of a calculation.
+type ExtractionConfidence struct {
+	Number    string            `json:"number"`
+	Threshold decimal.Decimal   `json:"threshold"`
+	Fields    []FieldConfidence `json:"fields"`
+
+	// LoanNumbers are the contracts with at least one low-confidence field.
+	LoanNumbers []string `json:"loanNumbers"`
+}
+
+// GetExtractionConfidence lists the fields extracted with a confidence below the threshold
+// from the CIB file of the calculation of the given number.
+// The result is empty when the extractor provided no confidence.
+func (s *Service) GetExtractionConfidence(ctx context.Context, in *ExtractionConfidenceQuery) (*ExtractionConfidence, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetExtractionConfidence"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	fields, err := getExtractionConfidence(ctx, s.db, &CalculationQuery{
+		Number:    in.Number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get extraction confidence", zap.Error(err))
+		return nil, err
+	}
+
+	threshold := in.Threshold
+	if threshold.IsZero() {
+		threshold = DefaultLowConfidenceThreshold
+	}
+
+	return newExtractionConfidence(in.Number, threshold, fields), nil
+}
+
+func newExtractionConfidence(number string, threshold decimal.Decimal, fields []FieldConfidence) *ExtractionConfidence {
+	result := &ExtractionConfidence{
+		Number:      number,
+		Threshold:   threshold,
+		Fields:      make([]FieldConfidence, 0),
+		LoanNumbers: make([]string, 0),
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range fields {
+		if !f.Confidence.LessThan(threshold) {
+			continue
+		}
+
+		result.Fields = append(result.Fields, f)
+		if f.LoanNumber != "" && !seen[f.LoanNumber] {
+			seen[f.LoanNumber] = true
+			result.LoanNumbers = append(result.LoanNumbers, f.LoanNumber)
+		}
+	}
+
+	return result
+}
+
+func getExtractionConfidence(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]FieldConfidence, error) {
+	defer database.TimeQuery("cib.getExtractionConfidence")()
+
+	if in.Number == "" {
+		return nil, ErrCalculationNotFound
+	}
+
+	pred, args, err := in.ToSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.
+		Select("TOP 1 extraction_confidence").
+		From(`cib_file_analysis`).
+		Where(pred, args...).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	var raw sql.NullString
+	err = db.QueryRowContext(ctx, q, args...).Scan(&raw)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCalculationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get extraction confidence: %w", err)
+	}
+
+	if !raw.Valid || raw.String == "" {
+		return nil, nil
+	}
+
+	var fields []FieldConfidence
+	if err := json.Unmarshal([]byte(raw.String), &fields); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal extraction confidence: %w", err)
+	}
+
+	return fields, nil
+}
@@ -0,0 +1,243 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+type ConsolidateReq struct {
+	// Numbers are the numbers of the two calculations to consolidate.
+	Numbers []string `json:"numbers"`
+
+	// Number is the number the consolidated calculation is saved as, required when Save is set.
+	Number string `json:"number"`
+
+	// Save persists the consolidated calculation, otherwise it is only returned.
+	Save bool `json:"save"`
+}
+
+func (r *ConsolidateReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	for i := range r.Numbers {
+		r.Numbers[i] = strings.TrimSpace(r.Numbers[i])
+	}
+	r.Number = strings.TrimSpace(r.Number)
+
+	switch {
+	case len(r.Numbers) != 2:
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: "Numbers must contain exactly two calculation numbers",
+		})
+
+	case r.Numbers[0] == "" || r.Numbers[1] == "":
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: "Numbers must not be empty",
+		})
+
+	case r.Numbers[0] == r.Numbers[1]:
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: "Numbers must be two different calculation numbers",
+		})
+	}
+
+	if r.Save && r.Number == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "number",
+			Description: "Number must not be empty when the consolidated calculation is saved",
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Consolidation is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// identifiable reports whether the customer has the phone number and the date of birth
+// needed to tell it apart from another customer with the same name.
+func identifiable(c Customer) bool {
+	return strings.TrimSpace(c.PhoneNumber) != "" && !c.DateOfBirth.Time().IsZero()
+}
+
+// sameCustomer reports whether both calculations are of the same customer,
+// i.e. they share the display name, the phone number and the date of birth.
+// Customers missing the phone number or the date of birth are never the same,
+// two of them with the same name would otherwise match.
+func sameCustomer(a, b Customer) bool {
+	return identifiable(a) && identifiable(b) &&
+		strings.EqualFold(strings.TrimSpace(a.DisplayName), strings.TrimSpace(b.DisplayName)) &&
+		strings.TrimSpace(a.PhoneNumber) == strings.TrimSpace(b.PhoneNumber) &&
+		a.DateOfBirth.Time().Equal(b.DateOfBirth.Time())
+}
+
+// mergeContracts returns the contracts of both sets de-duplicated by loan number.
+// When both sets have a loan, the most recently reported one is kept.
+// Contracts without a loan number cannot be matched and are always kept.
+func mergeContracts(a, b []Contract) []Contract {
+	merged := make([]Contract, 0, len(a)+len(b))
+	index := make(map[string]int)
+	for _, contracts := range [][]Contract{a, b} {
+		for _, c := range contracts {
+			number := strings.TrimSpace(c.Number)
+			if number == "" {
+				merged = append(merged, c)
+				continue
+			}
+
+			i, ok := index[number]
+			if !ok {
+				index[number] = len(merged)
+				merged = append(merged, c)
+				continue
+			}
+
+			if c.LastedAt.Time().After(merged[i].LastedAt.Time()) {
+				merged[i] = c
+			}
+		}
+	}
+
+	return merged
+}
+
+// newAggregateByBankCode counts the contracts per bank code, sorted by bank code.
+func newAggregateByBankCode(contracts []Contract) []AggregateByBankCode {
+	counts := make(map[string]int64)
+	for _, c := range contracts {
+		counts[c.BankCode]++
+	}
+
+	aggregates := make([]AggregateByBankCode, 0, len(counts))
+	for code, n := range counts {
+		aggregates = append(aggregates, AggregateByBankCode{
+			BankCode: code,
+			Quantity: decimal.NewFromInt(n),
+		})
+	}
+	sort.Slice(aggregates, func(i, j int) bool {
+		return aggregates[i].BankCode < aggregates[j].BankCode
+	})
+
+	return aggregates
+}
+
+// consolidateCalculations merges the contracts of two calculations of the same customer
+// into a new calculation with recomputed aggregates.
+func consolidateCalculations(by string, number string, a, b *Calculation, minFinanceAmountInLAK decimal.Decimal) *Calculation {
+	now := time.Now()
+	c := new(Calculation)
+	c.CreatedBy = by
+	c.UpdatedBy = by
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.Number = number
+	c.CIBFileName = a.CIBFileName
+	c.Customer = a.Customer
+	c.Contracts = mergeContracts(a.Contracts, b.Contracts)
+	markNegligibleContracts(c.Contracts, minFinanceAmountInLAK)
+	c.AggregateQuantity = newAggregateQuantity(c.Contracts)
+	c.AggregateByBankCode = newAggregateByBankCode(c.Contracts)
+	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
+	c.BaseCurrency = a.BaseCurrency
+	if c.BaseCurrency == "" {
+		c.BaseCurrency = b.BaseCurrency
+	}
+
+	return c
+}
+
+// ConsolidateCalculations merges the calculations of a customer analyzed under two numbers.
+// The loans are de-duplicated by loan number and the aggregates are recomputed.
+// The consolidated calculation is only saved when requested.
+func (s *Service) ConsolidateCalculations(ctx context.Context, in *ConsolidateReq) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ConsolidateCalculations"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	calculations := make([]*Calculation, 0, len(in.Numbers))
+	for _, n := range in.Numbers {
+		calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+			Number:    n,
+			createdBy: claims.VisibleCreator(),
+		})
+		if errors.Is(err, ErrCalculationNotFound) {
+			return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+		}
+		if err != nil {
+			zlog.Error("failed to get calculation by number", zap.Error(err))
+			return nil, err
+		}
+
+		calculations = append(calculations, calculation)
+	}
+
+	if !identifiable(calculations[0].Customer) || !identifiable(calculations[1].Customer) {
+		return nil, rpcStatus.Error(codes.FailedPrecondition, "Calculations can only be consolidated when both customers have a phone number and a date of birth.")
+	}
+	if !sameCustomer(calculations[0].Customer, calculations[1].Customer) {
+		return nil, rpcStatus.Error(codes.FailedPrecondition, "Calculations can only be consolidated when they share the customer name, phone number and date of birth.")
+	}
+	if a, b := calculations[0].BaseCurrency, calculations[1].BaseCurrency; a != "" && b != "" && !strings.EqualFold(a, b) {
+		return nil, rpcStatus.Errorf(codes.FailedPrecondition, "Calculations can only be consolidated when their installments are in the same base currency, got %s and %s.", a, b)
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	consolidated := consolidateCalculations(claims.Username, in.Number, calculations[0], calculations[1], cfg.CIBMinFinanceAmount)
+	if !in.Save {
+		return consolidated, nil
+	}
+
+	exists, err := isCalculationExists(ctx, s.db, in.Number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if calculation exists: %w", err)
+	}
+	if exists {
+		return nil, rpcStatus.New(
+			codes.AlreadyExists,
+			"Calculation with this number already exists. Please use a different number.",
+		).Err()
+	}
+
+	if err := saveCalculation(ctx, s.db, consolidated); err != nil {
+		zlog.Error("failed to save consolidated calculation", zap.Error(err))
+		return nil, err
+	}
+
+	return consolidated, nil
+}
@@ -0,0 +1,125 @@
+package cib
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestConsolidateCalculationsDeduplicatesLoans(t *testing.T) {
+	reportedAt := func(month time.Month) yyyymmdd {
+		return yyyymmdd(time.Date(2025, month, 1, 0, 0, 0, 0, time.UTC))
+	}
+	contract := func(number, bank string, status status, installment int64, month time.Month) Contract {
+		return Contract{
+			Number:           number,
+			BankCode:         bank,
+			Status:           status,
+			LastedAt:         reportedAt(month),
+			InstallmentInLAK: decimal.NewFromInt(installment),
+		}
+	}
+
+	a := &Calculation{
+		Number:       "CIB-1",
+		BaseCurrency: "LAK",
+		Contracts: []Contract{
+			contract("LN-1", "BCEL", StatusActive, 1000, time.March),
+			contract("LN-2", "LDB", StatusActive, 2000, time.March),
+		},
+	}
+	b := &Calculation{
+		Number: "CIB-2",
+		Contracts: []Contract{
+			// LN-2 was reported later by the second calculation, closed in the meantime.
+			contract("LN-2", "LDB", StatusClosed, 0, time.May),
+			// LN-1 was reported earlier by the second calculation.
+			contract("LN-1", "BCEL", StatusActive, 900, time.January),
+			contract("LN-3", "BCEL", StatusActive, 500, time.May),
+		},
+	}
+
+	c := consolidateCalculations("user@example.com", "CIB-3", a, b, decimal.Zero)
+
+	numbers := make([]string, 0, len(c.Contracts))
+	for _, ct := range c.Contracts {
+		numbers = append(numbers, ct.Number)
+	}
+	if want := []string{"LN-1", "LN-2", "LN-3"}; !slices.Equal(numbers, want) {
+		t.Fatalf("contracts = %v, want %v", numbers, want)
+	}
+	if c.Contracts[0].InstallmentInLAK.IntPart() != 1000 || c.Contracts[1].Status != StatusClosed {
+		t.Errorf("contracts = %+v, want the most recently reported loans", c.Contracts)
+	}
+
+	if !c.AggregateQuantity.Total.Equal(decimal.NewFromInt(3)) || !c.AggregateQuantity.Active.Equal(decimal.NewFromInt(2)) ||
+		!c.AggregateQuantity.Closed.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("aggregate quantity = %+v, want 3 loans of which 2 active and 1 closed", c.AggregateQuantity)
+	}
+	if len(c.AggregateByBankCode) != 2 || c.AggregateByBankCode[0].BankCode != "BCEL" ||
+		!c.AggregateByBankCode[0].Quantity.Equal(decimal.NewFromInt(2)) {
+		t.Errorf("aggregate by bank code = %+v, want 2 loans of BCEL and 1 of LDB", c.AggregateByBankCode)
+	}
+	if !c.TotalInstallmentInLAK.Equal(decimal.NewFromInt(1500)) {
+		t.Errorf("total installment = %s, want 1500", c.TotalInstallmentInLAK)
+	}
+	if c.Number != "CIB-3" || c.BaseCurrency != "LAK" {
+		t.Errorf("calculation %s in %s, want CIB-3 in LAK", c.Number, c.BaseCurrency)
+	}
+}
+
+func TestConsolidateCalculationsCustomer(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	row := func(t *testing.T, id int64, number, customer, phone string, dob any, contracts []Contract) []any {
+		b, err := json.Marshal(contracts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return []any{
+			id, number, "cib.pdf", customer, phone, dob,
+			"0", "0", "0", "0", "LAK",
+			[]byte(`[]`), b, "user@example.com", now, "user@example.com", now,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		customer string
+		phone    string
+		dob      any
+		wantCode codes.Code
+	}{
+		// Both calculations share the phone number and the date of birth of the case,
+		// a missing one must not make them the same customer.
+		{name: "same customer", customer: " somchai ", phone: "020000000", dob: "1990-01-01", wantCode: codes.OK},
+		{name: "other customer", customer: "Keo", phone: "020000000", dob: "1990-01-01", wantCode: codes.FailedPrecondition},
+		{name: "no phone number", customer: "Somchai", phone: "", dob: "1990-01-01", wantCode: codes.FailedPrecondition},
+		{name: "no date of birth", customer: "Somchai", phone: "020000000", dob: nil, wantCode: codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(calculationColumns,
+				row(t, 1, "CIB-1", "Somchai", tt.phone, tt.dob, []Contract{{Number: "LN-1", BankCode: "BCEL", Status: StatusActive}}))
+			mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(calculationColumns,
+				row(t, 2, "CIB-2", tt.customer, tt.phone, tt.dob, []Contract{{Number: "LN-1", BankCode: "BCEL", Status: StatusActive}}))
+
+			ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+			c, err := s.ConsolidateCalculations(ctx, &ConsolidateReq{Numbers: []string{"CIB-1", "CIB-2"}})
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ConsolidateCalculations() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err == nil && len(c.Contracts) != 1 {
+				t.Errorf("got %d contracts, want the shared loan once", len(c.Contracts))
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package cib
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"go.uber.org/zap"
+)
+
+// contractCSVHeader returns the header of the contracts CSV, the installment converted
+// to the given base currency being labelled with it.
+func contractCSVHeader(baseCurrency string) []string {
+	return []string{
+		"Calculation Number",
+		"Customer Name",
+		"Loan Number",
+		"Bank Code",
+		"Type",
+		"Term Type",
+		"Currency",
+		"Status",
+		"Grade CIB",
+		"Overdue Days",
+		"Finance Amount",
+		"Outstanding Balance",
+		"Installment",
+		"Exchange Rate",
+		fmt.Sprintf("Installment in %s", baseCurrency),
+		"Negligible",
+	}
+}
+
+// ExportContractsToCSV writes one CSV row per contract of the calculations matching the query to w.
+// The calculations are read and written in batches, so the rows are streamed instead of being kept in memory.
+// The export starts from the resume ID of the query and ignores its limit, every contract is written.
+func (s *Service) ExportContractsToCSV(ctx context.Context, w io.Writer, in *BatchGetCalculationsQuery) error {
+	claims := auth.ClaimsFromContext(ctx)
+	zlog := s.zlog.With(
+		zap.String("Method", "ExportContractsToCSV"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return err
+	}
+
+	in.createdBy = claims.VisibleCreator()
+	in.riskExcludedBankCodes = s.riskExcludedBankCodes
+	if err := s.exportContractsToCSV(ctx, w, in); err != nil {
+		zlog.Error("failed to export contracts to csv", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (s *Service) exportContractsToCSV(ctx context.Context, w io.Writer, in *BatchGetCalculationsQuery) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(contractCSVHeader(s.currency.BaseCurrency())); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	nextID := in.ResumeID
+	for {
+		calculations, err := batchGetCalculations(ctx, s.db, exportBatchSize, nextID, in)
+		if err != nil {
+			return fmt.Errorf("failed to get calculations: %w", err)
+		}
+		if len(calculations) == 0 {
+			break
+		}
+		nextID = calculations[len(calculations)-1].ID
+
+		for _, c := range in.filterByRisk(calculations) {
+			for _, contract := range c.Contracts {
+				if err := cw.Write(contractCSVRecord(c, contract)); err != nil {
+					return fmt.Errorf("failed to write contract: %w", err)
+				}
+			}
+		}
+
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return fmt.Errorf("failed to flush csv: %w", err)
+		}
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to flush csv: %w", err)
+	}
+
+	return nil
+}
+
+func contractCSVRecord(c *Calculation, contract Contract) []string {
+	return []string{
+		c.Number,
+		c.Customer.DisplayName,
+		contract.Number,
+		contract.BankCode,
+		contract.Type,
+		contract.TermType,
+		contract.Currency,
+		contract.Status.String(),
+		contract.GradeCIB,
+		contract.OverdueInDay.String(),
+		contract.FinanceAmount.String(),
+		contract.OutstandingBalance.String(),
+		contract.Installment.StringFixed(2),
+		contract.ExchangeRate.String(),
+		contract.InstallmentInLAK.StringFixed(2),
+		strconv.FormatBool(contract.Negligible),
+	}
+}
@@ -0,0 +1,67 @@
+package cib
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+)
+
+func TestExportContractsToCSV(t *testing.T) {
+	contract := func(number string) Contract {
+		return Contract{
+			Number:           number,
+			BankCode:         "BCEL",
+			Currency:         "USD",
+			Status:           StatusActive,
+			Installment:      decimal.NewFromInt(100),
+			ExchangeRate:     decimal.NewFromInt(21500),
+			InstallmentInLAK: decimal.NewFromInt(2150000),
+		}
+	}
+
+	s, mock := newTestService(t)
+	if err := s.currency.SetBaseCurrency("THB"); err != nil {
+		t.Fatal(err)
+	}
+	mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns,
+		batchRow(t, 2, "CIB-2", "Somchai", []Contract{contract("LN-1"), contract("LN-2")}),
+		batchRow(t, 1, "CIB-1", "Keo", []Contract{contract("LN-3")}),
+	)
+	mock.ExpectQuery(`FROM cib_file_analysis`)
+
+	var buf bytes.Buffer
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	if err := s.ExportContractsToCSV(ctx, &buf, &BatchGetCalculationsQuery{}); err != nil {
+		t.Fatalf("ExportContractsToCSV() error = %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the csv: %v", err)
+	}
+
+	// The header and one row per contract.
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4: %v", len(records), records)
+	}
+
+	installmentInBase := len(contractCSVHeader("")) - 2
+	if got := records[0][installmentInBase]; got != "Installment in THB" {
+		t.Errorf("header = %q, want the installment labelled with the base currency", got)
+	}
+
+	want := [][2]string{{"CIB-2", "LN-1"}, {"CIB-2", "LN-2"}, {"CIB-1", "LN-3"}}
+	for i, w := range want {
+		r := records[i+1]
+		if r[0] != w[0] || r[2] != w[1] {
+			t.Errorf("record %d = %s %s, want %s %s", i+1, r[0], r[2], w[0], w[1])
+		}
+		if r[installmentInBase] != "2150000.00" {
+			t.Errorf("record %d installment in base currency = %s, want 2150000.00", i+1, r[installmentInBase])
+		}
+	}
+}
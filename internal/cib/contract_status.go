@@ -0,0 +1,146 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// ContractStatusReq sets the status of a contract whose status
+// was not mapped, or wrongly mapped, from the CIB file.
+type ContractStatusReq struct {
+	Number     string `json:"-" param:"number"`
+	LoanNumber string `json:"-" param:"loanNumber"`
+	Status     string `json:"status"`
+}
+
+func (r *ContractStatusReq) status() status {
+	return statusValues[strings.ToUpper(strings.TrimSpace(r.Status))]
+}
+
+func (r *ContractStatusReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if strings.TrimSpace(r.LoanNumber) == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "loanNumber",
+			Description: "Loan number must not be empty",
+		})
+	}
+
+	switch r.status() {
+	case StatusActive, StatusClosed:
+	default:
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "status",
+			Description: "Status must be one of ACTIVE or CLOSED",
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Contract status is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// SetContractStatus sets the status of the contracts of the given loan number and re-derives
+// their installment, the aggregates and the total installment of the calculation.
+func (s *Service) SetContractStatus(ctx context.Context, in *ContractStatusReq) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "SetContractStatus"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    in.Number,
+		createdBy: claims.ChangeableCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	if !calculation.SetContractStatus(claims.Username, strings.TrimSpace(in.LoanNumber), in.status(), s.installmentFloors, cfg.CIBMinFinanceAmount, cfg.CIBInstallmentPlaces) {
+		return nil, rpcStatus.Error(codes.NotFound, "Contract not found in the calculation")
+	}
+
+	if err := saveCalculation(ctx, s.db, calculation); err != nil {
+		zlog.Error("failed to save calculation", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
+// SetContractStatus sets the status of the contracts of the given loan number, re-deriving their
+// installment in the base currency with their exchange rate, and the aggregates of the calculation.
+// It reports whether any contract has the loan number.
+func (c *Calculation) SetContractStatus(by string, loanNumber string, st status, floors map[termType]decimal.Decimal, minFinanceAmountInLAK decimal.Decimal, installmentPlaces int32) bool {
+	var found bool
+	for i := range c.Contracts {
+		contract := &c.Contracts[i]
+		if strings.TrimSpace(contract.Number) != loanNumber {
+			continue
+		}
+
+		found = true
+		contract.Status = st
+		contract.termType = termTypeFromTypeOfTermLoan(contract.TermType)
+		contract.Installment = calculateInstallment(*contract, installmentFloor(*contract, floors))
+		contract.InstallmentInLAK = convertInstallmentToBase(contract.Installment, contract.ExchangeRate, installmentPlaces)
+	}
+	if !found {
+		return false
+	}
+
+	markNegligibleContracts(c.Contracts, minFinanceAmountInLAK)
+	c.AggregateQuantity = newAggregateQuantity(c.Contracts)
+	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
+	c.UpdatedBy = by
+	c.UpdatedAt = time.Now()
+	return true
+}
+
+// unspecifiedStatusContracts returns the loan numbers of the contracts whose status
+// could not be mapped from the CIB file.
+func unspecifiedStatusContracts(contracts []Contract) []string {
+	numbers := make([]string, 0)
+	for _, c := range contracts {
+		if c.Status == StatusUnSpecified {
+			numbers = append(numbers, c.Number)
+		}
+	}
+	return numbers
+}
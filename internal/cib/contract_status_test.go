@@ -0,0 +1,144 @@
+package cib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestCalculationSetContractStatusCorrectsUnmappedStatus(t *testing.T) {
+	one := decimal.NewFromInt(1)
+	contract := newContract(loanHistory{
+		AccountNumber:    "LN-1",
+		BankNameEn:       "BCEL",
+		OpenedDate:       "01-01-2024",
+		MatureDate:       "01-01-2025",
+		Interest:         "12",
+		CreditLimit:      "12000000",
+		OsBalance:        "6000000",
+		Currency:         "LAK",
+		TypeOfLoan:       "CL",
+		AccountStatusEng: "Normal",
+	}, one, nil, 0)
+
+	c := &Calculation{Contracts: []Contract{contract}}
+	c.AggregateQuantity = newAggregateQuantity(c.Contracts)
+	c.TotalInstallmentInLAK = sumInstallment(c.Contracts)
+
+	if got := unspecifiedStatusContracts(c.Contracts); len(got) != 1 || got[0] != "LN-1" {
+		t.Fatalf("unspecifiedStatusContracts() = %v, want [LN-1]", got)
+	}
+	if !c.TotalInstallmentInLAK.IsZero() {
+		t.Fatalf("total installment of an unmapped contract = %s, want 0", c.TotalInstallmentInLAK)
+	}
+
+	tests := []struct {
+		status          status
+		wantActive      int64
+		wantClosed      int64
+		wantInstallment bool
+	}{
+		{status: StatusActive, wantActive: 1, wantInstallment: true},
+		{status: StatusClosed, wantClosed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status.String(), func(t *testing.T) {
+			if !c.SetContractStatus("user@example.com", "LN-1", tt.status, nil, decimal.Zero, 0) {
+				t.Fatal("SetContractStatus() = false, want true")
+			}
+
+			got := c.Contracts[0]
+			if got.Status != tt.status {
+				t.Errorf("status = %v, want %v", got.Status, tt.status)
+			}
+			if got.InstallmentInLAK.IsPositive() != tt.wantInstallment {
+				t.Errorf("installment = %s, want positive %v", got.InstallmentInLAK, tt.wantInstallment)
+			}
+			if !c.TotalInstallmentInLAK.Equal(got.InstallmentInLAK) {
+				t.Errorf("total installment = %s, want %s", c.TotalInstallmentInLAK, got.InstallmentInLAK)
+			}
+			if !c.AggregateQuantity.Active.Equal(decimal.NewFromInt(tt.wantActive)) || !c.AggregateQuantity.Closed.Equal(decimal.NewFromInt(tt.wantClosed)) {
+				t.Errorf("aggregate = %+v, want %d active and %d closed", c.AggregateQuantity, tt.wantActive, tt.wantClosed)
+			}
+			if got := unspecifiedStatusContracts(c.Contracts); len(got) != 0 {
+				t.Errorf("unspecifiedStatusContracts() = %v, want none", got)
+			}
+		})
+	}
+
+	if c.SetContractStatus("user@example.com", "LN-2", StatusActive, nil, decimal.Zero, 0) {
+		t.Error("SetContractStatus() of an unknown loan number = true, want false")
+	}
+}
+
+func newTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	db, mock := dbtest.New(t)
+	currencySvc, err := currency.NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewService(context.Background(), db, currencySvc, zap.NewNop(), "http://localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+func TestSetContractStatusOnlyChangesOwnCalculations(t *testing.T) {
+	tests := []struct {
+		name          string
+		claims        *auth.Claims
+		wantCreatedBy bool
+	}{
+		{
+			name:          "user",
+			claims:        &auth.Claims{Username: "user@example.com", Role: auth.RoleUser},
+			wantCreatedBy: true,
+		},
+		{
+			name:          "read-only admin",
+			claims:        &auth.Claims{Username: "viewer@example.com", Role: auth.RoleReadOnlyAdmin},
+			wantCreatedBy: true,
+		},
+		{
+			name:   "admin",
+			claims: &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			// The calculation of another user is not found.
+			get := mock.ExpectQuery(`FROM cib_file_analysis`)
+
+			ctx := auth.ContextWithClaims(context.Background(), tt.claims)
+			_, err := s.SetContractStatus(ctx, &ContractStatusReq{Number: "CIB-1", LoanNumber: "LN-1", Status: "ACTIVE"})
+			if got := rpcStatus.Code(err); got != codes.PermissionDenied {
+				t.Fatalf("SetContractStatus() code = %v, want PermissionDenied", got)
+			}
+
+			var filtered bool
+			for _, arg := range get.Args() {
+				if arg == tt.claims.Username {
+					filtered = true
+				}
+			}
+			if filtered != tt.wantCreatedBy {
+				t.Errorf("query restricted to the calculations of %s = %v, want %v", tt.claims.Username, filtered, tt.wantCreatedBy)
+			}
+		})
+	}
+}
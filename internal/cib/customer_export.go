@@ -0,0 +1,104 @@
+package cib
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// customerExportBatchSize is the number of calculations read per batch by the customer export.
+const customerExportBatchSize = 100
+
+type CustomerExportQuery struct {
+	Name string `query:"name"`
+}
+
+func (q *CustomerExportQuery) Validate() error {
+	if strings.TrimSpace(q.Name) == "" {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Customer export query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "name",
+					Description: "Name must not be empty",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// ExportCustomerToExcel exports the contracts of every calculation whose customer display name
+// is the given name to one workbook with the summary, active and closed loan sheets.
+// The loans are de-duplicated by loan number across calculations, the most recently reported one is kept.
+func (s *Service) ExportCustomerToExcel(ctx context.Context, in *CustomerExportQuery) (*bytes.Buffer, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ExportCustomerToExcel"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	q := &BatchGetCalculationsQuery{
+		customerDisplayNameExact: strings.TrimSpace(in.Name),
+		createdBy:                claims.VisibleCreator(),
+	}
+
+	var found bool
+	contracts := make([]Contract, 0)
+	var nextID int64
+	for {
+		calculations, err := batchGetCalculations(ctx, s.db, customerExportBatchSize, nextID, q)
+		if err != nil {
+			zlog.Error("failed to get calculations", zap.Error(err))
+			return nil, err
+		}
+		if len(calculations) == 0 {
+			break
+		}
+
+		found = true
+		for _, c := range calculations {
+			contracts = mergeContracts(contracts, c.Contracts)
+		}
+
+		nextID = calculations[len(calculations)-1].ID
+	}
+	if !found {
+		return nil, rpcStatus.Error(codes.NotFound, "Customer has no calculation or you are not allowed to view it")
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+	markNegligibleContracts(contracts, cfg.CIBMinFinanceAmount)
+
+	buf, err := s.exportCalculationToExcel(ctx, &Calculation{
+		Contracts:             contracts,
+		TotalInstallmentInLAK: sumInstallment(contracts),
+	})
+	if err != nil {
+		zlog.Error("failed to export customer to excel", zap.Error(err))
+		return nil, err
+	}
+
+	return buf, nil
+}
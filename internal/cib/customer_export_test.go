@@ -0,0 +1,107 @@
+package cib
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+// batchColumns are the columns selected by batchGetCalculations.
+var batchColumns = []string{
+	"id", "number", "cib_file_name", "customer_display_name", "customer_phone_number", "customer_dob",
+	"total_loan", "total_closed_loan", "total_active_loan", "total_installment_lak",
+	"aggregate_by_bank", "contract_info", "created_by", "created_at", "updated_by", "updated_at",
+}
+
+func batchRow(t *testing.T, id int64, number, customer string, contracts []Contract) []any {
+	t.Helper()
+
+	b, err := json.Marshal(contracts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []any{
+		id, number, "cib.pdf", customer, "020000000", "1990-01-01",
+		"0", "0", "0", "0",
+		[]byte(`[]`), b, "user@example.com", now, "user@example.com", now,
+	}
+}
+
+func TestExportCustomerToExcelDeduplicatesLoans(t *testing.T) {
+	reportedAt := func(month time.Month) yyyymmdd {
+		return yyyymmdd(time.Date(2025, month, 1, 0, 0, 0, 0, time.UTC))
+	}
+	contract := func(number, typ string, lastedAt yyyymmdd) Contract {
+		return Contract{
+			Number:           number,
+			BankCode:         "BCEL",
+			Type:             typ,
+			Currency:         "LAK",
+			Status:           StatusActive,
+			LastedAt:         lastedAt,
+			Installment:      decimal.NewFromInt(100000),
+			InstallmentInLAK: decimal.NewFromInt(100000),
+			ExchangeRate:     decimal.NewFromInt(1),
+		}
+	}
+
+	s, mock := newTestService(t)
+	batch := mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns,
+		batchRow(t, 2, "CIB-2", "Somchai", []Contract{
+			contract("LN-1", "latest", reportedAt(5)),
+			contract("LN-2", "car loan", reportedAt(5)),
+		}),
+		batchRow(t, 1, "CIB-1", "Somchai", []Contract{
+			contract("LN-1", "earlier", reportedAt(1)),
+		}),
+	)
+	mock.ExpectQuery(`FROM cib_file_analysis`)
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	buf, err := s.ExportCustomerToExcel(ctx, &CustomerExportQuery{Name: " Somchai "})
+	if err != nil {
+		t.Fatalf("ExportCustomerToExcel() error = %v", err)
+	}
+
+	// The customer is matched by the exact name, not as a LIKE pattern matching other customers.
+	var exact bool
+	for _, arg := range batch.Args() {
+		if arg == "Somchai" {
+			exact = true
+		}
+	}
+	if !exact {
+		t.Errorf("query args = %v, want the exact customer name", batch.Args())
+	}
+
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatalf("failed to open the workbook: %v", err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Summary all Loan")
+	if err != nil {
+		t.Fatalf("failed to read the summary sheet: %v", err)
+	}
+
+	// The header, one row per loan and the total.
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want 4: %v", len(rows), rows)
+	}
+
+	types := map[string]bool{}
+	for _, row := range rows[1:3] {
+		types[row[4]] = true
+	}
+	if !types["latest"] || !types["car loan"] {
+		t.Errorf("loan types = %v, want the latest LN-1 and LN-2", types)
+	}
+}
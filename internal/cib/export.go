@@ -9,19 +9,34 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/10664kls/automatic-finance-api/internal/database"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/shopspring/decimal"
 	"github.com/xuri/excelize/v2"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
 )
 
-func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
-	f := excelize.NewFile()
-	defer f.Close()
+// exportBatchSize is the number of calculations read per batch by the exports.
+const exportBatchSize = 500
+
+// exportCalculationsToExcel writes the calculations with a stream writer,
+// so the rows are flushed to a temporary file instead of being kept in memory.
+// The caller must close the returned file. The returned next ID resumes the export
+// when the limit of the query is reached, it is zero once every calculation is exported.
+func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (f *excelize.File, nextID int64, err error) {
+	f = excelize.NewFile()
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
 
 	const sheetName = "Calculation of cib"
 	sheet, err := f.NewSheet(sheetName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+		return nil, 0, fmt.Errorf("failed to create new sheet: %w", err)
 	}
 	f.SetActiveSheet(sheet)
 
@@ -33,7 +48,7 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create style: %w", err)
 	}
 
 	fontStyle, err := f.NewStyle(&excelize.Style{
@@ -42,44 +57,65 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create front style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create front style: %w", err)
 	}
 
-	f.SetCellValue(sheetName, "A1", "Enter Facility / LO Number")
-	f.SetCellValue(sheetName, "B1", "Customer Name")
-	f.SetCellValue(sheetName, "C1", "Total Loan")
-	f.SetCellValue(sheetName, "D1", "Total closed loan")
-	f.SetCellValue(sheetName, "E1", "Total active loan")
-	f.SetCellValue(sheetName, "F1", "Total installment (CIB)")
-	f.SetCellStyle(sheetName, "A1", "F1", fontStyle)
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create stream writer: %w", err)
+	}
+
+	if err := sw.SetRow("A1", []any{
+		excelize.Cell{StyleID: fontStyle, Value: "Enter Facility / LO Number"},
+		excelize.Cell{StyleID: fontStyle, Value: "Customer Name"},
+		excelize.Cell{StyleID: fontStyle, Value: "Total Loan"},
+		excelize.Cell{StyleID: fontStyle, Value: "Total closed loan"},
+		excelize.Cell{StyleID: fontStyle, Value: "Total active loan"},
+		excelize.Cell{StyleID: fontStyle, Value: "Total installment (CIB)"},
+	}); err != nil {
+		return nil, 0, fmt.Errorf("failed to set header row: %w", err)
+	}
 
 	startRow := 2
-	var nextID int64
+	nextID = in.ResumeID
+	var read int
 	for {
-		calculations, err := batchGetCalculations(ctx, s.db, 500, nextID, in)
+		size := exportBatchSize
+		if in.Limit > 0 {
+			if read >= in.Limit {
+				break // the limit is reached, the export resumes from nextID
+			}
+			size = min(size, in.Limit-read)
+		}
+
+		calculations, err := batchGetCalculations(ctx, s.db, size, nextID, in)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get calculations: %w", err)
+			return nil, 0, fmt.Errorf("failed to get calculations: %w", err)
 		}
 
 		if len(calculations) == 0 {
+			nextID = 0
 			break
 		}
+		read += len(calculations)
 
 		s.mu.Lock()
 		nextID = calculations[len(calculations)-1].ID
 		s.mu.Unlock()
 
-		setCalculationsToExcel(f, sheetName, numberStyle, startRow, calculations)
+		calculations = in.filterByRisk(calculations)
+		if err := setCalculationsToExcel(sw, numberStyle, startRow, calculations); err != nil {
+			return nil, 0, fmt.Errorf("failed to set calculations to excel: %w", err)
+		}
 
 		startRow += len(calculations)
 	}
 
-	byt, err := f.WriteToBuffer()
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	if err := sw.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("failed to flush stream writer: %w", err)
 	}
 
-	return byt, nil
+	return f, nextID, nil
 }
 
 func (s *Service) exportCalculationToExcel(ctx context.Context, calculation *Calculation) (*bytes.Buffer, error) {
@@ -106,8 +142,9 @@ func (s *Service) exportCalculationToExcel(ctx context.Context, calculation *Cal
 		return nil, fmt.Errorf("failed to create front style: %w", err)
 	}
 
-	setCalculationToSummaryExcelSheet(ctx, f, fontStyle, numberStyle, calculation.TotalInstallmentInLAK, calculation.Contracts)
-	setCalculationToActiveLoanExcelSheet(ctx, f, fontStyle, numberStyle, calculation.Contracts)
+	baseCurrency := s.currency.BaseCurrency()
+	setCalculationToSummaryExcelSheet(ctx, f, fontStyle, numberStyle, baseCurrency, calculation.TotalInstallmentInLAK, calculation.Contracts)
+	setCalculationToActiveLoanExcelSheet(ctx, f, fontStyle, numberStyle, baseCurrency, calculation.Contracts)
 	setCalculationToClosedLoanExcelSheet(ctx, f, fontStyle, numberStyle, calculation.Contracts)
 
 	byt, err := f.WriteToBuffer()
@@ -118,7 +155,7 @@ func (s *Service) exportCalculationToExcel(ctx context.Context, calculation *Cal
 	return byt, nil
 }
 
-func setCalculationToSummaryExcelSheet(_ context.Context, f *excelize.File, fontStyle int, numberStyle int, totalInstallmentInLak decimal.Decimal, contracts []Contract) error {
+func setCalculationToSummaryExcelSheet(_ context.Context, f *excelize.File, fontStyle int, numberStyle int, baseCurrency string, totalInstallmentInLak decimal.Decimal, contracts []Contract) error {
 	const sheetName = "Summary all Loan"
 	summarySheet, err := f.NewSheet(sheetName)
 	if err != nil {
@@ -142,7 +179,7 @@ func setCalculationToSummaryExcelSheet(_ context.Context, f *excelize.File, font
 	f.SetCellValue(sheetName, "M1", "ສະຖານະພາບ")
 	f.SetCellValue(sheetName, "N1", "term")
 	f.SetCellValue(sheetName, "O1", "Installment by currency")
-	f.SetCellValue(sheetName, "P1", "InstLAK")
+	f.SetCellValue(sheetName, "P1", "Inst"+baseCurrency)
 	f.SetCellStyle(sheetName, "A1", "P1", fontStyle)
 
 	startRow := 2
@@ -190,7 +227,7 @@ func setCalculationToSummaryExcelSheet(_ context.Context, f *excelize.File, font
 	return nil
 }
 
-func setCalculationToActiveLoanExcelSheet(_ context.Context, f *excelize.File, fontStyle int, numberStyle int, contracts []Contract) error {
+func setCalculationToActiveLoanExcelSheet(_ context.Context, f *excelize.File, fontStyle int, numberStyle int, baseCurrency string, contracts []Contract) error {
 	const sheetName = "Active Loan"
 	activeLoanSheet, err := f.NewSheet(sheetName)
 	if err != nil {
@@ -205,7 +242,7 @@ func setCalculationToActiveLoanExcelSheet(_ context.Context, f *excelize.File, f
 	f.SetCellValue(sheetName, "D1", "ການຈັດຊັ້ນໜີ້")
 	f.SetCellValue(sheetName, "E1", "term")
 	f.SetCellValue(sheetName, "F1", "Installment")
-	f.SetCellValue(sheetName, "G1", "InstLAK")
+	f.SetCellValue(sheetName, "G1", "Inst"+baseCurrency)
 	f.SetCellValue(sheetName, "H1", "ປະຫວັດການຈັດຊັ້ນໜີ້12ເດືອນນັບຈາກເດືອນປະຈຸບັນ")
 	f.SetCellStyle(sheetName, "A1", "H1", fontStyle)
 	f.MergeCell(sheetName, "H1", "S1")
@@ -283,24 +320,26 @@ func setCalculationToClosedLoanExcelSheet(_ context.Context, f *excelize.File, f
 	return nil
 }
 
-func setCalculationsToExcel(f *excelize.File, sheetName string, numberStyle int, startRow int, calculations []*Calculation) {
+func setCalculationsToExcel(sw *excelize.StreamWriter, numberStyle int, startRow int, calculations []*Calculation) error {
 	for i, c := range calculations {
-		rowNumber := startRow + i
-		f.SetCellValue(sheetName, fmt.Sprintf("A%d", rowNumber), c.Number)
-		f.SetCellValue(sheetName, fmt.Sprintf("B%d", rowNumber), c.Customer.DisplayName)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("C%d", rowNumber), c.AggregateQuantity.Total.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("C%d", rowNumber), fmt.Sprintf("C%d", rowNumber), numberStyle)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", rowNumber), c.AggregateQuantity.Closed.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("D%d", rowNumber), fmt.Sprintf("D%d", rowNumber), numberStyle)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("E%d", rowNumber), c.AggregateQuantity.Active.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("E%d", rowNumber), fmt.Sprintf("E%d", rowNumber), numberStyle)
+		cell, err := excelize.CoordinatesToCellName(1, startRow+i)
+		if err != nil {
+			return err
+		}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("F%d", rowNumber), c.TotalInstallmentInLAK.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("F%d", rowNumber), fmt.Sprintf("F%d", rowNumber), numberStyle)
+		if err := sw.SetRow(cell, []any{
+			c.Number,
+			c.Customer.DisplayName,
+			excelize.Cell{StyleID: numberStyle, Value: c.AggregateQuantity.Total.InexactFloat64()},
+			excelize.Cell{StyleID: numberStyle, Value: c.AggregateQuantity.Closed.InexactFloat64()},
+			excelize.Cell{StyleID: numberStyle, Value: c.AggregateQuantity.Active.InexactFloat64()},
+			excelize.Cell{StyleID: numberStyle, Value: c.TotalInstallmentInLAK.InexactFloat64()},
+		}); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
 type BatchGetCalculationsQuery struct {
@@ -310,7 +349,68 @@ type BatchGetCalculationsQuery struct {
 	CreatedAfter        time.Time `query:"createdAfter"`
 	CreatedBefore       time.Time `query:"createdBefore"`
 
+	// HasRiskFlags keeps the calculations with a contract that is overdue or has been graded worse than A.
+	HasRiskFlags bool `query:"hasRiskFlags"`
+
+	// MinOverdueDays keeps the calculations with a contract overdue for at least this many days.
+	MinOverdueDays int64 `query:"minOverdueDays"`
+
+	// WorstGrade keeps the calculations with a contract graded at least as bad as this grade,
+	// currently or within the last 12 months.
+	WorstGrade string `query:"worstGrade"`
+
+	// ResumeID resumes an interrupted export from the calculations with an ID lower than it,
+	// i.e. the next ID returned by the previous export. Zero starts from the newest calculation.
+	ResumeID int64 `query:"nextId"`
+
+	// Limit is the maximum number of calculations read by an export. Zero reads them all.
+	Limit int `query:"limit"`
+
 	nextID int64
+
+	// loanNumber keeps the calculations whose contracts may hold the loan number, see FindByLoanNumber.
+	loanNumber string
+
+	// customerDisplayNameExact keeps the calculations of the customer of exactly this display name,
+	// unlike CustomerDisplayName matching any name containing it.
+	customerDisplayNameExact string
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+
+	// riskExcludedBankCodes are the bank codes whose contracts are skipped by the risk criteria.
+	riskExcludedBankCodes map[string]bool
+}
+
+func (q *BatchGetCalculationsQuery) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if q.MinOverdueDays < 0 {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "minOverdueDays",
+			Description: "Minimum overdue days must not be negative",
+		})
+	}
+
+	if q.WorstGrade != "" && gradeRank(q.WorstGrade) == 0 {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "worstGrade",
+			Description: "Worst grade must be one of A, B, C, D or E",
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
 }
 
 func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
@@ -324,6 +424,17 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 	if q.CustomerDisplayName != "" {
 		and = append(and, sq.Expr("customer_display_name LIKE ?", "%"+q.CustomerDisplayName+"%"))
 	}
+	if q.customerDisplayNameExact != "" {
+		and = append(and, sq.Eq{"customer_display_name": q.customerDisplayNameExact})
+	}
+
+	if q.loanNumber != "" {
+		and = append(and, sq.Expr(contractInfoText+" LIKE ?", loanNumberPattern(q.loanNumber)))
+	}
+
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"created_by": q.createdBy})
+	}
 
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
@@ -341,6 +452,8 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 }
 
 func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID int64, in *BatchGetCalculationsQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("cib.batchGetCalculations")()
+
 	id := fmt.Sprintf("TOP %d id", batchSize)
 	in.nextID = nextID
 	pred, args, err := in.ToSQL()
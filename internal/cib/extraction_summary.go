@@ -0,0 +1,97 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// extractionSummaryContracts is the number of contracts shown
+// at each end of the contracts of an extraction summary.
+const extractionSummaryContracts = 3
+
+// CurrencyQuantity is the number of contracts in a currency.
+type CurrencyQuantity struct {
+	Currency string `json:"currency"`
+	Quantity int    `json:"quantity"`
+}
+
+// ExtractionSummary is what was extracted from the CIB file of a calculation,
+// to check the extraction without the full calculation.
+type ExtractionSummary struct {
+	Number               string             `json:"number"`
+	CIBFileName          string             `json:"cibFileName"`
+	Customer             Customer           `json:"customer"`
+	ContractCount        int                `json:"contractCount"`
+	CurrencyDistribution []CurrencyQuantity `json:"currencyDistribution"`
+	FirstContracts       []Contract         `json:"firstContracts"`
+	LastContracts        []Contract         `json:"lastContracts"`
+}
+
+// GetExtractionSummary returns the extraction summary of the calculation of the given number,
+// computed from the stored calculation without extracting the CIB file again.
+func (s *Service) GetExtractionSummary(ctx context.Context, number string) (*ExtractionSummary, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetExtractionSummary"),
+		zap.String("Username", claims.Username),
+		zap.String("number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	return newExtractionSummary(calculation), nil
+}
+
+func newExtractionSummary(c *Calculation) *ExtractionSummary {
+	first := min(extractionSummaryContracts, len(c.Contracts))
+	last := max(first, len(c.Contracts)-extractionSummaryContracts)
+
+	return &ExtractionSummary{
+		Number:               c.Number,
+		CIBFileName:          c.CIBFileName,
+		Customer:             c.Customer,
+		ContractCount:        len(c.Contracts),
+		CurrencyDistribution: currencyDistribution(c.Contracts),
+		FirstContracts:       c.Contracts[:first],
+		LastContracts:        c.Contracts[last:],
+	}
+}
+
+// currencyDistribution counts the contracts per currency, ordered by currency code.
+func currencyDistribution(contracts []Contract) []CurrencyQuantity {
+	counts := make(map[string]int)
+	for _, c := range contracts {
+		counts[strings.ToUpper(strings.TrimSpace(c.Currency))]++
+	}
+
+	distribution := make([]CurrencyQuantity, 0, len(counts))
+	for currency, quantity := range counts {
+		distribution = append(distribution, CurrencyQuantity{
+			Currency: currency,
+			Quantity: quantity,
+		})
+	}
+	sort.Slice(distribution, func(i, j int) bool {
+		return distribution[i].Currency < distribution[j].Currency
+	})
+
+	return distribution
+}
@@ -0,0 +1,75 @@
+package cib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNewExtractionSummary(t *testing.T) {
+	contracts := func(currencies ...string) []Contract {
+		cs := make([]Contract, len(currencies))
+		for i, currency := range currencies {
+			cs[i] = Contract{Number: string(rune('A' + i)), Currency: currency}
+		}
+		return cs
+	}
+	numbers := func(cs []Contract) []string {
+		ns := make([]string, len(cs))
+		for i, c := range cs {
+			ns[i] = c.Number
+		}
+		return ns
+	}
+
+	tests := []struct {
+		name             string
+		contracts        []Contract
+		wantCount        int
+		wantDistribution []CurrencyQuantity
+		wantFirst        []string
+		wantLast         []string
+	}{
+		{
+			name:             "more contracts than both ends",
+			contracts:        contracts("LAK", "USD", " lak ", "THB", "LAK", "USD", "LAK"),
+			wantCount:        7,
+			wantDistribution: []CurrencyQuantity{{Currency: "LAK", Quantity: 4}, {Currency: "THB", Quantity: 1}, {Currency: "USD", Quantity: 2}},
+			wantFirst:        []string{"A", "B", "C"},
+			wantLast:         []string{"E", "F", "G"},
+		},
+		{
+			name:             "ends do not repeat contracts",
+			contracts:        contracts("LAK", "USD", "LAK", "LAK"),
+			wantCount:        4,
+			wantDistribution: []CurrencyQuantity{{Currency: "LAK", Quantity: 3}, {Currency: "USD", Quantity: 1}},
+			wantFirst:        []string{"A", "B", "C"},
+			wantLast:         []string{"D"},
+		},
+		{
+			name:             "no contract",
+			contracts:        []Contract{},
+			wantCount:        0,
+			wantDistribution: []CurrencyQuantity{},
+			wantFirst:        []string{},
+			wantLast:         []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := newExtractionSummary(&Calculation{Number: "CIB-1", Contracts: tt.contracts})
+			if summary.ContractCount != tt.wantCount {
+				t.Errorf("contract count = %d, want %d", summary.ContractCount, tt.wantCount)
+			}
+			if !reflect.DeepEqual(summary.CurrencyDistribution, tt.wantDistribution) {
+				t.Errorf("currency distribution = %v, want %v", summary.CurrencyDistribution, tt.wantDistribution)
+			}
+			if got := numbers(summary.FirstContracts); !reflect.DeepEqual(got, tt.wantFirst) {
+				t.Errorf("first contracts = %v, want %v", got, tt.wantFirst)
+			}
+			if got := numbers(summary.LastContracts); !reflect.DeepEqual(got, tt.wantLast) {
+				t.Errorf("last contracts = %v, want %v", got, tt.wantLast)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package cib
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// LoanSearchQuery searches the contracts of every calculation by loan number.
+type LoanSearchQuery struct {
+	LoanNumber string `query:"loanNumber"`
+}
+
+func (q *LoanSearchQuery) Validate() error {
+	if strings.TrimSpace(q.LoanNumber) == "" {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Loan search query is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "loanNumber",
+					Description: "Loan number must not be empty",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// LoanMatch is a contract with the searched loan number together with
+// the calculation it was found in.
+type LoanMatch struct {
+	CalculationID     int64     `json:"calculationId"`
+	CalculationNumber string    `json:"calculationNumber"`
+	CIBFileName       string    `json:"cibFileName"`
+	Customer          Customer  `json:"customer"`
+	Contract          Contract  `json:"contract"`
+	CalculatedAt      time.Time `json:"calculatedAt"`
+}
+
+type LoanSearchResult struct {
+	Matches []*LoanMatch `json:"matches"`
+}
+
+// FindByLoanNumber finds the contracts with the given loan number across every calculation,
+// newest calculation first.
+//
+// The contracts are stored as JSON in the contract_info column without an index,
+// so the calculations are narrowed with a LIKE on the encoded loan number
+// and the decoded contracts are then matched exactly.
+func (s *Service) FindByLoanNumber(ctx context.Context, in *LoanSearchQuery) (*LoanSearchResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "FindByLoanNumber"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	loanNumber := strings.TrimSpace(in.LoanNumber)
+	q := &BatchGetCalculationsQuery{
+		loanNumber: loanNumber,
+		createdBy:  claims.VisibleCreator(),
+	}
+
+	matches := make([]*LoanMatch, 0)
+	var nextID int64
+	for {
+		calculations, err := batchGetCalculations(ctx, s.db, customerExportBatchSize, nextID, q)
+		if err != nil {
+			zlog.Error("failed to get calculations", zap.Error(err))
+			return nil, err
+		}
+		if len(calculations) == 0 {
+			break
+		}
+
+		for _, c := range calculations {
+			matches = append(matches, matchLoanNumber(c, loanNumber)...)
+		}
+
+		nextID = calculations[len(calculations)-1].ID
+	}
+
+	return &LoanSearchResult{
+		Matches: matches,
+	}, nil
+}
+
+// matchLoanNumber returns the contracts of the calculation with the given loan number.
+func matchLoanNumber(c *Calculation, loanNumber string) []*LoanMatch {
+	matches := make([]*LoanMatch, 0)
+	for _, contract := range c.Contracts {
+		if !strings.EqualFold(strings.TrimSpace(contract.Number), loanNumber) {
+			continue
+		}
+
+		matches = append(matches, &LoanMatch{
+			CalculationID:     c.ID,
+			CalculationNumber: c.Number,
+			CIBFileName:       c.CIBFileName,
+			Customer:          c.Customer,
+			Contract:          contract,
+			CalculatedAt:      c.CreatedAt,
+		})
+	}
+
+	return matches
+}
+
+// contractInfoText is the contract_info column as text, so it can be matched with LIKE,
+// which SQL Server does not allow on its VARBINARY type. The encoded contracts are ASCII JSON.
+const contractInfoText = "CAST(contract_info AS VARCHAR(MAX))"
+
+// loanNumberPattern returns the LIKE pattern matching the JSON encoded contracts
+// that may hold the given loan number, with the LIKE wildcards escaped.
+func loanNumberPattern(loanNumber string) string {
+	b, _ := json.Marshal(loanNumber)
+	return "%" + database.EscapeLike(strings.Trim(string(b), `"`)) + "%"
+}
+
+// contractCurrencyPattern returns the LIKE pattern matching the JSON encoded contracts
+// with a contract in the given currency.
+func contractCurrencyPattern(code string) string {
+	b, _ := json.Marshal(strings.ToUpper(strings.TrimSpace(code)))
+	return `%"currency":` + database.EscapeLike(string(b)) + "%"
+}
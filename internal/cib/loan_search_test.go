@@ -0,0 +1,60 @@
+package cib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestFindByLoanNumber(t *testing.T) {
+	s, mock := newTestService(t)
+
+	// The LIKE narrows the calculations to those holding the loan number anywhere in their contracts,
+	// the decoded contracts are then matched exactly.
+	first := mock.ExpectQuery(`WHERE \(CAST\(contract_info AS VARCHAR\(MAX\)\) LIKE @p1 AND created_by = @p2\) ORDER BY id DESC`).WillReturnRows(batchColumns,
+		batchRow(t, 2, "CIB-2", "Somchai", []Contract{{Number: "LN-100"}, {Number: "LN-200"}}),
+		batchRow(t, 1, "CIB-1", "Somchai", []Contract{{Number: " ln-100 "}, {Number: "LN-1000"}}),
+	)
+	mock.ExpectQuery(`FROM cib_file_analysis`)
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	result, err := s.FindByLoanNumber(ctx, &LoanSearchQuery{LoanNumber: " LN-100 "})
+	if err != nil {
+		t.Fatalf("FindByLoanNumber() error = %v", err)
+	}
+	if args := first.Args(); len(args) != 2 || args[0] != "%LN-100%" || args[1] != "user@example.com" {
+		t.Errorf("query args = %v, want the loan number pattern and the creator", args)
+	}
+
+	if len(result.Matches) != 2 {
+		t.Fatalf("FindByLoanNumber() = %d matches, want 2", len(result.Matches))
+	}
+	for i, want := range []string{"CIB-2", "CIB-1"} {
+		if got := result.Matches[i].CalculationNumber; got != want {
+			t.Errorf("match %d in %s, want %s", i, got, want)
+		}
+	}
+	if got := result.Matches[1].Contract.Number; got != " ln-100 " {
+		t.Errorf("contract of CIB-1 = %q, want the contract as extracted", got)
+	}
+}
+
+func TestFindByLoanNumberValidate(t *testing.T) {
+	// No statement is expected, the query is rejected before the search.
+	s, _ := newTestService(t)
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	_, err := s.FindByLoanNumber(ctx, &LoanSearchQuery{LoanNumber: "  "})
+	if rpcStatus.Code(err) != codes.InvalidArgument {
+		t.Errorf("FindByLoanNumber() error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestLoanNumberPattern(t *testing.T) {
+	if got, want := loanNumberPattern("LN_1%[2]"), "%LN[_]1[%][[]2]%"; got != want {
+		t.Errorf("loanNumberPattern() = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package cib
+
+import (
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultMaxOverdueDays is the maximum number of overdue days accepted from the CIB file
+// when no other maximum is configured.
+const DefaultMaxOverdueDays = 3650
+
+// clampOverdueDays clamps the overdue days of the contracts to [0, maxOverdueDays],
+// recording the value reported by the CIB file on the contracts it changed.
+func clampOverdueDays(contracts []Contract, maxOverdueDays decimal.Decimal) {
+	for i := range contracts {
+		c := &contracts[i]
+		switch {
+		case c.OverdueInDay.IsNegative():
+			c.OverdueInDayWarning = fmt.Sprintf("overdue days %s is negative, set to 0", c.OverdueInDay)
+			c.OverdueInDay = decimal.Zero
+
+		case c.OverdueInDay.GreaterThan(maxOverdueDays):
+			c.OverdueInDayWarning = fmt.Sprintf("overdue days %s exceeds the maximum, set to %s", c.OverdueInDay, maxOverdueDays)
+			c.OverdueInDay = maxOverdueDays
+		}
+	}
+}
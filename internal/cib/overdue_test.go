@@ -0,0 +1,54 @@
+package cib
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestClampOverdueDays(t *testing.T) {
+	tests := []struct {
+		name        string
+		overdueDays string
+		wantDays    int64
+		wantWarning string
+	}{
+		{name: "within range", overdueDays: "45", wantDays: 45},
+		{name: "at the maximum", overdueDays: "3650", wantDays: 3650},
+		{name: "negative", overdueDays: "-5", wantDays: 0, wantWarning: "overdue days -5 is negative, set to 0"},
+		{name: "absurd", overdueDays: "99999", wantDays: 3650, wantWarning: "overdue days 99999 exceeds the maximum, set to 3650"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contracts := newContracts([]loanHistory{{AccountNumber: "LN-1", Currency: "LAK", NoOfOverdueDays: tt.overdueDays}}, nil, nil, 0)
+			clampOverdueDays(contracts, decimal.NewFromInt(DefaultMaxOverdueDays))
+
+			if got := contracts[0].OverdueInDay; !got.Equal(decimal.NewFromInt(tt.wantDays)) {
+				t.Errorf("overdue days = %s, want %d", got, tt.wantDays)
+			}
+			if got := contracts[0].OverdueInDayWarning; got != tt.wantWarning {
+				t.Errorf("overdue days warning = %q, want %q", got, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestSetMaxOverdueDays(t *testing.T) {
+	tests := []struct {
+		days int64
+		want int64
+	}{
+		{days: 720, want: 720},
+		{days: 0, want: DefaultMaxOverdueDays},
+		{days: -1, want: DefaultMaxOverdueDays},
+	}
+
+	for _, tt := range tests {
+		s := new(Service)
+		s.SetMaxOverdueDays(tt.days)
+		if !s.maxOverdueDays.Equal(decimal.NewFromInt(tt.want)) {
+			t.Errorf("SetMaxOverdueDays(%d): max overdue days = %s, want %d", tt.days, s.maxOverdueDays, tt.want)
+		}
+	}
+}
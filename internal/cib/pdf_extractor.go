@@ -71,6 +71,9 @@ type responseExtracted struct {
 		DOB          string        `json:"birth_date"`
 		Histories    []loanHistory `json:"histories"`
 		Actives      []loanActive  `json:"actives"`
+
+		// Confidence is the confidence of the customer fields by field name, if the extractor provides it.
+		Confidence map[string]decimal.Decimal `json:"confidence"`
 	} `json:"extracted_data"`
 }
 
@@ -108,6 +111,7 @@ func mapExtractedData(e *responseExtracted) *CreditBureau {
 		DOB:                 e.Extraction.DOB,
 		Contracts:           e.Extraction.Histories,
 		AggregateByBankCode: as,
+		Confidence:          newFieldConfidences(e.Extraction.Confidence, e.Extraction.Histories),
 	}
 }
 
@@ -125,6 +129,9 @@ type CreditBureau struct {
 	DOB                 string        `json:"dob"`
 	Contracts           []loanHistory `json:"contracts"`
 	AggregateByBankCode []AggregateByBankCode
+
+	// Confidence is the confidence of the extracted fields, nil if the extractor provides none.
+	Confidence []FieldConfidence
 }
 
 type loanActive struct {
@@ -156,4 +163,7 @@ type loanHistory struct {
 	Tenor                string   `json:"tenor"`
 	AccountStatusEng     string   `json:"account_status_eng"`
 	GradeCIBLast12Months []string `json:"grade_cib_last_12months"`
+
+	// Confidence is the confidence of the fields of the contract by field name, if the extractor provides it.
+	Confidence map[string]decimal.Decimal `json:"confidence"`
 }
@@ -0,0 +1,116 @@
+package cib
+
+import (
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// DefaultRiskExcludedBankCodes are the bank codes whose contracts do not count toward the risk flags
+// when no other bank codes are configured, i.e. the contracts of our own institution.
+var DefaultRiskExcludedBankCodes = []string{"KLS_LS"}
+
+// newBankCodeSet returns the set of the given bank codes, in upper case.
+func newBankCodeSet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" {
+			set[code] = true
+		}
+	}
+
+	return set
+}
+
+// gradeRanks ranks the CIB loan classification grades from the best to the worst.
+var gradeRanks = map[string]int{
+	"A": 1,
+	"B": 2,
+	"C": 3,
+	"D": 4,
+	"E": 5,
+}
+
+// gradeRank returns the rank of the grade, or zero if the grade is not known.
+func gradeRank(grade string) int {
+	return gradeRanks[strings.ToUpper(strings.TrimSpace(grade))]
+}
+
+// worstGradeRank returns the rank of the worst grade of the contract,
+// current or within the last 12 months.
+func (c Contract) worstGradeRank() int {
+	worst := gradeRank(c.GradeCIB)
+	for _, g := range c.GradeCIBLast12Months {
+		if r := gradeRank(g); r > worst {
+			worst = r
+		}
+	}
+
+	return worst
+}
+
+// hasRiskFlags reports whether the contract is overdue or has been graded worse than A.
+func (c Contract) hasRiskFlags() bool {
+	return c.OverdueInDay.IsPositive() || c.worstGradeRank() > gradeRanks["A"]
+}
+
+// riskFilter reports whether the query filters the calculations by risk.
+func (q *BatchGetCalculationsQuery) riskFilter() bool {
+	return q.HasRiskFlags || q.MinOverdueDays > 0 || q.WorstGrade != ""
+}
+
+// meetsRiskCriteria reports whether the calculation meets every risk criterion of the query.
+// Each criterion is met when at least one of the contracts meets it.
+func (q *BatchGetCalculationsQuery) meetsRiskCriteria(c *Calculation) bool {
+	if q.HasRiskFlags && !q.anyRiskContract(c, Contract.hasRiskFlags) {
+		return false
+	}
+
+	if q.MinOverdueDays > 0 {
+		min := decimal.NewFromInt(q.MinOverdueDays)
+		if !q.anyRiskContract(c, func(ct Contract) bool { return ct.OverdueInDay.GreaterThanOrEqual(min) }) {
+			return false
+		}
+	}
+
+	if q.WorstGrade != "" {
+		rank := gradeRank(q.WorstGrade)
+		if !q.anyRiskContract(c, func(ct Contract) bool { return ct.worstGradeRank() >= rank }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterByRisk returns the calculations meeting the risk criteria of the query.
+func (q *BatchGetCalculationsQuery) filterByRisk(calculations []*Calculation) []*Calculation {
+	if !q.riskFilter() {
+		return calculations
+	}
+
+	filtered := make([]*Calculation, 0, len(calculations))
+	for _, c := range calculations {
+		if q.meetsRiskCriteria(c) {
+			filtered = append(filtered, c)
+		}
+	}
+
+	return filtered
+}
+
+// anyRiskContract reports whether a contract of the calculation meets the criterion,
+// skipping the contracts of the bank codes excluded from the risk flags.
+func (q *BatchGetCalculationsQuery) anyRiskContract(c *Calculation, fn func(Contract) bool) bool {
+	for _, ct := range c.Contracts {
+		if q.riskExcludedBankCodes[strings.ToUpper(strings.TrimSpace(ct.BankCode))] {
+			continue
+		}
+		if fn(ct) {
+			return true
+		}
+	}
+
+	return false
+}
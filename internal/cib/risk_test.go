@@ -0,0 +1,151 @@
+package cib
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"slices"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestFilterByRisk(t *testing.T) {
+	calculations := []*Calculation{
+		{Number: "CLEAN", Contracts: []Contract{{BankCode: "BCEL", GradeCIB: "A"}}},
+		{Number: "OVERDUE-10", Contracts: []Contract{{BankCode: "BCEL", GradeCIB: "A", OverdueInDay: decimal.NewFromInt(10)}}},
+		{Number: "OVERDUE-90", Contracts: []Contract{
+			{BankCode: "BCEL", GradeCIB: "A"},
+			{BankCode: "LDB", GradeCIB: "B", OverdueInDay: decimal.NewFromInt(90)},
+		}},
+		{Number: "GRADED-D", Contracts: []Contract{{BankCode: "BCEL", GradeCIB: "A", GradeCIBLast12Months: []string{"A", "D"}}}},
+		// The contracts of our own institution do not count toward the risk flags.
+		{Number: "OWN-OVERDUE", Contracts: []Contract{{BankCode: "kls_ls", GradeCIB: "E", OverdueInDay: decimal.NewFromInt(120)}}},
+	}
+
+	tests := []struct {
+		name  string
+		query BatchGetCalculationsQuery
+		want  []string
+	}{
+		{name: "no risk criteria", want: []string{"CLEAN", "OVERDUE-10", "OVERDUE-90", "GRADED-D", "OWN-OVERDUE"}},
+		{name: "has risk flags", query: BatchGetCalculationsQuery{HasRiskFlags: true}, want: []string{"OVERDUE-10", "OVERDUE-90", "GRADED-D"}},
+		{name: "min overdue days", query: BatchGetCalculationsQuery{MinOverdueDays: 30}, want: []string{"OVERDUE-90"}},
+		{name: "worst grade", query: BatchGetCalculationsQuery{WorstGrade: "c"}, want: []string{"GRADED-D"}},
+		{name: "every criterion", query: BatchGetCalculationsQuery{HasRiskFlags: true, MinOverdueDays: 5, WorstGrade: "B"}, want: []string{"OVERDUE-90"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.riskExcludedBankCodes = newBankCodeSet(DefaultRiskExcludedBankCodes)
+
+			got := make([]string, 0)
+			for _, c := range tt.query.filterByRisk(calculations) {
+				got = append(got, c.Number)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("filterByRisk() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchGetCalculationsQueryValidateRisk(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    BatchGetCalculationsQuery
+		wantCode codes.Code
+	}{
+		{name: "valid", query: BatchGetCalculationsQuery{HasRiskFlags: true, MinOverdueDays: 30, WorstGrade: "c"}},
+		{name: "negative overdue days", query: BatchGetCalculationsQuery{MinOverdueDays: -1}, wantCode: codes.InvalidArgument},
+		{name: "unknown grade", query: BatchGetCalculationsQuery{WorstGrade: "F"}, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpcStatus.Code(tt.query.Validate()); got != tt.wantCode {
+				t.Errorf("Validate() code = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestExportContractsToCSVRiskFilter(t *testing.T) {
+	s, mock := newTestService(t)
+	mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns,
+		batchRow(t, 2, "CIB-2", "Somchai", []Contract{{Number: "LN-1", BankCode: "BCEL", GradeCIB: "A"}}),
+		batchRow(t, 1, "CIB-1", "Keo", []Contract{{Number: "LN-2", BankCode: "BCEL", GradeCIB: "C"}}),
+	)
+	mock.ExpectQuery(`FROM cib_file_analysis`)
+
+	var buf bytes.Buffer
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+	if err := s.ExportContractsToCSV(ctx, &buf, &BatchGetCalculationsQuery{WorstGrade: "B"}); err != nil {
+		t.Fatalf("ExportContractsToCSV() error = %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the csv: %v", err)
+	}
+	// The header and the contract of the only calculation graded at least B.
+	if len(records) != 2 || records[1][0] != "CIB-1" {
+		t.Errorf("records = %v, want the header and the contract of CIB-1", records)
+	}
+}
+
+func TestRiskExcludedBankCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		excluded []string
+		want     []string
+	}{
+		// Only the contract of LDB is overdue, it flags CIB-1 unless LDB is excluded.
+		{name: "default", want: []string{"CIB-1"}},
+		// The configured bank codes replace the default ones.
+		{name: "excluded bank code", excluded: []string{" ldb "}, want: []string{"CIB-2"}},
+		{name: "excluded bank codes", excluded: []string{"LDB", "KLS_LS"}, want: []string{}},
+		{name: "no excluded bank code", excluded: []string{}, want: []string{"CIB-1", "CIB-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			if tt.excluded != nil {
+				s.SetRiskExcludedBankCodes(tt.excluded)
+			}
+			mock.ExpectQuery(`FROM cib_file_analysis`).WillReturnRows(batchColumns,
+				batchRow(t, 2, "CIB-1", "Somchai", []Contract{
+					{Number: "LN-1", BankCode: "BCEL", GradeCIB: "A"},
+					{Number: "LN-2", BankCode: "LDB", GradeCIB: "A", OverdueInDay: decimal.NewFromInt(45)},
+				}),
+				// The internal facility is graded C, flagged only without the default exclusion.
+				batchRow(t, 1, "CIB-2", "Keo", []Contract{{Number: "LN-3", BankCode: "KLS_LS", GradeCIB: "C"}}),
+			)
+			mock.ExpectQuery(`FROM cib_file_analysis`)
+
+			var buf bytes.Buffer
+			ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+			if err := s.ExportContractsToCSV(ctx, &buf, &BatchGetCalculationsQuery{HasRiskFlags: true}); err != nil {
+				t.Fatalf("ExportContractsToCSV() error = %v", err)
+			}
+
+			records, err := csv.NewReader(&buf).ReadAll()
+			if err != nil {
+				t.Fatalf("failed to read the csv: %v", err)
+			}
+			got := make([]string, 0)
+			for _, r := range records[1:] {
+				if !slices.Contains(got, r[0]) {
+					got = append(got, r[0])
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("flagged calculations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package cib
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// ErrNoAmortizationSchedule is returned for the contracts without amortization schedule,
+// i.e. the revolving facilities or the contracts without period.
+var ErrNoAmortizationSchedule = errors.New("contract has no amortization schedule")
+
+// AmortizationPeriod is a period of an amortization schedule, in the contract currency.
+type AmortizationPeriod struct {
+	Period      int64           `json:"period"`
+	Installment decimal.Decimal `json:"installment"`
+	Principal   decimal.Decimal `json:"principal"`
+	Interest    decimal.Decimal `json:"interest"`
+	Balance     decimal.Decimal `json:"balance"` // The balance remaining after the period.
+}
+
+type AmortizationSchedule struct {
+	LoanNumber    string               `json:"loanNumber"`
+	TermType      string               `json:"termType"`
+	Currency      string               `json:"currency"`
+	FinanceAmount decimal.Decimal      `json:"financeAmount"`
+	InterestRate  decimal.Decimal      `json:"interestRate"`
+	Periods       []AmortizationPeriod `json:"periods"`
+}
+
+// buildAmortizationSchedule returns the schedule of the contract from its finance amount, rate and period,
+// the installments being the ones of calculateInstallment.
+// The CL contracts pay the same principal and a flat interest on the finance amount each period,
+// the L and PL contracts pay the PMT installment with the interest on the reducing balance.
+// The amounts are rounded to 2 decimal places, the computation is not.
+func buildAmortizationSchedule(c Contract) (*AmortizationSchedule, error) {
+	t := termTypeFromTypeOfTermLoan(c.TermType)
+	periods := c.Period.IntPart()
+	if t == TermTypeOD || periods <= 0 || !c.FinanceAmount.IsPositive() {
+		return nil, ErrNoAmortizationSchedule
+	}
+
+	schedule := &AmortizationSchedule{
+		LoanNumber:    c.Number,
+		TermType:      c.TermType,
+		Currency:      c.Currency,
+		FinanceAmount: c.FinanceAmount,
+		InterestRate:  c.InterestRate,
+		Periods:       make([]AmortizationPeriod, 0, periods),
+	}
+
+	hundred := decimal.NewFromInt(100)
+	balance := c.FinanceAmount
+	for p := int64(1); p <= periods; p++ {
+		var principal, interest decimal.Decimal
+		switch t {
+		case TermTypeCL:
+			principal = c.FinanceAmount.Div(c.Period)
+			interest = c.FinanceAmount.Mul(c.InterestRate.Div(hundred))
+
+		default:
+			monthlyRate := c.InterestRate.Div(hundred).Div(decimal.NewFromInt(12))
+			interest = balance.Mul(monthlyRate)
+			principal = calculatePMT(c.InterestRate, c.Period, c.FinanceAmount).Sub(interest)
+		}
+
+		// The last period settles what the rounding left.
+		if p == periods {
+			principal = balance
+		}
+		balance = balance.Sub(principal)
+
+		schedule.Periods = append(schedule.Periods, AmortizationPeriod{
+			Period:      p,
+			Installment: principal.Add(interest).Round(2),
+			Principal:   principal.Round(2),
+			Interest:    interest.Round(2),
+			Balance:     balance.Round(2),
+		})
+	}
+
+	return schedule, nil
+}
+
+// GetAmortizationSchedule returns the amortization schedule of the contract of the given loan number
+// within the calculation of the given number.
+func (s *Service) GetAmortizationSchedule(ctx context.Context, number, loanNumber string) (*AmortizationSchedule, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetAmortizationSchedule"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+		zap.String("LoanNumber", loanNumber),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	loanNumber = strings.TrimSpace(loanNumber)
+	for _, c := range calculation.Contracts {
+		if strings.TrimSpace(c.Number) != loanNumber {
+			continue
+		}
+
+		schedule, err := buildAmortizationSchedule(c)
+		if errors.Is(err, ErrNoAmortizationSchedule) {
+			return nil, rpcStatus.Error(codes.FailedPrecondition, "This contract has no amortization schedule, it is a revolving facility or has no period.")
+		}
+
+		return schedule, err
+	}
+
+	return nil, rpcStatus.Error(codes.NotFound, "Contract not found in the calculation")
+}
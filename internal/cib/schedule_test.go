@@ -0,0 +1,120 @@
+package cib
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestBuildAmortizationSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		termType string
+		rate     int64
+		periods  int64
+	}{
+		{name: "flat CL", termType: "CL", rate: 1, periods: 24},
+		{name: "reducing L", termType: "L", rate: 12, periods: 36},
+		{name: "reducing PL", termType: " pl ", rate: 18, periods: 7},
+		{name: "reducing L without interest", termType: "L", periods: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Contract{
+				Number:        "LN-1",
+				TermType:      tt.termType,
+				Currency:      "LAK",
+				FinanceAmount: decimal.NewFromInt(10000000),
+				InterestRate:  decimal.NewFromInt(tt.rate),
+				Period:        decimal.NewFromInt(tt.periods),
+			}
+
+			schedule, err := buildAmortizationSchedule(c)
+			if err != nil {
+				t.Fatalf("buildAmortizationSchedule() error = %v", err)
+			}
+			if int64(len(schedule.Periods)) != tt.periods {
+				t.Fatalf("got %d periods, want %d", len(schedule.Periods), tt.periods)
+			}
+
+			last := schedule.Periods[len(schedule.Periods)-1]
+			if !last.Balance.IsZero() {
+				t.Errorf("final balance = %s, want 0", last.Balance)
+			}
+
+			// The last period only settles the rounding, its installment is the regular one.
+			regular := schedule.Periods[0].Installment
+			if diff := last.Installment.Sub(regular).Abs(); diff.GreaterThan(decimal.NewFromInt(1)) {
+				t.Errorf("last installment = %s, want about the regular installment %s", last.Installment, regular)
+			}
+
+			principal := decimal.Zero
+			for i, p := range schedule.Periods {
+				principal = principal.Add(p.Principal)
+				if i > 0 && p.Balance.GreaterThan(schedule.Periods[i-1].Balance) {
+					t.Errorf("balance of period %d = %s, want it below %s", p.Period, p.Balance, schedule.Periods[i-1].Balance)
+				}
+			}
+			if diff := principal.Sub(c.FinanceAmount).Abs(); diff.GreaterThan(decimal.NewFromInt(1)) {
+				t.Errorf("total principal = %s, want the finance amount %s", principal, c.FinanceAmount)
+			}
+		})
+	}
+}
+
+func TestBuildAmortizationScheduleInterest(t *testing.T) {
+	contract := func(termType string) Contract {
+		return Contract{
+			TermType:      termType,
+			FinanceAmount: decimal.NewFromInt(12000000),
+			InterestRate:  decimal.NewFromInt(1),
+			Period:        decimal.NewFromInt(12),
+		}
+	}
+
+	// The flat interest is on the finance amount every period.
+	flat, err := buildAmortizationSchedule(contract("CL"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range flat.Periods {
+		if !p.Interest.Equal(decimal.NewFromInt(120000)) || !p.Principal.Equal(decimal.NewFromInt(1000000)) {
+			t.Errorf("flat period %d = principal %s interest %s, want 1000000 and 120000", p.Period, p.Principal, p.Interest)
+		}
+	}
+
+	// The reducing interest is on the balance, so it decreases every period.
+	reducing, err := buildAmortizationSchedule(contract("L"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reducing.Periods[0].Interest.Equal(decimal.NewFromInt(10000)) {
+		t.Errorf("first reducing interest = %s, want 10000", reducing.Periods[0].Interest)
+	}
+	for i := 1; i < len(reducing.Periods); i++ {
+		if !reducing.Periods[i].Interest.LessThan(reducing.Periods[i-1].Interest) {
+			t.Errorf("reducing interest of period %d = %s, want it below %s", i+1, reducing.Periods[i].Interest, reducing.Periods[i-1].Interest)
+		}
+	}
+}
+
+func TestBuildAmortizationScheduleWithoutSchedule(t *testing.T) {
+	tests := []struct {
+		name string
+		c    Contract
+	}{
+		{name: "overdraft", c: Contract{TermType: "OD", FinanceAmount: decimal.NewFromInt(1000), InterestRate: decimal.NewFromInt(1), Period: decimal.NewFromInt(12)}},
+		{name: "no period", c: Contract{TermType: "L", FinanceAmount: decimal.NewFromInt(1000), InterestRate: decimal.NewFromInt(1)}},
+		{name: "no finance amount", c: Contract{TermType: "CL", InterestRate: decimal.NewFromInt(1), Period: decimal.NewFromInt(12)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := buildAmortizationSchedule(tt.c); !errors.Is(err, ErrNoAmortizationSchedule) {
+				t.Errorf("buildAmortizationSchedule() error = %v, want ErrNoAmortizationSchedule", err)
+			}
+		})
+	}
+}
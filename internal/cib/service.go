@@ -10,14 +10,18 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/10664kls/automatic-finance-api/internal/auth"
 	"github.com/10664kls/automatic-finance-api/internal/currency"
 	"github.com/10664kls/automatic-finance-api/internal/pager"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
 	"go.uber.org/zap"
 	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
@@ -25,11 +29,30 @@ import (
 )
 
 type Service struct {
-	pdfExtractorURL string
-	db              *sql.DB
-	mu              *sync.Mutex
-	currency        *currency.Service
-	zlog            *zap.Logger
+	pdfExtractorURL   string
+	db                *sql.DB
+	mu                *sync.Mutex
+	currency          *currency.Service
+	zlog              *zap.Logger
+	installmentFloors map[termType]decimal.Decimal
+
+	// minFinanceAmount is the finance amount in the base currency below which active contracts are negligible.
+	minFinanceAmount decimal.Decimal
+
+	// installmentPlaces is the number of decimal places the installments in the base currency are rounded to.
+	installmentPlaces int32
+
+	// maxOverdueDays is the maximum number of overdue days accepted from the CIB file.
+	maxOverdueDays decimal.Decimal
+
+	// riskExcludedBankCodes are the bank codes whose contracts do not count toward the risk flags.
+	riskExcludedBankCodes map[string]bool
+
+	// fileRetention is how long the CIB files no longer referenced by any calculation are kept.
+	fileRetention time.Duration
+
+	// settings are the settings adjustable at runtime, see SetSettings.
+	settings *settings.Service
 }
 
 func NewService(_ context.Context, db *sql.DB, currency *currency.Service, zlog *zap.Logger, pdfExtractorURL string) (*Service, error) {
@@ -47,14 +70,96 @@ func NewService(_ context.Context, db *sql.DB, currency *currency.Service, zlog
 	}
 
 	return &Service{
-		db:              db,
-		currency:        currency,
-		pdfExtractorURL: pdfExtractorURL,
-		mu:              new(sync.Mutex),
-		zlog:            zlog,
+		db:                db,
+		currency:          currency,
+		pdfExtractorURL:   pdfExtractorURL,
+		mu:                new(sync.Mutex),
+		zlog:              zlog,
+		installmentFloors: make(map[termType]decimal.Decimal),
+		minFinanceAmount:  decimal.Zero,
+		maxOverdueDays:    decimal.NewFromInt(DefaultMaxOverdueDays),
+
+		riskExcludedBankCodes: newBankCodeSet(DefaultRiskExcludedBankCodes),
+		fileRetention:         DefaultFileRetention,
 	}, nil
 }
 
+// SetInstallmentFloor sets the minimum monthly installment in the base currency for
+// the revolving facilities of the given term type, one of OD, CC or RL.
+// A zero floor disables it.
+func (s *Service) SetInstallmentFloor(name string, floorInLAK decimal.Decimal) error {
+	t := termTypeValues[name]
+	switch t {
+	case TermTypeOD, TermTypeCC, TermTypeRL:
+	default:
+		return fmt.Errorf("installment floor is not supported for term type %q", name)
+	}
+	if floorInLAK.IsNegative() {
+		return errors.New("installment floor must not be negative")
+	}
+
+	s.installmentFloors[t] = floorInLAK
+	return nil
+}
+
+// SetMinFinanceAmount sets the finance amount in the base currency below which active contracts
+// are flagged as negligible and excluded from the total installment.
+// A zero amount, the default, excludes no contract.
+func (s *Service) SetMinFinanceAmount(amountInLAK decimal.Decimal) error {
+	if amountInLAK.IsNegative() {
+		return errors.New("minimum finance amount must not be negative")
+	}
+
+	s.minFinanceAmount = amountInLAK
+	return nil
+}
+
+// SetInstallmentRoundingPlaces sets the number of decimal places the installments converted
+// to the base currency are rounded to. The default, zero, rounds to the whole LAK.
+func (s *Service) SetInstallmentRoundingPlaces(places int32) error {
+	if places < 0 {
+		return errors.New("installment rounding places must not be negative")
+	}
+
+	s.installmentPlaces = places
+	return nil
+}
+
+// SetMaxOverdueDays sets the maximum number of overdue days accepted from the CIB file,
+// greater values are clamped to it and flagged on the contract.
+// A value less than or equal to zero resets it to DefaultMaxOverdueDays.
+func (s *Service) SetMaxOverdueDays(days int64) {
+	if days <= 0 {
+		days = DefaultMaxOverdueDays
+	}
+	s.maxOverdueDays = decimal.NewFromInt(days)
+}
+
+// SetRiskExcludedBankCodes sets the bank codes whose contracts do not count toward the risk flags,
+// e.g. the internal facilities of our own institution. Nil or empty excludes no bank code.
+func (s *Service) SetRiskExcludedBankCodes(codes []string) {
+	s.riskExcludedBankCodes = newBankCodeSet(codes)
+}
+
+// SetSettings sets the settings service the calculations read the minimum finance amount
+// and the installment rounding places from. Nil uses the ones configured on this service.
+func (s *Service) SetSettings(svc *settings.Service) {
+	s.settings = svc
+}
+
+// calculationSettings returns the settings in effect, the ones configured on this service
+// when no settings service is set.
+func (s *Service) calculationSettings(ctx context.Context) (settings.Settings, error) {
+	if s.settings == nil {
+		return settings.Settings{
+			CIBMinFinanceAmount:  s.minFinanceAmount,
+			CIBInstallmentPlaces: s.installmentPlaces,
+		}, nil
+	}
+
+	return s.settings.Current(ctx)
+}
+
 type CIBFileReq struct {
 	OriginalName string
 	ReadSeeker   io.ReadSeeker
@@ -201,7 +306,37 @@ func (s *Service) CalculateCIB(ctx context.Context, in *CalculateReq) (*Calculat
 		return nil, err
 	}
 
-	calculation := newCalculationFromCIBInfo(claims.Username, in.Number, cibFile.Name, extraction, currencies.Currencies)
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	rates := s.exchangeRates(currencies.Currencies)
+	if !in.RatesAt.IsZero() {
+		pinned, err := s.currency.RatesAt(ctx, in.RatesAt)
+		if err != nil {
+			zlog.Error("failed to get exchange rates", zap.Error(err))
+			return nil, err
+		}
+
+		if missing := missingPinnedRates(extraction.Contracts, rates, pinned); len(missing) > 0 {
+			return nil, rpcStatus.Errorf(
+				codes.FailedPrecondition,
+				"The currencies %s have no exchange rate at %s. Please choose a later time.",
+				strings.Join(missing, ", "),
+				in.RatesAt.Format(time.RFC3339),
+			)
+		}
+		rates = pinned
+	}
+
+	calculation := newCalculationFromCIBInfo(claims.Username, in.Number, cibFile.Name, extraction, rates, s.installmentFloors, cfg.CIBMinFinanceAmount, cfg.CIBInstallmentPlaces, s.maxOverdueDays)
+	calculation.confidence = extraction.Confidence
+	calculation.BaseCurrency = s.currency.BaseCurrency()
+	if numbers := unspecifiedStatusContracts(calculation.Contracts); len(numbers) > 0 {
+		zlog.Warn("contracts with an unmapped status, set their status manually", zap.Strings("loanNumbers", numbers))
+	}
 	if err := saveCalculation(ctx, s.db, calculation); err != nil {
 		zlog.Error("failed to create calculation", zap.Error(err))
 		return nil, err
@@ -210,6 +345,50 @@ func (s *Service) CalculateCIB(ctx context.Context, in *CalculateReq) (*Calculat
 	return calculation, nil
 }
 
+func (s *Service) RefreshExchangeRates(ctx context.Context, number string) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "RefreshExchangeRates"),
+		zap.String("Username", claims.Username),
+		zap.String("number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.ChangeableCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	currencies, err := s.currency.ListCurrencies(ctx, &currency.Query{
+		PageSize: 200,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	calculation.RefreshExchangeRates(claims.Username, s.exchangeRates(currencies.Currencies), s.installmentFloors, cfg.CIBMinFinanceAmount, cfg.CIBInstallmentPlaces)
+	calculation.BaseCurrency = s.currency.BaseCurrency()
+	if err := saveCalculation(ctx, s.db, calculation); err != nil {
+		zlog.Error("failed to save calculation", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
 func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*Calculation, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -220,10 +399,11 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
@@ -233,6 +413,32 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	return calculation, nil
 }
 
+// GetCalculationByID returns the calculation of the given internal ID,
+// e.g. as referenced by the audit log.
+func (s *Service) GetCalculationByID(ctx context.Context, id int64) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetCalculationByID"),
+		zap.String("Username", claims.Username),
+		zap.Int64("ID", id),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		ID:        id,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by id", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
 type ListCalculationsResult struct {
 	Calculations  []*Calculation `json:"calculations"`
 	NextPageToken string         `json:"nextPageToken"`
@@ -247,6 +453,12 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 		zap.Any("req", in),
 	)
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
+	in.createdBy = claims.VisibleCreator()
 	calculations, err := listCalculations(ctx, s.db, in)
 	if err != nil {
 		zlog.Error("failed to list calculations", zap.Error(err))
@@ -257,8 +469,9 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 	if l := len(calculations); l > 0 && l == int(pager.Size(in.PageSize)) {
 		last := calculations[l-1]
 		pageToken = pager.EncodeCursor(&pager.Cursor{
-			ID:   strconv.FormatInt(last.ID, 10),
-			Time: last.CreatedAt,
+			ID:    strconv.FormatInt(last.ID, 10),
+			Time:  last.CreatedAt,
+			Value: last.orderValue(order),
 		})
 	}
 
@@ -272,7 +485,11 @@ func (s *Service) SignedURL(ctx context.Context, in *CIBFile) string {
 	return fmt.Sprintf("%s/v1/files/%s?signature=%s", os.Getenv("BACKEND_URL"), in.Name, signedURL(in))
 }
 
-func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
+// ExportCalculationsToExcel returns the workbook of the calculations matching the query,
+// including its risk criteria.
+// The caller must close the returned file once it has been written.
+// An export reading Limit calculations returns the next ID to resume it from, zero once it is complete.
+func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*excelize.File, int64, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	zlog := s.zlog.With(
 		zap.String("Method", "ExportCalculationsToExcel"),
@@ -280,13 +497,19 @@ func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		zap.Any("req", in),
 	)
 
-	byt, err := s.exportCalculationsToExcel(ctx, in)
+	if err := in.Validate(); err != nil {
+		return nil, 0, err
+	}
+
+	in.createdBy = claims.VisibleCreator()
+	in.riskExcludedBankCodes = s.riskExcludedBankCodes
+	f, nextID, err := s.exportCalculationsToExcel(ctx, in)
 	if err != nil {
 		zlog.Error("failed to export calculations to excel", zap.Error(err))
-		return nil, err
+		return nil, 0, err
 	}
 
-	return byt, nil
+	return f, nextID, nil
 }
 
 func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number string) (*bytes.Buffer, error) {
@@ -298,10 +521,11 @@ func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number s
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
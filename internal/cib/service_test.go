@@ -0,0 +1,107 @@
+package cib
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// calculationColumns are the columns selected by listCalculations.
+var calculationColumns = []string{
+	"id", "number", "cib_file_name", "customer_display_name", "customer_phone_number", "customer_dob",
+	"total_loan", "total_closed_loan", "total_active_loan", "total_installment_lak", "base_currency",
+	"aggregate_by_bank", "contract_info", "created_by", "created_at", "updated_by", "updated_at",
+}
+
+func TestGetCalculationByNumberVisibility(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	// The calculation CIB-1 was created by user@example.com.
+	tests := []struct {
+		name          string
+		claims        *auth.Claims
+		wantCreatedBy string
+		wantCode      codes.Code
+	}{
+		{name: "owner", claims: &auth.Claims{Username: "user@example.com", Role: auth.RoleUser}, wantCreatedBy: "user@example.com"},
+		{name: "admin", claims: &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true}},
+		{name: "unrelated user", claims: &auth.Claims{Username: "other@example.com", Role: auth.RoleUser}, wantCreatedBy: "other@example.com", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			get := mock.ExpectQuery(`FROM cib_file_analysis`)
+			if tt.wantCode == codes.OK {
+				get.WillReturnRows(calculationColumns, []any{
+					1, "CIB-1", "cib.pdf", "Somchai", "020000000", "1990-01-01",
+					"0", "0", "0", "0", "LAK",
+					[]byte(`[]`), []byte(`[]`), "user@example.com", now, "user@example.com", now,
+				})
+			}
+
+			_, err := s.GetCalculationByNumber(auth.ContextWithClaims(context.Background(), tt.claims), "CIB-1")
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByNumber() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if got := createdByArg(get.Args()); got != tt.wantCreatedBy {
+				t.Errorf("created by filter = %q, want %q", got, tt.wantCreatedBy)
+			}
+		})
+	}
+}
+
+// createdByArg returns the argument of the query that is a user, or an empty string if none is.
+func createdByArg(args []any) string {
+	for _, a := range args {
+		if s, ok := a.(string); ok && strings.Contains(s, "@") {
+			return s
+		}
+	}
+	return ""
+}
+
+func TestGetCalculationByID(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		found    bool
+		wantCode codes.Code
+	}{
+		{name: "found", found: true, wantCode: codes.OK},
+		{name: "not found", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			get := mock.ExpectQuery(`FROM cib_file_analysis`)
+			if tt.found {
+				get.WillReturnRows(calculationColumns, []any{
+					1, "CIB-1", "cib.pdf", "Somchai", "020000000", "1990-01-01",
+					"0", "0", "0", "0", "LAK",
+					[]byte(`[]`), []byte(`[]`), "user@example.com", now, "user@example.com", now,
+				})
+			}
+
+			ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+			calculation, err := s.GetCalculationByID(ctx, 1)
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByID() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if !slices.Contains(get.Args(), any(int64(1))) {
+				t.Errorf("query arguments = %v, want the ID 1", get.Args())
+			}
+			if err == nil && (calculation.ID != 1 || calculation.Number != "CIB-1") {
+				t.Errorf("calculation %d %s, want 1 CIB-1", calculation.ID, calculation.Number)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package currency
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultCacheTTL is how long the currencies read by code are cached before they are read
+// from the database again, so that the changes made through another instance are picked up.
+const DefaultCacheTTL = time.Minute
+
+type cachedCurrency struct {
+	currency  Currency
+	expiresAt time.Time
+}
+
+// SetCacheTTL sets how long the currencies read by code are cached.
+// A value less than or equal to zero resets it to DefaultCacheTTL.
+func (s *Service) SetCacheTTL(d time.Duration) {
+	if d <= 0 {
+		d = DefaultCacheTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cacheTTL = d
+}
+
+// cachedByCode returns a copy of the cached currency of the given code while it has not expired.
+func (s *Service) cachedByCode(code string) (*Currency, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.cache[strings.ToUpper(code)]
+	if !ok || !time.Now().Before(c.expiresAt) {
+		return nil, false
+	}
+
+	currency := c.currency
+	return &currency, true
+}
+
+// cacheGeneration returns the generation of the cache, which invalidate increments.
+// It is read before reading a currency from the database, see cacheByCode.
+func (s *Service) cacheGeneration() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.generation
+}
+
+// cacheByCode caches a copy of the currency under its code, unless the cache was invalidated
+// since the given generation, as the currency may have been read before the change.
+func (s *Service) cacheByCode(generation uint64, currency *Currency) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if generation != s.generation {
+		return
+	}
+
+	s.cache[strings.ToUpper(currency.Code)] = cachedCurrency{
+		currency:  *currency,
+		expiresAt: time.Now().Add(s.cacheTTL),
+	}
+}
+
+// invalidate drops the cached currencies, so the next reads load them from the database.
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	clear(s.cache)
+	s.generation++
+}
@@ -0,0 +1,127 @@
+package currency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// currencyColumns are the columns selected by listCurrencies.
+var currencyColumns = []string{"id", "code", "exchange_rate", "created_by", "updated_by", "created_at", "updated_at"}
+
+func currencyRow(code, rate string) []any {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	return []any{"currency0001", code, rate, "admin@example.com", "admin@example.com", now, now}
+}
+
+func newTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	db, mock := dbtest.New(t)
+	s, err := NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+func contextWithAdmin() context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{
+		Username: "admin@example.com",
+		Role:     auth.RoleAdmin,
+		IsAdmin:  true,
+	})
+}
+
+func getRate(t *testing.T, s *Service, code string) string {
+	t.Helper()
+
+	currency, err := s.GetCurrencyByCode(contextWithAdmin(), code)
+	if err != nil {
+		t.Fatalf("GetCurrencyByCode() error = %v", err)
+	}
+
+	return currency.ExchangeRate.String()
+}
+
+func TestGetCurrencyByCodeCacheHit(t *testing.T) {
+	s, mock := newTestService(t)
+	// The currency is read from the database once.
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+
+	for range 3 {
+		if got := getRate(t, s, "usd"); got != "21500" {
+			t.Errorf("exchange rate = %s, want 21500", got)
+		}
+	}
+}
+
+func TestGetCurrencyByCodeCacheExpiry(t *testing.T) {
+	s, mock := newTestService(t)
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "21600"))
+
+	if got := getRate(t, s, "USD"); got != "21500" {
+		t.Fatalf("exchange rate = %s, want 21500", got)
+	}
+
+	// Expire the cached currency instead of waiting for the TTL.
+	s.mu.Lock()
+	c := s.cache["USD"]
+	c.expiresAt = time.Now().Add(-time.Second)
+	s.cache["USD"] = c
+	s.mu.Unlock()
+
+	if got := getRate(t, s, "USD"); got != "21600" {
+		t.Errorf("exchange rate after expiry = %s, want 21600", got)
+	}
+}
+
+func TestGetCurrencyByCodeCacheInvalidatedOnUpdate(t *testing.T) {
+	s, mock := newTestService(t)
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+
+	if got := getRate(t, s, "USD"); got != "21500" {
+		t.Fatalf("exchange rate = %s, want 21500", got)
+	}
+
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+	mock.ExpectQuery(`SELECT TOP 1 id FROM currency`)
+	mock.ExpectExec(`UPDATE currency`)
+	mock.ExpectExec(`INSERT INTO currency_rate_history`)
+
+	_, err := s.UpdateExchangeRate(contextWithAdmin(), &ExchangeRateReq{ID: "currency0001", ExchangeRate: decimal.NewFromInt(22000)})
+	if err != nil {
+		t.Fatalf("UpdateExchangeRate() error = %v", err)
+	}
+
+	// The update is reflected immediately, without waiting for the TTL.
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(currencyColumns, currencyRow("USD", "22000"))
+	if got := getRate(t, s, "USD"); got != "22000" {
+		t.Errorf("exchange rate after update = %s, want 22000", got)
+	}
+}
+
+func TestCacheByCodeSkipsCurrencyReadBeforeInvalidation(t *testing.T) {
+	s, _ := newTestService(t)
+
+	// A read started before an update must not cache the rate it read before the update.
+	generation := s.cacheGeneration()
+	s.invalidate()
+	s.cacheByCode(generation, &Currency{Code: "USD", ExchangeRate: decimal.NewFromInt(21500)})
+
+	if _, ok := s.cachedByCode("USD"); ok {
+		t.Error("cachedByCode() found the currency read before the invalidation")
+	}
+
+	s.cacheByCode(s.cacheGeneration(), &Currency{Code: "USD", ExchangeRate: decimal.NewFromInt(22000)})
+	if c, ok := s.cachedByCode("USD"); !ok || !c.ExchangeRate.Equal(decimal.NewFromInt(22000)) {
+		t.Errorf("cachedByCode() = %v, %v, want the currency read after the invalidation", c, ok)
+	}
+}
@@ -0,0 +1,299 @@
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/gen"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/biter777/countries"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// maxImportRates is the maximum number of rows accepted by ImportRates.
+const maxImportRates = 250
+
+// ImportOutcome is what happened to a row of an import of exchange rates.
+type ImportOutcome string
+
+const (
+	ImportOutcomeCreated ImportOutcome = "CREATED"
+	ImportOutcomeUpdated ImportOutcome = "UPDATED"
+	ImportOutcomeFailed  ImportOutcome = "FAILED"
+)
+
+// ImportRateResult is the result of a row of an import of exchange rates.
+// The Row is the line of the row in the CSV.
+type ImportRateResult struct {
+	Row          int             `json:"row"`
+	Code         string          `json:"code"`
+	ExchangeRate decimal.Decimal `json:"exchangeRate"`
+	Outcome      ImportOutcome   `json:"outcome"`
+	Reason       string          `json:"reason,omitempty"`
+}
+
+type ImportRatesResult struct {
+	Results []*ImportRateResult `json:"results"`
+	Created int                 `json:"created"`
+	Updated int                 `json:"updated"`
+	Failed  int                 `json:"failed"`
+}
+
+// ImportRates creates or updates the currencies of a CSV of code,exchangeRate rows in one transaction.
+// A header row is skipped. The rows that are not valid are reported as failed and the others are still imported.
+func (s *Service) ImportRates(ctx context.Context, r io.Reader) (*ImportRatesResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ImportRates"),
+		zap.String("Username", claims.Username),
+	)
+
+	results, err := parseImportRates(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := importCurrencies(ctx, s.db, claims.Username, results, time.Now()); err != nil {
+		zlog.Error("failed to import currencies", zap.Error(err))
+		return nil, err
+	}
+
+	result := &ImportRatesResult{
+		Results: results,
+	}
+	for _, row := range results {
+		switch row.Outcome {
+		case ImportOutcomeCreated:
+			result.Created++
+		case ImportOutcomeUpdated:
+			result.Updated++
+		case ImportOutcomeFailed:
+			result.Failed++
+		}
+	}
+	s.invalidate()
+
+	return result, nil
+}
+
+// parseImportRates parses the rows of a CSV of code,exchangeRate.
+// The rows that are not valid are returned as failed with the reason.
+func parseImportRates(r io.Reader) ([]*ImportRateResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	results := make([]*ImportRateResult, 0)
+	seen := make(map[string]bool)
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, badImportFile(fmt.Sprintf("File is not a valid CSV: %s", err))
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(results) == 0 && isImportHeader(record) {
+			continue
+		}
+
+		row := &ImportRateResult{
+			Row:          line,
+			ExchangeRate: decimal.Zero,
+		}
+		results = append(results, row)
+		if len(results) > maxImportRates {
+			return nil, badImportFile(fmt.Sprintf("File must not contain more than %d rows", maxImportRates))
+		}
+
+		if len(record) != 2 {
+			row.Outcome = ImportOutcomeFailed
+			row.Reason = "Row must have a code and an exchange rate"
+			continue
+		}
+
+		row.Code = strings.ToUpper(strings.TrimSpace(record[0]))
+		row.Reason = importRateViolation(row, strings.TrimSpace(record[1]), seen)
+		if row.Reason != "" {
+			row.Outcome = ImportOutcomeFailed
+		}
+		seen[row.Code] = true
+	}
+
+	if len(results) == 0 {
+		return nil, badImportFile("File must not be empty")
+	}
+
+	return results, nil
+}
+
+// importRateViolation sets the exchange rate of the row and returns why the row is not valid, if it is not.
+func importRateViolation(row *ImportRateResult, rate string, seen map[string]bool) string {
+	if row.Code == "" {
+		return "Code must not be empty"
+	}
+	if !countries.CurrencyCodeByName(row.Code).IsValid() {
+		return "Code is not valid. The code must be a valid ISO 4217 currency code"
+	}
+	if seen[row.Code] {
+		return "Code must not be duplicated"
+	}
+
+	if rate == "" {
+		return "Exchange rate must not be empty"
+	}
+	exchangeRate, err := decimal.NewFromString(rate)
+	if err != nil {
+		return "Exchange rate must be a number"
+	}
+	if !exchangeRate.IsPositive() {
+		return "Exchange rate must be greater than zero"
+	}
+
+	row.ExchangeRate = exchangeRate
+	return ""
+}
+
+func isImportHeader(record []string) bool {
+	return len(record) > 0 && strings.EqualFold(strings.TrimSpace(record[0]), "code")
+}
+
+func badImportFile(description string) error {
+	s, _ := rpcStatus.New(
+		codes.InvalidArgument,
+		"Exchange rates file is not valid. Please check the errors and try again, see details for more information.",
+	).WithDetails(&edPb.BadRequest{
+		FieldViolations: []*edPb.BadRequest_FieldViolation{
+			{
+				Field:       "file",
+				Description: description,
+			},
+		},
+	})
+
+	return s.Err()
+}
+
+// importCurrencies creates or updates the currencies of the valid rows and their rate history in one transaction,
+// setting the outcome of each row. The existing currencies are looked up in the transaction,
+// so a currency created meanwhile is updated instead of failing the import on its unique code.
+func importCurrencies(ctx context.Context, db *sql.DB, by string, rows []*ImportRateResult, now time.Time) error {
+	codes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Outcome != ImportOutcomeFailed {
+			codes = append(codes, row.Code)
+		}
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+
+	defer database.TimeQuery("currency.importCurrencies")()
+
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		byCode, err := lockCurrenciesByCode(ctx, tx, codes)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			if row.Outcome == ImportOutcomeFailed {
+				continue
+			}
+
+			if c, ok := byCode[row.Code]; ok {
+				c.updatedBy = by
+				c.ExchangeRate = row.ExchangeRate
+				c.UpdatedAt = now
+				if err := saveCurrency(ctx, tx, c); err != nil {
+					return err
+				}
+
+				row.Outcome = ImportOutcomeUpdated
+				continue
+			}
+
+			c := &Currency{
+				createdBy:    by,
+				updatedBy:    by,
+				ID:           gen.ID(),
+				Code:         row.Code,
+				ExchangeRate: row.ExchangeRate,
+				CreatedAt:    now,
+				UpdatedAt:    now,
+			}
+			if err := insertCurrency(ctx, tx, c); err != nil {
+				return err
+			}
+
+			row.Outcome = ImportOutcomeCreated
+		}
+
+		return nil
+	})
+}
+
+// lockCurrenciesByCode returns the currencies of the given codes by code.
+// The lock is held until the end of the transaction, so the currencies of these codes
+// cannot be created or changed meanwhile.
+func lockCurrenciesByCode(ctx context.Context, tx *sql.Tx, codes []string) (map[string]*Currency, error) {
+	q, args := sq.
+		Select(
+			"id",
+			"code",
+			"exchange_rate",
+			"created_by",
+			"updated_by",
+			"created_at",
+			"updated_at",
+		).
+		From(`currency WITH (UPDLOCK, HOLDLOCK)`).
+		Where(sq.Eq{"code": codes}).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := tx.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query for locking currencies: %w", err)
+	}
+	defer rows.Close()
+
+	currencies := make(map[string]*Currency, len(codes))
+	for rows.Next() {
+		var c Currency
+		err := rows.Scan(
+			&c.ID,
+			&c.Code,
+			&c.ExchangeRate,
+			&c.createdBy,
+			&c.updatedBy,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+
+		currencies[c.Code] = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return currencies, nil
+}
@@ -0,0 +1,189 @@
+package currency
+
+import (
+	"strings"
+	"testing"
+
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// importViolation returns the description of the first field violation of the error.
+func importViolation(err error) string {
+	for _, d := range rpcStatus.Convert(err).Details() {
+		if br, ok := d.(*edPb.BadRequest); ok && len(br.FieldViolations) > 0 {
+			return br.FieldViolations[0].Description
+		}
+	}
+	return ""
+}
+
+func TestParseImportRates(t *testing.T) {
+	type row struct {
+		line   int
+		code   string
+		rate   string
+		reason string
+	}
+
+	tests := []struct {
+		name string
+		csv  string
+		want []row
+	}{
+		{
+			name: "header",
+			csv:  "Code,exchangeRate\nusd,21500\n THB , 600.5\n",
+			want: []row{{line: 2, code: "USD", rate: "21500"}, {line: 3, code: "THB", rate: "600.5"}},
+		},
+		{
+			name: "no header",
+			csv:  "USD,21500\n",
+			want: []row{{line: 1, code: "USD", rate: "21500"}},
+		},
+		{
+			name: "header only as the first row",
+			csv:  "USD,21500\ncode,1\n",
+			want: []row{{line: 1, code: "USD", rate: "21500"}, {line: 2, code: "CODE", rate: "0", reason: "Code is not valid. The code must be a valid ISO 4217 currency code"}},
+		},
+		{
+			name: "invalid code",
+			csv:  "XYZ,100\n,100\n",
+			want: []row{
+				{line: 1, code: "XYZ", rate: "0", reason: "Code is not valid. The code must be a valid ISO 4217 currency code"},
+				{line: 2, code: "", rate: "0", reason: "Code must not be empty"},
+			},
+		},
+		{
+			name: "invalid rate",
+			csv:  "USD,0\nTHB,-600\nEUR,abc\nJPY,\n",
+			want: []row{
+				{line: 1, code: "USD", rate: "0", reason: "Exchange rate must be greater than zero"},
+				{line: 2, code: "THB", rate: "0", reason: "Exchange rate must be greater than zero"},
+				{line: 3, code: "EUR", rate: "0", reason: "Exchange rate must be a number"},
+				{line: 4, code: "JPY", rate: "0", reason: "Exchange rate must not be empty"},
+			},
+		},
+		{
+			name: "duplicated code",
+			csv:  "USD,21500\nusd,21600\n",
+			want: []row{{line: 1, code: "USD", rate: "21500"}, {line: 2, code: "USD", rate: "0", reason: "Code must not be duplicated"}},
+		},
+		{
+			name: "wrong number of fields",
+			csv:  "USD\nTHB,600,extra\n",
+			want: []row{
+				{line: 1, rate: "0", reason: "Row must have a code and an exchange rate"},
+				{line: 2, rate: "0", reason: "Row must have a code and an exchange rate"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := parseImportRates(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatalf("parseImportRates() error = %v", err)
+			}
+			if len(results) != len(tt.want) {
+				t.Fatalf("parseImportRates() = %d rows, want %d", len(results), len(tt.want))
+			}
+			for i, w := range tt.want {
+				r := results[i]
+				failed := r.Outcome == ImportOutcomeFailed
+				if r.Row != w.line || r.Code != w.code || r.ExchangeRate.String() != w.rate || r.Reason != w.reason || failed != (w.reason != "") {
+					t.Errorf("row %d = %d %q %s %s %q, want %d %q %s failed %v %q",
+						i, r.Row, r.Code, r.ExchangeRate, r.Outcome, r.Reason, w.line, w.code, w.rate, w.reason != "", w.reason)
+				}
+			}
+		})
+	}
+}
+
+func TestParseImportRatesNotValidFile(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want string
+	}{
+		{name: "empty", csv: "", want: "File must not be empty"},
+		{name: "header only", csv: "code,exchangeRate\n", want: "File must not be empty"},
+		{name: "too many rows", csv: strings.Repeat("USD,21500\n", maxImportRates+1), want: "File must not contain more than 250 rows"},
+		{name: "not a CSV", csv: "USD,\"21500\n", want: "File is not a valid CSV"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseImportRates(strings.NewReader(tt.csv))
+			if rpcStatus.Code(err) != codes.InvalidArgument {
+				t.Fatalf("parseImportRates() error = %v, want InvalidArgument", err)
+			}
+			if got := importViolation(err); !strings.HasPrefix(got, tt.want) {
+				t.Errorf("violation = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The limit counts the rows, not the header.
+	if _, err := parseImportRates(strings.NewReader("code,exchangeRate\n" + strings.Repeat("USD,21500\n", maxImportRates))); err != nil {
+		t.Errorf("parseImportRates() of %d rows error = %v", maxImportRates, err)
+	}
+}
+
+func TestImportRates(t *testing.T) {
+	s, mock := newTestService(t)
+
+	// The existing currencies are looked up by the valid codes in the transaction,
+	// USD is updated and THB is created.
+	lookup := mock.ExpectQuery(`FROM currency WITH \(UPDLOCK, HOLDLOCK\) WHERE code IN \(@p1,@p2\)`).
+		WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+	update := mock.ExpectExec(`UPDATE currency SET`)
+	mock.ExpectExec(`INSERT INTO currency_rate_history`)
+	insert := mock.ExpectExec(`INSERT INTO currency \(`)
+	mock.ExpectExec(`INSERT INTO currency_rate_history`)
+
+	result, err := s.ImportRates(contextWithAdmin(), strings.NewReader("code,exchangeRate\nUSD,21600\nTHB,600\nXYZ,1\nLAK,0\n"))
+	if err != nil {
+		t.Fatalf("ImportRates() error = %v", err)
+	}
+
+	if args := lookup.Args(); len(args) != 2 || args[0] != "USD" || args[1] != "THB" {
+		t.Errorf("lookup args = %v, want the valid codes", args)
+	}
+	if args := update.Args(); len(args) < 2 || args[0] != "USD" || args[1] != "21600" {
+		t.Errorf("update args = %v, want USD at 21600", args)
+	}
+	if args := insert.Args(); len(args) < 3 || args[1] != "THB" || args[2] != "600" {
+		t.Errorf("insert args = %v, want THB at 600", args)
+	}
+	if got := mock.Commits(); got != 1 {
+		t.Errorf("commits = %d, want 1", got)
+	}
+
+	if result.Created != 1 || result.Updated != 1 || result.Failed != 2 {
+		t.Errorf("created %d, updated %d, failed %d, want 1, 1, 2", result.Created, result.Updated, result.Failed)
+	}
+	want := []ImportOutcome{ImportOutcomeUpdated, ImportOutcomeCreated, ImportOutcomeFailed, ImportOutcomeFailed}
+	for i, r := range result.Results {
+		if r.Outcome != want[i] {
+			t.Errorf("row %d (%s) = %s, want %s", r.Row, r.Code, r.Outcome, want[i])
+		}
+	}
+}
+
+func TestImportRatesAllFailed(t *testing.T) {
+	// No statement is expected, there is no valid row to import.
+	s, mock := newTestService(t)
+
+	result, err := s.ImportRates(contextWithAdmin(), strings.NewReader("XYZ,1\nUSD,abc\n"))
+	if err != nil {
+		t.Fatalf("ImportRates() error = %v", err)
+	}
+	if result.Created != 0 || result.Updated != 0 || result.Failed != 2 {
+		t.Errorf("created %d, updated %d, failed %d, want 0, 0, 2", result.Created, result.Updated, result.Failed)
+	}
+	if got := mock.Commits(); got != 0 {
+		t.Errorf("commits = %d, want 0", got)
+	}
+}
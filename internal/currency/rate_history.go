@@ -0,0 +1,132 @@
+package currency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/shopspring/decimal"
+)
+
+// ErrRateNotFound is returned when a currency has no exchange rate effective at the given time,
+// e.g. the currency was created after it.
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// GetRateAt returns the rate to the base currency of the currency of the given code effective at the given time,
+// so a calculation can be reproduced with the rate of its date. The base currency converts to itself at 1.
+func (s *Service) GetRateAt(ctx context.Context, code string, at time.Time) (decimal.Decimal, error) {
+	if strings.EqualFold(code, s.baseCurrency) {
+		return decimal.NewFromInt(1), nil
+	}
+
+	rates, err := listRatesAt(ctx, s.db, at, code)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	for _, rate := range rates {
+		return rate, nil
+	}
+
+	return decimal.Zero, fmt.Errorf("%w: %s at %s", ErrRateNotFound, code, at.Format(time.RFC3339))
+}
+
+// RatesAt returns the rates to the base currency effective at the given time by currency code.
+// The currencies created after it have no rate. The base currency converts to itself at 1.
+func (s *Service) RatesAt(ctx context.Context, at time.Time) (map[string]decimal.Decimal, error) {
+	rates, err := listRatesAt(ctx, s.db, at, "")
+	if err != nil {
+		return nil, err
+	}
+
+	for code := range rates {
+		if strings.EqualFold(code, s.baseCurrency) {
+			rates[code] = decimal.NewFromInt(1)
+		}
+	}
+
+	return rates, nil
+}
+
+// listRatesAt lists the rates effective at the given time by currency code,
+// of every currency or of the currency of the given code.
+func listRatesAt(ctx context.Context, db *sql.DB, at time.Time, code string) (map[string]decimal.Decimal, error) {
+	defer database.TimeQuery("currency.listRatesAt")()
+
+	and := sq.And{}
+	if code != "" {
+		and = append(and, sq.Eq{"c.code": code})
+	}
+
+	pred, args, err := and.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.
+		Select(
+			"c.code",
+			"h.rate",
+		).
+		From("currency AS c").
+		JoinClause(
+			"CROSS APPLY (SELECT TOP 1 rate FROM currency_rate_history WHERE currency_id = c.id AND effective_at <= ? ORDER BY effective_at DESC) AS h",
+			at,
+		).
+		Where(pred, args...).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query for listing rates: %w", err)
+	}
+	defer rows.Close()
+
+	rates := make(map[string]decimal.Decimal)
+	for rows.Next() {
+		var code string
+		var rate decimal.Decimal
+		if err := rows.Scan(&code, &rate); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		rates[code] = rate
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return rates, nil
+}
+
+// insertRate appends the rate of the currency to its rate history, effective since its last update.
+func insertRate(ctx context.Context, tx *sql.Tx, in *Currency) error {
+	q, args := sq.Insert("currency_rate_history").
+		Columns(
+			"currency_id",
+			"rate",
+			"effective_at",
+			"created_by",
+			"created_at",
+		).
+		Values(
+			in.ID,
+			in.ExchangeRate,
+			in.UpdatedAt,
+			in.updatedBy,
+			in.UpdatedAt,
+		).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("failed to insert rate history: %w", err)
+	}
+
+	return nil
+}
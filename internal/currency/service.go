@@ -5,11 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
 	"github.com/10664kls/automatic-finance-api/internal/gen"
 	"github.com/10664kls/automatic-finance-api/internal/pager"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
 	sq "github.com/Masterminds/squirrel"
 	"github.com/biter777/countries"
 	"github.com/shopspring/decimal"
@@ -22,9 +26,22 @@ import (
 // ErrCurrencyNotFound is returned when a currency is not found in the database.
 var ErrCurrencyNotFound = errors.New("currency not found")
 
+// DefaultBaseCurrency is the currency net incomes and installments are converted to
+// when no other base currency is configured.
+const DefaultBaseCurrency = "LAK"
+
 type Service struct {
-	db   *sql.DB
-	zlog *zap.Logger
+	db           *sql.DB
+	zlog         *zap.Logger
+	baseCurrency string
+
+	mu         *sync.RWMutex
+	cacheTTL   time.Duration
+	cache      map[string]cachedCurrency
+	generation uint64
+
+	// settings are the settings adjustable at runtime, see SetSettings.
+	settings *settings.Service
 }
 
 func NewService(_ context.Context, db *sql.DB, zlog *zap.Logger) (*Service, error) {
@@ -36,11 +53,65 @@ func NewService(_ context.Context, db *sql.DB, zlog *zap.Logger) (*Service, erro
 	}
 
 	return &Service{
-		db:   db,
-		zlog: zlog,
+		db:           db,
+		zlog:         zlog,
+		baseCurrency: DefaultBaseCurrency,
+		mu:           new(sync.RWMutex),
+		cacheTTL:     DefaultCacheTTL,
+		cache:        make(map[string]cachedCurrency),
 	}, nil
 }
 
+// SetBaseCurrency sets the ISO 4217 code of the currency the exchange rates convert to.
+// An empty code resets the base currency to DefaultBaseCurrency.
+func (s *Service) SetBaseCurrency(code string) error {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		code = DefaultBaseCurrency
+	}
+	if !countries.CurrencyCodeByName(code).IsValid() {
+		return fmt.Errorf("base currency %q is not a valid ISO 4217 currency code", code)
+	}
+
+	s.baseCurrency = code
+	return nil
+}
+
+// SetSettings sets the settings service the base currency is read from.
+// Nil uses the base currency configured on this service.
+func (s *Service) SetSettings(svc *settings.Service) {
+	s.settings = svc
+}
+
+// BaseCurrency returns the ISO 4217 code of the currency the exchange rates convert to.
+// The base currency configured on this service is returned when the settings cannot be read.
+func (s *Service) BaseCurrency() string {
+	if s.settings == nil {
+		return s.baseCurrency
+	}
+
+	cfg, err := s.settings.Current(context.Background())
+	if err != nil {
+		s.zlog.Error("failed to get settings", zap.Error(err))
+		return s.baseCurrency
+	}
+	if cfg.BaseCurrency == "" {
+		return s.baseCurrency
+	}
+
+	return cfg.BaseCurrency
+}
+
+// RateToBase returns the exchange rate of the currency to the base currency.
+// The base currency converts to itself at 1, whatever rate is stored for it.
+func (s *Service) RateToBase(c *Currency) decimal.Decimal {
+	if strings.EqualFold(c.Code, s.baseCurrency) {
+		return decimal.NewFromInt(1)
+	}
+
+	return c.ExchangeRate
+}
+
 func (s *Service) CreateCurrency(ctx context.Context, in *CreateReq) (*Currency, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -67,6 +138,7 @@ func (s *Service) CreateCurrency(ctx context.Context, in *CreateReq) (*Currency,
 		zlog.Error("failed to create currency", zap.Error(err))
 		return nil, err
 	}
+	s.invalidate()
 
 	return currency, nil
 }
@@ -108,6 +180,7 @@ func (s *Service) UpdateExchangeRate(ctx context.Context, in *ExchangeRateReq) (
 		zlog.Error("failed to update currency", zap.Error(err))
 		return nil, err
 	}
+	s.invalidate()
 
 	return currency, nil
 }
@@ -134,6 +207,8 @@ func (s *Service) GetCurrencyByID(ctx context.Context, id string) (*Currency, er
 	return currency, nil
 }
 
+// GetCurrencyByCode returns the currency of the given code,
+// read from the cache while it has not expired, see SetCacheTTL.
 func (s *Service) GetCurrencyByCode(ctx context.Context, code string) (*Currency, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	zlog := s.zlog.With(
@@ -141,6 +216,11 @@ func (s *Service) GetCurrencyByCode(ctx context.Context, code string) (*Currency
 		zap.String("Username", claims.Username),
 	)
 
+	if currency, ok := s.cachedByCode(code); ok {
+		return currency, nil
+	}
+
+	generation := s.cacheGeneration()
 	currency, err := getCurrency(ctx, s.db, &Query{
 		Code: code,
 	})
@@ -152,9 +232,71 @@ func (s *Service) GetCurrencyByCode(ctx context.Context, code string) (*Currency
 		return nil, err
 	}
 
+	s.cacheByCode(generation, currency)
 	return currency, nil
 }
 
+// Availability tells whether a currency can be used by a calculation.
+type Availability struct {
+	Code   string `json:"code"`
+	Exists bool   `json:"exists"`
+
+	// Active is set when the currency has a positive exchange rate to convert with.
+	Active       bool            `json:"active"`
+	ExchangeRate decimal.Decimal `json:"exchangeRate"`
+	UpdatedAt    *time.Time      `json:"updatedAt"`
+}
+
+// CheckCurrency tells whether the currency of the given code is configured and can be used by a calculation,
+// so clients can check it before creating one. Unlike GetCurrencyByCode, a missing currency is not an error.
+func (s *Service) CheckCurrency(ctx context.Context, code string) (*Availability, error) {
+	claims := auth.ClaimsFromContext(ctx)
+	zlog := s.zlog.With(
+		zap.String("Method", "CheckCurrency"),
+		zap.String("Username", claims.Username),
+		zap.String("Code", code),
+	)
+
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if !countries.CurrencyCodeByName(code).IsValid() {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Currency code is not valid. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "code",
+					Description: "Code must be a valid ISO 4217 currency code",
+				},
+			},
+		})
+
+		return nil, s.Err()
+	}
+
+	availability := &Availability{
+		Code:         code,
+		ExchangeRate: decimal.Zero,
+	}
+
+	currency, err := getCurrency(ctx, s.db, &Query{
+		Code: code,
+	})
+	if errors.Is(err, ErrCurrencyNotFound) {
+		return availability, nil
+	}
+	if err != nil {
+		zlog.Error("failed to get currency", zap.Error(err))
+		return nil, err
+	}
+
+	availability.Exists = true
+	availability.Active = currency.ExchangeRate.IsPositive()
+	availability.ExchangeRate = currency.ExchangeRate
+	availability.UpdatedAt = &currency.UpdatedAt
+	return availability, nil
+}
+
 type ListCurrenciesResult struct {
 	Currencies    []*Currency `json:"currencies"`
 	NextPageToken string      `json:"nextPageToken"`
@@ -192,7 +334,8 @@ func (s *Service) ListCurrencies(ctx context.Context, in *Query) (*ListCurrencie
 // Currency represents a currency and its exchange rate.
 // The Code is the ISO 4217 currency code.
 //
-//	Base currency is LAK.
+// The exchange rate converts an amount of the currency to the base currency,
+// see Service.BaseCurrency.
 type Currency struct {
 	createdBy    string
 	updatedBy    string
@@ -206,6 +349,7 @@ type Currency struct {
 type Query struct {
 	ID            string    `json:"id" param:"id" query:"id"`
 	Code          string    `json:"code"  query:"code"`
+	CodePrefix    string    `json:"codePrefix"  query:"codePrefix"` // Matches the codes starting with it, e.g. US for USD.
 	PageToken     string    `json:"pageToken"  query:"pageToken"`
 	PageSize      uint64    `json:"pageSize"  query:"pageSize"`
 	CreatedAfter  time.Time `json:"createdAfter"  query:"createdAfter"`
@@ -223,6 +367,10 @@ func (q *Query) ToSql() (string, []any, error) {
 		and = append(and, sq.Eq{"code": q.Code})
 	}
 
+	if prefix := strings.ToUpper(strings.TrimSpace(q.CodePrefix)); prefix != "" {
+		and = append(and, sq.Like{"code": database.EscapeLike(prefix) + "%"})
+	}
+
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
 	}
@@ -313,6 +461,13 @@ func getCurrency(ctx context.Context, db *sql.DB, in *Query) (*Currency, error)
 }
 
 func updateCurrency(ctx context.Context, db *sql.DB, in *Currency) error {
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return saveCurrency(ctx, tx, in)
+	})
+}
+
+// saveCurrency updates the currency and appends its rate to its rate history.
+func saveCurrency(ctx context.Context, tx *sql.Tx, in *Currency) error {
 	q, args := sq.Update("currency").
 		Set("code", in.Code).
 		Set("exchange_rate", in.ExchangeRate).
@@ -325,15 +480,22 @@ func updateCurrency(ctx context.Context, db *sql.DB, in *Currency) error {
 		PlaceholderFormat(sq.AtP).
 		MustSql()
 
-	_, err := db.ExecContext(ctx, q, args...)
+	_, err := tx.ExecContext(ctx, q, args...)
 	if err != nil {
 		return fmt.Errorf("failed to update currency: %w", err)
 	}
 
-	return nil
+	return insertRate(ctx, tx, in)
 }
 
 func createCurrency(ctx context.Context, db *sql.DB, in *Currency) error {
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		return insertCurrency(ctx, tx, in)
+	})
+}
+
+// insertCurrency inserts the currency and its first rate to its rate history.
+func insertCurrency(ctx context.Context, tx *sql.Tx, in *Currency) error {
 	q, args := sq.Insert("currency").
 		Columns(
 			"id",
@@ -356,12 +518,12 @@ func createCurrency(ctx context.Context, db *sql.DB, in *Currency) error {
 		PlaceholderFormat(sq.AtP).
 		MustSql()
 
-	_, err := db.ExecContext(ctx, q, args...)
+	_, err := tx.ExecContext(ctx, q, args...)
 	if err != nil {
 		return fmt.Errorf("failed to create currency: %w", err)
 	}
 
-	return nil
+	return insertRate(ctx, tx, in)
 }
 
 // CreateReq represents a request for creating a currency.
@@ -0,0 +1,200 @@
+package currency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestBaseCurrencyFromSettings(t *testing.T) {
+	updatedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	settingColumns := []string{"name", "value", "updated_by", "updated_at"}
+
+	tests := []struct {
+		name  string
+		value string
+		err   error
+		want  string
+	}{
+		{name: "set", value: "THB", want: "THB"},
+		{name: "not set", want: "USD"},
+		{name: "settings failing", err: errors.New("database is down"), want: "USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			if err := s.SetBaseCurrency("USD"); err != nil {
+				t.Fatal(err)
+			}
+
+			settingsSvc, err := settings.NewService(context.Background(), s.db, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			settingsSvc.SetDefaults(settings.Settings{})
+			s.SetSettings(settingsSvc)
+
+			e := mock.ExpectQuery(`FROM settings`).WillReturnError(tt.err)
+			if tt.value != "" {
+				e.WillReturnRows(settingColumns, []any{"currency.base_currency", tt.value, "admin@example.com", updatedAt})
+			}
+
+			if got := s.BaseCurrency(); got != tt.want {
+				t.Errorf("BaseCurrency() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryCodePrefixSQL(t *testing.T) {
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{prefix: " us ", want: "US%"},
+		{prefix: "U%", want: "U[%]%"},
+		{prefix: "U_", want: "U[_]%"},
+		{prefix: "[U", want: "[[]U%"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			pred, args, err := (&Query{CodePrefix: tt.prefix}).ToSql()
+			if err != nil {
+				t.Fatalf("ToSql() error = %v", err)
+			}
+			if !strings.Contains(pred, "code LIKE ?") {
+				t.Errorf("ToSql() = %q, want the code LIKE predicate", pred)
+			}
+			if len(args) != 1 || args[0] != tt.want {
+				t.Errorf("ToSql() args = %v, want %s", args, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateToBase(t *testing.T) {
+	s, _ := newTestService(t)
+	if err := s.SetBaseCurrency(" thb "); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.BaseCurrency(); got != "THB" {
+		t.Fatalf("BaseCurrency() = %s, want THB", got)
+	}
+
+	tests := []struct {
+		code string
+		rate string
+		want string
+	}{
+		{code: "THB", rate: "0", want: "1"},
+		{code: "LAK", rate: "0.0015", want: "0.0015"},
+		{code: "USD", rate: "35.5", want: "35.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			c := &Currency{Code: tt.code, ExchangeRate: decimal.RequireFromString(tt.rate)}
+			if got := s.RateToBase(c); got.String() != tt.want {
+				t.Errorf("RateToBase() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if err := s.SetBaseCurrency("XYZ"); err == nil {
+		t.Error("SetBaseCurrency(XYZ) error = nil, want an invalid currency")
+	}
+	if err := s.SetBaseCurrency(""); err != nil || s.BaseCurrency() != DefaultBaseCurrency {
+		t.Errorf("SetBaseCurrency(\"\") = %v, base %s, want %s", err, s.BaseCurrency(), DefaultBaseCurrency)
+	}
+}
+
+func TestCheckCurrency(t *testing.T) {
+	tests := []struct {
+		name       string
+		code       string
+		rate       string
+		wantExists bool
+		wantActive bool
+		wantCode   codes.Code
+	}{
+		{name: "existing", code: " usd ", rate: "21500", wantExists: true, wantActive: true},
+		{name: "missing", code: "EUR"},
+		{name: "inactive", code: "THB", rate: "0", wantExists: true},
+		{name: "invalid", code: "XYZ", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			if tt.wantCode == codes.OK {
+				e := mock.ExpectQuery(`FROM currency`)
+				if tt.rate != "" {
+					e.WillReturnRows(currencyColumns, currencyRow(strings.ToUpper(strings.TrimSpace(tt.code)), tt.rate))
+				}
+			}
+
+			// Any user may check a currency, not only those allowed to manage them.
+			ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+			got, err := s.CheckCurrency(ctx, tt.code)
+			if code := rpcStatus.Code(err); code != tt.wantCode {
+				t.Fatalf("CheckCurrency() code = %v, want %v (error %v)", code, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if got.Exists != tt.wantExists || got.Active != tt.wantActive {
+				t.Errorf("CheckCurrency() exists %v active %v, want exists %v active %v", got.Exists, got.Active, tt.wantExists, tt.wantActive)
+			}
+			if want := strings.ToUpper(strings.TrimSpace(tt.code)); got.Code != want {
+				t.Errorf("code = %s, want %s", got.Code, want)
+			}
+			if tt.wantExists && got.ExchangeRate.String() != tt.rate {
+				t.Errorf("exchange rate = %s, want %s", got.ExchangeRate, tt.rate)
+			}
+		})
+	}
+}
+
+func TestListCurrenciesCodePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   *Query
+		pattern string
+		want    any
+	}{
+		{name: "prefix", query: &Query{CodePrefix: "us"}, pattern: `FROM currency WHERE \(code LIKE @p1\)`, want: "US%"},
+		{name: "exact code", query: &Query{Code: "USD"}, pattern: `FROM currency WHERE \(code = @p1\)`, want: "USD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newTestService(t)
+			// The seeded currencies matching the query.
+			list := mock.ExpectQuery(tt.pattern).WillReturnRows(currencyColumns, currencyRow("USD", "21500"))
+
+			ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+			result, err := s.ListCurrencies(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("ListCurrencies() error = %v", err)
+			}
+			if args := list.Args(); len(args) == 0 || args[0] != tt.want {
+				t.Errorf("query arguments = %v, want %v first", args, tt.want)
+			}
+			if len(result.Currencies) != 1 || result.Currencies[0].Code != "USD" {
+				t.Errorf("currencies = %+v, want USD", result.Currencies)
+			}
+		})
+	}
+}
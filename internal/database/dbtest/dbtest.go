@@ -0,0 +1,318 @@
+// Package dbtest provides a fake database/sql driver for the tests of the services,
+// which answers the statements with the results the test expects instead of a database.
+//
+//	db, mock := dbtest.New(t)
+//	mock.ExpectQuery(`FROM currency`).WillReturnRows([]string{"id", "code"}, []any{"1", "USD"})
+//	mock.ExpectExec(`UPDATE currency`).WillReturnResult(1)
+//
+// A statement is answered by the first expectation not yet used whose pattern matches it.
+// A statement matching no expectation fails the test, and so does an expectation left unused.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"testing"
+)
+
+// Mock holds the expectations of the statements of a fake database.
+type Mock struct {
+	t testing.TB
+
+	mu           sync.Mutex
+	expectations []*Expectation
+	commits      int
+	rollbacks    int
+}
+
+// New returns a fake database answering the statements with the expectations of the returned mock.
+// The test fails when it ends with an expectation left unused.
+func New(t testing.TB) (*sql.DB, *Mock) {
+	t.Helper()
+
+	m := &Mock{t: t}
+	db := sql.OpenDB(&connector{m: m})
+	t.Cleanup(func() {
+		db.Close()
+		m.checkUsed()
+	})
+
+	return db, m
+}
+
+// Expectation is the expected statement and the result it is answered with.
+type Expectation struct {
+	query   bool
+	pattern *regexp.Regexp
+
+	columns []string
+	rows    [][]any
+	result  int64
+	err     error
+
+	used bool
+	args []any
+}
+
+// ExpectQuery expects a query matching the regular expression pattern.
+// It returns no rows unless told otherwise.
+func (m *Mock) ExpectQuery(pattern string) *Expectation {
+	return m.expect(true, pattern)
+}
+
+// ExpectExec expects a statement matching the regular expression pattern.
+// It affects one row unless told otherwise.
+func (m *Mock) ExpectExec(pattern string) *Expectation {
+	e := m.expect(false, pattern)
+	e.result = 1
+	return e
+}
+
+func (m *Mock) expect(query bool, pattern string) *Expectation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e := &Expectation{
+		query:   query,
+		pattern: regexp.MustCompile(pattern),
+	}
+	m.expectations = append(m.expectations, e)
+	return e
+}
+
+// WillReturnRows answers the query with the rows of the given columns.
+func (e *Expectation) WillReturnRows(columns []string, rows ...[]any) *Expectation {
+	e.columns = columns
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult answers the statement with the number of rows affected.
+func (e *Expectation) WillReturnResult(rowsAffected int64) *Expectation {
+	e.result = rowsAffected
+	return e
+}
+
+// WillReturnError answers the statement with the error.
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Used reports whether a statement has been answered with the expectation.
+func (e *Expectation) Used() bool {
+	return e.used
+}
+
+// Args returns the arguments of the statement answered with the expectation.
+func (e *Expectation) Args() []any {
+	return e.args
+}
+
+// Commits returns the number of transactions committed.
+func (m *Mock) Commits() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.commits
+}
+
+// Rollbacks returns the number of transactions rolled back.
+func (m *Mock) Rollbacks() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rollbacks
+}
+
+func (m *Mock) match(query bool, stmt string, args []driver.NamedValue) (*Expectation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.expectations {
+		if e.used || e.query != query || !e.pattern.MatchString(stmt) {
+			continue
+		}
+
+		e.used = true
+		e.args = make([]any, len(args))
+		for i, a := range args {
+			e.args[i] = a.Value
+		}
+		return e, nil
+	}
+
+	m.t.Errorf("dbtest: unexpected statement: %s", stmt)
+	return nil, fmt.Errorf("dbtest: unexpected statement: %s", stmt)
+}
+
+func (m *Mock) checkUsed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.expectations {
+		if !e.used {
+			m.t.Errorf("dbtest: expected statement matching %q was not run", e.pattern)
+		}
+	}
+}
+
+// SQLError is an error of the database with a SQL Server error number,
+// e.g. 2627 for a violation of a unique constraint.
+type SQLError struct {
+	Number int32
+}
+
+func (e SQLError) Error() string {
+	return fmt.Sprintf("dbtest: sql error %d", e.Number)
+}
+
+func (e SQLError) SQLErrorNumber() int32 {
+	return e.Number
+}
+
+type connector struct {
+	m *Mock
+}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{m: c.m}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("dbtest: open is not supported, use dbtest.New")
+}
+
+type conn struct {
+	m *Mock
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, fmt.Errorf("dbtest: prepared statements are not supported")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return &tx{m: c.m}, nil
+}
+
+func (c *conn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return &tx{m: c.m}, nil
+}
+
+// CheckNamedValue keeps the arguments as they are, so the tests can check them,
+// except for the driver.Valuer ones, which are replaced by their value as a driver would.
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if valuer, ok := v.Value.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		v.Value = value
+	}
+
+	return nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	e, err := c.m.match(true, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return &rows{columns: e.columns, values: e.rows}, nil
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, err := c.m.match(false, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return driver.RowsAffected(e.result), nil
+}
+
+type tx struct {
+	m *Mock
+}
+
+func (t *tx) Commit() error {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	t.m.commits++
+	return nil
+}
+
+func (t *tx) Rollback() error {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	t.m.rollbacks++
+	return nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]any
+	next    int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+
+	row := r.values[r.next]
+	r.next++
+	for i := range dest {
+		if i >= len(row) {
+			dest[i] = nil
+			continue
+		}
+		dest[i] = value(row[i])
+	}
+
+	return nil
+}
+
+// value converts the Go values of the rows to the values a driver returns.
+func value(v any) driver.Value {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case driver.Valuer:
+		value, _ := v.Value()
+		return value
+	}
+
+	return v
+}
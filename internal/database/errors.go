@@ -0,0 +1,18 @@
+package database
+
+import "errors"
+
+// IsUniqueViolation reports whether err is caused by a violation of a unique constraint or index.
+func IsUniqueViolation(err error) bool {
+	var sqlErr interface{ SQLErrorNumber() int32 }
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+
+	switch sqlErr.SQLErrorNumber() {
+	case 2601, 2627: // duplicate key in a unique index, violation of a unique constraint
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,10 @@
+package database
+
+import "strings"
+
+var likeEscaper = strings.NewReplacer("[", "[[]", "%", "[%]", "_", "[_]")
+
+// EscapeLike escapes the wildcards of a LIKE pattern, so the given text is matched literally.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -0,0 +1,19 @@
+package database
+
+import "testing"
+
+func TestEscapeLike(t *testing.T) {
+	tests := map[string]string{
+		"USD":       "USD",
+		"100%":      "100[%]",
+		"loan_1":    "loan[_]1",
+		"[LN]":      "[[]LN]",
+		"%_[mixed]": "[%][_][[]mixed]",
+	}
+
+	for in, want := range tests {
+		if got := EscapeLike(in); got != want {
+			t.Errorf("EscapeLike(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package database
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultSlowQueryThreshold is the duration above which a query is logged as slow
+// when no other threshold is configured.
+const DefaultSlowQueryThreshold = 500 * time.Millisecond
+
+var slowQueryThreshold atomic.Int64
+
+func init() {
+	slowQueryThreshold.Store(int64(DefaultSlowQueryThreshold))
+}
+
+// SetSlowQueryThreshold sets the duration above which a query is logged as slow.
+// A value less than or equal to zero disables the logging.
+func SetSlowQueryThreshold(d time.Duration) {
+	slowQueryThreshold.Store(int64(d))
+}
+
+// TimeQuery starts timing the query of the given label and returns the function to call once it is done,
+// which logs a warning with the global logger if the query took longer than the slow query threshold.
+// The label names the query, e.g. "income.listCalculations", so the statement and its arguments are never logged.
+//
+//	defer database.TimeQuery("income.listCalculations")()
+func TimeQuery(label string) func() {
+	start := time.Now()
+	return func() {
+		logSlowQuery(zap.L(), label, time.Since(start), time.Duration(slowQueryThreshold.Load()))
+	}
+}
+
+func logSlowQuery(zlog *zap.Logger, label string, elapsed, threshold time.Duration) {
+	if threshold <= 0 || elapsed <= threshold {
+		return
+	}
+
+	zlog.Warn("slow query",
+		zap.String("Query", label),
+		zap.Duration("Duration", elapsed),
+		zap.Duration("Threshold", threshold),
+	)
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTimeQueryLogsSlowQuery(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	SetSlowQueryThreshold(10 * time.Millisecond)
+	defer SetSlowQueryThreshold(DefaultSlowQueryThreshold)
+
+	// A stub query deliberately slower than the threshold, then a fast one.
+	func() {
+		defer TimeQuery("stub.slow")()
+		time.Sleep(20 * time.Millisecond)
+	}()
+	func() {
+		defer TimeQuery("stub.fast")()
+	}()
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d log entries, want only the slow query: %v", len(entries), entries)
+	}
+	e := entries[0]
+	if e.Level != zapcore.WarnLevel {
+		t.Errorf("level = %s, want warn", e.Level)
+	}
+	if got := e.ContextMap()["Query"]; got != "stub.slow" {
+		t.Errorf("query = %v, want stub.slow", got)
+	}
+	if got, ok := e.ContextMap()["Duration"].(time.Duration); !ok || got < 20*time.Millisecond {
+		t.Errorf("duration = %v, want at least 20ms", e.ContextMap()["Duration"])
+	}
+}
+
+func TestTimeQueryDisabled(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+
+	SetSlowQueryThreshold(0)
+	defer SetSlowQueryThreshold(DefaultSlowQueryThreshold)
+
+	func() {
+		defer TimeQuery("stub.slow")()
+		time.Sleep(time.Millisecond)
+	}()
+
+	if n := logs.Len(); n != 0 {
+		t.Errorf("got %d log entries, want none with the logging disabled", n)
+	}
+}
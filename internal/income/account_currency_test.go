@@ -0,0 +1,68 @@
+package income
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestCalculateIncomeAccountCurrency(t *testing.T) {
+	// The statement without account number nor name has its header cells elsewhere.
+	noAccount := statement.DefaultStatementLayout
+	noAccount.AccountNumber, noAccount.AccountDisplayName = "H1", "H2"
+
+	tests := []struct {
+		name          string
+		layout        statement.StatementLayout
+		currency      string
+		wantCode      codes.Code
+		wantViolation string
+	}{
+		{
+			name:          "blank currency",
+			layout:        statement.DefaultStatementLayout,
+			currency:      "",
+			wantCode:      codes.InvalidArgument,
+			wantViolation: "Account currency in cell A11 of the statement must be a 3-letter currency code",
+		},
+		{
+			name:          "invalid currency",
+			layout:        statement.DefaultStatementLayout,
+			currency:      "KIP.",
+			wantCode:      codes.InvalidArgument,
+			wantViolation: "Account currency in cell A11 of the statement must be a 3-letter currency code",
+		},
+		{
+			name:     "no income transactions",
+			layout:   noAccount,
+			currency: "LAK",
+			wantCode: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeStatementWithLayout(t, tt.layout, "01/01/2025 ຫາ 31/03/2025", tt.currency,
+				credit("25/01/2025", "Salary January", 5000000),
+			)
+			s, mock := newCalculateTestService(t)
+			// Every case fails reading the statement header, before the currency is looked up.
+			expectStatement(mock, file, salaryWordlist())
+
+			_, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductPL))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if got := fieldViolation(err); got != tt.wantViolation {
+				t.Errorf("violation = %q, want %q", got, tt.wantViolation)
+			}
+			if tt.wantViolation == "" && strings.Contains(rpcStatus.Convert(err).Message(), "currency") {
+				t.Errorf("CalculateIncome() error = %v, want it not to blame the currency", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package income
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/pager"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+)
+
+const (
+	// AttentionStalePending is set when a calculation has been pending for too long.
+	AttentionStalePending = "STALE_PENDING"
+
+	// AttentionZeroNetIncome is set when a calculation has no monthly net income.
+	AttentionZeroNetIncome = "ZERO_NET_INCOME"
+
+	// AttentionDefaultExchangeRate is set when a calculation fell back to the default exchange rate.
+	AttentionDefaultExchangeRate = "DEFAULT_EXCHANGE_RATE"
+)
+
+// AttentionCriteria are the conditions under which a calculation needs the attention of a supervisor.
+// A calculation needs attention when it meets any of the enabled criteria.
+type AttentionCriteria struct {
+	// StalePendingAfter is how long a calculation can stay pending. Zero disables the criterion.
+	StalePendingAfter time.Duration
+
+	// ZeroNetIncome enables the criterion of a zero monthly net income.
+	ZeroNetIncome bool
+
+	// DefaultExchangeRate enables the criterion of the default exchange rate fallback.
+	DefaultExchangeRate bool
+}
+
+// DefaultAttentionCriteria are the attention criteria used when no others are configured.
+var DefaultAttentionCriteria = AttentionCriteria{
+	StalePendingAfter:   72 * time.Hour,
+	ZeroNetIncome:       true,
+	DefaultExchangeRate: true,
+}
+
+// SetAttentionCriteria sets the criteria used by ListNeedingAttention.
+func (s *Service) SetAttentionCriteria(c AttentionCriteria) {
+	s.attentionCriteria = c
+}
+
+// predicate returns the condition matching the calculations that meet any of the criteria at the given time,
+// or nil if no criterion is enabled.
+func (c AttentionCriteria) predicate(now time.Time) sq.Sqlizer {
+	or := sq.Or{}
+	if c.StalePendingAfter > 0 {
+		or = append(or, sq.And{
+			sq.Eq{"status": types.StatusPending.String()},
+			sq.Lt{"created_at": now.Add(-c.StalePendingAfter)},
+		})
+	}
+	if c.ZeroNetIncome {
+		or = append(or, sq.Eq{"monthly_net_income": 0})
+	}
+	if c.DefaultExchangeRate {
+		or = append(or, sq.Eq{"exchange_rate_source": ExchangeRateSourceDefault})
+	}
+
+	if len(or) == 0 {
+		return nil
+	}
+
+	return or
+}
+
+// reasons returns the criteria the calculation meets at the given time.
+func (c AttentionCriteria) reasons(calculation *Calculation, now time.Time) []string {
+	reasons := make([]string, 0)
+	if c.StalePendingAfter > 0 && calculation.Status == types.StatusPending && calculation.CreatedAt.Before(now.Add(-c.StalePendingAfter)) {
+		reasons = append(reasons, AttentionStalePending)
+	}
+	if c.ZeroNetIncome && calculation.MonthlyNetIncome.IsZero() {
+		reasons = append(reasons, AttentionZeroNetIncome)
+	}
+	if c.DefaultExchangeRate && calculation.ExchangeRateSource == ExchangeRateSourceDefault {
+		reasons = append(reasons, AttentionDefaultExchangeRate)
+	}
+
+	return reasons
+}
+
+type AttentionQuery struct {
+	PageSize  uint64 `query:"pageSize"`
+	PageToken string `query:"pageToken"`
+}
+
+// CalculationNeedingAttention is a calculation with the attention criteria it meets.
+type CalculationNeedingAttention struct {
+	Calculation *Calculation `json:"calculation"`
+	Reasons     []string     `json:"reasons"`
+}
+
+type ListNeedingAttentionResult struct {
+	Calculations  []*CalculationNeedingAttention `json:"calculations"`
+	NextPageToken string                         `json:"nextPageToken"`
+}
+
+// ListNeedingAttention returns the calculations that meet any of the configured attention criteria,
+// newest first.
+func (s *Service) ListNeedingAttention(ctx context.Context, in *AttentionQuery) (*ListNeedingAttentionResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListNeedingAttention"),
+		zap.String("Username", claims.Username),
+	)
+
+	now := time.Now()
+	pred := s.attentionCriteria.predicate(now)
+	if pred == nil {
+		return &ListNeedingAttentionResult{
+			Calculations: make([]*CalculationNeedingAttention, 0),
+		}, nil
+	}
+
+	calculations, err := listCalculations(ctx, s.db, &CalculationQuery{
+		PageSize:  in.PageSize,
+		PageToken: in.PageToken,
+		attention: pred,
+		createdBy: claims.VisibleCreator(),
+	})
+	if err != nil {
+		zlog.Error("failed to list calculations needing attention", zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]*CalculationNeedingAttention, 0, len(calculations))
+	for _, c := range calculations {
+		result = append(result, &CalculationNeedingAttention{
+			Calculation: c,
+			Reasons:     s.attentionCriteria.reasons(c, now),
+		})
+	}
+
+	var pageToken string
+	if l := len(calculations); l > 0 && l == int(pager.Size(in.PageSize)) {
+		last := calculations[l-1]
+		pageToken = pager.EncodeCursor(&pager.Cursor{
+			ID:   strconv.FormatInt(last.ID, 10),
+			Time: last.CreatedAt,
+		})
+	}
+
+	return &ListNeedingAttentionResult{
+		Calculations:  result,
+		NextPageToken: pageToken,
+	}, nil
+}
@@ -0,0 +1,147 @@
+package income
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// attentionRow returns a calculation row as listed by listCalculations.
+func attentionRow(id int64, exchangeRateSource, netIncome, status string, createdAt time.Time) []any {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	return []any{
+		id, "statement.pdf", fmt.Sprintf("APP-%d", id), "SA", "LAK", "0100001", "Somchai",
+		"1", exchangeRateSource, "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", netIncome,
+		"0", "3", startedAt, endedAt, status, []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", createdAt, "user@example.com", createdAt, nil,
+	}
+}
+
+func TestAttentionCriteriaPredicate(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		criteria AttentionCriteria
+		wantSQL  []string
+		wantArgs []any
+	}{
+		{
+			name:     "stale pending",
+			criteria: AttentionCriteria{StalePendingAfter: 72 * time.Hour},
+			wantSQL:  []string{"status = ?", "created_at < ?"},
+			wantArgs: []any{types.StatusPending.String(), now.Add(-72 * time.Hour)},
+		},
+		{
+			name:     "zero net income",
+			criteria: AttentionCriteria{ZeroNetIncome: true},
+			wantSQL:  []string{"monthly_net_income = ?"},
+			wantArgs: []any{0},
+		},
+		{
+			name:     "default exchange rate",
+			criteria: AttentionCriteria{DefaultExchangeRate: true},
+			wantSQL:  []string{"exchange_rate_source = ?"},
+			wantArgs: []any{ExchangeRateSourceDefault},
+		},
+		{
+			name:     "every criterion",
+			criteria: DefaultAttentionCriteria,
+			wantSQL:  []string{"status = ?", "monthly_net_income = ?", "exchange_rate_source = ?", " OR "},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, args, err := tt.criteria.predicate(now).ToSql()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.wantSQL {
+				if !strings.Contains(sql, want) {
+					t.Errorf("predicate = %s, want %q", sql, want)
+				}
+			}
+			if tt.wantArgs != nil && !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+
+	if pred := (AttentionCriteria{}).predicate(now); pred != nil {
+		t.Errorf("predicate without criteria = %v, want nil", pred)
+	}
+}
+
+func TestListNeedingAttention(t *testing.T) {
+	now := time.Now()
+	criteria := AttentionCriteria{StalePendingAfter: 72 * time.Hour, ZeroNetIncome: true, DefaultExchangeRate: true}
+
+	s, mock := newCalculateTestService(t)
+	s.SetAttentionCriteria(criteria)
+	list := mock.ExpectQuery(`FROM statement_file_analysis WHERE .*monthly_net_income`).WillReturnRows(calculationColumns,
+		attentionRow(3, ExchangeRateSourceCurrency, "5000000", "PENDING", now.Add(-96*time.Hour)),
+		attentionRow(2, ExchangeRateSourceCurrency, "0", "COMPLETED", now.Add(-time.Hour)),
+		attentionRow(1, ExchangeRateSourceDefault, "5000000", "PENDING", now.Add(-time.Hour)),
+	)
+
+	result, err := s.ListNeedingAttention(userContext(), &AttentionQuery{PageSize: 3})
+	if err != nil {
+		t.Fatalf("ListNeedingAttention() error = %v", err)
+	}
+
+	want := [][]string{
+		{AttentionStalePending},
+		{AttentionZeroNetIncome},
+		{AttentionDefaultExchangeRate},
+	}
+	if len(result.Calculations) != len(want) {
+		t.Fatalf("calculations = %d, want %d", len(result.Calculations), len(want))
+	}
+	for i, c := range result.Calculations {
+		if !slices.Equal(c.Reasons, want[i]) {
+			t.Errorf("reasons of calculation %d = %v, want %v", c.Calculation.ID, c.Reasons, want[i])
+		}
+	}
+	if result.NextPageToken == "" {
+		t.Error("next page token is empty, want the token of the next page of a full page")
+	}
+	if !slices.Contains(list.Args(), any("user@example.com")) {
+		t.Errorf("list args = %v, want the calculations of user@example.com", list.Args())
+	}
+}
+
+func TestListNeedingAttentionWithoutCriteria(t *testing.T) {
+	s, _ := newCalculateTestService(t)
+	s.SetAttentionCriteria(AttentionCriteria{})
+
+	result, err := s.ListNeedingAttention(userContext(), &AttentionQuery{})
+	if err != nil {
+		t.Fatalf("ListNeedingAttention() error = %v", err)
+	}
+	if len(result.Calculations) != 0 {
+		t.Errorf("calculations = %d, want none", len(result.Calculations))
+	}
+}
+
+func TestAttentionCriteriaReasonsDisabled(t *testing.T) {
+	c := newTestCalculation("APP-1")
+	c.CreatedAt = time.Now().Add(-96 * time.Hour)
+	c.MonthlyNetIncome = decimal.Zero
+	c.ExchangeRateSource = ExchangeRateSourceDefault
+
+	if got := (AttentionCriteria{}).reasons(c, time.Now()); len(got) != 0 {
+		t.Errorf("reasons without criteria = %v, want none", got)
+	}
+	if got := DefaultAttentionCriteria.reasons(c, time.Now()); len(got) != 3 {
+		t.Errorf("reasons = %v, want the 3 criteria", got)
+	}
+}
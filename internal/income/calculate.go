@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/10664kls/automatic-finance-api/internal/database"
@@ -21,6 +24,23 @@ import (
 // ErrCalculationNotFound is returned when a calculation is not found in the database.
 var ErrCalculationNotFound = fmt.Errorf("calculation not found")
 
+const (
+	// ExchangeRateSourceCurrency is set when the exchange rate comes from the currency of the account.
+	ExchangeRateSourceCurrency = "CURRENCY"
+
+	// ExchangeRateSourceDefault is set when the currency of the account has no positive rate
+	// and the exchange rate falls back to 1.
+	ExchangeRateSourceDefault = "DEFAULT"
+
+	// ExchangeRateSourceOverride is set when the exchange rate is a fixed rate
+	// given by the request or configured for the product, see Service.SetExchangeRateOverrides.
+	ExchangeRateSourceOverride = "OVERRIDE"
+
+	// ExchangeRateSourceHistory is set when the exchange rate is the rate of the currency
+	// effective at the end of the statement, see Service.SetPinExchangeRates.
+	ExchangeRateSourceHistory = "HISTORY"
+)
+
 type Calculation struct {
 	ID                                int64                `json:"id"`
 	StatementFileName                 string               `json:"statementFileName"`
@@ -28,6 +48,12 @@ type Calculation struct {
 	Product                           types.ProductType    `json:"product"`
 	Account                           Account              `json:"account"`
 	ExchangeRate                      decimal.Decimal      `json:"exchangeRate"`
+	ExchangeRateSource                string               `json:"exchangeRateSource"`
+	IncomeDirection                   IncomeDirection      `json:"incomeDirection"`
+	OtherIncomeCapPercentage          decimal.Decimal      `json:"otherIncomeCapPercentage"`
+	SalaryVariation                   decimal.Decimal      `json:"salaryVariation"`
+	SalaryVolatile                    bool                 `json:"salaryVolatile"`
+	NetIncomeOutOfRange               bool                 `json:"netIncomeOutOfRange"`
 	BasicSalaryFromInterview          decimal.Decimal      `json:"basicSalaryFromInterview"`
 	MonthlyAverageIncome              decimal.Decimal      `json:"monthlyAverageIncome"`
 	MonthlyNetIncome                  decimal.Decimal      `json:"monthlyNetIncome"`
@@ -44,14 +70,29 @@ type Calculation struct {
 	UpdatedBy                         string               `json:"updatedBy"`
 	CreatedAt                         time.Time            `json:"createdAt"`
 	UpdatedAt                         time.Time            `json:"updatedAt"`
+	CompletedAt                       *time.Time           `json:"completedAt"`
 
 	SalaryBreakdown     *SalaryBreakdown     `json:"salaryBreakdown"`
 	AllowanceBreakdown  *AllowanceBreakdown  `json:"allowanceBreakdown"`
 	CommissionBreakdown *CommissionBreakdown `json:"commissionBreakdown"`
 	Source              *Source              `json:"source"`
+
+	// MissingMonths are the months within the statement period
+	// that have no salary transactions, e.g. a salary gap.
+	MissingMonths []string `json:"missingMonths"`
+
+	// ExcludedTransactions are the statement transactions dropped for starting with an excluded note prefix,
+	// set only when the calculation is created from its statement.
+	ExcludedTransactions ExcludedTransactions `json:"excludedTransactions"`
+
+	// config is the configuration the calculation is created under,
+	// saved only when the calculation is created, see GetCalculationConfig.
+	config *CalculationConfig
 }
 
-func (c *Calculation) ReCalculate(by string, in *RecalculateReq) error {
+// ReCalculate recalculates the income from the given breakdowns,
+// with the other income counted at the given factor.
+func (c *Calculation) ReCalculate(by string, in *RecalculateReq, otherIncomeFactor decimal.Decimal) error {
 	c.SalaryBreakdown = newSalaryBreakdown(in.MonthlySalaries)
 	c.AllowanceBreakdown = newAllowanceBreakdown(in.Allowances)
 	c.CommissionBreakdown = newCommissionBreakdown(in.Commissions)
@@ -64,13 +105,15 @@ func (c *Calculation) ReCalculate(by string, in *RecalculateReq) error {
 
 	c.UpdatedAt = time.Now()
 	c.UpdatedBy = by
-	c.populate(c.Product, c.PeriodInMonth, c.ExchangeRate, mapCal)
+	c.populate(c.Product, c.PeriodInMonth, c.ExchangeRate, otherIncomeFactor, c.OtherIncomeCapPercentage, mapCal)
 	return nil
 }
 
 func (c *Calculation) Complete(by string) {
+	now := time.Now()
 	c.Status = types.StatusCompleted
-	c.UpdatedAt = time.Now()
+	c.CompletedAt = &now
+	c.UpdatedAt = now
 	c.UpdatedBy = by
 }
 
@@ -78,39 +121,103 @@ func (c *Calculation) IsCompleted() bool {
 	return c.Status == types.StatusCompleted
 }
 
+// canRecalculate reports whether the user can recalculate the calculation at the given time.
+// A completed calculation can only be recalculated by its creator within the grace period after completion.
+func (c *Calculation) canRecalculate(username string, grace time.Duration, now time.Time) bool {
+	if !c.IsCompleted() {
+		return true
+	}
+
+	if grace <= 0 || c.CompletedAt == nil || c.CreatedBy != username {
+		return false
+	}
+
+	return now.Before(c.CompletedAt.Add(grace))
+}
+
+// newSalaryBreakdown returns the breakdown of the given monthly salaries.
+// The totals and times received are recomputed from the transactions, the given ones are ignored.
 func newSalaryBreakdown(months []MonthlySalary) *SalaryBreakdown {
+	for i := range months {
+		months[i].Total = sumTransactions(months[i].Transactions)
+		months[i].TimesReceived = decimal.NewFromInt(int64(len(months[i].Transactions)))
+	}
+
 	return &SalaryBreakdown{
 		MonthlySalaries: months,
 	}
 }
 
+// newAllowanceBreakdown returns the breakdown of the given allowances.
+// The totals are recomputed from the transactions, the given ones are ignored.
 func newAllowanceBreakdown(allowances []Allowance) *AllowanceBreakdown {
+	for i := range allowances {
+		allowances[i].Total = sumTransactions(allowances[i].Transactions)
+	}
+
 	return &AllowanceBreakdown{
 		Allowances: allowances,
 	}
 }
 
+// newCommissionBreakdown returns the breakdown of the given commissions.
+// The totals are recomputed from the transactions, the given ones are ignored.
 func newCommissionBreakdown(commissions []Commission) *CommissionBreakdown {
+	for i := range commissions {
+		commissions[i].Total = sumTransactions(commissions[i].Transactions)
+	}
+
 	return &CommissionBreakdown{
 		Commissions: commissions,
 	}
 }
 
-func (c *Calculation) populate(product types.ProductType, period, exchangeRate decimal.Decimal, incomes statMap) {
+func (c *Calculation) populate(product types.ProductType, period, exchangeRate, otherIncomeFactor, otherIncomeCapPercentage decimal.Decimal, incomes statMap) {
 	c.Source = newSourceIncome(incomes, product, period)
 	c.BasicSalaryFromInterview = incomes.basicSalaryFromInterview()
 	c.AllowanceBreakdown = incomes.toListAllowances()
 	c.CommissionBreakdown = incomes.toListCommissions(period)
 	c.SalaryBreakdown = incomes.toListMonthlySalaries()
+	c.SalaryVariation = c.SalaryBreakdown.VariationCoefficient
 	c.PeriodInMonth = period
 	c.TotalBasicSalary = incomes.totalBasicSalary(product, period)
 	c.TotalIncome = incomes.totalIncome(product)
 	c.TotalOtherIncome = incomes.totalOtherIncome(period)
 	c.MonthlyOtherIncome = incomes.averageOtherIncome(period)
-	c.EightyPercentOfMonthlyOtherIncome = incomes.averageOtherIncomeIn80Percent(period)
-	c.MonthlyAverageIncome = incomes.averageMonthlyIncome(product, period)
-	c.MonthlyNetIncome = incomes.netIncomeMonthly(product, exchangeRate, period)
+	c.EightyPercentOfMonthlyOtherIncome = incomes.averageOtherIncomeIn80Percent(period, otherIncomeFactor)
+	c.MonthlyAverageIncome = incomes.averageMonthlyIncome(product, period, otherIncomeFactor, otherIncomeCapPercentage)
+	c.MonthlyNetIncome = incomes.netIncomeMonthly(product, exchangeRate, period, otherIncomeFactor, otherIncomeCapPercentage)
 	c.ExchangeRate = exchangeRate
+	c.MissingMonths = missingSalaryMonths(c.StartedAt, c.EndedAt, c.SalaryBreakdown)
+}
+
+// missingSalaryMonths returns the months in [from, to] in chronological order
+// that have no salary transactions in the given breakdown.
+func missingSalaryMonths(from, to time.Time, salaries *SalaryBreakdown) []string {
+	missing := make([]string, 0)
+	if from.IsZero() || to.Before(from) {
+		return missing
+	}
+
+	received := make(map[string]bool)
+	if salaries != nil {
+		for _, m := range salaries.MonthlySalaries {
+			if len(m.Transactions) > 0 {
+				received[m.Month] = true
+			}
+		}
+	}
+
+	month := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, from.Location())
+	last := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, to.Location())
+	for !month.After(last) {
+		if key := month.Format("January-2006"); !received[key] {
+			missing = append(missing, key)
+		}
+		month = month.AddDate(0, 1, 0)
+	}
+
+	return missing
 }
 
 type Account struct {
@@ -149,9 +256,10 @@ type MonthlySalary struct {
 }
 
 type SalaryBreakdown struct {
-	MonthlySalaries []MonthlySalary `json:"monthlySalaries"`
-	BasicSalary     decimal.Decimal `json:"basicSalary"`
-	Total           decimal.Decimal `json:"total"`
+	MonthlySalaries      []MonthlySalary `json:"monthlySalaries"`
+	BasicSalary          decimal.Decimal `json:"basicSalary"`
+	Total                decimal.Decimal `json:"total"`
+	VariationCoefficient decimal.Decimal `json:"variationCoefficient"`
 }
 
 func (s SalaryBreakdown) Length() decimal.Decimal {
@@ -221,6 +329,10 @@ func newCalculation(by string, number, statementFileName string, product types.P
 		StatementFileName:                 statementFileName,
 		Product:                           product,
 		ExchangeRate:                      decimal.NewFromInt(1),
+		ExchangeRateSource:                ExchangeRateSourceDefault,
+		IncomeDirection:                   DefaultIncomeDirection,
+		OtherIncomeCapPercentage:          decimal.Zero,
+		SalaryVariation:                   decimal.Zero,
 		BasicSalaryFromInterview:          decimal.Zero,
 		MonthlyAverageIncome:              decimal.Zero,
 		MonthlyNetIncome:                  decimal.Zero,
@@ -234,6 +346,7 @@ func newCalculation(by string, number, statementFileName string, product types.P
 		CreatedAt:                         now,
 		UpdatedBy:                         by,
 		UpdatedAt:                         now,
+		ExcludedTransactions:              make(ExcludedTransactions, 0),
 	}
 }
 
@@ -305,10 +418,46 @@ type CalculationQuery struct {
 	Product            string    `query:"product"`
 	Number             string    `query:"number"`
 	AccountDisplayName string    `query:"accountDisplayName"`
+	ExchangeRateSource string    `query:"exchangeRateSource"`
 	CreatedAfter       time.Time `query:"createdAfter"`
 	CreatedBefore      time.Time `query:"createdBefore"`
 	PageSize           uint64    `query:"pageSize"`
 	PageToken          string    `query:"pageToken"`
+	OrderBy            string    `query:"orderBy"`
+	OrderDir           string    `query:"orderDir"`
+
+	// Currency keeps the calculations of the accounts in this currency.
+	Currency string `query:"currency"`
+
+	// attention restricts the calculations to those needing attention, see ListNeedingAttention.
+	attention sq.Sqlizer
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+}
+
+// calculationOrderColumns are the columns the calculations can be ordered by.
+var calculationOrderColumns = map[string]pager.Column{
+	"createdAt":        {Name: "created_at", Time: true},
+	"number":           {Name: "number"},
+	"monthlyNetIncome": {Name: "monthly_net_income"},
+}
+
+// order returns the order of the calculations, newest first by default.
+func (q *CalculationQuery) order() (*pager.Order, error) {
+	return pager.ParseOrder(q.OrderBy, q.OrderDir, "createdAt", calculationOrderColumns)
+}
+
+// orderValue returns the value of the calculation kept in the cursor for the given order.
+func (c *Calculation) orderValue(o *pager.Order) string {
+	switch o.By {
+	case "number":
+		return c.Number
+	case "monthlyNetIncome":
+		return c.MonthlyNetIncome.String()
+	}
+
+	return ""
 }
 
 func (q *CalculationQuery) ToSQL() (string, []any, error) {
@@ -325,6 +474,19 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 	if q.AccountDisplayName != "" {
 		and = append(and, sq.Expr("account_display_name LIKE ?", "%"+q.AccountDisplayName+"%"))
 	}
+	if q.ExchangeRateSource != "" {
+		and = append(and, sq.Eq{"exchange_rate_source": strings.ToUpper(strings.TrimSpace(q.ExchangeRateSource))})
+	}
+	if q.Currency != "" {
+		and = append(and, sq.Eq{"account_currency": strings.ToUpper(strings.TrimSpace(q.Currency))})
+	}
+	if q.attention != nil {
+		and = append(and, q.attention)
+	}
+
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"created_by": q.createdBy})
+	}
 
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
@@ -335,9 +497,14 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 	}
 
 	if q.PageToken != "" {
+		order, err := q.order()
+		if err != nil {
+			return "", nil, err
+		}
+
 		cursor, err := pager.DecodeCursor(q.PageToken)
 		if err == nil {
-			and = append(and, sq.Lt{"created_at": cursor.Time})
+			and = append(and, order.After(cursor, "id"))
 		}
 	}
 
@@ -346,7 +513,19 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 
 // saveCalculationIncome saves the calculation to the database.
 func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) error {
-	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+	defer database.TimeQuery("income.saveCalculationIncome")()
+
+	err := database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		// A new calculation is only inserted, so a number already used is reported by the unique index
+		// instead of overwriting the calculation of the number. The loaded calculations are updated.
+		if in.ID == 0 {
+			if err := insertCalculationIncome(ctx, tx, in); err != nil {
+				return err
+			}
+
+			return saveCalculationSnapshot(ctx, tx, in)
+		}
+
 		updatedQuery, args := sq.Update("statement_file_analysis").
 			Set("statement_file_name", in.StatementFileName).
 			Set("number", in.Number).
@@ -355,6 +534,12 @@ func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) err
 			Set("account_number", in.Account.Number).
 			Set("account_display_name", in.Account.DisplayName).
 			Set("exchange_rate", in.ExchangeRate).
+			Set("exchange_rate_source", in.ExchangeRateSource).
+			Set("income_direction", in.IncomeDirection.String()).
+			Set("other_income_cap_percentage", in.OtherIncomeCapPercentage).
+			Set("salary_variation", in.SalaryVariation).
+			Set("salary_volatile", in.SalaryVolatile).
+			Set("net_income_out_of_range", in.NetIncomeOutOfRange).
 			Set("total_income", in.TotalIncome).
 			Set("basic_salary_interview", in.BasicSalaryFromInterview).
 			Set("total_basic_salary", in.TotalBasicSalary).
@@ -373,6 +558,7 @@ func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) err
 			Set("commission", in.CommissionBreakdown.Bytes()).
 			Set("updated_by", in.UpdatedBy).
 			Set("updated_at", in.UpdatedAt).
+			Set("completed_at", in.CompletedAt).
 			Where(sq.Eq{
 				"number": in.Number,
 			}).
@@ -390,77 +576,110 @@ func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) err
 		}
 
 		if rowsAffected == 0 {
-			insertQuery, args := sq.Insert("statement_file_analysis").
-				Columns(
-					"statement_file_name",
-					"number",
-					"product",
-					"account_currency",
-					"account_number",
-					"account_display_name",
-					"exchange_rate",
-					"basic_salary_interview",
-					"total_income",
-					"total_basic_salary",
-					"total_other_income",
-					"eighty_percent_of_monthly_other_income",
-					"monthly_other_income",
-					"monthly_net_income",
-					"monthly_average_income",
-					"period_in_month",
-					"started_at",
-					"ended_at",
-					"status",
-					"source_income",
-					"monthly_salary",
-					"allowance",
-					"commission",
-					"created_by",
-					"created_at",
-				).
-				Values(
-					in.StatementFileName,
-					in.Number,
-					in.Product,
-					in.Account.Currency,
-					in.Account.Number,
-					in.Account.DisplayName,
-					in.ExchangeRate,
-					in.BasicSalaryFromInterview,
-					in.TotalIncome,
-					in.TotalBasicSalary,
-					in.TotalOtherIncome,
-					in.EightyPercentOfMonthlyOtherIncome,
-					in.MonthlyOtherIncome,
-					in.MonthlyNetIncome,
-					in.MonthlyAverageIncome,
-					in.PeriodInMonth,
-					in.StartedAt,
-					in.EndedAt,
-					in.Status.String(),
-					in.Source.Bytes(),
-					in.SalaryBreakdown.Bytes(),
-					in.AllowanceBreakdown.Bytes(),
-					in.CommissionBreakdown.Bytes(),
-					in.CreatedBy,
-					in.CreatedAt,
-				).
-				Suffix("SELECT SCOPE_IDENTITY()").
-				PlaceholderFormat(sq.AtP).
-				MustSql()
-
-			row := tx.QueryRowContext(ctx, insertQuery, args...)
-			if err := row.Scan(&in.ID); err != nil {
-				return fmt.Errorf("failed to insert calculation: %w", err)
+			if err := insertCalculationIncome(ctx, tx, in); err != nil {
+				return err
 			}
-			return nil
 		}
 
-		return nil
+		return saveCalculationSnapshot(ctx, tx, in)
 	})
+	if database.IsUniqueViolation(err) {
+		return rpcStatus.New(
+			codes.AlreadyExists,
+			"Calculation with this number already exists. Please use a different number.",
+		).Err()
+	}
+
+	return err
+}
+
+func insertCalculationIncome(ctx context.Context, tx *sql.Tx, in *Calculation) error {
+	insertQuery, args := sq.Insert("statement_file_analysis").
+		Columns(
+			"statement_file_name",
+			"number",
+			"product",
+			"account_currency",
+			"account_number",
+			"account_display_name",
+			"exchange_rate",
+			"exchange_rate_source",
+			"income_direction",
+			"other_income_cap_percentage",
+			"salary_variation",
+			"salary_volatile",
+			"net_income_out_of_range",
+			"basic_salary_interview",
+			"total_income",
+			"total_basic_salary",
+			"total_other_income",
+			"eighty_percent_of_monthly_other_income",
+			"monthly_other_income",
+			"monthly_net_income",
+			"monthly_average_income",
+			"period_in_month",
+			"started_at",
+			"ended_at",
+			"status",
+			"source_income",
+			"monthly_salary",
+			"allowance",
+			"commission",
+			"config",
+			"excluded_transactions",
+			"created_by",
+			"created_at",
+		).
+		Values(
+			in.StatementFileName,
+			in.Number,
+			in.Product,
+			in.Account.Currency,
+			in.Account.Number,
+			in.Account.DisplayName,
+			in.ExchangeRate,
+			in.ExchangeRateSource,
+			in.IncomeDirection.String(),
+			in.OtherIncomeCapPercentage,
+			in.SalaryVariation,
+			in.SalaryVolatile,
+			in.NetIncomeOutOfRange,
+			in.BasicSalaryFromInterview,
+			in.TotalIncome,
+			in.TotalBasicSalary,
+			in.TotalOtherIncome,
+			in.EightyPercentOfMonthlyOtherIncome,
+			in.MonthlyOtherIncome,
+			in.MonthlyNetIncome,
+			in.MonthlyAverageIncome,
+			in.PeriodInMonth,
+			in.StartedAt,
+			in.EndedAt,
+			in.Status.String(),
+			in.Source.Bytes(),
+			in.SalaryBreakdown.Bytes(),
+			in.AllowanceBreakdown.Bytes(),
+			in.CommissionBreakdown.Bytes(),
+			in.config.Bytes(),
+			in.ExcludedTransactions.Bytes(),
+			in.CreatedBy,
+			in.CreatedAt,
+		).
+		Suffix("SELECT SCOPE_IDENTITY()").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	row := tx.QueryRowContext(ctx, insertQuery, args...)
+	if err := row.Scan(&in.ID); err != nil {
+		return fmt.Errorf("failed to insert calculation: %w", err)
+	}
+
+	return nil
 }
 
 func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("income.listCalculations")()
+
 	id := fmt.Sprintf("TOP %d id", pager.Size(in.PageSize))
 
 	pred, args, err := in.ToSQL()
@@ -468,6 +687,11 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
 	q, args := sq.Select(
 		id,
 		"statement_file_name",
@@ -477,6 +701,12 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		"account_number",
 		"account_display_name",
 		"exchange_rate",
+		"exchange_rate_source",
+		"income_direction",
+		"other_income_cap_percentage",
+		"salary_variation",
+		"salary_volatile",
+		"net_income_out_of_range",
 		"basic_salary_interview",
 		"total_income",
 		"total_basic_salary",
@@ -493,14 +723,16 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		"monthly_salary",
 		"allowance",
 		"commission",
+		"excluded_transactions",
 		"created_by",
 		"created_at",
 		"updated_by",
 		"updated_at",
+		"completed_at",
 	).
 		From("statement_file_analysis").
 		Where(pred, args...).
-		OrderBy("created_at DESC").
+		OrderBy(order.OrderBy("id")...).
 		PlaceholderFormat(sq.AtP).
 		MustSql()
 
@@ -513,7 +745,8 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 	calculations := make([]*Calculation, 0)
 	for rows.Next() {
 		c := new(Calculation)
-		var source, salaries, allowances, commissions []byte
+		var source, salaries, allowances, commissions, excluded []byte
+		var completedAt sql.NullTime
 		err := rows.Scan(
 			&c.ID,
 			&c.StatementFileName,
@@ -523,6 +756,12 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 			&c.Account.Number,
 			&c.Account.DisplayName,
 			&c.ExchangeRate,
+			&c.ExchangeRateSource,
+			&c.IncomeDirection,
+			&c.OtherIncomeCapPercentage,
+			&c.SalaryVariation,
+			&c.SalaryVolatile,
+			&c.NetIncomeOutOfRange,
 			&c.BasicSalaryFromInterview,
 			&c.TotalIncome,
 			&c.TotalBasicSalary,
@@ -539,10 +778,12 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 			&salaries,
 			&allowances,
 			&commissions,
+			&excluded,
 			&c.CreatedBy,
 			&c.CreatedAt,
 			&c.UpdatedBy,
 			&c.UpdatedAt,
+			&completedAt,
 		)
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCalculationNotFound
@@ -550,6 +791,9 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan calculation: %w", err)
 		}
+		if completedAt.Valid {
+			c.CompletedAt = &completedAt.Time
+		}
 
 		component := new(Source)
 		if err := json.Unmarshal(source, component); err != nil {
@@ -575,6 +819,15 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		c.SalaryBreakdown = salaryBreakdown
 		c.AllowanceBreakdown = allowanceBreakdown
 		c.CommissionBreakdown = commissionBreakdown
+		c.MissingMonths = missingSalaryMonths(c.StartedAt, c.EndedAt, salaryBreakdown)
+
+		// The calculations created before the excluded transactions were kept have none.
+		c.ExcludedTransactions = make(ExcludedTransactions, 0)
+		if excluded != nil {
+			if err := json.Unmarshal(excluded, &c.ExcludedTransactions); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal excluded transactions: %w", err)
+			}
+		}
 
 		calculations = append(calculations, c)
 	}
@@ -633,7 +886,8 @@ type Transaction struct {
 }
 
 type ListTransactionsResult struct {
-	Transactions []*Transaction `json:"transactions"`
+	Transactions  []*Transaction `json:"transactions"`
+	NextPageToken string         `json:"nextPageToken"`
 }
 
 type TransactionReq struct {
@@ -645,6 +899,9 @@ type TransactionReq struct {
 
 	// Month in MMYYYY format
 	Month types.MMYYY `json:"month"`
+
+	PageSize  uint64 `json:"pageSize"`
+	PageToken string `json:"pageToken"`
 }
 
 func (r *TransactionReq) Validate() error {
@@ -726,10 +983,24 @@ type BatchGetCalculationsQuery struct {
 	Product            string    `query:"product"`
 	Number             string    `query:"number"`
 	AccountDisplayName string    `query:"accountDisplayName"`
+	ExchangeRateSource string    `query:"exchangeRateSource"`
 	CreatedAfter       time.Time `query:"createdAfter"`
 	CreatedBefore      time.Time `query:"createdBefore"`
 
+	// WithInterviewBasicSalary adds the basic salary from interview to the exported calculations.
+	WithInterviewBasicSalary bool `query:"withInterviewBasicSalary"`
+
+	// ResumeID resumes an interrupted export from the calculations with an ID lower than it,
+	// i.e. the next ID returned by the previous export. Zero starts from the newest calculation.
+	ResumeID int64 `query:"nextId"`
+
+	// Limit is the maximum number of calculations read by an export. Zero reads them all.
+	Limit int `query:"limit"`
+
 	nextID int64
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
 }
 
 func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
@@ -746,6 +1017,13 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 	if q.AccountDisplayName != "" {
 		and = append(and, sq.Expr("account_display_name LIKE ?", "%"+q.AccountDisplayName+"%"))
 	}
+	if q.ExchangeRateSource != "" {
+		and = append(and, sq.Eq{"exchange_rate_source": strings.ToUpper(strings.TrimSpace(q.ExchangeRateSource))})
+	}
+
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"created_by": q.createdBy})
+	}
 
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
@@ -763,6 +1041,8 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 }
 
 func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID int64, in *BatchGetCalculationsQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("income.batchGetCalculations")()
+
 	id := fmt.Sprintf("TOP %d id", batchSize)
 	in.nextID = nextID
 	pred, args, err := in.ToSQL()
@@ -779,6 +1059,13 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 		"account_number",
 		"account_display_name",
 		"exchange_rate",
+		"exchange_rate_source",
+		"income_direction",
+		"other_income_cap_percentage",
+		"salary_variation",
+		"salary_volatile",
+		"net_income_out_of_range",
+		"basic_salary_interview",
 		"total_income",
 		"total_basic_salary",
 		"total_other_income",
@@ -796,6 +1083,7 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 		"created_at",
 		"updated_by",
 		"updated_at",
+		"completed_at",
 	).
 		From("statement_file_analysis").
 		Where(pred, args...).
@@ -813,6 +1101,7 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 	for rows.Next() {
 		c := new(Calculation)
 		var source, salaries, allowances, commissions []byte
+		var completedAt sql.NullTime
 		err := rows.Scan(
 			&c.ID,
 			&c.StatementFileName,
@@ -822,6 +1111,13 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 			&c.Account.Number,
 			&c.Account.DisplayName,
 			&c.ExchangeRate,
+			&c.ExchangeRateSource,
+			&c.IncomeDirection,
+			&c.OtherIncomeCapPercentage,
+			&c.SalaryVariation,
+			&c.SalaryVolatile,
+			&c.NetIncomeOutOfRange,
+			&c.BasicSalaryFromInterview,
 			&c.TotalIncome,
 			&c.TotalBasicSalary,
 			&c.TotalOtherIncome,
@@ -839,6 +1135,7 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 			&c.CreatedAt,
 			&c.UpdatedBy,
 			&c.UpdatedAt,
+			&completedAt,
 		)
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrCalculationNotFound
@@ -846,6 +1143,9 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan calculation: %w", err)
 		}
+		if completedAt.Valid {
+			c.CompletedAt = &completedAt.Time
+		}
 
 		component := new(Source)
 		if err := json.Unmarshal(source, component); err != nil {
@@ -871,6 +1171,7 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 		c.SalaryBreakdown = salaryBreakdown
 		c.AllowanceBreakdown = allowanceBreakdown
 		c.CommissionBreakdown = commissionBreakdown
+		c.MissingMonths = missingSalaryMonths(c.StartedAt, c.EndedAt, salaryBreakdown)
 
 		calculations = append(calculations, c)
 	}
@@ -880,3 +1181,39 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 
 	return calculations, nil
 }
+
+// paginateTransactions orders the transactions by date then bill number and returns the page of the token.
+// The transactions are parsed from a file, so the token holds the offset of the page in the ordered transactions.
+// An invalid token starts from the first page.
+func paginateTransactions(txs []*Transaction, pageSize uint64, pageToken string) ([]*Transaction, string) {
+	sort.SliceStable(txs, func(i, j int) bool {
+		a, b := time.Time(txs[i].Date), time.Time(txs[j].Date)
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+
+		return txs[i].BillNumber < txs[j].BillNumber
+	})
+
+	var offset int
+	if pageToken != "" {
+		if cursor, err := pager.DecodeCursor(pageToken); err == nil {
+			if n, err := strconv.Atoi(cursor.ID); err == nil && n > 0 {
+				offset = n
+			}
+		}
+	}
+	if offset >= len(txs) {
+		return make([]*Transaction, 0), ""
+	}
+
+	end := offset + int(pager.Size(pageSize))
+	if end >= len(txs) {
+		return txs[offset:], ""
+	}
+
+	return txs[offset:end], pager.EncodeCursor(&pager.Cursor{
+		ID:   strconv.Itoa(end),
+		Time: time.Time(txs[end-1].Date),
+	})
+}
@@ -0,0 +1,215 @@
+package income
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// newTestCalculation returns a new calculation of the number ready to be saved.
+func newTestCalculation(number string) *Calculation {
+	c := newCalculation("ann", number, "statement.xlsx", types.ProductSA)
+	c.Source = &Source{}
+	c.SalaryBreakdown = &SalaryBreakdown{}
+	c.AllowanceBreakdown = &AllowanceBreakdown{}
+	c.CommissionBreakdown = &CommissionBreakdown{}
+	return c
+}
+
+func TestSaveCalculationIncomeConcurrentCreate(t *testing.T) {
+	db, mock := dbtest.New(t)
+
+	// Both creations passed the isCalculationExists pre-check,
+	// the fake driver answers the insert of the second one as the unique index on the number would.
+	// It checks the handling of the violation, not the index itself.
+	mock.ExpectQuery(`INSERT INTO statement_file_analysis \(`).WillReturnRows([]string{"id"}, []any{1})
+	mock.ExpectQuery(`INSERT INTO statement_file_analysis \(`).WillReturnError(dbtest.SQLError{Number: 2627})
+	mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = saveCalculationIncome(context.Background(), db, newTestCalculation("APP-1"))
+		}()
+	}
+	wg.Wait()
+
+	var created, exists int
+	for _, err := range errs {
+		switch rpcStatus.Code(err) {
+		case codes.OK:
+			created++
+		case codes.AlreadyExists:
+			exists++
+		default:
+			t.Errorf("saveCalculationIncome() error = %v", err)
+		}
+	}
+	if created != 1 || exists != 1 {
+		t.Errorf("got %d created and %d already exists, want 1 and 1", created, exists)
+	}
+}
+
+func TestSaveCalculationIncomeUpdatesLoadedCalculation(t *testing.T) {
+	db, mock := dbtest.New(t)
+	mock.ExpectExec(`UPDATE statement_file_analysis`)
+	mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+
+	c := newTestCalculation("APP-1")
+	c.ID = 7
+	if err := saveCalculationIncome(context.Background(), db, c); err != nil {
+		t.Fatalf("saveCalculationIncome() error = %v", err)
+	}
+}
+
+func TestCalculateIncomeMissingMonths(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 30/04/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+		credit("25/04/2025", "Salary April", 5000000),
+	)
+	s, mock := newCalculateTestService(t)
+	expectStatement(mock, file, salaryWordlist())
+	expectCurrency(mock, "LAK", "1")
+	expectSave(mock)
+
+	calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+	if err != nil {
+		t.Fatalf("CalculateIncome() error = %v", err)
+	}
+	if !slices.Equal(calculation.MissingMonths, []string{"February-2025"}) {
+		t.Errorf("missing months = %v, want [February-2025]", calculation.MissingMonths)
+	}
+}
+
+func TestMissingSalaryMonths(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC)
+	salaries := func(months ...string) *SalaryBreakdown {
+		b := &SalaryBreakdown{}
+		for _, m := range months {
+			b.MonthlySalaries = append(b.MonthlySalaries, MonthlySalary{Month: m, Transactions: []Transaction{{}}})
+		}
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		salaries *SalaryBreakdown
+		want     []string
+	}{
+		{name: "every month paid", from: from, to: to, salaries: salaries("January-2025", "February-2025", "March-2025", "April-2025"), want: []string{}},
+		{name: "skipped months", from: from, to: to, salaries: salaries("January-2025", "April-2025"), want: []string{"February-2025", "March-2025"}},
+		{name: "month without transactions", from: from, to: to,
+			salaries: &SalaryBreakdown{MonthlySalaries: []MonthlySalary{{Month: "January-2025"}}},
+			want:     []string{"January-2025", "February-2025", "March-2025", "April-2025"}},
+		{name: "no salaries", from: from, to: from, want: []string{"January-2025"}},
+		{name: "no period", to: to, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingSalaryMonths(tt.from, tt.to, tt.salaries); !slices.Equal(got, tt.want) {
+				t.Errorf("missingSalaryMonths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateTransactions(t *testing.T) {
+	day := func(d int) types.DDMMYYYY {
+		return types.DDMMYYYY(time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC))
+	}
+	txs := []*Transaction{
+		{Date: day(3), BillNumber: "B-1"},
+		{Date: day(1), BillNumber: "B-9"},
+		{Date: day(2), BillNumber: "B-2"},
+		{Date: day(1), BillNumber: "B-3"},
+		{Date: day(2), BillNumber: "B-1"},
+	}
+	key := func(page []*Transaction) []string {
+		keys := make([]string, 0, len(page))
+		for _, tx := range page {
+			keys = append(keys, time.Time(tx.Date).Format("02")+"/"+tx.BillNumber)
+		}
+		return keys
+	}
+
+	// Ordered by date then bill number, two per page.
+	wantPages := [][]string{
+		{"01/B-3", "01/B-9"},
+		{"02/B-1", "02/B-2"},
+		{"03/B-1"},
+	}
+
+	var token string
+	for i, want := range wantPages {
+		var page []*Transaction
+		page, token = paginateTransactions(txs, 2, token)
+		if got := key(page); !slices.Equal(got, want) {
+			t.Errorf("page %d = %v, want %v", i, got, want)
+		}
+		if last := i == len(wantPages)-1; last != (token == "") {
+			t.Errorf("page %d next page token = %q, want one only before the last page", i, token)
+		}
+	}
+
+	// A page ending on the last transaction has no next page.
+	if page, token := paginateTransactions(txs, 5, ""); len(page) != 5 || token != "" {
+		t.Errorf("full page = %d transactions with token %q, want 5 without a token", len(page), token)
+	}
+}
+
+func TestCalculationDecimalFormat(t *testing.T) {
+	t.Cleanup(func() { types.SetDecimalFormat(types.DefaultDecimalFormat) })
+
+	c := newTestCalculation("APP-1")
+	c.MonthlyNetIncome = decimal.RequireFromString("5000000.5")
+	c.MonthlyAverageIncome = decimal.NewFromInt(5000000)
+	c.TotalIncome = decimal.NewFromInt(15000000)
+
+	tests := []struct {
+		format types.DecimalFormat
+		want   map[string]any
+	}{
+		{format: types.DecimalFormatString, want: map[string]any{
+			"monthlyNetIncome": "5000000.5", "monthlyAverageIncome": "5000000", "totalIncome": "15000000",
+		}},
+		{format: types.DecimalFormatNumber, want: map[string]any{
+			"monthlyNetIncome": 5000000.5, "monthlyAverageIncome": 5000000.0, "totalIncome": 15000000.0,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			types.SetDecimalFormat(tt.format)
+
+			b, err := json.Marshal(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			for field, want := range tt.want {
+				if got[field] != want {
+					t.Errorf("%s = %#v, want %#v", field, got[field], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package income
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// CalculationConfig is the configuration a calculation was created under.
+// It is recorded once when the calculation is created and never updated,
+// so the calculation can be reproduced after the settings change.
+type CalculationConfig struct {
+	OtherIncomeFactor        decimal.Decimal        `json:"otherIncomeFactor"`
+	OtherIncomeCapPercentage decimal.Decimal        `json:"otherIncomeCapPercentage"`
+	SalaryVariationThreshold decimal.Decimal        `json:"salaryVariationThreshold"`
+	BaseCurrency             string                 `json:"baseCurrency"`
+	MinPeriodInMonths        int64                  `json:"minPeriodInMonths"`
+	IncomeDirection          IncomeDirection        `json:"incomeDirection"`
+	NumberFormat             statement.NumberFormat `json:"numberFormat"`
+	MergeSameDayCredits      bool                   `json:"mergeSameDayCredits"`
+	ExcludePartialFinalMonth bool                   `json:"excludePartialFinalMonth"`
+	ExcludedNotePrefixes     []string               `json:"excludedNotePrefixes"`
+	RecordedAt               time.Time              `json:"recordedAt"`
+}
+
+// Bytes returns the JSON encoding of the configuration, nil if there is none.
+func (c *CalculationConfig) Bytes() []byte {
+	if c == nil {
+		return nil
+	}
+
+	b, _ := json.Marshal(c)
+	return b
+}
+
+// CalculationConfigResult is the configuration of the calculation of the given number.
+type CalculationConfigResult struct {
+	Number string             `json:"number"`
+	Config *CalculationConfig `json:"config"`
+}
+
+// GetCalculationConfig returns the configuration the calculation of the given number was created under.
+// The calculations created before the configuration was recorded have none.
+func (s *Service) GetCalculationConfig(ctx context.Context, number string) (*CalculationConfigResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetCalculationConfig"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	result, err := getCalculationConfig(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation config", zap.Error(err))
+		return nil, err
+	}
+	if result.Config == nil {
+		return nil, rpcStatus.Error(codes.NotFound, "Configuration was not recorded for this calculation")
+	}
+
+	return result, nil
+}
+
+// getCalculationConfig reads only the configuration of the first calculation matching the query.
+func getCalculationConfig(ctx context.Context, db *sql.DB, in *CalculationQuery) (*CalculationConfigResult, error) {
+	defer database.TimeQuery("income.getCalculationConfig")()
+
+	pred, args, err := in.ToSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.
+		Select(
+			"TOP 1 number",
+			"config",
+		).
+		From("statement_file_analysis").
+		Where(pred, args...).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	var r CalculationConfigResult
+	var config []byte
+	err = db.QueryRowContext(ctx, q, args...).Scan(&r.Number, &config)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCalculationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan calculation config: %w", err)
+	}
+
+	if config != nil {
+		r.Config = new(CalculationConfig)
+		if err := json.Unmarshal(config, r.Config); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal calculation config: %w", err)
+		}
+	}
+
+	return &r, nil
+}
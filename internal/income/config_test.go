@@ -0,0 +1,92 @@
+package income
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// Indexes of the arguments of the insert of a calculation.
+const (
+	netIncomeOutOfRangeArg = 12
+	configArg              = 29
+)
+
+func TestGetCalculationConfig(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+	)
+
+	s, mock := newCalculateTestService(t)
+	settingsSvc, err := settings.NewService(context.Background(), s.db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSettings(settingsSvc)
+	if err := s.SetMinPeriod(types.ProductSA, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatement(mock, file, salaryWordlist())
+	mock.ExpectQuery(`FROM settings`)
+	expectCurrency(mock, "LAK", "1")
+	insert := expectSave(mock)
+	if _, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA)); err != nil {
+		t.Fatalf("CalculateIncome() error = %v", err)
+	}
+	saved, ok := insert.Args()[configArg].([]byte)
+	if !ok || len(saved) == 0 {
+		t.Fatalf("config saved = %v, want the configuration", insert.Args()[configArg])
+	}
+
+	// The settings change after the calculation is created.
+	mock.ExpectExec(`UPDATE settings`)
+	mock.ExpectQuery(`FROM settings`).WillReturnRows([]string{"name", "value", "updated_by", "updated_at"},
+		[]any{"income.other_income_factor", "0.5", "admin@example.com", time.Now()},
+	)
+	factor := decimal.NewFromFloat(0.5)
+	admin := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+	if _, err := settingsSvc.UpdateSettings(admin, &settings.UpdateReq{OtherIncomeFactor: &factor}); err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+
+	get := mock.ExpectQuery(`TOP 1 number,\s*config FROM statement_file_analysis`).WillReturnRows([]string{"number", "config"}, []any{"APP-1", saved})
+	result, err := s.GetCalculationConfig(userContext(), "APP-1")
+	if err != nil {
+		t.Fatalf("GetCalculationConfig() error = %v", err)
+	}
+	if got := get.Args(); len(got) != 2 || got[0] != "APP-1" || got[1] != "user@example.com" {
+		t.Errorf("query args = %v, want the number and the creator", got)
+	}
+
+	config := result.Config
+	if !config.OtherIncomeFactor.Equal(decimal.NewFromFloat(0.8)) {
+		t.Errorf("other income factor = %s, want the 0.8 in force when the calculation was created", config.OtherIncomeFactor)
+	}
+	if config.BaseCurrency != "LAK" {
+		t.Errorf("base currency = %q, want LAK", config.BaseCurrency)
+	}
+	if config.MinPeriodInMonths != 2 {
+		t.Errorf("min period in months = %d, want 2", config.MinPeriodInMonths)
+	}
+	if config.RecordedAt.IsZero() {
+		t.Error("recorded at is not set")
+	}
+
+	// A calculation created before the configuration was recorded has none.
+	mock.ExpectQuery(`TOP 1 number,\s*config`).WillReturnRows([]string{"number", "config"}, []any{"APP-2", nil})
+	_, err = s.GetCalculationConfig(userContext(), "APP-2")
+	if st, _ := rpcStatus.FromError(err); st.Code() != codes.NotFound {
+		t.Errorf("GetCalculationConfig() without a config error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,100 @@
+package income
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+)
+
+// CountsByProduct is the number of calculations by product name, e.g. "SA".
+type CountsByProduct map[string]int64
+
+type CountsQuery struct {
+	CreatedAfter  time.Time `query:"createdAfter"`
+	CreatedBefore time.Time `query:"createdBefore"`
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+}
+
+func (q *CountsQuery) ToSQL() (string, []any, error) {
+	and := sq.And{}
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"created_by": q.createdBy})
+	}
+	if !q.CreatedAfter.IsZero() {
+		and = append(and, sq.GtOrEq{"created_at": q.CreatedAfter})
+	}
+	if !q.CreatedBefore.IsZero() {
+		and = append(and, sq.LtOrEq{"created_at": q.CreatedBefore})
+	}
+
+	return and.ToSql()
+}
+
+// CountsByProduct counts the calculations of each product created within the optional date range of the query.
+func (s *Service) CountsByProduct(ctx context.Context, in *CountsQuery) (CountsByProduct, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "CountsByProduct"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	in.createdBy = claims.VisibleCreator()
+	counts, err := countCalculationsByProduct(ctx, s.db, in)
+	if err != nil {
+		zlog.Error("failed to count calculations by product", zap.Error(err))
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func countCalculationsByProduct(ctx context.Context, db *sql.DB, in *CountsQuery) (CountsByProduct, error) {
+	defer database.TimeQuery("income.countCalculationsByProduct")()
+
+	pred, args, err := in.ToSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.Select(
+		"product",
+		"COUNT(*)",
+	).
+		From("statement_file_analysis").
+		Where(pred, args...).
+		GroupBy("product").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count calculations by product: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(CountsByProduct)
+	for rows.Next() {
+		var product types.ProductType
+		var count int64
+		if err := rows.Scan(&product, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan count: %w", err)
+		}
+		counts[product.String()] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate counts: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,60 @@
+package income
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+)
+
+func TestCountsByProduct(t *testing.T) {
+	after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	admin := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		in       *CountsQuery
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:    "all calculations",
+			ctx:     admin,
+			in:      &CountsQuery{},
+			wantSQL: `SELECT product, COUNT\(\*\) FROM statement_file_analysis WHERE \(1=1\) GROUP BY product`,
+		},
+		{
+			name:     "own calculations within the date range",
+			ctx:      userContext(),
+			in:       &CountsQuery{CreatedAfter: after, CreatedBefore: before},
+			wantSQL:  `FROM statement_file_analysis WHERE \(created_by = @p1 AND created_at >= @p2 AND created_at <= @p3\) GROUP BY product`,
+			wantArgs: []any{"user@example.com", after, before},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			q := mock.ExpectQuery(tt.wantSQL).WillReturnRows([]string{"product", "count"},
+				[]any{"SA", 3},
+				[]any{"PL", 2},
+			)
+
+			counts, err := s.CountsByProduct(tt.ctx, tt.in)
+			if err != nil {
+				t.Fatalf("CountsByProduct() error = %v", err)
+			}
+			if want := (CountsByProduct{"SA": 3, "PL": 2}); !maps.Equal(counts, want) {
+				t.Errorf("CountsByProduct() = %v, want %v", counts, want)
+			}
+			if got := q.Args(); !slices.Equal(got, tt.wantArgs) {
+				t.Errorf("query args = %v, want %v", got, tt.wantArgs)
+			}
+		})
+	}
+}
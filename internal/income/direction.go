@@ -0,0 +1,88 @@
+package income
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/shopspring/decimal"
+)
+
+// IncomeDirection is how the income amounts are read from the rows of a statement file.
+type IncomeDirection string
+
+const (
+	// IncomeDirectionCredits counts the positive amounts of the amount column,
+	// the statement listing only the credits or signing the debits negative.
+	IncomeDirectionCredits IncomeDirection = "CREDITS"
+
+	// IncomeDirectionDebits counts the negative amounts of the amount column by their absolute value,
+	// for the exports signing the credits of the account negative.
+	IncomeDirectionDebits IncomeDirection = "DEBITS"
+
+	// IncomeDirectionSeparate counts the positive amounts of the credit column,
+	// for the exports having a debit column and a credit column.
+	IncomeDirectionSeparate IncomeDirection = "SEPARATE"
+)
+
+// DefaultIncomeDirection is the income direction used when no other direction is configured.
+const DefaultIncomeDirection = IncomeDirectionCredits
+
+const (
+	// amountColumn is the column of the amounts, or of the debits when the credits have their own column.
+	amountColumn = 4
+
+	// creditColumn is the column of the credits of the statements read with IncomeDirectionSeparate.
+	creditColumn = 5
+)
+
+// ParseIncomeDirection parses the income direction of the given name, e.g. "credits".
+func ParseIncomeDirection(s string) (IncomeDirection, error) {
+	d := IncomeDirection(strings.ToUpper(strings.TrimSpace(s)))
+	switch d {
+	case IncomeDirectionCredits, IncomeDirectionDebits, IncomeDirectionSeparate:
+		return d, nil
+	}
+
+	return "", fmt.Errorf("invalid income direction %q, must be one of %s, %s or %s",
+		s, IncomeDirectionCredits, IncomeDirectionDebits, IncomeDirectionSeparate)
+}
+
+func (d IncomeDirection) String() string {
+	return string(d)
+}
+
+// orDefault returns the direction, or DefaultIncomeDirection for the calculations made before it was recorded.
+func (d IncomeDirection) orDefault() IncomeDirection {
+	if d == "" {
+		return DefaultIncomeDirection
+	}
+	return d
+}
+
+// incomeAmount returns the income amount of the statement row read in this direction,
+// written in the given number format, false if the row has no income in this direction.
+func (d IncomeDirection) incomeAmount(row []string, format statement.NumberFormat) (decimal.Decimal, bool) {
+	d = d.orDefault()
+
+	column := amountColumn
+	if d == IncomeDirectionSeparate {
+		column = creditColumn
+	}
+	if len(row) <= column {
+		return decimal.Zero, false
+	}
+
+	amount, err := format.ParseAmount(row[column])
+	if err != nil {
+		return decimal.Zero, false
+	}
+	if d == IncomeDirectionDebits {
+		amount = amount.Neg()
+	}
+	if !amount.GreaterThan(decimal.Zero) {
+		return decimal.Zero, false
+	}
+
+	return amount, true
+}
@@ -0,0 +1,110 @@
+package income
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+// ParseExchangeRateOverrides parses the fixed exchange rates to the base currency by product and currency code,
+// e.g. "PL:USD=21000,PL:THB=600". An empty string has none.
+func ParseExchangeRateOverrides(s string) (map[types.ProductType]map[string]decimal.Decimal, error) {
+	overrides := make(map[types.ProductType]map[string]decimal.Decimal)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, rawRate, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid exchange rate override %q, must be PRODUCT:CUR=rate", entry)
+		}
+
+		rawProduct, code, ok := strings.Cut(key, ":")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok || len(code) != 3 {
+			return nil, fmt.Errorf("invalid exchange rate override %q, must be PRODUCT:CUR=rate", entry)
+		}
+
+		product, err := types.ParseProductType(strings.ToUpper(strings.TrimSpace(rawProduct)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid product of exchange rate override %q: %w", entry, err)
+		}
+
+		rate, err := decimal.NewFromString(strings.TrimSpace(rawRate))
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate of exchange rate override %q: %w", entry, err)
+		}
+
+		if _, ok := overrides[product]; !ok {
+			overrides[product] = make(map[string]decimal.Decimal)
+		}
+		overrides[product][code] = rate
+	}
+
+	return overrides, nil
+}
+
+// SetExchangeRateOverrides sets the fixed exchange rates to the base currency used instead of the rate
+// of the currency for the calculations of a product, e.g. a conservative rate mandated by the credit policy.
+// The override of a calculation request takes precedence.
+func (s *Service) SetExchangeRateOverrides(overrides map[types.ProductType]map[string]decimal.Decimal) error {
+	for product, rates := range overrides {
+		if !isKnownProduct(product) {
+			return fmt.Errorf("exchange rate override is not supported for product %s", product)
+		}
+		for code, rate := range rates {
+			if !rate.IsPositive() {
+				return fmt.Errorf("exchange rate override of %s for product %s must be positive", code, product)
+			}
+		}
+	}
+
+	s.exchangeRateOverrides = overrides
+	return nil
+}
+
+// SetPinExchangeRates sets whether the calculations use the rate of the currency effective
+// at the end of their statement instead of the current rate, so a calculation can be reproduced later.
+// A currency without a rate effective then falls back to its current rate. It is off by default.
+func (s *Service) SetPinExchangeRates(pin bool) {
+	s.pinExchangeRates = pin
+}
+
+// exchangeRate returns the rate to the base currency of the calculation and its source:
+// the override of the request, the override of the product for the currency,
+// the rate effective at the end of the statement when pinned, or the current rate of the currency.
+// A currency without a positive rate falls back to 1, recorded as the default source to be reviewed.
+func (s *Service) exchangeRate(ctx context.Context, in *CalculateReq, c *currency.Currency, endedAt time.Time) (decimal.Decimal, string, error) {
+	if in.ExchangeRateOverride.IsPositive() {
+		return in.ExchangeRateOverride, ExchangeRateSourceOverride, nil
+	}
+
+	if rate, ok := s.exchangeRateOverrides[in.Product][strings.ToUpper(c.Code)]; ok {
+		return rate, ExchangeRateSourceOverride, nil
+	}
+
+	if s.pinExchangeRates && !endedAt.IsZero() {
+		rate, err := s.currency.GetRateAt(ctx, c.Code, endedAt)
+		if err == nil {
+			return rate, ExchangeRateSourceHistory, nil
+		}
+		if !errors.Is(err, currency.ErrRateNotFound) {
+			return decimal.Zero, "", fmt.Errorf("failed to get exchange rate at the end of the statement: %w", err)
+		}
+	}
+
+	rate := s.currency.RateToBase(c)
+	if !rate.IsPositive() {
+		return decimal.NewFromInt(1), ExchangeRateSourceDefault, nil
+	}
+
+	return rate, ExchangeRateSourceCurrency, nil
+}
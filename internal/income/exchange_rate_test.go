@@ -0,0 +1,288 @@
+package income
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+func TestServiceExchangeRate(t *testing.T) {
+	db, _ := dbtest.New(t)
+	currencySvc, err := currency.NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Service{
+		currency: currencySvc,
+		exchangeRateOverrides: map[types.ProductType]map[string]decimal.Decimal{
+			types.ProductPL: {"USD": decimal.NewFromInt(20000)},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		req        *CalculateReq
+		currency   *currency.Currency
+		wantRate   string
+		wantSource string
+	}{
+		{
+			name:       "currency",
+			req:        &CalculateReq{Product: types.ProductSA},
+			currency:   &currency.Currency{Code: "USD", ExchangeRate: decimal.NewFromInt(21500)},
+			wantRate:   "21500",
+			wantSource: ExchangeRateSourceCurrency,
+		},
+		{
+			name:       "base currency",
+			req:        &CalculateReq{Product: types.ProductSA},
+			currency:   &currency.Currency{Code: "LAK", ExchangeRate: decimal.Zero},
+			wantRate:   "1",
+			wantSource: ExchangeRateSourceCurrency,
+		},
+		{
+			name:       "currency without a rate",
+			req:        &CalculateReq{Product: types.ProductSA},
+			currency:   &currency.Currency{Code: "USD", ExchangeRate: decimal.Zero},
+			wantRate:   "1",
+			wantSource: ExchangeRateSourceDefault,
+		},
+		{
+			name:       "product override",
+			req:        &CalculateReq{Product: types.ProductPL},
+			currency:   &currency.Currency{Code: "USD", ExchangeRate: decimal.Zero},
+			wantRate:   "20000",
+			wantSource: ExchangeRateSourceOverride,
+		},
+		{
+			name:       "request override",
+			req:        &CalculateReq{Product: types.ProductPL, ExchangeRateOverride: decimal.NewFromInt(19000)},
+			currency:   &currency.Currency{Code: "USD", ExchangeRate: decimal.NewFromInt(21500)},
+			wantRate:   "19000",
+			wantSource: ExchangeRateSourceOverride,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, source, err := s.exchangeRate(context.Background(), tt.req, tt.currency, tt.currency.CreatedAt)
+			if err != nil {
+				t.Fatalf("exchangeRate() error = %v", err)
+			}
+			if rate.String() != tt.wantRate || source != tt.wantSource {
+				t.Errorf("exchangeRate() = %s, %s, want %s, %s", rate, source, tt.wantRate, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestSaveCalculationIncomePersistsExchangeRateSource(t *testing.T) {
+	db, mock := dbtest.New(t)
+	insert := mock.ExpectQuery(`INSERT INTO statement_file_analysis \(`).WillReturnRows([]string{"id"}, []any{1})
+	mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+
+	c := newTestCalculation("APP-1")
+	c.ExchangeRateSource = ExchangeRateSourceDefault
+	if err := saveCalculationIncome(context.Background(), db, c); err != nil {
+		t.Fatalf("saveCalculationIncome() error = %v", err)
+	}
+
+	if !slices.Contains(insert.Args(), any(ExchangeRateSourceDefault)) {
+		t.Errorf("insert args = %v, want the exchange rate source %s", insert.Args(), ExchangeRateSourceDefault)
+	}
+}
+
+func TestQueryExchangeRateSourceSQL(t *testing.T) {
+	calculation := &CalculationQuery{ExchangeRateSource: " default "}
+	batch := &BatchGetCalculationsQuery{ExchangeRateSource: " default "}
+
+	for name, q := range map[string]interface{ ToSQL() (string, []any, error) }{
+		"CalculationQuery":          calculation,
+		"BatchGetCalculationsQuery": batch,
+	} {
+		t.Run(name, func(t *testing.T) {
+			pred, args, err := q.ToSQL()
+			if err != nil {
+				t.Fatalf("ToSQL() error = %v", err)
+			}
+			if !strings.Contains(pred, "exchange_rate_source = ?") {
+				t.Errorf("ToSQL() = %q, want the exchange_rate_source predicate", pred)
+			}
+			if !slices.Contains(args, any(ExchangeRateSourceDefault)) {
+				t.Errorf("ToSQL() args = %v, want %s", args, ExchangeRateSourceDefault)
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeNonLAKBaseCurrency(t *testing.T) {
+	tests := []struct {
+		name          string
+		currency      string
+		rate          string
+		wantRate      string
+		wantNetIncome string
+	}{
+		// The rates convert the account currency to the base currency, so LAK converts to USD at a fraction.
+		{name: "account in LAK", currency: "LAK", rate: "0.00005", wantRate: "0.00005", wantNetIncome: "250"},
+		{name: "account in the base currency", currency: "USD", rate: "21500", wantRate: "1", wantNetIncome: "5000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", tt.currency, credit("25/01/2025", "Salary January", 5000000))
+			s, mock := newCalculateTestService(t)
+			if err := s.currency.SetBaseCurrency("usd"); err != nil {
+				t.Fatal(err)
+			}
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, tt.currency, tt.rate)
+			expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if calculation.ExchangeRate.String() != tt.wantRate {
+				t.Errorf("exchange rate = %s, want %s", calculation.ExchangeRate, tt.wantRate)
+			}
+			if calculation.MonthlyNetIncome.String() != tt.wantNetIncome {
+				t.Errorf("monthly net income = %s, want %s", calculation.MonthlyNetIncome, tt.wantNetIncome)
+			}
+
+			buf, err := exportCalculationSummaryToExcel(context.Background(), calculation, exportOptions{baseCurrency: s.currency.BaseCurrency()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			rows, err := f.GetRows("Summary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if label := rows[len(rows)-1][0]; label != "Net income amount (USD)" {
+				t.Errorf("net income label = %q, want the base currency USD", label)
+			}
+		})
+	}
+}
+
+func TestParseExchangeRateOverrides(t *testing.T) {
+	got, err := ParseExchangeRateOverrides(" PL:usd=21000, PL:THB=600 ,SA:USD=20500,")
+	if err != nil {
+		t.Fatalf("ParseExchangeRateOverrides() error = %v", err)
+	}
+	want := map[types.ProductType]map[string]string{
+		types.ProductPL: {"USD": "21000", "THB": "600"},
+		types.ProductSA: {"USD": "20500"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ParseExchangeRateOverrides() = %v, want %v", got, want)
+	}
+	for product, rates := range want {
+		for code, rate := range rates {
+			if r, ok := got[product][code]; !ok || r.String() != rate {
+				t.Errorf("override of %s for %s = %s, want %s", code, product, r, rate)
+			}
+		}
+	}
+
+	for _, s := range []string{"PL:USD", "PL=21000", "PL:US=21000", "XX:USD=21000", "PL:USD=abc"} {
+		if _, err := ParseExchangeRateOverrides(s); err == nil {
+			t.Errorf("ParseExchangeRateOverrides(%q) error = nil, want an error", s)
+		}
+	}
+}
+
+func TestSetExchangeRateOverrides(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    int64
+		wantErr bool
+	}{
+		{name: "positive", rate: 21000},
+		{name: "zero", rate: 0, wantErr: true},
+		{name: "negative", rate: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := new(Service)
+			err := s.SetExchangeRateOverrides(map[types.ProductType]map[string]decimal.Decimal{
+				types.ProductPL: {"USD": decimal.NewFromInt(tt.rate)},
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetExchangeRateOverrides() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr && s.exchangeRateOverrides != nil {
+				t.Errorf("overrides = %v, want none set", s.exchangeRateOverrides)
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeExchangeRateOverride(t *testing.T) {
+	tests := []struct {
+		name          string
+		product       types.ProductType
+		override      decimal.Decimal
+		wantRate      string
+		wantSource    string
+		wantNetIncome string
+	}{
+		{name: "currency rate", product: types.ProductSA, wantRate: "21500", wantSource: ExchangeRateSourceCurrency, wantNetIncome: "107500000"},
+		{name: "product override", product: types.ProductPL, wantRate: "20000", wantSource: ExchangeRateSourceOverride, wantNetIncome: "100000000"},
+		{name: "request override", product: types.ProductPL, override: decimal.NewFromInt(19000), wantRate: "19000", wantSource: ExchangeRateSourceOverride, wantNetIncome: "95000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "USD", credit("25/01/2025", "Salary January", 5000))
+			s, mock := newCalculateTestService(t)
+			// The product override applies to PL only.
+			if err := s.SetExchangeRateOverrides(map[types.ProductType]map[string]decimal.Decimal{
+				types.ProductPL: {"USD": decimal.NewFromInt(20000)},
+			}); err != nil {
+				t.Fatal(err)
+			}
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "USD", "21500")
+			expectSave(mock)
+
+			req := newCalculateReq(tt.product)
+			req.ExchangeRateOverride = tt.override
+
+			calculation, err := s.CalculateIncome(userContext(), req)
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if calculation.ExchangeRate.String() != tt.wantRate || calculation.ExchangeRateSource != tt.wantSource {
+				t.Errorf("exchange rate = %s from %s, want %s from %s", calculation.ExchangeRate, calculation.ExchangeRateSource, tt.wantRate, tt.wantSource)
+			}
+			if calculation.MonthlyNetIncome.String() != tt.wantNetIncome {
+				t.Errorf("monthly net income = %s, want %s", calculation.MonthlyNetIncome, tt.wantNetIncome)
+			}
+		})
+	}
+}
+
+func TestCalculateReqValidateExchangeRateOverride(t *testing.T) {
+	req := newCalculateReq(types.ProductPL)
+	req.ExchangeRateOverride = decimal.NewFromInt(-1)
+	if err := req.Validate(); fieldViolation(err) != "Exchange rate override must be positive" {
+		t.Errorf("Validate() error = %v, want a violation on the exchange rate override", err)
+	}
+}
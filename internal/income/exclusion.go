@@ -0,0 +1,50 @@
+package income
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ExcludedTransaction is a statement transaction dropped from a calculation before it was classified.
+type ExcludedTransaction struct {
+	Transaction
+	Reason string `json:"reason"`
+}
+
+// ExcludedTransactions are the statement transactions dropped from a calculation before they were classified.
+type ExcludedTransactions []ExcludedTransaction
+
+// Bytes returns the excluded transactions as JSON, an empty list if there are none.
+func (e ExcludedTransactions) Bytes() []byte {
+	if e == nil {
+		e = ExcludedTransactions{}
+	}
+
+	b, _ := json.Marshal(e)
+	return b
+}
+
+// matchExcludedNote returns the excluded prefix the note starts with, the case being ignored,
+// false if it starts with none.
+func matchExcludedNote(note string, prefixes []string) (string, bool) {
+	note = strings.ToLower(strings.TrimSpace(note))
+	for _, p := range prefixes {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		if strings.HasPrefix(note, strings.ToLower(p)) {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// newExcludedTransaction returns the transaction excluded for starting with the given note prefix.
+func newExcludedTransaction(t Transaction, prefix string) ExcludedTransaction {
+	return ExcludedTransaction{
+		Transaction: t,
+		Reason:      fmt.Sprintf("Note starts with the excluded prefix %q", prefix),
+	}
+}
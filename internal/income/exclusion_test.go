@@ -0,0 +1,87 @@
+package income
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+)
+
+func TestMatchExcludedNote(t *testing.T) {
+	prefixes := []string{"Transfer own", " ", "REVERSAL"}
+
+	tests := []struct {
+		name   string
+		note   string
+		want   string
+		wantOK bool
+	}{
+		{name: "prefix ignoring case", note: "  transfer OWN account salary", want: "Transfer own", wantOK: true},
+		{name: "other prefix", note: "Reversal of salary", want: "REVERSAL", wantOK: true},
+		{name: "prefix not at the start", note: "Salary transfer own", wantOK: false},
+		{name: "blank prefix matches nothing", note: "Salary January", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchExcludedNote(tt.note, prefixes)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("matchExcludedNote() = %q, %v, want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestExcludedTransactionsBytes(t *testing.T) {
+	var none ExcludedTransactions
+	if got := string(none.Bytes()); got != "[]" {
+		t.Errorf("Bytes() = %s, want []", got)
+	}
+}
+
+func TestGetCalculationSurfacesExcludedTransactions(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	excluded := ExcludedTransactions{
+		newExcludedTransaction(Transaction{Noted: "TRANSFER own account"}, "Transfer own"),
+	}
+
+	tests := []struct {
+		name   string
+		stored any
+		want   int
+	}{
+		{name: "excluded transactions", stored: excluded.Bytes(), want: 1},
+		{name: "saved before they were recorded", stored: nil, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+				1, "statement.pdf", "APP-1", "SA", "LAK", "0100001", "Somchai",
+				"1", "BASE", "CREDITS", "0", "0",
+				false, false, "0", "0", "0",
+				"0", "0", "0", "0",
+				"0", "3", startedAt, endedAt, "PENDING", []byte(`{}`), []byte(`{}`),
+				[]byte(`{}`), []byte(`{}`), tt.stored, "user@example.com", now, "user@example.com", now, nil,
+			})
+
+			calculation, err := getCalculation(context.Background(), db, &CalculationQuery{ID: 1})
+			if err != nil {
+				t.Fatalf("getCalculation() error = %v", err)
+			}
+			if got := len(calculation.ExcludedTransactions); got != tt.want {
+				t.Fatalf("excluded transactions = %d, want %d", got, tt.want)
+			}
+			if calculation.ExcludedTransactions == nil {
+				t.Error("excluded transactions = nil, want an empty list")
+			}
+			if tt.want > 0 && calculation.ExcludedTransactions[0].Noted != "TRANSFER own account" {
+				t.Errorf("excluded transaction note = %q, want %q", calculation.ExcludedTransactions[0].Noted, "TRANSFER own account")
+			}
+		})
+	}
+}
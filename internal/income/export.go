@@ -6,17 +6,29 @@ import (
 	"fmt"
 
 	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
 	"github.com/xuri/excelize/v2"
 )
 
-func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
-	f := excelize.NewFile()
-	defer f.Close()
+// exportBatchSize is the number of calculations read per batch by the exports.
+const exportBatchSize = 500
+
+// exportCalculationsToExcel writes the calculations with a stream writer,
+// so the rows are flushed to a temporary file instead of being kept in memory.
+// The caller must close the returned file. The returned next ID resumes the export
+// when the limit of the query is reached, it is zero once every calculation is exported.
+func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (f *excelize.File, nextID int64, err error) {
+	f = excelize.NewFile()
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
 
 	const sheetName = "Calculation of Incomes"
 	sheet, err := f.NewSheet(sheetName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+		return nil, 0, fmt.Errorf("failed to create new sheet: %w", err)
 	}
 	f.SetActiveSheet(sheet)
 
@@ -28,7 +40,7 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create style: %w", err)
 	}
 
 	fontStyle, err := f.NewStyle(&excelize.Style{
@@ -37,49 +49,73 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create front style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create front style: %w", err)
 	}
 
-	f.SetCellValue(sheetName, "A1", "FLAPPL/LO NO")
-	f.SetCellValue(sheetName, "B1", "Product")
-	f.SetCellValue(sheetName, "C1", "Average income/month")
-	f.SetCellValue(sheetName, "D1", "Account Number")
-	f.SetCellValue(sheetName, "E1", "Bank Account Name")
-	f.SetCellValue(sheetName, "F1", "Period Account")
-	f.SetCellValue(sheetName, "G1", "Currency")
-	f.SetCellValue(sheetName, "H1", "Net income amount")
-	f.SetCellStyle(sheetName, "A1", "H1", fontStyle)
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create stream writer: %w", err)
+	}
+
+	header := []any{
+		excelize.Cell{StyleID: fontStyle, Value: "FLAPPL/LO NO"},
+		excelize.Cell{StyleID: fontStyle, Value: "Product"},
+		excelize.Cell{StyleID: fontStyle, Value: "Average income/month"},
+		excelize.Cell{StyleID: fontStyle, Value: "Account Number"},
+		excelize.Cell{StyleID: fontStyle, Value: "Bank Account Name"},
+		excelize.Cell{StyleID: fontStyle, Value: "Period Account"},
+		excelize.Cell{StyleID: fontStyle, Value: "Currency"},
+		excelize.Cell{StyleID: fontStyle, Value: fmt.Sprintf("Net income amount (%s)", s.currency.BaseCurrency())},
+	}
+	if in.WithInterviewBasicSalary {
+		header = append(header, excelize.Cell{StyleID: fontStyle, Value: "Basic salary from interview"})
+	}
+	if err := sw.SetRow("A1", header); err != nil {
+		return nil, 0, fmt.Errorf("failed to set header row: %w", err)
+	}
 
 	startRow := 2
-	var nextID int64
+	nextID = in.ResumeID
+	var read int
 	for {
-		calculations, err := batchGetCalculations(ctx, s.db, 500, nextID, in)
+		size := exportBatchSize
+		if in.Limit > 0 {
+			if read >= in.Limit {
+				break // the limit is reached, the export resumes from nextID
+			}
+			size = min(size, in.Limit-read)
+		}
+
+		calculations, err := batchGetCalculations(ctx, s.db, size, nextID, in)
 		if err != nil {
-			return nil, fmt.Errorf("failed to batch get calculations: %w", err)
+			return nil, 0, fmt.Errorf("failed to batch get calculations: %w", err)
 		}
 
 		if len(calculations) == 0 {
+			nextID = 0
 			break
 		}
+		read += len(calculations)
 
 		s.mu.Lock()
 		nextID = calculations[len(calculations)-1].ID
 		s.mu.Unlock()
 
-		setCalculationsToExcel(f, sheetName, numberStyle, startRow, calculations)
+		if err := setCalculationsToExcel(sw, numberStyle, startRow, calculations, in.WithInterviewBasicSalary); err != nil {
+			return nil, 0, fmt.Errorf("failed to set calculations to excel: %w", err)
+		}
 
 		startRow += len(calculations)
 	}
 
-	byt, err := f.WriteToBuffer()
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	if err := sw.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("failed to flush stream writer: %w", err)
 	}
 
-	return byt, nil
+	return f, nextID, nil
 }
 
-func exportCalculationToExcel(_ context.Context, calculation *Calculation) (*bytes.Buffer, error) {
+func exportCalculationToExcel(_ context.Context, calculation *Calculation, opts exportOptions) (*bytes.Buffer, error) {
 	f := excelize.NewFile()
 	defer f.Close()
 
@@ -112,19 +148,19 @@ func exportCalculationToExcel(_ context.Context, calculation *Calculation) (*byt
 	f.SetActiveSheet(sheet)
 	switch calculation.Product {
 	case types.ProductPL, types.ProductSF:
-		setSummaryToExcelForProductPLAndSF(f, numberStyle, fontStyle, sheetName, calculation)
+		setSummaryToExcelForProductPLAndSF(f, numberStyle, fontStyle, sheetName, calculation, opts.baseCurrency)
 
 	case types.ProductSA:
-		setSummaryToExcelForProductSA(f, numberStyle, fontStyle, sheetName, calculation)
+		setSummaryToExcelForProductSA(f, numberStyle, fontStyle, sheetName, calculation, opts.baseCurrency)
 	}
 
-	if err := setSalaryToExcel(f, numberStyle, fontStyle, sheetName, calculation); err != nil {
+	if err := setSalaryToExcel(f, numberStyle, fontStyle, sheetName, calculation, opts.withBillNumbers); err != nil {
 		return nil, fmt.Errorf("failed to set salary to excel: %w", err)
 	}
 	if err := setAllowanceToExcel(f, numberStyle, fontStyle, sheetName, calculation); err != nil {
 		return nil, fmt.Errorf("failed to set allowance to excel: %w", err)
 	}
-	if err := setCommissionToExcel(f, numberStyle, fontStyle, sheetName, calculation); err != nil {
+	if err := setCommissionToExcel(f, numberStyle, fontStyle, sheetName, calculation, opts.withBillNumbers); err != nil {
 		return nil, fmt.Errorf("failed to set commission to excel: %w", err)
 	}
 
@@ -136,7 +172,99 @@ func exportCalculationToExcel(_ context.Context, calculation *Calculation) (*byt
 	return byt, nil
 }
 
-func setSummaryToExcelForProductPLAndSF(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation) {
+func exportTransactionsToExcel(calculation *Calculation, matched map[source][]Transaction) (*bytes.Buffer, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Matched Transactions"
+	sheet, err := f.NewSheet(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+	}
+	f.SetActiveSheet(sheet)
+
+	formatNumber := "#,##0.00"
+	numberStyle, err := f.NewStyle(&excelize.Style{
+		CustomNumFmt: &formatNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create style: %w", err)
+	}
+
+	totalStyle, err := f.NewStyle(&excelize.Style{
+		CustomNumFmt: &formatNumber,
+		Font: &excelize.Font{
+			Bold: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create total style: %w", err)
+	}
+
+	fontStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create front style: %w", err)
+	}
+
+	f.SetCellValue(sheetName, "A1", "FLAPPL/LO NO")
+	f.SetCellValue(sheetName, "B1", calculation.Number)
+	f.SetCellValue(sheetName, "A2", "Bank Account Name")
+	f.SetCellValue(sheetName, "B2", calculation.Account.DisplayName)
+	f.SetCellValue(sheetName, "A3", "Account Number")
+	f.SetCellValue(sheetName, "B3", fmt.Sprintf("%s (%s)", calculation.Account.Number, calculation.Account.Currency))
+	f.SetCellStyle(sheetName, "A1", "A3", fontStyle)
+
+	f.SetCellValue(sheetName, "A5", "Category")
+	f.SetCellValue(sheetName, "B5", "Date")
+	f.SetCellValue(sheetName, "C5", "Bill Number")
+	f.SetCellValue(sheetName, "D5", "Noted")
+	f.SetCellValue(sheetName, "E5", "Amount")
+	f.SetCellStyle(sheetName, "A5", "E5", fontStyle)
+
+	row := 6
+	total := decimal.Zero
+	for _, category := range []source{SourceSalary, SourceAllowance, SourceCommission} {
+		ts := matched[category]
+		if len(ts) == 0 {
+			continue
+		}
+
+		for _, t := range ts {
+			f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), category.String())
+			f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), t.Date.String())
+			f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), t.BillNumber)
+			f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), t.Noted)
+			f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), t.Amount.InexactFloat64())
+			f.SetCellStyle(sheetName, fmt.Sprintf("E%d", row), fmt.Sprintf("E%d", row), numberStyle)
+			row++
+		}
+
+		subtotal := sumTransactions(ts)
+		total = total.Add(subtotal)
+
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), fmt.Sprintf("Subtotal %s", category.String()))
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), subtotal.InexactFloat64())
+		f.SetCellStyle(sheetName, fmt.Sprintf("A%d", row), fmt.Sprintf("E%d", row), totalStyle)
+		row += 2
+	}
+
+	f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), "Total")
+	f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), total.InexactFloat64())
+	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", row), fmt.Sprintf("E%d", row), totalStyle)
+
+	byt, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	}
+
+	return byt, nil
+}
+
+func setSummaryToExcelForProductPLAndSF(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation, baseCurrency string) {
 	f.MergeCell(sheetName, "B2", "I2")
 	f.SetCellValue(sheetName, "B2", "ໃບວິເຄາະສິນເຊື່ອ (ການປະເມີນລາຍໄດ້ຂອງລູກຄ້າ) - ລາຍໄດ້ເງິນເດືອນພະນັກງານ")
 	f.SetCellStyle(sheetName, "B2", "I2", fontStyle)
@@ -212,7 +340,7 @@ func setSummaryToExcelForProductPLAndSF(f *excelize.File, numberStyle, fontStyle
 	f.SetCellValue(sheetName, "D17", calculation.ExchangeRate.InexactFloat64())
 	f.SetCellStyle(sheetName, "C17", "I17", numberStyle)
 
-	f.SetCellValue(sheetName, "B18", "ຍອດສະເລ່ຍລາຍໄດ້/ເດືອນ (LAK)")
+	f.SetCellValue(sheetName, "B18", fmt.Sprintf("ຍອດສະເລ່ຍລາຍໄດ້/ເດືອນ (%s)", baseCurrency))
 	f.SetCellStyle(sheetName, "B18", "B18", fontStyle)
 
 	f.MergeCell(sheetName, "C18", "I18")
@@ -221,7 +349,7 @@ func setSummaryToExcelForProductPLAndSF(f *excelize.File, numberStyle, fontStyle
 
 }
 
-func setSummaryToExcelForProductSA(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation) {
+func setSummaryToExcelForProductSA(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation, baseCurrency string) {
 	f.MergeCell(sheetName, "B2", "I2")
 	f.SetCellValue(sheetName, "B2", "ໃບວິເຄາະສິນເຊື່ອ (ການປະເມີນລາຍໄດ້ຂອງລູກຄ້າ) - ລາຍໄດ້ເງິນເດືອນພະນັກງານ")
 	f.SetCellStyle(sheetName, "B2", "I2", fontStyle)
@@ -282,7 +410,7 @@ func setSummaryToExcelForProductSA(f *excelize.File, numberStyle, fontStyle int,
 	f.SetCellValue(sheetName, "D14", calculation.ExchangeRate.InexactFloat64())
 	f.SetCellStyle(sheetName, "C14", "I14", numberStyle)
 
-	f.SetCellValue(sheetName, "B15", "ຍອດສະເລ່ຍລາຍໄດ້/ເດືອນ (LAK)")
+	f.SetCellValue(sheetName, "B15", fmt.Sprintf("ຍອດສະເລ່ຍລາຍໄດ້/ເດືອນ (%s)", baseCurrency))
 	f.SetCellStyle(sheetName, "B15", "B15", fontStyle)
 
 	f.MergeCell(sheetName, "C15", "I15")
@@ -290,7 +418,7 @@ func setSummaryToExcelForProductSA(f *excelize.File, numberStyle, fontStyle int,
 	f.SetCellStyle(sheetName, "C15", "I15", numberStyle)
 }
 
-func setSalaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation) error {
+func setSalaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation, withBillNumbers bool) error {
 	f.SetCellValue(sheetName, "L3", "Fixed Income salary (Only)")
 	f.MergeCell(sheetName, "L3", "M3")
 	f.SetCellStyle(sheetName, "L3", "M3", fontStyle)
@@ -302,11 +430,11 @@ func setSalaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName st
 	f.SetCellValue(sheetName, "N3", "ຈຳນວນຄັ້ງທີ່ເງີນເດືອນເຂົ້າ")
 	f.SetCellStyle(sheetName, "N3", "N3", fontStyle)
 	longestReceived := findSalaryLongestTimesReceived(calculation)
-	if err := mergeFromCol(f, sheetName, "N", 3, longestReceived); err != nil {
+	titles := listTitleForTimesReceived(longestReceived, withBillNumbers)
+	if err := mergeFromCol(f, sheetName, "N", 3, len(titles)); err != nil {
 		return err
 	}
 
-	titles := listTitleForTimesReceived(longestReceived)
 	if err := setStringsAcrossExcelCols(f, sheetName, "N", 4, titles); err != nil {
 		return err
 	}
@@ -317,8 +445,7 @@ func setSalaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName st
 		f.SetCellValue(sheetName, fmt.Sprintf("M%d", startRow+i), v.Total.InexactFloat64())
 		f.SetCellStyle(sheetName, fmt.Sprintf("M%d", startRow+i), fmt.Sprintf("M%d", startRow+i), numberStyle)
 
-		amounts := listNumberFromTransactions(v.Transactions)
-		if err := setNumbersAcrossExcelCols(f, sheetName, "N", startRow+i, numberStyle, amounts); err != nil {
+		if err := setTransactionsAcrossExcelCols(f, sheetName, "N", startRow+i, numberStyle, v.Transactions, withBillNumbers); err != nil {
 			return err
 		}
 	}
@@ -363,7 +490,7 @@ func setAllowanceToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName
 	return nil
 }
 
-func setCommissionToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation) error {
+func setCommissionToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation, withBillNumbers bool) error {
 	startRow := 16 + len(calculation.SalaryBreakdown.MonthlySalaries) + len(calculation.AllowanceBreakdown.Allowances)
 
 	f.SetCellValue(sheetName, fmt.Sprintf("L%d", startRow), "commission/OT(Monthly income)")
@@ -378,11 +505,11 @@ func setCommissionToExcel(f *excelize.File, numberStyle, fontStyle int, sheetNam
 	f.SetCellStyle(sheetName, fmt.Sprintf("N%d", startRow), fmt.Sprintf("N%d", startRow), fontStyle)
 
 	longestReceived := findCommissionLongestTimesReceived(calculation)
-	if err := mergeFromCol(f, sheetName, "N", startRow, longestReceived); err != nil {
+	titles := listTitleForTimesReceived(longestReceived, withBillNumbers)
+	if err := mergeFromCol(f, sheetName, "N", startRow, len(titles)); err != nil {
 		return err
 	}
 
-	titles := listTitleForTimesReceived(longestReceived)
 	if err := setStringsAcrossExcelCols(f, sheetName, "N", startRow+1, titles); err != nil {
 		return err
 	}
@@ -393,8 +520,7 @@ func setCommissionToExcel(f *excelize.File, numberStyle, fontStyle int, sheetNam
 		f.SetCellValue(sheetName, fmt.Sprintf("M%d", rowNumber+i), v.Total.InexactFloat64())
 		f.SetCellStyle(sheetName, fmt.Sprintf("M%d", rowNumber+i), fmt.Sprintf("M%d", rowNumber+i), numberStyle)
 
-		amounts := listNumberFromTransactions(v.Transactions)
-		if err := setNumbersAcrossExcelCols(f, sheetName, "N", rowNumber+i, numberStyle, amounts); err != nil {
+		if err := setTransactionsAcrossExcelCols(f, sheetName, "N", rowNumber+i, numberStyle, v.Transactions, withBillNumbers); err != nil {
 			return err
 		}
 	}
@@ -431,10 +557,15 @@ func findCommissionLongestTimesReceived(calculation *Calculation) int {
 	return l
 }
 
-func listTitleForTimesReceived(l int) []string {
+// listTitleForTimesReceived lists the titles of the columns of the times received,
+// each followed by the title of its bill number column when withBillNumbers is set.
+func listTitleForTimesReceived(l int, withBillNumbers bool) []string {
 	var headers []string
 	for i := 1; i <= l; i++ {
 		headers = append(headers, fmt.Sprintf("ຄັ້ງທີ %d", i))
+		if withBillNumbers {
+			headers = append(headers, fmt.Sprintf("Bill No. %d", i))
+		}
 	}
 
 	return headers
@@ -503,23 +634,62 @@ func setNumbersAcrossExcelCols(f *excelize.File, sheet string, startCol string,
 	return nil
 }
 
-func setCalculationsToExcel(f *excelize.File, sheetName string, numberStyle int, startRow int, calculations []*Calculation) {
-	for i, c := range calculations {
-		rowNumber := startRow + i
-		f.SetCellValue(sheetName, fmt.Sprintf("A%d", rowNumber), c.Number)
-		f.SetCellValue(sheetName, fmt.Sprintf("B%d", rowNumber), c.Product)
+// setTransactionsAcrossExcelCols sets the amounts of the transactions across the columns from startCol,
+// each followed by its bill number when withBillNumbers is set.
+func setTransactionsAcrossExcelCols(f *excelize.File, sheet string, startCol string, row int, style int, ts []Transaction, withBillNumbers bool) error {
+	if !withBillNumbers {
+		return setNumbersAcrossExcelCols(f, sheet, startCol, row, style, listNumberFromTransactions(ts))
+	}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("C%d", rowNumber), c.MonthlyAverageIncome.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("C%d", rowNumber), fmt.Sprintf("C%d", rowNumber), numberStyle)
+	colIdx, err := excelize.ColumnNameToNumber(startCol)
+	if err != nil {
+		return err
+	}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", rowNumber), c.Account.Number)
-		f.SetCellValue(sheetName, fmt.Sprintf("E%d", rowNumber), c.Account.DisplayName)
-		f.SetCellValue(sheetName, fmt.Sprintf("F%d", rowNumber), c.PeriodInMonth.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("F%d", rowNumber), fmt.Sprintf("F%d", rowNumber), numberStyle)
+	for i, t := range ts {
+		amountCol, err := excelize.ColumnNumberToName(colIdx + 2*i)
+		if err != nil {
+			return err
+		}
+		billNumberCol, err := excelize.ColumnNumberToName(colIdx + 2*i + 1)
+		if err != nil {
+			return err
+		}
+
+		amountCell := fmt.Sprintf("%s%d", amountCol, row)
+		f.SetCellValue(sheet, amountCell, t.Amount.InexactFloat64())
+		f.SetCellStyle(sheet, amountCell, amountCell, style)
+		f.SetCellValue(sheet, fmt.Sprintf("%s%d", billNumberCol, row), t.BillNumber)
+	}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("G%d", rowNumber), c.Account.Currency)
+	return nil
+}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("H%d", rowNumber), c.MonthlyNetIncome.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("H%d", rowNumber), fmt.Sprintf("H%d", rowNumber), numberStyle)
+func setCalculationsToExcel(sw *excelize.StreamWriter, numberStyle int, startRow int, calculations []*Calculation, withInterviewBasicSalary bool) error {
+	for i, c := range calculations {
+		cell, err := excelize.CoordinatesToCellName(1, startRow+i)
+		if err != nil {
+			return err
+		}
+
+		row := []any{
+			c.Number,
+			c.Product.String(),
+			excelize.Cell{StyleID: numberStyle, Value: c.MonthlyAverageIncome.InexactFloat64()},
+			c.Account.Number,
+			c.Account.DisplayName,
+			excelize.Cell{StyleID: numberStyle, Value: c.PeriodInMonth.InexactFloat64()},
+			c.Account.Currency,
+			excelize.Cell{StyleID: numberStyle, Value: c.MonthlyNetIncome.InexactFloat64()},
+		}
+		if withInterviewBasicSalary {
+			row = append(row, excelize.Cell{StyleID: numberStyle, Value: c.BasicSalaryFromInterview.InexactFloat64()})
+		}
+
+		if err := sw.SetRow(cell, row); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
@@ -0,0 +1,148 @@
+package income
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// DefaultExportTemplate is the layout used when no export template is given.
+const DefaultExportTemplate = "default"
+
+// ExportCalculationReq is the layout of the export of a calculation.
+type ExportCalculationReq struct {
+	// Template is the name of the export template, empty for DefaultExportTemplate.
+	Template string `query:"template"`
+
+	// WithBillNumbers adds the bill number next to each amount of the salary and commission breakdowns.
+	WithBillNumbers bool `query:"withBillNumbers"`
+}
+
+// exportOptions are the options a calculation is rendered with.
+type exportOptions struct {
+	// baseCurrency labels the net income.
+	baseCurrency string
+
+	withBillNumbers bool
+}
+
+// exportTemplate renders a calculation to an Excel workbook.
+type exportTemplate func(ctx context.Context, calculation *Calculation, opts exportOptions) (*bytes.Buffer, error)
+
+// exportTemplates are the registered layouts of the calculation export, by name.
+var exportTemplates = map[string]exportTemplate{
+	DefaultExportTemplate: exportCalculationToExcel,
+	"summary":             exportCalculationSummaryToExcel,
+}
+
+// lookupExportTemplate returns the export template with the given name.
+// An empty name selects the default template.
+func lookupExportTemplate(name string) (exportTemplate, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = DefaultExportTemplate
+	}
+
+	if t, ok := exportTemplates[name]; ok {
+		return t, nil
+	}
+
+	names := make([]string, 0, len(exportTemplates))
+	for n := range exportTemplates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	s, _ := rpcStatus.New(
+		codes.InvalidArgument,
+		"Export template is not valid. Please check the errors and try again, see details for more information.",
+	).WithDetails(&edPb.BadRequest{
+		FieldViolations: []*edPb.BadRequest_FieldViolation{
+			{
+				Field:       "template",
+				Description: fmt.Sprintf("Template must be one of %s", strings.Join(names, ", ")),
+			},
+		},
+	})
+
+	return nil, s.Err()
+}
+
+// exportCalculationSummaryToExcel renders the figures of the calculation
+// as a single sheet of label and value rows, without the breakdowns.
+func exportCalculationSummaryToExcel(_ context.Context, calculation *Calculation, opts exportOptions) (*bytes.Buffer, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Summary"
+	sheet, err := f.NewSheet(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+	}
+	f.SetActiveSheet(sheet)
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		return nil, fmt.Errorf("failed to delete default sheet: %w", err)
+	}
+
+	formatNumber := "#,##0.00"
+	numberStyle, err := f.NewStyle(&excelize.Style{
+		CustomNumFmt: &formatNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create style: %w", err)
+	}
+
+	fontStyle, err := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{
+			Bold: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create front style: %w", err)
+	}
+
+	rows := []struct {
+		label string
+		value any
+	}{
+		{"FLAPPL/LO NO", calculation.Number},
+		{"Product", calculation.Product.String()},
+		{"Account Number", calculation.Account.Number},
+		{"Bank Account Name", calculation.Account.DisplayName},
+		{"Currency", calculation.Account.Currency},
+		{"Exchange Rate", calculation.ExchangeRate.InexactFloat64()},
+		{"Period Account", calculation.PeriodInMonth.InexactFloat64()},
+		{"Basic Salary", calculation.SalaryBreakdown.BasicSalary.InexactFloat64()},
+		{"Average Allowance/month", calculation.AllowanceBreakdown.Total.InexactFloat64()},
+		{"Average Commission/month", calculation.CommissionBreakdown.MonthlyAverage.InexactFloat64()},
+		{"Average income/month", calculation.MonthlyAverageIncome.InexactFloat64()},
+		{fmt.Sprintf("Net income amount (%s)", opts.baseCurrency), calculation.MonthlyNetIncome.InexactFloat64()},
+	}
+
+	f.SetColWidth(sheetName, "A", "A", 28)
+	f.SetColWidth(sheetName, "B", "B", 24)
+	for i, r := range rows {
+		row := i + 1
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), r.label)
+		f.SetCellStyle(sheetName, fmt.Sprintf("A%d", row), fmt.Sprintf("A%d", row), fontStyle)
+
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), r.value)
+		if _, ok := r.value.(float64); ok {
+			f.SetCellStyle(sheetName, fmt.Sprintf("B%d", row), fmt.Sprintf("B%d", row), numberStyle)
+		}
+	}
+
+	byt, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	}
+
+	return byt, nil
+}
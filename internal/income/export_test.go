@@ -0,0 +1,342 @@
+package income
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// exportRow returns the row of a synthetic completed calculation as read by batchGetCalculations.
+func exportRow(id int) []any {
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	return []any{
+		id, "statement.pdf", fmt.Sprintf("APP-%d", id), "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "30000000", "30000000",
+		"0", "10000000", "10000000", "3", now.AddDate(0, -3, 0), now,
+		"COMPLETED", []byte(`{}`), []byte(`{}`), []byte(`{}`), []byte(`{}`), "user@example.com", now, "user@example.com",
+		now, nil,
+	}
+}
+
+// seedExportBatches seeds n synthetic calculations read in batches of exportBatchSize,
+// with the ids in descending order as batchGetCalculations reads them.
+func seedExportBatches(mock *dbtest.Mock, n int) {
+	rows := make([][]any, 0, exportBatchSize)
+	for id := n; id > 0; id-- {
+		rows = append(rows, exportRow(id))
+		if len(rows) == exportBatchSize || id == 1 {
+			mock.ExpectQuery(`FROM statement_file_analysis`).WillReturnRows(batchColumns, rows...)
+			rows = make([][]any, 0, exportBatchSize)
+		}
+	}
+	mock.ExpectQuery(`FROM statement_file_analysis`)
+}
+
+func newExportService(tb testing.TB, n int) *Service {
+	tb.Helper()
+
+	db, mock := dbtest.New(tb)
+	seedExportBatches(mock, n)
+
+	currencySvc, err := currency.NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	return &Service{db: db, currency: currencySvc, zlog: zap.NewNop(), mu: new(sync.Mutex)}
+}
+
+func exportContext() context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+}
+
+func TestExportCalculationsToExcel(t *testing.T) {
+	const n = 2*exportBatchSize + 200
+
+	s := newExportService(t, n)
+	f, nextID, err := s.ExportCalculationsToExcel(exportContext(), &BatchGetCalculationsQuery{})
+	if err != nil {
+		t.Fatalf("ExportCalculationsToExcel() error = %v", err)
+	}
+	defer f.Close()
+
+	if nextID != 0 {
+		t.Errorf("next ID = %d, want 0 once every calculation is exported", nextID)
+	}
+
+	rows, err := f.GetRows("Calculation of Incomes")
+	if err != nil {
+		t.Fatalf("failed to read the sheet: %v", err)
+	}
+
+	// The header and one row per calculation.
+	if len(rows) != n+1 {
+		t.Fatalf("got %d rows, want %d", len(rows), n+1)
+	}
+	if got := rows[n][0]; got != "APP-1" {
+		t.Errorf("last row = %s, want APP-1", got)
+	}
+}
+
+func TestExportCalculationsToExcelResume(t *testing.T) {
+	exported := func(t *testing.T, s *Service, in *BatchGetCalculationsQuery) ([]string, int64) {
+		t.Helper()
+
+		f, nextID, err := s.ExportCalculationsToExcel(exportContext(), in)
+		if err != nil {
+			t.Fatalf("ExportCalculationsToExcel() error = %v", err)
+		}
+		defer f.Close()
+
+		rows, err := f.GetRows("Calculation of Incomes")
+		if err != nil {
+			t.Fatalf("failed to read the sheet: %v", err)
+		}
+		numbers := make([]string, 0, len(rows))
+		for _, r := range rows[1:] {
+			numbers = append(numbers, r[0])
+		}
+		return numbers, nextID
+	}
+
+	db, mock := dbtest.New(t)
+	currencySvc, err := currency.NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Service{db: db, currency: currencySvc, zlog: zap.NewNop(), mu: new(sync.Mutex)}
+
+	// The first export of the calculations 10 to 1 stops at its limit.
+	first := mock.ExpectQuery(`TOP 4 id`).WillReturnRows(batchColumns, exportRow(10), exportRow(9), exportRow(8), exportRow(7))
+	numbers, nextID := exported(t, s, &BatchGetCalculationsQuery{Limit: 4})
+	if len(first.Args()) != 1 {
+		t.Errorf("first batch args = %v, want only the creator", first.Args())
+	}
+	if want := []string{"APP-10", "APP-9", "APP-8", "APP-7"}; !slices.Equal(numbers, want) {
+		t.Errorf("first export = %q, want %q", numbers, want)
+	}
+	if nextID != 7 {
+		t.Fatalf("next ID = %d, want 7", nextID)
+	}
+
+	// The export resumed from the next ID reads the calculations below it to the end.
+	resumed := mock.ExpectQuery(`TOP 500 id`).WillReturnRows(batchColumns, exportRow(6), exportRow(5), exportRow(4), exportRow(3), exportRow(2), exportRow(1))
+	mock.ExpectQuery(`TOP 500 id`)
+	numbers, nextID = exported(t, s, &BatchGetCalculationsQuery{ResumeID: nextID})
+	if !slices.Contains(resumed.Args(), any(int64(7))) {
+		t.Errorf("resumed batch args = %v, want the calculations below ID 7", resumed.Args())
+	}
+	if want := []string{"APP-6", "APP-5", "APP-4", "APP-3", "APP-2", "APP-1"}; !slices.Equal(numbers, want) {
+		t.Errorf("resumed export = %q, want %q", numbers, want)
+	}
+	if nextID != 0 {
+		t.Errorf("next ID = %d, want 0 once every calculation is exported", nextID)
+	}
+}
+
+// BenchmarkExportCalculationsToExcel reports the memory allocated to export a large synthetic dataset,
+// the rows of the stream writer being flushed to a temporary file once they exceed its chunk size.
+func BenchmarkExportCalculationsToExcel(b *testing.B) {
+	for _, n := range []int{exportBatchSize, 20 * exportBatchSize} {
+		b.Run(fmt.Sprintf("%d calculations", n), func(b *testing.B) {
+			b.ReportAllocs()
+			for range b.N {
+				b.StopTimer()
+				s := newExportService(b, n)
+				b.StartTimer()
+
+				f, _, err := s.ExportCalculationsToExcel(exportContext(), &BatchGetCalculationsQuery{})
+				if err != nil {
+					b.Fatalf("ExportCalculationsToExcel() error = %v", err)
+				}
+				if _, err := f.WriteTo(io.Discard); err != nil {
+					b.Fatalf("failed to write the workbook: %v", err)
+				}
+				f.Close()
+			}
+		})
+	}
+}
+
+func TestExportTransactionsToExcelByNumber(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("10/02/2025", "Allowance February", 1000000),
+		credit("15/02/2025", "Transfer", 2000000),
+	)
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	s, mock := newCalculateTestService(t)
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+		1, file.Name, "APP-1", "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "3", startedAt, endedAt, "PENDING", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", endedAt, "user@example.com", endedAt, nil,
+	})
+	mock.ExpectQuery(`FROM statement_file WHERE`).WillReturnRows(
+		[]string{"id", "original_file_name", "file_name", "location", "created_by", "created_at"},
+		[]any{file.ID, file.Name, file.Name, file.Location, "user@example.com", endedAt},
+	)
+	mock.ExpectQuery(`FROM income_wordlist`).WillReturnRows(
+		[]string{"id", "word", "category", "created_by", "created_at", "updated_by", "updated_at"},
+		[]any{1, "salary", SourceSalary.String(), "admin@example.com", endedAt, "admin@example.com", endedAt},
+		[]any{2, "allowance", SourceAllowance.String(), "admin@example.com", endedAt, "admin@example.com", endedAt},
+	)
+
+	buf, err := s.ExportTransactionsToExcelByNumber(userContext(), "APP-1")
+	if err != nil {
+		t.Fatalf("ExportTransactionsToExcelByNumber() error = %v", err)
+	}
+
+	f, err := excelize.OpenReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	rows, err := f.GetRows("Matched Transactions")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make([]string, 0)
+	for _, row := range rows[5:] {
+		if len(row) > 0 {
+			got = append(got, strings.Join(row, "|"))
+		}
+	}
+	want := []string{
+		"SALARY|25-01-2025|B-25/01/2025|Salary January|5,000,000.00",
+		"SALARY|25-02-2025|B-25/02/2025|Salary February|5,000,000.00",
+		"Subtotal SALARY||||10,000,000.00",
+		"ALLOWANCE|10-02-2025|B-10/02/2025|Allowance February|1,000,000.00",
+		"Subtotal ALLOWANCE||||1,000,000.00",
+		"Total||||11,000,000.00",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("rows = %q, want %q", got, want)
+	}
+}
+
+func TestExportCalculationTemplates(t *testing.T) {
+	tests := []struct {
+		template   string
+		wantSheets []string
+		wantA1     string
+	}{
+		{template: "", wantSheets: []string{"Sheet1", "ເງີນເດືອນສະເລ່ຍຫຼາຍເດືອນ"}},
+		{template: "Default", wantSheets: []string{"Sheet1", "ເງີນເດືອນສະເລ່ຍຫຼາຍເດືອນ"}},
+		{template: "summary", wantSheets: []string{"Summary"}, wantA1: "FLAPPL/LO NO"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			seedPendingCalculation(mock, "APP-1")
+
+			buf, err := s.ExportCalculationToExcelByNumber(userContext(), "APP-1", &ExportCalculationReq{Template: tt.template})
+			if err != nil {
+				t.Fatalf("ExportCalculationToExcelByNumber() error = %v", err)
+			}
+
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			if got := f.GetSheetList(); !slices.Equal(got, tt.wantSheets) {
+				t.Errorf("sheets = %v, want %v", got, tt.wantSheets)
+			}
+			if tt.wantA1 != "" {
+				if got, _ := f.GetCellValue(tt.wantSheets[0], "A1"); got != tt.wantA1 {
+					t.Errorf("A1 = %q, want %q", got, tt.wantA1)
+				}
+			}
+		})
+	}
+}
+
+func TestExportCalculationUnknownTemplate(t *testing.T) {
+	s, _ := newCalculateTestService(t)
+
+	_, err := s.ExportCalculationToExcelByNumber(userContext(), "APP-1", &ExportCalculationReq{Template: "compact"})
+	if rpcStatus.Code(err) != codes.InvalidArgument {
+		t.Fatalf("ExportCalculationToExcelByNumber() error = %v, want InvalidArgument", err)
+	}
+}
+
+func TestExportCalculationWithBillNumbers(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)
+	salaries := []byte(`{"monthlySalaries":[{"month":"January-2025","transactions":[
+		{"date":"10-01-2025","billNumber":"B-1","amount":"2500000"},
+		{"date":"25-01-2025","billNumber":"B-2","amount":"2500000"}
+	],"total":"5000000"}],"total":"5000000"}`)
+
+	tests := []struct {
+		name            string
+		withBillNumbers bool
+		wantHeader      []string
+		wantRow         []string
+	}{
+		{name: "default", wantHeader: []string{"ຄັ້ງທີ 1", "ຄັ້ງທີ 2", "", ""}, wantRow: []string{"2,500,000.00", "2,500,000.00", "", ""}},
+		{name: "with bill numbers", withBillNumbers: true,
+			wantHeader: []string{"ຄັ້ງທີ 1", "Bill No. 1", "ຄັ້ງທີ 2", "Bill No. 2"},
+			wantRow:    []string{"2,500,000.00", "B-1", "2,500,000.00", "B-2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+				1, "statement.pdf", "APP-1", "SA", "LAK", "0100001", "Somchai",
+				"1", "BASE", "CREDITS", "0", "0",
+				false, false, "0", "0", "0",
+				"0", "0", "0", "0",
+				"0", "1", startedAt, endedAt, "PENDING", []byte(`{}`), salaries,
+				[]byte(`{}`), []byte(`{}`), nil, "user@example.com", endedAt, "user@example.com", endedAt, nil,
+			})
+
+			buf, err := s.ExportCalculationToExcelByNumber(userContext(), "APP-1", &ExportCalculationReq{WithBillNumbers: tt.withBillNumbers})
+			if err != nil {
+				t.Fatalf("ExportCalculationToExcelByNumber() error = %v", err)
+			}
+			f, err := excelize.OpenReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			const sheetName = "ເງີນເດືອນສະເລ່ຍຫຼາຍເດືອນ"
+			for row, want := range map[int][]string{4: tt.wantHeader, 5: tt.wantRow} {
+				got := make([]string, 0, len(want))
+				for _, col := range []string{"N", "O", "P", "Q"} {
+					v, _ := f.GetCellValue(sheetName, fmt.Sprintf("%s%d", col, row))
+					got = append(got, v)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("row %d = %q, want %q", row, got, want)
+				}
+			}
+		})
+	}
+}
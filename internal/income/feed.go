@@ -0,0 +1,105 @@
+package income
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// FeedEntry is a transaction of a calculation together with its calculation context,
+// one entry per transaction for the BI tools.
+type FeedEntry struct {
+	Number     string            `json:"number"`
+	Product    types.ProductType `json:"product"`
+	Category   source            `json:"category"`
+	Title      string            `json:"title"` // The title of the allowance, empty for the other categories.
+	Month      string            `json:"month"`
+	Date       types.DDMMYYYY    `json:"date"`
+	BillNumber string            `json:"billNumber"`
+	Noted      string            `json:"noted"`
+	Amount     decimal.Decimal   `json:"amount"`
+}
+
+type ListFeedResult struct {
+	Entries []*FeedEntry `json:"entries"`
+}
+
+// feed flattens the salary, allowance and commission breakdowns of the calculation, in this order.
+// The allowances are not broken down by month, so their month is the one of the transaction date.
+func (c *Calculation) feed() []*FeedEntry {
+	entries := make([]*FeedEntry, 0)
+	add := func(category source, title, month string, t Transaction) {
+		entries = append(entries, &FeedEntry{
+			Number:     c.Number,
+			Product:    c.Product,
+			Category:   category,
+			Title:      title,
+			Month:      month,
+			Date:       t.Date,
+			BillNumber: t.BillNumber,
+			Noted:      t.Noted,
+			Amount:     t.Amount,
+		})
+	}
+
+	if c.SalaryBreakdown != nil {
+		for _, m := range c.SalaryBreakdown.MonthlySalaries {
+			for _, t := range m.Transactions {
+				add(SourceSalary, "", m.Month, t)
+			}
+		}
+	}
+
+	if c.AllowanceBreakdown != nil {
+		for _, a := range c.AllowanceBreakdown.Allowances {
+			for _, t := range a.Transactions {
+				add(SourceAllowance, a.Title, time.Time(t.Date).Format("January-2006"), t)
+			}
+		}
+	}
+
+	if c.CommissionBreakdown != nil {
+		for _, m := range c.CommissionBreakdown.Commissions {
+			for _, t := range m.Transactions {
+				add(SourceCommission, "", m.Month, t)
+			}
+		}
+	}
+
+	return entries
+}
+
+// ListFeedByNumber returns the transactions of the calculation of the given number as a flat feed,
+// read from its stored breakdowns.
+func (s *Service) ListFeedByNumber(ctx context.Context, number string) (*ListFeedResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListFeedByNumber"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	return &ListFeedResult{
+		Entries: calculation.feed(),
+	}, nil
+}
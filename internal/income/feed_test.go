@@ -0,0 +1,68 @@
+package income
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestListFeedByNumber(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)
+	salaries := []byte(`{"monthlySalaries":[
+		{"month":"January-2025","transactions":[{"date":"25-01-2025","billNumber":"B-1","amount":"5000000"}],"total":"5000000"},
+		{"month":"February-2025","transactions":[{"date":"10-02-2025","billNumber":"B-2","amount":"2500000"},{"date":"25-02-2025","billNumber":"B-3","amount":"2500000"}],"total":"5000000"}
+	],"total":"10000000"}`)
+	allowances := []byte(`{"allowances":[
+		{"title":"transport","transactions":[{"date":"15-01-2025","billNumber":"B-4","amount":"300000"},{"date":"15-02-2025","billNumber":"B-5","amount":"300000"}],"total":"600000"}
+	],"total":"600000"}`)
+	commissions := []byte(`{"commissions":[
+		{"month":"February-2025","transactions":[{"date":"28-02-2025","billNumber":"B-6","amount":"1000000"}],"total":"1000000"}
+	],"total":"1000000"}`)
+
+	s, mock := newCalculateTestService(t)
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+		1, "statement.pdf", "APP-1", "PL", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "2", startedAt, endedAt, "PENDING", []byte(`{}`), salaries,
+		allowances, commissions, nil, "user@example.com", endedAt, "user@example.com", endedAt, nil,
+	})
+
+	result, err := s.ListFeedByNumber(userContext(), "APP-1")
+	if err != nil {
+		t.Fatalf("ListFeedByNumber() error = %v", err)
+	}
+
+	// One entry per transaction across the breakdowns.
+	wantCount := map[source]int{SourceSalary: 3, SourceAllowance: 2, SourceCommission: 1}
+	wantTotal := map[source]int64{SourceSalary: 10000000, SourceAllowance: 600000, SourceCommission: 1000000}
+	if len(result.Entries) != 6 {
+		t.Fatalf("got %d entries, want the 6 transactions of the breakdowns", len(result.Entries))
+	}
+
+	count := make(map[source]int)
+	total := make(map[source]decimal.Decimal)
+	for _, e := range result.Entries {
+		count[e.Category]++
+		total[e.Category] = total[e.Category].Add(e.Amount)
+		if e.Number != "APP-1" || e.Product.String() != "PL" {
+			t.Errorf("entry %s of %s %s, want the context of APP-1 PL", e.BillNumber, e.Number, e.Product)
+		}
+	}
+	for category, want := range wantCount {
+		if count[category] != want {
+			t.Errorf("%s entries = %d, want %d", category, count[category], want)
+		}
+		if !total[category].Equal(decimal.NewFromInt(wantTotal[category])) {
+			t.Errorf("%s amount = %s, want the breakdown total %d", category, total[category], wantTotal[category])
+		}
+	}
+
+	allowance := result.Entries[4]
+	if allowance.Title != "transport" || allowance.Month != "February-2025" {
+		t.Errorf("allowance entry = %+v, want the transport allowance of February-2025", allowance)
+	}
+}
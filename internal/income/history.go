@@ -0,0 +1,191 @@
+package income
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// CalculationSnapshot is the summary figures of a calculation at the time it was saved.
+type CalculationSnapshot struct {
+	ID                   int64             `json:"id"`
+	Product              types.ProductType `json:"product"`
+	AccountCurrency      string            `json:"accountCurrency"`
+	ExchangeRate         decimal.Decimal   `json:"exchangeRate"`
+	TotalIncome          decimal.Decimal   `json:"totalIncome"`
+	TotalBasicSalary     decimal.Decimal   `json:"totalBasicSalary"`
+	TotalOtherIncome     decimal.Decimal   `json:"totalOtherIncome"`
+	MonthlyNetIncome     decimal.Decimal   `json:"monthlyNetIncome"`
+	MonthlyAverageIncome decimal.Decimal   `json:"monthlyAverageIncome"`
+	PeriodInMonth        decimal.Decimal   `json:"periodInMonth"`
+	StartedAt            time.Time         `json:"startedAt"`
+	EndedAt              time.Time         `json:"endedAt"`
+	CreatedBy            string            `json:"createdBy"`
+	CreatedAt            time.Time         `json:"createdAt"`
+}
+
+type ListCalculationHistoryResult struct {
+	Snapshots []*CalculationSnapshot `json:"snapshots"`
+}
+
+// ListCalculationHistory returns the snapshots of the calculation with the given number,
+// oldest first, one for each time the calculation was saved.
+func (s *Service) ListCalculationHistory(ctx context.Context, number string) (*ListCalculationHistoryResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListCalculationHistory"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	snapshots, err := listCalculationSnapshots(ctx, s.db, calculation.ID)
+	if err != nil {
+		zlog.Error("failed to list calculation snapshots", zap.Error(err))
+		return nil, err
+	}
+
+	return &ListCalculationHistoryResult{
+		Snapshots: snapshots,
+	}, nil
+}
+
+// saveCalculationSnapshot records the summary figures of the calculation in its history.
+// It must be called within the transaction that saves the calculation.
+func saveCalculationSnapshot(ctx context.Context, tx *sql.Tx, in *Calculation) error {
+	q, args := sq.Insert("statement_file_analysis_history").
+		Columns(
+			"original_id",
+			"new_statement_file_name",
+			"new_number",
+			"new_product",
+			"new_account_currency",
+			"new_account_number",
+			"new_account_display_name",
+			"new_exchange_rate",
+			"new_total_income",
+			"new_total_basic_salary",
+			"new_total_other_income",
+			"new_monthly_net_income",
+			"new_monthly_average_income",
+			"new_period_in_month",
+			"new_started_at",
+			"new_ended_at",
+			"created_by",
+			"created_at",
+		).
+		Values(
+			sq.Expr("(SELECT id FROM statement_file_analysis WHERE number = ?)", in.Number),
+			in.StatementFileName,
+			in.Number,
+			in.Product,
+			in.Account.Currency,
+			in.Account.Number,
+			in.Account.DisplayName,
+			in.ExchangeRate,
+			in.TotalIncome,
+			in.TotalBasicSalary,
+			in.TotalOtherIncome,
+			in.MonthlyNetIncome,
+			in.MonthlyAverageIncome,
+			in.PeriodInMonth,
+			in.StartedAt,
+			in.EndedAt,
+			in.UpdatedBy,
+			in.UpdatedAt,
+		).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+		return fmt.Errorf("failed to insert calculation snapshot: %w", err)
+	}
+
+	return nil
+}
+
+func listCalculationSnapshots(ctx context.Context, db *sql.DB, calculationID int64) ([]*CalculationSnapshot, error) {
+	defer database.TimeQuery("income.listCalculationSnapshots")()
+
+	q, args := sq.Select(
+		"history_id",
+		"new_product",
+		"new_account_currency",
+		"new_exchange_rate",
+		"new_total_income",
+		"new_total_basic_salary",
+		"new_total_other_income",
+		"new_monthly_net_income",
+		"new_monthly_average_income",
+		"new_period_in_month",
+		"new_started_at",
+		"new_ended_at",
+		"created_by",
+		"created_at",
+	).
+		From("statement_file_analysis_history").
+		Where(sq.Eq{"original_id": calculationID}).
+		OrderBy("created_at ASC", "history_id ASC").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list calculation snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := make([]*CalculationSnapshot, 0)
+	for rows.Next() {
+		s := new(CalculationSnapshot)
+		if err := rows.Scan(
+			&s.ID,
+			&s.Product,
+			&s.AccountCurrency,
+			&s.ExchangeRate,
+			&s.TotalIncome,
+			&s.TotalBasicSalary,
+			&s.TotalOtherIncome,
+			&s.MonthlyNetIncome,
+			&s.MonthlyAverageIncome,
+			&s.PeriodInMonth,
+			&s.StartedAt,
+			&s.EndedAt,
+			&s.CreatedBy,
+			&s.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan calculation snapshot: %w", err)
+		}
+
+		snapshots = append(snapshots, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows of calculation snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
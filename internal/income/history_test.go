@@ -0,0 +1,84 @@
+package income
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+)
+
+// Indexes of the arguments of the insert of a calculation snapshot.
+const (
+	snapshotTotalIncomeArg = 8
+	snapshotCreatedByArg   = 16
+)
+
+func TestReCalculateIncomeRecordsSnapshots(t *testing.T) {
+	january := time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)
+
+	db, mock := dbtest.New(t)
+	s := &Service{db: db, zlog: zap.NewNop()}
+
+	snapshots := make([]*dbtest.Expectation, 0, 2)
+	for _, amount := range []int64{5000000, 6000000} {
+		seedPendingCalculation(mock, "APP-1")
+		mock.ExpectExec(`UPDATE statement_file_analysis`)
+		snapshots = append(snapshots, mock.ExpectExec(`INSERT INTO statement_file_analysis_history`))
+
+		if _, err := s.ReCalculateIncome(userContext(), newRecalculateReq("January-2025", january, amount)); err != nil {
+			t.Fatalf("ReCalculateIncome() error = %v", err)
+		}
+	}
+
+	for i, want := range []int64{5000000, 6000000} {
+		args := snapshots[i].Args()
+		if fmt.Sprint(args[snapshotTotalIncomeArg]) != fmt.Sprint(want) {
+			t.Errorf("snapshot %d total income = %v, want %d", i, args[snapshotTotalIncomeArg], want)
+		}
+		if args[snapshotCreatedByArg] != "user@example.com" {
+			t.Errorf("snapshot %d created by = %v, want user@example.com", i, args[snapshotCreatedByArg])
+		}
+	}
+}
+
+func TestListCalculationHistory(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	seedPendingCalculation(mock, "APP-1")
+
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	snapshot := func(id int64, totalIncome string, by string, at time.Time) []any {
+		return []any{id, "SA", "LAK", "1", totalIncome, totalIncome, "0", "0", "0", "3", startedAt, endedAt, by, at}
+	}
+	history := mock.ExpectQuery(`FROM statement_file_analysis_history`).WillReturnRows(
+		[]string{
+			"history_id", "new_product", "new_account_currency", "new_exchange_rate", "new_total_income",
+			"new_total_basic_salary", "new_total_other_income", "new_monthly_net_income", "new_monthly_average_income",
+			"new_period_in_month", "new_started_at", "new_ended_at", "created_by", "created_at",
+		},
+		snapshot(1, "5000000", "user@example.com", endedAt),
+		snapshot(2, "6000000", "approver@example.com", endedAt.Add(time.Hour)),
+	)
+
+	result, err := s.ListCalculationHistory(userContext(), "APP-1")
+	if err != nil {
+		t.Fatalf("ListCalculationHistory() error = %v", err)
+	}
+
+	if len(result.Snapshots) != 2 {
+		t.Fatalf("snapshots = %d, want 2", len(result.Snapshots))
+	}
+	first, second := result.Snapshots[0], result.Snapshots[1]
+	if !first.TotalIncome.Equal(decimal.NewFromInt(5000000)) || !second.TotalIncome.Equal(decimal.NewFromInt(6000000)) {
+		t.Errorf("total incomes = %s, %s, want 5000000, 6000000", first.TotalIncome, second.TotalIncome)
+	}
+	if second.CreatedBy != "approver@example.com" || !second.CreatedAt.After(first.CreatedAt) {
+		t.Errorf("second snapshot = %s at %v, want approver@example.com after the first", second.CreatedBy, second.CreatedAt)
+	}
+	if args := history.Args(); len(args) != 1 || args[0] != int64(1) {
+		t.Errorf("history args = %v, want the calculation 1", args)
+	}
+}
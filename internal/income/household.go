@@ -0,0 +1,136 @@
+package income
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+type HouseholdReq struct {
+	Numbers []string `json:"numbers"`
+}
+
+// HouseholdBorrower is the income of one borrower of a joint application.
+type HouseholdBorrower struct {
+	Number             string          `json:"number"`
+	Product            string          `json:"product"`
+	AccountDisplayName string          `json:"accountDisplayName"`
+	AccountCurrency    string          `json:"accountCurrency"`
+	ExchangeRate       decimal.Decimal `json:"exchangeRate"`
+	MonthlyNetIncome   decimal.Decimal `json:"monthlyNetIncome"`
+}
+
+// HouseholdIncome is the combined income of the borrowers of a joint application.
+type HouseholdIncome struct {
+	Borrowers             []*HouseholdBorrower `json:"borrowers"`
+	TotalMonthlyNetIncome decimal.Decimal      `json:"totalMonthlyNetIncome"`
+
+	// CurrencyMismatch is set when the accounts of the borrowers are in different currencies.
+	CurrencyMismatch bool `json:"currencyMismatch"`
+}
+
+func validateHouseholdNumbers(numbers []string) error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if len(numbers) < 2 {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: "Numbers must contain at least two calculation numbers",
+		})
+	}
+
+	seen := make(map[string]bool, len(numbers))
+	for i, n := range numbers {
+		n = strings.TrimSpace(n)
+		if n == "" {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("numbers[%d]", i),
+				Description: "Number must not be empty",
+			})
+			continue
+		}
+
+		if seen[n] {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("numbers[%d]", i),
+				Description: "Number must not be duplicated",
+			})
+		}
+		seen[n] = true
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Household is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// Household combines the monthly net income of the calculations with the given numbers,
+// e.g. the borrowers of a joint application.
+func (s *Service) Household(ctx context.Context, numbers []string) (*HouseholdIncome, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "Household"),
+		zap.String("Username", claims.Username),
+		zap.Strings("numbers", numbers),
+	)
+
+	if err := validateHouseholdNumbers(numbers); err != nil {
+		return nil, err
+	}
+
+	household := &HouseholdIncome{
+		Borrowers:             make([]*HouseholdBorrower, 0, len(numbers)),
+		TotalMonthlyNetIncome: decimal.Zero,
+	}
+	for _, n := range numbers {
+		calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+			Number:    strings.TrimSpace(n),
+			createdBy: claims.VisibleCreator(),
+		})
+		if errors.Is(err, ErrCalculationNotFound) {
+			return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+		}
+		if err != nil {
+			zlog.Error("failed to get calculation by number", zap.Error(err))
+			return nil, err
+		}
+
+		household.add(calculation)
+	}
+
+	return household, nil
+}
+
+func (h *HouseholdIncome) add(c *Calculation) {
+	if len(h.Borrowers) > 0 && !strings.EqualFold(h.Borrowers[0].AccountCurrency, c.Account.Currency) {
+		h.CurrencyMismatch = true
+	}
+
+	h.Borrowers = append(h.Borrowers, &HouseholdBorrower{
+		Number:             c.Number,
+		Product:            c.Product.String(),
+		AccountDisplayName: c.Account.DisplayName,
+		AccountCurrency:    c.Account.Currency,
+		ExchangeRate:       c.ExchangeRate,
+		MonthlyNetIncome:   c.MonthlyNetIncome,
+	})
+	h.TotalMonthlyNetIncome = h.TotalMonthlyNetIncome.Add(c.MonthlyNetIncome)
+}
@@ -0,0 +1,90 @@
+package income
+
+import (
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// seedHouseholdCalculation seeds a completed calculation of the number
+// whose account is in the given currency with the given monthly net income, and returns its query.
+func seedHouseholdCalculation(mock *dbtest.Mock, number, currency, netIncome string) *dbtest.Expectation {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	return mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+		1, "statement.pdf", number, "PL", currency, "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", netIncome,
+		"0", "3", startedAt, endedAt, "COMPLETED", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", endedAt, "user@example.com", endedAt, nil,
+	})
+}
+
+func TestHousehold(t *testing.T) {
+	tests := []struct {
+		name         string
+		currencies   []string
+		wantMismatch bool
+	}{
+		{name: "same currency", currencies: []string{"LAK", "LAK"}},
+		{name: "currency mismatch", currencies: []string{"LAK", "USD"}, wantMismatch: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			seedHouseholdCalculation(mock, "APP-1", tt.currencies[0], "5000000")
+			seedHouseholdCalculation(mock, "APP-2", tt.currencies[1], "3500000")
+
+			household, err := s.Household(userContext(), []string{"APP-1", " APP-2 "})
+			if err != nil {
+				t.Fatalf("Household() error = %v", err)
+			}
+			if !household.TotalMonthlyNetIncome.Equal(decimal.NewFromInt(8500000)) {
+				t.Errorf("total monthly net income = %s, want 8500000", household.TotalMonthlyNetIncome)
+			}
+			if household.CurrencyMismatch != tt.wantMismatch {
+				t.Errorf("currency mismatch = %v, want %v", household.CurrencyMismatch, tt.wantMismatch)
+			}
+			if len(household.Borrowers) != 2 || household.Borrowers[1].Number != "APP-2" ||
+				!household.Borrowers[1].MonthlyNetIncome.Equal(decimal.NewFromInt(3500000)) {
+				t.Errorf("borrowers = %+v, want APP-1 and APP-2 with their income", household.Borrowers)
+			}
+		})
+	}
+}
+
+func TestHouseholdValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		numbers []string
+	}{
+		{name: "single number", numbers: []string{"APP-1"}},
+		{name: "empty number", numbers: []string{"APP-1", " "}},
+		{name: "duplicate number", numbers: []string{"APP-1", "APP-1 "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newCalculateTestService(t)
+			if _, err := s.Household(userContext(), tt.numbers); rpcStatus.Code(err) != codes.InvalidArgument {
+				t.Fatalf("Household() error = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
+
+func TestHouseholdCalculationNotFound(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	seedHouseholdCalculation(mock, "APP-1", "LAK", "5000000")
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`)
+
+	if _, err := s.Household(userContext(), []string{"APP-1", "APP-2"}); rpcStatus.Code(err) != codes.NotFound {
+		t.Fatalf("Household() error = %v, want NotFound", err)
+	}
+}
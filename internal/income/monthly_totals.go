@@ -0,0 +1,107 @@
+package income
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// MonthlyTotal is the income received in a month across the salary, allowance and commission categories.
+type MonthlyTotal struct {
+	Month      string          `json:"month"`
+	Salary     decimal.Decimal `json:"salary"`
+	Allowance  decimal.Decimal `json:"allowance"`
+	Commission decimal.Decimal `json:"commission"`
+	Total      decimal.Decimal `json:"total"`
+}
+
+type MonthlyTotalsResult struct {
+	MonthlyTotals []*MonthlyTotal `json:"monthlyTotals"`
+}
+
+// monthlyTotals merges the salary, allowance and commission breakdowns of the calculation by month,
+// in chronological order. The allowances are not broken down by month, so they are counted
+// in the month of their transaction date.
+func (c *Calculation) monthlyTotals() []*MonthlyTotal {
+	months := make(map[string]*MonthlyTotal)
+	month := func(key string) *MonthlyTotal {
+		m, ok := months[key]
+		if !ok {
+			m = &MonthlyTotal{Month: key}
+			months[key] = m
+		}
+		return m
+	}
+
+	if c.SalaryBreakdown != nil {
+		for _, s := range c.SalaryBreakdown.MonthlySalaries {
+			m := month(s.Month)
+			m.Salary = m.Salary.Add(sumTransactions(s.Transactions))
+		}
+	}
+
+	if c.AllowanceBreakdown != nil {
+		for _, a := range c.AllowanceBreakdown.Allowances {
+			for _, t := range a.Transactions {
+				m := month(time.Time(t.Date).Format("January-2006"))
+				m.Allowance = m.Allowance.Add(t.Amount)
+			}
+		}
+	}
+
+	if c.CommissionBreakdown != nil {
+		for _, cm := range c.CommissionBreakdown.Commissions {
+			m := month(cm.Month)
+			m.Commission = m.Commission.Add(sumTransactions(cm.Transactions))
+		}
+	}
+
+	totals := make([]*MonthlyTotal, 0, len(months))
+	for _, m := range months {
+		m.Total = m.Salary.Add(m.Allowance).Add(m.Commission)
+		totals = append(totals, m)
+	}
+
+	sort.Slice(totals, func(i, j int) bool {
+		ti, _ := time.Parse("January-2006", totals[i].Month)
+		tj, _ := time.Parse("January-2006", totals[j].Month)
+		return ti.Before(tj)
+	})
+
+	return totals
+}
+
+// MonthlyTotals returns the income received each month by the calculation of the given number,
+// all categories combined.
+func (s *Service) MonthlyTotals(ctx context.Context, number string) (*MonthlyTotalsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "MonthlyTotals"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	return &MonthlyTotalsResult{
+		MonthlyTotals: calculation.monthlyTotals(),
+	}, nil
+}
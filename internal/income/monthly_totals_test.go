@@ -0,0 +1,52 @@
+package income
+
+import (
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestMonthlyTotalsMergesCategories(t *testing.T) {
+	tx := func(year int, month time.Month, amount int64) Transaction {
+		return Transaction{Date: types.DDMMYYYY(time.Date(year, month, 15, 0, 0, 0, 0, time.UTC)), Amount: decimal.NewFromInt(amount)}
+	}
+
+	c := &Calculation{
+		SalaryBreakdown: &SalaryBreakdown{MonthlySalaries: []MonthlySalary{
+			{Month: "January-2025", Transactions: []Transaction{tx(2025, time.January, 5000000)}},
+			{Month: "December-2024", Transactions: []Transaction{tx(2024, time.December, 4000000), tx(2024, time.December, 1000000)}},
+		}},
+		AllowanceBreakdown: &AllowanceBreakdown{Allowances: []Allowance{
+			{Title: "transport", Transactions: []Transaction{tx(2024, time.December, 300000), tx(2025, time.January, 300000)}},
+			{Title: "phone", Transactions: []Transaction{tx(2025, time.January, 100000)}},
+		}},
+		CommissionBreakdown: &CommissionBreakdown{Commissions: []Commission{
+			{Month: "January-2025", Transactions: []Transaction{tx(2025, time.January, 2000000)}},
+			{Month: "February-2025", Transactions: []Transaction{tx(2025, time.February, 700000)}},
+		}},
+	}
+
+	want := []struct {
+		month                                string
+		salary, allowance, commission, total int64
+	}{
+		{month: "December-2024", salary: 5000000, allowance: 300000, total: 5300000},
+		{month: "January-2025", salary: 5000000, allowance: 400000, commission: 2000000, total: 7400000},
+		{month: "February-2025", commission: 700000, total: 700000},
+	}
+
+	got := c.monthlyTotals()
+	if len(got) != len(want) {
+		t.Fatalf("got %d months, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Month != w.month || !g.Salary.Equal(decimal.NewFromInt(w.salary)) || !g.Allowance.Equal(decimal.NewFromInt(w.allowance)) ||
+			!g.Commission.Equal(decimal.NewFromInt(w.commission)) || !g.Total.Equal(decimal.NewFromInt(w.total)) {
+			t.Errorf("month %d = %s salary %s allowance %s commission %s total %s, want %+v",
+				i, g.Month, g.Salary, g.Allowance, g.Commission, g.Total, w)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package income
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// NetIncomeRange is the range of the reasonable monthly net incomes in a currency.
+// A calculation outside of it is likely made from a misparsed statement.
+type NetIncomeRange struct {
+	Min decimal.Decimal `json:"min"`
+
+	// Max is the maximum reasonable net income, zero means no maximum.
+	Max decimal.Decimal `json:"max"`
+}
+
+func (r NetIncomeRange) contains(amount decimal.Decimal) bool {
+	if amount.LessThan(r.Min) {
+		return false
+	}
+	return r.Max.IsZero() || !amount.GreaterThan(r.Max)
+}
+
+// ParseNetIncomeRanges parses the net income ranges by currency written as CUR:min-max separated by commas,
+// e.g. "LAK:1000000-500000000,USD:50-20000". The maximum may be omitted, e.g. "THB:1000-".
+func ParseNetIncomeRanges(s string) (map[string]NetIncomeRange, error) {
+	ranges := make(map[string]NetIncomeRange)
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		code, bounds, ok := strings.Cut(entry, ":")
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !ok || len(code) != 3 {
+			return nil, fmt.Errorf("invalid net income range %q, must be CUR:min-max", entry)
+		}
+
+		rawMin, rawMax, ok := strings.Cut(bounds, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid net income range %q, must be CUR:min-max", entry)
+		}
+
+		var r NetIncomeRange
+		var err error
+		if r.Min, err = decimal.NewFromString(strings.TrimSpace(rawMin)); err != nil {
+			return nil, fmt.Errorf("invalid minimum of net income range %q: %w", entry, err)
+		}
+		if rawMax = strings.TrimSpace(rawMax); rawMax != "" {
+			if r.Max, err = decimal.NewFromString(rawMax); err != nil {
+				return nil, fmt.Errorf("invalid maximum of net income range %q: %w", entry, err)
+			}
+		}
+		if r.Min.IsNegative() || (!r.Max.IsZero() && r.Max.LessThan(r.Min)) {
+			return nil, fmt.Errorf("invalid net income range %q, the minimum must not be negative nor above the maximum", entry)
+		}
+
+		ranges[code] = r
+	}
+
+	return ranges, nil
+}
+
+// SetNetIncomeRanges sets the ranges of the reasonable monthly net incomes by currency code.
+// The calculations of an account currency without a range are never flagged.
+func (s *Service) SetNetIncomeRanges(ranges map[string]NetIncomeRange) {
+	s.netIncomeRanges = ranges
+}
+
+// flagNetIncomeRange flags the calculation when its monthly net income in the account currency,
+// i.e. before the conversion to the base currency, is outside of the range of the currency.
+// It is a warning, the calculation is still made.
+func (s *Service) flagNetIncomeRange(c *Calculation) {
+	r, ok := s.netIncomeRanges[strings.ToUpper(strings.TrimSpace(c.Account.Currency))]
+	c.NetIncomeOutOfRange = ok && !r.contains(c.MonthlyAverageIncome)
+}
@@ -0,0 +1,87 @@
+package income
+
+import (
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestParseNetIncomeRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    map[string]NetIncomeRange
+		wantErr bool
+	}{
+		{in: "", want: map[string]NetIncomeRange{}},
+		{in: "lak:1000000-500000000, THB:1000-", want: map[string]NetIncomeRange{
+			"LAK": {Min: decimal.NewFromInt(1000000), Max: decimal.NewFromInt(500000000)},
+			"THB": {Min: decimal.NewFromInt(1000)},
+		}},
+		{in: "LAK", wantErr: true},
+		{in: "LAK:1000", wantErr: true},
+		{in: "LAK:500-100", wantErr: true},
+		{in: "LAK:-5-100", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseNetIncomeRanges(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseNetIncomeRanges() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseNetIncomeRanges() = %v, want %v", got, tt.want)
+			}
+			for code, r := range tt.want {
+				if !got[code].Min.Equal(r.Min) || !got[code].Max.Equal(r.Max) {
+					t.Errorf("range of %s = %v, want %v", code, got[code], r)
+				}
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeNetIncomeRange(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+	)
+
+	tests := []struct {
+		name     string
+		ranges   map[string]NetIncomeRange
+		wantFlag bool
+	}{
+		{name: "no range for the currency", ranges: map[string]NetIncomeRange{"USD": {Max: decimal.NewFromInt(1)}}},
+		{name: "within range", ranges: map[string]NetIncomeRange{"LAK": {Min: decimal.NewFromInt(1000000), Max: decimal.NewFromInt(50000000)}}},
+		{name: "below range", ranges: map[string]NetIncomeRange{"LAK": {Min: decimal.NewFromInt(6000000)}}, wantFlag: true},
+		{name: "above range", ranges: map[string]NetIncomeRange{"LAK": {Max: decimal.NewFromInt(4000000)}}, wantFlag: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetNetIncomeRanges(tt.ranges)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			insert := expectSave(mock)
+
+			// The flag is a warning, the calculation is still made and saved.
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if calculation.NetIncomeOutOfRange != tt.wantFlag {
+				t.Errorf("net income out of range = %v, want %v", calculation.NetIncomeOutOfRange, tt.wantFlag)
+			}
+			if got := insert.Args()[netIncomeOutOfRangeArg]; got != tt.wantFlag {
+				t.Errorf("net income out of range saved = %v, want %v", got, tt.wantFlag)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package income
+
+import (
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// listedCalculationRow returns the row of a pending calculation as selected by listCalculations.
+func listedCalculationRow(id int64, number string) []any {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	return []any{
+		id, "statement.xlsx", number, "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "3", startedAt, endedAt, "PENDING", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", endedAt, "user@example.com", endedAt, nil,
+	}
+}
+
+func TestListCalculationsAscendingPages(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+
+	first := mock.ExpectQuery(`FROM statement_file_analysis WHERE \(created_by = @p1\) ORDER BY number ASC, id ASC`).
+		WillReturnRows(calculationColumns, listedCalculationRow(3, "APP-1"), listedCalculationRow(1, "APP-2"))
+	page, err := s.ListCalculations(userContext(), &CalculationQuery{PageSize: 2, OrderBy: "number", OrderDir: "asc"})
+	if err != nil {
+		t.Fatalf("ListCalculations() error = %v", err)
+	}
+	if !first.Used() || len(page.Calculations) != 2 || page.NextPageToken == "" {
+		t.Fatalf("first page = %d calculations with token %q, want 2 and a next page", len(page.Calculations), page.NextPageToken)
+	}
+
+	// The next page follows the last number, the ID breaking the ties of equal numbers.
+	second := mock.ExpectQuery(`WHERE \(created_by = @p1 AND \(number > @p2 OR \(number = @p3 AND id > @p4\)\)\) ORDER BY number ASC, id ASC`).
+		WillReturnRows(calculationColumns, listedCalculationRow(2, "APP-3"))
+	page, err = s.ListCalculations(userContext(), &CalculationQuery{PageSize: 2, OrderBy: "number", OrderDir: "asc", PageToken: page.NextPageToken})
+	if err != nil {
+		t.Fatalf("ListCalculations() next page error = %v", err)
+	}
+	if args := second.Args(); len(args) != 4 || args[1] != "APP-2" || args[2] != "APP-2" || args[3] != "1" {
+		t.Errorf("next page args = %v, want after APP-2 of ID 1", args)
+	}
+	if len(page.Calculations) != 1 || page.NextPageToken != "" {
+		t.Errorf("last page = %d calculations with token %q, want 1 and no next page", len(page.Calculations), page.NextPageToken)
+	}
+}
+
+func TestListCalculationsInvalidOrder(t *testing.T) {
+	// No statement is expected, the order is rejected before the query.
+	s, _ := newCalculateTestService(t)
+
+	_, err := s.ListCalculations(userContext(), &CalculationQuery{OrderBy: "password_hash"})
+	if rpcStatus.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListCalculations() error = %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,10 @@
+package income
+
+// SetExcludePartialFinalMonth sets whether the transactions of the final month are left out
+// of the totals when the statement ends before the last day of that month, e.g. on 15/03.
+// The period in months counts the months of the statement without the partial final month,
+// so it is never in the divisor; excluding its transactions keeps
+// the totals consistent with it. It is off by default.
+func (s *Service) SetExcludePartialFinalMonth(exclude bool) {
+	s.excludePartialFinalMonth = exclude
+}
@@ -0,0 +1,54 @@
+package income
+
+import (
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestCalculatePartialFinalMonth(t *testing.T) {
+	tests := []struct {
+		name       string
+		exclude    bool
+		wantTotal  int64
+		wantMonths int
+	}{
+		{name: "included", wantTotal: 15000000, wantMonths: 3},
+		{name: "excluded", exclude: true, wantTotal: 10000000, wantMonths: 2},
+	}
+
+	file := writeStatement(t, "01/01/2025 ຫາ 15/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("10/03/2025", "Salary March", 5000000),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetExcludePartialFinalMonth(tt.exclude)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+
+			// The period never counts the partial final month, whether its transactions are excluded or not.
+			if !calculation.PeriodInMonth.Equal(decimal.NewFromInt(2)) {
+				t.Errorf("period = %s, want 2", calculation.PeriodInMonth)
+			}
+			if !calculation.SalaryBreakdown.Total.Equal(decimal.NewFromInt(tt.wantTotal)) {
+				t.Errorf("total salary = %s, want %d", calculation.SalaryBreakdown.Total, tt.wantTotal)
+			}
+			if got := len(calculation.SalaryBreakdown.MonthlySalaries); got != tt.wantMonths {
+				t.Errorf("months = %d, want %d", got, tt.wantMonths)
+			}
+			if calculation.config.ExcludePartialFinalMonth != tt.exclude {
+				t.Errorf("recorded exclusion = %v, want %v", calculation.config.ExcludePartialFinalMonth, tt.exclude)
+			}
+		})
+	}
+}
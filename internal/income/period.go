@@ -0,0 +1,123 @@
+package income
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// recomputePeriodsBatchSize is the number of calculations checked per batch by RecomputePeriods.
+const recomputePeriodsBatchSize = 200
+
+type RecomputePeriodsReq struct {
+	// IncludeCompleted also corrects the completed calculations, only pending ones are corrected otherwise.
+	IncludeCompleted bool `json:"includeCompleted"`
+}
+
+type RecomputePeriodsResult struct {
+	Scanned   int64 `json:"scanned"`
+	Corrected int64 `json:"corrected"`
+}
+
+// recomputePeriod sets the period in months and re-derives the averages depending on it.
+func (c *Calculation) recomputePeriod(by string, period, otherIncomeFactor decimal.Decimal) error {
+	mapCal, err := c.toStateMap()
+	if err != nil {
+		return fmt.Errorf("failed to convert calculation to state map: %w", err)
+	}
+
+	c.UpdatedAt = time.Now()
+	c.UpdatedBy = by
+	c.populate(c.Product, period, c.ExchangeRate, otherIncomeFactor, c.OtherIncomeCapPercentage, mapCal)
+	return nil
+}
+
+// RecomputePeriods corrects the calculations whose period in months no longer matches
+// the one counted from their statement period, e.g. after a change of countMonth,
+// and re-derives their averages. Only admins are allowed to recompute the periods.
+func (s *Service) RecomputePeriods(ctx context.Context, in *RecomputePeriodsReq) (*RecomputePeriodsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "RecomputePeriods"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	result := new(RecomputePeriodsResult)
+	q := new(BatchGetCalculationsQuery)
+	var nextID int64
+	for {
+		calculations, err := batchGetCalculations(ctx, s.db, recomputePeriodsBatchSize, nextID, q)
+		if err != nil {
+			zlog.Error("failed to batch get calculations", zap.Error(err))
+			return nil, err
+		}
+		if len(calculations) == 0 {
+			break
+		}
+		nextID = calculations[len(calculations)-1].ID
+
+		for _, c := range calculations {
+			result.Scanned++
+			if c.IsCompleted() && !in.IncludeCompleted {
+				continue
+			}
+
+			period := countMonth(c.StartedAt, c.EndedAt)
+			if period.Equal(c.PeriodInMonth) {
+				continue
+			}
+
+			// The batch does not carry every field of a calculation, so it is read in full before saving.
+			calculation, err := getCalculation(ctx, s.db, &CalculationQuery{ID: c.ID})
+			if err != nil {
+				zlog.Error("failed to get calculation", zap.Int64("ID", c.ID), zap.Error(err))
+				return nil, err
+			}
+
+			// The averages are re-derived under the configuration the calculation was created under,
+			// the current settings are used only for the calculations created before it was recorded.
+			factor, threshold := cfg.OtherIncomeFactor, cfg.SalaryVariationThreshold
+			recorded, err := getCalculationConfig(ctx, s.db, &CalculationQuery{ID: c.ID})
+			if err != nil {
+				zlog.Error("failed to get calculation config", zap.Int64("ID", c.ID), zap.Error(err))
+				return nil, err
+			}
+			if recorded.Config != nil {
+				factor, threshold = recorded.Config.OtherIncomeFactor, recorded.Config.SalaryVariationThreshold
+			}
+
+			if err := calculation.recomputePeriod(claims.Username, period, factor); err != nil {
+				zlog.Error("failed to recompute period", zap.String("Number", calculation.Number), zap.Error(err))
+				return nil, err
+			}
+			flagSalaryVariation(calculation, threshold)
+			s.flagNetIncomeRange(calculation)
+
+			if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
+				zlog.Error("failed to save calculation", zap.String("Number", calculation.Number), zap.Error(err))
+				return nil, err
+			}
+			result.Corrected++
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,116 @@
+package income
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"go.uber.org/zap"
+)
+
+func TestCountMonth(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int64
+	}{
+		{name: "full months", from: date(2025, 1, 1), to: date(2025, 3, 31), want: 3},
+		{name: "partial final month", from: date(2025, 1, 1), to: date(2025, 3, 15), want: 2},
+		{name: "across years", from: date(2024, 11, 1), to: date(2025, 4, 30), want: 6},
+		{name: "single month", from: date(2025, 2, 1), to: date(2025, 2, 28), want: 1},
+		{name: "ended before started", from: date(2025, 3, 1), to: date(2025, 1, 31), want: 0},
+		{name: "no period", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countMonth(tt.from, tt.to); got.IntPart() != tt.want {
+				t.Errorf("countMonth() = %s, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// batchColumns are the columns selected by batchGetCalculations.
+var batchColumns = []string{
+	"id", "statement_file_name", "number", "product", "account_currency", "account_number", "account_display_name",
+	"exchange_rate", "exchange_rate_source", "income_direction", "other_income_cap_percentage", "salary_variation",
+	"salary_volatile", "net_income_out_of_range", "basic_salary_interview", "total_income", "total_basic_salary",
+	"total_other_income", "monthly_net_income", "monthly_average_income", "period_in_month", "started_at", "ended_at",
+	"status", "source_income", "monthly_salary", "allowance", "commission", "created_by", "created_at", "updated_by",
+	"updated_at", "completed_at",
+}
+
+// calculationColumns are the columns selected by getCalculation.
+var calculationColumns = []string{
+	"id", "statement_file_name", "number", "product", "account_currency", "account_number", "account_display_name",
+	"exchange_rate", "exchange_rate_source", "income_direction", "other_income_cap_percentage", "salary_variation",
+	"salary_volatile", "net_income_out_of_range", "basic_salary_interview", "total_income", "total_basic_salary",
+	"total_other_income", "eighty_percent_of_monthly_other_income", "monthly_other_income", "monthly_net_income",
+	"monthly_average_income", "period_in_month", "started_at", "ended_at", "status", "source_income", "monthly_salary",
+	"allowance", "commission", "excluded_transactions", "created_by", "created_at", "updated_by", "updated_at", "completed_at",
+}
+
+// Indexes of the arguments of the update of a calculation.
+const (
+	basicSalaryInterviewArg = 14
+	eightyPercentArg        = 18
+	averageIncomeArg        = 20
+	periodArg               = 21
+)
+
+func TestRecomputePeriodsCorrectsOffByOnePeriod(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	commission := []byte(`{"commissions":[{"month":"January-2025","transactions":[{"date":"15-01-2025","amount":"300000"}],"total":"300000"}],"total":"300000"}`)
+
+	db, mock := dbtest.New(t)
+	// The calculation was saved with the period counted without its final month, 2 instead of 3.
+	mock.ExpectQuery(`TOP 200 id`).WillReturnRows(batchColumns, []any{
+		1, "statement.pdf", "APP-1", "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "2", startedAt, endedAt,
+		"PENDING", []byte(`{}`), []byte(`{}`), []byte(`{}`), commission, "user@example.com", now, "user@example.com",
+		now, nil,
+	})
+	mock.ExpectQuery(`TOP 200 id`)
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+		1, "statement.pdf", "APP-1", "SA", "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "2", startedAt, endedAt, "PENDING", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), commission, nil, "user@example.com", now, "user@example.com", now, nil,
+	})
+	// The calculation was created under an other income factor of 0.5, the current one is 0.8.
+	mock.ExpectQuery(`TOP 1 number,\s*config`).WillReturnRows([]string{"number", "config"}, []any{"APP-1", []byte(`{"otherIncomeFactor":"0.5"}`)})
+	update := mock.ExpectExec(`UPDATE statement_file_analysis`)
+	mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+
+	s := &Service{db: db, zlog: zap.NewNop()}
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+	result, err := s.RecomputePeriods(ctx, &RecomputePeriodsReq{})
+	if err != nil {
+		t.Fatalf("RecomputePeriods() error = %v", err)
+	}
+	if result.Scanned != 1 || result.Corrected != 1 {
+		t.Errorf("RecomputePeriods() = %+v, want 1 scanned and 1 corrected", result)
+	}
+
+	args := update.Args()
+	if got := args[periodArg]; got != "3" {
+		t.Errorf("period saved = %v, want 3", got)
+	}
+	// The commission of 300000 over 3 months at the recorded factor of 0.5.
+	if got := args[eightyPercentArg]; got != "50000" {
+		t.Errorf("eighty percent of monthly other income saved = %v, want 50000", got)
+	}
+}
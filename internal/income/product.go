@@ -0,0 +1,130 @@
+package income
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// otherIncomeFactor is the part of the other income (commission and allowance)
+// counted in the monthly average income of PL/SF products, unless set otherwise in the settings.
+var otherIncomeFactor = decimal.NewFromFloat(0.8)
+
+// Product describes how the income of a product is computed.
+type Product struct {
+	Code                     types.ProductType `json:"code"`
+	DisplayName              string            `json:"displayName"`
+	Description              string            `json:"description"`
+	BasicSalarySource        string            `json:"basicSalarySource"`
+	OtherIncomeTreatment     string            `json:"otherIncomeTreatment"`
+	OtherIncomeFactor        decimal.Decimal   `json:"otherIncomeFactor"`
+	OtherIncomeCapPercentage decimal.Decimal   `json:"otherIncomeCapPercentage"`
+
+	// MinPeriodInMonths is the minimum number of months a statement must cover, zero for no minimum.
+	MinPeriodInMonths int64 `json:"minPeriodInMonths"`
+}
+
+type ListProductsResult struct {
+	Products []*Product `json:"products"`
+}
+
+// products is the configuration of the known products, in display order.
+// It must be kept in line with averageMonthlyIncome.
+var products = []Product{
+	{
+		Code:                 types.ProductSA,
+		DisplayName:          "Salary Advance",
+		Description:          "Monthly average income is the basic salary plus the monthly average of allowances and commissions.",
+		BasicSalarySource:    "Total of the lowest salary received each month divided by the period in months, or the basic salary from interview if lower.",
+		OtherIncomeTreatment: "Allowances and commissions are counted in full.",
+		OtherIncomeFactor:    decimal.NewFromInt(1),
+	},
+	{
+		Code:                 types.ProductSF,
+		DisplayName:          "Salary Financing",
+		Description:          "Monthly average income is the basic salary plus a part of the monthly average of other income.",
+		BasicSalarySource:    "Lowest monthly salary within the period, or the basic salary from interview if lower.",
+		OtherIncomeTreatment: "Allowances and commissions are multiplied by the other income factor and capped at the other income cap percentage of basic salary, if any.",
+		OtherIncomeFactor:    otherIncomeFactor,
+	},
+	{
+		Code:                 types.ProductPL,
+		DisplayName:          "Personal Loan",
+		Description:          "Monthly average income is the basic salary plus a part of the monthly average of other income.",
+		BasicSalarySource:    "Lowest monthly salary within the period, or the basic salary from interview if lower.",
+		OtherIncomeTreatment: "Allowances and commissions are multiplied by the other income factor and capped at the other income cap percentage of basic salary, if any.",
+		OtherIncomeFactor:    otherIncomeFactor,
+	},
+}
+
+// ListProducts returns the known products and how their income is computed,
+// including the other income factor and cap in effect.
+func (s *Service) ListProducts(ctx context.Context) (*ListProductsResult, error) {
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		s.zlog.Error("failed to get settings", zap.String("Method", "ListProducts"), zap.Error(err))
+		return nil, err
+	}
+
+	result := make([]*Product, 0, len(products))
+	for _, p := range products {
+		p.OtherIncomeCapPercentage = decimal.Zero
+		if p.Code == types.ProductPL || p.Code == types.ProductSF {
+			p.OtherIncomeFactor = cfg.OtherIncomeFactor
+			p.OtherIncomeCapPercentage = cfg.OtherIncomeCapPercentage
+		}
+		p.MinPeriodInMonths = s.minPeriods[p.Code]
+		result = append(result, &p)
+	}
+
+	return &ListProductsResult{
+		Products: result,
+	}, nil
+}
+
+// SetMinPeriod sets the minimum number of months the statement of a calculation
+// of the given product must cover, e.g. 6 for PL. Zero removes the minimum.
+func (s *Service) SetMinPeriod(product types.ProductType, months int64) error {
+	if !isKnownProduct(product) {
+		return fmt.Errorf("minimum period is not supported for product %s", product)
+	}
+	if months < 0 {
+		return fmt.Errorf("minimum period must not be negative")
+	}
+
+	s.minPeriods[product] = months
+	return nil
+}
+
+func isKnownProduct(product types.ProductType) bool {
+	for _, p := range products {
+		if p.Code == product {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkMinPeriod returns a FailedPrecondition error if the period of the calculation
+// is shorter than the minimum period of its product.
+func (s *Service) checkMinPeriod(c *Calculation) error {
+	minimum := s.minPeriods[c.Product]
+	if minimum <= 0 || c.PeriodInMonth.GreaterThanOrEqual(decimal.NewFromInt(minimum)) {
+		return nil
+	}
+
+	return rpcStatus.Errorf(
+		codes.FailedPrecondition,
+		"The statement covers %s months but product %s requires at least %d months, %s months are missing.",
+		c.PeriodInMonth,
+		c.Product,
+		minimum,
+		decimal.NewFromInt(minimum).Sub(c.PeriodInMonth),
+	)
+}
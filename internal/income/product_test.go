@@ -0,0 +1,107 @@
+package income
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestListProducts(t *testing.T) {
+	s, _ := newCalculateTestService(t)
+	s.SetOtherIncomeCapPercentage(decimal.NewFromInt(50))
+	if err := s.SetMinPeriod(types.ProductPL, 6); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := s.ListProducts(userContext())
+	if err != nil {
+		t.Fatalf("ListProducts() error = %v", err)
+	}
+
+	want := map[types.ProductType]struct {
+		factor    decimal.Decimal
+		cap       decimal.Decimal
+		minPeriod int64
+	}{
+		types.ProductSA: {factor: decimal.NewFromInt(1), cap: decimal.Zero},
+		types.ProductSF: {factor: decimal.NewFromFloat(0.8), cap: decimal.NewFromInt(50)},
+		types.ProductPL: {factor: decimal.NewFromFloat(0.8), cap: decimal.NewFromInt(50), minPeriod: 6},
+	}
+	if len(result.Products) != len(want) {
+		t.Fatalf("products = %d, want %d", len(result.Products), len(want))
+	}
+	for _, p := range result.Products {
+		w, ok := want[p.Code]
+		if !ok {
+			t.Errorf("unexpected product %s", p.Code)
+			continue
+		}
+		delete(want, p.Code)
+
+		if p.DisplayName == "" || p.Description == "" || p.BasicSalarySource == "" || p.OtherIncomeTreatment == "" {
+			t.Errorf("product %s is not described: %+v", p.Code, p)
+		}
+		if !p.OtherIncomeFactor.Equal(w.factor) || !p.OtherIncomeCapPercentage.Equal(w.cap) || p.MinPeriodInMonths != w.minPeriod {
+			t.Errorf("product %s = factor %s, cap %s, min period %d, want %s, %s, %d",
+				p.Code, p.OtherIncomeFactor, p.OtherIncomeCapPercentage, p.MinPeriodInMonths, w.factor, w.cap, w.minPeriod)
+		}
+	}
+	for code := range want {
+		t.Errorf("product %s is missing", code)
+	}
+
+	// The configuration of the products is not changed by the settings in effect.
+	if !products[1].OtherIncomeCapPercentage.IsZero() {
+		t.Errorf("configured cap = %s, want it unchanged", products[1].OtherIncomeCapPercentage)
+	}
+}
+
+func TestCalculateIncomeMinPeriod(t *testing.T) {
+	// A statement of two months.
+	file := writeStatement(t, "01/01/2025 ຫາ 28/02/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+	)
+
+	tests := []struct {
+		product  types.ProductType
+		wantCode codes.Code
+	}{
+		{product: types.ProductSA, wantCode: codes.OK},
+		{product: types.ProductPL, wantCode: codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.product.String(), func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			if err := s.SetMinPeriod(types.ProductSA, 2); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.SetMinPeriod(types.ProductPL, 6); err != nil {
+				t.Fatal(err)
+			}
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			if tt.wantCode == codes.OK {
+				expectSave(mock)
+			}
+
+			_, err := s.CalculateIncome(userContext(), newCalculateReq(tt.product))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil && !strings.Contains(rpcStatus.Convert(err).Message(), "4 months are missing") {
+				t.Errorf("message = %q, want the shortfall of 4 months", rpcStatus.Convert(err).Message())
+			}
+		})
+	}
+
+	s, _ := newCalculateTestService(t)
+	if err := s.SetMinPeriod(types.ProductSA, -1); err == nil {
+		t.Error("SetMinPeriod() with a negative period succeeded, want an error")
+	}
+}
@@ -0,0 +1,59 @@
+package income
+
+import (
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// SetMergeSameDayCredits sets whether the transactions of a category received on the same day
+// are merged into one before the monthly totals and the times received are computed,
+// so a salary split into several same-day credits is counted once. It is off by default.
+func (s *Service) SetMergeSameDayCredits(merge bool) {
+	s.mergeSameDayCredits = merge
+}
+
+// mergeSameDayCredits merges the transactions of each category received on the same day,
+// within the same month or allowance title, and recomputes the amounts of the category.
+func (s statMap) mergeSameDayCredits() {
+	for _, stat := range s {
+		monthly := make([]decimal.Decimal, 0, len(stat.Monthly))
+		for key, tx := range stat.Transactions {
+			merged := mergeSameDayTransactions(tx)
+			for _, t := range merged {
+				monthly = append(monthly, t.Amount)
+			}
+			stat.Transactions[key] = merged
+		}
+		stat.Monthly = monthly
+	}
+}
+
+// mergeSameDayTransactions merges the transactions of the same date into one, in order of first receipt.
+// The merged transaction has the sum of the amounts, the bill numbers joined and the note of the first one.
+func mergeSameDayTransactions(tx []Transaction) []Transaction {
+	merged := make([]Transaction, 0, len(tx))
+	index := make(map[time.Time]int)
+	for _, t := range tx {
+		date := time.Time(t.Date)
+		i, ok := index[date]
+		if !ok {
+			index[date] = len(merged)
+			merged = append(merged, t)
+			continue
+		}
+
+		m := &merged[i]
+		m.Amount = m.Amount.Add(t.Amount)
+		if b := strings.TrimSpace(t.BillNumber); b != "" {
+			if m.BillNumber == "" {
+				m.BillNumber = b
+			} else {
+				m.BillNumber += ", " + b
+			}
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,69 @@
+package income
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+)
+
+func TestCalculateIncomeMergeSameDayCredits(t *testing.T) {
+	// The salary of January is split into two credits of the same day.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January part 1", 3000000),
+		credit("25/01/2025", "Salary January part 2", 2000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+	)
+
+	tests := []struct {
+		name              string
+		merge             bool
+		wantTimesReceived int64
+		wantBillNumber    string
+		wantAverage       int64
+	}{
+		// The smaller part of the split salary is counted as the salary of January.
+		{name: "default", wantTimesReceived: 2, wantBillNumber: "B-25/01/2025", wantAverage: 4000000},
+		{name: "merged", merge: true, wantTimesReceived: 1, wantBillNumber: "B-25/01/2025, B-25/01/2025", wantAverage: 5000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetMergeSameDayCredits(tt.merge)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			insert := expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+
+			january := calculation.SalaryBreakdown.MonthlySalaries[0]
+			if !january.TimesReceived.Equal(decimal.NewFromInt(tt.wantTimesReceived)) || len(january.Transactions) != int(tt.wantTimesReceived) {
+				t.Errorf("January received %s times in %d transactions, want %d", january.TimesReceived, len(january.Transactions), tt.wantTimesReceived)
+			}
+			if got := january.Transactions[0].BillNumber; got != tt.wantBillNumber {
+				t.Errorf("January bill number = %q, want %q", got, tt.wantBillNumber)
+			}
+			// Merging never changes the total received.
+			if !january.Total.Equal(decimal.NewFromInt(5000000)) {
+				t.Errorf("January total = %s, want 5000000", january.Total)
+			}
+			if !calculation.MonthlyAverageIncome.Equal(decimal.NewFromInt(tt.wantAverage)) {
+				t.Errorf("monthly average income = %s, want %d", calculation.MonthlyAverageIncome, tt.wantAverage)
+			}
+
+			var config CalculationConfig
+			if err := json.Unmarshal(insert.Args()[configArg].([]byte), &config); err != nil {
+				t.Fatal(err)
+			}
+			if config.MergeSameDayCredits != tt.merge {
+				t.Errorf("recorded merge same-day credits = %v, want %v", config.MergeSameDayCredits, tt.merge)
+			}
+		})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -15,6 +17,7 @@ import (
 	"github.com/10664kls/automatic-finance-api/internal/auth"
 	"github.com/10664kls/automatic-finance-api/internal/currency"
 	"github.com/10664kls/automatic-finance-api/internal/pager"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
 	"github.com/10664kls/automatic-finance-api/internal/statement"
 	"github.com/10664kls/automatic-finance-api/internal/types"
 	"github.com/shopspring/decimal"
@@ -25,12 +28,88 @@ import (
 	rpcStatus "google.golang.org/grpc/status"
 )
 
+// DefaultMaxStatementRows is the maximum number of rows parsed from a statement file
+// when no other limit is configured.
+const DefaultMaxStatementRows = 20000
+
+// DefaultMaxRecalculationMonths is the maximum number of months accepted in a recalculation
+// when no other limit is configured.
+const DefaultMaxRecalculationMonths = 60
+
+// ErrStatementTooLarge is returned when a statement file has more rows than the configured limit.
+var ErrStatementTooLarge = errors.New("statement file exceeds the maximum number of rows")
+
+// ErrAccountNumberFormat is returned when the account number of a statement file
+// does not match the configured account number pattern.
+var ErrAccountNumberFormat = errors.New("statement account number does not match the expected format")
+
+// ErrAccountCurrency is returned when the account currency cell of a statement file
+// is blank or does not hold a 3-letter currency code.
+var ErrAccountCurrency = errors.New("statement account currency is not a valid currency code")
+
 type Service struct {
-	currency  *currency.Service
-	statement *statement.Service
-	db        *sql.DB
-	mu        *sync.Mutex
-	zlog      *zap.Logger
+	currency         *currency.Service
+	statement        *statement.Service
+	db               *sql.DB
+	mu               *sync.Mutex
+	zlog             *zap.Logger
+	maxStatementRows int
+	defaultProduct   types.ProductType
+
+	// maxRecalculationMonths is the maximum number of months accepted in a recalculation.
+	maxRecalculationMonths int
+
+	// minPeriods are the minimum numbers of months a statement must cover by product.
+	minPeriods map[types.ProductType]int64
+
+	// otherIncomeCapPercentage caps the other income of PL/SF
+	// at this percentage of the basic salary. Zero means no cap.
+	otherIncomeCapPercentage decimal.Decimal
+
+	// completedGracePeriod is how long after completion the creator
+	// can still recalculate a completed calculation.
+	completedGracePeriod time.Duration
+
+	// salaryVariationThreshold is the coefficient of variation of the monthly salaries
+	// above which a calculation is flagged as volatile. Zero disables the flag.
+	salaryVariationThreshold decimal.Decimal
+
+	// accountNumberPattern is the format the account number of a statement must match.
+	// Nil accepts any account number.
+	accountNumberPattern *regexp.Regexp
+
+	// incomeDirection is how the income amounts are read from the statement files
+	// when the calculation request does not specify it.
+	incomeDirection IncomeDirection
+
+	// mergeSameDayCredits merges the same-day transactions of a category before computing
+	// the monthly totals and the times received, see SetMergeSameDayCredits.
+	mergeSameDayCredits bool
+
+	// excludePartialFinalMonth leaves the transactions of a partial final month out of the totals,
+	// see SetExcludePartialFinalMonth.
+	excludePartialFinalMonth bool
+
+	// netIncomeRanges are the reasonable monthly net incomes by currency code, see SetNetIncomeRanges.
+	netIncomeRanges map[string]NetIncomeRange
+
+	// exchangeRateOverrides are the fixed exchange rates by product and currency code, see SetExchangeRateOverrides.
+	exchangeRateOverrides map[types.ProductType]map[string]decimal.Decimal
+
+	// pinExchangeRates uses the rates effective at the end of the statements, see SetPinExchangeRates.
+	pinExchangeRates bool
+
+	// attentionCriteria are the conditions of the calculations listed by ListNeedingAttention.
+	attentionCriteria AttentionCriteria
+
+	// settings are the settings adjustable at runtime, see SetSettings.
+	settings *settings.Service
+
+	// wordlistCounter counts the transactions matched by each wordlist until the next flush.
+	wordlistCounter *wordlistCounter
+
+	// wordlistUsageWindow is how far back the usage of the wordlists is reported.
+	wordlistUsageWindow time.Duration
 }
 
 func NewService(_ context.Context, db *sql.DB, currency *currency.Service, statement *statement.Service, zlog *zap.Logger) (*Service, error) {
@@ -48,14 +127,112 @@ func NewService(_ context.Context, db *sql.DB, currency *currency.Service, state
 	}
 
 	return &Service{
-		db:        db,
-		currency:  currency,
-		statement: statement,
-		zlog:      zlog,
-		mu:        new(sync.Mutex),
+		db:                     db,
+		currency:               currency,
+		statement:              statement,
+		zlog:                   zlog,
+		mu:                     new(sync.Mutex),
+		maxStatementRows:       DefaultMaxStatementRows,
+		maxRecalculationMonths: DefaultMaxRecalculationMonths,
+		minPeriods:             make(map[types.ProductType]int64),
+		incomeDirection:        DefaultIncomeDirection,
+		attentionCriteria:      DefaultAttentionCriteria,
+		wordlistCounter:        newWordlistCounter(),
+		wordlistUsageWindow:    DefaultWordlistUsageWindow,
 	}, nil
 }
 
+// SetMaxStatementRows sets the maximum number of rows parsed from a statement file.
+// A value less than or equal to zero resets the limit to DefaultMaxStatementRows.
+func (s *Service) SetMaxStatementRows(n int) {
+	if n <= 0 {
+		n = DefaultMaxStatementRows
+	}
+	s.maxStatementRows = n
+}
+
+// SetMaxRecalculationMonths sets the maximum number of months accepted in a recalculation.
+// A value less than or equal to zero resets the limit to DefaultMaxRecalculationMonths.
+func (s *Service) SetMaxRecalculationMonths(n int) {
+	if n <= 0 {
+		n = DefaultMaxRecalculationMonths
+	}
+	s.maxRecalculationMonths = n
+}
+
+// SetDefaultProduct sets the product used by CalculateIncome when the request does not specify one.
+// ProductUnSpecified disables the default, so the product must be given.
+func (s *Service) SetDefaultProduct(p types.ProductType) {
+	s.defaultProduct = p
+}
+
+// SetOtherIncomeCapPercentage caps the other income counted for PL/SF products
+// at the given percentage of the basic salary, e.g. 50 counts other income up to half of basic.
+// A value less than or equal to zero disables the cap.
+func (s *Service) SetOtherIncomeCapPercentage(percentage decimal.Decimal) {
+	if percentage.LessThan(decimal.Zero) {
+		percentage = decimal.Zero
+	}
+	s.otherIncomeCapPercentage = percentage
+}
+
+// SetCompletedGracePeriod sets how long after completion the creator of a calculation
+// can still recalculate it. A value less than or equal to zero locks completed calculations immediately.
+func (s *Service) SetCompletedGracePeriod(d time.Duration) {
+	s.completedGracePeriod = d
+}
+
+// SetSalaryVariationThreshold sets the coefficient of variation of the monthly salaries
+// above which a calculation is flagged as having a volatile salary, e.g. 0.25.
+// A value less than or equal to zero disables the flag.
+func (s *Service) SetSalaryVariationThreshold(threshold decimal.Decimal) {
+	s.salaryVariationThreshold = threshold
+}
+
+// SetAccountNumberPattern sets the format the account number of a statement file must match,
+// e.g. `^\d{13}$`. The formats differ by bank, so nil accepts any account number.
+func (s *Service) SetAccountNumberPattern(pattern *regexp.Regexp) {
+	s.accountNumberPattern = pattern
+}
+
+// SetIncomeDirection sets how the income amounts are read from the statement files
+// of the calculations not specifying it. Empty resets it to DefaultIncomeDirection.
+func (s *Service) SetIncomeDirection(d IncomeDirection) {
+	s.incomeDirection = d.orDefault()
+}
+
+// IncomeDirection returns how the income amounts are read from the statement files
+// of the calculations not specifying it.
+func (s *Service) IncomeDirection() IncomeDirection {
+	return s.incomeDirection
+}
+
+// SetSettings sets the settings service the calculations read their adjustable settings from.
+// Nil uses the settings configured on this service.
+func (s *Service) SetSettings(svc *settings.Service) {
+	s.settings = svc
+}
+
+// calculationSettings returns the settings applied to new calculations and recalculations.
+func (s *Service) calculationSettings(ctx context.Context) (settings.Settings, error) {
+	if s.settings == nil {
+		return settings.Settings{
+			OtherIncomeFactor:        otherIncomeFactor,
+			OtherIncomeCapPercentage: s.otherIncomeCapPercentage,
+			SalaryVariationThreshold: s.salaryVariationThreshold,
+		}, nil
+	}
+
+	return s.settings.Current(ctx)
+}
+
+// flagSalaryVariation flags the calculation when its salary variation exceeds the threshold.
+// A threshold less than or equal to zero flags none.
+func flagSalaryVariation(c *Calculation, threshold decimal.Decimal) {
+	c.SalaryVolatile = threshold.GreaterThan(decimal.Zero) &&
+		c.SalaryVariation.GreaterThan(threshold)
+}
+
 func (s *Service) ListWordlists(ctx context.Context, in *WordlistQuery) (*ListWordlistsResult, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -70,6 +247,13 @@ func (s *Service) ListWordlists(ctx context.Context, in *WordlistQuery) (*ListWo
 		return nil, err
 	}
 
+	if in.WithUsage {
+		if err := s.setWordlistUsage(ctx, wordlists); err != nil {
+			zlog.Error("failed to set wordlist usage", zap.Error(err))
+			return nil, err
+		}
+	}
+
 	var pageToken string
 	if l := len(wordlists); l > 0 && l == int(pager.Size(in.PageSize)) {
 		last := wordlists[l-1]
@@ -163,6 +347,75 @@ func (s *Service) UpdateWordlist(ctx context.Context, in *WordlistReq) (*Wordlis
 	return wordlist, nil
 }
 
+// ReclassifyWordlists moves the given wordlists to another category in one transaction,
+// so the following calculations match their words to the new category.
+func (s *Service) ReclassifyWordlists(ctx context.Context, in *ReclassifyWordlistsReq) (*ListWordlistsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ReclassifyWordlists"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	wordlists, err := listWordlists(ctx, s.db, &WordlistQuery{
+		ids:     in.IDs,
+		noLimit: true,
+	})
+	if err != nil {
+		zlog.Error("failed to list wordlists", zap.Error(err))
+		return nil, err
+	}
+
+	found := make(map[int64]*Wordlist, len(wordlists))
+	for _, w := range wordlists {
+		found[w.ID] = w
+	}
+
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+	for i, id := range in.IDs {
+		if _, ok := found[id]; !ok {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("ids[%d]", i),
+				Description: "Wordlist with this ID does not exist",
+			})
+		}
+	}
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Wordlists are not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return nil, s.Err()
+	}
+
+	now := time.Now()
+	if err := reclassifyWordlists(ctx, s.db, in.IDs, in.Category, claims.Username, now); err != nil {
+		zlog.Error("failed to reclassify wordlists", zap.Error(err))
+		return nil, err
+	}
+
+	updated := make([]*Wordlist, 0, len(in.IDs))
+	for _, id := range in.IDs {
+		w := found[id]
+		w.Category = in.Category
+		w.UpdatedBy = claims.Username
+		w.UpdatedAt = now
+		updated = append(updated, w)
+	}
+
+	return &ListWordlistsResult{
+		Wordlists: updated,
+	}, nil
+}
+
 func (s *Service) CalculateIncome(ctx context.Context, in *CalculateReq) (*Calculation, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -171,6 +424,10 @@ func (s *Service) CalculateIncome(ctx context.Context, in *CalculateReq) (*Calcu
 		zap.String("Username", claims.Username),
 	)
 
+	if in.Product == types.ProductUnSpecified {
+		in.Product = s.defaultProduct
+	}
+
 	if err := in.Validate(); err != nil {
 		return nil, err
 	}
@@ -205,6 +462,9 @@ func (s *Service) CalculateIncome(ctx context.Context, in *CalculateReq) (*Calcu
 	if err != nil {
 		return nil, err
 	}
+	if err := s.statement.CheckHeader(statementFile); err != nil {
+		return nil, err
+	}
 
 	wordlists, err := listWordlists(ctx, s.db, &WordlistQuery{
 		noLimit: true,
@@ -215,6 +475,46 @@ func (s *Service) CalculateIncome(ctx context.Context, in *CalculateReq) (*Calcu
 	}
 
 	calculation, err := s.calculateIncomeFromStatementFile(ctx, in, wordlists, statementFile)
+	if errors.Is(err, ErrStatementTooLarge) {
+		zlog.Warn("statement file exceeds the maximum number of rows", zap.Error(err))
+		return nil, rpcStatus.Errorf(
+			codes.InvalidArgument,
+			"The statement file is too large. It must not contain more than %d rows.",
+			s.maxStatementRows,
+		)
+	}
+	if errors.Is(err, ErrAccountNumberFormat) {
+		zlog.Warn("statement account number does not match the expected format", zap.Error(err))
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"The statement file is not valid. Please check your statement file and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "statementFileName",
+					Description: fmt.Sprintf("Account number of the statement must match the format %s", s.accountNumberPattern),
+				},
+			},
+		})
+
+		return nil, s.Err()
+	}
+	if errors.Is(err, ErrAccountCurrency) {
+		zlog.Warn("statement account currency is not valid", zap.Error(err))
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"The statement file is not valid. Please check your statement file and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "statementFileName",
+					Description: fmt.Sprintf("Account currency in cell %s of the statement must be a 3-letter currency code", s.statement.Layout().AccountCurrency),
+				},
+			},
+		})
+
+		return nil, s.Err()
+	}
 	if err != nil {
 		zlog.Warn("failed to calculate income from statement file", zap.Error(err))
 		return nil, rpcStatus.
@@ -224,9 +524,14 @@ func (s *Service) CalculateIncome(ctx context.Context, in *CalculateReq) (*Calcu
 			)
 	}
 
+	if err := s.checkMinPeriod(calculation); err != nil {
+		zlog.Warn("statement period is shorter than the minimum period of the product", zap.Error(err))
+		return nil, err
+	}
+
 	if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
 		zlog.Error("failed to save calculation income", zap.Error(err))
-		return nil, fmt.Errorf("failed to save calculation income: %w", err)
+		return nil, err
 	}
 
 	return calculation, nil
@@ -242,10 +547,11 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
@@ -255,6 +561,32 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	return calculation, nil
 }
 
+// GetCalculationByID returns the calculation of the given internal ID,
+// e.g. as referenced by the audit log.
+func (s *Service) GetCalculationByID(ctx context.Context, id int64) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetCalculationByID"),
+		zap.String("Username", claims.Username),
+		zap.Int64("ID", id),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		ID:        id,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by id", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
 func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*ListCalculationsResult, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -263,6 +595,12 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 		zap.String("Username", claims.Username),
 	)
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
+	in.createdBy = claims.VisibleCreator()
 	calculations, err := listCalculations(ctx, s.db, in)
 	if err != nil {
 		zlog.Error("failed to list calculations", zap.Error(err))
@@ -273,8 +611,9 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 	if l := len(calculations); l > 0 && l == int(pager.Size(in.PageSize)) {
 		last := calculations[l-1]
 		pageToken = pager.EncodeCursor(&pager.Cursor{
-			ID:   strconv.FormatInt(last.ID, 10),
-			Time: last.CreatedAt,
+			ID:    strconv.FormatInt(last.ID, 10),
+			Time:  last.CreatedAt,
+			Value: last.orderValue(order),
 		})
 	}
 
@@ -290,6 +629,229 @@ type RecalculateReq struct {
 	MonthlySalaries          []MonthlySalary `json:"monthlySalaries"`
 	Allowances               []Allowance     `json:"allowances"`
 	Commissions              []Commission    `json:"commissions"`
+
+	// maxMonths is the maximum number of monthly salaries and of commissions,
+	// DefaultMaxRecalculationMonths when zero.
+	maxMonths int
+}
+
+func (r *RecalculateReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if r.Number == "" {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "number",
+			Description: "Number must not be empty",
+		})
+	}
+
+	if r.BasicSalaryFromInterview.IsNegative() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "basicSalaryFromInterview",
+			Description: "Basic salary from interview must not be negative",
+		})
+	}
+
+	maxMonths := r.maxMonths
+	if maxMonths <= 0 {
+		maxMonths = DefaultMaxRecalculationMonths
+	}
+
+	if len(r.MonthlySalaries) > maxMonths {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "monthlySalaries",
+			Description: fmt.Sprintf("Monthly salaries must not contain more than %d months", maxMonths),
+		})
+	}
+
+	if len(r.Commissions) > maxMonths {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "commissions",
+			Description: fmt.Sprintf("Commissions must not contain more than %d months", maxMonths),
+		})
+	}
+
+	for i, m := range r.MonthlySalaries {
+		violations = append(violations, validateMonthlyTransactions(fmt.Sprintf("monthlySalaries[%d]", i), m.Month, m.Transactions)...)
+	}
+
+	for i, c := range r.Commissions {
+		violations = append(violations, validateMonthlyTransactions(fmt.Sprintf("commissions[%d]", i), c.Month, c.Transactions)...)
+	}
+
+	for i, a := range r.Allowances {
+		field := fmt.Sprintf("allowances[%d]", i)
+		if strings.TrimSpace(a.Title) == "" {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       field + ".title",
+				Description: "Title must not be empty",
+			})
+		}
+		if a.Months.IsNegative() {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       field + ".months",
+				Description: "Months must not be negative",
+			})
+		}
+		for j, t := range a.Transactions {
+			violations = append(violations, validateTransaction(fmt.Sprintf("%s.transactions[%d]", field, j), t)...)
+		}
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Calculation is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// validatePeriod checks that every month of the request is within the period of the statement.
+func (r *RecalculateReq) validatePeriod(from, to time.Time) error {
+	if from.IsZero() || to.IsZero() {
+		return nil
+	}
+
+	first := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+	last := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	outOfPeriod := func(month string) bool {
+		m, err := time.Parse("January-2006", month)
+		if err != nil {
+			return false // already reported by Validate
+		}
+		return m.Before(first) || m.After(last)
+	}
+
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+	for i, m := range r.MonthlySalaries {
+		if outOfPeriod(m.Month) {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("monthlySalaries[%d].month", i),
+				Description: "Month must be within the period of the statement",
+			})
+		}
+	}
+
+	for i, c := range r.Commissions {
+		if outOfPeriod(c.Month) {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("commissions[%d].month", i),
+				Description: "Month must be within the period of the statement",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Calculation is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+func validateMonthlyTransactions(field, month string, ts []Transaction) []*edPb.BadRequest_FieldViolation {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if _, err := time.Parse("January-2006", month); err != nil {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       field + ".month",
+			Description: "Month must be in the format January-2006",
+		})
+		return violations
+	}
+
+	for i, t := range ts {
+		txField := fmt.Sprintf("%s.transactions[%d]", field, i)
+		violations = append(violations, validateTransaction(txField, t)...)
+		if !t.Date.Time().IsZero() && t.Date.Time().Format("January-2006") != month {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       txField + ".date",
+				Description: "Date must be in the same month as " + month,
+			})
+		}
+	}
+
+	return violations
+}
+
+func validateTransaction(field string, t Transaction) []*edPb.BadRequest_FieldViolation {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if !t.Amount.IsPositive() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       field + ".amount",
+			Description: "Amount must be greater than zero",
+		})
+	}
+
+	if t.Date.Time().IsZero() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       field + ".date",
+			Description: "Date must not be empty",
+		})
+	}
+
+	return violations
+}
+
+// ReCalculatePreview validates the recalculation and returns the recalculated figures
+// of the calculation without saving them.
+func (s *Service) ReCalculatePreview(ctx context.Context, in *RecalculateReq) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ReCalculatePreview"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	in.maxMonths = s.maxRecalculationMonths
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    in.Number,
+		createdBy: claims.ChangeableCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	if err := in.validatePeriod(calculation.StartedAt, calculation.EndedAt); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	if err := calculation.ReCalculate(claims.Username, in, cfg.OtherIncomeFactor); err != nil {
+		zlog.Error("failed to recalculate income", zap.Error(err))
+		return nil, err
+	}
+	flagSalaryVariation(calculation, cfg.SalaryVariationThreshold)
+	s.flagNetIncomeRange(calculation)
+
+	return calculation, nil
 }
 
 func (s *Service) ReCalculateIncome(ctx context.Context, in *RecalculateReq) (*Calculation, error) {
@@ -301,8 +863,14 @@ func (s *Service) ReCalculateIncome(ctx context.Context, in *RecalculateReq) (*C
 		zap.Any("req", in),
 	)
 
+	in.maxMonths = s.maxRecalculationMonths
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: in.Number,
+		Number:    in.Number,
+		createdBy: claims.ChangeableCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
@@ -311,14 +879,26 @@ func (s *Service) ReCalculateIncome(ctx context.Context, in *RecalculateReq) (*C
 		zlog.Error("failed to get calculation by number", zap.Error(err))
 		return nil, err
 	}
-	if calculation.IsCompleted() {
+	if !calculation.canRecalculate(claims.Username, s.completedGracePeriod, time.Now()) {
 		return nil, rpcStatus.Error(codes.FailedPrecondition, "This calculation is already completed and cannot be recalculated")
 	}
 
-	if err := calculation.ReCalculate(claims.Username, in); err != nil {
+	if err := in.validatePeriod(calculation.StartedAt, calculation.EndedAt); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.calculationSettings(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	if err := calculation.ReCalculate(claims.Username, in, cfg.OtherIncomeFactor); err != nil {
 		zlog.Error("failed to recalculate income", zap.Error(err))
 		return nil, err
 	}
+	flagSalaryVariation(calculation, cfg.SalaryVariationThreshold)
+	s.flagNetIncomeRange(calculation)
 
 	if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
 		zlog.Error("failed to save calculation", zap.Error(err))
@@ -338,7 +918,8 @@ func (s *Service) CompleteCalculation(ctx context.Context, number string) (*Calc
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.ChangeableCreator(auth.RoleApprover),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
 		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
@@ -375,10 +956,11 @@ func (s *Service) ListIncomeTransactionsByNumber(ctx context.Context, in *Transa
 	}
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: in.Number,
+		Number:    in.Number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
@@ -399,13 +981,17 @@ func (s *Service) ListIncomeTransactionsByNumber(ctx context.Context, in *Transa
 		return nil, err
 	}
 
-	txs, err := s.listTransactionFromStatementFile(ctx, in, wordlists, statementFile)
+	txs, err := s.listTransactionFromStatementFile(ctx, in, calculation.IncomeDirection, wordlists, statementFile)
 	if err != nil {
 		zlog.Error("failed to list transactions", zap.Error(err))
 		return nil, err
 	}
 
-	return &ListTransactionsResult{Transactions: txs}, nil
+	page, pageToken := paginateTransactions(txs, in.PageSize, in.PageToken)
+	return &ListTransactionsResult{
+		Transactions:  page,
+		NextPageToken: pageToken,
+	}, nil
 }
 
 func (s *Service) GetIncomeTransactionByBillNumber(ctx context.Context, in *GetTransactionReq) (*Transaction, error) {
@@ -422,10 +1008,11 @@ func (s *Service) GetIncomeTransactionByBillNumber(ctx context.Context, in *GetT
 	}
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: in.Number,
+		Number:    in.Number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
@@ -457,12 +1044,8 @@ func (s *Service) GetIncomeTransactionByBillNumber(ctx context.Context, in *GetT
 			return nil, fmt.Errorf("failed to get row columns: %w", err)
 		}
 
-		if len(row) > 4 {
-			incomeAmount, err := decimal.NewFromString(strings.ReplaceAll(row[4], ",", ""))
-			if err != nil {
-				continue
-			}
-			if incomeAmount.GreaterThan(decimal.Zero) && len(row[2]) > 0 {
+		if incomeAmount, ok := calculation.IncomeDirection.incomeAmount(row, s.statement.NumberFormat()); ok {
+			if len(row[2]) > 0 {
 				if strings.TrimSpace(strings.ToLower(row[1])) == strings.TrimSpace(strings.ToLower(in.BillNumber)) {
 					date, err := time.ParseInLocation("02/01/2006", row[0], time.Local)
 					if err != nil {
@@ -480,10 +1063,13 @@ func (s *Service) GetIncomeTransactionByBillNumber(ctx context.Context, in *GetT
 		}
 	}
 
-	return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 }
 
-func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
+// ExportCalculationsToExcel returns the workbook of the calculations matching the query.
+// The caller must close the returned file once it has been written.
+// An export reading Limit calculations returns the next ID to resume it from, zero once it is complete.
+func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*excelize.File, int64, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	zlog := s.zlog.With(
 		zap.String("Method", "ExportCalculationsToExcel"),
@@ -491,35 +1077,48 @@ func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		zap.Any("req", in),
 	)
 
-	byt, err := s.exportCalculationsToExcel(ctx, in)
+	in.createdBy = claims.VisibleCreator()
+	f, nextID, err := s.exportCalculationsToExcel(ctx, in)
 	if err != nil {
 		zlog.Error("failed to export calculations to excel", zap.Error(err))
-		return nil, err
+		return nil, 0, err
 	}
 
-	return byt, nil
+	return f, nextID, nil
 }
 
-func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number string) (*bytes.Buffer, error) {
+// ExportCalculationToExcelByNumber renders the calculation with the export template of the request.
+// An empty template selects DefaultExportTemplate.
+func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number string, in *ExportCalculationReq) (*bytes.Buffer, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	zlog := s.zlog.With(
 		zap.String("Method", "ExportCalculationToExcelByNumber"),
 		zap.String("Username", claims.Username),
 		zap.String("Number", number),
+		zap.Any("req", in),
 	)
 
+	export, err := lookupExportTemplate(in.Template)
+	if err != nil {
+		return nil, err
+	}
+
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
 		return nil, err
 	}
 
-	buf, err := exportCalculationToExcel(ctx, calculation)
+	buf, err := export(ctx, calculation, exportOptions{
+		baseCurrency:    s.currency.BaseCurrency(),
+		withBillNumbers: in.WithBillNumbers,
+	})
 	if err != nil {
 		zlog.Error("failed to export calculation to excel", zap.Error(err))
 		return nil, err
@@ -528,7 +1127,115 @@ func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number s
 	return buf, nil
 }
 
-func (s *Service) listTransactionFromStatementFile(_ context.Context, txReq *TransactionReq, wordlists []*Wordlist, statement *statement.StatementFile) ([]*Transaction, error) {
+func (s *Service) ExportTransactionsToExcelByNumber(ctx context.Context, number string) (*bytes.Buffer, error) {
+	claims := auth.ClaimsFromContext(ctx)
+	zlog := s.zlog.With(
+		zap.String("Method", "ExportTransactionsToExcelByNumber"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcStatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	statementFile, err := s.statement.GetStatementByName(ctx, calculation.StatementFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	wordlists, err := listWordlists(ctx, s.db, &WordlistQuery{
+		noLimit: true,
+	})
+	if err != nil {
+		zlog.Error("failed to get wordlists", zap.Error(err))
+		return nil, err
+	}
+
+	matched, err := s.listMatchedTransactionsFromStatementFile(calculation.IncomeDirection, wordlists, statementFile)
+	if err != nil {
+		zlog.Error("failed to list matched transactions", zap.Error(err))
+		return nil, err
+	}
+
+	buf, err := exportTransactionsToExcel(calculation, matched)
+	if err != nil {
+		zlog.Error("failed to export transactions to excel", zap.Error(err))
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// listMatchedTransactionsFromStatementFile returns every transaction of the statement file
+// that matches a wordlist, grouped by the category of the matched wordlist.
+func (s *Service) listMatchedTransactionsFromStatementFile(direction IncomeDirection, wordlists []*Wordlist, statement *statement.StatementFile) (map[source][]Transaction, error) {
+	f, err := excelize.OpenFile(statement.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", statement.Name, err)
+	}
+	defer f.Close()
+
+	const sheetName = "Table 1"
+
+	rows, err := f.Rows(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows: %w", err)
+	}
+	defer rows.Close()
+
+	matched := make(map[source][]Transaction)
+	rowCount := 0
+	for rows.Next() {
+		rowCount++
+		if rowCount > s.maxStatementRows {
+			return nil, fmt.Errorf("%w: %s", ErrStatementTooLarge, statement.Name)
+		}
+
+		row, err := rows.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get row columns: %w", err)
+		}
+
+		amount, ok := direction.incomeAmount(row, s.statement.NumberFormat())
+		if !ok {
+			continue // skip rows with insufficient columns, invalid or zero amounts
+		}
+
+		if len(row[2]) == 0 {
+			continue // skip if the note field is empty
+		}
+
+		category, _, ok := matchWordlists(row[2], wordlists)
+		if !ok {
+			continue
+		}
+
+		date, err := time.ParseInLocation("02/01/2006", row[0], time.Local)
+		if err != nil {
+			continue // skip if date is invalid
+		}
+
+		matched[category] = append(matched[category], Transaction{
+			Amount:     amount,
+			Date:       types.DDMMYYYY(date),
+			BillNumber: row[1],
+			Noted:      row[2],
+		})
+	}
+
+	return matched, nil
+}
+
+func (s *Service) listTransactionFromStatementFile(_ context.Context, txReq *TransactionReq, direction IncomeDirection, wordlists []*Wordlist, statement *statement.StatementFile) ([]*Transaction, error) {
 	f, err := excelize.OpenFile(statement.Location)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s: %w", statement.Name, err)
@@ -550,12 +1257,8 @@ func (s *Service) listTransactionFromStatementFile(_ context.Context, txReq *Tra
 			return nil, fmt.Errorf("failed to get row columns: %w", err)
 		}
 
-		if len(row) > 4 {
-			incomeAmount, err := decimal.NewFromString(strings.ReplaceAll(row[4], ",", ""))
-			if err != nil {
-				continue
-			}
-			if incomeAmount.GreaterThan(decimal.Zero) && len(row[2]) > 0 {
+		if incomeAmount, ok := direction.incomeAmount(row, s.statement.NumberFormat()); ok {
+			if len(row[2]) > 0 {
 				if _, _, exist := matchWordlists(row[2], wordlists); exist {
 					date, err := time.ParseInLocation("02/01/2006", row[0], time.Local)
 					if err != nil {
@@ -578,19 +1281,43 @@ func (s *Service) listTransactionFromStatementFile(_ context.Context, txReq *Tra
 	return txs, nil
 }
 
-func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *CalculateReq, wordlists []*Wordlist, statement *statement.StatementFile) (*Calculation, error) {
+func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *CalculateReq, wordlists []*Wordlist, file *statement.StatementFile) (*Calculation, error) {
 	claims := auth.ClaimsFromContext(ctx)
-	calculation := newCalculation(claims.Username, cal.Number, statement.Name, cal.Product)
-
-	f, err := excelize.OpenFile(statement.Location)
+	cfg, err := s.calculationSettings(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", statement.Name, err)
+		return nil, fmt.Errorf("failed to get settings: %w", err)
+	}
+
+	calculation := newCalculation(claims.Username, cal.Number, file.Name, cal.Product)
+	calculation.OtherIncomeCapPercentage = cfg.OtherIncomeCapPercentage
+	calculation.IncomeDirection = s.incomeDirection
+	if cal.IncomeDirection != "" {
+		calculation.IncomeDirection, _ = ParseIncomeDirection(cal.IncomeDirection.String())
+	}
+	calculation.config = &CalculationConfig{
+		OtherIncomeFactor:        cfg.OtherIncomeFactor,
+		OtherIncomeCapPercentage: cfg.OtherIncomeCapPercentage,
+		SalaryVariationThreshold: cfg.SalaryVariationThreshold,
+		BaseCurrency:             s.currency.BaseCurrency(),
+		MinPeriodInMonths:        s.minPeriods[cal.Product],
+		IncomeDirection:          calculation.IncomeDirection,
+		NumberFormat:             s.statement.NumberFormat(),
+		MergeSameDayCredits:      s.mergeSameDayCredits,
+		ExcludePartialFinalMonth: s.excludePartialFinalMonth,
+		ExcludedNotePrefixes:     cfg.ExcludedNotePrefixes,
+		RecordedAt:               calculation.CreatedAt,
+	}
+
+	f, err := excelize.OpenFile(file.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", file.Name, err)
 	}
 	defer f.Close()
 
 	const sheetName = "Table 1"
+	layout := s.statement.Layout()
 
-	rawPeriod, err := f.GetCellValue(sheetName, "A7")
+	rawPeriod, err := f.GetCellValue(sheetName, layout.Period)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get period: %w", err)
 	}
@@ -599,17 +1326,17 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 	calculation.StartedAt = from
 	calculation.EndedAt = to
 
-	rawAccountNumber, err := f.GetCellValue(sheetName, "A9")
+	rawAccountNumber, err := f.GetCellValue(sheetName, layout.AccountNumber)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account number: %w", err)
 	}
 
-	rawAccountDisplayName, err := f.GetCellValue(sheetName, "A10")
+	rawAccountDisplayName, err := f.GetCellValue(sheetName, layout.AccountDisplayName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account display name: %w", err)
 	}
 
-	rawAccountCurrency, err := f.GetCellValue(sheetName, "A11")
+	rawAccountCurrency, err := f.GetCellValue(sheetName, layout.AccountCurrency)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get account currency: %w", err)
 	}
@@ -617,9 +1344,16 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 	calculation.Account.Number = extractAccount(rawAccountNumber)
 	calculation.Account.DisplayName = extractAccount(rawAccountDisplayName)
 	calculation.Account.Currency = extractAccount(rawAccountCurrency)
+	if len(strings.TrimSpace(calculation.Account.Currency)) != 3 {
+		return nil, fmt.Errorf("%w: %q in cell %s of %s", ErrAccountCurrency, rawAccountCurrency, layout.AccountCurrency, file.Name)
+	}
+
+	if len(calculation.Account.Number) == 0 || len(calculation.Account.DisplayName) == 0 {
+		return nil, fmt.Errorf("no valid income transactions found in the statement file %s", file.Name)
+	}
 
-	if len(calculation.Account.Number) == 0 || len(calculation.Account.DisplayName) == 0 || len(strings.TrimSpace(calculation.Account.Currency)) != 3 {
-		return nil, fmt.Errorf("no valid income transactions found in the statement file %s", statement.Name)
+	if s.accountNumberPattern != nil && !s.accountNumberPattern.MatchString(calculation.Account.Number) {
+		return nil, fmt.Errorf("%w: %q in %s", ErrAccountNumberFormat, calculation.Account.Number, file.Name)
 	}
 
 	currency, err := s.currency.GetCurrencyByCode(ctx, calculation.Account.Currency)
@@ -638,20 +1372,24 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 	keySy := SourceSalary.String()
 	keyCom := SourceCommission.String()
 	defaultMonths := decimal.NewFromInt(12)
+	matches := make(map[int64]int64) // transactions matched by wordlist ID
+	partialMonthStart, partial := statement.PartialFinalMonthStart(to)
+	excludePartialMonth := s.excludePartialFinalMonth && partial
+	rowCount := 0
 	for rows.Next() {
+		rowCount++
+		if rowCount > s.maxStatementRows {
+			return nil, fmt.Errorf("%w: %s", ErrStatementTooLarge, file.Name)
+		}
+
 		row, err := rows.Columns()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get row columns: %w", err)
 		}
 
-		if len(row) <= 4 {
-			continue // skip rows with insufficient columns
-		}
-
-		// Parse amount
-		rawAmount := strings.ReplaceAll(row[4], ",", "")
-		incomeAmount, err := decimal.NewFromString(rawAmount)
-		if err != nil || !incomeAmount.GreaterThan(decimal.Zero) {
+		// Parse amount, the rows with insufficient columns have none
+		incomeAmount, ok := calculation.IncomeDirection.incomeAmount(row, s.statement.NumberFormat())
+		if !ok {
 			continue // skip invalid or zero amounts
 		}
 
@@ -664,13 +1402,10 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 		if err != nil {
 			continue // skip if date is invalid
 		}
-		month := getMonthWithYYYYMM(row[0])
-
-		// Match note field with wordlist
-		category, title, matched := matchWordlists(row[2], wordlists)
-		if !matched {
-			continue
+		if excludePartialMonth && !date.Before(partialMonthStart) {
+			continue // skip the transactions of the partial final month
 		}
+		month := getMonthWithYYYYMM(row[0])
 
 		transaction := Transaction{
 			Amount:     incomeAmount,
@@ -679,6 +1414,20 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 			Noted:      row[2],
 		}
 
+		// Drop the excluded notes whatever wordlist they match
+		if prefix, excluded := matchExcludedNote(row[2], cfg.ExcludedNotePrefixes); excluded {
+			calculation.ExcludedTransactions = append(calculation.ExcludedTransactions, newExcludedTransaction(transaction, prefix))
+			continue
+		}
+
+		// Match note field with wordlist
+		wordlist, matched := matchWordlist(row[2], wordlists)
+		if !matched {
+			continue
+		}
+		category, title := wordlist.Category, wordlist.Word
+		matches[wordlist.ID]++
+
 		switch category {
 		case SourceSalary:
 			if _, ok := incomes[keySy]; !ok {
@@ -714,8 +1463,20 @@ func (s *Service) calculateIncomeFromStatementFile(ctx context.Context, cal *Cal
 		}
 	}
 
+	if s.mergeSameDayCredits {
+		incomes.mergeSameDayCredits()
+	}
+
 	period := countMonth(from, to)
-	calculation.populate(cal.Product, period, currency.ExchangeRate, incomes)
+	rate, rateSource, err := s.exchangeRate(ctx, cal, currency, to)
+	if err != nil {
+		return nil, err
+	}
+	calculation.populate(cal.Product, period, rate, cfg.OtherIncomeFactor, calculation.OtherIncomeCapPercentage, incomes)
+	calculation.ExchangeRateSource = rateSource
+	flagSalaryVariation(calculation, cfg.SalaryVariationThreshold)
+	s.flagNetIncomeRange(calculation)
+	s.wordlistCounter.add(matches)
 	return calculation, nil
 }
 
@@ -843,15 +1604,15 @@ func (s statMap) averageAllowance() decimal.Decimal {
 	return s.toListAllowances().Total
 }
 
-func (s statMap) averageOtherIncomeIn80Percent(period decimal.Decimal) decimal.Decimal {
-	// Assuming 80% of the total other income is considered
+// averageOtherIncomeIn80Percent returns the part of the monthly other income counted at the given factor, 80% by default.
+func (s statMap) averageOtherIncomeIn80Percent(period, otherIncomeFactor decimal.Decimal) decimal.Decimal {
 	other := s.averageOtherIncome(period)
 	other = other.Add(s.averageCommission(period))
 	other = other.Add(s.averageAllowance())
-	return other.Mul(decimal.NewFromFloat(0.8))
+	return other.Mul(otherIncomeFactor)
 }
 
-func (s statMap) averageMonthlyIncome(product types.ProductType, period decimal.Decimal) decimal.Decimal {
+func (s statMap) averageMonthlyIncome(product types.ProductType, period, otherIncomeFactor, otherIncomeCapPercentage decimal.Decimal) decimal.Decimal {
 	switch product {
 	case types.ProductSA:
 		basic := s.basicSalary(types.ProductSA, period)
@@ -867,25 +1628,42 @@ func (s statMap) averageMonthlyIncome(product types.ProductType, period decimal.
 			Add(s.averageCommission(period))
 
 	case types.ProductPL, types.ProductSF:
-		otherIn80Percent := s.averageOtherIncomeIn80Percent(period)
+		otherIn80Percent := s.averageOtherIncomeIn80Percent(period, otherIncomeFactor)
 		basic := s.basicSalary(product, period)
 		interview := s.basicSalaryFromInterview()
 		if interview.GreaterThan(decimal.Zero) && interview.LessThan(basic) {
-			return interview.Add(otherIn80Percent)
+			basic = interview
 		}
 
-		return basic.Add(otherIn80Percent)
+		return basic.Add(capOtherIncome(otherIn80Percent, basic, otherIncomeCapPercentage))
 	}
 
 	return decimal.Zero
 }
 
-func (s statMap) netIncomeMonthly(product types.ProductType, exchangeRate decimal.Decimal, period decimal.Decimal) decimal.Decimal {
+// capOtherIncome limits the other income to the given percentage of the basic salary.
+// A percentage less than or equal to zero means no cap.
+func capOtherIncome(other, basic, percentage decimal.Decimal) decimal.Decimal {
+	if !percentage.GreaterThan(decimal.Zero) {
+		return other
+	}
+
+	limit := basic.Mul(percentage).Div(decimal.NewFromInt(100))
+	if other.GreaterThan(limit) {
+		return limit
+	}
+
+	return other
+}
+
+// netIncomeMonthly returns the average monthly income converted to the base currency,
+// the exchange rate being the rate of the account currency to the base currency.
+func (s statMap) netIncomeMonthly(product types.ProductType, exchangeRate, period, otherIncomeFactor, otherIncomeCapPercentage decimal.Decimal) decimal.Decimal {
 	if period.IsZero() {
 		return decimal.Zero
 	}
 
-	monthlyIncome := s.averageMonthlyIncome(product, period)
+	monthlyIncome := s.averageMonthlyIncome(product, period, otherIncomeFactor, otherIncomeCapPercentage)
 	if monthlyIncome.IsZero() {
 		return decimal.Zero
 	}
@@ -1016,10 +1794,41 @@ func (s statMap) toListMonthlySalaries() *SalaryBreakdown {
 	})
 
 	return &SalaryBreakdown{
-		MonthlySalaries: monthlySalaries,
-		BasicSalary:     findMinAmount(raw.Monthly),
-		Total:           raw.Total,
+		MonthlySalaries:      monthlySalaries,
+		BasicSalary:          findMinAmount(raw.Monthly),
+		Total:                raw.Total,
+		VariationCoefficient: variationCoefficient(monthlySalaries),
+	}
+}
+
+// variationCoefficient returns the coefficient of variation of the monthly salary totals,
+// i.e. the standard deviation divided by the mean, rounded to 4 decimal places.
+// It is zero when there are less than two months or the mean is zero.
+func variationCoefficient(months []MonthlySalary) decimal.Decimal {
+	if len(months) < 2 {
+		return decimal.Zero
+	}
+
+	n := decimal.NewFromInt(int64(len(months)))
+	total := decimal.Zero
+	for _, m := range months {
+		total = total.Add(m.Total)
+	}
+
+	mean := total.Div(n)
+	if mean.IsZero() {
+		return decimal.Zero
+	}
+
+	sumOfSquares := decimal.Zero
+	for _, m := range months {
+		diff := m.Total.Sub(mean)
+		sumOfSquares = sumOfSquares.Add(diff.Mul(diff))
 	}
+
+	variance := sumOfSquares.Div(n).InexactFloat64()
+	stdDev := decimal.NewFromFloat(math.Sqrt(variance))
+	return stdDev.Div(mean.Abs()).Round(4)
 }
 
 func findMinAmount(amounts []decimal.Decimal) decimal.Decimal {
@@ -1074,15 +1883,22 @@ func sumTransactions(ts []Transaction) decimal.Decimal {
 	return sum
 }
 
+// countMonth counts the months of a statement from its start to its end, both included,
+// e.g. 01/01 to 31/03 is 3 months. The final month is not counted when the statement
+// ends before its last day, e.g. 01/01 to 15/03 is 2 months, see statement.PartialFinalMonthStart.
 func countMonth(from, to time.Time) decimal.Decimal {
-	if to.Before(from) {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
 		return decimal.Zero
 	}
 
 	yearDiff := to.Year() - from.Year()
 	monthDiff := int(to.Month()) - int(from.Month())
+	months := yearDiff*12 + monthDiff + 1
+	if _, partial := statement.PartialFinalMonthStart(to); partial {
+		months--
+	}
 
-	return decimal.NewFromInt(int64(yearDiff*12 + monthDiff))
+	return decimal.NewFromInt(int64(months))
 }
 
 func extractAccount(raw string) string {
@@ -1129,6 +1945,14 @@ type CalculateReq struct {
 	Number            string            `json:"number"`
 	Product           types.ProductType `json:"product"`
 	StatementFileName string            `json:"statementFileName"`
+
+	// IncomeDirection is how the income amounts are read from the statement file.
+	// Empty uses the direction configured on the service.
+	IncomeDirection IncomeDirection `json:"incomeDirection"`
+
+	// ExchangeRateOverride is a fixed exchange rate to the base currency used instead of the rate of the currency.
+	// Zero uses the override configured for the product, if any.
+	ExchangeRateOverride decimal.Decimal `json:"exchangeRateOverride"`
 }
 
 func (r *CalculateReq) Validate() error {
@@ -1155,6 +1979,22 @@ func (r *CalculateReq) Validate() error {
 		})
 	}
 
+	if r.IncomeDirection != "" {
+		if _, err := ParseIncomeDirection(r.IncomeDirection.String()); err != nil {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       "incomeDirection",
+				Description: fmt.Sprintf("Income direction must be one of %s, %s or %s", IncomeDirectionCredits, IncomeDirectionDebits, IncomeDirectionSeparate),
+			})
+		}
+	}
+
+	if r.ExchangeRateOverride.IsNegative() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "exchangeRateOverride",
+			Description: "Exchange rate override must be positive",
+		})
+	}
+
 	if len(violations) > 0 {
 		s, _ := rpcStatus.New(
 			codes.InvalidArgument,
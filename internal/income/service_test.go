@@ -0,0 +1,837 @@
+package income
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// seedPendingCalculation seeds a pending calculation of a statement from 01/01/2025 to 31/03/2025.
+func seedPendingCalculation(mock *dbtest.Mock, number string) {
+	seedPendingProductCalculation(mock, number, types.ProductSA)
+}
+
+// seedPendingProductCalculation seeds the pending calculation of the number and product over January to March 2025.
+func seedPendingProductCalculation(mock *dbtest.Mock, number string, product types.ProductType) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+		1, "statement.pdf", number, product.String(), "LAK", "0100001", "Somchai",
+		"1", "BASE", "CREDITS", "0", "0",
+		false, false, "0", "0", "0",
+		"0", "0", "0", "0",
+		"0", "3", startedAt, endedAt, "PENDING", []byte(`{}`), []byte(`{}`),
+		[]byte(`{}`), []byte(`{}`), nil, "user@example.com", now, "user@example.com", now, nil,
+	})
+}
+
+func newRecalculateReq(month string, date time.Time, amount int64) *RecalculateReq {
+	return &RecalculateReq{
+		Number: "APP-1",
+		MonthlySalaries: []MonthlySalary{{
+			Month: month,
+			Transactions: []Transaction{
+				{Date: types.DDMMYYYY(date), Amount: decimal.NewFromInt(amount)},
+			},
+		}},
+	}
+}
+
+func TestRecalculateValidation(t *testing.T) {
+	january := time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2025, 5, 25, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		req      *RecalculateReq
+		seed     func(mock *dbtest.Mock)
+		wantCode codes.Code
+	}{
+		{
+			name: "valid",
+			req:  newRecalculateReq("January-2025", january, 5000000),
+			seed: func(mock *dbtest.Mock) {
+				seedPendingCalculation(mock, "APP-1")
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "negative amount",
+			req:      newRecalculateReq("January-2025", january, -5000000),
+			seed:     func(*dbtest.Mock) {},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "transaction outside its month",
+			req:      newRecalculateReq("January-2025", may, 5000000),
+			seed:     func(*dbtest.Mock) {},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "month outside the statement period",
+			req:  newRecalculateReq("May-2025", may, 5000000),
+			seed: func(mock *dbtest.Mock) {
+				seedPendingCalculation(mock, "APP-1")
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+
+	// The preview and the recalculation validate the request alike,
+	// only the recalculation saves a valid one.
+	for _, tt := range tests {
+		t.Run("preview "+tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			tt.seed(mock)
+
+			s := &Service{db: db, zlog: zap.NewNop()}
+			calculation, err := s.ReCalculatePreview(ctx, tt.req)
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ReCalculatePreview() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err == nil && !calculation.TotalIncome.Equal(decimal.NewFromInt(5000000)) {
+				t.Errorf("total income = %s, want 5000000", calculation.TotalIncome)
+			}
+		})
+
+		t.Run("recalculate "+tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			tt.seed(mock)
+			if tt.wantCode == codes.OK {
+				mock.ExpectExec(`UPDATE statement_file_analysis`)
+				mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+			}
+
+			s := &Service{db: db, zlog: zap.NewNop()}
+			if _, err := s.ReCalculateIncome(ctx, tt.req); rpcStatus.Code(err) != tt.wantCode {
+				t.Fatalf("ReCalculateIncome() code = %v, want %v (error %v)", rpcStatus.Code(err), tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeRowCap(t *testing.T) {
+	rows := make([][]any, 0, 12)
+	for day := 1; day <= 12; day++ {
+		rows = append(rows, credit(fmt.Sprintf("%02d/01/2025", day), "Salary", 100000))
+	}
+	// The 12 transactions are below the header cells and the header row, on the rows 14 to 25.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", rows...)
+
+	tests := []struct {
+		name     string
+		maxRows  int
+		wantCode codes.Code
+	}{
+		{name: "within the cap", maxRows: 25, wantCode: codes.OK},
+		{name: "exceeding the cap", maxRows: 24, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetMaxStatementRows(tt.maxRows)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			if tt.wantCode == codes.OK {
+				expectSave(mock)
+			}
+
+			_, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeDefaultProduct(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", credit("25/01/2025", "Salary January", 5000000))
+
+	tests := []struct {
+		name           string
+		defaultProduct types.ProductType
+		product        types.ProductType
+		want           types.ProductType
+		wantCode       codes.Code
+	}{
+		{name: "specified product", defaultProduct: types.ProductPL, product: types.ProductSA, want: types.ProductSA},
+		{name: "default product", defaultProduct: types.ProductPL, want: types.ProductPL},
+		{name: "no default product", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetDefaultProduct(tt.defaultProduct)
+			if tt.wantCode == codes.OK {
+				expectStatement(mock, file, salaryWordlist())
+				expectCurrency(mock, "LAK", "1")
+				expectSave(mock)
+			}
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(tt.product))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err == nil && calculation.Product != tt.want {
+				t.Errorf("product = %v, want %v", calculation.Product, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeOtherIncomeCap(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+		credit("28/03/2025", "Commission Q1", 30000000),
+	)
+	commission := &Wordlist{ID: 2, Word: "commission", Category: SourceCommission}
+
+	tests := []struct {
+		name        string
+		capPercent  int64
+		wantAverage int64
+	}{
+		// 5,000,000 of basic salary and 80% of the 10,000,000 monthly commission.
+		{name: "no cap", wantAverage: 13000000},
+		{name: "cap at half the basic salary", capPercent: 50, wantAverage: 7500000},
+		{name: "cap above the other income", capPercent: 200, wantAverage: 13000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetOtherIncomeCapPercentage(decimal.NewFromInt(tt.capPercent))
+			expectStatement(mock, file, salaryWordlist(), commission)
+			expectCurrency(mock, "LAK", "1")
+			expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductPL))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if !calculation.MonthlyAverageIncome.Equal(decimal.NewFromInt(tt.wantAverage)) {
+				t.Errorf("monthly average income = %s, want %d", calculation.MonthlyAverageIncome, tt.wantAverage)
+			}
+			if !calculation.OtherIncomeCapPercentage.Equal(decimal.NewFromInt(tt.capPercent)) {
+				t.Errorf("recorded cap = %s, want %d", calculation.OtherIncomeCapPercentage, tt.capPercent)
+			}
+		})
+	}
+}
+
+func TestReCalculateIncomeCompletedGracePeriod(t *testing.T) {
+	january := time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		grace     time.Duration
+		completed time.Duration
+		claims    *auth.Claims
+		wantCode  codes.Code
+	}{
+		{
+			name:      "creator within the grace period",
+			grace:     30 * time.Minute,
+			completed: 10 * time.Minute,
+			claims:    &auth.Claims{Username: "user@example.com", Role: auth.RoleUser},
+			wantCode:  codes.OK,
+		},
+		{
+			name:      "creator after the grace period",
+			grace:     30 * time.Minute,
+			completed: time.Hour,
+			claims:    &auth.Claims{Username: "user@example.com", Role: auth.RoleUser},
+			wantCode:  codes.FailedPrecondition,
+		},
+		{
+			name:      "admin within the grace period",
+			grace:     30 * time.Minute,
+			completed: 10 * time.Minute,
+			claims:    &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true},
+			wantCode:  codes.FailedPrecondition,
+		},
+		{
+			name:      "no grace period",
+			completed: time.Minute,
+			claims:    &auth.Claims{Username: "user@example.com", Role: auth.RoleUser},
+			wantCode:  codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			completedAt := time.Now().Add(-tt.completed)
+			mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`).WillReturnRows(calculationColumns, []any{
+				1, "statement.pdf", "APP-1", "SA", "LAK", "0100001", "Somchai",
+				"1", "BASE", "CREDITS", "0", "0",
+				false, false, "0", "0", "0",
+				"0", "0", "0", "0",
+				"0", "3", startedAt, endedAt, "COMPLETED", []byte(`{}`), []byte(`{}`),
+				[]byte(`{}`), []byte(`{}`), nil, "user@example.com", startedAt, "user@example.com", completedAt, completedAt,
+			})
+			if tt.wantCode == codes.OK {
+				mock.ExpectExec(`UPDATE statement_file_analysis`)
+				mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+			}
+
+			s := &Service{db: db, zlog: zap.NewNop()}
+			s.SetCompletedGracePeriod(tt.grace)
+			ctx := auth.ContextWithClaims(context.Background(), tt.claims)
+			_, err := s.ReCalculateIncome(ctx, newRecalculateReq("January-2025", january, 5000000))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ReCalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestCompleteRecordsCompletion(t *testing.T) {
+	c := newTestCalculation("APP-1")
+	before := time.Now()
+	c.Complete("approver@example.com")
+
+	if !c.IsCompleted() || c.CompletedAt == nil || c.CompletedAt.Before(before) {
+		t.Fatalf("Complete() = %v completed at %v, want completed now", c.Status, c.CompletedAt)
+	}
+	if !c.CompletedAt.Equal(c.UpdatedAt) || c.UpdatedBy != "approver@example.com" {
+		t.Errorf("updated = %v by %s, want the completion", c.UpdatedAt, c.UpdatedBy)
+	}
+}
+
+func TestCalculateIncomeSalaryVariation(t *testing.T) {
+	tests := []struct {
+		name          string
+		salaries      []int64
+		wantVariation string
+		wantVolatile  bool
+	}{
+		{name: "stable", salaries: []int64{5000000, 5000000, 5000000}, wantVariation: "0"},
+		{name: "slightly variable", salaries: []int64{4800000, 5000000, 5200000}, wantVariation: "0.0327"},
+		{name: "volatile", salaries: []int64{2000000, 8000000, 5000000}, wantVariation: "0.4899", wantVolatile: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+				credit("25/01/2025", "Salary January", tt.salaries[0]),
+				credit("25/02/2025", "Salary February", tt.salaries[1]),
+				credit("25/03/2025", "Salary March", tt.salaries[2]),
+			)
+			s, mock := newCalculateTestService(t)
+			s.SetSalaryVariationThreshold(decimal.NewFromFloat(0.3))
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductPL))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if calculation.SalaryVariation.String() != tt.wantVariation {
+				t.Errorf("salary variation = %s, want %s", calculation.SalaryVariation, tt.wantVariation)
+			}
+			if calculation.SalaryVolatile != tt.wantVolatile {
+				t.Errorf("salary volatile = %v, want %v", calculation.SalaryVolatile, tt.wantVolatile)
+			}
+		})
+	}
+}
+
+func TestFlagSalaryVariationWithoutThreshold(t *testing.T) {
+	c := newTestCalculation("APP-1")
+	c.SalaryVariation = decimal.NewFromInt(2)
+
+	flagSalaryVariation(c, decimal.Zero)
+	if c.SalaryVolatile {
+		t.Error("salary volatile without a threshold = true, want false")
+	}
+}
+
+func TestCalculateIncomeAccountNumberPattern(t *testing.T) {
+	// The account number of the statement fixtures is 0100001.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", credit("25/01/2025", "Salary January", 5000000))
+
+	tests := []struct {
+		name     string
+		pattern  *regexp.Regexp
+		wantCode codes.Code
+	}{
+		{name: "no pattern", wantCode: codes.OK},
+		{name: "valid account number", pattern: regexp.MustCompile(`^\d{7}$`), wantCode: codes.OK},
+		{name: "malformed account number", pattern: regexp.MustCompile(`^\d{3}-\d{4}$`), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetAccountNumberPattern(tt.pattern)
+			expectStatement(mock, file, salaryWordlist())
+			if tt.wantCode == codes.OK {
+				expectCurrency(mock, "LAK", "1")
+				expectSave(mock)
+			}
+
+			_, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil && !strings.Contains(fieldViolation(err), tt.pattern.String()) {
+				t.Errorf("field violation = %q, want the expected format %s", fieldViolation(err), tt.pattern)
+			}
+		})
+	}
+}
+
+// fieldViolation returns the description of the first field violation of the error.
+func fieldViolation(err error) string {
+	for _, d := range rpcStatus.Convert(err).Details() {
+		if br, ok := d.(*edPb.BadRequest); ok && len(br.FieldViolations) > 0 {
+			return br.FieldViolations[0].Description
+		}
+	}
+	return ""
+}
+
+func TestCalculateIncomeShiftedLayout(t *testing.T) {
+	shifted := statement.StatementLayout{Period: "B2", AccountNumber: "B3", AccountDisplayName: "B4", AccountCurrency: "B5"}
+	file := writeStatementWithLayout(t, shifted, "01/01/2025 ຫາ 31/01/2025", "USD", credit("25/01/2025", "Salary January", 5000))
+
+	tests := []struct {
+		name     string
+		layout   statement.StatementLayout
+		wantCode codes.Code
+	}{
+		{name: "shifted layout", layout: shifted, wantCode: codes.OK},
+		// The default cells of the file are empty, so the currency cannot be read.
+		{name: "default layout", layout: statement.DefaultStatementLayout, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			if err := s.statement.SetLayout(tt.layout); err != nil {
+				t.Fatal(err)
+			}
+			expectStatement(mock, file, salaryWordlist())
+			if tt.wantCode == codes.OK {
+				expectCurrency(mock, "USD", "21500")
+				expectSave(mock)
+			}
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("CalculateIncome() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				if !strings.Contains(fieldViolation(err), tt.layout.AccountCurrency) {
+					t.Errorf("field violation = %q, want the cell %s", fieldViolation(err), tt.layout.AccountCurrency)
+				}
+				return
+			}
+
+			if calculation.Account.Number != "0100001" || calculation.Account.DisplayName != "Somchai" || calculation.Account.Currency != "USD" {
+				t.Errorf("account = %+v, want 0100001 of Somchai in USD", calculation.Account)
+			}
+			wantStartedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+			if !calculation.StartedAt.Equal(wantStartedAt) {
+				t.Errorf("started at = %v, want %v", calculation.StartedAt, wantStartedAt)
+			}
+		})
+	}
+}
+
+func TestGetCalculationByNumberVisibility(t *testing.T) {
+	// The calculation APP-1 was created by user@example.com.
+	tests := []struct {
+		name          string
+		claims        *auth.Claims
+		wantCreatedBy string
+		wantCode      codes.Code
+	}{
+		{name: "owner", claims: &auth.Claims{Username: "user@example.com", Role: auth.RoleUser}, wantCreatedBy: "user@example.com"},
+		{name: "admin", claims: &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true}},
+		{name: "unrelated user", claims: &auth.Claims{Username: "other@example.com", Role: auth.RoleUser}, wantCreatedBy: "other@example.com", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			var get *dbtest.Expectation
+			if tt.wantCode == codes.OK {
+				get = seedHouseholdCalculation(mock, "APP-1", "LAK", "5000000")
+			} else {
+				get = mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`)
+			}
+
+			_, err := s.GetCalculationByNumber(auth.ContextWithClaims(context.Background(), tt.claims), "APP-1")
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByNumber() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if got := createdByArg(get.Args()); got != tt.wantCreatedBy {
+				t.Errorf("created by filter = %q, want %q", got, tt.wantCreatedBy)
+			}
+		})
+	}
+}
+
+// createdByArg returns the argument of the query that is a user, or an empty string if none is.
+func createdByArg(args []any) string {
+	for _, a := range args {
+		if s, ok := a.(string); ok && strings.Contains(s, "@") {
+			return s
+		}
+	}
+	return ""
+}
+
+func TestCalculateIncomeOtherIncomeFactorSetting(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+		credit("28/03/2025", "Commission Q1", 30000000),
+	)
+	commission := &Wordlist{ID: 2, Word: "commission", Category: SourceCommission}
+
+	s, mock := newCalculateTestService(t)
+	settingsSvc, err := settings.NewService(context.Background(), s.db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetSettings(settingsSvc)
+
+	calculate := func(wantAverage, wantEightyPercent int64) {
+		t.Helper()
+
+		calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductPL))
+		if err != nil {
+			t.Fatalf("CalculateIncome() error = %v", err)
+		}
+		if !calculation.MonthlyAverageIncome.Equal(decimal.NewFromInt(wantAverage)) {
+			t.Errorf("monthly average income = %s, want %d", calculation.MonthlyAverageIncome, wantAverage)
+		}
+		if !calculation.EightyPercentOfMonthlyOtherIncome.Equal(decimal.NewFromInt(wantEightyPercent)) {
+			t.Errorf("counted monthly other income = %s, want %d", calculation.EightyPercentOfMonthlyOtherIncome, wantEightyPercent)
+		}
+	}
+
+	// No setting is stored, the default factor of 0.8 counts 8,000,000 of the 10,000,000 monthly commission.
+	expectStatement(mock, file, salaryWordlist(), commission)
+	mock.ExpectQuery(`FROM settings`)
+	expectCurrency(mock, "LAK", "1")
+	expectSave(mock)
+	calculate(13000000, 8000000)
+
+	updatedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectExec(`UPDATE settings`)
+	mock.ExpectQuery(`FROM settings`).WillReturnRows([]string{"name", "value", "updated_by", "updated_at"},
+		[]any{"income.other_income_factor", "0.5", "admin@example.com", updatedAt},
+	)
+	factor := decimal.NewFromFloat(0.5)
+	admin := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+	if _, err := settingsSvc.UpdateSettings(admin, &settings.UpdateReq{OtherIncomeFactor: &factor}); err != nil {
+		t.Fatalf("UpdateSettings() error = %v", err)
+	}
+
+	// The next calculation counts half of the monthly commission, the currency is cached.
+	expectStatement(mock, file, salaryWordlist(), commission)
+	expectSave(mock)
+	calculate(10000000, 5000000)
+}
+
+func TestCalculateIncomeDirection(t *testing.T) {
+	// The export lists the credits and the debits in the amount column and has a separate credit column.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK",
+		[]any{"25/01/2025", "B-1", "Salary January", "", "5000000", ""},
+		[]any{"26/01/2025", "B-2", "Salary refund", "", "-2000000", ""},
+		[]any{"27/01/2025", "B-3", "Salary bonus", "", "", "3000000"},
+	)
+
+	tests := []struct {
+		name       string
+		configured IncomeDirection
+		requested  IncomeDirection
+		want       IncomeDirection
+		wantSalary int64
+	}{
+		{name: "credits only by default", want: IncomeDirectionCredits, wantSalary: 5000000},
+		{name: "configured debits", configured: IncomeDirectionDebits, want: IncomeDirectionDebits, wantSalary: 2000000},
+		{name: "requested separate credit column", configured: IncomeDirectionDebits, requested: "separate", want: IncomeDirectionSeparate, wantSalary: 3000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetIncomeDirection(tt.configured)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			insert := expectSave(mock)
+
+			req := newCalculateReq(types.ProductSA)
+			req.IncomeDirection = tt.requested
+			calculation, err := s.CalculateIncome(userContext(), req)
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if !calculation.TotalBasicSalary.Equal(decimal.NewFromInt(tt.wantSalary)) {
+				t.Errorf("total basic salary = %s, want %d", calculation.TotalBasicSalary, tt.wantSalary)
+			}
+			if calculation.IncomeDirection != tt.want {
+				t.Errorf("income direction = %s, want %s", calculation.IncomeDirection, tt.want)
+			}
+			if !slices.Contains(insert.Args(), any(tt.want.String())) {
+				t.Errorf("saved arguments %v, want the income direction %s recorded", insert.Args(), tt.want)
+			}
+		})
+	}
+}
+
+func TestRecalculateMaxMonths(t *testing.T) {
+	months := func(n int) []MonthlySalary {
+		salaries := make([]MonthlySalary, n)
+		for i := range salaries {
+			date := time.Date(2025, time.Month(i+1), 25, 0, 0, 0, 0, time.UTC)
+			salaries[i] = MonthlySalary{
+				Month:        date.Format("January-2006"),
+				Transactions: []Transaction{{Date: types.DDMMYYYY(date), Amount: decimal.NewFromInt(5000000)}},
+			}
+		}
+		return salaries
+	}
+
+	tests := []struct {
+		name     string
+		months   int
+		wantCode codes.Code
+	}{
+		{name: "at the cap", months: 3, wantCode: codes.OK},
+		{name: "above the cap", months: 4, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			if tt.wantCode == codes.OK {
+				seedPendingCalculation(mock, "APP-1")
+			}
+
+			s := &Service{db: db, zlog: zap.NewNop()}
+			s.SetMaxRecalculationMonths(3)
+			_, err := s.ReCalculatePreview(userContext(), &RecalculateReq{Number: "APP-1", MonthlySalaries: months(tt.months)})
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ReCalculatePreview() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil && !strings.Contains(fieldViolation(err), "3 months") {
+				t.Errorf("field violation = %q, want the cap of 3 months", fieldViolation(err))
+			}
+		})
+	}
+}
+
+func TestCalculateIncomeNumberFormat(t *testing.T) {
+	tests := []struct {
+		format statement.NumberFormat
+		amount string
+	}{
+		{format: statement.NumberFormatDot, amount: "5,000,000.50"},
+		{format: statement.NumberFormatComma, amount: "5.000.000,50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK",
+				[]any{"25/01/2025", "B-1", "Salary January", "", tt.amount})
+
+			s, mock := newCalculateTestService(t)
+			s.statement.SetNumberFormat(tt.format)
+			expectStatement(mock, file, salaryWordlist())
+			expectCurrency(mock, "LAK", "1")
+			expectSave(mock)
+
+			calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+			if err != nil {
+				t.Fatalf("CalculateIncome() error = %v", err)
+			}
+			if want := decimal.RequireFromString("5000000.5"); !calculation.TotalBasicSalary.Equal(want) {
+				t.Errorf("total basic salary = %s, want %s", calculation.TotalBasicSalary, want)
+			}
+		})
+	}
+}
+
+func TestGetCalculationByID(t *testing.T) {
+	tests := []struct {
+		name     string
+		found    bool
+		wantCode codes.Code
+	}{
+		{name: "found", found: true, wantCode: codes.OK},
+		{name: "not found", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			var get *dbtest.Expectation
+			if tt.found {
+				get = seedHouseholdCalculation(mock, "APP-1", "LAK", "5000000")
+			} else {
+				get = mock.ExpectQuery(`TOP 1 id,\s*statement_file_name`)
+			}
+
+			calculation, err := s.GetCalculationByID(userContext(), 1)
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByID() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if !slices.Contains(get.Args(), any(int64(1))) {
+				t.Errorf("query arguments = %v, want the ID 1", get.Args())
+			}
+			if err == nil && (calculation.ID != 1 || calculation.Number != "APP-1") {
+				t.Errorf("calculation %d %s, want 1 APP-1", calculation.ID, calculation.Number)
+			}
+		})
+	}
+}
+
+func TestRecalculateCorrectsLyingTotals(t *testing.T) {
+	january := time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)
+	february := time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)
+
+	req := newRecalculateReq("January-2025", january, 5000000)
+	// The client claims totals its transactions do not add up to.
+	req.MonthlySalaries[0].Total = decimal.NewFromInt(99000000)
+	req.MonthlySalaries[0].TimesReceived = decimal.NewFromInt(9)
+	req.Commissions = []Commission{{
+		Month:        "February-2025",
+		Transactions: []Transaction{{Date: types.DDMMYYYY(february), Amount: decimal.NewFromInt(1000000)}},
+		Total:        decimal.NewFromInt(50000000),
+	}}
+
+	db, mock := dbtest.New(t)
+	seedPendingCalculation(mock, "APP-1")
+	s := &Service{db: db, zlog: zap.NewNop()}
+
+	calculation, err := s.ReCalculatePreview(userContext(), req)
+	if err != nil {
+		t.Fatalf("ReCalculatePreview() error = %v", err)
+	}
+
+	salary := calculation.SalaryBreakdown.MonthlySalaries[0]
+	if !salary.Total.Equal(decimal.NewFromInt(5000000)) || !salary.TimesReceived.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("salary of January total %s received %s times, want 5000000 once", salary.Total, salary.TimesReceived)
+	}
+	if got := calculation.CommissionBreakdown.Commissions[0].Total; !got.Equal(decimal.NewFromInt(1000000)) {
+		t.Errorf("commission of February total = %s, want 1000000", got)
+	}
+	// The SA product counts the salaries only.
+	if !calculation.TotalIncome.Equal(decimal.NewFromInt(5000000)) {
+		t.Errorf("total income = %s, want 5000000", calculation.TotalIncome)
+	}
+}
+
+func TestCalculateIncomeBaseCurrencyIgnoresStoredRate(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+	)
+
+	s, mock := newCalculateTestService(t)
+	expectStatement(mock, file, salaryWordlist())
+	// The rate stored for LAK is wrong, the base currency converts at 1 anyway.
+	expectCurrency(mock, "LAK", "2")
+	expectSave(mock)
+
+	calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+	if err != nil {
+		t.Fatalf("CalculateIncome() error = %v", err)
+	}
+	if !calculation.ExchangeRate.Equal(decimal.NewFromInt(1)) {
+		t.Errorf("exchange rate = %s, want 1", calculation.ExchangeRate)
+	}
+	if !calculation.MonthlyNetIncome.Equal(calculation.MonthlyAverageIncome) || !calculation.MonthlyNetIncome.Equal(decimal.NewFromInt(5000000)) {
+		t.Errorf("monthly net income = %s, want the monthly average income %s", calculation.MonthlyNetIncome, calculation.MonthlyAverageIncome)
+	}
+}
+
+func TestReCalculateIncomeBasicSalaryFromInterview(t *testing.T) {
+	salaries := []MonthlySalary{
+		{Month: "January-2025", Transactions: []Transaction{{Date: types.DDMMYYYY(time.Date(2025, 1, 25, 0, 0, 0, 0, time.UTC)), Amount: decimal.NewFromInt(5000000)}}},
+		{Month: "February-2025", Transactions: []Transaction{{Date: types.DDMMYYYY(time.Date(2025, 2, 25, 0, 0, 0, 0, time.UTC)), Amount: decimal.NewFromInt(5000000)}}},
+		{Month: "March-2025", Transactions: []Transaction{{Date: types.DDMMYYYY(time.Date(2025, 3, 25, 0, 0, 0, 0, time.UTC)), Amount: decimal.NewFromInt(5000000)}}},
+	}
+
+	tests := []struct {
+		name        string
+		product     types.ProductType
+		interview   int64
+		wantAverage int64
+	}{
+		{name: "SA without interview salary", product: types.ProductSA, wantAverage: 5000000},
+		{name: "SA with lower interview salary", product: types.ProductSA, interview: 4000000, wantAverage: 4000000},
+		// An interview salary above the statement salary is kept but does not raise the average.
+		{name: "SA with higher interview salary", product: types.ProductSA, interview: 6000000, wantAverage: 5000000},
+		{name: "PL without interview salary", product: types.ProductPL, wantAverage: 5000000},
+		// The 1,000,000 of monthly salary above the interview salary is counted as other income at 80%.
+		{name: "PL with lower interview salary", product: types.ProductPL, interview: 4000000, wantAverage: 4800000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			seedPendingProductCalculation(mock, "APP-1", tt.product)
+			update := mock.ExpectExec(`UPDATE statement_file_analysis`)
+			mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+
+			s := &Service{db: db, zlog: zap.NewNop()}
+			calculation, err := s.ReCalculateIncome(userContext(), &RecalculateReq{
+				Number:                   "APP-1",
+				BasicSalaryFromInterview: decimal.NewFromInt(tt.interview),
+				MonthlySalaries:          slices.Clone(salaries),
+			})
+			if err != nil {
+				t.Fatalf("ReCalculateIncome() error = %v", err)
+			}
+
+			if !calculation.BasicSalaryFromInterview.Equal(decimal.NewFromInt(tt.interview)) {
+				t.Errorf("basic salary from interview = %s, want %d", calculation.BasicSalaryFromInterview, tt.interview)
+			}
+			if !calculation.MonthlyAverageIncome.Equal(decimal.NewFromInt(tt.wantAverage)) {
+				t.Errorf("monthly average income = %s, want %d", calculation.MonthlyAverageIncome, tt.wantAverage)
+			}
+
+			args := update.Args()
+			if got, ok := args[basicSalaryInterviewArg].(string); !ok || !decimal.RequireFromString(got).Equal(decimal.NewFromInt(tt.interview)) {
+				t.Errorf("basic salary from interview saved = %v, want %d", args[basicSalaryInterviewArg], tt.interview)
+			}
+			if got, ok := args[averageIncomeArg].(string); !ok || !decimal.RequireFromString(got).Equal(decimal.NewFromInt(tt.wantAverage)) {
+				t.Errorf("monthly average income saved = %v, want %d", args[averageIncomeArg], tt.wantAverage)
+			}
+		})
+	}
+}
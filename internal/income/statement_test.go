@@ -0,0 +1,136 @@
+package income
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+// statementHeader is the header row of the transactions of the statement fixtures.
+var statementHeader = []any{"Date", "Bill No.", "Description", "", "Amount", "Credit"}
+
+// writeStatement writes a statement fixture of the account 0100001 in the given currency
+// over the given period, e.g. "01/01/2025 ຫາ 31/03/2025", whose transactions are the given rows.
+// The header cells are where DefaultStatementLayout expects them.
+func writeStatement(t testing.TB, period, currency string, rows ...[]any) *statement.StatementFile {
+	t.Helper()
+	return writeStatementWithLayout(t, statement.DefaultStatementLayout, period, currency, rows...)
+}
+
+// writeStatementWithLayout is writeStatement with the header cells where the given layout expects them.
+func writeStatementWithLayout(t testing.TB, layout statement.StatementLayout, period, currency string, rows ...[]any) *statement.StatementFile {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Table 1"
+	if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+		t.Fatal(err)
+	}
+	cells := map[string]string{
+		layout.Period:             "Period : " + period,
+		layout.AccountNumber:      "Account number : 0100001",
+		layout.AccountDisplayName: "Account name : Somchai",
+		layout.AccountCurrency:    "Currency : " + currency,
+	}
+	for cell, v := range cells {
+		if err := f.SetCellValue(sheetName, cell, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, row := range append([][]any{statementHeader}, rows...) {
+		cell, _ := excelize.CoordinatesToCellName(1, 13+i)
+		if err := f.SetSheetRow(sheetName, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	location := filepath.Join(t.TempDir(), "statement.xlsx")
+	if err := f.SaveAs(location); err != nil {
+		t.Fatal(err)
+	}
+
+	return &statement.StatementFile{ID: 1, Name: "statement.xlsx", Location: location}
+}
+
+// credit returns the statement row of a credit of the given amount on the given date, e.g. "25/01/2025".
+func credit(date, note string, amount int64) []any {
+	return []any{date, fmt.Sprintf("B-%s", date), note, "", fmt.Sprint(amount)}
+}
+
+func newCalculateTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	ctx := context.Background()
+	db, mock := dbtest.New(t)
+	currencySvc, err := currency.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	statementSvc, err := statement.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewService(ctx, db, currencySvc, statementSvc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+// expectStatement expects the lookups of CalculateIncome before the statement file is read:
+// the number not used yet, the statement file and the wordlists.
+func expectStatement(mock *dbtest.Mock, file *statement.StatementFile, wordlists ...*Wordlist) {
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`TOP 1 number FROM statement_file_analysis`)
+	mock.ExpectQuery(`FROM statement_file WHERE`).WillReturnRows(
+		[]string{"id", "original_file_name", "file_name", "location", "created_by", "created_at"},
+		[]any{file.ID, file.Name, file.Name, file.Location, "user@example.com", now},
+	)
+
+	rows := make([][]any, len(wordlists))
+	for i, w := range wordlists {
+		rows[i] = wordlistRow(w)
+	}
+	mock.ExpectQuery(`FROM income_wordlist`).WillReturnRows(wordlistColumns, rows...)
+}
+
+// expectCurrency expects the lookup of the currency of the statement.
+func expectCurrency(mock *dbtest.Mock, code, rate string) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(
+		[]string{"id", "code", "exchange_rate", "created_by", "updated_by", "created_at", "updated_at"},
+		[]any{"currency0001", code, rate, "admin@example.com", "admin@example.com", now, now},
+	)
+}
+
+// expectSave expects the insert of a new calculation and of its first snapshot, returning the insert.
+func expectSave(mock *dbtest.Mock) *dbtest.Expectation {
+	insert := mock.ExpectQuery(`INSERT INTO statement_file_analysis \(`).WillReturnRows([]string{"id"}, []any{1})
+	mock.ExpectExec(`INSERT INTO statement_file_analysis_history`)
+	return insert
+}
+
+func userContext() context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+}
+
+func newCalculateReq(product types.ProductType) *CalculateReq {
+	return &CalculateReq{Number: "APP-1", Product: product, StatementFileName: "statement.xlsx"}
+}
+
+func salaryWordlist() *Wordlist {
+	return &Wordlist{ID: 1, Word: "salary", Category: SourceSalary}
+}
@@ -4,6 +4,9 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strconv"
+	"strings"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
 )
 
 type source int
@@ -44,22 +47,24 @@ func (s source) MarshalJSON() ([]byte, error) {
 }
 
 func (s *source) UnmarshalJSON(b []byte) error {
-	if string(b) == "null" {
+	v, ok := types.UnquoteEnum(b)
+	if !ok {
 		return nil
 	}
 
-	b = b[1 : len(b)-1]
-	if t, err := strconv.Atoi(string(b)); err == nil {
-		*s = source(t)
+	if t, ok := sourceValues[strings.ToUpper(v)]; ok {
+		*s = t
 		return nil
 	}
 
-	if t, ok := sourceValues[string(b)]; ok {
-		*s = t
-		return nil
+	if t, err := strconv.Atoi(v); err == nil {
+		if _, ok := sourceNames[source(t)]; ok {
+			*s = source(t)
+			return nil
+		}
 	}
 
-	return fmt.Errorf("invalid source: %s", string(b))
+	return types.NewEnumError("category", v, sourceValues)
 }
 
 func (s *source) Scan(src any) error {
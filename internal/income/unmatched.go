@@ -0,0 +1,111 @@
+package income
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+type ListUnmatchedTransactionsResult struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+// ListUnmatchedTransactions returns the income transactions of the statement file whose note
+// matches no wordlist, read in the configured income direction, to find the words missing from the wordlists.
+func (s *Service) ListUnmatchedTransactions(ctx context.Context, statementFileName string) (*ListUnmatchedTransactionsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "ListUnmatchedTransactions"),
+		zap.String("Username", claims.Username),
+		zap.String("StatementFileName", statementFileName),
+	)
+
+	statementFile, err := s.statement.GetStatementByName(ctx, statementFileName)
+	if err != nil {
+		return nil, err
+	}
+
+	wordlists, err := listWordlists(ctx, s.db, &WordlistQuery{
+		noLimit: true,
+	})
+	if err != nil {
+		zlog.Error("failed to get wordlists", zap.Error(err))
+		return nil, err
+	}
+
+	unmatched, err := s.listUnmatchedTransactionsFromStatementFile(s.incomeDirection, wordlists, statementFile)
+	if err != nil {
+		zlog.Error("failed to list unmatched transactions", zap.Error(err))
+		return nil, err
+	}
+
+	return &ListUnmatchedTransactionsResult{
+		Transactions: unmatched,
+	}, nil
+}
+
+// listUnmatchedTransactionsFromStatementFile returns every income transaction of the statement file
+// with a note that matches no wordlist.
+func (s *Service) listUnmatchedTransactionsFromStatementFile(direction IncomeDirection, wordlists []*Wordlist, statement *statement.StatementFile) ([]Transaction, error) {
+	f, err := excelize.OpenFile(statement.Location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", statement.Name, err)
+	}
+	defer f.Close()
+
+	const sheetName = "Table 1"
+
+	rows, err := f.Rows(sheetName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows: %w", err)
+	}
+	defer rows.Close()
+
+	unmatched := make([]Transaction, 0)
+	rowCount := 0
+	for rows.Next() {
+		rowCount++
+		if rowCount > s.maxStatementRows {
+			return nil, fmt.Errorf("%w: %s", ErrStatementTooLarge, statement.Name)
+		}
+
+		row, err := rows.Columns()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get row columns: %w", err)
+		}
+
+		amount, ok := direction.incomeAmount(row, s.statement.NumberFormat())
+		if !ok {
+			continue // skip rows with insufficient columns, invalid or zero amounts
+		}
+
+		if len(row[2]) == 0 {
+			continue // skip if the note field is empty
+		}
+
+		if _, _, ok := matchWordlists(row[2], wordlists); ok {
+			continue
+		}
+
+		date, err := time.ParseInLocation("02/01/2006", row[0], time.Local)
+		if err != nil {
+			continue // skip if date is invalid, e.g. the header
+		}
+
+		unmatched = append(unmatched, Transaction{
+			Amount:     amount,
+			Date:       types.DDMMYYYY(date),
+			BillNumber: row[1],
+			Noted:      row[2],
+		})
+	}
+
+	return unmatched, nil
+}
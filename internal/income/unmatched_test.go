@@ -0,0 +1,39 @@
+package income
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListUnmatchedTransactions(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("26/01/2025", "Transfer from Ann", 300000),
+		credit("27/01/2025", "Rent February", 1200000),
+		[]any{"28/01/2025", "B-4", "Card payment", "", "-150000", ""},
+	)
+
+	s, mock := newCalculateTestService(t)
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM statement_file WHERE`).WillReturnRows(
+		[]string{"id", "original_file_name", "file_name", "location", "created_by", "created_at"},
+		[]any{file.ID, file.Name, file.Name, file.Location, "user@example.com", now},
+	)
+	mock.ExpectQuery(`FROM income_wordlist`).WillReturnRows(wordlistColumns, wordlistRow(salaryWordlist()))
+
+	result, err := s.ListUnmatchedTransactions(userContext(), file.Name)
+	if err != nil {
+		t.Fatalf("ListUnmatchedTransactions() error = %v", err)
+	}
+
+	// The salary matches the wordlist and the debit is not an income.
+	got := make([]string, 0, len(result.Transactions))
+	for _, tx := range result.Transactions {
+		got = append(got, tx.Noted)
+	}
+	want := []string{"Transfer from Ann", "Rent February"}
+	if !slices.Equal(got, want) {
+		t.Errorf("unmatched notes = %q, want %q", got, want)
+	}
+}
@@ -27,6 +27,9 @@ type Wordlist struct {
 	UpdatedBy string    `json:"updatedBy"` // Optional, can be used for updates
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
+
+	// Usage is set only when listed with usage.
+	Usage *WordlistUsage `json:"usage,omitempty"`
 }
 
 func (w *Wordlist) Update(by string, in *WordlistReq) bool {
@@ -44,6 +47,7 @@ type ListWordlistsResult struct {
 
 type WordlistQuery struct {
 	noLimit       bool
+	ids           []int64
 	ID            int64     `json:"id" param:"id" query:"id"`
 	Word          string    `json:"word"  query:"word"`
 	Category      string    `json:"category"  query:"category"`
@@ -51,6 +55,9 @@ type WordlistQuery struct {
 	PageSize      uint64    `json:"pageSize"  query:"pageSize"`
 	CreatedAfter  time.Time `json:"createdAfter"  query:"createdAfter"`
 	CreatedBefore time.Time `json:"createdBefore"  query:"createdBefore"`
+
+	// WithUsage reports how many transactions each wordlist matched over the usage window.
+	WithUsage bool `json:"withUsage" query:"withUsage"`
 }
 
 func (q *WordlistQuery) ToSql() (string, []any, error) {
@@ -60,6 +67,10 @@ func (q *WordlistQuery) ToSql() (string, []any, error) {
 		and = append(and, sq.Eq{"id": q.ID})
 	}
 
+	if len(q.ids) > 0 {
+		and = append(and, sq.Eq{"id": q.ids})
+	}
+
 	if q.Word != "" {
 		and = append(and, sq.Eq{"word": q.Word})
 	}
@@ -138,6 +149,15 @@ func (r *WordlistReq) ToWordlist(by string) *Wordlist {
 }
 
 func matchWordlists(target string, wordlists []*Wordlist) (source, string, bool) {
+	w, ok := matchWordlist(target, wordlists)
+	if !ok {
+		return SourceUnSpecified, "", false
+	}
+	return w.Category, w.Word, true
+}
+
+// matchWordlist returns the first wordlist matching the target.
+func matchWordlist(target string, wordlists []*Wordlist) (*Wordlist, bool) {
 	target = strings.TrimSpace(target)
 	target = strings.ToLower(target)
 	for _, w := range wordlists {
@@ -151,22 +171,24 @@ func matchWordlists(target string, wordlists []*Wordlist) (source, string, bool)
 				for v := range ts {
 					v = strings.TrimSpace(v)
 					if strings.EqualFold(v, strings.ToLower(w.Word)) {
-						return w.Category, w.Word, true
+						return w, true
 					}
 				}
 			}
 
 		default:
 			if strings.Contains(target, strings.ToLower(w.Word)) {
-				return w.Category, w.Word, true
+				return w, true
 			}
 		}
 	}
 
-	return SourceUnSpecified, "", false
+	return nil, false
 }
 
 func listWordlists(ctx context.Context, db *sql.DB, in *WordlistQuery) ([]*Wordlist, error) {
+	defer database.TimeQuery("income.listWordlists")()
+
 	id := fmt.Sprintf("TOP %d id", pager.Size(in.PageSize))
 	if in.noLimit {
 		id = "id"
@@ -295,3 +317,90 @@ func saveWordlist(ctx context.Context, db *sql.DB, wordlist *Wordlist) error {
 		return nil
 	})
 }
+
+type ReclassifyWordlistsReq struct {
+	IDs      []int64 `json:"ids"`
+	Category source  `json:"category"`
+}
+
+func (r *ReclassifyWordlistsReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if len(r.IDs) == 0 {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "ids",
+			Description: "IDs must not be empty",
+		})
+	}
+
+	seen := make(map[int64]bool, len(r.IDs))
+	for i, id := range r.IDs {
+		if id <= 0 {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("ids[%d]", i),
+				Description: "ID must be greater than zero",
+			})
+			continue
+		}
+
+		if seen[id] {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("ids[%d]", i),
+				Description: "ID must not be duplicated",
+			})
+		}
+		seen[id] = true
+	}
+
+	if r.Category == SourceUnSpecified {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "category",
+			Description: "Category must not be empty",
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Wordlists are not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// reclassifyWordlists moves the wordlists with the given IDs to the category in one transaction.
+// It returns ErrWordlistNotFound if any of the wordlists no longer exists.
+func reclassifyWordlists(ctx context.Context, db *sql.DB, ids []int64, category source, by string, at time.Time) error {
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		q, args := sq.Update("income_wordlist").
+			Set("category", category).
+			Set("updated_by", by).
+			Set("updated_at", at).
+			Where(sq.Eq{
+				"id": ids,
+			}).
+			PlaceholderFormat(sq.AtP).
+			MustSql()
+
+		effected, err := tx.ExecContext(ctx, q, args...)
+		if err != nil {
+			return fmt.Errorf("failed to reclassify wordlists: %w", err)
+		}
+
+		rowsAffected, err := effected.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected != int64(len(ids)) {
+			return ErrWordlistNotFound
+		}
+
+		return nil
+	})
+}
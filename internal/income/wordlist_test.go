@@ -0,0 +1,108 @@
+package income
+
+import (
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+var wordlistColumns = []string{"id", "word", "category", "created_by", "created_at", "updated_by", "updated_at"}
+
+func wordlistRow(w *Wordlist) []any {
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []any{w.ID, w.Word, w.Category.String(), "admin@example.com", at, "admin@example.com", at}
+}
+
+func TestReclassifyWordlists(t *testing.T) {
+	commissions := []*Wordlist{
+		{ID: 1, Word: "bonus", Category: SourceCommission},
+		{ID: 2, Word: "incentive", Category: SourceCommission},
+		{ID: 3, Word: "overtime", Category: SourceCommission},
+	}
+
+	s, mock := newCalculateTestService(t)
+	rows := make([][]any, len(commissions))
+	for i, w := range commissions {
+		rows[i] = wordlistRow(w)
+	}
+	mock.ExpectQuery(`FROM income_wordlist`).WillReturnRows(wordlistColumns, rows...)
+	update := mock.ExpectExec(`UPDATE income_wordlist SET category`).WillReturnResult(3)
+
+	result, err := s.ReclassifyWordlists(userContext(), &ReclassifyWordlistsReq{IDs: []int64{1, 2, 3}, Category: SourceAllowance})
+	if err != nil {
+		t.Fatalf("ReclassifyWordlists() error = %v", err)
+	}
+	if len(result.Wordlists) != 3 {
+		t.Fatalf("wordlists = %d, want 3", len(result.Wordlists))
+	}
+	for _, w := range result.Wordlists {
+		if w.Category != SourceAllowance || w.UpdatedBy != "user@example.com" {
+			t.Errorf("wordlist %d = %s by %s, want ALLOWANCE by user@example.com", w.ID, w.Category, w.UpdatedBy)
+		}
+	}
+	if args := update.Args(); len(args) != 6 || args[0] != SourceAllowance.String() {
+		t.Errorf("update args = %v, want the category ALLOWANCE and the 3 IDs", args)
+	}
+	if mock.Commits() != 1 {
+		t.Errorf("commits = %d, want 1", mock.Commits())
+	}
+
+	// The following calculation matches the words to their new category.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("26/01/2025", "Bonus January", 1000000),
+		credit("27/01/2025", "Overtime January", 500000),
+	)
+	expectStatement(mock, file, append([]*Wordlist{salaryWordlist()}, result.Wordlists...)...)
+	expectCurrency(mock, "LAK", "1")
+	expectSave(mock)
+
+	calculation, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductSA))
+	if err != nil {
+		t.Fatalf("CalculateIncome() error = %v", err)
+	}
+	if len(calculation.CommissionBreakdown.Commissions) != 0 {
+		t.Errorf("commissions = %+v, want none", calculation.CommissionBreakdown.Commissions)
+	}
+	if got := len(calculation.AllowanceBreakdown.Allowances); got != 2 {
+		t.Errorf("allowances = %d, want the bonus and the overtime", got)
+	}
+}
+
+func TestReclassifyWordlistsUnknownID(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	mock.ExpectQuery(`FROM income_wordlist`).WillReturnRows(wordlistColumns,
+		wordlistRow(&Wordlist{ID: 1, Word: "bonus", Category: SourceCommission}),
+	)
+
+	_, err := s.ReclassifyWordlists(userContext(), &ReclassifyWordlistsReq{IDs: []int64{1, 4}, Category: SourceAllowance})
+	if rpcStatus.Code(err) != codes.InvalidArgument {
+		t.Fatalf("ReclassifyWordlists() error = %v, want InvalidArgument", err)
+	}
+	if mock.Commits() != 0 {
+		t.Error("wordlists were reclassified")
+	}
+}
+
+func TestReclassifyWordlistsReqValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *ReclassifyWordlistsReq
+	}{
+		{name: "no IDs", req: &ReclassifyWordlistsReq{Category: SourceAllowance}},
+		{name: "invalid ID", req: &ReclassifyWordlistsReq{IDs: []int64{0}, Category: SourceAllowance}},
+		{name: "duplicate ID", req: &ReclassifyWordlistsReq{IDs: []int64{1, 1}, Category: SourceAllowance}},
+		{name: "no category", req: &ReclassifyWordlistsReq{IDs: []int64{1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); rpcStatus.Code(err) != codes.InvalidArgument {
+				t.Errorf("Validate() error = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
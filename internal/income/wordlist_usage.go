@@ -0,0 +1,215 @@
+package income
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+)
+
+// DefaultWordlistUsageWindow is how far back the usage of the wordlists is reported
+// when no other window is configured.
+const DefaultWordlistUsageWindow = 90 * 24 * time.Hour
+
+// WordlistUsage is how many transactions a wordlist matched since the start of the usage window.
+type WordlistUsage struct {
+	MatchedCount int64     `json:"matchedCount"`
+	Since        time.Time `json:"since"`
+}
+
+// wordlistCounter counts the transactions matched by each wordlist in memory
+// until they are flushed to the database by FlushWordlistUsage.
+type wordlistCounter struct {
+	mu     sync.Mutex
+	counts map[int64]int64
+}
+
+func newWordlistCounter() *wordlistCounter {
+	return &wordlistCounter{
+		counts: make(map[int64]int64),
+	}
+}
+
+func (c *wordlistCounter) add(counts map[int64]int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, n := range counts {
+		c.counts[id] += n
+	}
+}
+
+// pending returns the counts not flushed yet.
+func (c *wordlistCounter) pending() map[int64]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return maps.Clone(c.counts)
+}
+
+// drain returns the counts not flushed yet and resets them.
+func (c *wordlistCounter) drain() map[int64]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := c.counts
+	c.counts = make(map[int64]int64)
+	return counts
+}
+
+// SetWordlistUsageWindow sets how far back the usage of the wordlists is reported.
+// The usage older than the window is removed on the next flush.
+func (s *Service) SetWordlistUsageWindow(window time.Duration) {
+	if window <= 0 {
+		window = DefaultWordlistUsageWindow
+	}
+	s.wordlistUsageWindow = window
+}
+
+// FlushWordlistUsage saves the transactions matched by each wordlist since the last flush
+// and removes the usage older than the usage window. It is meant to be called periodically.
+// The counts are kept for the next flush if they cannot be saved.
+func (s *Service) FlushWordlistUsage(ctx context.Context) error {
+	counts := s.wordlistCounter.drain()
+
+	now := time.Now()
+	if err := saveWordlistUsage(ctx, s.db, counts, now, now.Add(-s.wordlistUsageWindow)); err != nil {
+		s.wordlistCounter.add(counts)
+		return err
+	}
+
+	return nil
+}
+
+// setWordlistUsage sets the usage of the wordlists since the start of the usage window,
+// including the counts not flushed yet.
+func (s *Service) setWordlistUsage(ctx context.Context, wordlists []*Wordlist) error {
+	if len(wordlists) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, 0, len(wordlists))
+	for _, w := range wordlists {
+		ids = append(ids, w.ID)
+	}
+
+	since := time.Now().Add(-s.wordlistUsageWindow)
+	counts, err := listWordlistUsage(ctx, s.db, ids, since)
+	if err != nil {
+		return err
+	}
+
+	pending := s.wordlistCounter.pending()
+	for _, w := range wordlists {
+		w.Usage = &WordlistUsage{
+			MatchedCount: counts[w.ID] + pending[w.ID],
+			Since:        since,
+		}
+	}
+
+	return nil
+}
+
+func listWordlistUsage(ctx context.Context, db *sql.DB, ids []int64, since time.Time) (map[int64]int64, error) {
+	defer database.TimeQuery("income.listWordlistUsage")()
+
+	q, args := sq.
+		Select(
+			"wordlist_id",
+			"SUM(matched_count)",
+		).
+		From("income_wordlist_usage").
+		Where(sq.And{
+			sq.Eq{"wordlist_id": ids},
+			sq.GtOrEq{"usage_date": since.Format(time.DateOnly)},
+		}).
+		GroupBy("wordlist_id").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query for listing wordlist usage: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int64, len(ids))
+	for rows.Next() {
+		var id, count int64
+		if err := rows.Scan(&id, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		counts[id] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate rows: %w", err)
+	}
+
+	return counts, nil
+}
+
+// saveWordlistUsage adds the counts to the usage of the day and removes the usage before the given time.
+func saveWordlistUsage(ctx context.Context, db *sql.DB, counts map[int64]int64, at, removeBefore time.Time) error {
+	defer database.TimeQuery("income.saveWordlistUsage")()
+
+	day := at.Format(time.DateOnly)
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for id, count := range counts {
+			updateQuery, args := sq.Update("income_wordlist_usage").
+				Set("matched_count", sq.Expr("matched_count + ?", count)).
+				Where(sq.Eq{
+					"wordlist_id": id,
+					"usage_date":  day,
+				}).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			effected, err := tx.ExecContext(ctx, updateQuery, args...)
+			if err != nil {
+				return fmt.Errorf("failed to update wordlist usage: %w", err)
+			}
+
+			rowsAffected, err := effected.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to get rows affected: %w", err)
+			}
+			if rowsAffected > 0 {
+				continue
+			}
+
+			insertQuery, args := sq.Insert("income_wordlist_usage").
+				Columns(
+					"wordlist_id",
+					"usage_date",
+					"matched_count",
+				).
+				Values(
+					id,
+					day,
+					count,
+				).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			if _, err := tx.ExecContext(ctx, insertQuery, args...); err != nil {
+				return fmt.Errorf("failed to insert wordlist usage: %w", err)
+			}
+		}
+
+		deleteQuery, args := sq.Delete("income_wordlist_usage").
+			Where(sq.Lt{"usage_date": removeBefore.Format(time.DateOnly)}).
+			PlaceholderFormat(sq.AtP).
+			MustSql()
+
+		if _, err := tx.ExecContext(ctx, deleteQuery, args...); err != nil {
+			return fmt.Errorf("failed to remove expired wordlist usage: %w", err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,93 @@
+package income
+
+import (
+	"context"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/types"
+)
+
+func TestListWordlistsWithUsage(t *testing.T) {
+	salary := salaryWordlist()
+	unused := &Wordlist{ID: 2, Word: "dividend", Category: SourceCommission}
+
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		credit("25/01/2025", "Salary January", 5000000),
+		credit("25/02/2025", "Salary February", 5000000),
+		credit("25/03/2025", "Salary March", 5000000),
+	)
+	s, mock := newCalculateTestService(t)
+	expectStatement(mock, file, salary, unused)
+	expectCurrency(mock, "LAK", "1")
+	expectSave(mock)
+
+	if _, err := s.CalculateIncome(userContext(), newCalculateReq(types.ProductPL)); err != nil {
+		t.Fatalf("CalculateIncome() error = %v", err)
+	}
+
+	// The flush saves the matches of the salary only, the unused wordlist has nothing to save.
+	commits := mock.Commits()
+	mock.ExpectExec(`UPDATE income_wordlist_usage SET matched_count = matched_count \+ @p1`).WillReturnResult(0)
+	insert := mock.ExpectExec(`INSERT INTO income_wordlist_usage`)
+	mock.ExpectExec(`DELETE FROM income_wordlist_usage WHERE usage_date < @p1`)
+
+	if err := s.FlushWordlistUsage(context.Background()); err != nil {
+		t.Fatalf("FlushWordlistUsage() error = %v", err)
+	}
+	if args := insert.Args(); len(args) != 3 || args[0] != salary.ID || args[2] != int64(3) {
+		t.Errorf("insert args = %v, want 3 matches of the salary wordlist", args)
+	}
+	if got := mock.Commits() - commits; got != 1 {
+		t.Errorf("flush commits = %d, want 1", got)
+	}
+
+	mock.ExpectQuery(`FROM income_wordlist WHERE`).WillReturnRows(wordlistColumns, wordlistRow(salary), wordlistRow(unused))
+	mock.ExpectQuery(`SUM\(matched_count\) FROM income_wordlist_usage WHERE \(wordlist_id IN \(@p1,@p2\) AND usage_date >= @p3\) GROUP BY wordlist_id`).
+		WillReturnRows([]string{"wordlist_id", "matched_count"}, []any{salary.ID, 3})
+
+	result, err := s.ListWordlists(userContext(), &WordlistQuery{WithUsage: true})
+	if err != nil {
+		t.Fatalf("ListWordlists() error = %v", err)
+	}
+	if len(result.Wordlists) != 2 {
+		t.Fatalf("wordlists = %d, want 2", len(result.Wordlists))
+	}
+
+	used, notUsed := result.Wordlists[0].Usage, result.Wordlists[1].Usage
+	if used == nil || notUsed == nil {
+		t.Fatalf("usage = %+v and %+v, want the usage of both wordlists", used, notUsed)
+	}
+	if used.MatchedCount != 3 || notUsed.MatchedCount != 0 {
+		t.Errorf("matched counts = %d and %d, want 3 and 0", used.MatchedCount, notUsed.MatchedCount)
+	}
+}
+
+func TestListWordlistsUsageIncludesPendingCounts(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	s.wordlistCounter.add(map[int64]int64{1: 2})
+
+	mock.ExpectQuery(`FROM income_wordlist WHERE`).WillReturnRows(wordlistColumns, wordlistRow(salaryWordlist()))
+	mock.ExpectQuery(`FROM income_wordlist_usage`).WillReturnRows([]string{"wordlist_id", "matched_count"}, []any{1, 5})
+
+	result, err := s.ListWordlists(userContext(), &WordlistQuery{WithUsage: true})
+	if err != nil {
+		t.Fatalf("ListWordlists() error = %v", err)
+	}
+	if got := result.Wordlists[0].Usage.MatchedCount; got != 7 {
+		t.Errorf("matched count = %d, want the 5 flushed and the 2 pending matches", got)
+	}
+}
+
+func TestListWordlistsWithoutUsage(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	// The usage is not read unless asked.
+	mock.ExpectQuery(`FROM income_wordlist WHERE`).WillReturnRows(wordlistColumns, wordlistRow(salaryWordlist()))
+
+	result, err := s.ListWordlists(userContext(), &WordlistQuery{})
+	if err != nil {
+		t.Fatalf("ListWordlists() error = %v", err)
+	}
+	if result.Wordlists[0].Usage != nil {
+		t.Errorf("usage = %+v, want none", result.Wordlists[0].Usage)
+	}
+}
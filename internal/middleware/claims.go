@@ -6,6 +6,8 @@ import (
 	"aidanwoods.dev/go-paseto"
 	"github.com/10664kls/automatic-finance-api/internal/auth"
 	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
 )
 
 func SetContextClaimsFromToken(next echo.HandlerFunc) echo.HandlerFunc {
@@ -38,3 +40,36 @@ func parseTokenToClaims(token *paseto.Token) *auth.Claims {
 
 	return claims
 }
+
+// RejectRevokedTokens rejects the requests whose token has been revoked, see auth.Auth.RevokeToken.
+// It must run after SetContextClaimsFromToken.
+func RejectRevokedTokens(isRevoked func(ctx context.Context, tokenID string) (bool, error)) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			revoked, err := isRevoked(ctx, auth.ClaimsFromContext(ctx).TokenID)
+			if err != nil {
+				return err
+			}
+			if revoked {
+				return rpcStatus.Error(codes.Unauthenticated, "Your provided token is not valid. Please provide a valid token")
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// RequireRole rejects the requests whose claims have none of the given roles, see auth.Claims.HasRole.
+// It must run after SetContextClaimsFromToken.
+func RequireRole(roles ...auth.Role) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !auth.ClaimsFromContext(c.Request().Context()).HasRole(roles...) {
+				return rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestRequireRole(t *testing.T) {
+	// The roles allowed to create or change the calculations, see server.Install.
+	creators := []auth.Role{auth.RoleUser, auth.RoleReadOnlyAdmin, auth.RoleAdmin}
+
+	tests := []struct {
+		name   string
+		claims *auth.Claims
+		want   codes.Code
+	}{
+		{name: "user", claims: &auth.Claims{Role: auth.RoleUser}, want: codes.OK},
+		{name: "read-only admin", claims: &auth.Claims{Role: auth.RoleReadOnlyAdmin}, want: codes.OK},
+		{name: "approver", claims: &auth.Claims{Role: auth.RoleApprover}, want: codes.PermissionDenied},
+		{name: "admin", claims: &auth.Claims{Role: auth.RoleAdmin, IsAdmin: true}, want: codes.OK},
+		{name: "no claims", claims: nil, want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tt.claims != nil {
+				req = req.WithContext(auth.ContextWithClaims(req.Context(), tt.claims))
+			}
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			called := false
+			h := RequireRole(creators...)(func(c echo.Context) error {
+				called = true
+				return nil
+			})
+
+			err := h(c)
+			if got := rpcStatus.Code(err); got != tt.want {
+				t.Fatalf("code = %s, want %s", got, tt.want)
+			}
+			if called != (tt.want == codes.OK) {
+				t.Errorf("handler called = %v, want %v", called, tt.want == codes.OK)
+			}
+		})
+	}
+}
+
+func TestRejectRevokedTokens(t *testing.T) {
+	revoked := map[string]bool{"token0000001": true}
+	isRevoked := func(_ context.Context, tokenID string) (bool, error) {
+		if tokenID == "broken" {
+			return false, errors.New("database is down")
+		}
+		return revoked[tokenID], nil
+	}
+
+	tests := []struct {
+		name       string
+		tokenID    string
+		wantCalled bool
+		wantStatus int
+	}{
+		{name: "revoked", tokenID: "token0000001", wantStatus: http.StatusUnauthorized},
+		{name: "not revoked", tokenID: "token0000002", wantCalled: true, wantStatus: http.StatusOK},
+		{name: "issued before the tokens were tracked", tokenID: "", wantCalled: true, wantStatus: http.StatusOK},
+		{name: "check failed", tokenID: "broken", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(auth.ContextWithClaims(req.Context(), &auth.Claims{Username: "ann@example.com", TokenID: tt.tokenID}))
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			called := false
+			h := RejectRevokedTokens(isRevoked)(func(c echo.Context) error {
+				called = true
+				return nil
+			})
+
+			err := h(c)
+			// The errors are written with the HTTP status of their code, see cmd/main.go httpErr.
+			if got := runtime.HTTPStatusFromCode(rpcStatus.Code(err)); got != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (error %v)", got, tt.wantStatus, err)
+			}
+			if called != tt.wantCalled {
+				t.Errorf("handler called = %v, want %v", called, tt.wantCalled)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ConcurrencyLimit allows at most n requests to be handled at the same time.
+// Requests over the limit are rejected with 429 Too Many Requests instead of waiting.
+func ConcurrencyLimit(n int) echo.MiddlewareFunc {
+	if n <= 0 {
+		n = 1
+	}
+	gate := make(chan struct{}, n)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			select {
+			case gate <- struct{}{}:
+				defer func() { <-gate }()
+				return next(c)
+
+			default:
+				return echo.ErrTooManyRequests
+			}
+		}
+	}
+}
+
+// IsExportRoute reports whether the matched route is an export route.
+// It is meant as a skipper of the general rate limiter,
+// since export routes have a dedicated limiter.
+func IsExportRoute(c echo.Context) bool {
+	return strings.Contains(c.Path(), "/export")
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	stdmw "github.com/labstack/echo/v4/middleware"
+)
+
+// newLimitedEcho returns an echo instance limited as cmd/main.go limits the server:
+// a general rate limiter skipping the export routes, which have a concurrency limit of one.
+// The export handler blocks until release is closed once started is signaled.
+func newLimitedEcho(started chan<- struct{}, release <-chan struct{}) *echo.Echo {
+	e := echo.New()
+	e.Use(stdmw.RateLimiterWithConfig(stdmw.RateLimiterConfig{
+		Skipper: IsExportRoute,
+		Store:   stdmw.NewRateLimiterMemoryStoreWithConfig(stdmw.RateLimiterMemoryStoreConfig{Rate: 1, Burst: 1}),
+	}))
+
+	e.GET("/v1/incomes/calculations", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	exports := e.Group("", ConcurrencyLimit(1))
+	exports.GET("/v1/incomes/calculations/export-to-excel", func(c echo.Context) error {
+		if started != nil {
+			started <- struct{}{}
+			<-release
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	return e
+}
+
+func serve(e *echo.Echo, path string) int {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
+
+func TestExportsDoNotUseGeneralBudget(t *testing.T) {
+	e := newLimitedEcho(nil, nil)
+
+	if got := serve(e, "/v1/incomes/calculations"); got != http.StatusOK {
+		t.Fatalf("first request = %d, want 200", got)
+	}
+	if got := serve(e, "/v1/incomes/calculations"); got != http.StatusTooManyRequests {
+		t.Fatalf("request over the general budget = %d, want 429", got)
+	}
+
+	for i := 0; i < 3; i++ {
+		if got := serve(e, "/v1/incomes/calculations/export-to-excel"); got != http.StatusOK {
+			t.Fatalf("export %d with the general budget exhausted = %d, want 200", i, got)
+		}
+	}
+}
+
+func TestRequestsDoNotUseExportBudget(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	e := newLimitedEcho(started, release)
+
+	done := make(chan int)
+	go func() { done <- serve(e, "/v1/incomes/calculations/export-to-excel") }()
+	<-started
+
+	if got := serve(e, "/v1/incomes/calculations/export-to-excel"); got != http.StatusTooManyRequests {
+		t.Errorf("export over the export budget = %d, want 429", got)
+	}
+	if got := serve(e, "/v1/incomes/calculations"); got != http.StatusOK {
+		t.Errorf("request during an export = %d, want 200", got)
+	}
+
+	close(release)
+	if got := <-done; got != http.StatusOK {
+		t.Errorf("running export = %d, want 200", got)
+	}
+	go func() { <-started }()
+	if got := serve(e, "/v1/incomes/calculations/export-to-excel"); got != http.StatusOK {
+		t.Errorf("export after the running one = %d, want 200", got)
+	}
+}
@@ -0,0 +1,120 @@
+package pager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+const (
+	OrderAsc  = "ASC"
+	OrderDesc = "DESC"
+)
+
+// Column is a column a list can be ordered by.
+type Column struct {
+	// Name is the name of the column in the query, e.g. "created_at".
+	Name string
+
+	// Time reports whether the column is a time, kept in Cursor.Time rather than Cursor.Value.
+	Time bool
+}
+
+// Order is the order of a list on one of its allowed columns.
+// The ties are broken by the ID, so the pages are stable.
+type Order struct {
+	// By is the name of the ordered column in the request, e.g. "createdAt".
+	By     string
+	Column Column
+	Desc   bool
+}
+
+// ParseOrder parses the order of the given request names, by being one of the allowed columns.
+// An empty by orders by defaultBy and an empty direction orders descending, the order of the lists before they could be ordered.
+func ParseOrder(by, dir, defaultBy string, columns map[string]Column) (*Order, error) {
+	if by == "" {
+		by = defaultBy
+	}
+	dir = strings.ToUpper(strings.TrimSpace(dir))
+	if dir == "" {
+		dir = OrderDesc
+	}
+
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	column, ok := columns[by]
+	if !ok {
+		names := make([]string, 0, len(columns))
+		for n := range columns {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "orderBy",
+			Description: fmt.Sprintf("Order by must be one of %s", strings.Join(names, ", ")),
+		})
+	}
+
+	if dir != OrderAsc && dir != OrderDesc {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "orderDir",
+			Description: fmt.Sprintf("Order direction must be %s or %s", OrderAsc, OrderDesc),
+		})
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Order is not valid. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return nil, s.Err()
+	}
+
+	return &Order{
+		By:     by,
+		Column: column,
+		Desc:   dir == OrderDesc,
+	}, nil
+}
+
+// OrderBy returns the ORDER BY clauses of the order, the ID column breaking the ties.
+func (o *Order) OrderBy(idColumn string) []string {
+	dir := OrderAsc
+	if o.Desc {
+		dir = OrderDesc
+	}
+
+	return []string{
+		fmt.Sprintf("%s %s", o.Column.Name, dir),
+		fmt.Sprintf("%s %s", idColumn, dir),
+	}
+}
+
+// After returns the predicate of the items following the cursor in this order.
+func (o *Order) After(c *Cursor, idColumn string) sq.Sqlizer {
+	var value any = c.Value
+	if o.Column.Time {
+		value = c.Time
+	}
+
+	if o.Desc {
+		return sq.Or{
+			sq.Lt{o.Column.Name: value},
+			sq.And{sq.Eq{o.Column.Name: value}, sq.Lt{idColumn: c.ID}},
+		}
+	}
+
+	return sq.Or{
+		sq.Gt{o.Column.Name: value},
+		sq.And{sq.Eq{o.Column.Name: value}, sq.Gt{idColumn: c.ID}},
+	}
+}
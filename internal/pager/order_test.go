@@ -0,0 +1,89 @@
+package pager
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+var testColumns = map[string]Column{
+	"createdAt": {Name: "created_at", Time: true},
+	"number":    {Name: "number"},
+}
+
+func TestParseOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		by, dir  string
+		want     []string
+		wantCode codes.Code
+	}{
+		{name: "default", want: []string{"created_at DESC", "id DESC"}},
+		{name: "ascending number", by: "number", dir: " asc ", want: []string{"number ASC", "id ASC"}},
+		{name: "unknown column", by: "password_hash", wantCode: codes.InvalidArgument},
+		{name: "unknown direction", dir: "sideways", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ParseOrder(tt.by, tt.dir, "createdAt", testColumns)
+			if got := rpcStatus.Code(err); got != tt.wantCode {
+				t.Fatalf("ParseOrder() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := order.OrderBy("id"); !slices.Equal(got, tt.want) {
+				t.Errorf("OrderBy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderAfter(t *testing.T) {
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cursor := &Cursor{ID: "7", Time: createdAt, Value: "APP-7"}
+
+	tests := []struct {
+		name     string
+		by, dir  string
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:     "descending time",
+			wantSQL:  "(created_at < ? OR (created_at = ? AND id < ?))",
+			wantArgs: []any{createdAt, createdAt, "7"},
+		},
+		{
+			name:     "ascending number",
+			by:       "number",
+			dir:      OrderAsc,
+			wantSQL:  "(number > ? OR (number = ? AND id > ?))",
+			wantArgs: []any{"APP-7", "APP-7", "7"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := ParseOrder(tt.by, tt.dir, "createdAt", testColumns)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sql, args, err := order.After(cursor, "id").ToSql()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("After() = %s, want %s", sql, tt.wantSQL)
+			}
+			if !slices.Equal(args, tt.wantArgs) {
+				t.Errorf("After() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -29,6 +29,9 @@ func Size(size uint64) uint64 {
 type Cursor struct {
 	ID   string    `json:"id"`
 	Time time.Time `json:"time"`
+
+	// Value is the value of the ordered column of the last item, unless it is a time column, see Order.
+	Value string `json:"value,omitempty"`
 }
 
 // EncodeCursor encodes the cursor to a string in base64 format.
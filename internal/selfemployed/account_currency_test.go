@@ -0,0 +1,45 @@
+package selfemployed
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+func TestPreviewCalculationAccountCurrency(t *testing.T) {
+	t.Run("blank currency", func(t *testing.T) {
+		file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "", sale("10/01/2025", 6000000))
+		s, mock := newCalculateTestService(t)
+		// The business has no default currency to fall back to.
+		expectStatement(mock, file, newTestBusiness(40))
+
+		_, err := s.PreviewCalculation(userContext(), newPreviewReq())
+		if got := rpcstatus.Code(err); got != codes.InvalidArgument {
+			t.Fatalf("PreviewCalculation() code = %v, want InvalidArgument (error %v)", got, err)
+		}
+		if got, want := fieldViolation(err), "Account currency in cell A11 of the statement must be a 3-letter currency code"; got != want {
+			t.Errorf("violation = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("no income transactions", func(t *testing.T) {
+		// The statement without account number nor name has its header cells elsewhere.
+		layout := statement.DefaultStatementLayout
+		layout.AccountNumber, layout.AccountDisplayName = "H1", "H2"
+		file := writeStatementWithLayout(t, layout, "01/01/2025 ຫາ 31/03/2025", "LAK", sale("10/01/2025", 6000000))
+		s, mock := newCalculateTestService(t)
+		expectStatement(mock, file, newTestBusiness(40))
+		expectCurrency(mock, "LAK", "1")
+
+		_, err := s.PreviewCalculation(userContext(), newPreviewReq())
+		if err == nil || !strings.Contains(err.Error(), "no valid income transactions") {
+			t.Fatalf("PreviewCalculation() error = %v, want no valid income transactions", err)
+		}
+		if strings.Contains(err.Error(), "currency") {
+			t.Errorf("PreviewCalculation() error = %v, want it not to blame the currency", err)
+		}
+	})
+}
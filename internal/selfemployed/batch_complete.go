@@ -0,0 +1,185 @@
+package selfemployed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+// maxBatchCompleteNumbers is the maximum number of calculation numbers accepted by BatchCompleteCalculations.
+const maxBatchCompleteNumbers = 250
+
+// CompleteOutcome is what happened to a calculation of a batch complete.
+type CompleteOutcome string
+
+const (
+	CompleteOutcomeCompleted        CompleteOutcome = "COMPLETED"
+	CompleteOutcomeAlreadyCompleted CompleteOutcome = "ALREADY_COMPLETED"
+
+	// CompleteOutcomeNotFound is the outcome of the given numbers matching no calculation
+	// the user is allowed to complete.
+	CompleteOutcomeNotFound CompleteOutcome = "NOT_FOUND"
+)
+
+type BatchCompleteCalculationsReq struct {
+	Numbers []string `json:"numbers"`
+}
+
+func (r *BatchCompleteCalculationsReq) Validate() error {
+	violations := make([]*edpb.BadRequest_FieldViolation, 0)
+
+	if len(r.Numbers) == 0 {
+		violations = append(violations, &edpb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: "Numbers must not be empty",
+		})
+	}
+
+	if len(r.Numbers) > maxBatchCompleteNumbers {
+		violations = append(violations, &edpb.BadRequest_FieldViolation{
+			Field:       "numbers",
+			Description: fmt.Sprintf("Numbers must not contain more than %d items", maxBatchCompleteNumbers),
+		})
+	}
+
+	seen := make(map[string]bool, len(r.Numbers))
+	for i, number := range r.Numbers {
+		if number == "" {
+			violations = append(violations, &edpb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("numbers[%d]", i),
+				Description: "Number must not be empty",
+			})
+			continue
+		}
+
+		if seen[number] {
+			violations = append(violations, &edpb.BadRequest_FieldViolation{
+				Field:       fmt.Sprintf("numbers[%d]", i),
+				Description: "Number must not be duplicated",
+			})
+		}
+		seen[number] = true
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcstatus.New(
+			codes.InvalidArgument,
+			"Batch complete is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edpb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+type CompleteCalculationResult struct {
+	Number  string          `json:"number"`
+	Outcome CompleteOutcome `json:"outcome"`
+}
+
+type BatchCompleteCalculationsResult struct {
+	Results []*CompleteCalculationResult `json:"results"`
+}
+
+// BatchCompleteCalculations completes the calculations of the given numbers in one transaction
+// and reports the outcome for each number, in the order of the request.
+// The calculations are completed as by CompleteCalculation.
+func (s *Service) BatchCompleteCalculations(ctx context.Context, in *BatchCompleteCalculationsReq) (*BatchCompleteCalculationsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "BatchCompleteCalculations"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	calculations, err := listCalculations(ctx, s.db, &CalculationQuery{
+		numbers:   in.Numbers,
+		PageSize:  maxBatchCompleteNumbers,
+		createdBy: claims.ChangeableCreator(auth.RoleApprover),
+	})
+	if err != nil {
+		zlog.Error("failed to list calculations", zap.Error(err))
+		return nil, err
+	}
+
+	byNumber := make(map[string]*Calculation, len(calculations))
+	for _, c := range calculations {
+		byNumber[c.Number] = c
+	}
+
+	result := &BatchCompleteCalculationsResult{
+		Results: make([]*CompleteCalculationResult, 0, len(in.Numbers)),
+	}
+	completed := make([]*Calculation, 0, len(calculations))
+	for _, number := range in.Numbers {
+		outcome := CompleteOutcomeCompleted
+		c, ok := byNumber[number]
+		switch {
+		case !ok:
+			outcome = CompleteOutcomeNotFound
+		case c.IsCompleted():
+			outcome = CompleteOutcomeAlreadyCompleted
+		default:
+			c.Complete(claims.Username)
+			completed = append(completed, c)
+		}
+
+		result.Results = append(result.Results, &CompleteCalculationResult{
+			Number:  number,
+			Outcome: outcome,
+		})
+	}
+
+	if err := completeCalculations(ctx, s.db, completed); err != nil {
+		zlog.Error("failed to complete calculations", zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// completeCalculations saves the status of the completed calculations in one transaction.
+func completeCalculations(ctx context.Context, db *sql.DB, calculations []*Calculation) error {
+	if len(calculations) == 0 {
+		return nil
+	}
+
+	defer database.TimeQuery("selfemployed.completeCalculations")()
+
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for _, c := range calculations {
+			q, args := sq.Update("self_employed_analysis").
+				Set("status", types.StatusCompleted.String()).
+				Set("updated_by", c.UpdatedBy).
+				Set("updated_at", c.UpdatedAt).
+				Where(sq.Eq{
+					"number": c.Number,
+				}).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+				return fmt.Errorf("failed to complete calculation %s: %w", c.Number, err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,102 @@
+package selfemployed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+func calculationRow(id int64, number, status string) []any {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+	return []any{
+		id, number, "statement.xlsx", "BT-1", "Retail", "SA", "LAK", "0100001",
+		"Somchai", "3", startedAt, endedAt, "1", "50",
+		false, false, "0", "0",
+		"0", "0", []byte(`{}`), status, "user@example.com", endedAt,
+		"user@example.com", endedAt,
+	}
+}
+
+func TestBatchCompleteCalculationsReqValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		numbers  []string
+		wantCode codes.Code
+	}{
+		{name: "numbers", numbers: []string{"APP-1", "APP-2"}},
+		{name: "no number", numbers: nil, wantCode: codes.InvalidArgument},
+		{name: "empty number", numbers: []string{"APP-1", ""}, wantCode: codes.InvalidArgument},
+		{name: "duplicated number", numbers: []string{"APP-1", "APP-1"}, wantCode: codes.InvalidArgument},
+		{name: "too many numbers", numbers: make([]string, maxBatchCompleteNumbers+1), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &BatchCompleteCalculationsReq{Numbers: tt.numbers}
+			if got := rpcstatus.Code(req.Validate()); got != tt.wantCode {
+				t.Errorf("Validate() code = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestBatchCompleteCalculationsMixedOutcomes(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	list := mock.ExpectQuery(`FROM self_employed_analysis AS s LEFT JOIN business_type AS b ON s.business_type_id = b.id WHERE \(number IN \(@p1,@p2,@p3\)\)`).
+		WillReturnRows(calculationColumns,
+			calculationRow(2, "APP-2", "COMPLETED"),
+			calculationRow(1, "APP-1", "PENDING"),
+		)
+	update := mock.ExpectExec(`UPDATE self_employed_analysis SET status = @p1, updated_by = @p2, updated_at = @p3 WHERE number = @p4`)
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "approver@example.com", Role: auth.RoleApprover})
+	result, err := s.BatchCompleteCalculations(ctx, &BatchCompleteCalculationsReq{Numbers: []string{"APP-1", "APP-2", "APP-3"}})
+	if err != nil {
+		t.Fatalf("BatchCompleteCalculations() error = %v", err)
+	}
+
+	if createdByArg(list.Args()) != "" {
+		t.Errorf("query args = %v, want the approver to complete the calculations of every user", list.Args())
+	}
+
+	want := []CompleteOutcome{CompleteOutcomeCompleted, CompleteOutcomeAlreadyCompleted, CompleteOutcomeNotFound}
+	if len(result.Results) != len(want) {
+		t.Fatalf("results = %d, want %d", len(result.Results), len(want))
+	}
+	for i, number := range []string{"APP-1", "APP-2", "APP-3"} {
+		if r := result.Results[i]; r.Number != number || r.Outcome != want[i] {
+			t.Errorf("result %d = %s %s, want %s %s", i, r.Number, r.Outcome, number, want[i])
+		}
+	}
+
+	// Only the pending calculation is updated, in one transaction.
+	if args := update.Args(); len(args) != 4 || args[0] != "COMPLETED" || args[1] != "approver@example.com" || args[3] != "APP-1" {
+		t.Errorf("update args = %v, want APP-1 completed by the approver", args)
+	}
+	if got := mock.Commits(); got != 1 {
+		t.Errorf("commits = %d, want 1", got)
+	}
+}
+
+func TestBatchCompleteCalculationsNothingToComplete(t *testing.T) {
+	s, mock := newCalculateTestService(t)
+	// No update and no transaction are expected, the calculation is already completed.
+	mock.ExpectQuery(`FROM self_employed_analysis`).WillReturnRows(calculationColumns, calculationRow(1, "APP-1", "COMPLETED"))
+
+	ctx := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "approver@example.com", Role: auth.RoleApprover})
+	result, err := s.BatchCompleteCalculations(ctx, &BatchCompleteCalculationsReq{Numbers: []string{"APP-1"}})
+	if err != nil {
+		t.Fatalf("BatchCompleteCalculations() error = %v", err)
+	}
+	if len(result.Results) != 1 || result.Results[0].Outcome != CompleteOutcomeAlreadyCompleted {
+		t.Errorf("results = %+v, want APP-1 already completed", result.Results)
+	}
+	if got := mock.Commits(); got != 0 {
+		t.Errorf("commits = %d, want 0", got)
+	}
+}
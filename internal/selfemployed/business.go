@@ -12,6 +12,7 @@ import (
 	"github.com/10664kls/automatic-finance-api/internal/gen"
 	"github.com/10664kls/automatic-finance-api/internal/pager"
 	sq "github.com/Masterminds/squirrel"
+	"github.com/biter777/countries"
 	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
 
 	"github.com/shopspring/decimal"
@@ -27,21 +28,26 @@ type Business struct {
 	Name             string          `json:"name"`
 	Description      string          `json:"description"`
 	MarginPercentage decimal.Decimal `json:"marginPercentage"`
+	DefaultCurrency  string          `json:"defaultCurrency"` // Used when the currency of a statement cannot be resolved.
 	CreatedBy        string          `json:"createdBy"`
 	UpdatedBy        string          `json:"updatedBy"`
 	CreatedAt        time.Time       `json:"createdAt"`
 	UpdatedAt        time.Time       `json:"updatedAt"`
+
+	// UsageCount is the number of calculations of the business, only set when listed with the usage.
+	UsageCount *int64 `json:"usageCount,omitempty"`
 }
 
-func (b *Business) update(by string, name string, description string, marginPercentage decimal.Decimal) {
+func (b *Business) update(by string, name string, description string, marginPercentage decimal.Decimal, defaultCurrency string) {
 	b.Name = name
 	b.Description = description
 	b.MarginPercentage = marginPercentage
+	b.DefaultCurrency = defaultCurrency
 	b.UpdatedBy = by
 	b.UpdatedAt = time.Now()
 }
 
-func newBusiness(by string, name string, description string, marginPercentage decimal.Decimal) *Business {
+func newBusiness(by string, name string, description string, marginPercentage decimal.Decimal, defaultCurrency string) *Business {
 	now := time.Now()
 
 	return &Business{
@@ -49,6 +55,7 @@ func newBusiness(by string, name string, description string, marginPercentage de
 		Name:             name,
 		Description:      description,
 		MarginPercentage: marginPercentage,
+		DefaultCurrency:  defaultCurrency,
 		CreatedBy:        by,
 		UpdatedBy:        by,
 		CreatedAt:        now,
@@ -61,6 +68,7 @@ type BusinessReq struct {
 	Name             string          `json:"name"`
 	Description      string          `json:"description"`
 	MarginPercentage decimal.Decimal `json:"marginPercentage"`
+	DefaultCurrency  string          `json:"defaultCurrency"`
 }
 
 func (r *BusinessReq) Validate() error {
@@ -93,6 +101,21 @@ func (r *BusinessReq) Validate() error {
 		})
 	}
 
+	if !r.MarginPercentage.Equal(r.MarginPercentage.Truncate(MaxMarginPlaces)) {
+		violations = append(violations, &edpb.BadRequest_FieldViolation{
+			Field:       "marginPercentage",
+			Description: fmt.Sprintf("Margin percentage must not have more than %d decimal places", MaxMarginPlaces),
+		})
+	}
+
+	r.DefaultCurrency = strings.ToUpper(strings.TrimSpace(r.DefaultCurrency))
+	if r.DefaultCurrency != "" && !countries.CurrencyCodeByName(r.DefaultCurrency).IsValid() {
+		violations = append(violations, &edpb.BadRequest_FieldViolation{
+			Field:       "defaultCurrency",
+			Description: "Default currency is not valid. The code must be a valid ISO 4217 currency code",
+		})
+	}
+
 	r.Description = html.EscapeString(strings.TrimSpace(r.Description))
 
 	if len(violations) > 0 {
@@ -116,6 +139,9 @@ type BusinessQuery struct {
 	CreatedBefore time.Time `query:"createdBefore"`
 	PageSize      uint64    `query:"pageSize"`
 	PageToken     string    `query:"pageToken"`
+
+	// WithUsage counts the calculations of each business.
+	WithUsage bool `query:"withUsage"`
 }
 
 func (q *BusinessQuery) ToSQL() (string, []any, error) {
@@ -153,6 +179,7 @@ func createBusiness(ctx context.Context, db *sql.DB, in *Business) error {
 			"name",
 			"description",
 			"margin_percentage",
+			"default_currency",
 			"created_by",
 			"updated_by",
 			"created_at",
@@ -163,6 +190,7 @@ func createBusiness(ctx context.Context, db *sql.DB, in *Business) error {
 			in.Name,
 			in.Description,
 			in.MarginPercentage,
+			in.DefaultCurrency,
 			in.CreatedBy,
 			in.UpdatedBy,
 			in.CreatedAt,
@@ -184,6 +212,7 @@ func updateBusiness(ctx context.Context, db *sql.DB, in *Business) error {
 		Set("name", in.Name).
 		Set("description", in.Description).
 		Set("margin_percentage", in.MarginPercentage).
+		Set("default_currency", in.DefaultCurrency).
 		Set("updated_by", in.UpdatedBy).
 		Set("updated_at", in.UpdatedAt).
 		Where(sq.Eq{"id": in.ID}).
@@ -206,16 +235,22 @@ func listBusinesses(ctx context.Context, db *sql.DB, in *BusinessQuery) ([]*Busi
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	q, args := sq.Select(
+	columns := []string{
 		id,
 		"name",
 		"description",
 		"margin_percentage",
+		"default_currency",
 		"created_by",
 		"updated_by",
 		"created_at",
 		"updated_at",
-	).
+	}
+	if in.WithUsage {
+		columns = append(columns, "(SELECT COUNT(*) FROM self_employed_analysis AS s WHERE s.business_type_id = business_type.id) AS usage_count")
+	}
+
+	q, args := sq.Select(columns...).
 		From("business_type").
 		Where(pred, args...).
 		OrderBy("created_at DESC").
@@ -231,16 +266,23 @@ func listBusinesses(ctx context.Context, db *sql.DB, in *BusinessQuery) ([]*Busi
 	businesses := make([]*Business, 0)
 	for rows.Next() {
 		b := new(Business)
-		err := rows.Scan(
+		dest := []any{
 			&b.ID,
 			&b.Name,
 			&b.Description,
 			&b.MarginPercentage,
+			&b.DefaultCurrency,
 			&b.CreatedBy,
 			&b.UpdatedBy,
 			&b.CreatedAt,
 			&b.UpdatedAt,
-		)
+		}
+		if in.WithUsage {
+			b.UsageCount = new(int64)
+			dest = append(dest, b.UsageCount)
+		}
+
+		err := rows.Scan(dest...)
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrBusinessNotFound
 		}
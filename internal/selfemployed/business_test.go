@@ -0,0 +1,68 @@
+package selfemployed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+func TestListBusinessesUsage(t *testing.T) {
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	columns := []string{"id", "name", "description", "margin_percentage", "default_currency", "created_by", "updated_by", "created_at", "updated_at"}
+	row := []any{"BT-1", "Retail", "", "50", "", "admin@example.com", "admin@example.com", now, now}
+
+	t.Run("without usage", func(t *testing.T) {
+		s, mock := newCalculateTestService(t)
+		// The default list does not count the calculations.
+		mock.ExpectQuery(`updated_at FROM business_type`).WillReturnRows(columns, row)
+
+		result, err := s.ListBusinesses(userContext(), &BusinessQuery{})
+		if err != nil {
+			t.Fatalf("ListBusinesses() error = %v", err)
+		}
+		if len(result.Businesses) != 1 || result.Businesses[0].UsageCount != nil {
+			t.Errorf("businesses = %+v, want one without a usage count", result.Businesses)
+		}
+	})
+
+	t.Run("with usage", func(t *testing.T) {
+		s, mock := newCalculateTestService(t)
+		mock.ExpectQuery(`COUNT\(\*\) FROM self_employed_analysis AS s WHERE s.business_type_id = business_type.id\) AS usage_count FROM business_type`).
+			WillReturnRows(append(columns, "usage_count"), append(row, 7))
+
+		result, err := s.ListBusinesses(userContext(), &BusinessQuery{WithUsage: true})
+		if err != nil {
+			t.Fatalf("ListBusinesses() error = %v", err)
+		}
+		if len(result.Businesses) != 1 || result.Businesses[0].UsageCount == nil || *result.Businesses[0].UsageCount != 7 {
+			t.Errorf("businesses = %+v, want one used by 7 calculations", result.Businesses)
+		}
+	})
+}
+
+func TestBusinessReqValidateMarginPercentage(t *testing.T) {
+	tests := []struct {
+		margin   string
+		wantCode codes.Code
+	}{
+		{margin: "0.000001"},
+		{margin: "12.345678"},
+		{margin: "100"},
+		{margin: "0", wantCode: codes.InvalidArgument},
+		{margin: "-0.5", wantCode: codes.InvalidArgument},
+		{margin: "100.000001", wantCode: codes.InvalidArgument},
+		{margin: "12.3456789", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.margin, func(t *testing.T) {
+			req := &BusinessReq{Name: "Retail", MarginPercentage: decimal.RequireFromString(tt.margin)}
+			if got := rpcstatus.Code(req.Validate()); got != tt.wantCode {
+				t.Errorf("Validate() code = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
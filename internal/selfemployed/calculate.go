@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
@@ -27,7 +28,18 @@ import (
 // ErrCalculationNotFound is returned when a calculation is not found in the database.
 var ErrCalculationNotFound = errors.New("calculation not found")
 
-func getCurrencyCodeFromStatementFile(file *statement.StatementFile) (string, error) {
+// ErrStatementTooLarge is returned when a statement file has more rows than the configured limit.
+var ErrStatementTooLarge = errors.New("statement file exceeds the maximum number of rows")
+
+// ErrAccountNumberFormat is returned when the account number of a statement file
+// does not match the configured account number pattern.
+var ErrAccountNumberFormat = errors.New("statement account number does not match the expected format")
+
+// ErrAccountCurrency is returned when the account currency cell of a statement file
+// is blank or does not hold a 3-letter currency code.
+var ErrAccountCurrency = errors.New("statement account currency is not a valid currency code")
+
+func getCurrencyCodeFromStatementFile(file *statement.StatementFile, layout statement.StatementLayout) (string, error) {
 	f, err := excelize.OpenFile(file.Location)
 	if err != nil {
 		return "", fmt.Errorf("failed to open statement file: %w", err)
@@ -36,14 +48,14 @@ func getCurrencyCodeFromStatementFile(file *statement.StatementFile) (string, er
 
 	const sheetName = "Table 1"
 
-	rawAccountCurrency, err := f.GetCellValue(sheetName, "A11")
+	rawAccountCurrency, err := f.GetCellValue(sheetName, layout.AccountCurrency)
 	if err != nil {
-		return "", fmt.Errorf("failed to get account currency from cell A11: %w", err)
+		return "", fmt.Errorf("failed to get account currency from cell %s: %w", layout.AccountCurrency, err)
 	}
 
 	currencyCode := extractAccount(rawAccountCurrency)
 	if len(strings.TrimSpace(currencyCode)) != 3 {
-		return "", fmt.Errorf("no valid income transactions found in the statement file %s", file.Location)
+		return "", fmt.Errorf("%w: %q in cell %s of %s", ErrAccountCurrency, rawAccountCurrency, layout.AccountCurrency, file.Location)
 	}
 
 	return currencyCode, nil
@@ -52,6 +64,10 @@ func getCurrencyCodeFromStatementFile(file *statement.StatementFile) (string, er
 func calculateIncomeFromStatementFile(
 	ctx context.Context,
 	in *CalculateReq,
+	maxRows int,
+	accountNumberPattern *regexp.Regexp,
+	layout statement.StatementLayout,
+	numberFormat statement.NumberFormat,
 ) (*Calculation, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	calculation := newCalculation(claims.Username, in)
@@ -64,38 +80,48 @@ func calculateIncomeFromStatementFile(
 
 	const sheetName = "Table 1"
 
-	rawPeriod, err := f.GetCellValue(sheetName, "A7")
+	rawPeriod, err := f.GetCellValue(sheetName, layout.Period)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get period from cell A7: %w", err)
+		return nil, fmt.Errorf("failed to get period from cell %s: %w", layout.Period, err)
 	}
 
 	from, to := extractPeriod(rawPeriod)
 	calculation.StartedAt = from
 	calculation.EndedAt = to
 
-	rawAccountNumber, err := f.GetCellValue(sheetName, "A9")
+	rawAccountNumber, err := f.GetCellValue(sheetName, layout.AccountNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account number from cell A9: %w", err)
+		return nil, fmt.Errorf("failed to get account number from cell %s: %w", layout.AccountNumber, err)
 	}
 
-	rawAccountDisplayName, err := f.GetCellValue(sheetName, "A10")
+	rawAccountDisplayName, err := f.GetCellValue(sheetName, layout.AccountDisplayName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account display name from cell A10: %w", err)
+		return nil, fmt.Errorf("failed to get account display name from cell %s: %w", layout.AccountDisplayName, err)
 	}
 
-	rawAccountCurrency, err := f.GetCellValue(sheetName, "A11")
+	rawAccountCurrency, err := f.GetCellValue(sheetName, layout.AccountCurrency)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account currency from cell A11: %w", err)
+		return nil, fmt.Errorf("failed to get account currency from cell %s: %w", layout.AccountCurrency, err)
 	}
 
 	calculation.Account.Number = extractAccount(rawAccountNumber)
 	calculation.Account.DisplayName = extractAccount(rawAccountDisplayName)
 	calculation.Account.Currency = extractAccount(rawAccountCurrency)
+	if len(strings.TrimSpace(calculation.Account.Currency)) != 3 && in.currency != nil {
+		calculation.Account.Currency = in.currency.Code // fallback to the business default currency
+	}
+	if len(strings.TrimSpace(calculation.Account.Currency)) != 3 {
+		return nil, fmt.Errorf("%w: %q in cell %s of %s", ErrAccountCurrency, rawAccountCurrency, layout.AccountCurrency, in.file.Location)
+	}
 
-	if len(calculation.Account.Number) == 0 || len(calculation.Account.DisplayName) == 0 || len(strings.TrimSpace(calculation.Account.Currency)) != 3 {
+	if len(calculation.Account.Number) == 0 || len(calculation.Account.DisplayName) == 0 {
 		return nil, fmt.Errorf("no valid income transactions found in the statement file %s", in.file.Location)
 	}
 
+	if accountNumberPattern != nil && !accountNumberPattern.MatchString(calculation.Account.Number) {
+		return nil, fmt.Errorf("%w: %q in %s", ErrAccountNumberFormat, calculation.Account.Number, in.file.Location)
+	}
+
 	rows, err := f.Rows(sheetName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get rows from sheet %s: %w", sheetName, err)
@@ -103,12 +129,20 @@ func calculateIncomeFromStatementFile(
 	defer rows.Close()
 
 	period := countMonth(calculation.StartedAt, calculation.EndedAt)
+	partialMonthStart, partial := statement.PartialFinalMonthStart(calculation.EndedAt)
+	calculation.PartialFinalMonthExcluded = in.excludePartialFinalMonth && partial
 	state := new(stateCal)
-	state.ExchangeRate = in.currency.ExchangeRate
-	state.MarginPercentage = in.business.MarginPercentage
+	state.ExchangeRate = in.exchangeRate
+	state.MarginPercentage, _ = in.marginPercentage()
 	state.PeriodInMonth = period
 
+	rowCount := 0
 	for rows.Next() {
+		rowCount++
+		if rowCount > maxRows {
+			return nil, fmt.Errorf("%w: %s", ErrStatementTooLarge, in.file.Location)
+		}
+
 		row, err := rows.Columns()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get columns from row: %w", err)
@@ -118,8 +152,7 @@ func calculateIncomeFromStatementFile(
 			continue // skip rows with insufficient columns
 		}
 
-		rawAmount := strings.ReplaceAll(row[4], ",", "")
-		incomeAmount, err := decimal.NewFromString(rawAmount)
+		incomeAmount, err := numberFormat.ParseAmount(row[4])
 		if err != nil || incomeAmount.LessThanOrEqual(decimal.Zero) {
 			continue // skip if the amount is not valid
 		}
@@ -136,6 +169,9 @@ func calculateIncomeFromStatementFile(
 		if err != nil {
 			continue // skip if the date is not valid
 		}
+		if calculation.PartialFinalMonthExcluded && !date.Before(partialMonthStart) {
+			continue // skip the transactions of the partial final month
+		}
 
 		transaction := Transaction{
 			Amount:     incomeAmount,
@@ -189,6 +225,7 @@ func (s *stateCal) averageMonthlyIncomeByMargin() decimal.Decimal {
 	return averageMonthly.Mul(percent)
 }
 
+// getMonthlyNetIncome returns the monthly income after margin converted to the base currency.
 func (s *stateCal) getMonthlyNetIncome() decimal.Decimal {
 	if s.PeriodInMonth.IsZero() || s.MarginPercentage.IsZero() {
 		return decimal.Zero
@@ -228,21 +265,26 @@ func (s *stateCal) toMonthlyBreakdown() *MonthlyBreakdown {
 }
 
 type Calculation struct {
-	ID                     int64                `json:"id"`
-	StatementFileName      string               `json:"statementFileName"`
-	Number                 string               `json:"number"`
-	BusinessType           BusinessType         `json:"businessType"`
-	Product                types.ProductType    `json:"product"`
-	Account                Account              `json:"account"`
-	StartedAt              time.Time            `json:"startedAt"`
-	EndedAt                time.Time            `json:"endedAt"`
-	PeriodInMonth          decimal.Decimal      `json:"periodInMonth"`
-	ExchangeRate           decimal.Decimal      `json:"exchangeRate"`
-	MarginPercentage       decimal.Decimal      `json:"marginPercentage"`
+	ID                int64             `json:"id"`
+	StatementFileName string            `json:"statementFileName"`
+	Number            string            `json:"number"`
+	BusinessType      BusinessType      `json:"businessType"`
+	Product           types.ProductType `json:"product"`
+	Account           Account           `json:"account"`
+	StartedAt         time.Time         `json:"startedAt"`
+	EndedAt           time.Time         `json:"endedAt"`
+	PeriodInMonth     decimal.Decimal   `json:"periodInMonth"`
+	ExchangeRate      decimal.Decimal   `json:"exchangeRate"`
+	MarginPercentage  decimal.Decimal   `json:"marginPercentage"`
+	MarginFallback    bool              `json:"marginFallback"` // The business has no margin, the default margin is applied.
+
+	// PartialFinalMonthExcluded is set when the transactions of a partial final month are left out of the totals.
+	PartialFinalMonthExcluded bool `json:"partialFinalMonthExcluded"`
+
 	TotalIncome            decimal.Decimal      `json:"totalIncome"`
 	MonthlyAverageIncome   decimal.Decimal      `json:"monthlyAverageIncome"`
 	MonthlyAverageByMargin decimal.Decimal      `json:"monthlyAverageByMargin"`
-	MonthlyNetIncome       decimal.Decimal      `json:"monthlyNetIncome"` // Monthly net income after margin in LAK.
+	MonthlyNetIncome       decimal.Decimal      `json:"monthlyNetIncome"` // Monthly net income after margin in the base currency.
 	MonthlyBreakdown       *MonthlyBreakdown    `json:"monthlyBreakdown"`
 	Status                 types.AnalysisStatus `json:"status"`
 	CreatedBy              string               `json:"createdBy"`
@@ -364,8 +406,9 @@ type TransactionQuery struct {
 	Month types.MMYYY `json:"month"`
 
 	// These must be set before listing transactions.
-	wordlists []*Wordlist
-	file      *statement.StatementFile
+	wordlists    []*Wordlist
+	file         *statement.StatementFile
+	numberFormat statement.NumberFormat
 }
 
 // Populate sets the fields of the request that are not part of the request but must be set before listing transactions.
@@ -439,8 +482,7 @@ func listIncomeTransactionsFromStatementFile(req *TransactionQuery) ([]*Transact
 			continue // skip if the row has less than 4 columns
 		}
 
-		rawAmount := strings.ReplaceAll(row[4], ",", "")
-		incomeAmount, err := decimal.NewFromString(rawAmount)
+		incomeAmount, err := req.numberFormat.ParseAmount(row[4])
 		if err != nil {
 			continue // skip if the amount is invalid
 		}
@@ -502,8 +544,7 @@ func getIncomeTransactionByBillNumber(req *GetTransactionQuery) (*Transaction, e
 			continue // skip if the row has less than 4 columns
 		}
 
-		rawAmount := strings.ReplaceAll(row[4], ",", "")
-		incomeAmount, err := decimal.NewFromString(rawAmount)
+		incomeAmount, err := req.numberFormat.ParseAmount(row[4])
 		if err != nil {
 			continue // skip if the amount is invalid
 		}
@@ -537,7 +578,8 @@ type GetTransactionQuery struct {
 	BillNumber string `json:"billNumber" param:"billNumber"`
 
 	// These must be set before getting the transaction.
-	file *statement.StatementFile
+	file         *statement.StatementFile
+	numberFormat statement.NumberFormat
 }
 
 // Populate sets the file field of the request that is not part of the request but must be set before getting the transaction.
@@ -578,6 +620,7 @@ func (r *GetTransactionQuery) Validate() error {
 }
 func newCalculation(by string, in *CalculateReq) *Calculation {
 	now := time.Now()
+	margin, fallback := in.marginPercentage()
 
 	return &Calculation{
 		CreatedBy: by,
@@ -588,7 +631,8 @@ func newCalculation(by string, in *CalculateReq) *Calculation {
 			ID:   in.business.ID,
 			Name: in.business.Name,
 		},
-		MarginPercentage:  in.business.MarginPercentage,
+		MarginPercentage:  margin,
+		MarginFallback:    fallback,
 		Product:           in.Product,
 		Number:            in.Number,
 		StatementFileName: in.StatementFileName,
@@ -596,15 +640,22 @@ func newCalculation(by string, in *CalculateReq) *Calculation {
 	}
 }
 
+// countMonth counts the months of a statement from its start to its end, both included,
+// e.g. 01/01 to 31/03 is 3 months. The final month is not counted when the statement
+// ends before its last day, e.g. 01/01 to 15/03 is 2 months, see statement.PartialFinalMonthStart.
 func countMonth(from, to time.Time) decimal.Decimal {
-	if to.Before(from) {
+	if from.IsZero() || to.IsZero() || to.Before(from) {
 		return decimal.Zero
 	}
 
 	yearDiff := to.Year() - from.Year()
 	monthDiff := int(to.Month()) - int(from.Month())
+	months := yearDiff*12 + monthDiff + 1
+	if _, partial := statement.PartialFinalMonthStart(to); partial {
+		months--
+	}
 
-	return decimal.NewFromInt(int64(yearDiff*12 + monthDiff))
+	return decimal.NewFromInt(int64(months))
 }
 
 func extractAccount(raw string) string {
@@ -671,6 +722,28 @@ type CalculateReq struct {
 	business  *Business
 	currency  *currency.Currency
 	wordlists []*Wordlist
+
+	// exchangeRate is the rate of the currency to the base currency, see currency.Service.RateToBase.
+	exchangeRate decimal.Decimal
+
+	// preview does not require the number, the calculation not being saved.
+	preview bool
+
+	// defaultMarginPercentage is the margin applied when the business has none, see Service.SetDefaultMarginPercentage.
+	defaultMarginPercentage decimal.Decimal
+
+	// excludePartialFinalMonth leaves the transactions of a partial final month out of the totals,
+	// see Service.SetExcludePartialFinalMonth.
+	excludePartialFinalMonth bool
+}
+
+// marginPercentage returns the margin of the business, or the default margin
+// when the business has none, reporting whether the default is applied.
+func (r *CalculateReq) marginPercentage() (decimal.Decimal, bool) {
+	if r.business.MarginPercentage.IsZero() && r.defaultMarginPercentage.IsPositive() {
+		return r.defaultMarginPercentage, true
+	}
+	return r.business.MarginPercentage, false
 }
 
 // Populate sets the fields of the request that are not part of the request but must be set before the calculation.
@@ -685,7 +758,7 @@ func (r *CalculateReq) Populate(file *statement.StatementFile, business *Busines
 func (r *CalculateReq) Validate() error {
 	violations := make([]*edpb.BadRequest_FieldViolation, 0)
 
-	if r.Number == "" {
+	if r.Number == "" && !r.preview {
 		violations = append(violations, &edpb.BadRequest_FieldViolation{
 			Field:       "number",
 			Description: "Number must not be empty",
@@ -730,6 +803,9 @@ func (r *CalculateReq) Validate() error {
 type RecalculateReq struct {
 	Number         string             `param:"number"`
 	MonthlyIncomes []MonthlyIncomeReq `json:"monthlyIncomes"`
+
+	// maxMonths is the maximum number of monthly incomes, DefaultMaxRecalculationMonths when zero.
+	maxMonths int
 }
 
 func (r *RecalculateReq) toMonthlyBreakdown() *MonthlyBreakdown {
@@ -769,6 +845,18 @@ func (r *RecalculateReq) Validate() error {
 		})
 	}
 
+	maxMonths := r.maxMonths
+	if maxMonths <= 0 {
+		maxMonths = DefaultMaxRecalculationMonths
+	}
+
+	if len(r.MonthlyIncomes) > maxMonths {
+		violations = append(violations, &edpb.BadRequest_FieldViolation{
+			Field:       "monthlyIncomes",
+			Description: fmt.Sprintf("Monthly incomes must not contain more than %d months", maxMonths),
+		})
+	}
+
 	for i, mi := range r.MonthlyIncomes {
 		if err := validateMonthlyIncome(&mi); err != nil {
 			violations = append(violations, &edpb.BadRequest_FieldViolation{
@@ -870,7 +958,15 @@ func isCalculationExists(ctx context.Context, db *sql.DB, number string) (bool,
 }
 
 func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) error {
-	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+	defer database.TimeQuery("selfemployed.saveCalculationIncome")()
+
+	err := database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		// A new calculation is only inserted, so a number already used is reported by the unique index
+		// instead of overwriting the calculation of the number. The loaded calculations are updated.
+		if in.ID == 0 {
+			return insertCalculationIncome(ctx, tx, in)
+		}
+
 		updatedQuery, args := sq.Update("self_employed_analysis").
 			Set("statement_file_name", in.StatementFileName).
 			Set("business_type_id", in.BusinessType.ID).
@@ -883,6 +979,8 @@ func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) err
 			Set("ended_at", in.EndedAt).
 			Set("exchange_rate", in.ExchangeRate).
 			Set("margin_percentage", in.MarginPercentage).
+			Set("margin_fallback", in.MarginFallback).
+			Set("partial_final_month_excluded", in.PartialFinalMonthExcluded).
 			Set("total_income", in.TotalIncome).
 			Set("monthly_average_income", in.MonthlyAverageIncome).
 			Set("monthly_average_margin", in.MonthlyAverageByMargin).
@@ -910,69 +1008,87 @@ func saveCalculationIncome(ctx context.Context, db *sql.DB, in *Calculation) err
 		}
 
 		if rowsAffected == 0 {
-			insertQuery, args := sq.Insert("self_employed_analysis").
-				Columns(
-					"number",
-					"statement_file_name",
-					"business_type_id",
-					"product",
-					"account_currency",
-					"account_number",
-					"account_display_name",
-					"period_in_month",
-					"started_at",
-					"ended_at",
-					"exchange_rate",
-					"margin_percentage",
-					"total_income",
-					"monthly_average_income",
-					"monthly_average_margin",
-					"monthly_net_income",
-					"source_income",
-					"status",
-					"created_by",
-					"created_at",
-					"updated_by",
-					"updated_at",
-				).
-				Values(
-					in.Number,
-					in.StatementFileName,
-					in.BusinessType.ID,
-					in.Product,
-					in.Account.Currency,
-					in.Account.Number,
-					in.Account.DisplayName,
-					in.PeriodInMonth,
-					in.StartedAt,
-					in.EndedAt,
-					in.ExchangeRate,
-					in.MarginPercentage,
-					in.TotalIncome,
-					in.MonthlyAverageIncome,
-					in.MonthlyAverageByMargin,
-					in.MonthlyNetIncome,
-					in.MonthlyBreakdown.Bytes(),
-					in.Status.String(),
-					in.CreatedBy,
-					in.CreatedAt,
-					in.UpdatedBy,
-					in.UpdatedAt,
-				).
-				Suffix("SELECT SCOPE_IDENTITY()").
-				PlaceholderFormat(sq.AtP).
-				MustSql()
-
-			row := tx.QueryRowContext(ctx, insertQuery, args...)
-			if err := row.Scan(&in.ID); err != nil {
-				return fmt.Errorf("failed to insert calculation: %w", err)
+			if err := insertCalculationIncome(ctx, tx, in); err != nil {
+				return err
 			}
-
-			return nil
 		}
 
 		return nil
 	})
+	if database.IsUniqueViolation(err) {
+		return rpcstatus.New(
+			codes.AlreadyExists,
+			"Calculation with this number already exists. Please use a different number.",
+		).Err()
+	}
+
+	return err
+}
+
+func insertCalculationIncome(ctx context.Context, tx *sql.Tx, in *Calculation) error {
+	insertQuery, args := sq.Insert("self_employed_analysis").
+		Columns(
+			"number",
+			"statement_file_name",
+			"business_type_id",
+			"product",
+			"account_currency",
+			"account_number",
+			"account_display_name",
+			"period_in_month",
+			"started_at",
+			"ended_at",
+			"exchange_rate",
+			"margin_percentage",
+			"margin_fallback",
+			"partial_final_month_excluded",
+			"total_income",
+			"monthly_average_income",
+			"monthly_average_margin",
+			"monthly_net_income",
+			"source_income",
+			"status",
+			"created_by",
+			"created_at",
+			"updated_by",
+			"updated_at",
+		).
+		Values(
+			in.Number,
+			in.StatementFileName,
+			in.BusinessType.ID,
+			in.Product,
+			in.Account.Currency,
+			in.Account.Number,
+			in.Account.DisplayName,
+			in.PeriodInMonth,
+			in.StartedAt,
+			in.EndedAt,
+			in.ExchangeRate,
+			in.MarginPercentage,
+			in.MarginFallback,
+			in.PartialFinalMonthExcluded,
+			in.TotalIncome,
+			in.MonthlyAverageIncome,
+			in.MonthlyAverageByMargin,
+			in.MonthlyNetIncome,
+			in.MonthlyBreakdown.Bytes(),
+			in.Status.String(),
+			in.CreatedBy,
+			in.CreatedAt,
+			in.UpdatedBy,
+			in.UpdatedAt,
+		).
+		Suffix("SELECT SCOPE_IDENTITY()").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	row := tx.QueryRowContext(ctx, insertQuery, args...)
+	if err := row.Scan(&in.ID); err != nil {
+		return fmt.Errorf("failed to insert calculation: %w", err)
+	}
+
+	return nil
 }
 
 type CalculationQuery struct {
@@ -985,6 +1101,41 @@ type CalculationQuery struct {
 	CreatedBefore      time.Time `query:"createdBefore"`
 	PageSize           uint64    `query:"pageSize"`
 	PageToken          string    `query:"pageToken"`
+	OrderBy            string    `query:"orderBy"`
+	OrderDir           string    `query:"orderDir"`
+
+	// Currency keeps the calculations of the accounts in this currency.
+	Currency string `query:"currency"`
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+
+	// numbers keeps the calculations of these numbers.
+	numbers []string
+}
+
+// calculationOrderColumns are the columns the calculations can be ordered by.
+var calculationOrderColumns = map[string]pager.Column{
+	"createdAt":        {Name: "s.created_at", Time: true},
+	"number":           {Name: "number"},
+	"monthlyNetIncome": {Name: "monthly_net_income"},
+}
+
+// order returns the order of the calculations, newest first by default.
+func (q *CalculationQuery) order() (*pager.Order, error) {
+	return pager.ParseOrder(q.OrderBy, q.OrderDir, "createdAt", calculationOrderColumns)
+}
+
+// orderValue returns the value of the calculation kept in the cursor for the given order.
+func (c *Calculation) orderValue(o *pager.Order) string {
+	switch o.By {
+	case "number":
+		return c.Number
+	case "monthlyNetIncome":
+		return c.MonthlyNetIncome.String()
+	}
+
+	return ""
 }
 
 func (q *CalculationQuery) ToSQL() (string, []any, error) {
@@ -998,12 +1149,22 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 	if q.Number != "" {
 		and = append(and, sq.Eq{"number": q.Number})
 	}
+	if len(q.numbers) > 0 {
+		and = append(and, sq.Eq{"number": q.numbers})
+	}
 	if q.AccountDisplayName != "" {
 		and = append(and, sq.Expr("account_display_name LIKE ?", "%"+q.AccountDisplayName+"%"))
 	}
 	if q.BusinessTypeID != "" {
 		and = append(and, sq.Eq{"business_type_id": q.BusinessTypeID})
 	}
+	if q.Currency != "" {
+		and = append(and, sq.Eq{"account_currency": strings.ToUpper(strings.TrimSpace(q.Currency))})
+	}
+
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"s.created_by": q.createdBy})
+	}
 
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"s.created_at": q.CreatedAfter})
@@ -1014,9 +1175,14 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 	}
 
 	if q.PageToken != "" {
+		order, err := q.order()
+		if err != nil {
+			return "", nil, err
+		}
+
 		cursor, err := pager.DecodeCursor(q.PageToken)
 		if err == nil {
-			and = append(and, sq.Lt{"s.created_at": cursor.Time})
+			and = append(and, order.After(cursor, "s.id"))
 		}
 	}
 
@@ -1024,6 +1190,8 @@ func (q *CalculationQuery) ToSQL() (string, []any, error) {
 }
 
 func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("selfemployed.listCalculations")()
+
 	id := fmt.Sprintf("TOP %d s.id", pager.Size(in.PageSize))
 
 	pred, args, err := in.ToSQL()
@@ -1031,6 +1199,11 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		return nil, fmt.Errorf("failed to build query: %w", err)
 	}
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
 	q, args := sq.Select(
 		id,
 		"number",
@@ -1046,6 +1219,8 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		"ended_at",
 		"exchange_rate",
 		"s.margin_percentage",
+		"s.margin_fallback",
+		"s.partial_final_month_excluded",
 		"total_income",
 		"monthly_average_income",
 		"monthly_average_margin",
@@ -1060,7 +1235,7 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 		From("self_employed_analysis AS s").
 		LeftJoin("business_type AS b ON s.business_type_id = b.id").
 		Where(pred, args...).
-		OrderBy("s.created_at DESC").
+		OrderBy(order.OrderBy("s.id")...).
 		PlaceholderFormat(sq.AtP).
 		MustSql()
 
@@ -1089,6 +1264,8 @@ func listCalculations(ctx context.Context, db *sql.DB, in *CalculationQuery) ([]
 			&c.EndedAt,
 			&c.ExchangeRate,
 			&c.MarginPercentage,
+			&c.MarginFallback,
+			&c.PartialFinalMonthExcluded,
 			&c.TotalIncome,
 			&c.MonthlyAverageIncome,
 			&c.MonthlyAverageByMargin,
@@ -1148,7 +1325,17 @@ type BatchGetCalculationsQuery struct {
 	CreatedAfter       time.Time `query:"createdAfter"`
 	CreatedBefore      time.Time `query:"createdBefore"`
 
+	// ResumeID resumes an interrupted export from the calculations with an ID lower than it,
+	// i.e. the next ID returned by the previous export. Zero starts from the newest calculation.
+	ResumeID int64 `query:"nextId"`
+
+	// Limit is the maximum number of calculations read by an export. Zero reads them all.
+	Limit int `query:"limit"`
+
 	nextID int64
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
 }
 
 func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
@@ -1169,6 +1356,10 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 		and = append(and, sq.Eq{"business_type_id": q.BusinessTypeID})
 	}
 
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"s.created_by": q.createdBy})
+	}
+
 	if !q.CreatedAfter.IsZero() {
 		and = append(and, sq.GtOrEq{"s.created_at": q.CreatedAfter})
 	}
@@ -1185,6 +1376,8 @@ func (q *BatchGetCalculationsQuery) ToSQL() (string, []any, error) {
 }
 
 func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID int64, in *BatchGetCalculationsQuery) ([]*Calculation, error) {
+	defer database.TimeQuery("selfemployed.batchGetCalculations")()
+
 	id := fmt.Sprintf("TOP %d s.id", batchSize)
 	in.nextID = nextID
 	pred, args, err := in.ToSQL()
@@ -1207,6 +1400,8 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 		"ended_at",
 		"exchange_rate",
 		"s.margin_percentage",
+		"s.margin_fallback",
+		"s.partial_final_month_excluded",
 		"total_income",
 		"monthly_average_income",
 		"monthly_average_margin",
@@ -1250,6 +1445,8 @@ func batchGetCalculations(ctx context.Context, db *sql.DB, batchSize int, nextID
 			&c.EndedAt,
 			&c.ExchangeRate,
 			&c.MarginPercentage,
+			&c.MarginFallback,
+			&c.PartialFinalMonthExcluded,
 			&c.TotalIncome,
 			&c.MonthlyAverageIncome,
 			&c.MonthlyAverageByMargin,
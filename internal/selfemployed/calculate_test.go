@@ -0,0 +1,50 @@
+package selfemployed
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+func TestSaveCalculationIncomeConcurrentCreate(t *testing.T) {
+	db, mock := dbtest.New(t)
+
+	// Both creations passed the isCalculationExists pre-check,
+	// the fake driver answers the insert of the second one as the unique index on the number would.
+	// It checks the handling of the violation, not the index itself.
+	mock.ExpectQuery(`INSERT INTO self_employed_analysis`).WillReturnRows([]string{"id"}, []any{1})
+	mock.ExpectQuery(`INSERT INTO self_employed_analysis`).WillReturnError(dbtest.SQLError{Number: 2627})
+
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = saveCalculationIncome(context.Background(), db, &Calculation{
+				Number:           "SE-1",
+				MonthlyBreakdown: &MonthlyBreakdown{},
+			})
+		}()
+	}
+	wg.Wait()
+
+	var created, exists int
+	for _, err := range errs {
+		switch rpcstatus.Code(err) {
+		case codes.OK:
+			created++
+		case codes.AlreadyExists:
+			exists++
+		default:
+			t.Errorf("saveCalculationIncome() error = %v", err)
+		}
+	}
+	if created != 1 || exists != 1 {
+		t.Errorf("got %d created and %d already exists, want 1 and 1", created, exists)
+	}
+}
@@ -0,0 +1,100 @@
+package selfemployed
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+)
+
+// CountsByBusinessType is the number of calculations by business type name.
+type CountsByBusinessType map[string]int64
+
+type CountsQuery struct {
+	CreatedAfter  time.Time `query:"createdAfter"`
+	CreatedBefore time.Time `query:"createdBefore"`
+
+	// createdBy restricts the calculations to those created by the user, see auth.Claims.VisibleCreator.
+	createdBy string
+}
+
+func (q *CountsQuery) ToSQL() (string, []any, error) {
+	and := sq.And{}
+	if q.createdBy != "" {
+		and = append(and, sq.Eq{"s.created_by": q.createdBy})
+	}
+	if !q.CreatedAfter.IsZero() {
+		and = append(and, sq.GtOrEq{"s.created_at": q.CreatedAfter})
+	}
+	if !q.CreatedBefore.IsZero() {
+		and = append(and, sq.LtOrEq{"s.created_at": q.CreatedBefore})
+	}
+
+	return and.ToSql()
+}
+
+// CountsByBusinessType counts the calculations of each business type created within the optional date range of the query.
+func (s *Service) CountsByBusinessType(ctx context.Context, in *CountsQuery) (CountsByBusinessType, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "CountsByBusinessType"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	in.createdBy = claims.VisibleCreator()
+	counts, err := countCalculationsByBusinessType(ctx, s.db, in)
+	if err != nil {
+		zlog.Error("failed to count calculations by business type", zap.Error(err))
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+func countCalculationsByBusinessType(ctx context.Context, db *sql.DB, in *CountsQuery) (CountsByBusinessType, error) {
+	defer database.TimeQuery("selfemployed.countCalculationsByBusinessType")()
+
+	pred, args, err := in.ToSQL()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	q, args := sq.Select(
+		"COALESCE(b.name, '')",
+		"COUNT(*)",
+	).
+		From("self_employed_analysis AS s").
+		LeftJoin("business_type AS b ON s.business_type_id = b.id").
+		Where(pred, args...).
+		GroupBy("b.name").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count calculations by business type: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(CountsByBusinessType)
+	for rows.Next() {
+		var name string
+		var count int64
+		if err := rows.Scan(&name, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan count: %w", err)
+		}
+		counts[name] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate counts: %w", err)
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,64 @@
+package selfemployed
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"go.uber.org/zap"
+)
+
+func TestCountsByBusinessType(t *testing.T) {
+	after := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	admin := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		in       *CountsQuery
+		wantSQL  string
+		wantArgs []any
+	}{
+		{
+			name:    "all calculations",
+			ctx:     admin,
+			in:      &CountsQuery{},
+			wantSQL: `FROM self_employed_analysis AS s LEFT JOIN business_type AS b ON s.business_type_id = b.id WHERE \(1=1\) GROUP BY b.name`,
+		},
+		{
+			name:     "own calculations created after a date",
+			ctx:      userContext(),
+			in:       &CountsQuery{CreatedAfter: after},
+			wantSQL:  `WHERE \(s.created_by = @p1 AND s.created_at >= @p2\) GROUP BY b.name`,
+			wantArgs: []any{"user@example.com", after},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock := dbtest.New(t)
+			s := &Service{db: db, zlog: zap.NewNop()}
+			// The calculations of a deleted business type are counted under an empty name.
+			q := mock.ExpectQuery(tt.wantSQL).WillReturnRows([]string{"name", "count"},
+				[]any{"Retail", 4},
+				[]any{"Restaurant", 1},
+				[]any{"", 2},
+			)
+
+			counts, err := s.CountsByBusinessType(tt.ctx, tt.in)
+			if err != nil {
+				t.Fatalf("CountsByBusinessType() error = %v", err)
+			}
+			if want := (CountsByBusinessType{"Retail": 4, "Restaurant": 1, "": 2}); !maps.Equal(counts, want) {
+				t.Errorf("CountsByBusinessType() = %v, want %v", counts, want)
+			}
+			if got := q.Args(); !slices.Equal(got, tt.wantArgs) {
+				t.Errorf("query args = %v, want %v", got, tt.wantArgs)
+			}
+		})
+	}
+}
@@ -3,19 +3,37 @@ package selfemployed
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"fmt"
 
+	"github.com/shopspring/decimal"
 	"github.com/xuri/excelize/v2"
 )
 
-func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
-	f := excelize.NewFile()
-	defer f.Close()
+// formatMarginPercentage rounds the margin percentage half away from zero to the places, e.g. 12.3456 with 2 places is "12.35%".
+func formatMarginPercentage(margin decimal.Decimal, places int32) string {
+	return margin.StringFixed(places) + "%"
+}
+
+// exportBatchSize is the number of calculations read per batch by the exports.
+const exportBatchSize = 500
+
+// exportCalculationsToExcel writes the calculations with a stream writer,
+// so the rows are flushed to a temporary file instead of being kept in memory.
+// The caller must close the returned file. The returned next ID resumes the export
+// when the limit of the query is reached, it is zero once every calculation is exported.
+func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (f *excelize.File, nextID int64, err error) {
+	f = excelize.NewFile()
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
 
 	const sheetName = "Calculation of Self-employed"
 	sheet, err := f.NewSheet(sheetName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create new sheet: %w", err)
+		return nil, 0, fmt.Errorf("failed to create new sheet: %w", err)
 	}
 	f.SetActiveSheet(sheet)
 
@@ -27,7 +45,7 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create style: %w", err)
 	}
 
 	fontStyle, err := f.NewStyle(&excelize.Style{
@@ -36,74 +54,97 @@ func (s *Service) exportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create front style: %w", err)
+		return nil, 0, fmt.Errorf("failed to create front style: %w", err)
+	}
+
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create stream writer: %w", err)
 	}
 
-	f.SetCellValue(sheetName, "A1", "FLAPPL/LO NO")
-	f.SetCellValue(sheetName, "B1", "Product")
-	f.SetCellValue(sheetName, "C1", "Average income/month")
-	f.SetCellValue(sheetName, "D1", "Account Number")
-	f.SetCellValue(sheetName, "E1", "Bank Account Name")
-	f.SetCellValue(sheetName, "F1", "Period Account")
-	f.SetCellValue(sheetName, "G1", "Currency")
-	f.SetCellValue(sheetName, "H1", "Net income amount")
-	f.SetCellValue(sheetName, "I1", "Business Segment")
-	f.SetCellValue(sheetName, "J1", "Margin Rate")
-	f.SetCellStyle(sheetName, "A1", "J1", fontStyle)
+	if err := sw.SetRow("A1", []any{
+		excelize.Cell{StyleID: fontStyle, Value: "FLAPPL/LO NO"},
+		excelize.Cell{StyleID: fontStyle, Value: "Product"},
+		excelize.Cell{StyleID: fontStyle, Value: "Average income/month"},
+		excelize.Cell{StyleID: fontStyle, Value: "Account Number"},
+		excelize.Cell{StyleID: fontStyle, Value: "Bank Account Name"},
+		excelize.Cell{StyleID: fontStyle, Value: "Period Account"},
+		excelize.Cell{StyleID: fontStyle, Value: "Currency"},
+		excelize.Cell{StyleID: fontStyle, Value: "Net income amount"},
+		excelize.Cell{StyleID: fontStyle, Value: "Business Segment"},
+		excelize.Cell{StyleID: fontStyle, Value: "Margin Rate"},
+	}); err != nil {
+		return nil, 0, fmt.Errorf("failed to set header row: %w", err)
+	}
 
 	startRow := 2
-	var nextID int64
+	nextID = in.ResumeID
+	var read int
 	for {
-		calculations, err := batchGetCalculations(ctx, s.db, 500, nextID, in)
+		size := exportBatchSize
+		if in.Limit > 0 {
+			if read >= in.Limit {
+				break // the limit is reached, the export resumes from nextID
+			}
+			size = min(size, in.Limit-read)
+		}
+
+		calculations, err := batchGetCalculations(ctx, s.db, size, nextID, in)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get calculations: %w", err)
+			return nil, 0, fmt.Errorf("failed to get calculations: %w", err)
 		}
 
 		if len(calculations) == 0 {
+			nextID = 0
 			break
 		}
+		read += len(calculations)
+
 		s.mu.Lock()
 		nextID = calculations[len(calculations)-1].ID
 		s.mu.Unlock()
 
-		setCalculationsToExcel(f, sheetName, numberStyle, startRow, calculations)
+		if err := setCalculationsToExcel(sw, numberStyle, startRow, calculations, s.marginDisplayPlaces); err != nil {
+			return nil, 0, fmt.Errorf("failed to set calculations to excel: %w", err)
+		}
+
 		startRow += len(calculations)
 	}
 
-	byt, err := f.WriteToBuffer()
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to buffer: %w", err)
+	if err := sw.Flush(); err != nil {
+		return nil, 0, fmt.Errorf("failed to flush stream writer: %w", err)
 	}
 
-	return byt, nil
+	return f, nextID, nil
 }
 
-func setCalculationsToExcel(f *excelize.File, sheetName string, numberStyle int, startRow int, calculations []*Calculation) {
+func setCalculationsToExcel(sw *excelize.StreamWriter, numberStyle int, startRow int, calculations []*Calculation, marginPlaces int32) error {
 	for i, c := range calculations {
-		rowNumber := startRow + i
-		f.SetCellValue(sheetName, fmt.Sprintf("A%d", rowNumber), c.Number)
-		f.SetCellValue(sheetName, fmt.Sprintf("B%d", rowNumber), c.Product)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("C%d", rowNumber), c.MonthlyAverageIncome.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("C%d", rowNumber), fmt.Sprintf("C%d", rowNumber), numberStyle)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("D%d", rowNumber), c.Account.Number)
-		f.SetCellValue(sheetName, fmt.Sprintf("E%d", rowNumber), c.Account.DisplayName)
-		f.SetCellValue(sheetName, fmt.Sprintf("F%d", rowNumber), c.PeriodInMonth.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("F%d", rowNumber), fmt.Sprintf("F%d", rowNumber), numberStyle)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("G%d", rowNumber), c.Account.Currency)
-
-		f.SetCellValue(sheetName, fmt.Sprintf("H%d", rowNumber), c.MonthlyNetIncome.InexactFloat64())
-		f.SetCellStyle(sheetName, fmt.Sprintf("H%d", rowNumber), fmt.Sprintf("H%d", rowNumber), numberStyle)
+		cell, err := excelize.CoordinatesToCellName(1, startRow+i)
+		if err != nil {
+			return err
+		}
 
-		f.SetCellValue(sheetName, fmt.Sprintf("I%d", rowNumber), c.BusinessType.Name)
-		f.SetCellValue(sheetName, fmt.Sprintf("J%d", rowNumber), fmt.Sprintf("%.2f%%", c.MarginPercentage.InexactFloat64()))
-		f.SetCellStyle(sheetName, fmt.Sprintf("J%d", rowNumber), fmt.Sprintf("J%d", rowNumber), numberStyle)
+		if err := sw.SetRow(cell, []any{
+			c.Number,
+			c.Product.String(),
+			excelize.Cell{StyleID: numberStyle, Value: c.MonthlyAverageIncome.InexactFloat64()},
+			c.Account.Number,
+			c.Account.DisplayName,
+			excelize.Cell{StyleID: numberStyle, Value: c.PeriodInMonth.InexactFloat64()},
+			c.Account.Currency,
+			excelize.Cell{StyleID: numberStyle, Value: c.MonthlyNetIncome.InexactFloat64()},
+			c.BusinessType.Name,
+			excelize.Cell{StyleID: numberStyle, Value: formatMarginPercentage(c.MarginPercentage, marginPlaces)},
+		}); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
-func exportCalculationToExcel(calculation *Calculation) (*bytes.Buffer, error) {
+func exportCalculationToExcel(calculation *Calculation, marginPlaces int32) (*bytes.Buffer, error) {
 	f := excelize.NewFile()
 	defer f.Close()
 
@@ -135,7 +176,7 @@ func exportCalculationToExcel(calculation *Calculation) (*bytes.Buffer, error) {
 
 	f.SetActiveSheet(sheet)
 
-	setSummaryToExcel(f, numberStyle, fontStyle, sheetName, calculation)
+	setSummaryToExcel(f, numberStyle, fontStyle, sheetName, calculation, marginPlaces)
 	if err := setMonthlyIncomeToExcel(f, sheetName, fontStyle, numberStyle, calculation); err != nil {
 		return nil, fmt.Errorf("failed to set monthly income to excel: %w", err)
 	}
@@ -148,7 +189,7 @@ func exportCalculationToExcel(calculation *Calculation) (*bytes.Buffer, error) {
 	return byt, nil
 }
 
-func setSummaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation) {
+func setSummaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName string, calculation *Calculation, marginPlaces int32) {
 	f.MergeCell(sheetName, "B2", "I2")
 	f.SetCellValue(sheetName, "B2", "ໃບວິເຄາະສິນເຊື່ອ (ການປະເມີນລາຍໄດ້ຂອງລູກຄ້າ) - ລາຍໄດ້ເຈົ້າຂອງກິດຈະການ")
 	f.SetCellStyle(sheetName, "B2", "I2", fontStyle)
@@ -210,7 +251,7 @@ func setSummaryToExcel(f *excelize.File, numberStyle, fontStyle int, sheetName s
 	f.MergeCell(sheetName, fmt.Sprintf("D%d", monthlyMarginStartRow), fmt.Sprintf("I%d", monthlyMarginStartRow))
 	f.SetCellStyle(sheetName, fmt.Sprintf("D%d", monthlyMarginStartRow), fmt.Sprintf("I%d", monthlyMarginStartRow), numberStyle)
 
-	f.SetCellValue(sheetName, fmt.Sprintf("J%d", monthlyMarginStartRow), fmt.Sprintf("%.2f%%", calculation.MarginPercentage.InexactFloat64()))
+	f.SetCellValue(sheetName, fmt.Sprintf("J%d", monthlyMarginStartRow), formatMarginPercentage(calculation.MarginPercentage, marginPlaces))
 	f.SetCellStyle(sheetName, fmt.Sprintf("J%d", monthlyMarginStartRow), fmt.Sprintf("J%d", monthlyMarginStartRow), numberStyle)
 
 	exchangeRateRow := monthlyMarginStartRow + 1
@@ -263,6 +304,53 @@ func setMonthlyIncomeToExcel(f *excelize.File, sheetName string, frontStyle, num
 	return nil
 }
 
+// exportMonthlyMatrixToCSV writes the monthly transactions of the calculation as a CSV matrix,
+// like setMonthlyIncomeToExcel: a column per month headed by the month, the transaction amounts
+// below it and the total of the month on the last row. The months with fewer transactions are padded with empty cells.
+func exportMonthlyMatrixToCSV(calculation *Calculation) (*bytes.Buffer, error) {
+	months := make([]MonthlyIncome, 0)
+	if calculation.MonthlyBreakdown != nil {
+		months = calculation.MonthlyBreakdown.MonthlyIncomes
+	}
+
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+
+	header := make([]string, len(months))
+	totals := make([]string, len(months))
+	for i, m := range months {
+		header[i] = m.Month
+		totals[i] = m.Total.String()
+	}
+	if err := w.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	longest := findLongestTransactionsFromMonthly(calculation.MonthlyBreakdown)
+	for row := 0; row < longest; row++ {
+		record := make([]string, len(months))
+		for i, m := range months {
+			if row < len(m.Transactions) {
+				record[i] = m.Transactions[row].Amount.String()
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return nil, fmt.Errorf("failed to write transactions: %w", err)
+		}
+	}
+
+	if err := w.Write(totals); err != nil {
+		return nil, fmt.Errorf("failed to write totals: %w", err)
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to flush csv: %w", err)
+	}
+
+	return buf, nil
+}
+
 func findLongestTransactionsFromMonthly(m *MonthlyBreakdown) int {
 	if m == nil {
 		return 0
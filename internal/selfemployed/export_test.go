@@ -0,0 +1,106 @@
+package selfemployed
+
+import (
+	"encoding/csv"
+	"slices"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestExportMonthlyMatrixToCSV(t *testing.T) {
+	amounts := func(values ...int64) []Transaction {
+		txs := make([]Transaction, len(values))
+		for i, v := range values {
+			txs[i] = Transaction{Amount: decimal.NewFromInt(v)}
+		}
+		return txs
+	}
+
+	calculation := &Calculation{MonthlyBreakdown: &MonthlyBreakdown{MonthlyIncomes: []MonthlyIncome{
+		{Month: "January-2025", Transactions: amounts(100, 200, 300), Total: decimal.NewFromInt(600)},
+		{Month: "February-2025", Transactions: amounts(400), Total: decimal.NewFromInt(400)},
+		{Month: "March-2025", Transactions: amounts(500, 600), Total: decimal.NewFromInt(1100)},
+	}}}
+
+	buf, err := exportMonthlyMatrixToCSV(calculation)
+	if err != nil {
+		t.Fatalf("exportMonthlyMatrixToCSV() error = %v", err)
+	}
+	records, err := csv.NewReader(buf).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to read the csv: %v", err)
+	}
+
+	// The header, the rows of the longest month and the totals, each with a column per month.
+	if len(records) != 5 {
+		t.Fatalf("got %d records, want 5: %v", len(records), records)
+	}
+	for i, r := range records {
+		if len(r) != 3 {
+			t.Errorf("record %d has %d columns, want one per month: %v", i, len(r), r)
+		}
+	}
+
+	want := [][]string{
+		{"January-2025", "February-2025", "March-2025"},
+		{"100", "400", "500"},
+		{"200", "", "600"},
+		{"300", "", ""},
+		{"600", "400", "1100"},
+	}
+	for i, w := range want {
+		if !slices.Equal(records[i], w) {
+			t.Errorf("record %d = %v, want %v", i, records[i], w)
+		}
+	}
+}
+
+func TestFormatMarginPercentage(t *testing.T) {
+	tests := []struct {
+		margin string
+		places int32
+		want   string
+	}{
+		{margin: "12.3456", places: 2, want: "12.35%"},
+		{margin: "12.3449", places: 2, want: "12.34%"},
+		{margin: "12.3456", places: 4, want: "12.3456%"},
+		{margin: "12.5", places: 0, want: "13%"},
+		{margin: "20", places: 2, want: "20.00%"},
+	}
+
+	for _, tt := range tests {
+		margin := decimal.RequireFromString(tt.margin)
+		if got := formatMarginPercentage(margin, tt.places); got != tt.want {
+			t.Errorf("formatMarginPercentage(%s, %d) = %s, want %s", tt.margin, tt.places, got, tt.want)
+		}
+		if !margin.Equal(decimal.RequireFromString(tt.margin)) {
+			t.Errorf("margin = %s after formatting, want the full precision %s", margin, tt.margin)
+		}
+	}
+}
+
+func TestSetMarginDisplayPlaces(t *testing.T) {
+	tests := []struct {
+		places  int32
+		want    int32
+		wantErr bool
+	}{
+		{places: 0, want: 0},
+		{places: 4, want: 4},
+		{places: MaxMarginPlaces, want: MaxMarginPlaces},
+		{places: -1, want: DefaultMarginDisplayPlaces, wantErr: true},
+		{places: MaxMarginPlaces + 1, want: DefaultMarginDisplayPlaces, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		s := &Service{marginDisplayPlaces: DefaultMarginDisplayPlaces}
+		err := s.SetMarginDisplayPlaces(tt.places)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetMarginDisplayPlaces(%d) error = %v, want error %v", tt.places, err, tt.wantErr)
+		}
+		if s.marginDisplayPlaces != tt.want {
+			t.Errorf("SetMarginDisplayPlaces(%d): display places = %d, want %d", tt.places, s.marginDisplayPlaces, tt.want)
+		}
+	}
+}
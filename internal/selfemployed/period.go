@@ -0,0 +1,93 @@
+package selfemployed
+
+import (
+	"context"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+// recomputePeriodsBatchSize is the number of calculations checked per batch by RecomputePeriods.
+const recomputePeriodsBatchSize = 200
+
+type RecomputePeriodsReq struct {
+	// IncludeCompleted also corrects the completed calculations, only pending ones are corrected otherwise.
+	IncludeCompleted bool `json:"includeCompleted"`
+}
+
+type RecomputePeriodsResult struct {
+	Scanned   int64 `json:"scanned"`
+	Corrected int64 `json:"corrected"`
+}
+
+// recomputePeriod sets the period in months and re-derives the averages depending on it.
+func (c *Calculation) recomputePeriod(by string, period decimal.Decimal) {
+	state := c.toStateCal()
+	state.PeriodInMonth = period
+	c.UpdatedAt = time.Now()
+	c.UpdatedBy = by
+	c.populate(state)
+}
+
+// RecomputePeriods corrects the calculations whose period in months no longer matches
+// the one counted from their statement period, e.g. after a change of countMonth,
+// and re-derives their averages. Only admins are allowed to recompute the periods.
+func (s *Service) RecomputePeriods(ctx context.Context, in *RecomputePeriodsReq) (*RecomputePeriodsResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "RecomputePeriods"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcstatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	result := new(RecomputePeriodsResult)
+	q := new(BatchGetCalculationsQuery)
+	var nextID int64
+	for {
+		calculations, err := batchGetCalculations(ctx, s.db, recomputePeriodsBatchSize, nextID, q)
+		if err != nil {
+			zlog.Error("failed to batch get calculations", zap.Error(err))
+			return nil, err
+		}
+		if len(calculations) == 0 {
+			break
+		}
+		nextID = calculations[len(calculations)-1].ID
+
+		for _, c := range calculations {
+			result.Scanned++
+			if c.IsCompleted() && !in.IncludeCompleted {
+				continue
+			}
+
+			period := countMonth(c.StartedAt, c.EndedAt)
+			if period.Equal(c.PeriodInMonth) {
+				continue
+			}
+
+			calculation, err := getCalculation(ctx, s.db, &CalculationQuery{ID: c.ID})
+			if err != nil {
+				zlog.Error("failed to get calculation", zap.Int64("ID", c.ID), zap.Error(err))
+				return nil, err
+			}
+
+			calculation.recomputePeriod(claims.Username, period)
+			if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
+				zlog.Error("failed to save calculation", zap.String("Number", calculation.Number), zap.Error(err))
+				return nil, err
+			}
+			result.Corrected++
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package selfemployed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCountMonth(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     int64
+	}{
+		{name: "full months", from: date(2025, 1, 1), to: date(2025, 3, 31), want: 3},
+		{name: "partial final month", from: date(2025, 1, 1), to: date(2025, 3, 15), want: 2},
+		{name: "across years", from: date(2024, 11, 1), to: date(2025, 4, 30), want: 6},
+		{name: "single month", from: date(2025, 2, 1), to: date(2025, 2, 28), want: 1},
+		{name: "ended before started", from: date(2025, 3, 1), to: date(2025, 1, 31), want: 0},
+		{name: "no period", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countMonth(tt.from, tt.to); got.IntPart() != tt.want {
+				t.Errorf("countMonth() = %s, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculatePartialFinalMonth(t *testing.T) {
+	tests := []struct {
+		name        string
+		exclude     bool
+		wantTotal   int64
+		wantAverage int64
+		wantMonths  int
+	}{
+		{name: "included", wantTotal: 15000000, wantAverage: 7500000, wantMonths: 3},
+		{name: "excluded", exclude: true, wantTotal: 10000000, wantAverage: 5000000, wantMonths: 2},
+	}
+
+	file := writeStatement(t, "01/01/2025 ຫາ 15/03/2025", "LAK",
+		sale("10/01/2025", 5000000),
+		sale("10/02/2025", 5000000),
+		sale("10/03/2025", 5000000),
+	)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetExcludePartialFinalMonth(tt.exclude)
+			expectStatement(mock, file, newTestBusiness(50))
+			expectCurrency(mock, "LAK", "1")
+
+			calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if err != nil {
+				t.Fatalf("PreviewCalculation() error = %v", err)
+			}
+
+			// The period never counts the partial final month, whether its transactions are excluded or not.
+			if !calculation.PeriodInMonth.Equal(decimal.NewFromInt(2)) {
+				t.Errorf("period = %s, want 2", calculation.PeriodInMonth)
+			}
+			if !calculation.TotalIncome.Equal(decimal.NewFromInt(tt.wantTotal)) {
+				t.Errorf("total income = %s, want %d", calculation.TotalIncome, tt.wantTotal)
+			}
+			if !calculation.MonthlyAverageIncome.Equal(decimal.NewFromInt(tt.wantAverage)) {
+				t.Errorf("monthly average income = %s, want %d", calculation.MonthlyAverageIncome, tt.wantAverage)
+			}
+			if got := len(calculation.MonthlyBreakdown.MonthlyIncomes); got != tt.wantMonths {
+				t.Errorf("months = %d, want %d", got, tt.wantMonths)
+			}
+			if calculation.PartialFinalMonthExcluded != tt.exclude {
+				t.Errorf("partial final month excluded = %v, want %v", calculation.PartialFinalMonthExcluded, tt.exclude)
+			}
+		})
+	}
+}
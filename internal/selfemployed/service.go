@@ -5,6 +5,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
 	"strconv"
 	"sync"
 
@@ -12,18 +14,55 @@ import (
 	"github.com/10664kls/automatic-finance-api/internal/currency"
 	"github.com/10664kls/automatic-finance-api/internal/pager"
 	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
 	"go.uber.org/zap"
 	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	rpcstatus "google.golang.org/grpc/status"
 )
 
+// DefaultMaxStatementRows is the maximum number of rows parsed from a statement file
+// when no other limit is configured.
+const DefaultMaxStatementRows = 20000
+
+// DefaultMaxRecalculationMonths is the maximum number of months accepted in a recalculation
+// when no other limit is configured.
+const DefaultMaxRecalculationMonths = 60
+
+// DefaultMarginDisplayPlaces is the number of decimal places of the margin percentages in the exports
+// when no other precision is configured.
+const DefaultMarginDisplayPlaces = 2
+
+// MaxMarginPlaces is the number of decimal places a margin percentage is stored with.
+const MaxMarginPlaces = 6
+
 type Service struct {
-	db        *sql.DB
-	statement *statement.Service
-	currency  *currency.Service
-	mu        *sync.Mutex
-	zlog      *zap.Logger
+	db               *sql.DB
+	statement        *statement.Service
+	currency         *currency.Service
+	mu               *sync.Mutex
+	zlog             *zap.Logger
+	maxStatementRows int
+	defaultProduct   types.ProductType
+
+	// maxRecalculationMonths is the maximum number of months accepted in a recalculation.
+	maxRecalculationMonths int
+
+	// accountNumberPattern is the format the account number of a statement must match.
+	// Nil accepts any account number.
+	accountNumberPattern *regexp.Regexp
+
+	// defaultMarginPercentage is the margin applied to the businesses without margin. Zero applies none.
+	defaultMarginPercentage decimal.Decimal
+
+	// excludePartialFinalMonth leaves the transactions of a partial final month out of the totals,
+	// see SetExcludePartialFinalMonth.
+	excludePartialFinalMonth bool
+
+	// marginDisplayPlaces is the number of decimal places of the margin percentages in the exports.
+	marginDisplayPlaces int32
 }
 
 func NewService(_ context.Context, db *sql.DB, statement *statement.Service, currency *currency.Service, zlog *zap.Logger) (*Service, error) {
@@ -41,14 +80,71 @@ func NewService(_ context.Context, db *sql.DB, statement *statement.Service, cur
 	}
 
 	return &Service{
-		db:        db,
-		statement: statement,
-		currency:  currency,
-		zlog:      zlog,
-		mu:        new(sync.Mutex),
+		db:                     db,
+		statement:              statement,
+		currency:               currency,
+		zlog:                   zlog,
+		mu:                     new(sync.Mutex),
+		maxStatementRows:       DefaultMaxStatementRows,
+		maxRecalculationMonths: DefaultMaxRecalculationMonths,
+		marginDisplayPlaces:    DefaultMarginDisplayPlaces,
 	}, nil
 }
 
+// SetMaxStatementRows sets the maximum number of rows parsed from a statement file.
+// A value less than or equal to zero resets the limit to DefaultMaxStatementRows.
+func (s *Service) SetMaxStatementRows(n int) {
+	if n <= 0 {
+		n = DefaultMaxStatementRows
+	}
+	s.maxStatementRows = n
+}
+
+// SetMaxRecalculationMonths sets the maximum number of months accepted in a recalculation.
+// A value less than or equal to zero resets the limit to DefaultMaxRecalculationMonths.
+func (s *Service) SetMaxRecalculationMonths(n int) {
+	if n <= 0 {
+		n = DefaultMaxRecalculationMonths
+	}
+	s.maxRecalculationMonths = n
+}
+
+// SetDefaultProduct sets the product used by CalculateIncome when the request does not specify one.
+// ProductUnSpecified disables the default, so the product must be given.
+func (s *Service) SetDefaultProduct(p types.ProductType) {
+	s.defaultProduct = p
+}
+
+// SetAccountNumberPattern sets the format the account number of a statement file must match.
+// Nil accepts any account number.
+func (s *Service) SetAccountNumberPattern(pattern *regexp.Regexp) {
+	s.accountNumberPattern = pattern
+}
+
+// SetDefaultMarginPercentage sets the margin applied to the calculations of a business without margin,
+// e.g. a business misconfigured before the margin was required. The calculations are flagged with MarginFallback.
+// A value less than or equal to zero applies none, so the net income of such a business is zero.
+func (s *Service) SetDefaultMarginPercentage(percentage decimal.Decimal) {
+	s.defaultMarginPercentage = percentage
+}
+
+// SetExcludePartialFinalMonth sets whether the transactions of the final month are left out
+// of the totals when the statement ends before the last day of that month, e.g. on 15/03.
+// The period in months already leaves the partial final month out of the divisor. It is off by default.
+func (s *Service) SetExcludePartialFinalMonth(exclude bool) {
+	s.excludePartialFinalMonth = exclude
+}
+
+// SetMarginDisplayPlaces sets the number of decimal places the margin percentages are rounded to in the exports.
+// The stored margin keeps its full precision.
+func (s *Service) SetMarginDisplayPlaces(places int32) error {
+	if places < 0 || places > MaxMarginPlaces {
+		return fmt.Errorf("margin display places must be between 0 and %d", MaxMarginPlaces)
+	}
+	s.marginDisplayPlaces = places
+	return nil
+}
+
 type ListBusinessesResult struct {
 	Businesses    []*Business `json:"businesses"`
 	NextPageToken string      `json:"nextPageToken"`
@@ -127,7 +223,11 @@ func (s *Service) CreateBusiness(ctx context.Context, in *BusinessReq) (*Busines
 		return nil, rpcstatus.Error(codes.AlreadyExists, "The business with this name already exists")
 	}
 
-	business := newBusiness(claims.Username, in.Name, in.Description, in.MarginPercentage)
+	if err := s.validateDefaultCurrency(ctx, in.DefaultCurrency); err != nil {
+		return nil, err
+	}
+
+	business := newBusiness(claims.Username, in.Name, in.Description, in.MarginPercentage, in.DefaultCurrency)
 	if err := createBusiness(ctx, s.db, business); err != nil {
 		zlog.Error("failed to create business", zap.Error(err))
 		return nil, err
@@ -167,7 +267,11 @@ func (s *Service) UpdateBusiness(ctx context.Context, in *BusinessReq) (*Busines
 		return nil, rpcstatus.Error(codes.AlreadyExists, "The business with this name already exists")
 	}
 
-	business.update(claims.Username, in.Name, in.Description, in.MarginPercentage)
+	if err := s.validateDefaultCurrency(ctx, in.DefaultCurrency); err != nil {
+		return nil, err
+	}
+
+	business.update(claims.Username, in.Name, in.Description, in.MarginPercentage, in.DefaultCurrency)
 	if err := updateBusiness(ctx, s.db, business); err != nil {
 		zlog.Error("failed to update business", zap.Error(err))
 		return nil, err
@@ -176,6 +280,33 @@ func (s *Service) UpdateBusiness(ctx context.Context, in *BusinessReq) (*Busines
 	return business, nil
 }
 
+// validateDefaultCurrency checks that the default currency of a business is
+// a currency known to the system. An empty code is valid.
+func (s *Service) validateDefaultCurrency(ctx context.Context, code string) error {
+	if code == "" {
+		return nil
+	}
+
+	_, err := s.currency.GetCurrencyByCode(ctx, code)
+	if st, ok := rpcstatus.FromError(err); ok && st.Code() == codes.PermissionDenied {
+		s, _ := rpcstatus.New(
+			codes.InvalidArgument,
+			"Business is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edpb.BadRequest{
+			FieldViolations: []*edpb.BadRequest_FieldViolation{
+				{
+					Field:       "defaultCurrency",
+					Description: "Default currency must be a currency that exists in the system",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return err
+}
+
 func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calculation, error) {
 	claims := auth.ClaimsFromContext(ctx)
 
@@ -185,6 +316,10 @@ func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calc
 		zap.String("username", claims.Username),
 	)
 
+	if req.Product == types.ProductUnSpecified {
+		req.Product = s.defaultProduct
+	}
+
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
@@ -198,6 +333,45 @@ func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calc
 		return nil, rpcstatus.Error(codes.AlreadyExists, "Calculation with this number already exists. Please use a different number.")
 	}
 
+	calculation, err := s.calculate(ctx, zlog, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
+		zlog.Error("failed to save calculation", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
+// PreviewCalculation calculates the income from the statement file of the request without saving it,
+// so the figures can be reviewed before the calculation is created. The number is not required.
+func (s *Service) PreviewCalculation(ctx context.Context, req *CalculateReq) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("method", "PreviewCalculation"),
+		zap.Any("req", req),
+		zap.String("username", claims.Username),
+	)
+
+	if req.Product == types.ProductUnSpecified {
+		req.Product = s.defaultProduct
+	}
+
+	req.preview = true
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s.calculate(ctx, zlog, req)
+}
+
+// calculate resolves the statement file, business and currency of the request
+// and calculates the income from the statement file.
+func (s *Service) calculate(ctx context.Context, zlog *zap.Logger, req *CalculateReq) (*Calculation, error) {
 	file, err := s.statement.GetStatementByName(ctx, req.StatementFileName)
 	if st, ok := rpcstatus.FromError(err); ok && st.Code() == codes.PermissionDenied {
 		s, _ := rpcstatus.New(
@@ -217,6 +391,9 @@ func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calc
 	if err != nil {
 		return nil, err
 	}
+	if err := s.statement.CheckHeader(file); err != nil {
+		return nil, err
+	}
 
 	business, err := s.GetBusinessByID(ctx, req.BusinessID)
 	if st, ok := rpcstatus.FromError(err); ok && st.Code() == codes.PermissionDenied {
@@ -244,7 +421,18 @@ func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calc
 		return nil, err
 	}
 
-	currencyCode, err := getCurrencyCodeFromStatementFile(file)
+	currencyCode, err := getCurrencyCodeFromStatementFile(file, s.statement.Layout())
+	if err != nil && business.DefaultCurrency != "" {
+		zlog.Info("statement currency is unresolved, using business default currency",
+			zap.String("defaultCurrency", business.DefaultCurrency),
+			zap.Error(err),
+		)
+		currencyCode, err = business.DefaultCurrency, nil
+	}
+	if errors.Is(err, ErrAccountCurrency) {
+		zlog.Warn("statement account currency is not valid", zap.Error(err))
+		return nil, accountCurrencyError(s.statement.Layout())
+	}
 	if err != nil {
 		s, _ := rpcstatus.New(
 			codes.InvalidArgument,
@@ -283,14 +471,40 @@ func (s *Service) CalculateIncome(ctx context.Context, req *CalculateReq) (*Calc
 	}
 
 	req.Populate(file, business, currency, wordlists)
-	calculation, err := calculateIncomeFromStatementFile(ctx, req)
-	if err != nil {
-		zlog.Error("failed to calculate income from statement file", zap.Error(err))
-		return nil, err
+	req.exchangeRate = s.currency.RateToBase(currency)
+	req.defaultMarginPercentage = s.defaultMarginPercentage
+	req.excludePartialFinalMonth = s.excludePartialFinalMonth
+	calculation, err := calculateIncomeFromStatementFile(ctx, req, s.maxStatementRows, s.accountNumberPattern, s.statement.Layout(), s.statement.NumberFormat())
+	if errors.Is(err, ErrStatementTooLarge) {
+		zlog.Warn("statement file exceeds the maximum number of rows", zap.Error(err))
+		return nil, rpcstatus.Errorf(
+			codes.InvalidArgument,
+			"The statement file is too large. It must not contain more than %d rows.",
+			s.maxStatementRows,
+		)
 	}
+	if errors.Is(err, ErrAccountNumberFormat) {
+		zlog.Warn("statement account number does not match the expected format", zap.Error(err))
+		s, _ := rpcstatus.New(
+			codes.InvalidArgument,
+			"The statement file is not valid. Please check your statement file and try again, see details for more information.",
+		).WithDetails(&edpb.BadRequest{
+			FieldViolations: []*edpb.BadRequest_FieldViolation{
+				{
+					Field:       "statementFileName",
+					Description: fmt.Sprintf("Account number of the statement must match the format %s", s.accountNumberPattern),
+				},
+			},
+		})
 
-	if err := saveCalculationIncome(ctx, s.db, calculation); err != nil {
-		zlog.Error("failed to save calculation", zap.Error(err))
+		return nil, s.Err()
+	}
+	if errors.Is(err, ErrAccountCurrency) {
+		zlog.Warn("statement account currency is not valid", zap.Error(err))
+		return nil, accountCurrencyError(s.statement.Layout())
+	}
+	if err != nil {
+		zlog.Error("failed to calculate income from statement file", zap.Error(err))
 		return nil, err
 	}
 
@@ -307,10 +521,11 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcstatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
+		return nil, rpcstatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
@@ -320,6 +535,32 @@ func (s *Service) GetCalculationByNumber(ctx context.Context, number string) (*C
 	return calculation, nil
 }
 
+// GetCalculationByID returns the calculation of the given internal ID,
+// e.g. as referenced by the audit log.
+func (s *Service) GetCalculationByID(ctx context.Context, id int64) (*Calculation, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetCalculationByID"),
+		zap.String("Username", claims.Username),
+		zap.Int64("ID", id),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		ID:        id,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcstatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by id", zap.Error(err))
+		return nil, err
+	}
+
+	return calculation, nil
+}
+
 type ListCalculationsResult struct {
 	Calculations  []*Calculation `json:"calculations"`
 	NextPageToken string         `json:"nextPageToken"`
@@ -334,6 +575,12 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 		zap.Any("req", in),
 	)
 
+	order, err := in.order()
+	if err != nil {
+		return nil, err
+	}
+
+	in.createdBy = claims.VisibleCreator()
 	calculations, err := listCalculations(ctx, s.db, in)
 	if err != nil {
 		zlog.Error("failed to list calculations", zap.Error(err))
@@ -344,8 +591,9 @@ func (s *Service) ListCalculations(ctx context.Context, in *CalculationQuery) (*
 	if l := len(calculations); l > 0 && l == int(pager.Size(in.PageSize)) {
 		last := calculations[l-1]
 		pageToken = pager.EncodeCursor(&pager.Cursor{
-			ID:   strconv.FormatInt(last.ID, 10),
-			Time: last.CreatedAt,
+			ID:    strconv.FormatInt(last.ID, 10),
+			Time:  last.CreatedAt,
+			Value: last.orderValue(order),
 		})
 	}
 
@@ -365,7 +613,8 @@ func (s *Service) CompleteCalculation(ctx context.Context, number string) (*Calc
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.ChangeableCreator(auth.RoleApprover),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
 		return nil, rpcstatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
@@ -397,12 +646,14 @@ func (s *Service) ReCalculateIncome(ctx context.Context, req *RecalculateReq) (*
 		zap.Any("req", req),
 	)
 
+	req.maxMonths = s.maxRecalculationMonths
 	if err := req.Validate(); err != nil {
 		return nil, err
 	}
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: req.Number,
+		Number:    req.Number,
+		createdBy: claims.ChangeableCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
 		return nil, rpcstatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
@@ -459,6 +710,7 @@ func (s *Service) ListIncomeTransactionsByNumber(ctx context.Context, req *Trans
 	}
 
 	req.Populate(file, wordlists)
+	req.numberFormat = s.statement.NumberFormat()
 	transactions, err := listIncomeTransactionsFromStatementFile(req)
 	if err != nil {
 		zlog.Error("failed to list transactions", zap.Error(err))
@@ -494,6 +746,7 @@ func (s *Service) GetIncomeTransactionByBillNumber(ctx context.Context, req *Get
 	}
 
 	req.Populate(file)
+	req.numberFormat = s.statement.NumberFormat()
 	transaction, err := getIncomeTransactionByBillNumber(req)
 	if err != nil {
 		zlog.Error("failed to get transaction", zap.Error(err))
@@ -626,7 +879,10 @@ func (s *Service) UpdateWordlist(ctx context.Context, req *WordlistReq) (*Wordli
 	return wordlist, nil
 }
 
-func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*bytes.Buffer, error) {
+// ExportCalculationsToExcel returns the workbook of the calculations matching the query.
+// The caller must close the returned file once it has been written.
+// An export reading Limit calculations returns the next ID to resume it from, zero once it is complete.
+func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCalculationsQuery) (*excelize.File, int64, error) {
 	claims := auth.ClaimsFromContext(ctx)
 	zlog := s.zlog.With(
 		zap.String("Service", "selfemployed"),
@@ -635,13 +891,46 @@ func (s *Service) ExportCalculationsToExcel(ctx context.Context, in *BatchGetCal
 		zap.Any("req", in),
 	)
 
-	byt, err := s.exportCalculationsToExcel(ctx, in)
+	in.createdBy = claims.VisibleCreator()
+	f, nextID, err := s.exportCalculationsToExcel(ctx, in)
 	if err != nil {
 		zlog.Error("failed to export calculations to excel", zap.Error(err))
+		return nil, 0, err
+	}
+
+	return f, nextID, nil
+}
+
+// ExportMonthlyMatrixToCSV exports the monthly transactions of the calculation of the given number
+// as a CSV matrix with a column per month.
+func (s *Service) ExportMonthlyMatrixToCSV(ctx context.Context, number string) (*bytes.Buffer, error) {
+	claims := auth.ClaimsFromContext(ctx)
+	zlog := s.zlog.With(
+		zap.String("Service", "selfemployed"),
+		zap.String("Method", "ExportMonthlyMatrixToCSV"),
+		zap.String("Username", claims.Username),
+		zap.String("Number", number),
+	)
+
+	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
+	})
+	if errors.Is(err, ErrCalculationNotFound) {
+		return nil, rpcstatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
+	}
+	if err != nil {
+		zlog.Error("failed to get calculation by number", zap.Error(err))
+		return nil, err
+	}
+
+	buf, err := exportMonthlyMatrixToCSV(calculation)
+	if err != nil {
+		zlog.Error("failed to export monthly matrix to csv", zap.Error(err))
 		return nil, err
 	}
 
-	return byt, nil
+	return buf, nil
 }
 
 func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number string) (*bytes.Buffer, error) {
@@ -654,17 +943,18 @@ func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number s
 	)
 
 	calculation, err := getCalculation(ctx, s.db, &CalculationQuery{
-		Number: number,
+		Number:    number,
+		createdBy: claims.VisibleCreator(),
 	})
 	if errors.Is(err, ErrCalculationNotFound) {
-		return nil, rpcstatus.Error(codes.PermissionDenied, "You are not allowed to this calculation or (it may not exist)")
+		return nil, rpcstatus.Error(codes.NotFound, "Calculation not found or you are not allowed to view it")
 	}
 	if err != nil {
 		zlog.Error("failed to get calculation by number", zap.Error(err))
 		return nil, err
 	}
 
-	buf, err := exportCalculationToExcel(calculation)
+	buf, err := exportCalculationToExcel(calculation, s.marginDisplayPlaces)
 	if err != nil {
 		zlog.Error("failed to export calculation to excel", zap.Error(err))
 		return nil, err
@@ -672,3 +962,21 @@ func (s *Service) ExportCalculationToExcelByNumber(ctx context.Context, number s
 
 	return buf, nil
 }
+
+// accountCurrencyError returns the error of a statement file whose account currency cell
+// does not hold a currency code, naming the cell so it is not mistaken for a statement without transactions.
+func accountCurrencyError(layout statement.StatementLayout) error {
+	s, _ := rpcstatus.New(
+		codes.InvalidArgument,
+		"The statement file is not valid. Please check your statement file and try again, see details for more information.",
+	).WithDetails(&edpb.BadRequest{
+		FieldViolations: []*edpb.BadRequest_FieldViolation{
+			{
+				Field:       "statementFileName",
+				Description: fmt.Sprintf("Account currency in cell %s of the statement must be a 3-letter currency code", layout.AccountCurrency),
+			},
+		},
+	})
+
+	return s.Err()
+}
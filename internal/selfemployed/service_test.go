@@ -0,0 +1,447 @@
+package selfemployed
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	edpb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcstatus "google.golang.org/grpc/status"
+)
+
+func TestPreviewCalculationRowCap(t *testing.T) {
+	rows := make([][]any, 0, 12)
+	for day := 1; day <= 12; day++ {
+		rows = append(rows, sale(fmt.Sprintf("%02d/01/2025", day), 100000))
+	}
+	// The 12 transactions are below the header cells and the header row, on the rows 14 to 25.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", rows...)
+
+	tests := []struct {
+		name     string
+		maxRows  int
+		wantCode codes.Code
+	}{
+		{name: "within the cap", maxRows: 25, wantCode: codes.OK},
+		{name: "exceeding the cap", maxRows: 24, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetMaxStatementRows(tt.maxRows)
+			expectStatement(mock, file, newTestBusiness(50))
+			expectCurrency(mock, "LAK", "1")
+
+			_, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("PreviewCalculation() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestPreviewCalculationDefaultCurrency(t *testing.T) {
+	tests := []struct {
+		name            string
+		statementCode   string
+		defaultCurrency string
+		wantCurrency    string
+		wantRate        string
+		wantCode        codes.Code
+	}{
+		{name: "statement currency resolved", statementCode: "LAK", defaultCurrency: "USD", wantCurrency: "LAK", wantRate: "1"},
+		{name: "statement currency unresolved", statementCode: "", defaultCurrency: "USD", wantCurrency: "USD", wantRate: "21500"},
+		{name: "statement currency unresolved without default", statementCode: "", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", tt.statementCode, sale("10/01/2025", 5000000))
+			business := newTestBusiness(50)
+			business.DefaultCurrency = tt.defaultCurrency
+
+			s, mock := newCalculateTestService(t)
+			expectStatement(mock, file, business)
+			if tt.wantCode == codes.OK {
+				expectCurrency(mock, tt.wantCurrency, tt.wantRate)
+			}
+
+			calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("PreviewCalculation() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+			if calculation.Account.Currency != tt.wantCurrency {
+				t.Errorf("account currency = %s, want %s", calculation.Account.Currency, tt.wantCurrency)
+			}
+			if calculation.ExchangeRate.String() != tt.wantRate {
+				t.Errorf("exchange rate = %s, want %s", calculation.ExchangeRate, tt.wantRate)
+			}
+		})
+	}
+}
+
+func TestBusinessReqValidateDefaultCurrency(t *testing.T) {
+	tests := []struct {
+		code     string
+		want     string
+		wantCode codes.Code
+	}{
+		{code: "", want: ""},
+		{code: " usd ", want: "USD"},
+		{code: "XYZ", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			req := &BusinessReq{Name: "Retail", MarginPercentage: decimal.NewFromInt(20), DefaultCurrency: tt.code}
+			err := req.Validate()
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("Validate() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err == nil && req.DefaultCurrency != tt.want {
+				t.Errorf("default currency = %q, want %q", req.DefaultCurrency, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviewCalculationAccountNumberPattern(t *testing.T) {
+	// The account number of the statement fixtures is 0100001.
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", sale("10/01/2025", 5000000))
+
+	tests := []struct {
+		name     string
+		pattern  *regexp.Regexp
+		wantCode codes.Code
+	}{
+		{name: "no pattern", wantCode: codes.OK},
+		{name: "valid account number", pattern: regexp.MustCompile(`^\d{7}$`), wantCode: codes.OK},
+		{name: "malformed account number", pattern: regexp.MustCompile(`^\d{3}-\d{4}$`), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetAccountNumberPattern(tt.pattern)
+			expectStatement(mock, file, newTestBusiness(50))
+			expectCurrency(mock, "LAK", "1")
+
+			_, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("PreviewCalculation() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil && !strings.Contains(fieldViolation(err), tt.pattern.String()) {
+				t.Errorf("field violation = %q, want the expected format %s", fieldViolation(err), tt.pattern)
+			}
+		})
+	}
+}
+
+// fieldViolation returns the description of the first field violation of the error.
+func fieldViolation(err error) string {
+	for _, d := range rpcstatus.Convert(err).Details() {
+		if br, ok := d.(*edpb.BadRequest); ok && len(br.FieldViolations) > 0 {
+			return br.FieldViolations[0].Description
+		}
+	}
+	return ""
+}
+
+func TestPreviewCalculationShiftedLayout(t *testing.T) {
+	shifted := statement.StatementLayout{Period: "B2", AccountNumber: "B3", AccountDisplayName: "B4", AccountCurrency: "B5"}
+	file := writeStatementWithLayout(t, shifted, "01/01/2025 ຫາ 31/03/2025", "LAK", sale("10/01/2025", 5000000))
+
+	tests := []struct {
+		name     string
+		layout   statement.StatementLayout
+		wantCode codes.Code
+	}{
+		{name: "shifted layout", layout: shifted, wantCode: codes.OK},
+		// The default cells of the file are empty and the business has no default currency.
+		{name: "default layout", layout: statement.DefaultStatementLayout, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			if err := s.statement.SetLayout(tt.layout); err != nil {
+				t.Fatal(err)
+			}
+			expectStatement(mock, file, newTestBusiness(50))
+			if tt.wantCode == codes.OK {
+				expectCurrency(mock, "LAK", "1")
+			}
+
+			calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("PreviewCalculation() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if calculation.Account.Number != "0100001" || calculation.Account.DisplayName != "Somchai" || calculation.Account.Currency != "LAK" {
+				t.Errorf("account = %+v, want 0100001 of Somchai in LAK", calculation.Account)
+			}
+			wantStartedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)
+			if !calculation.StartedAt.Equal(wantStartedAt) {
+				t.Errorf("started at = %v, want %v", calculation.StartedAt, wantStartedAt)
+			}
+		})
+	}
+}
+
+func TestPreviewCalculationWithoutSaving(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/03/2025", "LAK",
+		sale("10/01/2025", 6000000),
+		sale("10/02/2025", 6000000),
+		sale("10/03/2025", 6000000),
+	)
+
+	// Only the statement, the business and the currency are read,
+	// the fake driver fails the test on any insert or uniqueness check of the number.
+	s, mock := newCalculateTestService(t)
+	expectStatement(mock, file, newTestBusiness(40))
+	expectCurrency(mock, "LAK", "1")
+
+	calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+	if err != nil {
+		t.Fatalf("PreviewCalculation() error = %v", err)
+	}
+
+	if calculation.ID != 0 || calculation.Number != "" {
+		t.Errorf("calculation = id %d number %q, want an unsaved calculation", calculation.ID, calculation.Number)
+	}
+	for _, f := range []struct {
+		name string
+		got  decimal.Decimal
+		want int64
+	}{
+		{name: "total income", got: calculation.TotalIncome, want: 18000000},
+		{name: "monthly average income", got: calculation.MonthlyAverageIncome, want: 6000000},
+		{name: "monthly average by margin", got: calculation.MonthlyAverageByMargin, want: 2400000},
+		{name: "monthly net income", got: calculation.MonthlyNetIncome, want: 2400000},
+	} {
+		if !f.got.Equal(decimal.NewFromInt(f.want)) {
+			t.Errorf("%s = %s, want %d", f.name, f.got, f.want)
+		}
+	}
+	if got := len(calculation.MonthlyBreakdown.MonthlyIncomes); got != 3 {
+		t.Errorf("monthly breakdown has %d months, want 3", got)
+	}
+}
+
+// calculationColumns are the columns selected by listCalculations.
+var calculationColumns = []string{
+	"id", "number", "statement_file_name", "b.id", "b.name", "product", "account_currency", "account_number",
+	"account_display_name", "period_in_month", "started_at", "ended_at", "exchange_rate", "s.margin_percentage",
+	"s.margin_fallback", "s.partial_final_month_excluded", "total_income", "monthly_average_income",
+	"monthly_average_margin", "monthly_net_income", "source_income", "status", "s.created_by", "s.created_at",
+	"s.updated_by", "s.updated_at",
+}
+
+func TestGetCalculationByNumberVisibility(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	// The calculation APP-1 was created by user@example.com.
+	tests := []struct {
+		name          string
+		claims        *auth.Claims
+		wantCreatedBy string
+		wantCode      codes.Code
+	}{
+		{name: "owner", claims: &auth.Claims{Username: "user@example.com", Role: auth.RoleUser}, wantCreatedBy: "user@example.com"},
+		{name: "admin", claims: &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true}},
+		{name: "unrelated user", claims: &auth.Claims{Username: "other@example.com", Role: auth.RoleUser}, wantCreatedBy: "other@example.com", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			get := mock.ExpectQuery(`FROM self_employed_analysis`)
+			if tt.wantCode == codes.OK {
+				get.WillReturnRows(calculationColumns, []any{
+					1, "APP-1", "statement.xlsx", "BT-1", "Retail", "SA", "LAK", "0100001",
+					"Somchai", "3", startedAt, endedAt, "1", "50",
+					false, false, "0", "0",
+					"0", "0", []byte(`{}`), "PENDING", "user@example.com", endedAt,
+					"user@example.com", endedAt,
+				})
+			}
+
+			_, err := s.GetCalculationByNumber(auth.ContextWithClaims(context.Background(), tt.claims), "APP-1")
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByNumber() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if got := createdByArg(get.Args()); got != tt.wantCreatedBy {
+				t.Errorf("created by filter = %q, want %q", got, tt.wantCreatedBy)
+			}
+		})
+	}
+}
+
+// createdByArg returns the argument of the query that is a user, or an empty string if none is.
+func createdByArg(args []any) string {
+	for _, a := range args {
+		if s, ok := a.(string); ok && strings.Contains(s, "@") {
+			return s
+		}
+	}
+	return ""
+}
+
+func TestRecalculateReqValidateMaxMonths(t *testing.T) {
+	months := func(n int) []MonthlyIncomeReq {
+		incomes := make([]MonthlyIncomeReq, n)
+		for i := range incomes {
+			date := time.Date(2025, time.Month(i+1), 10, 0, 0, 0, 0, time.UTC)
+			incomes[i] = MonthlyIncomeReq{
+				Month:        date.Format("January-2006"),
+				Transactions: []Transaction{{Date: types.DDMMYYYY(date), BillNumber: "B-1", Noted: "Sale", Amount: decimal.NewFromInt(5000000)}},
+			}
+		}
+		return incomes
+	}
+
+	tests := []struct {
+		name     string
+		months   int
+		wantCode codes.Code
+	}{
+		{name: "at the cap", months: 3, wantCode: codes.OK},
+		{name: "above the cap", months: 4, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &RecalculateReq{Number: "APP-1", MonthlyIncomes: months(tt.months), maxMonths: 3}
+			err := req.Validate()
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("Validate() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if err != nil && !strings.Contains(fieldViolation(err), "3 months") {
+				t.Errorf("field violation = %q, want the cap of 3 months", fieldViolation(err))
+			}
+		})
+	}
+
+	// The recalculation validates the request with the configured cap before reading the calculation.
+	s, _ := newCalculateTestService(t)
+	s.SetMaxRecalculationMonths(3)
+	if _, err := s.ReCalculateIncome(userContext(), &RecalculateReq{Number: "APP-1", MonthlyIncomes: months(4)}); rpcstatus.Code(err) != codes.InvalidArgument {
+		t.Errorf("ReCalculateIncome() above the cap = %v, want InvalidArgument", err)
+	}
+}
+
+func TestGetCalculationByID(t *testing.T) {
+	startedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	endedAt := time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		found    bool
+		wantCode codes.Code
+	}{
+		{name: "found", found: true, wantCode: codes.OK},
+		{name: "not found", wantCode: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			get := mock.ExpectQuery(`FROM self_employed_analysis`)
+			if tt.found {
+				get.WillReturnRows(calculationColumns, []any{
+					1, "APP-1", "statement.xlsx", "BT-1", "Retail", "SA", "LAK", "0100001",
+					"Somchai", "3", startedAt, endedAt, "1", "50",
+					false, false, "0", "0",
+					"0", "0", []byte(`{}`), "PENDING", "user@example.com", endedAt,
+					"user@example.com", endedAt,
+				})
+			}
+
+			calculation, err := s.GetCalculationByID(userContext(), 1)
+			if got := rpcstatus.Code(err); got != tt.wantCode {
+				t.Fatalf("GetCalculationByID() code = %v, want %v (error %v)", got, tt.wantCode, err)
+			}
+			if !slices.Contains(get.Args(), any(int64(1))) {
+				t.Errorf("query arguments = %v, want the ID 1", get.Args())
+			}
+			if err == nil && (calculation.ID != 1 || calculation.Number != "APP-1") {
+				t.Errorf("calculation %d %s, want 1 APP-1", calculation.ID, calculation.Number)
+			}
+		})
+	}
+}
+
+func TestPreviewCalculationBaseCurrencyIgnoresStoredRate(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", sale("10/01/2025", 5000000))
+
+	s, mock := newCalculateTestService(t)
+	expectStatement(mock, file, newTestBusiness(50))
+	// The rate stored for LAK is wrong, the base currency converts at 1 anyway.
+	expectCurrency(mock, "LAK", "2")
+
+	calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+	if err != nil {
+		t.Fatalf("PreviewCalculation() error = %v", err)
+	}
+	if !calculation.MonthlyNetIncome.Equal(calculation.MonthlyAverageByMargin) || !calculation.MonthlyNetIncome.Equal(decimal.NewFromInt(2500000)) {
+		t.Errorf("monthly net income = %s, want the monthly average by margin %s", calculation.MonthlyNetIncome, calculation.MonthlyAverageByMargin)
+	}
+}
+
+func TestPreviewCalculationDefaultMargin(t *testing.T) {
+	file := writeStatement(t, "01/01/2025 ຫາ 31/01/2025", "LAK", sale("10/01/2025", 5000000))
+
+	tests := []struct {
+		name           string
+		businessMargin int64
+		defaultMargin  int64
+		wantMargin     int64
+		wantFallback   bool
+		wantNetIncome  int64
+	}{
+		{name: "business margin", businessMargin: 50, defaultMargin: 20, wantMargin: 50, wantNetIncome: 2500000},
+		{name: "fallback", defaultMargin: 20, wantMargin: 20, wantFallback: true, wantNetIncome: 1000000},
+		// Without a default margin the net income collapses, as before the fallback.
+		{name: "no default margin", wantMargin: 0, wantNetIncome: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newCalculateTestService(t)
+			s.SetDefaultMarginPercentage(decimal.NewFromInt(tt.defaultMargin))
+			expectStatement(mock, file, newTestBusiness(tt.businessMargin))
+			expectCurrency(mock, "LAK", "1")
+
+			calculation, err := s.PreviewCalculation(userContext(), newPreviewReq())
+			if err != nil {
+				t.Fatalf("PreviewCalculation() error = %v", err)
+			}
+			if !calculation.MarginPercentage.Equal(decimal.NewFromInt(tt.wantMargin)) {
+				t.Errorf("margin percentage = %s, want %d", calculation.MarginPercentage, tt.wantMargin)
+			}
+			if calculation.MarginFallback != tt.wantFallback {
+				t.Errorf("margin fallback = %v, want %v", calculation.MarginFallback, tt.wantFallback)
+			}
+			if !calculation.MonthlyNetIncome.Equal(decimal.NewFromInt(tt.wantNetIncome)) {
+				t.Errorf("monthly net income = %s, want %d", calculation.MonthlyNetIncome, tt.wantNetIncome)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package selfemployed
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+	"go.uber.org/zap"
+)
+
+// writeStatement writes a statement fixture of the account 0100001 in the given currency
+// over the given period, e.g. "01/01/2025 ຫາ 31/03/2025", whose transactions are the given rows.
+// The header cells are where DefaultStatementLayout expects them.
+func writeStatement(t testing.TB, period, currency string, rows ...[]any) *statement.StatementFile {
+	t.Helper()
+	return writeStatementWithLayout(t, statement.DefaultStatementLayout, period, currency, rows...)
+}
+
+// writeStatementWithLayout is writeStatement with the header cells where the given layout expects them.
+func writeStatementWithLayout(t testing.TB, layout statement.StatementLayout, period, currency string, rows ...[]any) *statement.StatementFile {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Table 1"
+	if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+		t.Fatal(err)
+	}
+	cells := map[string]string{
+		layout.Period:             "Period : " + period,
+		layout.AccountNumber:      "Account number : 0100001",
+		layout.AccountDisplayName: "Account name : Somchai",
+		layout.AccountCurrency:    "Currency : " + currency,
+	}
+	for cell, v := range cells {
+		if err := f.SetCellValue(sheetName, cell, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := []any{"Date", "Bill No.", "Description", "", "Amount"}
+	for i, row := range append([][]any{header}, rows...) {
+		cell, _ := excelize.CoordinatesToCellName(1, 13+i)
+		if err := f.SetSheetRow(sheetName, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	location := filepath.Join(t.TempDir(), "statement.xlsx")
+	if err := f.SaveAs(location); err != nil {
+		t.Fatal(err)
+	}
+
+	return &statement.StatementFile{ID: 1, Name: "statement.xlsx", Location: location}
+}
+
+// sale returns the statement row of a sale of the given amount on the given date, e.g. "10/01/2025".
+func sale(date string, amount int64) []any {
+	return []any{date, fmt.Sprintf("B-%s", date), "Sale " + date, "", fmt.Sprint(amount)}
+}
+
+func newCalculateTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	ctx := context.Background()
+	db, mock := dbtest.New(t)
+	currencySvc, err := currency.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	statementSvc, err := statement.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewService(ctx, db, statementSvc, currencySvc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+// expectStatement expects the lookups of a calculation before the statement file is read:
+// the statement file, the business and the wordlists, "sale" matching the sales of the fixtures.
+func expectStatement(mock *dbtest.Mock, file *statement.StatementFile, b *Business) {
+	now := time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM statement_file WHERE`).WillReturnRows(
+		[]string{"id", "original_file_name", "file_name", "location", "created_by", "created_at"},
+		[]any{file.ID, file.Name, file.Name, file.Location, "user@example.com", now},
+	)
+	mock.ExpectQuery(`FROM business_type`).WillReturnRows(
+		[]string{"id", "name", "description", "margin_percentage", "default_currency", "created_by", "updated_by", "created_at", "updated_at"},
+		[]any{b.ID, b.Name, b.Description, b.MarginPercentage.String(), b.DefaultCurrency, "admin@example.com", "admin@example.com", now, now},
+	)
+	mock.ExpectQuery(`FROM self_employed_wordlist`).WillReturnRows(
+		[]string{"id", "word", "created_by", "created_at", "updated_by", "updated_at"},
+		[]any{1, "sale", "admin@example.com", now, "admin@example.com", now},
+	)
+}
+
+// expectCurrency expects the lookup of the currency of the statement.
+func expectCurrency(mock *dbtest.Mock, code, rate string) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`FROM currency`).WillReturnRows(
+		[]string{"id", "code", "exchange_rate", "created_by", "updated_by", "created_at", "updated_at"},
+		[]any{"currency0001", code, rate, "admin@example.com", "admin@example.com", now, now},
+	)
+}
+
+func newTestBusiness(margin int64) *Business {
+	return &Business{ID: "BT-1", Name: "Retail", MarginPercentage: decimal.NewFromInt(margin)}
+}
+
+func userContext() context.Context {
+	return auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+}
+
+func newPreviewReq() *CalculateReq {
+	return &CalculateReq{Product: types.ProductSA, BusinessID: "BT-1", StatementFileName: "statement.xlsx"}
+}
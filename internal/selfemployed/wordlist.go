@@ -189,6 +189,8 @@ func saveWordlist(ctx context.Context, db *sql.DB, in *Wordlist) error {
 }
 
 func listWordlists(ctx context.Context, db *sql.DB, in *WordlistQuery) ([]*Wordlist, error) {
+	defer database.TimeQuery("selfemployed.listWordlists")()
+
 	id := fmt.Sprintf("TOP %d id", pager.Size(in.PageSize))
 	if in.noLimit {
 		id = "id"
@@ -1,17 +1,26 @@
 package server
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/10664kls/automatic-finance-api/internal/application"
 	"github.com/10664kls/automatic-finance-api/internal/auth"
 	"github.com/10664kls/automatic-finance-api/internal/cib"
 	"github.com/10664kls/automatic-finance-api/internal/currency"
 	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/10664kls/automatic-finance-api/internal/middleware"
 	"github.com/10664kls/automatic-finance-api/internal/selfemployed"
+	"github.com/10664kls/automatic-finance-api/internal/settings"
 	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/types"
+	"github.com/10664kls/automatic-finance-api/internal/version"
 	"github.com/labstack/echo/v4"
+	"github.com/xuri/excelize/v2"
 	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -25,9 +34,16 @@ type Server struct {
 	income       *income.Service
 	selfemployed *selfemployed.Service
 	cib          *cib.Service
+	settings     *settings.Service
+	application  *application.Service
+
+	exportMws []echo.MiddlewareFunc
+
+	// listStreamThreshold is the number of items above which the lists are streamed, see SetListStreamThreshold.
+	listStreamThreshold int
 }
 
-func NewServer(auth *auth.Auth, currency *currency.Service, income *income.Service, statement *statement.Service, cib *cib.Service, selfemployed *selfemployed.Service) (*Server, error) {
+func NewServer(auth *auth.Auth, currency *currency.Service, income *income.Service, statement *statement.Service, cib *cib.Service, selfemployed *selfemployed.Service, settings *settings.Service, application *application.Service) (*Server, error) {
 	if auth == nil {
 		return nil, errors.New("auth service is nil")
 	}
@@ -46,6 +62,12 @@ func NewServer(auth *auth.Auth, currency *currency.Service, income *income.Servi
 	if selfemployed == nil {
 		return nil, errors.New("selfemployed service is nil")
 	}
+	if settings == nil {
+		return nil, errors.New("settings service is nil")
+	}
+	if application == nil {
+		return nil, errors.New("application service is nil")
+	}
 
 	return &Server{
 		auth:         auth,
@@ -54,6 +76,10 @@ func NewServer(auth *auth.Auth, currency *currency.Service, income *income.Servi
 		statement:    statement,
 		cib:          cib,
 		selfemployed: selfemployed,
+		settings:     settings,
+		application:  application,
+
+		listStreamThreshold: DefaultListStreamThreshold,
 	}, nil
 }
 
@@ -64,9 +90,16 @@ func (s *Server) Install(e *echo.Echo, mws ...echo.MiddlewareFunc) error {
 
 	v1 := e.Group("/v1")
 
+	// creators are the middlewares of the routes creating, recalculating or changing the calculations,
+	// which approvers are not allowed to. Completing a calculation is left to every role.
+	creators := append(append([]echo.MiddlewareFunc{}, mws...), middleware.RequireRole(auth.RoleUser, auth.RoleReadOnlyAdmin, auth.RoleAdmin))
+
+	v1.GET("/version", s.version)
+
 	v1.POST("/auth/login", s.login)
 	v1.POST("/auth/token", s.refreshToken)
 	v1.GET("/auth/profile", s.profile, mws...)
+	v1.GET("/auth/profile/login-history", s.listMyLoginHistory, mws...)
 	v1.POST("/auth/profile/change-password", s.changeMyPassword, mws...)
 	v1.PATCH("/auth/profile/change-display-name", s.changeMyDisplayName, mws...)
 
@@ -75,49 +108,84 @@ func (s *Server) Install(e *echo.Echo, mws ...echo.MiddlewareFunc) error {
 	v1.GET("/auth/users", s.listUsers, mws...)
 	v1.POST("/auth/users/:id/reset-password", s.resetUserPasswordByAdmin, mws...)
 	v1.POST("/auth/users/:id/disable", s.disableUser, mws...)
+	v1.POST("/auth/users\\:batchDisable", s.batchDisableUsers, mws...)
 	v1.POST("/auth/users/:id/enable", s.enableUser, mws...)
 	v1.POST("/auth/users/:id/terminate", s.terminateUser, mws...)
+	v1.POST("/auth/users/:id/purge", s.purgeUser, mws...)
+	v1.POST("/auth/users/:id/role", s.changeUserRole, mws...)
+	v1.POST("/auth/tokens/:id/revoke", s.revokeToken, mws...)
+
+	v1.POST("/admin/reassign", s.reassignCalculations, mws...)
+	v1.POST("/admin/recompute-periods", s.recomputePeriods, mws...)
+	v1.POST("/admin/cleanup-files", s.cleanupFiles, mws...)
+
+	v1.GET("/settings", s.getSettings, mws...)
+	v1.PATCH("/settings", s.updateSettings, mws...)
 
 	v1.POST("/currencies", s.createCurrency, mws...)
+	v1.POST("/currencies/import", s.importCurrencyRates, mws...)
+	v1.GET("/currencies/check", s.checkCurrency, mws...)
 	v1.GET("/currencies/:id", s.getCurrencyByID, mws...)
+	v1.GET("/currencies/:code/affected-calculations", s.listAffectedCalculations, mws...)
 	v1.GET("/currencies", s.listCurrencies, mws...)
 	v1.PATCH("/currencies/:id", s.updateCurrencyExchangeRate, mws...)
 
 	v1.POST("/files/statements", s.uploadStatement, mws...)
 	v1.GET("/files/statements/:name", s.downloadStatement, mws...)
+	v1.GET("/files/statements/:name/unmatched", s.listUnmatchedIncomeTransactions, mws...)
 	v1.POST("/files/cib", s.uploadCIB, mws...)
 	v1.GET("/files/cib/:name", s.downloadCIB, mws...)
 
-	v1.POST("/incomes/calculations", s.calculateIncome, mws...)
+	v1.POST("/incomes/calculations", s.calculateIncome, creators...)
 	v1.GET("/incomes/calculations", s.listIncomeCalculations, mws...)
+	v1.GET("/incomes/calculations/attention", s.listIncomeCalculationsNeedingAttention, mws...)
+	v1.GET("/incomes/calculations/counts-by-product", s.countIncomeCalculationsByProduct, mws...)
 	v1.GET("/incomes/calculations/:number", s.getIncomeCalculationByNumber, mws...)
-	v1.PUT("/incomes/calculations/:number", s.recalculateIncome, mws...)
+	v1.GET("/incomes/calculations/by-id/:id", s.getIncomeCalculationByID, mws...)
+	v1.GET("/incomes/calculations/:number/feed", s.listIncomeFeedByNumber, mws...)
+	v1.GET("/incomes/calculations/:number/monthly-totals", s.getIncomeMonthlyTotals, mws...)
+	v1.GET("/incomes/calculations/:number/config", s.getIncomeCalculationConfig, mws...)
+	v1.PUT("/incomes/calculations/:number", s.recalculateIncome, creators...)
+	v1.POST("/incomes/calculations/:number/recalculate\\:validate", s.previewIncomeRecalculation, creators...)
 	v1.POST("/incomes/calculations/:number/complete", s.completeIncomeCalculation, mws...)
+	v1.GET("/incomes/calculations/:number/history", s.listIncomeCalculationHistory, mws...)
 	v1.POST("/incomes/calculations/:number/transactions", s.listIncomeTransactionsByNumber, mws...)
 	v1.GET("/incomes/calculations/:number/transactions/:billNumber", s.getIncomeTransactionByBillNumber, mws...)
-	v1.GET("/incomes/calculations/:number/export-to-excel", s.exportIncomeCalculationToExcelByNumber, mws...)
-	v1.GET("/incomes/calculations/export-to-excel", s.exportIncomeCalculationsToExcel, mws...)
+
+	v1.POST("/incomes/household", s.calculateHouseholdIncome, mws...)
+	v1.GET("/incomes/products", s.listIncomeProducts, mws...)
 
 	v1.GET("/incomes/wordlists", s.listIncomeWordlists, mws...)
 	v1.GET("/incomes/wordlists/:id", s.getIncomeWordlistByID, mws...)
 	v1.POST("/incomes/wordlists", s.createIncomeWordlist, mws...)
 	v1.PUT("/incomes/wordlists/:id", s.updateIncomeWordlist, mws...)
+	v1.POST("/incomes/wordlists\\:reclassify", s.reclassifyIncomeWordlists, mws...)
 
 	v1.GET("/cib/calculations", s.listCIBCalculations, mws...)
 	v1.GET("/cib/calculations/:number", s.getCIBCalculationByNumber, mws...)
-	v1.POST("/cib/calculations", s.calculateCIB, mws...)
-	v1.GET("/cib/calculations/:number/export-to-excel", s.exportCIBCalculationToExcelByNumber, mws...)
-	v1.GET("/cib/calculations/export-to-excel", s.exportCIBCalculationsToExcel, mws...)
-
-	v1.POST("/selfemployed/calculations", s.calculateSelfEmployedIncome, mws...)
+	v1.GET("/cib/calculations/by-id/:id", s.getCIBCalculationByID, mws...)
+	v1.GET("/cib/calculations/:number/aggregate-by-bank", s.getCIBAggregateByBankCode, mws...)
+	v1.GET("/cib/calculations/:number/extraction-summary", s.getCIBExtractionSummary, mws...)
+	v1.GET("/cib/calculations/:number/confidence", s.getCIBExtractionConfidence, mws...)
+	v1.GET("/cib/calculations/:number/contracts/:loanNumber/schedule", s.getCIBAmortizationSchedule, mws...)
+	v1.POST("/cib/calculations", s.calculateCIB, creators...)
+	v1.POST("/cib/calculations/:number/refresh-rates", s.refreshCIBExchangeRates, creators...)
+	v1.PATCH("/cib/calculations/:number/contracts/:loanNumber/status", s.setCIBContractStatus, creators...)
+	v1.POST("/cib/calculations\\:consolidate", s.consolidateCIBCalculations, creators...)
+	v1.GET("/cib/customers/active-loans", s.listCIBActiveLoansByCustomer, mws...)
+	v1.GET("/cib/contracts/search", s.searchCIBContractsByLoanNumber, mws...)
+
+	v1.POST("/selfemployed/calculations", s.calculateSelfEmployedIncome, creators...)
+	v1.POST("/selfemployed/calculations/preview", s.previewSelfEmployedCalculation, creators...)
 	v1.GET("/selfemployed/calculations", s.listSelfEmployedIncomeCalculations, mws...)
+	v1.GET("/selfemployed/calculations/counts-by-business-type", s.countSelfEmployedCalculationsByBusinessType, mws...)
 	v1.GET("/selfemployed/calculations/:number", s.getSelfEmployedIncomeCalculationByNumber, mws...)
-	v1.PUT("/selfemployed/calculations/:number", s.recalculateSelfEmployedIncome, mws...)
+	v1.GET("/selfemployed/calculations/by-id/:id", s.getSelfEmployedIncomeCalculationByID, mws...)
+	v1.PUT("/selfemployed/calculations/:number", s.recalculateSelfEmployedIncome, creators...)
 	v1.PATCH("/selfemployed/calculations/:number/complete", s.completeSelfEmployedIncomeCalculationByNumber, mws...)
+	v1.POST("/selfemployed/calculations\\:batchComplete", s.batchCompleteSelfEmployedCalculations, mws...)
 	v1.POST("/selfemployed/calculations/:number/transactions", s.listSelfEmployedIncomeTransactions, mws...)
 	v1.GET("/selfemployed/calculations/:number/transactions/:billNumber", s.getSelfEmployedIncomeTransactionByBillNumber, mws...)
-	v1.GET("/selfemployed/calculations/:number/export-to-excel", s.exportSelfEmployedIncomeCalculationToExcelByNumber, mws...)
-	v1.GET("/selfemployed/calculations/export-to-excel", s.exportSelfEmployedIncomeCalculationsToExcel, mws...)
 
 	v1.GET("/selfemployed/wordlists", s.listSelfEmployedWordlists, mws...)
 	v1.GET("/selfemployed/wordlists/:id", s.getSelfEmployedWordlistByID, mws...)
@@ -129,9 +197,32 @@ func (s *Server) Install(e *echo.Echo, mws ...echo.MiddlewareFunc) error {
 	v1.POST("/selfemployed/businesses", s.createSelfEmployedBusiness, mws...)
 	v1.PUT("/selfemployed/businesses/:id", s.updateSelfEmployedBusiness, mws...)
 
+	v1.GET("/applications/:number", s.getApplicationByNumber, mws...)
+
+	// Exports are heavier than the other routes, so they are limited by
+	// their own middlewares instead of sharing the budget of interactive requests.
+	exports := v1.Group("", s.exportMws...)
+	exports.GET("/incomes/calculations/:number/transactions/export", s.exportIncomeTransactionsToExcelByNumber, mws...)
+	exports.GET("/incomes/calculations/:number/export-to-excel", s.exportIncomeCalculationToExcelByNumber, mws...)
+	exports.GET("/incomes/calculations/export-to-excel", s.exportIncomeCalculationsToExcel, mws...)
+	exports.GET("/cib/calculations/:number/export-to-excel", s.exportCIBCalculationToExcelByNumber, mws...)
+	exports.GET("/cib/calculations/export-to-excel", s.exportCIBCalculationsToExcel, mws...)
+	exports.GET("/cib/customers/export", s.exportCIBCustomerToExcel, mws...)
+	exports.GET("/cib/contracts/export-to-csv", s.exportCIBContractsToCSV, mws...)
+	exports.GET("/assessment", s.exportAssessmentToExcel, mws...)
+	exports.GET("/selfemployed/calculations/:number/export-to-excel", s.exportSelfEmployedIncomeCalculationToExcelByNumber, mws...)
+	exports.GET("/selfemployed/calculations/:number/matrix.csv", s.exportSelfEmployedMonthlyMatrixToCSV, mws...)
+	exports.GET("/selfemployed/calculations/export-to-excel", s.exportSelfEmployedIncomeCalculationsToExcel, mws...)
+
 	return nil
 }
 
+// UseForExports adds middlewares that only apply to the export routes,
+// e.g. a dedicated limiter. It must be called before Install.
+func (s *Server) UseForExports(mws ...echo.MiddlewareFunc) {
+	s.exportMws = append(s.exportMws, mws...)
+}
+
 func (s *Server) profile(c echo.Context) error {
 	profile, err := s.auth.Profile(c.Request().Context())
 	if err != nil {
@@ -139,11 +230,15 @@ func (s *Server) profile(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"profile": profile,
+		"profile": profile.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
-func badJSON() error {
+func badJSON(err error) error {
+	if err := badEnum(err); err != nil {
+		return err
+	}
+
 	s, _ := rpcStatus.New(codes.InvalidArgument, "Request body must be a valid JSON.").
 		WithDetails(&edPb.ErrorInfo{
 			Reason: "BINDING_ERROR",
@@ -153,7 +248,11 @@ func badJSON() error {
 	return s.Err()
 }
 
-func badParam() error {
+func badParam(err error) error {
+	if err := badEnum(err); err != nil {
+		return err
+	}
+
 	s, _ := rpcStatus.New(codes.InvalidArgument, "Request parameters must be a valid type.").
 		WithDetails(&edPb.ErrorInfo{
 			Reason: "BINDING_ERROR",
@@ -163,11 +262,33 @@ func badParam() error {
 	return s.Err()
 }
 
+// badEnum returns an error with the valid options if the binding failed
+// because of an unknown enum value, and nil otherwise.
+func badEnum(err error) error {
+	var enumErr *types.EnumError
+	if !errors.As(err, &enumErr) {
+		return nil
+	}
+
+	s, _ := rpcStatus.New(codes.InvalidArgument, fmt.Sprintf("Request contains an invalid %s. It must be one of %s.", enumErr.Name, strings.Join(enumErr.Options, ", "))).
+		WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       enumErr.Name,
+					Description: enumErr.Error(),
+				},
+			},
+		})
+
+	return s.Err()
+}
+
 func (s *Server) login(c echo.Context) error {
 	req := new(auth.LoginReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
+	req.IPAddress = c.RealIP()
 
 	token, err := s.auth.Login(c.Request().Context(), req)
 	if err != nil {
@@ -180,7 +301,7 @@ func (s *Server) login(c echo.Context) error {
 func (s *Server) refreshToken(c echo.Context) error {
 	req := new(auth.NewTokenReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	token, err := s.auth.RefreshToken(c.Request().Context(), req)
@@ -194,7 +315,7 @@ func (s *Server) refreshToken(c echo.Context) error {
 func (s *Server) createUser(c echo.Context) error {
 	req := new(auth.CreateUserReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	user, err := s.auth.CreateUser(c.Request().Context(), req)
@@ -203,7 +324,7 @@ func (s *Server) createUser(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user": user,
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
@@ -214,14 +335,14 @@ func (s *Server) getUserByID(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user": user,
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
 func (s *Server) listUsers(c echo.Context) error {
 	req := new(auth.UserQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	users, err := s.auth.ListUsers(c.Request().Context(), req)
@@ -229,13 +350,27 @@ func (s *Server) listUsers(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, users)
+	return c.JSON(http.StatusOK, users.View(auth.ClaimsFromContext(c.Request().Context())))
+}
+
+func (s *Server) listMyLoginHistory(c echo.Context) error {
+	req := new(auth.LoginHistoryQuery)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	result, err := s.auth.ListMyLoginHistory(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
 }
 
 func (s *Server) changeMyPassword(c echo.Context) error {
 	req := new(auth.ChangeMyPasswordReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	if err := s.auth.ChangeMyPassword(c.Request().Context(), req); err != nil {
@@ -252,7 +387,7 @@ func (s *Server) changeMyPassword(c echo.Context) error {
 func (s *Server) resetUserPasswordByAdmin(c echo.Context) error {
 	req := new(auth.ResetUserPasswordByAdminReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	if err := s.auth.ResetUserPasswordByAdmin(c.Request().Context(), req); err != nil {
@@ -266,10 +401,99 @@ func (s *Server) resetUserPasswordByAdmin(c echo.Context) error {
 	})
 }
 
+func (s *Server) reassignCalculations(c echo.Context) error {
+	req := new(auth.ReassignCalculationsReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	result, err := s.auth.ReassignCalculations(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) cleanupFiles(c echo.Context) error {
+	req := new(statement.CleanupFilesReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	statements, err := s.statement.CleanupFiles(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	cibs, err := s.cib.CleanupFiles(c.Request().Context(), &cib.CleanupFilesReq{
+		RetentionDays: req.RetentionDays,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"statement": statements,
+		"cib":       cibs,
+	})
+}
+
+func (s *Server) recomputePeriods(c echo.Context) error {
+	req := new(income.RecomputePeriodsReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	incomes, err := s.income.RecomputePeriods(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	selfemployeds, err := s.selfemployed.RecomputePeriods(c.Request().Context(), &selfemployed.RecomputePeriodsReq{
+		IncludeCompleted: req.IncludeCompleted,
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"income":       incomes,
+		"selfemployed": selfemployeds,
+	})
+}
+
+func (s *Server) getSettings(c echo.Context) error {
+	result, err := s.settings.GetSettings(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"settings": result,
+	})
+}
+
+func (s *Server) updateSettings(c echo.Context) error {
+	req := new(settings.UpdateReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	result, err := s.settings.UpdateSettings(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"settings": result,
+	})
+}
+
 func (s *Server) changeMyDisplayName(c echo.Context) error {
 	req := new(auth.ChangeDisplayNameReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	user, err := s.auth.ChangeMyDisplayName(c.Request().Context(), req)
@@ -278,7 +502,7 @@ func (s *Server) changeMyDisplayName(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"profile": user,
+		"profile": user.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
@@ -289,7 +513,7 @@ func (s *Server) enableUser(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user": user,
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
@@ -300,7 +524,30 @@ func (s *Server) terminateUser(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user": user,
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
+	})
+}
+
+func (s *Server) purgeUser(c echo.Context) error {
+	user, err := s.auth.PurgeUser(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
+	})
+}
+
+func (s *Server) revokeToken(c echo.Context) error {
+	if err := s.auth.RevokeToken(c.Request().Context(), c.Param("id")); err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"status":  "SUCCESS",
+		"code":    http.StatusOK,
+		"message": "The token has been revoked successfully.",
 	})
 }
 
@@ -311,14 +558,44 @@ func (s *Server) disableUser(c echo.Context) error {
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{
-		"user": user,
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
+	})
+}
+
+func (s *Server) batchDisableUsers(c echo.Context) error {
+	req := new(auth.BatchDisableUsersReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	result, err := s.auth.BatchDisableUsers(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) changeUserRole(c echo.Context) error {
+	req := new(auth.ChangeUserRoleReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	user, err := s.auth.ChangeUserRole(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"user": user.View(auth.ClaimsFromContext(c.Request().Context())),
 	})
 }
 
 func (s *Server) createCurrency(c echo.Context) error {
 	req := new(currency.CreateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	currency, err := s.currency.CreateCurrency(c.Request().Context(), req)
@@ -334,7 +611,7 @@ func (s *Server) createCurrency(c echo.Context) error {
 func (s *Server) updateCurrencyExchangeRate(c echo.Context) error {
 	req := new(currency.ExchangeRateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	currency, err := s.currency.UpdateExchangeRate(c.Request().Context(), req)
@@ -350,7 +627,7 @@ func (s *Server) updateCurrencyExchangeRate(c echo.Context) error {
 func (s *Server) listCurrencies(c echo.Context) error {
 	req := new(currency.Query)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	currencies, err := s.currency.ListCurrencies(c.Request().Context(), req)
@@ -361,6 +638,17 @@ func (s *Server) listCurrencies(c echo.Context) error {
 	return c.JSON(http.StatusOK, currencies)
 }
 
+func (s *Server) checkCurrency(c echo.Context) error {
+	availability, err := s.currency.CheckCurrency(c.Request().Context(), c.QueryParam("code"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"currency": availability,
+	})
+}
+
 func (s *Server) getCurrencyByID(c echo.Context) error {
 	currency, err := s.currency.GetCurrencyByID(c.Request().Context(), c.Param("id"))
 	if err != nil {
@@ -372,6 +660,38 @@ func (s *Server) getCurrencyByID(c echo.Context) error {
 	})
 }
 
+func (s *Server) importCurrencyRates(c echo.Context) error {
+	f, err := c.FormFile("file")
+	if errors.Is(err, http.ErrMissingFile) {
+		st, _ := status.New(codes.InvalidArgument, "File must not be empty.").
+			WithDetails(&edPb.BadRequest{
+				FieldViolations: []*edPb.BadRequest_FieldViolation{
+					{
+						Field:       "file",
+						Description: "File must not be empty.",
+					},
+				},
+			})
+		return st.Err()
+	}
+	if err != nil {
+		return err
+	}
+
+	src, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	result, err := s.currency.ImportRates(c.Request().Context(), src)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 func (s *Server) uploadStatement(c echo.Context) error {
 	f, err := c.FormFile("file")
 	if errors.Is(err, http.ErrMissingFile) {
@@ -424,7 +744,7 @@ func (s *Server) downloadStatement(c echo.Context) error {
 func (s *Server) calculateIncome(c echo.Context) error {
 	req := new(income.CalculateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculation, err := s.income.CalculateIncome(c.Request().Context(), req)
@@ -440,7 +760,7 @@ func (s *Server) calculateIncome(c echo.Context) error {
 func (s *Server) listIncomeCalculations(c echo.Context) error {
 	req := new(income.CalculationQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculations, err := s.income.ListCalculations(c.Request().Context(), req)
@@ -448,9 +768,72 @@ func (s *Server) listIncomeCalculations(c echo.Context) error {
 		return err
 	}
 
+	return writeList(c, s.listStreamThreshold, calculations, "calculations", calculations.Calculations, calculations.NextPageToken)
+}
+
+func (s *Server) listIncomeCalculationsNeedingAttention(c echo.Context) error {
+	req := new(income.AttentionQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	calculations, err := s.income.ListNeedingAttention(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
 	return c.JSON(http.StatusOK, calculations)
 }
 
+func (s *Server) getIncomeCalculationByID(c echo.Context) error {
+	// An ID that is not a number matches no calculation.
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	calculation, err := s.income.GetCalculationByID(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
+func (s *Server) getIncomeMonthlyTotals(c echo.Context) error {
+	result, err := s.income.MonthlyTotals(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) listUnmatchedIncomeTransactions(c echo.Context) error {
+	result, err := s.income.ListUnmatchedTransactions(c.Request().Context(), c.Param("name"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) getIncomeCalculationConfig(c echo.Context) error {
+	result, err := s.income.GetCalculationConfig(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (s *Server) listIncomeFeedByNumber(c echo.Context) error {
+	result, err := s.income.ListFeedByNumber(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 func (s *Server) getIncomeCalculationByNumber(c echo.Context) error {
 	calculation, err := s.income.GetCalculationByNumber(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -465,7 +848,7 @@ func (s *Server) getIncomeCalculationByNumber(c echo.Context) error {
 func (s *Server) recalculateIncome(c echo.Context) error {
 	req := new(income.RecalculateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	salaries, err := s.income.ReCalculateIncome(c.Request().Context(), req)
@@ -476,10 +859,58 @@ func (s *Server) recalculateIncome(c echo.Context) error {
 	return c.JSON(http.StatusOK, salaries)
 }
 
+func (s *Server) previewIncomeRecalculation(c echo.Context) error {
+	req := new(income.RecalculateReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	calculation, err := s.income.ReCalculatePreview(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, calculation)
+}
+
+func (s *Server) calculateHouseholdIncome(c echo.Context) error {
+	req := new(income.HouseholdReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	household, err := s.income.Household(c.Request().Context(), req.Numbers)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"household": household,
+	})
+}
+
+func (s *Server) listIncomeCalculationHistory(c echo.Context) error {
+	history, err := s.income.ListCalculationHistory(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, history)
+}
+
+func (s *Server) listIncomeProducts(c echo.Context) error {
+	products, err := s.income.ListProducts(c.Request().Context())
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, products)
+}
+
 func (s *Server) listIncomeWordlists(c echo.Context) error {
 	req := new(income.WordlistQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlists, err := s.income.ListWordlists(c.Request().Context(), req)
@@ -493,7 +924,7 @@ func (s *Server) listIncomeWordlists(c echo.Context) error {
 func (s *Server) listIncomeTransactionsByNumber(c echo.Context) error {
 	req := new(income.TransactionReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	transactions, err := s.income.ListIncomeTransactionsByNumber(c.Request().Context(), req)
@@ -507,7 +938,7 @@ func (s *Server) listIncomeTransactionsByNumber(c echo.Context) error {
 func (s *Server) getIncomeTransactionByBillNumber(c echo.Context) error {
 	req := new(income.GetTransactionReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	transaction, err := s.income.GetIncomeTransactionByBillNumber(c.Request().Context(), req)
@@ -523,7 +954,7 @@ func (s *Server) getIncomeTransactionByBillNumber(c echo.Context) error {
 func (s *Server) getIncomeWordlistByID(c echo.Context) error {
 	req := new(income.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlist, err := s.income.GetWordlistByID(c.Request().Context(), req.ID)
@@ -539,7 +970,7 @@ func (s *Server) getIncomeWordlistByID(c echo.Context) error {
 func (s *Server) createIncomeWordlist(c echo.Context) error {
 	req := new(income.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlist, err := s.income.CreateWordlist(c.Request().Context(), req)
@@ -555,7 +986,7 @@ func (s *Server) createIncomeWordlist(c echo.Context) error {
 func (s *Server) updateIncomeWordlist(c echo.Context) error {
 	req := new(income.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlist, err := s.income.UpdateWordlist(c.Request().Context(), req)
@@ -568,6 +999,20 @@ func (s *Server) updateIncomeWordlist(c echo.Context) error {
 	})
 }
 
+func (s *Server) reclassifyIncomeWordlists(c echo.Context) error {
+	req := new(income.ReclassifyWordlistsReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	wordlists, err := s.income.ReclassifyWordlists(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, wordlists)
+}
+
 func (s *Server) completeIncomeCalculation(c echo.Context) error {
 	calculation, err := s.income.CompleteCalculation(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -580,7 +1025,12 @@ func (s *Server) completeIncomeCalculation(c echo.Context) error {
 }
 
 func (s *Server) exportIncomeCalculationToExcelByNumber(c echo.Context) error {
-	buf, err := s.income.ExportCalculationToExcelByNumber(c.Request().Context(), c.Param("number"))
+	req := new(income.ExportCalculationReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	buf, err := s.income.ExportCalculationToExcelByNumber(c.Request().Context(), c.Param("number"), req)
 	if err != nil {
 		return err
 	}
@@ -591,27 +1041,69 @@ func (s *Server) exportIncomeCalculationToExcelByNumber(c echo.Context) error {
 	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
 }
 
+func (s *Server) exportIncomeTransactionsToExcelByNumber(c echo.Context) error {
+	buf, err := s.income.ExportTransactionsToExcelByNumber(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="Income_transactions_%s.xlsx"`, c.Param("number")))
+
+	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+}
+
 func (s *Server) exportIncomeCalculationsToExcel(c echo.Context) error {
 	req := new(income.BatchGetCalculationsQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
-	buf, err := s.income.ExportCalculationsToExcel(c.Request().Context(), req)
+	f, nextID, err := s.income.ExportCalculationsToExcel(c.Request().Context(), req)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	setExportNextID(c, nextID)
 
-	c.Response().Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	c.Response().Header().Set("Content-Disposition", `attachment; filename="Income_calculations.xlsx"`)
 
-	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+	return writeWorkbook(c, f)
+}
+
+func (s *Server) countIncomeCalculationsByProduct(c echo.Context) error {
+	req := new(income.CountsQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	counts, err := s.income.CountsByProduct(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, counts)
+}
+
+func (s *Server) countSelfEmployedCalculationsByBusinessType(c echo.Context) error {
+	req := new(selfemployed.CountsQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	counts, err := s.selfemployed.CountsByBusinessType(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, counts)
 }
 
 func (s *Server) calculateCIB(c echo.Context) error {
 	req := new(cib.CalculateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculation, err := s.cib.CalculateCIB(c.Request().Context(), req)
@@ -624,6 +1116,19 @@ func (s *Server) calculateCIB(c echo.Context) error {
 	})
 }
 
+func (s *Server) getCIBCalculationByID(c echo.Context) error {
+	// An ID that is not a number matches no calculation.
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	calculation, err := s.cib.GetCalculationByID(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
 func (s *Server) getCIBCalculationByNumber(c echo.Context) error {
 	calculation, err := s.cib.GetCalculationByNumber(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -635,10 +1140,100 @@ func (s *Server) getCIBCalculationByNumber(c echo.Context) error {
 	})
 }
 
+func (s *Server) getCIBAggregateByBankCode(c echo.Context) error {
+	aggregate, err := s.cib.GetAggregateByBankCode(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"aggregate": aggregate,
+	})
+}
+
+func (s *Server) getCIBExtractionSummary(c echo.Context) error {
+	summary, err := s.cib.GetExtractionSummary(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"summary": summary,
+	})
+}
+
+func (s *Server) getCIBExtractionConfidence(c echo.Context) error {
+	req := new(cib.ExtractionConfidenceQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	confidence, err := s.cib.GetExtractionConfidence(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"confidence": confidence,
+	})
+}
+
+func (s *Server) refreshCIBExchangeRates(c echo.Context) error {
+	calculation, err := s.cib.RefreshExchangeRates(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
+func (s *Server) setCIBContractStatus(c echo.Context) error {
+	req := new(cib.ContractStatusReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	calculation, err := s.cib.SetContractStatus(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
+func (s *Server) consolidateCIBCalculations(c echo.Context) error {
+	req := new(cib.ConsolidateReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	calculation, err := s.cib.ConsolidateCalculations(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
+func (s *Server) getCIBAmortizationSchedule(c echo.Context) error {
+	schedule, err := s.cib.GetAmortizationSchedule(c.Request().Context(), c.Param("number"), c.Param("loanNumber"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, schedule)
+}
+
 func (s *Server) listCIBCalculations(c echo.Context) error {
 	req := new(cib.CalculationQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculations, err := s.cib.ListCalculations(c.Request().Context(), req)
@@ -646,7 +1241,35 @@ func (s *Server) listCIBCalculations(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, calculations)
+	return writeList(c, s.listStreamThreshold, calculations, "calculations", calculations.Calculations, calculations.NextPageToken)
+}
+
+func (s *Server) listCIBActiveLoansByCustomer(c echo.Context) error {
+	req := new(cib.ActiveLoanQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	loans, err := s.cib.ListActiveLoansByCustomer(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, loans)
+}
+
+func (s *Server) searchCIBContractsByLoanNumber(c echo.Context) error {
+	req := new(cib.LoanSearchQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	result, err := s.cib.FindByLoanNumber(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
 }
 
 func (s *Server) uploadCIB(c echo.Context) error {
@@ -710,27 +1333,77 @@ func (s *Server) exportCIBCalculationToExcelByNumber(c echo.Context) error {
 	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
 }
 
+func (s *Server) exportAssessmentToExcel(c echo.Context) error {
+	req := new(application.AssessmentQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	buf, err := s.application.ExportAssessmentToExcel(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="Assessment_%s.xlsx"`, req.IncomeNumber))
+
+	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+}
+
+func (s *Server) exportCIBCustomerToExcel(c echo.Context) error {
+	req := new(cib.CustomerExportQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	buf, err := s.cib.ExportCustomerToExcel(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="CIB_customer.xlsx"`)
+
+	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+}
+
 func (s *Server) exportCIBCalculationsToExcel(c echo.Context) error {
 	req := new(cib.BatchGetCalculationsQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
-	buf, err := s.cib.ExportCalculationsToExcel(c.Request().Context(), req)
+	f, nextID, err := s.cib.ExportCalculationsToExcel(c.Request().Context(), req)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	setExportNextID(c, nextID)
 
-	c.Response().Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	c.Response().Header().Set("Content-Disposition", `attachment; filename="CIB_calculations.xlsx"`)
 
-	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
+	return writeWorkbook(c, f)
+}
+
+func (s *Server) exportCIBContractsToCSV(c echo.Context) error {
+	req := new(cib.BatchGetCalculationsQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Content-Type", "text/csv")
+	c.Response().Header().Set("Content-Disposition", `attachment; filename="CIB_contracts.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	return s.cib.ExportContractsToCSV(c.Request().Context(), c.Response(), req)
 }
 
 func (s *Server) calculateSelfEmployedIncome(c echo.Context) error {
 	req := new(selfemployed.CalculateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculation, err := s.selfemployed.CalculateIncome(c.Request().Context(), req)
@@ -743,6 +1416,35 @@ func (s *Server) calculateSelfEmployedIncome(c echo.Context) error {
 	})
 }
 
+func (s *Server) previewSelfEmployedCalculation(c echo.Context) error {
+	req := new(selfemployed.CalculateReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	calculation, err := s.selfemployed.PreviewCalculation(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
+func (s *Server) getSelfEmployedIncomeCalculationByID(c echo.Context) error {
+	// An ID that is not a number matches no calculation.
+	id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	calculation, err := s.selfemployed.GetCalculationByID(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"calculation": calculation,
+	})
+}
+
 func (s *Server) getSelfEmployedIncomeCalculationByNumber(c echo.Context) error {
 	calculation, err := s.selfemployed.GetCalculationByNumber(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -757,7 +1459,7 @@ func (s *Server) getSelfEmployedIncomeCalculationByNumber(c echo.Context) error
 func (s *Server) listSelfEmployedIncomeCalculations(c echo.Context) error {
 	req := new(selfemployed.CalculationQuery)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	calculations, err := s.selfemployed.ListCalculations(c.Request().Context(), req)
@@ -765,13 +1467,13 @@ func (s *Server) listSelfEmployedIncomeCalculations(c echo.Context) error {
 		return err
 	}
 
-	return c.JSON(http.StatusOK, calculations)
+	return writeList(c, s.listStreamThreshold, calculations, "calculations", calculations.Calculations, calculations.NextPageToken)
 }
 
 func (s *Server) recalculateSelfEmployedIncome(c echo.Context) error {
 	req := new(selfemployed.RecalculateReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	calculation, err := s.selfemployed.ReCalculateIncome(c.Request().Context(), req)
@@ -784,6 +1486,20 @@ func (s *Server) recalculateSelfEmployedIncome(c echo.Context) error {
 	})
 }
 
+func (s *Server) batchCompleteSelfEmployedCalculations(c echo.Context) error {
+	req := new(selfemployed.BatchCompleteCalculationsReq)
+	if err := c.Bind(req); err != nil {
+		return badJSON(err)
+	}
+
+	result, err := s.selfemployed.BatchCompleteCalculations(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
 func (s *Server) completeSelfEmployedIncomeCalculationByNumber(c echo.Context) error {
 	calculation, err := s.selfemployed.CompleteCalculation(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -798,7 +1514,7 @@ func (s *Server) completeSelfEmployedIncomeCalculationByNumber(c echo.Context) e
 func (s *Server) listSelfEmployedIncomeTransactions(c echo.Context) error {
 	req := new(selfemployed.TransactionQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	transactions, err := s.selfemployed.ListIncomeTransactionsByNumber(c.Request().Context(), req)
@@ -812,7 +1528,7 @@ func (s *Server) listSelfEmployedIncomeTransactions(c echo.Context) error {
 func (s *Server) getSelfEmployedIncomeTransactionByBillNumber(c echo.Context) error {
 	req := new(selfemployed.GetTransactionQuery)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	transaction, err := s.selfemployed.GetIncomeTransactionByBillNumber(c.Request().Context(), req)
@@ -828,7 +1544,7 @@ func (s *Server) getSelfEmployedIncomeTransactionByBillNumber(c echo.Context) er
 func (s *Server) listSelfEmployedWordlists(c echo.Context) error {
 	req := new(selfemployed.WordlistQuery)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	wordlists, err := s.selfemployed.ListWordlists(c.Request().Context(), req)
@@ -842,7 +1558,7 @@ func (s *Server) listSelfEmployedWordlists(c echo.Context) error {
 func (s *Server) getSelfEmployedWordlistByID(c echo.Context) error {
 	req := new(selfemployed.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	wordlist, err := s.selfemployed.GetWordlistByID(c.Request().Context(), req.ID)
@@ -858,7 +1574,7 @@ func (s *Server) getSelfEmployedWordlistByID(c echo.Context) error {
 func (s *Server) createSelfEmployedWordlist(c echo.Context) error {
 	req := new(selfemployed.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlist, err := s.selfemployed.CreateWordlist(c.Request().Context(), req)
@@ -874,7 +1590,7 @@ func (s *Server) createSelfEmployedWordlist(c echo.Context) error {
 func (s *Server) updateSelfEmployedWordlist(c echo.Context) error {
 	req := new(selfemployed.WordlistReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	wordlist, err := s.selfemployed.UpdateWordlist(c.Request().Context(), req)
@@ -890,7 +1606,7 @@ func (s *Server) updateSelfEmployedWordlist(c echo.Context) error {
 func (s *Server) listSelfEmployedBusinesses(c echo.Context) error {
 	req := new(selfemployed.BusinessQuery)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	businesses, err := s.selfemployed.ListBusinesses(c.Request().Context(), req)
@@ -904,7 +1620,7 @@ func (s *Server) listSelfEmployedBusinesses(c echo.Context) error {
 func (s *Server) getSelfEmployedBusinessByID(c echo.Context) error {
 	req := new(selfemployed.BusinessReq)
 	if err := c.Bind(req); err != nil {
-		return badParam()
+		return badParam(err)
 	}
 
 	business, err := s.selfemployed.GetBusinessByID(c.Request().Context(), req.ID)
@@ -920,7 +1636,7 @@ func (s *Server) getSelfEmployedBusinessByID(c echo.Context) error {
 func (s *Server) createSelfEmployedBusiness(c echo.Context) error {
 	req := new(selfemployed.BusinessReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	business, err := s.selfemployed.CreateBusiness(c.Request().Context(), req)
@@ -936,7 +1652,7 @@ func (s *Server) createSelfEmployedBusiness(c echo.Context) error {
 func (s *Server) updateSelfEmployedBusiness(c echo.Context) error {
 	req := new(selfemployed.BusinessReq)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
 	business, err := s.selfemployed.UpdateBusiness(c.Request().Context(), req)
@@ -949,6 +1665,17 @@ func (s *Server) updateSelfEmployedBusiness(c echo.Context) error {
 	})
 }
 
+func (s *Server) exportSelfEmployedMonthlyMatrixToCSV(c echo.Context) error {
+	buf, err := s.selfemployed.ExportMonthlyMatrixToCSV(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	c.Response().Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="Monthly_matrix_selfemployed_%s.csv"`, c.Param("number")))
+
+	return c.Blob(http.StatusOK, "text/csv", buf.Bytes())
+}
+
 func (s *Server) exportSelfEmployedIncomeCalculationToExcelByNumber(c echo.Context) error {
 	buf, err := s.selfemployed.ExportCalculationToExcelByNumber(c.Request().Context(), c.Param("number"))
 	if err != nil {
@@ -964,16 +1691,83 @@ func (s *Server) exportSelfEmployedIncomeCalculationToExcelByNumber(c echo.Conte
 func (s *Server) exportSelfEmployedIncomeCalculationsToExcel(c echo.Context) error {
 	req := new(selfemployed.BatchGetCalculationsQuery)
 	if err := c.Bind(req); err != nil {
-		return badJSON()
+		return badJSON(err)
 	}
 
-	buf, err := s.selfemployed.ExportCalculationsToExcel(c.Request().Context(), req)
+	f, nextID, err := s.selfemployed.ExportCalculationsToExcel(c.Request().Context(), req)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	setExportNextID(c, nextID)
 
-	c.Response().Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
 	c.Response().Header().Set("Content-Disposition", `attachment; filename="Income_calculations_selfemployed.xlsx"`)
 
+	return writeWorkbook(c, f)
+}
+
+func (s *Server) getApplicationByNumber(c echo.Context) error {
+	application, err := s.application.GetApplicationByNumber(c.Request().Context(), c.Param("number"))
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"application": application,
+	})
+}
+
+func (s *Server) listAffectedCalculations(c echo.Context) error {
+	req := new(application.AffectedCalculationsQuery)
+	if err := c.Bind(req); err != nil {
+		return badParam(err)
+	}
+
+	affected, err := s.application.ListAffectedCalculations(c.Request().Context(), req)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"affectedCalculations": affected,
+	})
+}
+
+// VersionResult is the build of the running server and the main configuration it runs with.
+// It must not hold any secret, the endpoint being unauthenticated.
+type VersionResult struct {
+	version.Info
+	BaseCurrency    string                 `json:"baseCurrency"`
+	DecimalFormat   types.DecimalFormat    `json:"decimalFormat"`
+	NumberFormat    statement.NumberFormat `json:"numberFormat"`
+	IncomeDirection income.IncomeDirection `json:"incomeDirection"`
+}
+
+func (s *Server) version(c echo.Context) error {
+	return c.JSON(http.StatusOK, &VersionResult{
+		Info:            version.Get(),
+		BaseCurrency:    s.currency.BaseCurrency(),
+		DecimalFormat:   types.CurrentDecimalFormat(),
+		NumberFormat:    s.statement.NumberFormat(),
+		IncomeDirection: s.income.IncomeDirection(),
+	})
+}
+
+// writeWorkbook writes the workbook to a buffer before responding, so an error while writing it
+// is returned as an error response instead of a truncated file sent with a 200 status.
+func writeWorkbook(c echo.Context, f *excelize.File) error {
+	buf := new(bytes.Buffer)
+	if _, err := f.WriteTo(buf); err != nil {
+		return fmt.Errorf("failed to write workbook: %w", err)
+	}
+
 	return c.Blob(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", buf.Bytes())
 }
+
+// setExportNextID sets the header of the ID an export resumes from, not set once the export is complete.
+func setExportNextID(c echo.Context, nextID int64) {
+	if nextID > 0 {
+		c.Response().Header().Set("X-Next-Id", strconv.FormatInt(nextID, 10))
+	}
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/labstack/echo/v4"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+func TestBadJSONListsEnumOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+	}{
+		{name: "unknown product", body: `{"product":"XX"}`, wantField: "product"},
+		{name: "invalid JSON", body: `{"product":`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/incomes/calculations", strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c := echo.New().NewContext(req, httptest.NewRecorder())
+
+			err := c.Bind(new(income.CalculateReq))
+			if err == nil {
+				t.Fatal("Bind() error = nil, want a binding error")
+			}
+
+			s := rpcStatus.Convert(badJSON(err))
+			if s.Code() != codes.InvalidArgument {
+				t.Fatalf("badJSON() code = %v, want InvalidArgument", s.Code())
+			}
+
+			var field string
+			for _, d := range s.Details() {
+				if br, ok := d.(*edPb.BadRequest); ok && len(br.FieldViolations) > 0 {
+					field = br.FieldViolations[0].Field
+				}
+			}
+			if field != tt.wantField {
+				t.Errorf("field violation = %q, want %q", field, tt.wantField)
+			}
+			if tt.wantField != "" && !strings.Contains(s.Message(), "PL, SA, SF") {
+				t.Errorf("message = %q, want the valid products", s.Message())
+			}
+		})
+	}
+}
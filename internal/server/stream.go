@@ -0,0 +1,71 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DefaultListStreamThreshold is the number of items of a list response above which
+// the response is streamed when no other threshold is configured.
+// The calculations carry their breakdowns, so a page of the maximum size, see pager.Size, is streamed.
+const DefaultListStreamThreshold = 100
+
+// streamFlushSize is the number of buffered bytes flushed to the client while streaming a list.
+const streamFlushSize = 32 * 1024
+
+// SetListStreamThreshold sets the number of items of a list response above which the items
+// are encoded one by one to the response instead of being marshaled at once.
+// A value less than or equal to zero resets it to DefaultListStreamThreshold.
+func (s *Server) SetListStreamThreshold(n int) {
+	if n <= 0 {
+		n = DefaultListStreamThreshold
+	}
+	s.listStreamThreshold = n
+}
+
+// writeList writes the list result, streaming it as {"<key>": [...], "nextPageToken": "..."}
+// when it has more items than the threshold. The streamed shape is the one of the result,
+// which must only have these two fields. A failure while streaming cannot change the status anymore,
+// so the client gets a truncated body.
+func writeList[T any](c echo.Context, threshold int, result any, key string, items []T, nextPageToken string) error {
+	if len(items) <= threshold {
+		return c.JSON(http.StatusOK, result)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	res.WriteHeader(http.StatusOK)
+
+	w := bufio.NewWriter(res)
+	enc := json.NewEncoder(w)
+
+	k, _ := json.Marshal(key)
+	w.WriteByte('{')
+	w.Write(k)
+	w.WriteString(":[")
+	for i, item := range items {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+
+		if w.Buffered() >= streamFlushSize {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			res.Flush()
+		}
+	}
+
+	token, _ := json.Marshal(nextPageToken)
+	w.WriteString(`],"nextPageToken":`)
+	w.Write(token)
+	w.WriteString("}\n")
+
+	return w.Flush()
+}
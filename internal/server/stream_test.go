@@ -0,0 +1,75 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/labstack/echo/v4"
+	"github.com/shopspring/decimal"
+)
+
+func TestWriteList(t *testing.T) {
+	const n = 2000
+
+	calculations := make([]*income.Calculation, 0, n)
+	for i := range n {
+		calculations = append(calculations, &income.Calculation{
+			ID:               int64(n - i),
+			Number:           fmt.Sprintf("APP-%d", n-i),
+			Account:          income.Account{DisplayName: `Somchai "Sam" <ສົມໃຈ>`},
+			MonthlyNetIncome: decimal.NewFromInt(int64(i) * 1000),
+		})
+	}
+	result := &income.ListCalculationsResult{Calculations: calculations, NextPageToken: "eyJpZCI6IjEifQ"}
+
+	want, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		threshold int
+	}{
+		{name: "buffered", threshold: n},
+		{name: "streamed", threshold: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/v1/incomes/calculations", nil), rec)
+
+			if err := writeList(c, tt.threshold, result, "calculations", result.Calculations, result.NextPageToken); err != nil {
+				t.Fatalf("writeList() error = %v", err)
+			}
+			if rec.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if ct := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, echo.MIMEApplicationJSON) {
+				t.Errorf("content type = %q, want JSON", ct)
+			}
+
+			// The streamed response has the same shape and values as the marshaled result.
+			var got, wantJSON map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not valid JSON: %v", err)
+			}
+			if err := json.Unmarshal(want, &wantJSON); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, wantJSON) {
+				t.Errorf("response differs from the marshaled result")
+			}
+			if items, _ := got["calculations"].([]any); len(items) != n {
+				t.Errorf("got %d calculations, want %d", len(items), n)
+			}
+		})
+	}
+}
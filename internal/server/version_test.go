@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/10664kls/automatic-finance-api/internal/currency"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/10664kls/automatic-finance-api/internal/income"
+	"github.com/10664kls/automatic-finance-api/internal/statement"
+	"github.com/10664kls/automatic-finance-api/internal/version"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+func TestVersion(t *testing.T) {
+	injected := version.Info{Version: "v1.2.0", Commit: "4f28772", BuildTime: "2025-06-01T00:00:00Z"}
+	defaults := version.Get()
+	version.Version, version.Commit, version.BuildTime = injected.Version, injected.Commit, injected.BuildTime
+	t.Cleanup(func() {
+		version.Version, version.Commit, version.BuildTime = defaults.Version, defaults.Commit, defaults.BuildTime
+	})
+
+	// No statement is expected, the configuration is read from the services.
+	ctx := context.Background()
+	db, _ := dbtest.New(t)
+	currencySvc, err := currency.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := currencySvc.SetBaseCurrency("usd"); err != nil {
+		t.Fatal(err)
+	}
+	statementSvc, err := statement.NewService(ctx, db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomeSvc, err := income.NewService(ctx, db, currencySvc, statementSvc, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{currency: currencySvc, statement: statementSvc, income: incomeSvc}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/v1/version", nil), rec)
+	if err := s.version(c); err != nil {
+		t.Fatalf("version() error = %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"version":         injected.Version,
+		"commit":          injected.Commit,
+		"buildTime":       injected.BuildTime,
+		"baseCurrency":    "USD",
+		"decimalFormat":   "STRING",
+		"incomeDirection": "CREDITS",
+	}
+	for field, v := range want {
+		if got[field] != v {
+			t.Errorf("%s = %v, want %v", field, got[field], v)
+		}
+	}
+	if got["numberFormat"] == nil || got["numberFormat"] == "" {
+		t.Error("number format is not reported")
+	}
+
+	for _, secret := range []string{"key", "password", "secret", "dsn"} {
+		if strings.Contains(strings.ToLower(rec.Body.String()), secret) {
+			t.Errorf("response %s mentions %q", rec.Body.String(), secret)
+		}
+	}
+}
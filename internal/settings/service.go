@@ -0,0 +1,154 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// DefaultCacheTTL is how long the settings are cached before they are read from the database again,
+// so that the changes made through another instance are picked up.
+const DefaultCacheTTL = time.Minute
+
+type Service struct {
+	db       *sql.DB
+	zlog     *zap.Logger
+	mu       *sync.RWMutex
+	defaults Settings
+	cacheTTL time.Duration
+
+	cached    *Settings
+	expiresAt time.Time
+}
+
+func NewService(_ context.Context, db *sql.DB, zlog *zap.Logger) (*Service, error) {
+	if db == nil {
+		return nil, errors.New("db is nil")
+	}
+	if zlog == nil {
+		return nil, errors.New("logger is nil")
+	}
+
+	return &Service{
+		db:       db,
+		zlog:     zlog,
+		mu:       new(sync.RWMutex),
+		defaults: DefaultSettings,
+		cacheTTL: DefaultCacheTTL,
+	}, nil
+}
+
+// SetDefaults sets the settings used when they are not stored in the database,
+// e.g. the values configured by environment.
+func (s *Service) SetDefaults(d Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaults = d
+	s.cached = nil
+}
+
+// SetCacheTTL sets how long the settings are cached.
+// A value less than or equal to zero resets it to DefaultCacheTTL.
+func (s *Service) SetCacheTTL(d time.Duration) {
+	if d <= 0 {
+		d = DefaultCacheTTL
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cacheTTL = d
+}
+
+// Current returns the settings in effect, read from the cache while it has not expired.
+func (s *Service) Current(ctx context.Context) (Settings, error) {
+	s.mu.RLock()
+	if s.cached != nil && time.Now().Before(s.expiresAt) {
+		defer s.mu.RUnlock()
+		return *s.cached, nil
+	}
+	s.mu.RUnlock()
+
+	return s.load(ctx)
+}
+
+// load reads the settings from the database and caches them, unless another reader
+// has loaded them while this one waited for the write lock.
+func (s *Service) load(ctx context.Context) (Settings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cached != nil && time.Now().Before(s.expiresAt) {
+		return *s.cached, nil
+	}
+
+	settings, err := loadSettings(ctx, s.db, s.defaults)
+	if err != nil {
+		return Settings{}, err
+	}
+
+	s.cached = settings
+	s.expiresAt = time.Now().Add(s.cacheTTL)
+	return *settings, nil
+}
+
+// invalidate drops the cached settings, so the next read loads them from the database.
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cached = nil
+}
+
+func (s *Service) GetSettings(ctx context.Context) (*Settings, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "GetSettings"),
+		zap.String("Username", claims.Username),
+	)
+
+	settings, err := s.Current(ctx)
+	if err != nil {
+		zlog.Error("failed to get settings", zap.Error(err))
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings changes the given settings. Only admins are allowed to change the settings.
+// The change applies to the calculations made afterwards.
+func (s *Service) UpdateSettings(ctx context.Context, in *UpdateReq) (*Settings, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "UpdateSettings"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := saveSettings(ctx, s.db, in.values(), claims.Username, time.Now()); err != nil {
+		zlog.Error("failed to save settings", zap.Error(err))
+		return nil, err
+	}
+	s.invalidate()
+
+	return s.GetSettings(ctx)
+}
@@ -0,0 +1,129 @@
+package settings
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"github.com/shopspring/decimal"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// settingColumns are the columns selected by loadSettings.
+var settingColumns = []string{"name", "value", "updated_by", "updated_at"}
+
+func newTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	db, mock := dbtest.New(t)
+	s, err := NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+func TestLoadUsesSettingsLoadedWhileWaiting(t *testing.T) {
+	s, mock := newTestService(t)
+
+	// Another reader loaded the settings while this one waited for the write lock.
+	loaded := DefaultSettings
+	loaded.BaseCurrency = "THB"
+	s.cached = &loaded
+	s.expiresAt = time.Now().Add(time.Minute)
+
+	got, err := s.load(context.Background())
+	if err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if got.BaseCurrency != "THB" {
+		t.Errorf("base currency = %s, want the loaded THB", got.BaseCurrency)
+	}
+
+	// Once expired, the settings are loaded again.
+	s.expiresAt = time.Now().Add(-time.Second)
+	mock.ExpectQuery(`FROM settings`)
+	if got, err = s.load(context.Background()); err != nil {
+		t.Fatalf("load() error = %v", err)
+	}
+	if got.BaseCurrency != DefaultSettings.BaseCurrency {
+		t.Errorf("base currency = %s, want the default %s", got.BaseCurrency, DefaultSettings.BaseCurrency)
+	}
+}
+
+func TestCurrentOverridesDefaults(t *testing.T) {
+	updatedAt := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	s, mock := newTestService(t)
+	mock.ExpectQuery(`FROM settings`).WillReturnRows(settingColumns,
+		[]any{nameOtherIncomeFactor, "0.7", "admin@example.com", updatedAt},
+		[]any{nameCIBInstallmentPlaces, "2", "admin@example.com", updatedAt},
+		[]any{nameBaseCurrency, "THB", "admin@example.com", updatedAt},
+		[]any{nameSalaryVariationThreshold, "not a number", "admin@example.com", updatedAt},
+		[]any{"unknown", "1", "admin@example.com", updatedAt},
+	)
+
+	got, err := s.Current(context.Background())
+	if err != nil {
+		t.Fatalf("Current() error = %v", err)
+	}
+
+	if !got.OtherIncomeFactor.Equal(decimal.NewFromFloat(0.7)) {
+		t.Errorf("other income factor = %s, want 0.7", got.OtherIncomeFactor)
+	}
+	if got.CIBInstallmentPlaces != 2 {
+		t.Errorf("cib installment places = %d, want 2", got.CIBInstallmentPlaces)
+	}
+	if got.BaseCurrency != "THB" {
+		t.Errorf("base currency = %s, want THB", got.BaseCurrency)
+	}
+	// The malformed setting keeps its default.
+	if !got.SalaryVariationThreshold.Equal(DefaultSettings.SalaryVariationThreshold) {
+		t.Errorf("salary variation threshold = %s, want the default", got.SalaryVariationThreshold)
+	}
+}
+
+func TestUpdateReqValidate(t *testing.T) {
+	places := func(n int32) *int32 { return &n }
+	currency := func(code string) *string { return &code }
+
+	tests := []struct {
+		name     string
+		req      *UpdateReq
+		wantCode codes.Code
+	}{
+		{name: "nothing", req: &UpdateReq{}, wantCode: codes.InvalidArgument},
+		{name: "installment places", req: &UpdateReq{CIBInstallmentPlaces: places(2)}, wantCode: codes.OK},
+		{name: "negative installment places", req: &UpdateReq{CIBInstallmentPlaces: places(-1)}, wantCode: codes.InvalidArgument},
+		{name: "too many installment places", req: &UpdateReq{CIBInstallmentPlaces: places(maxCIBInstallmentPlaces + 1)}, wantCode: codes.InvalidArgument},
+		{name: "base currency", req: &UpdateReq{BaseCurrency: currency(" usd ")}, wantCode: codes.OK},
+		{name: "unknown base currency", req: &UpdateReq{BaseCurrency: currency("XYZ")}, wantCode: codes.InvalidArgument},
+		{name: "empty base currency", req: &UpdateReq{BaseCurrency: currency("")}, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rpcStatus.Code(tt.req.Validate()); got != tt.wantCode {
+				t.Errorf("Validate() code = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestUpdateReqValues(t *testing.T) {
+	places := int32(2)
+	currency := " thb "
+	req := &UpdateReq{CIBInstallmentPlaces: &places, BaseCurrency: &currency}
+	if err := req.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	values := req.values()
+	if values[nameCIBInstallmentPlaces] != "2" || values[nameBaseCurrency] != "THB" {
+		t.Errorf("values() = %v, want the installment places 2 and the base currency THB", values)
+	}
+}
@@ -0,0 +1,370 @@
+package settings
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/database"
+	sq "github.com/Masterminds/squirrel"
+	"github.com/biter777/countries"
+	"github.com/shopspring/decimal"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// Names of the settings as stored in the settings table.
+const (
+	nameOtherIncomeFactor        = "income.other_income_factor"
+	nameOtherIncomeCapPercentage = "income.other_income_cap_percentage"
+	nameSalaryVariationThreshold = "income.salary_variation_threshold"
+	nameCIBMinFinanceAmount      = "cib.min_finance_amount"
+	nameExcludedNotePrefixes     = "income.excluded_note_prefixes"
+	nameCIBInstallmentPlaces     = "cib.installment_rounding_places"
+	nameBaseCurrency             = "currency.base_currency"
+)
+
+const (
+	// maxExcludedNotePrefixes is the maximum number of excluded note prefixes.
+	maxExcludedNotePrefixes = 100
+
+	// maxExcludedNotePrefixLength is the maximum length of an excluded note prefix.
+	maxExcludedNotePrefixLength = 100
+
+	// maxCIBInstallmentPlaces is the maximum number of decimal places the CIB installments are rounded to.
+	maxCIBInstallmentPlaces = 6
+)
+
+// Settings are the knobs of the calculations that can be adjusted at runtime.
+type Settings struct {
+	// OtherIncomeFactor is the part of the other income counted in the monthly average income
+	// of PL/SF products, between 0 and 1, e.g. 0.8.
+	OtherIncomeFactor decimal.Decimal `json:"otherIncomeFactor"`
+
+	// OtherIncomeCapPercentage caps the other income of PL/SF products at this percentage
+	// of the basic salary. Zero means no cap.
+	OtherIncomeCapPercentage decimal.Decimal `json:"otherIncomeCapPercentage"`
+
+	// SalaryVariationThreshold is the coefficient of variation of the monthly salaries
+	// above which a calculation is flagged as volatile. Zero disables the flag.
+	SalaryVariationThreshold decimal.Decimal `json:"salaryVariationThreshold"`
+
+	// CIBMinFinanceAmount is the finance amount in the base currency below which
+	// active CIB contracts are negligible. Zero excludes no contract.
+	CIBMinFinanceAmount decimal.Decimal `json:"cibMinFinanceAmount"`
+
+	// ExcludedNotePrefixes are the prefixes of the statement notes never counted as income,
+	// e.g. the internal transfers or the reversals, whatever wordlist they match. The case is ignored.
+	ExcludedNotePrefixes []string `json:"excludedNotePrefixes"`
+
+	// CIBInstallmentPlaces is the number of decimal places the CIB installments converted
+	// to the base currency are rounded to, e.g. 0 rounds to the whole LAK.
+	CIBInstallmentPlaces int32 `json:"cibInstallmentPlaces"`
+
+	// BaseCurrency is the ISO 4217 code of the currency the net incomes and installments are converted to.
+	BaseCurrency string `json:"baseCurrency"`
+
+	UpdatedBy string    `json:"updatedBy"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DefaultSettings are the settings used when neither the database nor the service defaults set them.
+var DefaultSettings = Settings{
+	OtherIncomeFactor:        decimal.NewFromFloat(0.8),
+	OtherIncomeCapPercentage: decimal.Zero,
+	SalaryVariationThreshold: decimal.Zero,
+	CIBMinFinanceAmount:      decimal.Zero,
+	ExcludedNotePrefixes:     []string{},
+	CIBInstallmentPlaces:     0,
+	BaseCurrency:             "LAK",
+}
+
+// UpdateReq changes the given settings, leaving the others as they are.
+type UpdateReq struct {
+	OtherIncomeFactor        *decimal.Decimal `json:"otherIncomeFactor"`
+	OtherIncomeCapPercentage *decimal.Decimal `json:"otherIncomeCapPercentage"`
+	SalaryVariationThreshold *decimal.Decimal `json:"salaryVariationThreshold"`
+	CIBMinFinanceAmount      *decimal.Decimal `json:"cibMinFinanceAmount"`
+	ExcludedNotePrefixes     *[]string        `json:"excludedNotePrefixes"`
+	CIBInstallmentPlaces     *int32           `json:"cibInstallmentPlaces"`
+	BaseCurrency             *string          `json:"baseCurrency"`
+}
+
+func (r *UpdateReq) Validate() error {
+	violations := make([]*edPb.BadRequest_FieldViolation, 0)
+
+	if r.OtherIncomeFactor == nil &&
+		r.OtherIncomeCapPercentage == nil &&
+		r.SalaryVariationThreshold == nil &&
+		r.CIBMinFinanceAmount == nil &&
+		r.ExcludedNotePrefixes == nil &&
+		r.CIBInstallmentPlaces == nil &&
+		r.BaseCurrency == nil {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "settings",
+			Description: "At least one setting must be given",
+		})
+	}
+
+	if v := r.OtherIncomeFactor; v != nil && (!v.IsPositive() || v.GreaterThan(decimal.NewFromInt(1))) {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "otherIncomeFactor",
+			Description: "Other income factor must be greater than 0 and at most 1",
+		})
+	}
+
+	if v := r.OtherIncomeCapPercentage; v != nil && (v.IsNegative() || v.GreaterThan(decimal.NewFromInt(100))) {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "otherIncomeCapPercentage",
+			Description: "Other income cap percentage must be between 0 and 100",
+		})
+	}
+
+	if v := r.SalaryVariationThreshold; v != nil && v.IsNegative() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "salaryVariationThreshold",
+			Description: "Salary variation threshold must not be negative",
+		})
+	}
+
+	if v := r.CIBMinFinanceAmount; v != nil && v.IsNegative() {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "cibMinFinanceAmount",
+			Description: "CIB minimum finance amount must not be negative",
+		})
+	}
+
+	if r.ExcludedNotePrefixes != nil {
+		prefixes := *r.ExcludedNotePrefixes
+		if len(prefixes) > maxExcludedNotePrefixes {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       "excludedNotePrefixes",
+				Description: fmt.Sprintf("Excluded note prefixes must not contain more than %d prefixes", maxExcludedNotePrefixes),
+			})
+		}
+
+		for i, p := range prefixes {
+			prefixes[i] = strings.TrimSpace(p)
+			if prefixes[i] == "" || len(prefixes[i]) > maxExcludedNotePrefixLength {
+				violations = append(violations, &edPb.BadRequest_FieldViolation{
+					Field:       fmt.Sprintf("excludedNotePrefixes[%d]", i),
+					Description: fmt.Sprintf("Excluded note prefix must not be empty or longer than %d characters", maxExcludedNotePrefixLength),
+				})
+			}
+		}
+	}
+
+	if v := r.CIBInstallmentPlaces; v != nil && (*v < 0 || *v > maxCIBInstallmentPlaces) {
+		violations = append(violations, &edPb.BadRequest_FieldViolation{
+			Field:       "cibInstallmentPlaces",
+			Description: fmt.Sprintf("CIB installment places must be between 0 and %d", maxCIBInstallmentPlaces),
+		})
+	}
+
+	if r.BaseCurrency != nil {
+		*r.BaseCurrency = strings.ToUpper(strings.TrimSpace(*r.BaseCurrency))
+		if !countries.CurrencyCodeByName(*r.BaseCurrency).IsValid() {
+			violations = append(violations, &edPb.BadRequest_FieldViolation{
+				Field:       "baseCurrency",
+				Description: "Base currency must be a valid ISO 4217 currency code",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Settings are not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: violations,
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+// values returns the stored values of the settings of the request by name.
+// The lists are stored as JSON arrays.
+func (r *UpdateReq) values() map[string]string {
+	values := make(map[string]string)
+	if r.OtherIncomeFactor != nil {
+		values[nameOtherIncomeFactor] = r.OtherIncomeFactor.String()
+	}
+	if r.OtherIncomeCapPercentage != nil {
+		values[nameOtherIncomeCapPercentage] = r.OtherIncomeCapPercentage.String()
+	}
+	if r.SalaryVariationThreshold != nil {
+		values[nameSalaryVariationThreshold] = r.SalaryVariationThreshold.String()
+	}
+	if r.CIBMinFinanceAmount != nil {
+		values[nameCIBMinFinanceAmount] = r.CIBMinFinanceAmount.String()
+	}
+	if r.ExcludedNotePrefixes != nil {
+		b, _ := json.Marshal(*r.ExcludedNotePrefixes)
+		values[nameExcludedNotePrefixes] = string(b)
+	}
+	if r.CIBInstallmentPlaces != nil {
+		values[nameCIBInstallmentPlaces] = strconv.FormatInt(int64(*r.CIBInstallmentPlaces), 10)
+	}
+	if r.BaseCurrency != nil {
+		values[nameBaseCurrency] = *r.BaseCurrency
+	}
+
+	return values
+}
+
+// set sets the setting of the given name from its stored value
+// and reports whether the name is known and the value well formed.
+func (s *Settings) set(name, value string) bool {
+	switch name {
+	case nameExcludedNotePrefixes:
+		prefixes := make([]string, 0)
+		if err := json.Unmarshal([]byte(value), &prefixes); err != nil {
+			return false
+		}
+		s.ExcludedNotePrefixes = prefixes
+		return true
+	case nameCIBInstallmentPlaces:
+		places, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || places < 0 || places > maxCIBInstallmentPlaces {
+			return false
+		}
+		s.CIBInstallmentPlaces = int32(places)
+		return true
+	case nameBaseCurrency:
+		if !countries.CurrencyCodeByName(value).IsValid() {
+			return false
+		}
+		s.BaseCurrency = value
+		return true
+	}
+
+	field := s.field(name)
+	if field == nil {
+		return false
+	}
+
+	d, err := decimal.NewFromString(value)
+	if err != nil {
+		return false
+	}
+	*field = d
+	return true
+}
+
+// field returns the decimal setting of the given name, or nil if the name is not known.
+func (s *Settings) field(name string) *decimal.Decimal {
+	switch name {
+	case nameOtherIncomeFactor:
+		return &s.OtherIncomeFactor
+	case nameOtherIncomeCapPercentage:
+		return &s.OtherIncomeCapPercentage
+	case nameSalaryVariationThreshold:
+		return &s.SalaryVariationThreshold
+	case nameCIBMinFinanceAmount:
+		return &s.CIBMinFinanceAmount
+	}
+
+	return nil
+}
+
+// loadSettings overrides the defaults with the settings stored in the database.
+// Unknown or malformed settings are ignored.
+func loadSettings(ctx context.Context, db *sql.DB, defaults Settings) (*Settings, error) {
+	q, args := sq.
+		Select(
+			"name",
+			"value",
+			"updated_by",
+			"updated_at",
+		).
+		From("settings").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query for listing settings: %w", err)
+	}
+	defer rows.Close()
+
+	s := defaults
+	for rows.Next() {
+		var name, value, updatedBy string
+		var updatedAt time.Time
+		if err := rows.Scan(&name, &value, &updatedBy, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan setting: %w", err)
+		}
+
+		if !s.set(name, value) {
+			continue
+		}
+
+		if updatedAt.After(s.UpdatedAt) {
+			s.UpdatedAt = updatedAt
+			s.UpdatedBy = updatedBy
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate settings: %w", err)
+	}
+
+	return &s, nil
+}
+
+// saveSettings upserts the given settings.
+func saveSettings(ctx context.Context, db *sql.DB, values map[string]string, by string, at time.Time) error {
+	return database.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		for name, value := range values {
+			q, args := sq.Update("settings").
+				Set("value", value).
+				Set("updated_by", by).
+				Set("updated_at", at).
+				Where(sq.Eq{"name": name}).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			result, err := tx.ExecContext(ctx, q, args...)
+			if err != nil {
+				return fmt.Errorf("failed to update setting %s: %w", name, err)
+			}
+
+			rowsAffected, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("failed to get rows affected: %w", err)
+			}
+			if rowsAffected > 0 {
+				continue
+			}
+
+			q, args = sq.Insert("settings").
+				Columns(
+					"name",
+					"value",
+					"updated_by",
+					"updated_at",
+				).
+				Values(
+					name,
+					value,
+					by,
+					at,
+				).
+				PlaceholderFormat(sq.AtP).
+				MustSql()
+
+			if _, err := tx.ExecContext(ctx, q, args...); err != nil {
+				return fmt.Errorf("failed to insert setting %s: %w", name, err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,222 @@
+package statement
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	sq "github.com/Masterminds/squirrel"
+	"go.uber.org/zap"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// DefaultFileRetention is how long the statement files no longer referenced by any calculation
+// are kept when no other retention is configured.
+const DefaultFileRetention = 180 * 24 * time.Hour
+
+// cleanupBatchSize is the number of statement files checked per batch by the cleanup.
+const cleanupBatchSize = 200
+
+// unreferencedStatementFile is the condition of the statement files no longer referenced
+// by any income or selfemployed calculation.
+const unreferencedStatementFile = "NOT EXISTS (SELECT 1 FROM statement_file_analysis WHERE statement_file_analysis.statement_file_name = statement_file.file_name)" +
+	" AND NOT EXISTS (SELECT 1 FROM self_employed_analysis WHERE self_employed_analysis.statement_file_name = statement_file.file_name)"
+
+type CleanupFilesReq struct {
+	// RetentionDays overrides the configured retention, in days.
+	RetentionDays int `json:"retentionDays"`
+}
+
+func (r *CleanupFilesReq) Validate() error {
+	if r.RetentionDays < 0 {
+		s, _ := rpcStatus.New(
+			codes.InvalidArgument,
+			"Cleanup is not valid or incomplete. Please check the errors and try again, see details for more information.",
+		).WithDetails(&edPb.BadRequest{
+			FieldViolations: []*edPb.BadRequest_FieldViolation{
+				{
+					Field:       "retentionDays",
+					Description: "Retention days must not be negative",
+				},
+			},
+		})
+
+		return s.Err()
+	}
+
+	return nil
+}
+
+type CleanupFilesResult struct {
+	// Removed are the names of the removed files.
+	Removed []string `json:"removed"`
+}
+
+// SetFileRetention sets how long the statement files no longer referenced by any calculation are kept.
+// A value less than or equal to zero resets it to DefaultFileRetention.
+func (s *Service) SetFileRetention(d time.Duration) {
+	if d <= 0 {
+		d = DefaultFileRetention
+	}
+	s.fileRetention = d
+}
+
+// CleanupFiles removes the statement files older than the retention that are no longer referenced
+// by any calculation. Only admins are allowed to clean up the files.
+func (s *Service) CleanupFiles(ctx context.Context, in *CleanupFilesReq) (*CleanupFilesResult, error) {
+	claims := auth.ClaimsFromContext(ctx)
+
+	zlog := s.zlog.With(
+		zap.String("Method", "CleanupFiles"),
+		zap.String("Username", claims.Username),
+		zap.Any("req", in),
+	)
+
+	if !claims.IsAdmin {
+		return nil, rpcStatus.Error(codes.PermissionDenied, "You are not allowed to this resource or (it may not exist)")
+	}
+
+	if err := in.Validate(); err != nil {
+		return nil, err
+	}
+
+	retention := s.fileRetention
+	if in.RetentionDays > 0 {
+		retention = time.Duration(in.RetentionDays) * 24 * time.Hour
+	}
+
+	result, err := s.removeUnreferencedFiles(ctx, zlog, time.Now().Add(-retention))
+	if err != nil {
+		zlog.Error("failed to clean up files", zap.Error(err))
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RemoveExpiredFiles removes the statement files older than the configured retention
+// that are no longer referenced by any calculation. It is run by the background cleanup.
+func (s *Service) RemoveExpiredFiles(ctx context.Context) (*CleanupFilesResult, error) {
+	zlog := s.zlog.With(
+		zap.String("Method", "RemoveExpiredFiles"),
+	)
+
+	return s.removeUnreferencedFiles(ctx, zlog, time.Now().Add(-s.fileRetention))
+}
+
+func (s *Service) removeUnreferencedFiles(ctx context.Context, zlog *zap.Logger, before time.Time) (*CleanupFilesResult, error) {
+	result := &CleanupFilesResult{
+		Removed: make([]string, 0),
+	}
+
+	var afterID int64
+	for {
+		files, err := listUnreferencedStatementFiles(ctx, s.db, before, afterID)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			break
+		}
+		afterID = files[len(files)-1].ID
+
+		for _, f := range files {
+			deleted, err := deleteUnreferencedStatementFile(ctx, s.db, f.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !deleted {
+				continue // referenced in the meantime
+			}
+
+			if err := os.Remove(f.Location); err != nil && !errors.Is(err, os.ErrNotExist) {
+				zlog.Warn("failed to remove statement file from disk", zap.String("Name", f.Name), zap.Error(err))
+			}
+
+			zlog.Info("removed unreferenced statement file",
+				zap.String("Name", f.Name),
+				zap.String("OriginalName", f.OriginalName),
+				zap.Time("CreatedAt", f.CreatedAt),
+			)
+			result.Removed = append(result.Removed, f.Name)
+		}
+	}
+
+	return result, nil
+}
+
+// listUnreferencedStatementFiles lists the statement files created before the given time
+// that are no longer referenced by any calculation, with an ID greater than afterID.
+func listUnreferencedStatementFiles(ctx context.Context, db *sql.DB, before time.Time, afterID int64) ([]*StatementFile, error) {
+	q, args := sq.Select(
+		fmt.Sprintf("TOP %d id", cleanupBatchSize),
+		"original_file_name",
+		"file_name",
+		"location",
+		"created_by",
+		"created_at",
+	).
+		From("statement_file").
+		Where(sq.Gt{"id": afterID}).
+		Where(sq.Lt{"created_at": before}).
+		Where(unreferencedStatementFile).
+		OrderBy("id ASC").
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list unreferenced statement files: %w", err)
+	}
+	defer rows.Close()
+
+	files := make([]*StatementFile, 0)
+	for rows.Next() {
+		f := new(StatementFile)
+		if err := rows.Scan(
+			&f.ID,
+			&f.OriginalName,
+			&f.Name,
+			&f.Location,
+			&f.CreatedBy,
+			&f.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan statement file: %w", err)
+		}
+
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate statement files: %w", err)
+	}
+
+	return files, nil
+}
+
+// deleteUnreferencedStatementFile deletes the statement file of the given ID
+// unless it is referenced by a calculation, and reports whether it was deleted.
+func deleteUnreferencedStatementFile(ctx context.Context, db *sql.DB, id int64) (bool, error) {
+	q, args := sq.Delete("statement_file").
+		Where(sq.Eq{"id": id}).
+		Where(unreferencedStatementFile).
+		PlaceholderFormat(sq.AtP).
+		MustSql()
+
+	result, err := db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete statement file: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
@@ -0,0 +1,121 @@
+package statement
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/10664kls/automatic-finance-api/internal/auth"
+	"github.com/10664kls/automatic-finance-api/internal/database/dbtest"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// statementFileColumns are the columns selected by listUnreferencedStatementFiles.
+var statementFileColumns = []string{"id", "original_file_name", "file_name", "location", "created_by", "created_at"}
+
+func newTestService(t *testing.T) (*Service, *dbtest.Mock) {
+	t.Helper()
+
+	db, mock := dbtest.New(t)
+	s, err := NewService(context.Background(), db, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s, mock
+}
+
+func writeTestFile(t *testing.T, dir, name string) string {
+	t.Helper()
+
+	location := filepath.Join(dir, name)
+	if err := os.WriteFile(location, []byte("statement"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return location
+}
+
+func TestRemoveExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	unreferenced := writeTestFile(t, dir, "unreferenced.xlsx")
+	referenced := writeTestFile(t, dir, "referenced.xlsx")
+	createdAt := time.Now().AddDate(-1, 0, 0)
+
+	s, mock := newTestService(t)
+	s.SetFileRetention(30 * 24 * time.Hour)
+
+	// Only the files older than the retention and referenced by neither an income
+	// nor a selfemployed calculation are listed.
+	unreferencedOnly := `FROM statement_file WHERE id > @p1 AND created_at < @p2` +
+		` AND NOT EXISTS \(SELECT 1 FROM statement_file_analysis .*\)` +
+		` AND NOT EXISTS \(SELECT 1 FROM self_employed_analysis .*\)`
+	list := mock.ExpectQuery(unreferencedOnly).
+		WillReturnRows(statementFileColumns,
+			[]any{1, "january.xlsx", "unreferenced.xlsx", unreferenced, "user@example.com", createdAt},
+			[]any{2, "february.xlsx", "referenced.xlsx", referenced, "user@example.com", createdAt},
+		)
+	mock.ExpectQuery(`FROM statement_file WHERE id > @p1`)
+	mock.ExpectExec(`DELETE FROM statement_file WHERE id = @p1 AND NOT EXISTS`)
+	// The second file has been referenced by a calculation since it was listed.
+	mock.ExpectExec(`DELETE FROM statement_file WHERE id = @p1 AND NOT EXISTS`).WillReturnResult(0)
+
+	result, err := s.RemoveExpiredFiles(context.Background())
+	if err != nil {
+		t.Fatalf("RemoveExpiredFiles() error = %v", err)
+	}
+
+	if want := []string{"unreferenced.xlsx"}; !reflect.DeepEqual(result.Removed, want) {
+		t.Errorf("removed = %v, want %v", result.Removed, want)
+	}
+	if _, err := os.Stat(unreferenced); !os.IsNotExist(err) {
+		t.Errorf("the unreferenced file is still on disk: %v", err)
+	}
+	if _, err := os.Stat(referenced); err != nil {
+		t.Errorf("the referenced file is not on disk: %v", err)
+	}
+
+	// The files created within the retention are kept.
+	before, _ := list.Args()[1].(time.Time)
+	if want := time.Now().Add(-30 * 24 * time.Hour); before.After(want) || before.Before(want.Add(-time.Minute)) {
+		t.Errorf("files created before %v are listed, want before %v", before, want)
+	}
+}
+
+func TestCleanupFiles(t *testing.T) {
+	admin := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "admin@example.com", Role: auth.RoleAdmin, IsAdmin: true})
+	user := auth.ContextWithClaims(context.Background(), &auth.Claims{Username: "user@example.com", Role: auth.RoleUser})
+
+	t.Run("retention days", func(t *testing.T) {
+		s, mock := newTestService(t)
+		list := mock.ExpectQuery(`FROM statement_file WHERE id > @p1`)
+
+		if _, err := s.CleanupFiles(admin, &CleanupFilesReq{RetentionDays: 7}); err != nil {
+			t.Fatalf("CleanupFiles() error = %v", err)
+		}
+
+		before, _ := list.Args()[1].(time.Time)
+		if want := time.Now().AddDate(0, 0, -7); before.After(want) || before.Before(want.Add(-time.Minute)) {
+			t.Errorf("files created before %v are listed, want before %v", before, want)
+		}
+	})
+
+	t.Run("not an admin", func(t *testing.T) {
+		s, _ := newTestService(t)
+		if _, err := s.CleanupFiles(user, &CleanupFilesReq{}); rpcStatus.Code(err) != codes.PermissionDenied {
+			t.Errorf("CleanupFiles() error = %v, want PermissionDenied", err)
+		}
+	})
+
+	t.Run("negative retention days", func(t *testing.T) {
+		s, _ := newTestService(t)
+		if _, err := s.CleanupFiles(admin, &CleanupFilesReq{RetentionDays: -1}); rpcStatus.Code(err) != codes.InvalidArgument {
+			t.Errorf("CleanupFiles() error = %v, want InvalidArgument", err)
+		}
+	})
+}
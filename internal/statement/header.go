@@ -0,0 +1,88 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// headerSearchRows is the number of rows searched for the header row of the transactions.
+const headerSearchRows = 50
+
+// CheckHeader checks that the sheet of the statement file has a row holding every header label
+// of the layout, so a file of another template is rejected before its transactions are read.
+// It returns InvalidArgument with the labels missing from the closest row.
+func (s *Service) CheckHeader(file *StatementFile) error {
+	labels := s.layout.HeaderLabels
+	if len(labels) == 0 {
+		return nil
+	}
+
+	f, err := excelize.OpenFile(file.Location)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", file.Name, err)
+	}
+	defer f.Close()
+
+	const sheetName = "Table 1"
+
+	rows, err := f.Rows(sheetName)
+	if err != nil {
+		return fmt.Errorf("failed to get rows: %w", err)
+	}
+	defer rows.Close()
+
+	missing := labels
+	for i := 0; i < headerSearchRows && rows.Next(); i++ {
+		row, err := rows.Columns()
+		if err != nil {
+			return fmt.Errorf("failed to get row columns: %w", err)
+		}
+
+		if m := missingHeaderLabels(row, labels); len(m) < len(missing) {
+			missing = m
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+	}
+
+	violations := make([]*edPb.BadRequest_FieldViolation, len(missing))
+	for i, label := range missing {
+		violations[i] = &edPb.BadRequest_FieldViolation{
+			Field:       "statementFileName",
+			Description: fmt.Sprintf("Statement file is missing the %q column", label),
+		}
+	}
+
+	st, _ := rpcStatus.New(
+		codes.InvalidArgument,
+		"Statement file does not match the expected template. Please check the errors and try again, see details for more information.",
+	).WithDetails(&edPb.BadRequest{
+		FieldViolations: violations,
+	})
+
+	return st.Err()
+}
+
+// missingHeaderLabels returns the labels not found in any cell of the row,
+// compared case-insensitively and ignoring the surrounding spaces.
+func missingHeaderLabels(row []string, labels []string) []string {
+	cells := make(map[string]bool, len(row))
+	for _, c := range row {
+		cells[strings.ToLower(strings.TrimSpace(c))] = true
+	}
+
+	missing := make([]string, 0)
+	for _, label := range labels {
+		if !cells[strings.ToLower(strings.TrimSpace(label))] {
+			missing = append(missing, label)
+		}
+	}
+
+	return missing
+}
@@ -0,0 +1,115 @@
+package statement
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+	edPb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	rpcStatus "google.golang.org/grpc/status"
+)
+
+// writeStatementFixture writes a statement file whose transactions sheet holds the given rows.
+func writeStatementFixture(t *testing.T, rows [][]any) *StatementFile {
+	t.Helper()
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	const sheetName = "Table 1"
+	if err := f.SetSheetName("Sheet1", sheetName); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(sheetName, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	location := filepath.Join(t.TempDir(), "statement.xlsx")
+	if err := f.SaveAs(location); err != nil {
+		t.Fatal(err)
+	}
+
+	return &StatementFile{Name: "statement.xlsx", Location: location}
+}
+
+func TestCheckHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		rows        [][]any
+		wantMissing []string
+	}{
+		{
+			name: "header row below the account cells",
+			rows: [][]any{
+				{"Statement of account"},
+				{"Account number", "0100001"},
+				{" date ", "Bill No.", "DESCRIPTION", "", "Amount"},
+				{"15/01/2025", "B1", "Salary January", "", "5000000"},
+			},
+		},
+		{
+			name: "header-less file",
+			rows: [][]any{
+				{"15/01/2025", "B1", "Salary January", "", "5000000"},
+				{"16/01/2025", "B2", "Transfer", "", "100000"},
+			},
+			wantMissing: []string{"Date", "Description"},
+		},
+		{
+			name: "other template",
+			rows: [][]any{
+				{"Date", "Narrative", "Amount"},
+				{"15/01/2025", "Salary January", "5000000"},
+			},
+			wantMissing: []string{"Description"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t)
+			err := s.CheckHeader(writeStatementFixture(t, tt.rows))
+			if len(tt.wantMissing) == 0 {
+				if err != nil {
+					t.Fatalf("CheckHeader() error = %v", err)
+				}
+				return
+			}
+
+			st, ok := rpcStatus.FromError(err)
+			if !ok || st.Code() != codes.InvalidArgument {
+				t.Fatalf("CheckHeader() error = %v, want InvalidArgument", err)
+			}
+			var violations []*edPb.BadRequest_FieldViolation
+			for _, d := range st.Details() {
+				if br, ok := d.(*edPb.BadRequest); ok {
+					violations = br.GetFieldViolations()
+				}
+			}
+			if len(violations) != len(tt.wantMissing) {
+				t.Fatalf("violations = %v, want one for each of %v", violations, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestSetLayoutKeepsDefaultHeaderLabels(t *testing.T) {
+	s, _ := newTestService(t)
+	if err := s.SetLayout(StatementLayout{HeaderLabels: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Layout().HeaderLabels; len(got) != len(DefaultStatementLayout.HeaderLabels) {
+		t.Errorf("header labels = %v, want %v", got, DefaultStatementLayout.HeaderLabels)
+	}
+
+	if err := s.SetLayout(StatementLayout{HeaderLabels: []string{"Posting date"}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Layout().HeaderLabels; len(got) != 1 || got[0] != "Posting date" {
+		t.Errorf("header labels = %v, want [Posting date]", got)
+	}
+}
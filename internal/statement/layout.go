@@ -0,0 +1,86 @@
+package statement
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// StatementLayout is the location of the header cells of a statement file.
+// The cells are addressed in the A1 notation.
+type StatementLayout struct {
+	Period             string `json:"period"`
+	AccountNumber      string `json:"accountNumber"`
+	AccountDisplayName string `json:"accountDisplayName"`
+	AccountCurrency    string `json:"accountCurrency"`
+
+	// HeaderLabels are the labels of the columns the header row of the transactions must have,
+	// see Service.CheckHeader.
+	HeaderLabels []string `json:"headerLabels"`
+}
+
+// DefaultStatementLayout is the layout of the statement files of the bank,
+// used when no other layout is configured.
+var DefaultStatementLayout = StatementLayout{
+	Period:             "A7",
+	AccountNumber:      "A9",
+	AccountDisplayName: "A10",
+	AccountCurrency:    "A11",
+	HeaderLabels:       []string{"Date", "Description"},
+}
+
+// withDefaults returns the layout with the empty cells and header labels replaced by those of DefaultStatementLayout.
+func (l StatementLayout) withDefaults() StatementLayout {
+	if l.Period == "" {
+		l.Period = DefaultStatementLayout.Period
+	}
+	if l.AccountNumber == "" {
+		l.AccountNumber = DefaultStatementLayout.AccountNumber
+	}
+	if l.AccountDisplayName == "" {
+		l.AccountDisplayName = DefaultStatementLayout.AccountDisplayName
+	}
+	if l.AccountCurrency == "" {
+		l.AccountCurrency = DefaultStatementLayout.AccountCurrency
+	}
+	if len(l.HeaderLabels) == 0 {
+		l.HeaderLabels = DefaultStatementLayout.HeaderLabels
+	}
+	return l
+}
+
+// validate checks that every cell of the layout is a valid cell address.
+func (l StatementLayout) validate() error {
+	for _, cell := range []struct {
+		name string
+		addr string
+	}{
+		{"period", l.Period},
+		{"account number", l.AccountNumber},
+		{"account display name", l.AccountDisplayName},
+		{"account currency", l.AccountCurrency},
+	} {
+		if _, _, err := excelize.CellNameToCoordinates(cell.addr); err != nil {
+			return fmt.Errorf("%s cell %q is not a valid cell address: %w", cell.name, cell.addr, err)
+		}
+	}
+
+	return nil
+}
+
+// SetLayout sets the layout used to read the header cells of the statement files.
+// The empty cells and header labels of the layout keep those of DefaultStatementLayout.
+func (s *Service) SetLayout(l StatementLayout) error {
+	l = l.withDefaults()
+	if err := l.validate(); err != nil {
+		return err
+	}
+
+	s.layout = l
+	return nil
+}
+
+// Layout returns the layout used to read the header cells of the statement files.
+func (s *Service) Layout() StatementLayout {
+	return s.layout
+}
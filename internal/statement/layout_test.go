@@ -0,0 +1,50 @@
+package statement
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetLayout(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  StatementLayout
+		want    StatementLayout
+		wantErr bool
+	}{
+		{
+			name:   "empty cells keep the defaults",
+			layout: StatementLayout{Period: "B2", AccountCurrency: "B5"},
+			want: StatementLayout{
+				Period:             "B2",
+				AccountNumber:      DefaultStatementLayout.AccountNumber,
+				AccountDisplayName: DefaultStatementLayout.AccountDisplayName,
+				AccountCurrency:    "B5",
+				HeaderLabels:       DefaultStatementLayout.HeaderLabels,
+			},
+		},
+		{
+			name:    "invalid cell address",
+			layout:  StatementLayout{AccountCurrency: "5B"},
+			want:    DefaultStatementLayout,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{layout: DefaultStatementLayout}
+			err := s.SetLayout(tt.layout)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetLayout() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			got := s.Layout()
+			if got.Period != tt.want.Period || got.AccountNumber != tt.want.AccountNumber ||
+				got.AccountDisplayName != tt.want.AccountDisplayName || got.AccountCurrency != tt.want.AccountCurrency ||
+				!slices.Equal(got.HeaderLabels, tt.want.HeaderLabels) {
+				t.Errorf("Layout() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package statement
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// NumberFormat is how the amounts of the statement files are written.
+type NumberFormat string
+
+const (
+	// NumberFormatDot writes the amounts with a decimal dot and comma thousands separators, e.g. 1,234.56.
+	NumberFormatDot NumberFormat = "DOT"
+
+	// NumberFormatComma writes the amounts with a decimal comma and dot thousands separators, e.g. 1.234,56.
+	NumberFormatComma NumberFormat = "COMMA"
+
+	// NumberFormatAuto detects the separators of each amount.
+	// The amounts that could be written either way, e.g. 1,234, are read with a decimal dot.
+	NumberFormatAuto NumberFormat = "AUTO"
+)
+
+// DefaultNumberFormat is the number format used when no other format is configured.
+const DefaultNumberFormat = NumberFormatDot
+
+// ParseNumberFormat parses the number format of the given name, e.g. "comma".
+func ParseNumberFormat(s string) (NumberFormat, error) {
+	f := NumberFormat(strings.ToUpper(strings.TrimSpace(s)))
+	switch f {
+	case NumberFormatDot, NumberFormatComma, NumberFormatAuto:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("invalid number format %q, must be one of %s, %s or %s",
+		s, NumberFormatDot, NumberFormatComma, NumberFormatAuto)
+}
+
+func (f NumberFormat) String() string {
+	return string(f)
+}
+
+// ParseAmount parses the amount written in this number format.
+func (f NumberFormat) ParseAmount(raw string) (decimal.Decimal, error) {
+	raw = strings.TrimSpace(raw)
+
+	switch f {
+	case NumberFormatComma:
+		return parseAmount(raw, ",", ".")
+	case NumberFormatAuto:
+		decimalSep, thousandsSep := detectSeparators(raw)
+		return parseAmount(raw, decimalSep, thousandsSep)
+	default:
+		return parseAmount(raw, ".", ",")
+	}
+}
+
+func parseAmount(raw, decimalSep, thousandsSep string) (decimal.Decimal, error) {
+	raw = strings.ReplaceAll(raw, thousandsSep, "")
+	if decimalSep != "." {
+		raw = strings.Replace(raw, decimalSep, ".", 1)
+	}
+
+	return decimal.NewFromString(raw)
+}
+
+// detectSeparators returns the decimal and thousands separators the amount is written with.
+func detectSeparators(raw string) (decimalSep, thousandsSep string) {
+	lastDot := strings.LastIndex(raw, ".")
+	lastComma := strings.LastIndex(raw, ",")
+
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		// The last separator is the decimal one, e.g. 1.234,56 or 1,234.56.
+		if lastComma > lastDot {
+			return ",", "."
+		}
+
+	case lastComma >= 0:
+		// A single comma not followed by three digits is a decimal comma, e.g. 1234,5.
+		if strings.Count(raw, ",") == 1 && len(raw)-lastComma-1 != 3 {
+			return ",", "."
+		}
+
+	case lastDot >= 0:
+		// Several dots are thousands separators, e.g. 1.234.567.
+		if strings.Count(raw, ".") > 1 {
+			return ",", "."
+		}
+	}
+
+	return ".", ","
+}
+
+// SetNumberFormat sets how the amounts of the statement files are written.
+// Empty resets it to DefaultNumberFormat.
+func (s *Service) SetNumberFormat(f NumberFormat) {
+	if f == "" {
+		f = DefaultNumberFormat
+	}
+	s.numberFormat = f
+}
+
+// NumberFormat returns how the amounts of the statement files are written.
+func (s *Service) NumberFormat() NumberFormat {
+	return s.numberFormat
+}
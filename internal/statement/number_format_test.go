@@ -0,0 +1,46 @@
+package statement
+
+import "testing"
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		format NumberFormat
+		raw    string
+		want   string
+	}{
+		{format: NumberFormatDot, raw: "1,234.56", want: "1234.56"},
+		{format: NumberFormatDot, raw: " 5,000,000 ", want: "5000000"},
+		{format: NumberFormatComma, raw: "1.234,56", want: "1234.56"},
+		{format: NumberFormatComma, raw: "5.000.000", want: "5000000"},
+		{format: NumberFormatAuto, raw: "1,234.56", want: "1234.56"},
+		{format: NumberFormatAuto, raw: "1.234,56", want: "1234.56"},
+		{format: NumberFormatAuto, raw: "1234,5", want: "1234.5"},
+		{format: NumberFormatAuto, raw: "1.234.567", want: "1234567"},
+		// Ambiguous amounts are read with a decimal dot.
+		{format: NumberFormatAuto, raw: "1,234", want: "1234"},
+		{format: NumberFormatAuto, raw: "1.5", want: "1.5"},
+		// The default format reads a decimal dot, as before the formats were configurable.
+		{format: "", raw: "1,234.56", want: "1234.56"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format)+" "+tt.raw, func(t *testing.T) {
+			got, err := tt.format.ParseAmount(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseAmount(%q) error = %v", tt.raw, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("ParseAmount(%q) = %s, want %s", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNumberFormat(t *testing.T) {
+	if got, err := ParseNumberFormat(" comma "); err != nil || got != NumberFormatComma {
+		t.Errorf("ParseNumberFormat(comma) = %s, %v, want %s", got, err, NumberFormatComma)
+	}
+	if _, err := ParseNumberFormat("space"); err == nil {
+		t.Error("ParseNumberFormat(space) error = nil, want an invalid number format")
+	}
+}
@@ -0,0 +1,13 @@
+package statement
+
+import "time"
+
+// PartialFinalMonthStart returns the first day of the final month of a statement ending at the given date,
+// ok is false if the statement ends on the last day of the month.
+func PartialFinalMonthStart(endedAt time.Time) (start time.Time, ok bool) {
+	if endedAt.IsZero() || endedAt.AddDate(0, 0, 1).Month() != endedAt.Month() {
+		return time.Time{}, false
+	}
+
+	return time.Date(endedAt.Year(), endedAt.Month(), 1, 0, 0, 0, 0, endedAt.Location()), true
+}
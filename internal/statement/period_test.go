@@ -0,0 +1,29 @@
+package statement
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartialFinalMonthStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		endedAt   time.Time
+		wantStart time.Time
+		wantOK    bool
+	}{
+		{name: "ends mid-month", endedAt: time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC), wantStart: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), wantOK: true},
+		{name: "ends on the last day", endedAt: time.Date(2025, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{name: "ends on the last day of a leap february", endedAt: time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "no end", endedAt: time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, ok := PartialFinalMonthStart(tt.endedAt)
+			if ok != tt.wantOK || !start.Equal(tt.wantStart) {
+				t.Errorf("PartialFinalMonthStart() = %v, %v, want %v, %v", start, ok, tt.wantStart, tt.wantOK)
+			}
+		})
+	}
+}
@@ -23,8 +23,13 @@ import (
 )
 
 type Service struct {
-	db   *sql.DB
-	zlog *zap.Logger
+	db           *sql.DB
+	zlog         *zap.Logger
+	layout       StatementLayout
+	numberFormat NumberFormat
+
+	// fileRetention is how long the statement files no longer referenced by any calculation are kept.
+	fileRetention time.Duration
 }
 
 func NewService(_ context.Context, db *sql.DB, zlog *zap.Logger) (*Service, error) {
@@ -36,8 +41,12 @@ func NewService(_ context.Context, db *sql.DB, zlog *zap.Logger) (*Service, erro
 	}
 
 	return &Service{
-		db:   db,
-		zlog: zlog,
+		db:           db,
+		zlog:         zlog,
+		layout:       DefaultStatementLayout,
+		numberFormat: DefaultNumberFormat,
+
+		fileRetention: DefaultFileRetention,
 	}, nil
 }
 
@@ -0,0 +1,55 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// DecimalFormat is how the decimal fields, e.g. the monetary amounts, are written in JSON.
+// The format applies to every decimal of the API responses, so a client always gets the same representation.
+// The Excel exports are not affected, the cells being numbers.
+type DecimalFormat string
+
+const (
+	// DecimalFormatString writes the decimals as strings, e.g. "1234.56", keeping their exact value.
+	DecimalFormatString DecimalFormat = "STRING"
+
+	// DecimalFormatNumber writes the decimals as numbers, e.g. 1234.56.
+	// Clients decoding numbers as floats may lose the precision of large or long amounts.
+	DecimalFormatNumber DecimalFormat = "NUMBER"
+)
+
+// DefaultDecimalFormat is the decimal format used when no other format is configured.
+const DefaultDecimalFormat = DecimalFormatString
+
+// ParseDecimalFormat parses the decimal format of the given name, e.g. "number".
+func ParseDecimalFormat(s string) (DecimalFormat, error) {
+	f := DecimalFormat(strings.ToUpper(strings.TrimSpace(s)))
+	switch f {
+	case DecimalFormatString, DecimalFormatNumber:
+		return f, nil
+	}
+
+	return "", fmt.Errorf("invalid decimal format %q, must be one of %s or %s", s, DecimalFormatString, DecimalFormatNumber)
+}
+
+func (f DecimalFormat) String() string {
+	return string(f)
+}
+
+// SetDecimalFormat sets how the decimals are written in JSON. Empty resets it to DefaultDecimalFormat.
+// Both formats are read back, so the breakdowns stored as JSON remain readable after a change.
+// It must be called before serving the requests.
+func SetDecimalFormat(f DecimalFormat) {
+	decimal.MarshalJSONWithoutQuotes = f == DecimalFormatNumber
+}
+
+// CurrentDecimalFormat returns how the decimals are written in JSON, see SetDecimalFormat.
+func CurrentDecimalFormat() DecimalFormat {
+	if decimal.MarshalJSONWithoutQuotes {
+		return DecimalFormatNumber
+	}
+	return DecimalFormatString
+}
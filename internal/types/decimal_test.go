@@ -0,0 +1,84 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseDecimalFormat(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    DecimalFormat
+		wantErr bool
+	}{
+		{in: "STRING", want: DecimalFormatString},
+		{in: " number ", want: DecimalFormatNumber},
+		{in: "float", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDecimalFormat(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDecimalFormat() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDecimalFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetDecimalFormat(t *testing.T) {
+	t.Cleanup(func() { SetDecimalFormat(DefaultDecimalFormat) })
+
+	type amounts struct {
+		MonthlyNetIncome decimal.Decimal `json:"monthlyNetIncome"`
+	}
+	in := amounts{MonthlyNetIncome: decimal.RequireFromString("1234567.89")}
+
+	tests := []struct {
+		format DecimalFormat
+		want   string
+	}{
+		{format: DecimalFormatString, want: `{"monthlyNetIncome":"1234567.89"}`},
+		{format: DecimalFormatNumber, want: `{"monthlyNetIncome":1234567.89}`},
+		{format: "", want: `{"monthlyNetIncome":"1234567.89"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			SetDecimalFormat(tt.format)
+
+			b, err := json.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", b, tt.want)
+			}
+
+			// Both formats are read back whatever the current one.
+			for _, stored := range []string{`{"monthlyNetIncome":"1234567.89"}`, `{"monthlyNetIncome":1234567.89}`} {
+				var out amounts
+				if err := json.Unmarshal([]byte(stored), &out); err != nil {
+					t.Fatalf("Unmarshal(%s) error = %v", stored, err)
+				}
+				if !out.MonthlyNetIncome.Equal(in.MonthlyNetIncome) {
+					t.Errorf("Unmarshal(%s) = %s, want %s", stored, out.MonthlyNetIncome, in.MonthlyNetIncome)
+				}
+			}
+
+			want := tt.format
+			if want == "" {
+				want = DefaultDecimalFormat
+			}
+			if got := CurrentDecimalFormat(); got != want {
+				t.Errorf("CurrentDecimalFormat() = %q, want %q", got, want)
+			}
+		})
+	}
+}
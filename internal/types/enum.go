@@ -0,0 +1,49 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EnumError is returned when a value cannot be parsed into an enum type.
+// It lists the valid options so that the caller can correct the value.
+type EnumError struct {
+	Name    string
+	Value   string
+	Options []string
+}
+
+// NewEnumError returns an EnumError with the options sorted alphabetically.
+// The UNSPECIFIED option is never listed since it is not a valid input.
+func NewEnumError[T ~int](name, value string, options map[string]T) *EnumError {
+	opts := make([]string, 0, len(options))
+	for k := range options {
+		if k == "UNSPECIFIED" {
+			continue
+		}
+		opts = append(opts, k)
+	}
+	sort.Strings(opts)
+
+	return &EnumError{
+		Name:    name,
+		Value:   value,
+		Options: opts,
+	}
+}
+
+func (e *EnumError) Error() string {
+	return fmt.Sprintf("invalid %s: %q, must be one of %s", e.Name, e.Value, strings.Join(e.Options, ", "))
+}
+
+// UnquoteEnum returns the value of a JSON enum with the quotes removed.
+// It reports false when the value is null.
+func UnquoteEnum(b []byte) (string, bool) {
+	s := strings.TrimSpace(string(b))
+	if s == "null" {
+		return "", false
+	}
+
+	return strings.Trim(s, `"`), true
+}
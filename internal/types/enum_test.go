@@ -0,0 +1,69 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestProductTypeUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ProductType
+		wantErr bool
+	}{
+		{in: `"SA"`, want: ProductSA},
+		{in: `" pl "`, want: ProductPL},
+		{in: `2`, want: ProductSF},
+		{in: `null`, want: ProductUnSpecified},
+		{in: `"XX"`, wantErr: true},
+		{in: `9`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var p ProductType
+			err := json.Unmarshal([]byte(tt.in), &p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && p != tt.want {
+				t.Errorf("Unmarshal() = %v, want %v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnknownProductListsOptions(t *testing.T) {
+	var req struct {
+		Product ProductType `json:"product"`
+	}
+	err := json.Unmarshal([]byte(`{"product":"XX"}`), &req)
+
+	var enumErr *EnumError
+	if !errors.As(err, &enumErr) {
+		t.Fatalf("Unmarshal() error = %v, want an *EnumError", err)
+	}
+	if enumErr.Name != "product" || enumErr.Value != "XX" {
+		t.Errorf("EnumError = %s %q, want product \"XX\"", enumErr.Name, enumErr.Value)
+	}
+	if want := []string{"PL", "SA", "SF"}; !slices.Equal(enumErr.Options, want) {
+		t.Errorf("options = %v, want %v", enumErr.Options, want)
+	}
+	if got, want := enumErr.Error(), `invalid product: "XX", must be one of PL, SA, SF`; got != want {
+		t.Errorf("Error() = %s, want %s", got, want)
+	}
+}
+
+func TestAnalysisStatusUnmarshalJSON(t *testing.T) {
+	var s AnalysisStatus
+	if err := json.Unmarshal([]byte(`"completed"`), &s); err != nil || s.String() != "COMPLETED" {
+		t.Errorf("Unmarshal() = %v, %v, want COMPLETED", s, err)
+	}
+
+	var enumErr *EnumError
+	if err := json.Unmarshal([]byte(`"DONE"`), &s); !errors.As(err, &enumErr) || enumErr.Name != "status" {
+		t.Errorf("Unmarshal() error = %v, want an *EnumError of the status", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type ProductType int
@@ -41,22 +42,35 @@ func (p ProductType) MarshalJSON() ([]byte, error) {
 }
 
 func (p *ProductType) UnmarshalJSON(b []byte) error {
-	if string(b) == "null" {
+	v, ok := UnquoteEnum(b)
+	if !ok {
 		return nil
 	}
 
-	b = b[1 : len(b)-1]
-	if t, ok := productValues[string(b)]; ok {
-		*p = t
-		return nil
+	t, err := ParseProductType(v)
+	if err != nil {
+		return err
 	}
 
-	if t, err := strconv.Atoi(string(b)); err == nil {
-		*p = ProductType(t)
-		return nil
+	*p = t
+	return nil
+}
+
+// ParseProductType parses the name or the number of a product.
+// It returns an *EnumError listing the valid products if s is not a known product.
+func ParseProductType(s string) (ProductType, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if t, ok := productValues[s]; ok {
+		return t, nil
+	}
+
+	if t, err := strconv.Atoi(s); err == nil {
+		if _, ok := productNames[ProductType(t)]; ok {
+			return ProductType(t), nil
+		}
 	}
 
-	return fmt.Errorf("invalid product: %s", string(b))
+	return ProductUnSpecified, NewEnumError("product", s, productValues)
 }
 
 func (p *ProductType) Scan(src any) error {
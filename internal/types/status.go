@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strconv"
+	"strings"
 )
 
 type AnalysisStatus int
@@ -38,22 +39,24 @@ func (s AnalysisStatus) MarshalJSON() ([]byte, error) {
 }
 
 func (s *AnalysisStatus) UnmarshalJSON(b []byte) error {
-	if string(b) == "null" {
+	v, ok := UnquoteEnum(b)
+	if !ok {
 		return nil
 	}
 
-	b = b[1 : len(b)-1]
-	if v, ok := statusValues[string(b)]; ok {
-		*s = v
+	if t, ok := statusValues[strings.ToUpper(v)]; ok {
+		*s = t
 		return nil
 	}
 
-	if v, err := strconv.Atoi(string(b)); err == nil {
-		*s = AnalysisStatus(v)
-		return nil
+	if t, err := strconv.Atoi(v); err == nil {
+		if _, ok := statusNames[AnalysisStatus(t)]; ok {
+			*s = AnalysisStatus(t)
+			return nil
+		}
 	}
 
-	return fmt.Errorf("invalid status: %s", string(b))
+	return NewEnumError("status", v, statusValues)
 }
 
 func (s AnalysisStatus) Value() (driver.Value, error) {
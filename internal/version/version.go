@@ -0,0 +1,33 @@
+// Package version holds the build information of the binary, injected at build time, e.g.
+//
+//	go build -ldflags "-X github.com/10664kls/automatic-finance-api/internal/version.Version=v1.2.0 \
+//		-X github.com/10664kls/automatic-finance-api/internal/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/10664kls/automatic-finance-api/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd
+package version
+
+var (
+	// Version is the version of the build, e.g. v1.2.0.
+	Version = "dev"
+
+	// Commit is the git commit the build was made from.
+	Commit = "unknown"
+
+	// BuildTime is when the build was made, in RFC 3339.
+	BuildTime = "unknown"
+)
+
+// Info is the build information of the binary.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"buildTime"`
+}
+
+// Get returns the build information of the binary.
+func Get() Info {
+	return Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+	}
+}
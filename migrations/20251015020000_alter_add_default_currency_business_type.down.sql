@@ -0,0 +1,2 @@
+ALTER TABLE business_type
+  DROP COLUMN default_currency;
@@ -0,0 +1,2 @@
+ALTER TABLE business_type
+  ADD default_currency VARCHAR(10) NOT NULL DEFAULT '';
@@ -0,0 +1,6 @@
+DROP INDEX uq_statement_file_analysis_number ON statement_file_analysis;
+
+DROP INDEX uq_cib_file_analysis_number ON cib_file_analysis;
+CREATE INDEX idx_cib_file_analysis_number ON cib_file_analysis(number);
+
+DROP INDEX uq_self_employed_analysis_number ON self_employed_analysis;
@@ -0,0 +1,18 @@
+-- The numbers were not unique before this migration. Fail before changing any index
+-- when a table holds duplicates, they must be resolved by hand, e.g. listed with
+-- SELECT number, COUNT(*) FROM <table> GROUP BY number HAVING COUNT(*) > 1;
+IF EXISTS (SELECT number FROM statement_file_analysis GROUP BY number HAVING COUNT(*) > 1)
+    THROW 50000, 'statement_file_analysis has duplicate numbers, resolve them before creating uq_statement_file_analysis_number', 1;
+
+IF EXISTS (SELECT number FROM cib_file_analysis GROUP BY number HAVING COUNT(*) > 1)
+    THROW 50000, 'cib_file_analysis has duplicate numbers, resolve them before creating uq_cib_file_analysis_number', 1;
+
+IF EXISTS (SELECT number FROM self_employed_analysis GROUP BY number HAVING COUNT(*) > 1)
+    THROW 50000, 'self_employed_analysis has duplicate numbers, resolve them before creating uq_self_employed_analysis_number', 1;
+
+CREATE UNIQUE INDEX uq_statement_file_analysis_number ON statement_file_analysis(number);
+
+DROP INDEX idx_cib_file_analysis_number ON cib_file_analysis;
+CREATE UNIQUE INDEX uq_cib_file_analysis_number ON cib_file_analysis(number);
+
+CREATE UNIQUE INDEX uq_self_employed_analysis_number ON self_employed_analysis(number);
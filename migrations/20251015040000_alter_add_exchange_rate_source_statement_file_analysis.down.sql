@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  DROP COLUMN exchange_rate_source;
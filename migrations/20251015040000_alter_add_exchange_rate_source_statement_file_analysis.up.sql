@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  ADD exchange_rate_source VARCHAR(20) NOT NULL DEFAULT '';
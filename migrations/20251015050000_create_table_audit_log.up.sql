@@ -0,0 +1,11 @@
+CREATE TABLE audit_log(
+  id int IDENTITY(1,1) PRIMARY KEY,
+  action VARCHAR(100) NOT NULL,
+  resource VARCHAR(100) NOT NULL DEFAULT '',
+  detail NVARCHAR(MAX) NOT NULL DEFAULT '',
+  created_by NVARCHAR(150) NOT NULL DEFAULT '',
+  created_at DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET()
+);
+
+CREATE INDEX idx_audit_log_action ON audit_log (action);
+CREATE INDEX idx_audit_log_created_at ON audit_log (created_at);
@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  ADD other_income_cap_percentage DECIMAL(5, 2) NOT NULL DEFAULT 0.00;
@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  ADD completed_at DATETIMEOFFSET NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE statement_file_analysis
+  ADD salary_variation DECIMAL(10, 4) NOT NULL DEFAULT 0.00,
+      salary_volatile BIT NOT NULL DEFAULT 0;
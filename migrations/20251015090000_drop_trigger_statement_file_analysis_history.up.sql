@@ -0,0 +1,3 @@
+-- The history is now written by the application on every save,
+-- so that the actor is the user rather than the database login.
+DROP TRIGGER IF EXISTS trg_statement_file_analysis_update;
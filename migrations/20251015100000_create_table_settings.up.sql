@@ -0,0 +1,6 @@
+CREATE TABLE settings(
+  name VARCHAR(100) PRIMARY KEY,
+  value NVARCHAR(200) NOT NULL,
+  updated_by NVARCHAR(150) NOT NULL DEFAULT '',
+  updated_at DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET()
+);
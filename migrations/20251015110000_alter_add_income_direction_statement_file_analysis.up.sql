@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  ADD income_direction VARCHAR(20) NOT NULL DEFAULT 'CREDITS';
@@ -0,0 +1,4 @@
+ALTER TABLE "user"
+  ADD role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+EXEC('UPDATE "user" SET role = ''admin'' WHERE is_admin = 1');
@@ -0,0 +1,9 @@
+CREATE TABLE login_history(
+  id BIGINT IDENTITY(1,1) PRIMARY KEY,
+  email NVARCHAR(150) NOT NULL,
+  succeeded BIT NOT NULL DEFAULT 0,
+  ip_address VARCHAR(45) NOT NULL DEFAULT '',
+  created_at DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET()
+);
+
+CREATE INDEX idx_login_history_email_created_at ON login_history (email, created_at);
@@ -0,0 +1 @@
+ALTER TABLE settings ALTER COLUMN value NVARCHAR(200) NOT NULL;
@@ -0,0 +1 @@
+ALTER TABLE settings ALTER COLUMN value NVARCHAR(MAX) NOT NULL;
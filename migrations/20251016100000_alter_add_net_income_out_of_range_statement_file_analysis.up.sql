@@ -0,0 +1,2 @@
+ALTER TABLE statement_file_analysis
+  ADD net_income_out_of_range BIT NOT NULL DEFAULT 0;
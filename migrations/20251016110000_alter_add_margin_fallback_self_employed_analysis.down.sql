@@ -0,0 +1,2 @@
+ALTER TABLE self_employed_analysis
+  DROP COLUMN margin_fallback;
@@ -0,0 +1,2 @@
+ALTER TABLE self_employed_analysis
+  ADD margin_fallback BIT NOT NULL DEFAULT 0;
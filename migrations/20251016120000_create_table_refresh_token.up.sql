@@ -0,0 +1,10 @@
+CREATE TABLE refresh_token(
+  id VARCHAR(25) NOT NULL PRIMARY KEY, -- The token ID (jti) shared by the access and refresh tokens of a pair.
+  user_id VARCHAR(25) NOT NULL,
+  expires_at DATETIMEOFFSET NOT NULL,
+  used_at DATETIMEOFFSET NULL,
+  revoked_at DATETIMEOFFSET NULL,
+  created_at DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET()
+);
+
+CREATE INDEX idx_refresh_token_user_id ON refresh_token (user_id);
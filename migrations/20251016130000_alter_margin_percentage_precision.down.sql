@@ -0,0 +1,2 @@
+ALTER TABLE business_type ALTER COLUMN margin_percentage DECIMAL(5, 2) NOT NULL;
+ALTER TABLE self_employed_analysis ALTER COLUMN margin_percentage DECIMAL(5, 2) NOT NULL;
@@ -0,0 +1,3 @@
+-- The margin percentages keep fractional basis points, the exports round them for display.
+ALTER TABLE business_type ALTER COLUMN margin_percentage DECIMAL(9, 6) NOT NULL;
+ALTER TABLE self_employed_analysis ALTER COLUMN margin_percentage DECIMAL(9, 6) NOT NULL;
@@ -0,0 +1 @@
+DROP TABLE income_wordlist_usage;
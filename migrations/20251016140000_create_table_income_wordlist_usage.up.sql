@@ -0,0 +1,6 @@
+CREATE TABLE income_wordlist_usage(
+  wordlist_id INT NOT NULL,
+  usage_date DATE NOT NULL, -- The day the transactions were matched, the usage is counted by day.
+  matched_count BIGINT NOT NULL DEFAULT 0,
+  PRIMARY KEY (wordlist_id, usage_date)
+);
@@ -0,0 +1,4 @@
+ALTER TABLE "user"
+  DROP CONSTRAINT df_user_password_history;
+ALTER TABLE "user"
+  DROP COLUMN password_history;
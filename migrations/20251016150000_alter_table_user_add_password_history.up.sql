@@ -0,0 +1,3 @@
+-- The JSON array of the bcrypt hashes of the previous passwords, the most recent first.
+ALTER TABLE "user"
+  ADD password_history NVARCHAR(MAX) NOT NULL CONSTRAINT df_user_password_history DEFAULT '[]';
@@ -0,0 +1,2 @@
+ALTER TABLE self_employed_analysis
+  ADD partial_final_month_excluded BIT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+ALTER TABLE "user"
+  DROP CONSTRAINT df_user_purged_by;
+ALTER TABLE "user"
+  DROP COLUMN purged_by, purged_at;
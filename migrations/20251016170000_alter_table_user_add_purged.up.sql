@@ -0,0 +1,3 @@
+ALTER TABLE "user"
+  ADD purged_by NVARCHAR(150) NOT NULL CONSTRAINT df_user_purged_by DEFAULT '',
+    purged_at DATETIMEOFFSET NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE cib_file_analysis
+  DROP COLUMN extraction_confidence;
@@ -0,0 +1,3 @@
+-- The confidence of the extracted fields, NULL when the extractor provides none.
+ALTER TABLE cib_file_analysis
+  ADD extraction_confidence NVARCHAR(MAX) NULL;
@@ -0,0 +1 @@
+DROP TABLE currency_rate_history;
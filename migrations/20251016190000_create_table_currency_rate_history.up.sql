@@ -0,0 +1,17 @@
+CREATE TABLE currency_rate_history(
+  id BIGINT IDENTITY(1,1) PRIMARY KEY,
+  currency_id VARCHAR(25) NOT NULL,
+  rate DECIMAL(10, 2) NOT NULL,
+  effective_at DATETIMEOFFSET NOT NULL,
+  created_by NVARCHAR(150) NOT NULL DEFAULT '',
+  created_at DATETIMEOFFSET NOT NULL DEFAULT SYSDATETIMEOFFSET(),
+  CONSTRAINT fk_currency_rate_history_currency FOREIGN KEY (currency_id) REFERENCES currency(id)
+);
+
+CREATE INDEX idx_currency_rate_history_currency_id_effective_at ON currency_rate_history (currency_id, effective_at);
+
+-- The current rate of each currency, effective since its last update. The rates before it are not seeded,
+-- currency_updated_history records the creation time of the currency instead of the time of the update.
+INSERT INTO currency_rate_history (currency_id, rate, effective_at, created_by)
+SELECT id, exchange_rate, updated_at, updated_by
+FROM currency;
@@ -0,0 +1,4 @@
+ALTER TABLE cib_file_analysis
+  DROP CONSTRAINT df_cib_file_analysis_base_currency;
+ALTER TABLE cib_file_analysis
+  DROP COLUMN base_currency;
@@ -0,0 +1,3 @@
+-- The base currency of the installments, empty for the calculations saved before it was recorded.
+ALTER TABLE cib_file_analysis
+  ADD base_currency VARCHAR(3) NOT NULL CONSTRAINT df_cib_file_analysis_base_currency DEFAULT '';